@@ -0,0 +1,25 @@
+package backup
+
+import "io"
+
+type mockLogger struct{}
+
+func (m *mockLogger) Trace(s string, i ...interface{})    {}
+func (m *mockLogger) Debug(s string, i ...interface{})    {}
+func (m *mockLogger) Info(s string, i ...interface{})     {}
+func (m *mockLogger) Warn(s string, i ...interface{})     {}
+func (m *mockLogger) Error(s string, i ...interface{})    {}
+func (m *mockLogger) Critical(s string, i ...interface{}) {}
+
+// mockBackuper writes data and then returns err.
+type mockBackuper struct {
+	data []byte
+	err  error
+}
+
+func (m *mockBackuper) Backup(w io.Writer) error {
+	if _, err := w.Write(m.data); err != nil {
+		return err
+	}
+	return m.err
+}
@@ -0,0 +1,144 @@
+// Package backup periodically saves snapshots of the Controller's database to a directory.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+const (
+	snapshotPrefix = "encodarr-backup-"
+	snapshotSuffix = ".db"
+
+	// snapshotTimeFormat sorts the same alphabetically and chronologically, which rotation relies on.
+	snapshotTimeFormat = "20060102-150405"
+)
+
+// NewScheduler returns a new Scheduler which saves a snapshot to dir every interval and keeps the newest keep snapshots.
+func NewScheduler(logger controller.Logger, backuper controller.DatabaseBackuper, dir string, interval time.Duration, keep int) Scheduler {
+	return Scheduler{
+		logger:   logger,
+		backuper: backuper,
+		dir:      dir,
+		interval: interval,
+		keep:     keep,
+		now:      time.Now,
+	}
+}
+
+// Scheduler saves snapshots of the database on an interval and deletes the old ones.
+type Scheduler struct {
+	logger   controller.Logger
+	backuper controller.DatabaseBackuper
+	dir      string
+	interval time.Duration
+	keep     int
+
+	now func() time.Time
+}
+
+// Start starts saving snapshots without blocking the thread. The first snapshot is saved after one interval.
+func (s *Scheduler) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			filename, err := s.Snapshot()
+			if errors.Is(err, controller.ErrBackupNotSupported) {
+				s.logger.Warn("Stopping scheduled backups: %v", err)
+				return
+			} else if err != nil {
+				s.logger.Error("scheduled backup failed: %v", err)
+				continue
+			}
+			s.logger.Info("Saved database backup to %v", filename)
+		}
+	}()
+}
+
+// Snapshot saves a verified snapshot of the database to the directory and then deletes all but the newest snapshots.
+// The snapshot is written to a temporary file first, so a failed backup never leaves a partial snapshot behind.
+func (s *Scheduler) Snapshot() (filename string, err error) {
+	if err = os.MkdirAll(s.dir, 0777); err != nil {
+		return "", err
+	}
+
+	filename = filepath.Join(s.dir, snapshotPrefix+s.now().Format(snapshotTimeFormat)+snapshotSuffix)
+	tmpFilename := filename + ".tmp"
+
+	f, err := os.Create(tmpFilename)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.backuper.Backup(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFilename)
+		return "", err
+	}
+
+	if err = os.Rename(tmpFilename, filename); err != nil {
+		os.Remove(tmpFilename)
+		return "", err
+	}
+
+	if err = s.rotate(); err != nil {
+		s.logger.Error("failed to delete old backups: %v", err)
+	}
+
+	return filename, nil
+}
+
+// rotate deletes every snapshot in the directory except for the newest s.keep.
+func (s *Scheduler) rotate() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	snapshots := make([]string, 0)
+	for _, v := range entries {
+		if !v.IsDir() && strings.HasPrefix(v.Name(), snapshotPrefix) && strings.HasSuffix(v.Name(), snapshotSuffix) {
+			snapshots = append(snapshots, v.Name())
+		}
+	}
+
+	if len(snapshots) <= s.keep {
+		return nil
+	}
+	sort.Strings(snapshots)
+
+	var errs []string
+	for _, v := range snapshots[:len(snapshots)-s.keep] {
+		if err = os.Remove(filepath.Join(s.dir, v)); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return nil
+}
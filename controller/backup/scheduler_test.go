@@ -0,0 +1,64 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRotation(t *testing.T) {
+	dir := t.TempDir()
+	backuper := &mockBackuper{data: []byte("snapshot")}
+
+	s := NewScheduler(&mockLogger{}, backuper, dir, time.Hour, 2)
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	// Files that aren't snapshots must never be rotated away
+	if err := os.WriteFile(dir+"/notes.txt", []byte("keep me"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Snapshot(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		now = now.Add(time.Hour)
+	}
+
+	// A failed backup doesn't leave anything behind or rotate away a good snapshot
+	backuper.err = errors.New("snapshot failed the integrity check")
+	if _, err := s.Snapshot(); err == nil {
+		t.Errorf("expected the failed backup to return an error")
+	}
+
+	expected := []string{"encodarr-backup-20210801-130000.db", "encodarr-backup-20210801-140000.db", "notes.txt"}
+	if got := dirNames(t, dir); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v but got %v", expected, got)
+	}
+
+	b, err := os.ReadFile(dir + "/encodarr-backup-20210801-140000.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "snapshot" {
+		t.Errorf("expected the snapshot contents to be saved but got '%s'", b)
+	}
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, v := range entries {
+		names = append(names, v.Name())
+	}
+	return names
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/webapi"
+)
+
+// outputFormat is how commands print what they receive from the Controller.
+type outputFormat string
+
+const (
+	outputTable outputFormat = "table"
+	outputJSON  outputFormat = "json"
+)
+
+func (o outputFormat) valid() bool {
+	return o == outputTable || o == outputJSON
+}
+
+// rootCommand returns the tree of every command.
+func rootCommand() *command {
+	return &command{
+		name:  "encodarr-cli",
+		short: "encodarr-cli manages an Encodarr Controller through its web API.",
+		subcommands: []*command{
+			{
+				name:  "library",
+				short: "Show the libraries",
+				subcommands: []*command{
+					{name: "list", short: "List the libraries and how many jobs are queued in each.", run: libraryList},
+					{name: "drain", args: "<library id>", short: "Stop dispatching the jobs of a library. It is still scanned.", run: func(a *app, args []string) error { return libraryDrain(a, args, true) }},
+					{name: "undrain", args: "<library id>", short: "Dispatch the jobs of a drained library again.", run: func(a *app, args []string) error { return libraryDrain(a, args, false) }},
+				},
+			},
+			{
+				name:  "queue",
+				short: "Show the queued jobs",
+				subcommands: []*command{
+					queueListCommand(),
+					{name: "move", args: "<job uuid> <library id>", short: "Move a queued job to the end of another library's queue.", run: queueMove},
+				},
+			},
+			{
+				name:  "scan",
+				short: "Scan libraries",
+				subcommands: []*command{
+					{name: "trigger", args: "<library id>", short: "Start a scan of a library.", run: scanTrigger},
+					{name: "preview", args: "<library id>", short: "List the jobs a scan of a library would queue, without queueing them.", run: scanPreview},
+				},
+			},
+			{
+				name:  "history",
+				short: "Show the finished jobs",
+				subcommands: []*command{
+					historyTailCommand(),
+				},
+			},
+			{
+				name:  "runners",
+				short: "Show the Runners",
+				subcommands: []*command{
+					{name: "list", short: "List the Runners and the jobs they are running.", run: runnersList},
+				},
+			},
+			{
+				name:  "processing",
+				short: "Stop or resume all scans and dispatches",
+				subcommands: []*command{
+					{name: "status", short: "Show whether or not the Controller starts scans and dispatches jobs.", run: processingStatus},
+					{name: "disable", short: "Stop starting scans and dispatching jobs. Running scans and jobs finish.", run: func(a *app, args []string) error { return setProcessing(a, args, false) }},
+					{name: "enable", short: "Resume starting scans and dispatching jobs.", run: func(a *app, args []string) error { return setProcessing(a, args, true) }},
+				},
+			},
+		},
+	}
+}
+
+// libraryList prints every library.
+func libraryList(a *app, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	libs, err := libraries(a)
+	if err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, libs)
+	}
+	return writeTable(a.stdout, []string{"ID", "FOLDER", "PRIORITY", "CHECK INTERVAL", "QUEUED", "DRAINED"}, len(libs), func(i int) []string {
+		l := libs[i]
+		return []string{strconv.Itoa(l.ID), l.Folder, strconv.Itoa(l.Priority), l.FsCheckInterval, strconv.Itoa(len(l.Queue.Items)), strconv.FormatBool(l.Drained)}
+	})
+}
+
+// libraryDrain stops (drain) or resumes (undrain) the dispatching of the jobs of the library in args.
+func libraryDrain(a *app, args []string, drain bool) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errUsage
+	}
+
+	action := "Undrained"
+	if drain {
+		action = "Drained"
+		err = a.client.DrainLibrary(a.ctx, id)
+	} else {
+		err = a.client.UndrainLibrary(a.ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, struct {
+			LibraryID int  `json:"library_id"`
+			Drained   bool `json:"drained"`
+		}{id, drain})
+	}
+	_, err = fmt.Fprintf(a.stdout, "%v library %v\n", action, id)
+	return err
+}
+
+// queueListCommand returns the command which prints the queued jobs of one or every library, in the order of their queues.
+func queueListCommand() *command {
+	library := -1
+	return &command{
+		name:  "list",
+		short: "List the queued jobs of every library, or of one with --library.",
+		flags: func(fs *flag.FlagSet) {
+			fs.IntVar(&library, "library", -1, "only list the jobs of the library with this ID")
+		},
+		run: func(a *app, args []string) error { return queueList(a, args, library) },
+	}
+}
+
+// queueList prints the queued jobs of the library with the provided ID, or of every library if it is negative.
+func queueList(a *app, args []string, library int) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	var libs []webapi.Library
+	if library >= 0 {
+		lib, err := a.client.Library(a.ctx, library)
+		if err != nil {
+			return err
+		}
+		libs = []webapi.Library{lib}
+	} else {
+		var err error
+		if libs, err = libraries(a); err != nil {
+			return err
+		}
+	}
+
+	jobs := make([]controller.Job, 0)
+	for _, l := range libs {
+		for _, job := range l.Queue.Items {
+			job.LibraryID = l.ID
+			jobs = append(jobs, job)
+		}
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, jobs)
+	}
+	return writeTable(a.stdout, []string{"LIBRARY", "UUID", "PATH"}, len(jobs), func(i int) []string {
+		return []string{strconv.Itoa(jobs[i].LibraryID), string(jobs[i].UUID), jobs[i].Path}
+	})
+}
+
+// queueMove moves the queued job in args to the queue of the library in args.
+func queueMove(a *app, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	uuid := controller.UUID(args[0])
+	id, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errUsage
+	}
+
+	if err = a.client.MoveJob(a.ctx, uuid, id); err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, struct {
+			UUID      controller.UUID `json:"uuid"`
+			LibraryID int             `json:"library_id"`
+		}{uuid, id})
+	}
+	_, err = fmt.Fprintf(a.stdout, "Moved job %v to library %v\n", uuid, id)
+	return err
+}
+
+// scanTrigger asks the Controller to scan the library in args.
+func scanTrigger(a *app, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errUsage
+	}
+
+	if err = a.client.ScanLibrary(a.ctx, id); err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, struct {
+			LibraryID int  `json:"library_id"`
+			Requested bool `json:"requested"`
+		}{id, true})
+	}
+	_, err = fmt.Fprintf(a.stdout, "Requested a scan of library %v\n", id)
+	return err
+}
+
+// scanPreview prints the jobs which a scan of the library in args would queue.
+func scanPreview(a *app, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errUsage
+	}
+
+	jobs, err := a.client.PreviewScan(a.ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, webapi.ScanPreview{Jobs: jobs})
+	}
+	return writeTable(a.stdout, []string{"PATH", "COMMAND"}, len(jobs), func(i int) []string {
+		return []string{jobs[i].Path, strings.Join(jobs[i].Command, " ")}
+	})
+}
+
+// historyTailOptions are the flags of history tail.
+type historyTailOptions struct {
+	lines    int
+	follow   bool
+	interval time.Duration
+}
+
+// historyTailCommand returns the command which prints the last jobs in the history.
+func historyTailCommand() *command {
+	var opts historyTailOptions
+	return &command{
+		name:  "tail",
+		short: "Show the last jobs in the history, and with -f, every job which finishes afterwards.",
+		flags: func(fs *flag.FlagSet) {
+			fs.IntVar(&opts.lines, "n", 10, "how many of the last jobs to show")
+			fs.BoolVar(&opts.follow, "f", false, "keep showing the jobs which finish until interrupted")
+			fs.DurationVar(&opts.interval, "interval", 5*time.Second, "how often the history is checked with -f")
+		},
+		run: func(a *app, args []string) error { return historyTail(a, args, opts) },
+	}
+}
+
+// historyTail prints the last opts.lines jobs in the history. With opts.follow, it keeps checking the history
+// every opts.interval and prints the jobs which weren't in it yet, until the context is cancelled.
+// JSON output is one entry per line when following.
+func historyTail(a *app, args []string, opts historyTailOptions) error {
+	if len(args) != 0 || opts.lines < 0 || opts.interval <= 0 {
+		return errUsage
+	}
+
+	history, err := a.client.History(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(history))
+	for _, v := range history {
+		seen[historyKey(v)] = true
+	}
+	if len(history) > opts.lines {
+		history = history[len(history)-opts.lines:]
+	}
+
+	if !opts.follow {
+		if a.output == outputJSON {
+			return writeJSON(a.stdout, webapi.History{History: history})
+		}
+		return writeTable(a.stdout, historyHeader, len(history), func(i int) []string { return historyRow(history[i]) })
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 8, 2, ' ', 0)
+	printEntries := func(entries []webapi.HistoryEntry) error {
+		for _, v := range entries {
+			if a.output == outputJSON {
+				if err := json.NewEncoder(a.stdout).Encode(v); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintln(tw, strings.Join(historyRow(v), "\t"))
+		}
+		return tw.Flush()
+	}
+
+	if a.output == outputTable {
+		fmt.Fprintln(tw, strings.Join(historyHeader, "\t"))
+	}
+	if err = printEntries(history); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		latest, err := a.client.History(a.ctx)
+		if a.ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		added := make([]webapi.HistoryEntry, 0)
+		for _, v := range latest {
+			if k := historyKey(v); !seen[k] {
+				seen[k] = true
+				added = append(added, v)
+			}
+		}
+		if err = printEntries(added); err != nil {
+			return err
+		}
+	}
+}
+
+var historyHeader = []string{"COMPLETED", "FILE", "WARNINGS", "ERRORS"}
+
+func historyRow(h webapi.HistoryEntry) []string {
+	return []string{h.DateTimeCompleted, h.File, strconv.Itoa(len(h.Warnings)), strconv.Itoa(len(h.Errors))}
+}
+
+// historyKey identifies a history entry, which doesn't have an ID of its own.
+func historyKey(h webapi.HistoryEntry) string {
+	return h.DateTimeCompleted + "\x00" + h.File
+}
+
+// runnersList prints every Runner.
+func runnersList(a *app, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	runners, err := a.client.Runners(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, webapi.Runners{Runners: runners})
+	}
+	return writeTable(a.stdout, []string{"NAME", "VERSION", "ONLINE", "WAITING", "JOBS", "LAST SEEN"}, len(runners), func(i int) []string {
+		r := runners[i]
+		jobs := make([]string, len(r.CurrentJobs))
+		for j, v := range r.CurrentJobs {
+			jobs[j] = string(v)
+		}
+		return []string{r.DisplayName, r.Version, strconv.FormatBool(r.Online), strconv.FormatBool(r.Waiting), strings.Join(jobs, ","), r.LastSeen.Local().Format("2006-01-02 15:04:05")}
+	})
+}
+
+// processingStatus prints whether or not the Controller starts scans and dispatches jobs.
+func processingStatus(a *app, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	enabled, err := a.client.Processing(a.ctx)
+	if err != nil {
+		return err
+	}
+	return printProcessing(a, enabled)
+}
+
+// setProcessing stops or resumes the scans and dispatches of the Controller.
+func setProcessing(a *app, args []string, enabled bool) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	if err := a.client.SetProcessing(a.ctx, enabled); err != nil {
+		return err
+	}
+	return printProcessing(a, enabled)
+}
+
+func printProcessing(a *app, enabled bool) error {
+	if a.output == outputJSON {
+		return writeJSON(a.stdout, webapi.Processing{Enabled: enabled})
+	}
+
+	state := "disabled, no scans are started and no jobs are dispatched"
+	if enabled {
+		state = "enabled"
+	}
+	_, err := fmt.Fprintf(a.stdout, "Processing is %v\n", state)
+	return err
+}
+
+// libraries returns every library, in the order of their IDs.
+func libraries(a *app) ([]webapi.Library, error) {
+	ids, err := a.client.LibraryIDs(a.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	libs := make([]webapi.Library, 0, len(ids))
+	for _, id := range ids {
+		l, err := a.client.Library(a.ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("library %v: %w", id, err)
+		}
+		libs = append(libs, l)
+	}
+	return libs, nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeTable writes the header and rows aligned in columns. row returns the cells of the i-th of n rows.
+func writeTable(w io.Writer, header []string, n int, row func(i int) []string) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for i := 0; i < n; i++ {
+		fmt.Fprintln(tw, strings.Join(row(i), "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,240 @@
+// encodarr-cli is a command-line client for the web API of an Encodarr Controller.
+//
+// The Controller's URL and API key are read from the --url and --api-key flags, the ENCODARR_URL and ENCODARR_API_KEY
+// environment variables, or the config file, in that order. The config file is a JSON object with url and api_key
+// keys, which is read from --config, ENCODARR_CLI_CONFIG, or <user config dir>/encodarr/cli.json.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/BrenekH/encodarr/controller/webapi"
+)
+
+const (
+	defaultURL = "http://localhost:8123"
+
+	// Exit codes
+	exitError = 1 // The command failed, including when the Controller responded with an error.
+	exitUsage = 2 // The command line is invalid.
+)
+
+// errUsage is returned by commands whose arguments are invalid. The usage of the command is printed along with it.
+var errUsage = errors.New("invalid usage")
+
+// config is the contents of the config file.
+type config struct {
+	URL    string `json:"url"`
+	APIKey string `json:"api_key"`
+}
+
+// app is what the commands run with.
+type app struct {
+	ctx    context.Context
+	client webapi.Client
+	output outputFormat
+	stdout io.Writer
+}
+
+// command is a command or a group of subcommands. Commands with subcommands don't have a run func.
+type command struct {
+	name        string
+	args        string // The positional arguments of the command, shown in its usage.
+	short       string
+	subcommands []*command
+
+	// flags registers the command's own flags, if it has any.
+	flags func(fs *flag.FlagSet)
+	run   func(a *app, args []string) error
+}
+
+// commonFlags are accepted by every command.
+type commonFlags struct {
+	url        string
+	apiKey     string
+	configPath string
+	output     string
+}
+
+func (c *commonFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.url, "url", c.url, "URL of the Controller (env ENCODARR_URL)")
+	fs.StringVar(&c.apiKey, "api-key", c.apiKey, "API key sent to the Controller (env ENCODARR_API_KEY)")
+	fs.StringVar(&c.configPath, "config", c.configPath, "path of the config file (env ENCODARR_CLI_CONFIG)")
+	fs.StringVar(&c.output, "output", c.output, "output format, table or json")
+	fs.StringVar(&c.output, "o", c.output, "shorthand for --output")
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command in args and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	root := rootCommand()
+	common := commonFlags{output: string(outputTable)}
+
+	fs := flag.NewFlagSet(root.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	common.register(fs)
+	fs.Usage = func() { printUsage(stderr, []*command{root}, fs) }
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil {
+		return exitUsage
+	}
+
+	// Find the command, printing the usage of the group that the path stops at
+	path := []*command{root}
+	args = fs.Args()
+	for len(path[len(path)-1].subcommands) > 0 {
+		cmd := path[len(path)-1]
+		if len(args) == 0 {
+			printUsage(stderr, path, nil)
+			return exitUsage
+		}
+		next := findSubcommand(cmd, args[0])
+		if next == nil {
+			fmt.Fprintf(stderr, "Unknown command %q\n\n", strings.Join(append(commandNames(path), args[0]), " "))
+			printUsage(stderr, path, nil)
+			return exitUsage
+		}
+		path = append(path, next)
+		args = args[1:]
+	}
+
+	cmd := path[len(path)-1]
+	cmdFlags := flag.NewFlagSet(strings.Join(commandNames(path), " "), flag.ContinueOnError)
+	cmdFlags.SetOutput(stderr)
+	common.register(cmdFlags)
+	if cmd.flags != nil {
+		cmd.flags(cmdFlags)
+	}
+	cmdFlags.Usage = func() { printUsage(stderr, path, cmdFlags) }
+	if err := cmdFlags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil {
+		return exitUsage
+	}
+
+	output := outputFormat(common.output)
+	if !output.valid() {
+		fmt.Fprintf(stderr, "Invalid output format %q, expected table or json\n", common.output)
+		return exitUsage
+	}
+
+	url, apiKey, err := resolveConnection(common)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	a := &app{ctx: ctx, client: webapi.NewClient(url, apiKey), output: output, stdout: stdout}
+	if err = cmd.run(a, cmdFlags.Args()); errors.Is(err, errUsage) {
+		printUsage(stderr, path, cmdFlags)
+		return exitUsage
+	} else if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitError
+	}
+	return 0
+}
+
+// resolveConnection returns the URL and API key of the Controller from the flags, the environment, or the config file.
+func resolveConnection(common commonFlags) (url, apiKey string, err error) {
+	cfg, err := readConfig(common.configPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	url = firstNonEmpty(common.url, os.Getenv("ENCODARR_URL"), cfg.URL, defaultURL)
+	apiKey = firstNonEmpty(common.apiKey, os.Getenv("ENCODARR_API_KEY"), cfg.APIKey)
+	return url, apiKey, nil
+}
+
+// readConfig reads the config file at path, or at the default location if path and ENCODARR_CLI_CONFIG are empty.
+// A missing file at the default location isn't an error.
+func readConfig(path string) (config, error) {
+	path = firstNonEmpty(path, os.Getenv("ENCODARR_CLI_CONFIG"))
+	explicit := path != ""
+	if !explicit {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return config{}, nil
+		}
+		path = filepath.Join(dir, "encodarr", "cli.json")
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return config{}, nil
+	} else if err != nil {
+		return config{}, fmt.Errorf("reading the config file: %w", err)
+	}
+
+	var cfg config
+	if err = json.Unmarshal(b, &cfg); err != nil {
+		return config{}, fmt.Errorf("reading the config file %v: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func findSubcommand(cmd *command, name string) *command {
+	for _, v := range cmd.subcommands {
+		if v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+func commandNames(path []*command) []string {
+	names := make([]string, len(path))
+	for i, v := range path {
+		names[i] = v.name
+	}
+	return names
+}
+
+// printUsage prints the usage of the last command in path, followed by its subcommands or the defaults of fs.
+func printUsage(w io.Writer, path []*command, fs *flag.FlagSet) {
+	cmd := path[len(path)-1]
+	name := strings.Join(commandNames(path), " ")
+
+	if len(cmd.subcommands) > 0 {
+		fmt.Fprintf(w, "Usage: %v <command> [flags]\n\n", name)
+		if cmd.short != "" {
+			fmt.Fprintf(w, "%v\n\n", cmd.short)
+		}
+		fmt.Fprintln(w, "Commands:")
+		for _, v := range cmd.subcommands {
+			fmt.Fprintf(w, "  %-10v %v\n", v.name, v.short)
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "Usage: %v\n\n%v\n\nFlags:\n", strings.TrimSpace(name+" [flags] "+cmd.args), cmd.short)
+	if fs != nil {
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+}
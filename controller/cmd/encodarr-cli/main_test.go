@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestController(t *testing.T) *httptest.Server {
+	responses := map[string]string{
+		"GET /api/web/v1/libraries":         `{"IDs": [1, 2]}`,
+		"GET /api/web/v1/library/1":         `{"id": 1, "folder": "/media/movies", "priority": 5, "fs_check_interval": "30m0s", "queue": {"Items": [{"uuid": "a", "path": "/media/movies/a.mkv"}]}}`,
+		"GET /api/web/v1/library/2":         `{"id": 2, "folder": "/media/tv", "drained": true, "queue": {"Items": [{"uuid": "b", "path": "/media/tv/b.mkv"}, {"uuid": "c", "path": "/media/tv/c.mkv"}]}}`,
+		"GET /api/web/v1/history":           `{"history": [{"file": "/media/a.mkv", "datetime_completed": "08-01-2021 10:00:00"}, {"file": "/media/b.mkv", "datetime_completed": "08-01-2021 11:00:00", "errors": ["failed"]}]}`,
+		"GET /api/web/v1/runners":           `{"runners": [{"uuid": "r", "display_name": "Desktop", "version": "0.3.0", "last_seen": "2021-08-01T10:00:00Z", "online": true, "current_jobs": ["a"]}]}`,
+		"GET /api/web/v1/processing":        `{"enabled": true}`,
+		"GET /api/web/v1/library/1/preview": `{"jobs": [{"uuid": "d", "path": "/media/movies/d.mkv", "command": ["-i", "ENCODARR_INPUT_FILE", "-c:v", "hevc"]}]}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodPost && (r.URL.Path == "/api/web/v1/library/1/scan" || r.URL.Path == "/api/web/v1/library/1/drain" || r.URL.Path == "/api/web/v1/job/a/move") {
+			rw.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if r.Method == http.MethodPut && r.URL.Path == "/api/web/v1/processing" {
+			// Echo the new state back like the Controller does
+			io.Copy(rw, r.Body)
+			return
+		}
+		resp, ok := responses[r.Method+" "+r.URL.Path]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.Write([]byte(resp))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRun(t *testing.T) {
+	server := newTestController(t)
+	t.Setenv("ENCODARR_URL", server.URL)
+	t.Setenv("ENCODARR_API_KEY", "secret")
+	t.Setenv("ENCODARR_CLI_CONFIG", "")
+
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+		stdout   []string // Lines which must be in stdout, with their spacing collapsed.
+		stderr   string
+	}{
+		{
+			name:   "Queue List",
+			args:   []string{"queue", "list"},
+			stdout: []string{"LIBRARY UUID PATH", "1 a /media/movies/a.mkv", "2 b /media/tv/b.mkv", "2 c /media/tv/c.mkv"},
+		},
+		{
+			name:   "Queue List Of One Library",
+			args:   []string{"queue", "list", "--library", "2"},
+			stdout: []string{"2 c /media/tv/c.mkv"},
+		},
+		{
+			name:   "Queue List JSON",
+			args:   []string{"-o", "json", "queue", "list", "--library", "1"},
+			stdout: []string{`"uuid": "a",`, `"library_id": 1,`},
+		},
+		{
+			name:   "Library List",
+			args:   []string{"library", "list"},
+			stdout: []string{"ID FOLDER PRIORITY CHECK INTERVAL QUEUED DRAINED", "1 /media/movies 5 30m0s 1 false", "2 /media/tv 0 2 true"},
+		},
+		{
+			name:   "Scan Trigger",
+			args:   []string{"scan", "trigger", "1"},
+			stdout: []string{"Requested a scan of library 1"},
+		},
+		{
+			name:   "History Tail",
+			args:   []string{"history", "tail", "-n", "1"},
+			stdout: []string{"COMPLETED FILE WARNINGS ERRORS", "08-01-2021 11:00:00 /media/b.mkv 0 1"},
+		},
+		{
+			name:   "Runners List",
+			args:   []string{"runners", "list", "--output", "json"},
+			stdout: []string{`"display_name": "Desktop",`, `"online": true,`},
+		},
+		{
+			name:   "Scan Preview",
+			args:   []string{"scan", "preview", "1"},
+			stdout: []string{"PATH COMMAND", "/media/movies/d.mkv -i ENCODARR_INPUT_FILE -c:v hevc"},
+		},
+		{
+			name:   "Queue Move",
+			args:   []string{"queue", "move", "a", "2"},
+			stdout: []string{"Moved job a to library 2"},
+		},
+		{
+			name:     "Queue Move Missing Library",
+			args:     []string{"queue", "move", "a"},
+			exitCode: exitUsage,
+			stderr:   "Usage: encodarr-cli queue move [flags] <job uuid> <library id>",
+		},
+		{
+			name:   "Library Drain",
+			args:   []string{"library", "drain", "1"},
+			stdout: []string{"Drained library 1"},
+		},
+		{
+			name:     "Library Undrain Unknown",
+			args:     []string{"library", "undrain", "1"},
+			exitCode: exitError,
+			stderr:   "404 Not Found",
+		},
+		{
+			name:   "Processing Status",
+			args:   []string{"processing", "status"},
+			stdout: []string{"Processing is enabled"},
+		},
+		{
+			name:   "Processing Disable",
+			args:   []string{"processing", "disable"},
+			stdout: []string{"Processing is disabled, no scans are started and no jobs are dispatched"},
+		},
+		{
+			name:   "Processing Enable JSON",
+			args:   []string{"-o", "json", "processing", "enable"},
+			stdout: []string{`"enabled": true`},
+		},
+		{
+			name:     "API Error",
+			args:     []string{"scan", "trigger", "2"},
+			exitCode: exitError,
+			stderr:   "404 Not Found",
+		},
+		{
+			name:     "Wrong API Key",
+			args:     []string{"--api-key", "wrong", "runners", "list"},
+			exitCode: exitError,
+			stderr:   "401 Unauthorized",
+		},
+		{
+			name:     "Unknown Command",
+			args:     []string{"queue", "purge"},
+			exitCode: exitUsage,
+			stderr:   `Unknown command "encodarr-cli queue purge"`,
+		},
+		{
+			name:     "Missing Argument",
+			args:     []string{"scan", "trigger"},
+			exitCode: exitUsage,
+			stderr:   "Usage: encodarr-cli scan trigger [flags] <library id>",
+		},
+		{
+			name:     "Invalid Output",
+			args:     []string{"-o", "yaml", "runners", "list"},
+			exitCode: exitUsage,
+			stderr:   `Invalid output format "yaml"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(context.Background(), test.args, &stdout, &stderr); code != test.exitCode {
+				t.Fatalf("expected exit code %v but got %v (stderr: %q)", test.exitCode, code, stderr.String())
+			}
+
+			lines := make(map[string]bool)
+			for _, l := range strings.Split(stdout.String(), "\n") {
+				lines[strings.Join(strings.Fields(l), " ")] = true
+			}
+			for _, expected := range test.stdout {
+				if !lines[expected] {
+					t.Errorf("expected the line %q in %q", expected, stdout.String())
+				}
+			}
+			if !strings.Contains(stderr.String(), test.stderr) {
+				t.Errorf("expected %q in stderr %q", test.stderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestResolveConnection(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cli.json")
+	if err := os.WriteFile(path, []byte(`{"url": "http://config:8123", "api_key": "config-key"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("ENCODARR_URL", "")
+	t.Setenv("ENCODARR_API_KEY", "env-key")
+	t.Setenv("ENCODARR_CLI_CONFIG", path)
+
+	url, apiKey, err := resolveConnection(commonFlags{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "http://config:8123" || apiKey != "env-key" {
+		t.Errorf("expected the URL from the config file and the API key from the environment but got %q and %q", url, apiKey)
+	}
+
+	url, _, err = resolveConnection(commonFlags{url: "http://flag:8123"})
+	if err != nil || url != "http://flag:8123" {
+		t.Errorf("expected the URL from the flag but got %q (%v)", url, err)
+	}
+
+	if _, _, err = resolveConnection(commonFlags{configPath: filepath.Join(dir, "missing.json")}); err == nil {
+		t.Errorf("expected an error for a missing config file which was asked for")
+	}
+}
@@ -2,13 +2,15 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/backup"
 	"github.com/BrenekH/encodarr/controller/cmd/options"
 	"github.com/BrenekH/encodarr/controller/globals"
 	"github.com/BrenekH/encodarr/controller/httpserver"
@@ -16,11 +18,18 @@ import (
 	"github.com/BrenekH/encodarr/controller/library"
 	"github.com/BrenekH/encodarr/controller/library/commanddecider"
 	"github.com/BrenekH/encodarr/controller/library/mediainfo"
+	"github.com/BrenekH/encodarr/controller/logging"
+	"github.com/BrenekH/encodarr/controller/mediaserver"
+	"github.com/BrenekH/encodarr/controller/memory"
+	"github.com/BrenekH/encodarr/controller/metrics"
+	"github.com/BrenekH/encodarr/controller/notifier"
+	"github.com/BrenekH/encodarr/controller/postgres"
 	"github.com/BrenekH/encodarr/controller/runnercommunicator"
 	"github.com/BrenekH/encodarr/controller/settings"
 	"github.com/BrenekH/encodarr/controller/sqlite"
+	"github.com/BrenekH/encodarr/controller/timeline"
+	"github.com/BrenekH/encodarr/controller/trash"
 	"github.com/BrenekH/encodarr/controller/userinterfacer"
-	"github.com/BrenekH/logange"
 )
 
 var (
@@ -32,29 +41,26 @@ func main() {
 	configDir := options.ConfigDir()
 	httpServerPort := options.Port()
 
-	// Setup main logger
-	mainLogger := logange.NewLogger("main")
+	// Setup the root logger to print info to stdout and the log verbosity from the settings to a file
+	logRoot := logging.NewRoot(logging.Format(options.LogFormat()))
+	logRoot.AddOutput(os.Stdout, logging.LevelInfo)
 
-	formatter := logange.StandardFormatter{FormatString: "${datetime}|${name}|${lineno}|${levelname}|${message}\n"}
-
-	// Setup the root logger to print info
-	rootStdoutHandler := logange.NewStdoutHandler()
-	rootStdoutHandler.SetFormatter(formatter)
-	rootStdoutHandler.SetLevel(logange.LevelInfo)
-
-	logange.RootLogger.AddHandler(&rootStdoutHandler)
-
-	// Root logging to a file
-	rootFileHandler, err := logange.NewFileHandler(fmt.Sprintf("%v/controller.log", configDir))
-	if err != nil {
-		log.Printf("Error creating rootFileHandler: %v", err)
-		os.Exit(10)
-		return
+	// The log file follows the LogVerbosity setting, which is only known once the settings are loaded
+	var logFile *logging.File
+	var logFileOutput *logging.Output
+	if path := options.LogFile(); path != "" {
+		var err error
+		logFile, err = logging.OpenFile(path, logging.Rotation{MaxSize: options.LogMaxSize(), MaxBackups: options.LogMaxBackups(), MaxAge: options.LogMaxAge()})
+		if err != nil {
+			log.Printf("Error opening the log file: %v", err)
+			os.Exit(10)
+			return
+		}
+		defer logFile.Close()
+		logFileOutput = logRoot.AddOutput(logFile, logging.LevelInfo)
 	}
-	rootFileHandler.SetFormatter(formatter)
-	rootFileHandler.SetLevel(logange.LevelInfo)
 
-	logange.RootLogger.AddHandler(&rootFileHandler)
+	mainLogger := logRoot.NewLogger("main")
 
 	mainLogger.Info("Starting Encodarr Controller version %v", globals.Version)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -68,78 +74,229 @@ func main() {
 		cancel()
 	}()
 
-	sqliteDBBuilderLogger := logange.NewLogger("sqlite.DBBuilder")
-	sqliteDatabase, err := sqlite.NewDatabase(configDir, &sqliteDBBuilderLogger)
+	settingsStore, err := settings.NewStore(configDir, options.SecretsKeyFile())
 	if err != nil {
-		mainLogger.Critical("%v", err)
+		mainLogger.Critical("NewSettingsStore Error: %v", err)
 	}
+	queryTimeout := func() time.Duration { return time.Duration(settingsStore.QueryTimeout()) }
 
-	settingsStore, err := settings.NewStore(configDir)
+	var ds dataStorers
+	if options.InMemoryDB() {
+		mainLogger.Warn("Keeping data in memory. It will be lost when the Controller stops.")
+		ds = newMemoryDataStorers()
+	} else if dsn := options.PostgresDSN(); dsn != "" {
+		ds, err = newPostgresDataStorers(logRoot, dsn, queryTimeout)
+	} else {
+		ds, err = newSQLiteDataStorers(logRoot, configDir, queryTimeout, settingsStore.CompressQueues)
+	}
 	if err != nil {
-		mainLogger.Critical("NewSettingsStore Error: %v", err)
+		mainLogger.Critical("%v", err)
+	}
+	if options.BackupDir() != "" && !ds.backups {
+		mainLogger.Critical("ENCODARR_BACKUP_DIR enables scheduled backups, but only SQLite databases can be backed up by the Controller. Unset it, and back up a PostgreSQL database with pg_dump instead.")
 	}
 
-	httpSrvLogger := logange.NewLogger("httpServer")
+	// The records which are about a job are saved for the job's timeline
+	timelineLogger := logRoot.NewLogger("timeline.Recorder")
+	timelineRecorder := timeline.NewRecorder(&timelineLogger, ds.jobEvents, options.JobTimelineRetention())
+	logRoot.AddHook(logging.LevelInfo, timelineRecorder.Hook)
+
+	httpSrvLogger := logRoot.NewLogger("httpServer")
 	httpServer := httpserver.NewServer(&httpSrvLogger, httpServerPort, webAPIVersions, runnerAPIVersions)
 
-	// --------------- HealthChecker ---------------
-	sqliteHCLogger := logange.NewLogger("sqlite.HCA")
-	hcDBAdapter := sqlite.NewHealthCheckerAdapter(&sqliteDatabase, &sqliteHCLogger)
+	notifierLogger := logRoot.NewLogger("notifier")
+	eventNotifier := notifier.New(&notifierLogger, &settingsStore)
+	eventNotifier.SetDataStorers(ds.libraryManager, ds.userInterfacer)
+
+	paths := controller.NewPathCanonicalizer(options.ResolveSymlinks(), options.CaseInsensitivePaths())
 
-	healthCheckerLogger := logange.NewLogger("JobHealth.Checker")
-	healthChecker := jobhealth.NewChecker(&hcDBAdapter, &settingsStore, &healthCheckerLogger)
+	metricsCollector := metrics.New()
+	httpServer.Handle("/metrics", metricsCollector)
+
+	// --------------- HealthChecker ---------------
+	healthCheckerLogger := logRoot.NewLogger("JobHealth.Checker")
+	healthChecker := jobhealth.NewChecker(ds.healthChecker, &settingsStore, &eventNotifier, &healthCheckerLogger, options.RunnerOfflineThreshold(), options.RestartGracePeriod())
+	healthChecker.SetNoRunnersAlert(options.NoRunnersAlert())
+	healthChecker.SetMetricsCollector(metricsCollector)
 
 	// --------------- LibraryManager ---------------
-	sqliteLMLogger := logange.NewLogger("sqlite.LMA")
-	lmDBAdapter := sqlite.NewLibraryManagerAdapter(&sqliteDatabase, &sqliteLMLogger)
+	mediainfoMRLogger := logRoot.NewLogger("library/mediainfo.MetadataReader")
+	mediainfoReader := mediainfo.NewMetadataReader(&mediainfoMRLogger)
+	mediainfoReader.SetTimeout(options.MetadataReadTimeout(), options.MetadataReadTimeoutPerGiB(), options.MaxMetadataReadTimeout())
+	mediainfoReader.SetExtraArgs(options.MetadataReadArgs())
+	var metadataReader library.MetadataReader = &mediainfoReader
 
-	mediainfoMRLogger := logange.NewLogger("library/mediainfo.MetadataReader")
-	metadataReader := mediainfo.NewMetadataReader(&mediainfoMRLogger)
+	// The sidecars are read behind the cache so that their metadata is cached like MediaInfo's
+	if options.FFprobeSidecars() {
+		ffprobeSidecarLogger := logRoot.NewLogger("library.FFprobeSidecar")
+		ffprobeSidecar := library.NewFFprobeSidecar(metadataReader, &ffprobeSidecarLogger)
+		metadataReader = &ffprobeSidecar
+	}
 
-	fileCacheDS := sqlite.NewFileCacheAdapter(&sqliteDatabase)
-	cacheMiddlewareLogger := logange.NewLogger("library.cache")
-	metadataCacheMiddleware := library.NewCache(&metadataReader, &fileCacheDS, &cacheMiddlewareLogger)
+	cacheMiddlewareLogger := logRoot.NewLogger("library.cache")
+	metadataCacheMiddleware := library.NewCache(metadataReader, ds.fileCache, &cacheMiddlewareLogger)
 
-	cmdDeciderLogger := logange.NewLogger("library/command_decider.CmdDecider")
+	cmdDeciderLogger := logRoot.NewLogger("library/command_decider.CmdDecider")
 	commandDecider := commanddecider.New(&cmdDeciderLogger)
 
-	lmLogger := logange.NewLogger("library.Manager")
-	lm := library.NewManager(&lmLogger, &lmDBAdapter, &metadataCacheMiddleware, &commandDecider)
+	lmLogger := logRoot.NewLogger("library.Manager")
+	lm := library.NewManager(&lmLogger, ds.libraryManager, &settingsStore, &metadataCacheMiddleware, &commandDecider, &eventNotifier, metricsCollector, paths, options.DeletedLibraryRetention())
+	lm.SetPopStrategy(library.PopStrategy(options.PopStrategy()))
+	lm.SetQueueAging(options.QueueAging())
+	lm.SetMetadataReadConcurrency(options.MetadataReadConcurrency())
+	lm.SetMaxConcurrentScans(options.MaxConcurrentScans())
+	lm.SetMaxScanLoad(options.MaxScanLoad())
+	lm.SetAwaitingSpaceLimit(options.MaxAwaitingSpace())
+	lm.SetTranscodeBudget(options.TranscodeBudget(), options.TranscodeBudgetWindow())
+	lm.SetSpaceReservation(options.SpaceReservationRatio())
+	lm.SetSidecarExtensions(options.SidecarExtensions())
+	lm.SetDatastoreOutagePolicy(options.DatastoreMaxBackoff(), options.DatastoreBreakerThreshold())
+
+	mediaServerLogger := logRoot.NewLogger("mediaserver.Refresher")
+	mediaServerRefresher := mediaserver.New(&mediaServerLogger, &settingsStore)
+	lm.SetMediaServerRefresher(&mediaServerRefresher)
+
+	// --------------- Trash ---------------
+	trashLogger := logRoot.NewLogger("trash.Trash")
+	originalsTrash := trash.New(&trashLogger, options.TrashDir(), options.TrashRetention(), options.TrashMinFreeSpace())
+	lm.SetTrash(&originalsTrash)
 
 	// --------------- RunnerCommunicator ---------------
-	rcDSLogger := logange.NewLogger("sqlite.RCA")
-	rcDS := sqlite.NewRunnerCommunicatorAdapter(&sqliteDatabase, &rcDSLogger)
-	rcLogger := logange.NewLogger("runnerCommunicator")
-	rc := runnercommunicator.NewRunnerHTTPApiV1(&rcLogger, &httpServer, &rcDS)
+	rcLogger := logRoot.NewLogger("runnerCommunicator")
+	rc := runnercommunicator.NewRunnerHTTPApiV1(&rcLogger, &httpServer, ds.runnerCommunicator, options.MaxLeaseDuration())
+	stagingDir := options.StagingDir()
+	if err := os.MkdirAll(stagingDir, 0777); err != nil {
+		log.Printf("Error creating the staging directory: %v", err)
+		os.Exit(10)
+		return
+	}
+	rc.SetStagingDir(stagingDir)
 
 	// --------------- UserInterfacer ---------------
-	uiaLogger := logange.NewLogger("sqlite.UIA")
-	uiDBAdapter := sqlite.NewUserInterfacerAdapter(&sqliteDatabase, &uiaLogger)
-	uiLogger := logange.NewLogger("userInterfacer")
-	ui := userinterfacer.NewWebHTTPv1(&uiLogger, &httpServer, &settingsStore, &uiDBAdapter, false)
+	uiLogger := logRoot.NewLogger("userInterfacer")
+	ui := userinterfacer.NewWebHTTPv1(&uiLogger, &httpServer, &settingsStore, ds.userInterfacer, paths, options.RunnerOfflineThreshold(), false)
+	ui.SetQueueAging(options.QueueAging())
+	ui.SetTrash(&originalsTrash)
+	ui.SetNotifier(&eventNotifier)
+	ui.SetLibraryManager(&lm)
+	if logFile != nil {
+		ui.SetLogFile(logFile.Path())
+	}
+
+	// --------------- Scheduled backups, trash cleanup, media server rescans, and notifications ---------------
+	backgroundWG := sync.WaitGroup{}
+	if dir := options.BackupDir(); dir != "" {
+		backupLogger := logRoot.NewLogger("backup.Scheduler")
+		backupScheduler := backup.NewScheduler(&backupLogger, ds.userInterfacer, dir, options.BackupInterval(), options.BackupKeep())
+		backupScheduler.Start(ctx, &backgroundWG)
+	}
+	originalsTrash.Start(ctx, &backgroundWG)
+	mediaServerRefresher.Start(ctx, &backgroundWG)
+	eventNotifier.Start(ctx, &backgroundWG)
+	timelineRecorder.Start(ctx, &backgroundWG)
 
-	runLogger := logange.NewLogger("run")
-	controller.Run(&ctx, &runLogger, &healthChecker, &lm, &rc, &ui, getSetFileLogLevelFunc(&rootFileHandler, &settingsStore), false)
+	runLogger := logRoot.NewLogger("run")
+	controller.Run(ctx, &runLogger, &healthChecker, &lm, &rc, &ui, getSetLogLevelsFunc(logRoot, logFileOutput, &settingsStore), false)
+
+	backgroundWG.Wait()
+}
+
+// dataStorers groups the data storers of every component so that main doesn't need to know which database is in use.
+type dataStorers struct {
+	healthChecker      controller.HealthCheckerDataStorer
+	libraryManager     controller.LibraryManagerDataStorer
+	fileCache          controller.FileCacheDataStorer
+	jobEvents          controller.JobEventDataStorer
+	runnerCommunicator controller.RunnerCommunicatorDataStorer
+	userInterfacer     controller.UserInterfacerDataStorer
+
+	// backups is whether or not userInterfacer can take backups of the database.
+	backups bool
+}
+
+// newSQLiteDataStorers creates data storers backed by the SQLite database in configDir. Each of their calls is
+// limited to the duration returned by queryTimeout, and library queues are compressed while compressQueues returns true.
+func newSQLiteDataStorers(logRoot *logging.Root, configDir string, queryTimeout func() time.Duration, compressQueues func() bool) (dataStorers, error) {
+	dbBuilderLogger := logRoot.NewLogger("sqlite.DBBuilder")
+	db, err := sqlite.NewDatabase(configDir, &dbBuilderLogger)
+	db.SetQueryTimeout(queryTimeout)
+	db.SetCompressQueues(compressQueues)
+
+	hcLogger := logRoot.NewLogger("sqlite.HCA")
+	hc := sqlite.NewHealthCheckerAdapter(&db, &hcLogger)
+
+	lmLogger := logRoot.NewLogger("sqlite.LMA")
+	lm := sqlite.NewLibraryManagerAdapter(&db, &lmLogger)
+
+	fc := sqlite.NewFileCacheAdapter(&db)
+	je := sqlite.NewJobEventAdapter(&db)
+
+	rcLogger := logRoot.NewLogger("sqlite.RCA")
+	rc := sqlite.NewRunnerCommunicatorAdapter(&db, &rcLogger)
+
+	uiLogger := logRoot.NewLogger("sqlite.UIA")
+	ui := sqlite.NewUserInterfacerAdapter(&db, &uiLogger)
+
+	return dataStorers{&hc, &lm, &fc, &je, &rc, &ui, true}, err
+}
+
+// newPostgresDataStorers creates data storers backed by the PostgreSQL database described by dsn. Each of their calls
+// is limited to the duration returned by queryTimeout.
+func newPostgresDataStorers(logRoot *logging.Root, dsn string, queryTimeout func() time.Duration) (dataStorers, error) {
+	dbBuilderLogger := logRoot.NewLogger("postgres.DBBuilder")
+	db, err := postgres.NewDatabase(dsn, &dbBuilderLogger)
+	db.SetQueryTimeout(queryTimeout)
+
+	hcLogger := logRoot.NewLogger("postgres.HCA")
+	hc := postgres.NewHealthCheckerAdapter(&db, &hcLogger)
+
+	lmLogger := logRoot.NewLogger("postgres.LMA")
+	lm := postgres.NewLibraryManagerAdapter(&db, &lmLogger)
+
+	fc := postgres.NewFileCacheAdapter(&db)
+	je := postgres.NewJobEventAdapter(&db)
+
+	rcLogger := logRoot.NewLogger("postgres.RCA")
+	rc := postgres.NewRunnerCommunicatorAdapter(&db, &rcLogger)
+
+	uiLogger := logRoot.NewLogger("postgres.UIA")
+	ui := postgres.NewUserInterfacerAdapter(&db, &uiLogger)
+
+	return dataStorers{&hc, &lm, &fc, &je, &rc, &ui, false}, err
 }
 
-func getSetFileLogLevelFunc(fh *logange.FileHandler, ss controller.SettingsStorer) func() {
+// newMemoryDataStorers creates data storers which keep everything in memory.
+func newMemoryDataStorers() dataStorers {
+	db := memory.NewDatabase()
+
+	hc := memory.NewHealthCheckerAdapter(db)
+	lm := memory.NewLibraryManagerAdapter(db)
+	fc := memory.NewFileCacheAdapter(db)
+	je := memory.NewJobEventAdapter(db)
+	rc := memory.NewRunnerCommunicatorAdapter(db)
+	ui := memory.NewUserInterfacerAdapter(db)
+
+	return dataStorers{&hc, &lm, &fc, &je, &rc, &ui, false}
+}
+
+// getSetLogLevelsFunc returns a func which sets the level of the log file, if there is one, to the LogVerbosity setting
+// and the levels of the components named in the LogLevels setting. Invalid levels are treated as INFO and ignored respectively.
+func getSetLogLevelsFunc(root *logging.Root, fileOutput *logging.Output, ss controller.SettingsStorer) func() {
 	return func() {
-		switch ss.LogVerbosity() {
-		case "TRACE":
-			fh.SetLevel(logange.LevelTrace)
-		case "DEBUG":
-			fh.SetLevel(logange.LevelDebug)
-		case "INFO":
-			fh.SetLevel(logange.LevelInfo)
-		case "WARN":
-		case "WARNING":
-			fh.SetLevel(logange.LevelWarn)
-		case "ERROR":
-			fh.SetLevel(logange.LevelError)
-		case "CRITICAL":
-			fh.SetLevel(logange.LevelCritical)
-		default:
-			fh.SetLevel(logange.LevelInfo)
+		if fileOutput != nil {
+			level, err := logging.ParseLevel(ss.LogVerbosity())
+			if err != nil {
+				level = logging.LevelInfo
+			}
+			fileOutput.SetLevel(level)
+		}
+
+		componentLevels := make(map[string]logging.Level, len(ss.LogLevels()))
+		for component, v := range ss.LogLevels() {
+			if level, err := logging.ParseLevel(v); err == nil {
+				componentLevels[component] = level
+			}
 		}
+		root.SetComponentLevels(componentLevels)
 	}
 }
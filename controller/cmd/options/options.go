@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type optionConst struct {
@@ -20,6 +23,126 @@ var port string = "8123"
 var configDirConst optionConst = optionConst{"ENCODARR_CONFIG_DIR", "config-dir", "Sets the location that configuration files are saved to.", "--config-dir <directory>"}
 var configDir string = ""
 
+var postgresDSNConst optionConst = optionConst{"ENCODARR_POSTGRES_DSN", "postgres-dsn", "Stores data in the PostgreSQL database described by the DSN instead of SQLite.", "--postgres-dsn <dsn>"}
+var postgresDSN string = ""
+
+var inMemoryDBConst optionConst = optionConst{"ENCODARR_IN_MEMORY_DB", "in-memory-db", "Keeps all data in memory instead of a database. Everything except the settings is lost when the Controller stops.", "--in-memory-db <true|false>"}
+var inMemoryDB string = "false"
+
+var logFormatConst optionConst = optionConst{"ENCODARR_LOG_FORMAT", "log-format", "Sets the format of the log, text or json (one object per line with the time, level, component, message, and fields).", "--log-format <text|json>"}
+var logFormat string = "text"
+
+var logFileConst optionConst = optionConst{"ENCODARR_LOG_FILE", "log-file", "Sets the file that the log is written to as well as stdout. none only logs to stdout.", "--log-file <path|none>"}
+var logFile string = ""
+
+var logMaxSizeConst optionConst = optionConst{"ENCODARR_LOG_MAX_SIZE", "log-max-size", "Sets the size in MiB that the log file grows to before it is rotated. 0 disables rotation.", "--log-max-size <MiB>"}
+var logMaxSize string = "100"
+
+var logMaxBackupsConst optionConst = optionConst{"ENCODARR_LOG_MAX_BACKUPS", "log-max-backups", "Sets how many rotated log files are kept. 0 keeps all of them.", "--log-max-backups <count>"}
+var logMaxBackups string = "5"
+
+var logMaxAgeConst optionConst = optionConst{"ENCODARR_LOG_MAX_AGE", "log-max-age", "Sets how long rotated log files are kept. 0s keeps them regardless of their age.", "--log-max-age <duration>"}
+var logMaxAge string = "0s"
+
+var jobTimelineRetentionConst optionConst = optionConst{"ENCODARR_JOB_TIMELINE_RETENTION", "job-timeline-retention", "Sets how long the log records of each job are kept for its timeline. 0s keeps them forever.", "--job-timeline-retention <duration>"}
+var jobTimelineRetention string = "720h"
+
+var backupDirConst optionConst = optionConst{"ENCODARR_BACKUP_DIR", "backup-dir", "Enables scheduled backups of the SQLite database, which are saved to the directory.", "--backup-dir <directory>"}
+var backupDir string = ""
+
+var backupIntervalConst optionConst = optionConst{"ENCODARR_BACKUP_INTERVAL", "backup-interval", "Sets how often scheduled database backups are saved.", "--backup-interval <duration>"}
+var backupInterval string = "24h"
+
+var backupKeepConst optionConst = optionConst{"ENCODARR_BACKUP_KEEP", "backup-keep", "Sets how many scheduled database backups are kept.", "--backup-keep <count>"}
+var backupKeep string = "7"
+
+var maxLeaseDurationConst optionConst = optionConst{"ENCODARR_MAX_LEASE_DURATION", "max-lease-duration", "Sets the longest lease on a job that a Runner may ask for.", "--max-lease-duration <duration>"}
+var maxLeaseDuration string = "24h"
+
+var runnerOfflineThresholdConst optionConst = optionConst{"ENCODARR_RUNNER_OFFLINE_THRESHOLD", "runner-offline-threshold", "Sets how long a Runner may go without sending a heartbeat before it is marked as offline and its jobs are requeued. 0 disables the check.", "--runner-offline-threshold <duration>"}
+var runnerOfflineThreshold string = "90s"
+
+var restartGracePeriodConst optionConst = optionConst{"ENCODARR_RESTART_GRACE_PERIOD", "restart-grace-period", "Sets how long the Runners have to renew the leases on their dispatched jobs after the Controller starts before the leases which weren't renewed are revoked. 0 disables the grace period.", "--restart-grace-period <duration>"}
+var restartGracePeriod string = "2m"
+
+var noRunnersAlertConst optionConst = optionConst{"ENCODARR_NO_RUNNERS_ALERT", "no-runners-alert", "Sets how long no Runner may be seen while jobs are queued before the user is alerted. 0 disables the alert.", "--no-runners-alert <duration>"}
+var noRunnersAlert string = "1h"
+
+var datastoreMaxBackoffConst optionConst = optionConst{"ENCODARR_DATASTORE_MAX_BACKOFF", "datastore-max-backoff", "Sets the longest wait between attempts to reach the datastore while it is unavailable.", "--datastore-max-backoff <duration>"}
+var datastoreMaxBackoff string = "1m"
+
+var datastoreBreakerThresholdConst optionConst = optionConst{"ENCODARR_DATASTORE_BREAKER_THRESHOLD", "datastore-breaker-threshold", "Sets how many failed attempts in a row to reach the datastore mark it as down, which stops dispatching jobs until it is reached again. 0 never marks it as down.", "--datastore-breaker-threshold <int>"}
+var datastoreBreakerThreshold string = "5"
+
+var resolveSymlinksConst optionConst = optionConst{"ENCODARR_RESOLVE_SYMLINKS", "resolve-symlinks", "Resolves symlinks in media paths so that a file reached through different folders is only processed once.", "--resolve-symlinks <true|false>"}
+var resolveSymlinks string = "false"
+
+var caseInsensitivePathsConst optionConst = optionConst{"ENCODARR_CASE_INSENSITIVE_PATHS", "case-insensitive-paths", "Compares media paths case-insensitively. Only use this if the media is on a case-insensitive filesystem.", "--case-insensitive-paths <true|false>"}
+var caseInsensitivePaths string = "false"
+
+var ffprobeSidecarsConst optionConst = optionConst{"ENCODARR_FFPROBE_SIDECARS", "ffprobe-sidecars", "Reads the metadata of a media file from a <file name>.ffprobe.json file next to it instead of running MediaInfo, as long as it isn't older than the file.", "--ffprobe-sidecars <true|false>"}
+var ffprobeSidecars string = "false"
+
+var deletedLibraryRetentionConst optionConst = optionConst{"ENCODARR_DELETED_LIBRARY_RETENTION", "deleted-library-retention", "Sets how long a deleted library can be restored before it is permanently removed.", "--deleted-library-retention <duration>"}
+var deletedLibraryRetention string = "168h"
+
+var popStrategyConst optionConst = optionConst{"ENCODARR_POP_STRATEGY", "pop-strategy", "Sets which job of the highest priority library is dispatched next. Either queue-order or smallest-first.", "--pop-strategy <queue-order|smallest-first>"}
+var popStrategy string = "queue-order"
+
+var queueAgingConst optionConst = optionConst{"ENCODARR_QUEUE_AGING", "queue-aging", "Sets how much the priority of a queued job rises for every day that it waits. 0 disables aging.", "--queue-aging <priority per day>"}
+var queueAging string = "0"
+
+var maxConcurrentScansConst optionConst = optionConst{"ENCODARR_MAX_CONCURRENT_SCANS", "max-concurrent-scans", "Sets how many libraries may be scanned at once. The highest priority libraries are scanned first. 0 doesn't limit the scans.", "--max-concurrent-scans <count>"}
+var maxConcurrentScans string = "0"
+
+var maxScanLoadConst optionConst = optionConst{"ENCODARR_MAX_SCAN_LOAD", "max-scan-load", "Sets the CPU load, as a percentage of the CPUs' one-minute load average, above which scans are deferred. 0 disables the limit.", "--max-scan-load <percent>"}
+var maxScanLoad string = "0"
+
+var metadataReadConcurrencyConst optionConst = optionConst{"ENCODARR_METADATA_READ_CONCURRENCY", "metadata-read-concurrency", "Sets how many files may have their metadata read at once across all library scans.", "--metadata-read-concurrency <count>"}
+var metadataReadConcurrency string = "4"
+
+var metadataReadTimeoutConst optionConst = optionConst{"ENCODARR_METADATA_READ_TIMEOUT", "metadata-read-timeout", "Sets how long reading the metadata of an empty file may take before MediaInfo is killed. 0 disables the timeout.", "--metadata-read-timeout <duration>"}
+var metadataReadTimeout string = "1m"
+
+var metadataReadTimeoutPerGiBConst optionConst = optionConst{"ENCODARR_METADATA_READ_TIMEOUT_PER_GIB", "metadata-read-timeout-per-gib", "Sets how much longer reading the metadata of a file may take for every GiB of its size.", "--metadata-read-timeout-per-gib <duration>"}
+var metadataReadTimeoutPerGiB string = "10s"
+
+var maxMetadataReadTimeoutConst optionConst = optionConst{"ENCODARR_MAX_METADATA_READ_TIMEOUT", "max-metadata-read-timeout", "Sets the longest that reading the metadata of any file may take.", "--max-metadata-read-timeout <duration>"}
+var maxMetadataReadTimeout string = "15m"
+
+var metadataReadArgsConst optionConst = optionConst{"ENCODARR_METADATA_READ_ARGS", "metadata-read-args", "Sets extra arguments, separated by spaces, that are passed to MediaInfo when reading the metadata of a file.", "--metadata-read-args <arguments>"}
+var metadataReadArgs string = ""
+
+var trashDirConst optionConst = optionConst{"ENCODARR_TRASH_DIR", "trash-dir", "Sets the folder that the originals of libraries using the move-to-trash original file handling are moved to.", "--trash-dir <directory>"}
+var trashDir string = ""
+
+var stagingDirConst optionConst = optionConst{"ENCODARR_STAGING_DIR", "staging-dir", "Sets the folder that the files received from the Runners are kept in until they are imported.", "--staging-dir <directory>"}
+var stagingDir string = ""
+
+var trashRetentionConst optionConst = optionConst{"ENCODARR_TRASH_RETENTION", "trash-retention", "Sets how long originals are kept in the trash before they are deleted. 0 keeps them until space is needed.", "--trash-retention <duration>"}
+var trashRetention string = "720h"
+
+var trashMinFreeSpaceConst optionConst = optionConst{"ENCODARR_TRASH_MIN_FREE_SPACE", "trash-min-free-space", "Sets how many bytes must be free on the trash's filesystem before the oldest originals are deleted early. 0 disables the check.", "--trash-min-free-space <bytes>"}
+var trashMinFreeSpace string = "0"
+
+var maxAwaitingSpaceConst optionConst = optionConst{"ENCODARR_MAX_AWAITING_SPACE", "max-awaiting-space", "Sets how many bytes of transcoded files may wait for space in their libraries at once. Completed jobs which don't fit fail.", "--max-awaiting-space <bytes>"}
+var maxAwaitingSpace string = "53687091200"
+
+var transcodeBudgetConst optionConst = optionConst{"ENCODARR_TRANSCODE_BUDGET", "transcode-budget", "Sets how many bytes of transcoded files may be imported within the budget window before dispatching pauses. 0 disables the budget.", "--transcode-budget <bytes>"}
+var transcodeBudget string = "0"
+
+var transcodeBudgetWindowConst optionConst = optionConst{"ENCODARR_TRANSCODE_BUDGET_WINDOW", "transcode-budget-window", "Sets the rolling window that the transcode budget applies to.", "--transcode-budget-window <duration>"}
+var transcodeBudgetWindow string = "24h"
+
+var spaceReservationRatioConst optionConst = optionConst{"ENCODARR_SPACE_RESERVATION_RATIO", "space-reservation-ratio", "Sets how much space is reserved on a library's filesystem for each dispatched job, relative to the size of its original file. 0 disables the reservations.", "--space-reservation-ratio <ratio>"}
+var spaceReservationRatio string = "0"
+
+var sidecarExtensionsConst optionConst = optionConst{"ENCODARR_SIDECAR_EXTENSIONS", "sidecar-extensions", "Sets the comma separated extensions of the sidecar files which are moved along with a video file in libraries with move_sidecars set.", "--sidecar-extensions <extensions>"}
+var sidecarExtensions string = ".srt,.ass,.ssa,.sub,.idx,.vtt,.nfo"
+
+var secretsKeyFileConst optionConst = optionConst{"ENCODARR_SECRETS_KEY_FILE", "secrets-key-file", "Sets the file holding the key that sensitive settings are encrypted with. It is generated if it doesn't exist.", "--secrets-key-file <file>"}
+var secretsKeyFile string = ""
+
 var inputsParsed bool = false
 
 func init() {
@@ -44,6 +167,141 @@ func parseInputs() {
 	stringVarFromEnv(&configDir, configDirConst.EnvVar)
 	stringVar(&configDir, configDirConst.CmdLine, configDirConst.Description, configDirConst.Usage)
 
+	// PostgreSQL DSN
+	stringVarFromEnv(&postgresDSN, postgresDSNConst.EnvVar)
+	stringVar(&postgresDSN, postgresDSNConst.CmdLine, postgresDSNConst.Description, postgresDSNConst.Usage)
+
+	// In-memory database
+	stringVarFromEnv(&inMemoryDB, inMemoryDBConst.EnvVar)
+	stringVar(&inMemoryDB, inMemoryDBConst.CmdLine, inMemoryDBConst.Description, inMemoryDBConst.Usage)
+
+	// Log format
+	stringVarFromEnv(&logFormat, logFormatConst.EnvVar)
+	stringVar(&logFormat, logFormatConst.CmdLine, logFormatConst.Description, logFormatConst.Usage)
+
+	// Log file
+	stringVarFromEnv(&logFile, logFileConst.EnvVar)
+	stringVar(&logFile, logFileConst.CmdLine, logFileConst.Description, logFileConst.Usage)
+
+	stringVarFromEnv(&logMaxSize, logMaxSizeConst.EnvVar)
+	stringVar(&logMaxSize, logMaxSizeConst.CmdLine, logMaxSizeConst.Description, logMaxSizeConst.Usage)
+
+	stringVarFromEnv(&logMaxBackups, logMaxBackupsConst.EnvVar)
+	stringVar(&logMaxBackups, logMaxBackupsConst.CmdLine, logMaxBackupsConst.Description, logMaxBackupsConst.Usage)
+
+	stringVarFromEnv(&logMaxAge, logMaxAgeConst.EnvVar)
+	stringVar(&logMaxAge, logMaxAgeConst.CmdLine, logMaxAgeConst.Description, logMaxAgeConst.Usage)
+
+	// Job timelines
+	stringVarFromEnv(&jobTimelineRetention, jobTimelineRetentionConst.EnvVar)
+	stringVar(&jobTimelineRetention, jobTimelineRetentionConst.CmdLine, jobTimelineRetentionConst.Description, jobTimelineRetentionConst.Usage)
+
+	// Scheduled backups
+	stringVarFromEnv(&backupDir, backupDirConst.EnvVar)
+	stringVar(&backupDir, backupDirConst.CmdLine, backupDirConst.Description, backupDirConst.Usage)
+
+	stringVarFromEnv(&backupInterval, backupIntervalConst.EnvVar)
+	stringVar(&backupInterval, backupIntervalConst.CmdLine, backupIntervalConst.Description, backupIntervalConst.Usage)
+
+	stringVarFromEnv(&backupKeep, backupKeepConst.EnvVar)
+	stringVar(&backupKeep, backupKeepConst.CmdLine, backupKeepConst.Description, backupKeepConst.Usage)
+
+	stringVarFromEnv(&maxLeaseDuration, maxLeaseDurationConst.EnvVar)
+	stringVar(&maxLeaseDuration, maxLeaseDurationConst.CmdLine, maxLeaseDurationConst.Description, maxLeaseDurationConst.Usage)
+
+	stringVarFromEnv(&runnerOfflineThreshold, runnerOfflineThresholdConst.EnvVar)
+	stringVar(&runnerOfflineThreshold, runnerOfflineThresholdConst.CmdLine, runnerOfflineThresholdConst.Description, runnerOfflineThresholdConst.Usage)
+
+	stringVarFromEnv(&restartGracePeriod, restartGracePeriodConst.EnvVar)
+	stringVar(&restartGracePeriod, restartGracePeriodConst.CmdLine, restartGracePeriodConst.Description, restartGracePeriodConst.Usage)
+
+	stringVarFromEnv(&noRunnersAlert, noRunnersAlertConst.EnvVar)
+	stringVar(&noRunnersAlert, noRunnersAlertConst.CmdLine, noRunnersAlertConst.Description, noRunnersAlertConst.Usage)
+
+	stringVarFromEnv(&datastoreMaxBackoff, datastoreMaxBackoffConst.EnvVar)
+	stringVar(&datastoreMaxBackoff, datastoreMaxBackoffConst.CmdLine, datastoreMaxBackoffConst.Description, datastoreMaxBackoffConst.Usage)
+
+	stringVarFromEnv(&datastoreBreakerThreshold, datastoreBreakerThresholdConst.EnvVar)
+	stringVar(&datastoreBreakerThreshold, datastoreBreakerThresholdConst.CmdLine, datastoreBreakerThresholdConst.Description, datastoreBreakerThresholdConst.Usage)
+
+	// Path canonicalization
+	stringVarFromEnv(&resolveSymlinks, resolveSymlinksConst.EnvVar)
+	stringVar(&resolveSymlinks, resolveSymlinksConst.CmdLine, resolveSymlinksConst.Description, resolveSymlinksConst.Usage)
+
+	stringVarFromEnv(&ffprobeSidecars, ffprobeSidecarsConst.EnvVar)
+	stringVar(&ffprobeSidecars, ffprobeSidecarsConst.CmdLine, ffprobeSidecarsConst.Description, ffprobeSidecarsConst.Usage)
+
+	stringVarFromEnv(&caseInsensitivePaths, caseInsensitivePathsConst.EnvVar)
+	stringVar(&caseInsensitivePaths, caseInsensitivePathsConst.CmdLine, caseInsensitivePathsConst.Description, caseInsensitivePathsConst.Usage)
+
+	// Deleted libraries
+	stringVarFromEnv(&deletedLibraryRetention, deletedLibraryRetentionConst.EnvVar)
+	stringVar(&deletedLibraryRetention, deletedLibraryRetentionConst.CmdLine, deletedLibraryRetentionConst.Description, deletedLibraryRetentionConst.Usage)
+
+	// Pop strategy
+	stringVarFromEnv(&popStrategy, popStrategyConst.EnvVar)
+	stringVar(&popStrategy, popStrategyConst.CmdLine, popStrategyConst.Description, popStrategyConst.Usage)
+
+	// Queue aging
+	stringVarFromEnv(&queueAging, queueAgingConst.EnvVar)
+	stringVar(&queueAging, queueAgingConst.CmdLine, queueAgingConst.Description, queueAgingConst.Usage)
+
+	// Max concurrent scans
+	stringVarFromEnv(&maxConcurrentScans, maxConcurrentScansConst.EnvVar)
+	stringVar(&maxConcurrentScans, maxConcurrentScansConst.CmdLine, maxConcurrentScansConst.Description, maxConcurrentScansConst.Usage)
+
+	// Max scan load
+	stringVarFromEnv(&maxScanLoad, maxScanLoadConst.EnvVar)
+	stringVar(&maxScanLoad, maxScanLoadConst.CmdLine, maxScanLoadConst.Description, maxScanLoadConst.Usage)
+
+	// Metadata read concurrency
+	stringVarFromEnv(&metadataReadConcurrency, metadataReadConcurrencyConst.EnvVar)
+	stringVar(&metadataReadConcurrency, metadataReadConcurrencyConst.CmdLine, metadataReadConcurrencyConst.Description, metadataReadConcurrencyConst.Usage)
+
+	stringVarFromEnv(&metadataReadTimeout, metadataReadTimeoutConst.EnvVar)
+	stringVar(&metadataReadTimeout, metadataReadTimeoutConst.CmdLine, metadataReadTimeoutConst.Description, metadataReadTimeoutConst.Usage)
+
+	stringVarFromEnv(&metadataReadTimeoutPerGiB, metadataReadTimeoutPerGiBConst.EnvVar)
+	stringVar(&metadataReadTimeoutPerGiB, metadataReadTimeoutPerGiBConst.CmdLine, metadataReadTimeoutPerGiBConst.Description, metadataReadTimeoutPerGiBConst.Usage)
+
+	stringVarFromEnv(&maxMetadataReadTimeout, maxMetadataReadTimeoutConst.EnvVar)
+	stringVar(&maxMetadataReadTimeout, maxMetadataReadTimeoutConst.CmdLine, maxMetadataReadTimeoutConst.Description, maxMetadataReadTimeoutConst.Usage)
+
+	stringVarFromEnv(&metadataReadArgs, metadataReadArgsConst.EnvVar)
+	stringVar(&metadataReadArgs, metadataReadArgsConst.CmdLine, metadataReadArgsConst.Description, metadataReadArgsConst.Usage)
+
+	// Trash
+	stringVarFromEnv(&trashDir, trashDirConst.EnvVar)
+	stringVar(&trashDir, trashDirConst.CmdLine, trashDirConst.Description, trashDirConst.Usage)
+
+	stringVarFromEnv(&stagingDir, stagingDirConst.EnvVar)
+	stringVar(&stagingDir, stagingDirConst.CmdLine, stagingDirConst.Description, stagingDirConst.Usage)
+
+	stringVarFromEnv(&trashRetention, trashRetentionConst.EnvVar)
+	stringVar(&trashRetention, trashRetentionConst.CmdLine, trashRetentionConst.Description, trashRetentionConst.Usage)
+
+	stringVarFromEnv(&trashMinFreeSpace, trashMinFreeSpaceConst.EnvVar)
+	stringVar(&trashMinFreeSpace, trashMinFreeSpaceConst.CmdLine, trashMinFreeSpaceConst.Description, trashMinFreeSpaceConst.Usage)
+
+	stringVarFromEnv(&maxAwaitingSpace, maxAwaitingSpaceConst.EnvVar)
+	stringVar(&maxAwaitingSpace, maxAwaitingSpaceConst.CmdLine, maxAwaitingSpaceConst.Description, maxAwaitingSpaceConst.Usage)
+
+	stringVarFromEnv(&transcodeBudget, transcodeBudgetConst.EnvVar)
+	stringVar(&transcodeBudget, transcodeBudgetConst.CmdLine, transcodeBudgetConst.Description, transcodeBudgetConst.Usage)
+
+	stringVarFromEnv(&transcodeBudgetWindow, transcodeBudgetWindowConst.EnvVar)
+	stringVar(&transcodeBudgetWindow, transcodeBudgetWindowConst.CmdLine, transcodeBudgetWindowConst.Description, transcodeBudgetWindowConst.Usage)
+
+	stringVarFromEnv(&spaceReservationRatio, spaceReservationRatioConst.EnvVar)
+	stringVar(&spaceReservationRatio, spaceReservationRatioConst.CmdLine, spaceReservationRatioConst.Description, spaceReservationRatioConst.Usage)
+
+	stringVarFromEnv(&sidecarExtensions, sidecarExtensionsConst.EnvVar)
+	stringVar(&sidecarExtensions, sidecarExtensionsConst.CmdLine, sidecarExtensionsConst.Description, sidecarExtensionsConst.Usage)
+
+	// Secrets key file
+	stringVarFromEnv(&secretsKeyFile, secretsKeyFileConst.EnvVar)
+	stringVar(&secretsKeyFile, secretsKeyFileConst.CmdLine, secretsKeyFileConst.Description, secretsKeyFileConst.Usage)
+
 	makeConfigDir()
 
 	parseCL()
@@ -72,6 +330,438 @@ func ConfigDir() string {
 	return configDir
 }
 
+// PostgresDSN returns the passed PostgreSQL DSN. An empty string means that SQLite should be used.
+func PostgresDSN() string {
+	parseInputs()
+	return postgresDSN
+}
+
+// InMemoryDB returns whether or not data should be kept in memory instead of a database.
+func InMemoryDB() bool {
+	parseInputs()
+	b, err := strconv.ParseBool(inMemoryDB)
+	if err != nil {
+		log.Printf("Invalid value '%v' for --%v, using a database instead", inMemoryDB, inMemoryDBConst.CmdLine)
+		return false
+	}
+	return b
+}
+
+// LogFormat returns the format of the log, text or json.
+func LogFormat() string {
+	parseInputs()
+	if logFormat != "text" && logFormat != "json" {
+		log.Printf("Invalid value '%v' for --%v, using text", logFormat, logFormatConst.CmdLine)
+		return "text"
+	}
+	return logFormat
+}
+
+// LogFile returns the path of the log file, which is controller.log in the config directory unless it is set.
+// An empty string means that the log is only written to stdout.
+func LogFile() string {
+	parseInputs()
+	switch logFile {
+	case "":
+		return configDir + "/controller.log"
+	case "none":
+		return ""
+	}
+	return logFile
+}
+
+// LogMaxSize returns the size in bytes that the log file grows to before it is rotated. 0 disables rotation.
+func LogMaxSize() int64 {
+	parseInputs()
+	n, err := strconv.ParseInt(logMaxSize, 10, 64)
+	if err != nil || n < 0 {
+		log.Printf("Invalid value '%v' for --%v, using 100 MiB instead", logMaxSize, logMaxSizeConst.CmdLine)
+		n = 100
+	}
+	return n << 20
+}
+
+// LogMaxBackups returns how many rotated log files are kept. 0 keeps all of them.
+func LogMaxBackups() int {
+	parseInputs()
+	n, err := strconv.Atoi(logMaxBackups)
+	if err != nil || n < 0 {
+		log.Printf("Invalid value '%v' for --%v, keeping 5 instead", logMaxBackups, logMaxBackupsConst.CmdLine)
+		return 5
+	}
+	return n
+}
+
+// LogMaxAge returns how long rotated log files are kept. 0 keeps them regardless of their age.
+func LogMaxAge() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(logMaxAge)
+	if err != nil || d < 0 {
+		log.Printf("Invalid value '%v' for --%v, keeping rotated log files regardless of their age", logMaxAge, logMaxAgeConst.CmdLine)
+		return 0
+	}
+	return d
+}
+
+// JobTimelineRetention returns how long the log records of each job are kept for its timeline. 0 keeps them forever.
+func JobTimelineRetention() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(jobTimelineRetention)
+	if err != nil || d < 0 {
+		log.Printf("Invalid value '%v' for --%v, using 720h instead", jobTimelineRetention, jobTimelineRetentionConst.CmdLine)
+		return 30 * 24 * time.Hour
+	}
+	return d
+}
+
+// BackupDir returns the directory that scheduled backups are saved to. An empty string means that they are disabled.
+func BackupDir() string {
+	parseInputs()
+	return backupDir
+}
+
+// BackupInterval returns how often scheduled backups are saved.
+func BackupInterval() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(backupInterval)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid value '%v' for --%v, using 24h instead", backupInterval, backupIntervalConst.CmdLine)
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// BackupKeep returns how many scheduled backups are kept.
+func BackupKeep() int {
+	parseInputs()
+	n, err := strconv.Atoi(backupKeep)
+	if err != nil || n < 1 {
+		log.Printf("Invalid value '%v' for --%v, keeping 7 instead", backupKeep, backupKeepConst.CmdLine)
+		return 7
+	}
+	return n
+}
+
+// MaxLeaseDuration returns the longest lease on a job that a Runner may ask for.
+func MaxLeaseDuration() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(maxLeaseDuration)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid value '%v' for --%v, using 24h instead", maxLeaseDuration, maxLeaseDurationConst.CmdLine)
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// RunnerOfflineThreshold returns how long a Runner may go without being seen before it is considered offline.
+// 0 disables the offline check.
+func RunnerOfflineThreshold() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(runnerOfflineThreshold)
+	if err != nil || d < 0 {
+		log.Printf("Invalid value '%v' for --%v, using 90s instead", runnerOfflineThreshold, runnerOfflineThresholdConst.CmdLine)
+		return 90 * time.Second
+	}
+	return d
+}
+
+// RestartGracePeriod returns how long the Runners have to renew the leases on their dispatched jobs after the Controller starts.
+// 0 disables the grace period.
+func RestartGracePeriod() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(restartGracePeriod)
+	if err != nil || d < 0 {
+		log.Printf("Invalid value '%v' for --%v, using 2m instead", restartGracePeriod, restartGracePeriodConst.CmdLine)
+		return 2 * time.Minute
+	}
+	return d
+}
+
+// NoRunnersAlert returns how long no Runner may be seen while jobs are queued before the user is alerted.
+// 0 disables the alert.
+func NoRunnersAlert() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(noRunnersAlert)
+	if err != nil || d < 0 {
+		log.Printf("Invalid value '%v' for --%v, using 1h instead", noRunnersAlert, noRunnersAlertConst.CmdLine)
+		return time.Hour
+	}
+	return d
+}
+
+// DatastoreMaxBackoff returns the longest wait between attempts to reach the datastore while it is unavailable.
+func DatastoreMaxBackoff() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(datastoreMaxBackoff)
+	if err != nil || d < time.Second {
+		log.Printf("Invalid value '%v' for --%v, using 1m instead", datastoreMaxBackoff, datastoreMaxBackoffConst.CmdLine)
+		return time.Minute
+	}
+	return d
+}
+
+// DatastoreBreakerThreshold returns how many failed attempts in a row to reach the datastore mark it as down.
+// 0 never marks it as down.
+func DatastoreBreakerThreshold() int {
+	parseInputs()
+	n, err := strconv.Atoi(datastoreBreakerThreshold)
+	if err != nil || n < 0 {
+		log.Printf("Invalid value '%v' for --%v, using 5 instead", datastoreBreakerThreshold, datastoreBreakerThresholdConst.CmdLine)
+		return 5
+	}
+	return n
+}
+
+// ResolveSymlinks returns whether or not symlinks in media paths should be resolved.
+func ResolveSymlinks() bool {
+	parseInputs()
+	b, err := strconv.ParseBool(resolveSymlinks)
+	if err != nil {
+		log.Printf("Invalid value '%v' for --%v, leaving symlinks unresolved", resolveSymlinks, resolveSymlinksConst.CmdLine)
+		return false
+	}
+	return b
+}
+
+// FFprobeSidecars returns whether or not metadata should be read from ffprobe sidecar files when they are present.
+func FFprobeSidecars() bool {
+	parseInputs()
+	b, err := strconv.ParseBool(ffprobeSidecars)
+	if err != nil {
+		log.Printf("Invalid value '%v' for --%v, ignoring ffprobe sidecars", ffprobeSidecars, ffprobeSidecarsConst.CmdLine)
+		return false
+	}
+	return b
+}
+
+// CaseInsensitivePaths returns whether or not media paths should be compared case-insensitively.
+func CaseInsensitivePaths() bool {
+	parseInputs()
+	b, err := strconv.ParseBool(caseInsensitivePaths)
+	if err != nil {
+		log.Printf("Invalid value '%v' for --%v, comparing paths case-sensitively", caseInsensitivePaths, caseInsensitivePathsConst.CmdLine)
+		return false
+	}
+	return b
+}
+
+// DeletedLibraryRetention returns how long a deleted library can be restored before it is purged.
+func DeletedLibraryRetention() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(deletedLibraryRetention)
+	if err != nil || d < 0 {
+		log.Printf("Invalid value '%v' for --%v, using 168h instead", deletedLibraryRetention, deletedLibraryRetentionConst.CmdLine)
+		return 7 * 24 * time.Hour
+	}
+	return d
+}
+
+// PopStrategy returns the name of the strategy used to choose which queued job is dispatched next.
+func PopStrategy() string {
+	parseInputs()
+	return popStrategy
+}
+
+// QueueAging returns how much the priority of a queued job rises for every day that it waits. 0 disables aging.
+func QueueAging() float64 {
+	parseInputs()
+	f, err := strconv.ParseFloat(queueAging, 64)
+	if err != nil || f < 0 {
+		log.Printf("Invalid value '%v' for --%v, disabling queue aging", queueAging, queueAgingConst.CmdLine)
+		return 0
+	}
+	return f
+}
+
+// MaxConcurrentScans returns how many libraries may be scanned at once. 0 doesn't limit the scans.
+func MaxConcurrentScans() int {
+	parseInputs()
+	n, err := strconv.Atoi(maxConcurrentScans)
+	if err != nil || n < 0 {
+		log.Printf("Invalid value '%v' for --%v, not limiting concurrent scans", maxConcurrentScans, maxConcurrentScansConst.CmdLine)
+		return 0
+	}
+	return n
+}
+
+// MaxScanLoad returns the CPU load, as a percentage of the CPUs, above which scans are deferred. 0 disables the limit.
+func MaxScanLoad() float64 {
+	parseInputs()
+	f, err := strconv.ParseFloat(maxScanLoad, 64)
+	if err != nil || f < 0 {
+		log.Printf("Invalid value '%v' for --%v, not limiting scans by CPU load", maxScanLoad, maxScanLoadConst.CmdLine)
+		return 0
+	}
+	return f
+}
+
+// MetadataReadConcurrency returns how many files may have their metadata read at once across all library scans.
+func MetadataReadConcurrency() int {
+	parseInputs()
+	n, err := strconv.Atoi(metadataReadConcurrency)
+	if err != nil || n < 1 {
+		log.Printf("Invalid value '%v' for --%v, using 4 instead", metadataReadConcurrency, metadataReadConcurrencyConst.CmdLine)
+		return 4
+	}
+	return n
+}
+
+// MetadataReadTimeout returns how long reading the metadata of an empty file may take. 0 disables the timeout.
+func MetadataReadTimeout() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(metadataReadTimeout)
+	if err != nil || d < 0 {
+		log.Printf("Invalid value '%v' for --%v, using 1m instead", metadataReadTimeout, metadataReadTimeoutConst.CmdLine)
+		return time.Minute
+	}
+	return d
+}
+
+// MetadataReadTimeoutPerGiB returns how much longer reading the metadata of a file may take for every GiB of its size.
+func MetadataReadTimeoutPerGiB() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(metadataReadTimeoutPerGiB)
+	if err != nil || d < 0 {
+		log.Printf("Invalid value '%v' for --%v, using 10s instead", metadataReadTimeoutPerGiB, metadataReadTimeoutPerGiBConst.CmdLine)
+		return 10 * time.Second
+	}
+	return d
+}
+
+// MaxMetadataReadTimeout returns the longest that reading the metadata of any file may take.
+func MaxMetadataReadTimeout() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(maxMetadataReadTimeout)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid value '%v' for --%v, using 15m instead", maxMetadataReadTimeout, maxMetadataReadTimeoutConst.CmdLine)
+		return 15 * time.Minute
+	}
+	return d
+}
+
+// MetadataReadArgs returns the extra arguments that are passed to MediaInfo when reading the metadata of a file.
+func MetadataReadArgs() []string {
+	parseInputs()
+	return strings.Fields(metadataReadArgs)
+}
+
+// TrashDir returns the folder that originals are moved to by the move-to-trash original file handling.
+// It defaults to trash in the config directory.
+func TrashDir() string {
+	parseInputs()
+	if trashDir == "" {
+		return configDir + "/trash"
+	}
+	return trashDir
+}
+
+// StagingDir returns the folder that the files received from the Runners are kept in until they are imported.
+// It defaults to staging in the config directory.
+func StagingDir() string {
+	parseInputs()
+	if stagingDir == "" {
+		return configDir + "/staging"
+	}
+	return stagingDir
+}
+
+// TrashRetention returns how long originals are kept in the trash before they are deleted. 0 disables the retention.
+func TrashRetention() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(trashRetention)
+	if err != nil || d < 0 {
+		log.Printf("Invalid value '%v' for --%v, using 720h instead", trashRetention, trashRetentionConst.CmdLine)
+		return 30 * 24 * time.Hour
+	}
+	return d
+}
+
+// TrashMinFreeSpace returns how many bytes must be free on the trash's filesystem before the oldest originals in it are
+// deleted early. 0 disables the check.
+func TrashMinFreeSpace() uint64 {
+	parseInputs()
+	n, err := strconv.ParseUint(trashMinFreeSpace, 10, 64)
+	if err != nil {
+		log.Printf("Invalid value '%v' for --%v, disabling the free space check", trashMinFreeSpace, trashMinFreeSpaceConst.CmdLine)
+		return 0
+	}
+	return n
+}
+
+// MaxAwaitingSpace returns how many bytes of transcoded files may wait for space in their libraries at once.
+func MaxAwaitingSpace() int64 {
+	parseInputs()
+	n, err := strconv.ParseInt(maxAwaitingSpace, 10, 64)
+	if err != nil || n < 0 {
+		log.Printf("Invalid value '%v' for --%v, using 53687091200 instead", maxAwaitingSpace, maxAwaitingSpaceConst.CmdLine)
+		return 50 << 30
+	}
+	return n
+}
+
+// TranscodeBudget returns how many bytes of transcoded files may be imported within TranscodeBudgetWindow before
+// dispatching pauses. 0 disables the budget.
+func TranscodeBudget() int64 {
+	parseInputs()
+	n, err := strconv.ParseInt(transcodeBudget, 10, 64)
+	if err != nil || n < 0 {
+		log.Printf("Invalid value '%v' for --%v, disabling the transcode budget", transcodeBudget, transcodeBudgetConst.CmdLine)
+		return 0
+	}
+	return n
+}
+
+// TranscodeBudgetWindow returns the rolling window that the transcode budget applies to.
+func TranscodeBudgetWindow() time.Duration {
+	parseInputs()
+	d, err := time.ParseDuration(transcodeBudgetWindow)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid value '%v' for --%v, using 24h instead", transcodeBudgetWindow, transcodeBudgetWindowConst.CmdLine)
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// SpaceReservationRatio returns how much space is reserved on a library's filesystem for each dispatched job, relative
+// to the size of its original file. 0 disables the reservations.
+func SpaceReservationRatio() float64 {
+	parseInputs()
+	f, err := strconv.ParseFloat(spaceReservationRatio, 64)
+	if err != nil || f < 0 {
+		log.Printf("Invalid value '%v' for --%v, disabling space reservations", spaceReservationRatio, spaceReservationRatioConst.CmdLine)
+		return 0
+	}
+	return f
+}
+
+// SidecarExtensions returns the extensions of the sidecar files which are moved along with a video file.
+// Extensions without a leading dot are given one.
+func SidecarExtensions() []string {
+	parseInputs()
+	extensions := make([]string, 0)
+	for _, ext := range strings.Split(sidecarExtensions, ",") {
+		ext = strings.TrimSpace(ext)
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions = append(extensions, ext)
+	}
+	return extensions
+}
+
+// SecretsKeyFile returns the path of the key file that sensitive settings are encrypted with.
+// It defaults to secrets.key in the config directory.
+func SecretsKeyFile() string {
+	parseInputs()
+	if secretsKeyFile == "" {
+		return configDir + "/secrets.key"
+	}
+	return secretsKeyFile
+}
+
 // makeConfigDir creates the options.configDir
 func makeConfigDir() {
 	err := os.MkdirAll(configDir, 0777)
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrCPULoadUnsupported is returned by CPULoad on platforms where the load can't be read.
+var ErrCPULoadUnsupported = errors.New("reading the CPU load isn't supported on this platform")
+
+// parseLoadAverage returns the one-minute load average from s, which is either the contents of /proc/loadavg
+// ("0.52 0.58 0.59 1/467 12345") or the output of sysctl -n vm.loadavg ("{ 0.52 0.58 0.59 }"), as a percentage of
+// the CPUs.
+func parseLoadAverage(s string, cpus int) (float64, error) {
+	fields := strings.Fields(strings.Trim(strings.TrimSpace(s), "{}"))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("invalid load average '%v'", s)
+	}
+
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || load < 0 {
+		return 0, fmt.Errorf("invalid load average '%v'", s)
+	}
+	if cpus < 1 {
+		cpus = 1
+	}
+	return load / float64(cpus) * 100, nil
+}
@@ -0,0 +1,19 @@
+//go:build darwin
+// +build darwin
+
+package controller
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// CPULoad returns the one-minute load average as a percentage of the CPUs, so 100 means that there is a runnable
+// process for every CPU. It is read with sysctl.
+func CPULoad() (float64, error) {
+	b, err := exec.Command("sysctl", "-n", "vm.loadavg").Output()
+	if err != nil {
+		return 0, err
+	}
+	return parseLoadAverage(string(b), runtime.NumCPU())
+}
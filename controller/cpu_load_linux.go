@@ -0,0 +1,19 @@
+//go:build linux
+// +build linux
+
+package controller
+
+import (
+	"os"
+	"runtime"
+)
+
+// CPULoad returns the one-minute load average as a percentage of the CPUs, so 100 means that there is a runnable
+// process for every CPU. It is read from /proc/loadavg.
+func CPULoad() (float64, error) {
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	return parseLoadAverage(string(b), runtime.NumCPU())
+}
@@ -0,0 +1,37 @@
+package controller
+
+import "testing"
+
+func TestParseLoadAverage(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		cpus     int
+		expected float64
+		err      bool
+	}{
+		{name: "Proc", in: "2.00 1.50 1.00 3/467 12345\n", cpus: 4, expected: 50},
+		{name: "Sysctl", in: "{ 6.00 5.00 4.00 }\n", cpus: 4, expected: 150},
+		{name: "No CPUs", in: "0.50 0.50 0.50 1/1 1", cpus: 0, expected: 50},
+		{name: "Empty", in: "", cpus: 4, err: true},
+		{name: "Not A Number", in: "{ load }", cpus: 4, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			load, err := parseLoadAverage(test.in, test.cpus)
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error but got %v", load)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if load != test.expected {
+				t.Errorf("expected %v but got %v", test.expected, load)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package controller
+
+// CPULoad always returns ErrCPULoadUnsupported.
+func CPULoad() (float64, error) {
+	return 0, ErrCPULoadUnsupported
+}
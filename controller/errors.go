@@ -5,5 +5,34 @@ import "errors"
 // ErrEmptyQueue represents when the operation cannot be completed because the queue is empty
 var ErrEmptyQueue error = errors.New("queue is empty")
 
+// ErrDatabaseTooNew is returned when the database schema was migrated by a newer version of the Controller than the one running.
+var ErrDatabaseTooNew = errors.New("database schema is newer than this version of the Controller supports")
+
+// ErrBackupNotSupported is returned by data storers which can't take a snapshot of their database.
+var ErrBackupNotSupported = errors.New("backups are not supported by this data storer")
+
+// ErrLibraryConflict is returned by SaveLibrary when the library was saved by someone else after it was read.
+// The library should be read again and the change re-applied.
+var ErrLibraryConflict = errors.New("library was modified by another caller")
+
+// ErrNoJobAvailable is returned by PopNewJob when there isn't a job which can be dispatched.
+var ErrNoJobAvailable = errors.New("no available jobs")
+
+// ErrJobNotFound is returned when there isn't a queued job with the provided UUID.
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobDispatched is returned when an operation which only applies to queued jobs is attempted on a dispatched job.
+var ErrJobDispatched = errors.New("job is dispatched")
+
+// ErrJobNotMovable is returned by MoveJob when the target library wouldn't queue the job or the job can't leave its library.
+var ErrJobNotMovable = errors.New("job can't be moved")
+
+// ErrPathDispatched is returned by SaveDispatchedJob when another job for the same path is already dispatched.
+var ErrPathDispatched = errors.New("another job for the path is already dispatched")
+
 // ErrClosed is used when a struct is closed but an operation was attempted anyway.
 var ErrClosed = errors.New("attempted operation on closed struct")
+
+// ErrInsufficientSpace is returned by MoveFile when a file has to be copied, but the filesystem it is copied to
+// doesn't have room for it.
+var ErrInsufficientSpace = errors.New("not enough free space on the destination filesystem")
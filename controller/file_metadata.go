@@ -1,11 +1,52 @@
 package controller
 
+import (
+	"strings"
+	"time"
+)
+
 // FileMetadata contains information about a video file.
 type FileMetadata struct {
 	General        General         `json:"general"`
 	VideoTracks    []VideoTrack    `json:"video_tracks"`
 	AudioTracks    []AudioTrack    `json:"audio_tracks"`
 	SubtitleTracks []SubtitleTrack `json:"subtitle_tracks"`
+
+	// ClosedCaptions is whether or not the video carries embedded EIA-608/708 captions. They are part of the
+	// video stream, so they aren't included in SubtitleTracks.
+	ClosedCaptions bool `json:"closed_captions"`
+
+	// Chapters is whether or not the file has chapter markers.
+	Chapters bool `json:"chapters"`
+
+	// Programs are the programs of a file which carries several of them (ex. a DVR capture of a transport stream), in the
+	// order that the file lists them. It is empty for files without programs.
+	Programs []Program `json:"programs,omitempty"`
+}
+
+// MetadataReadOptions are a library's overrides of how the metadata of its files is read.
+type MetadataReadOptions struct {
+	// Timeout is how long reading the metadata of a file may take. Zero uses the metadata reader's own timeouts.
+	Timeout time.Duration
+
+	// Args are passed to the metadata reader instead of its own extra arguments. Empty uses its own.
+	Args []string
+}
+
+// Program is one of the programs of a media file, which FFmpeg selects the streams of with -map 0:p:<ID>.
+type Program struct {
+	ID            int   `json:"id"`             // "MenuID" of the tracks (MI), "program_id" (FF)
+	StreamIndexes []int `json:"stream_indexes"` // The Index of every track that belongs to the program.
+}
+
+// Contains returns whether or not the track with the provided index belongs to the program.
+func (p Program) Contains(index int) bool {
+	for _, i := range p.StreamIndexes {
+		if i == index {
+			return true
+		}
+	}
+	return false
 }
 
 // NOTE: Track type determined by "@type" for MediaInfo and "codec_type" for FFProbe
@@ -24,12 +65,23 @@ type VideoTrack struct {
 	Width          int    `json:"width"`           // "Width" (MI), "width" (FF)
 	Height         int    `json:"height"`          // "Height" (MI), "height" (FF)
 	ColorPrimaries string `json:"color_primaries"` // "colour_primaries" (MI), "color_primaries" (FF) Will be different based on which MetadataReader is being used (FF gives "bt2020" while MI gives "BT.2020")
+	BitDepth       int    `json:"bit_depth"`       // "BitDepth" (MI), "bits_per_raw_sample" (FF) Zero if the MetadataReader couldn't tell.
+
+	// VariableFrameRate is whether or not the frame rate changes throughout the track.
+	// "FrameRate_Mode" is VFR (MI), "r_frame_rate" differs from "avg_frame_rate" (FF)
+	VariableFrameRate bool `json:"variable_frame_rate"`
+}
+
+// HDR returns whether or not the track uses the BT.2020 color primaries, which is how HDR video is recognized.
+func (v VideoTrack) HDR() bool {
+	return strings.Contains(strings.ToLower(v.ColorPrimaries), "2020")
 }
 
 // AudioTrack contains information about a singular audio stream in a media file.
 type AudioTrack struct {
-	Index    int `json:"index"`    // "StreamOrder" (MI), "index" (FF)
-	Channels int `json:"channels"` // "Channels" (MI), "channels" (FF)
+	Index    int    `json:"index"`    // "StreamOrder" (MI), "index" (FF)
+	Channels int    `json:"channels"` // "Channels" (MI), "channels" (FF)
+	Language string `json:"language"` // "Language" (MI), "tags.language"
 }
 
 // SubtitleTrack contains information about a singular text stream in a media file.
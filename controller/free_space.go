@@ -0,0 +1,21 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package controller
+
+import (
+	"errors"
+	"syscall"
+)
+
+// ErrFreeSpaceUnsupported is returned by FreeSpace on platforms where it can't be checked.
+var ErrFreeSpaceUnsupported = errors.New("checking free space isn't supported on this platform")
+
+// FreeSpace returns how many bytes are available to unprivileged users on the filesystem holding dir.
+func FreeSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package controller
+
+import "errors"
+
+// ErrFreeSpaceUnsupported is returned by FreeSpace on platforms where it can't be checked.
+var ErrFreeSpaceUnsupported = errors.New("checking free space isn't supported on this platform")
+
+// FreeSpace always returns ErrFreeSpaceUnsupported.
+func FreeSpace(dir string) (uint64, error) {
+	return 0, ErrFreeSpaceUnsupported
+}
@@ -3,9 +3,9 @@ module github.com/BrenekH/encodarr/controller
 go 1.17
 
 require (
-	github.com/BrenekH/logange v0.6.0
 	github.com/golang-migrate/migrate/v4 v4.15.0-beta.1
 	github.com/google/uuid v1.2.0
+	github.com/lib/pq v1.10.0
 	modernc.org/sqlite v1.10.6
 )
 
@@ -0,0 +1,153 @@
+package httpserver
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// uncompressedPrefixes are the URL path prefixes that should never be compressed.
+// The Runner API transfers media files, which are already compressed, so compressing them again just wastes CPU.
+var uncompressedPrefixes = []string{"/api/runner/"}
+
+// compressibleContentTypes are the content types that are worth compressing.
+var compressibleContentTypes = []string{"application/json", "application/javascript", "text/"}
+
+// shouldCompressPattern returns whether or not a handler registered under pattern should have its responses compressed.
+func shouldCompressPattern(pattern string) bool {
+	for _, v := range uncompressedPrefixes {
+		if strings.HasPrefix(pattern, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// compressionHandler wraps h so that compressible responses are gzipped when the client supports it.
+func compressionHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		defer gw.Close()
+
+		h.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip parses the value of an Accept-Encoding header and returns whether or not gzip is acceptable.
+func acceptsGzip(acceptEncoding string) bool {
+	for _, v := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(strings.TrimSpace(v), ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if parsed, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		if q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter is a http.ResponseWriter that decides whether or not to compress the response
+// once the content type is known (on the first call to Write).
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+
+	statusCode  int
+	wroteHeader bool
+}
+
+// WriteHeader stores the status code so that the compression headers can still be set before it is sent.
+func (g *gzipResponseWriter) WriteHeader(statusCode int) {
+	if g.wroteHeader {
+		return
+	}
+	g.statusCode = statusCode
+}
+
+// Write compresses p if the response is compressible. Otherwise, p is passed straight through.
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		g.writeHeader(p)
+	}
+
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+	return g.ResponseWriter.Write(p)
+}
+
+// Close flushes any compressed data and sends the headers if they haven't been already.
+func (g *gzipResponseWriter) Close() error {
+	if !g.wroteHeader {
+		g.writeHeader(nil)
+	}
+
+	if g.gz != nil {
+		return g.gz.Close()
+	}
+	return nil
+}
+
+// writeHeader decides whether or not to compress the response based on the content type
+// and sends the headers to the client.
+func (g *gzipResponseWriter) writeHeader(firstWrite []byte) {
+	g.wroteHeader = true
+	h := g.Header()
+
+	ct := h.Get("Content-Type")
+	if ct == "" && len(firstWrite) > 0 {
+		ct = http.DetectContentType(firstWrite)
+		h.Set("Content-Type", ct)
+	}
+
+	if len(firstWrite) > 0 && h.Get("Content-Encoding") == "" && isCompressibleContentType(ct) && compressibleStatus(g.statusCode) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+
+	g.ResponseWriter.WriteHeader(g.statusCode)
+}
+
+// isCompressibleContentType returns whether or not a response with the provided content type should be compressed.
+func isCompressibleContentType(ct string) bool {
+	for _, v := range compressibleContentTypes {
+		if strings.HasPrefix(ct, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressibleStatus returns whether or not a response with the provided status code can have its body compressed.
+// Partial content is never compressed because the byte ranges refer to the uncompressed representation.
+func compressibleStatus(statusCode int) bool {
+	switch {
+	case statusCode >= 100 && statusCode < 200:
+		return false
+	case statusCode == http.StatusNoContent, statusCode == http.StatusNotModified, statusCode == http.StatusPartialContent:
+		return false
+	}
+	return true
+}
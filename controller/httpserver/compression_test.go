@@ -0,0 +1,136 @@
+package httpserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testJSON = `{"history": [{"file": "/media/movie.mkv"}]}`
+
+func jsonHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(testJSON))
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		expectGzip     bool
+	}{
+		{name: "No Accept-Encoding", acceptEncoding: "", expectGzip: false},
+		{name: "gzip", acceptEncoding: "gzip", expectGzip: true},
+		{name: "Multiple encodings", acceptEncoding: "br, gzip, deflate", expectGzip: true},
+		{name: "gzip explicitly refused", acceptEncoding: "gzip;q=0, deflate", expectGzip: false},
+		{name: "Wildcard", acceptEncoding: "*", expectGzip: true},
+		{name: "Unsupported encoding only", acceptEncoding: "br", expectGzip: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/web/v1/history", nil)
+			if test.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+
+			compressionHandler(http.HandlerFunc(jsonHandler)).ServeHTTP(rec, req)
+
+			gotGzip := rec.Header().Get("Content-Encoding") == "gzip"
+			if gotGzip != test.expectGzip {
+				t.Fatalf("expected gzip to be %v but Content-Encoding was '%v'", test.expectGzip, rec.Header().Get("Content-Encoding"))
+			}
+
+			var body io.Reader = rec.Body
+			if gotGzip {
+				gr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatalf("unexpected error creating gzip reader: %v", err)
+				}
+				body = gr
+			}
+
+			b, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("unexpected error reading body: %v", err)
+			}
+			if string(b) != testJSON {
+				t.Errorf("expected body %v but got %v", testJSON, string(b))
+			}
+		})
+	}
+}
+
+func TestCompressionSniffsContentType(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/web/v1/settings", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+
+	// No Content-Type is set, which is what a couple of the web handlers do.
+	compressionHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testJSON))
+	})).ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("expected sniffed text response to be compressed")
+	}
+}
+
+func TestCompressionSkipsNonCompressibleResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "Video content type",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "video/x-matroska")
+				w.Write([]byte{0x1a, 0x45, 0xdf, 0xa3})
+			},
+		},
+		{
+			name: "No Content",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rec := httptest.NewRecorder()
+
+			compressionHandler(test.handler).ServeHTTP(rec, req)
+
+			if rec.Header().Get("Content-Encoding") != "" {
+				t.Errorf("expected response to not be compressed")
+			}
+		})
+	}
+}
+
+func TestShouldCompressPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected bool
+	}{
+		{pattern: "/api/web/v1/history", expected: true},
+		{pattern: "/api/web/v1/library/", expected: true},
+		{pattern: "/", expected: true},
+		{pattern: "/api/runner/v1/job/request", expected: false},
+		{pattern: "/api/runner/v1/job/complete", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			if out := shouldCompressPattern(test.pattern); out != test.expected {
+				t.Errorf("expected %v but got %v", test.expected, out)
+			}
+		})
+	}
+}
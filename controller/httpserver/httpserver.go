@@ -33,7 +33,7 @@ type Server struct {
 
 // Start starts the http server which will exit when ctx is closed. Calling Start more than once results in a no-op.
 // The passed sync.WaitGroup should not have the Add method called before passing to Start.
-func (s *Server) Start(ctx *context.Context, wg *sync.WaitGroup) {
+func (s *Server) Start(ctx context.Context, wg *sync.WaitGroup) {
 	if s.serverAlreadyStarted {
 		return
 	}
@@ -48,7 +48,7 @@ func (s *Server) Start(ctx *context.Context, wg *sync.WaitGroup) {
 	go func() {
 		defer wg.Done()
 
-		<-(*ctx).Done()
+		<-ctx.Done()
 
 		shutdownCtx, ctxCancel := context.WithTimeout(context.Background(), time.Duration(10*time.Second))
 		defer ctxCancel()
@@ -60,14 +60,18 @@ func (s *Server) Start(ctx *context.Context, wg *sync.WaitGroup) {
 	}()
 }
 
-// Handle wraps net/http.Handle.
+// Handle wraps net/http.Handle. Responses are compressed when the client supports it, unless the pattern
+// is for an endpoint which transfers media files.
 func (s *Server) Handle(pattern string, handler http.Handler) {
+	if shouldCompressPattern(pattern) {
+		handler = compressionHandler(handler)
+	}
 	http.Handle(pattern, handler)
 }
 
-// HandleFunc wraps net/http.HandleFunc.
+// HandleFunc wraps net/http.HandleFunc. Responses are compressed in the same way as Handle.
 func (s *Server) HandleFunc(pattern string, handlerFunc func(http.ResponseWriter, *http.Request)) {
-	http.HandleFunc(pattern, handlerFunc)
+	s.Handle(pattern, http.HandlerFunc(handlerFunc))
 }
 
 func startListenAndServer(wg *sync.WaitGroup, logger controller.Logger, port string) *http.Server {
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"sync"
 	"time"
@@ -12,10 +13,18 @@ import (
 // should interact with the Run function.
 type HealthChecker interface {
 	// Run loops through the provided slice of dispatched jobs and checks if any have
-	// surpassed the allowed time between updates.
-	Run() (uuidsToNull []UUID)
+	// surpassed the allowed time between updates. The returned jobs have been taken away from their Runners,
+	// so their UUIDs should be nullified and the jobs handed to the LibraryManager.
+	Run() (staleJobs []StaleJob)
 
-	Start(ctx *context.Context)
+	// LeaseDuration returns how long the leases on the jobs of the provided library last by default.
+	LeaseDuration(libraryID int) time.Duration
+
+	// CheckRunnersAvailable alerts the user if no Runner has been seen for a while even though jobsQueued is true.
+	// It returns when a Runner was last seen while the alert is raised, or the zero time once a Runner is seen again.
+	CheckRunnersAvailable(jobsQueued bool) (noRunnersSince time.Time)
+
+	Start(ctx context.Context)
 }
 
 // The LibraryManager interface describes how a struct wishing to deal with user's
@@ -35,7 +44,44 @@ type LibraryManager interface {
 	// them to the appropriate libraries.
 	UpdateLibrarySettings(map[int]Library)
 
-	Start(ctx *context.Context, wg *sync.WaitGroup)
+	// ScanLibraries starts a scan of each of the provided libraries that isn't already being scanned.
+	ScanLibraries(ids []int)
+
+	// ScanningLibraries returns the IDs of the libraries which are currently being scanned.
+	ScanningLibraries() []int
+
+	// AwaitingSpaceJobs returns the completed jobs which are waiting for space in their library to be imported.
+	AwaitingSpaceJobs() []Job
+
+	// StagedFiles returns the files received from the Runners which the LibraryManager holds on to after importing
+	// their jobs, which are those of the jobs waiting for space.
+	StagedFiles() []string
+
+	// MetricsSnapshot returns the values of the metrics at a single point in time.
+	MetricsSnapshot() MetricsSnapshot
+
+	// RequeueLibrary forgets which files of the library have already been processed and starts a scan of it,
+	// so that they are queued again.
+	RequeueLibrary(libraryID int) error
+
+	// HandleStaleJobs applies the action of each of the provided stale jobs, which have already been removed
+	// from the dispatched jobs.
+	HandleStaleJobs([]StaleJob)
+
+	// Health returns whether or not the datastore can be reached.
+	Health() DatastoreHealth
+
+	// DispatchPlan returns the order in which the queued jobs are expected to be dispatched.
+	DispatchPlan() DispatchPlan
+
+	// QueueBenchmarks prepares benchmark jobs for the provided requests.
+	QueueBenchmarks([]BenchmarkRequest)
+
+	// PopBenchmarkJob returns a prepared benchmark job which may be dispatched to one of the provided waiting Runners
+	// and forgets it. ErrNoJobAvailable is returned if there isn't one.
+	PopBenchmarkJob(waitingRunners []string) (Job, error)
+
+	Start(ctx context.Context, wg *sync.WaitGroup)
 }
 
 // The RunnerCommunicator interface describes how a struct wishing to communicate
@@ -45,8 +91,9 @@ type RunnerCommunicator interface {
 	// system.
 	CompletedJobs() []CompletedJob
 
-	// NewJob takes the provided job and sends it to a waiting Runner.
-	NewJob(Job)
+	// NewJob takes the provided job and sends it to a waiting Runner, along with a lease on it that lasts for at least
+	// leaseDuration. Benchmark jobs for a specific Runner are only sent to that Runner.
+	NewJob(job Job, leaseDuration time.Duration)
 
 	// NeedNewJob returns a boolean indicating whether or not a new job is required.
 	NeedNewJob() bool
@@ -59,7 +106,12 @@ type RunnerCommunicator interface {
 	// WaitingRunners returns the names of all the Runners which are waiting for a job.
 	WaitingRunners() (runnerNames []string)
 
-	Start(ctx *context.Context, wg *sync.WaitGroup)
+	// CleanStaging removes the files received from the Runners which are left behind, ex. by a crash, because they
+	// don't belong to a dispatched job or a job being received, and aren't in keep. It is called from the same
+	// goroutine as the imports and may only do the cleanup every so often.
+	CleanStaging(keep []string)
+
+	Start(ctx context.Context, wg *sync.WaitGroup)
 }
 
 // The UserInterfacer interface describes how a struct wishing to interact
@@ -76,7 +128,71 @@ type UserInterfacer interface {
 	// the waiting Runner is received.
 	SetWaitingRunners(runnerNames []string)
 
-	Start(ctx *context.Context, wg *sync.WaitGroup)
+	// ScanRequests returns the IDs of the libraries that the user has requested to be scanned.
+	ScanRequests() []int
+
+	// RequeueRequests returns the IDs of the libraries that the user has requested to be requeued.
+	RequeueRequests() []int
+
+	// SetScanningLibraries stores the IDs of the libraries which are currently being scanned.
+	SetScanningLibraries(ids []int)
+
+	// SetAwaitingSpaceJobs stores the completed jobs which are waiting for space in their library to be imported.
+	SetAwaitingSpaceJobs(jobs []Job)
+
+	// SetNoRunnersSince stores when a Runner was last seen while the no runners alert is raised. The zero time clears the alert.
+	SetNoRunnersSince(t time.Time)
+
+	// SetMetricsSnapshot stores the latest snapshot of the metrics for an incoming request.
+	SetMetricsSnapshot(MetricsSnapshot)
+
+	// SetDatastoreHealth stores whether or not the datastore can be reached so that an outage can be shown to the user.
+	SetDatastoreHealth(DatastoreHealth)
+
+	// SetDispatchPlan stores the order in which the queued jobs are expected to be dispatched, so that their positions
+	// and estimated start times can be shown to the user.
+	SetDispatchPlan(DispatchPlan)
+
+	// BenchmarkRequests returns the benchmarks that the user has requested.
+	BenchmarkRequests() []BenchmarkRequest
+
+	Start(ctx context.Context, wg *sync.WaitGroup)
+}
+
+// The Notifier interface describes how a struct wishing to notify the user about events
+// should interact with other components of the application.
+type Notifier interface {
+	// Notify sends the provided event to the user.
+	Notify(Event)
+}
+
+// The MetricsCollector interface describes how a struct wishing to collect metrics
+// should interact with other components of the application.
+type MetricsCollector interface {
+	// Counter returns the named counter, registering it with the provided help text if it doesn't exist yet.
+	Counter(name, help string) Counter
+
+	// Histogram returns the named histogram, registering it with the provided help text and bucket upper bounds
+	// if it doesn't exist yet.
+	Histogram(name, help string, buckets []float64) Histogram
+
+	// Batch runs f, which updates several metrics that belong together, so that a snapshot sees all or none of its updates.
+	Batch(f func())
+
+	// Snapshot returns the values of every metric at a single point in time.
+	Snapshot() MetricsSnapshot
+}
+
+// Counter is a metric which can only go up.
+type Counter interface {
+	// Add increases the counter by delta. Negative values are ignored.
+	Add(delta float64)
+}
+
+// Histogram is a metric which counts observations into buckets.
+type Histogram interface {
+	// Observe records a single value.
+	Observe(value float64)
 }
 
 // The SettingsStorer defines how a struct which stores the settings in some manner
@@ -88,59 +204,291 @@ type SettingsStorer interface {
 
 	// Getters and Setters
 
+	// CompressQueues is whether the library queues are gzip compressed when they are saved. Queues which were
+	// saved before it was changed are still read.
+	CompressQueues() bool
+	SetCompressQueues(bool)
+
 	HealthCheckInterval() uint64
 	SetHealthCheckInterval(uint64)
 
+	// MediaServer is the media server which is told to rescan the folders of replaced files. Its Type is empty if there isn't one.
+	MediaServer() MediaServer
+	SetMediaServer(MediaServer)
+
+	// Notifications are the channels that events are posted to and when the daily digest is sent.
+	Notifications() Notifications
+	SetNotifications(Notifications)
+
 	HealthCheckTimeout() uint64
 	SetHealthCheckTimeout(uint64)
 
+	// StaleJobAction is what is done with jobs which haven't been updated within the HealthCheckTimeout,
+	// unless their library overrides it.
+	StaleJobAction() string
+	SetStaleJobAction(string)
+
 	LogVerbosity() string
 	SetLogVerbosity(string)
+
+	// LogLevels maps the names of logger components (ex. library.Manager, or library for every library component)
+	// to the log verbosity which overrides LogVerbosity for them.
+	LogLevels() map[string]string
+	SetLogLevels(map[string]string)
+
+	// MaxJobAttempts is the number of times a job may fail before it is quarantined instead of re-queued.
+	MaxJobAttempts() uint64
+	SetMaxJobAttempts(uint64)
+
+	// QueryTimeout is how long a single data storer call may take, in nanoseconds. 0 disables the timeout.
+	QueryTimeout() uint64
+	SetQueryTimeout(uint64)
+
+	// QuarantineExpiry is how long a job stays quarantined before its file is evaluated again by the next scan, in
+	// nanoseconds. 0 keeps jobs quarantined until they are cleared.
+	QuarantineExpiry() uint64
+	SetQuarantineExpiry(uint64)
+
+	// Secret returns the decrypted value of a sensitive setting, or an empty string if it isn't set.
+	Secret(SecretSetting) string
+
+	// SetSecret sets a sensitive setting, which is encrypted when the settings are saved. An empty value clears it.
+	SetSecret(SecretSetting, string)
 }
 
 // HealthCheckerDataStorer defines how a HealthChecker stores data.
+// The methods of it and the other data storer interfaces return early with the context's error once ctx is done.
 type HealthCheckerDataStorer interface {
-	DispatchedJobs() []DispatchedJob
-	DeleteJob(uuid UUID) error
+	DispatchedJobs(ctx context.Context) []DispatchedJob
+
+	// RevokeLease deletes the dispatched job with the provided UUID if its lease expired at or before now,
+	// and returns whether it was deleted. A job whose lease was renewed in the meantime is left alone.
+	RevokeLease(ctx context.Context, uuid UUID, now time.Time) (bool, error)
+
+	// Runners returns every Runner which has contacted the Controller.
+	Runners(ctx context.Context) ([]Runner, error)
+
+	// StaleJobSettings returns the stale job settings of every library, keyed by library ID.
+	StaleJobSettings(ctx context.Context) (map[int]StaleJobSettings, error)
+
+	// SaveHealthCheckAction records an action of the health checker.
+	SaveHealthCheckAction(ctx context.Context, a HealthCheckAction) error
 }
 
 // LibraryManagerDataStorer defines how a LibraryManager stores data.
 type LibraryManagerDataStorer interface {
-	Libraries() ([]Library, error)
-	Library(id int) (Library, error)
-	SaveLibrary(Library) error
-
-	IsPathDispatched(path string) (bool, error)
-	PopDispatchedJob(uuid UUID) (DispatchedJob, error)
-
-	PushHistory(History) error
+	Libraries(ctx context.Context) ([]Library, error)
+	Library(ctx context.Context, id int) (Library, error)
+	SaveLibrary(ctx context.Context, lib Library) error
+
+	// AppendJobs adds the jobs whose paths aren't already queued to the end of the library's queue in a single write
+	// and returns the ones which were added. Unlike SaveLibrary, it doesn't conflict with other changes to the library.
+	AppendJobs(ctx context.Context, libraryID int, jobs []Job) (appended []Job, err error)
+
+	IsPathDispatched(ctx context.Context, path string) (bool, error)
+	IsJobDispatched(ctx context.Context, uuid UUID) (bool, error)
+	PopDispatchedJob(ctx context.Context, uuid UUID) (DispatchedJob, error)
+
+	// DispatchedJobCount returns the number of dispatched jobs that belong to the provided library.
+	DispatchedJobCount(ctx context.Context, libraryID int) (int, error)
+
+	// DispatchedJobs returns all of the dispatched jobs.
+	DispatchedJobs(ctx context.Context) ([]DispatchedJob, error)
+
+	// RevokeLease deletes the dispatched job with the provided UUID if its lease expired at or before now,
+	// and returns whether it was deleted. A job whose lease was renewed in the meantime is left alone.
+	RevokeLease(ctx context.Context, uuid UUID, now time.Time) (bool, error)
+
+	// HoldGroupPart saves a completed part of a multi-part set, replacing the held part with the same UUID.
+	// The held parts are kept until ReleaseGroupParts is called for their set, so that they survive restarts.
+	HoldGroupPart(ctx context.Context, p HeldGroupPart) error
+	// HeldGroupParts returns the held parts of every multi-part set in the order that they were first held.
+	HeldGroupParts(ctx context.Context) ([]HeldGroupPart, error)
+	// ReleaseGroupParts deletes the held parts of the multi-part set with the provided group key.
+	ReleaseGroupParts(ctx context.Context, group string) error
+
+	PushHistory(ctx context.Context, h History) error
+
+	// SaveBenchmarkResult records the outcome of a benchmark job.
+	SaveBenchmarkResult(ctx context.Context, r BenchmarkResult) error
+
+	// IncrementJobAttempts increments the failed attempt counter of the job for the provided path and returns the new count.
+	// ResetJobAttempts clears it.
+	IncrementJobAttempts(ctx context.Context, path string) (attempts int, err error)
+	ResetJobAttempts(ctx context.Context, path string) error
+
+	QuarantineJob(ctx context.Context, q QuarantinedJob) error
+	IsPathQuarantined(ctx context.Context, path string) (bool, error)
+
+	// ReleaseExpiredQuarantines takes the jobs which were quarantined before quarantinedBefore out of quarantine,
+	// resets their attempt counters, and returns their paths.
+	ReleaseExpiredQuarantines(ctx context.Context, quarantinedBefore time.Time) (released []string, err error)
+
+	// IsPathSkipped returns whether or not the provided path was recorded as completed outside of Encodarr.
+	IsPathSkipped(ctx context.Context, path string) (bool, error)
+
+	// LastProcessedModtime returns the modtime that the file at the provided path had when a job for it was last
+	// completed, or sql.ErrNoRows if a job for it has never been completed.
+	LastProcessedModtime(ctx context.Context, path string) (time.Time, error)
+	SaveLastProcessedModtime(ctx context.Context, path string, t time.Time) error
+	// DeleteProcessedModtimes forgets the modtimes of every path starting with pathPrefix and returns how many
+	// paths were forgotten.
+	DeleteProcessedModtimes(ctx context.Context, pathPrefix string) (deleted int, err error)
+
+	// CanonicalizePaths rewrites the stored processed modtimes, job attempts, quarantined jobs, and skipped paths with
+	// the paths returned by canonicalize and returns how many paths were changed. Entries which end up with the same
+	// path are merged.
+	CanonicalizePaths(ctx context.Context, canonicalize func(path string) string) (changed int, err error)
+
+	// FileSnapshotModtimes returns the modtimes of the file snapshots of the provided library, keyed by path.
+	FileSnapshotModtimes(ctx context.Context, libraryID int) (map[string]time.Time, error)
+	// SaveFileSnapshot creates or replaces the snapshot of the file at s.Path.
+	SaveFileSnapshot(ctx context.Context, s FileSnapshot) error
+	// DeleteFileSnapshots deletes the snapshots of the provided paths and returns how many were deleted.
+	DeleteFileSnapshots(ctx context.Context, paths []string) (deleted int, err error)
+
+	// DeleteLibrary marks the library as deleted at the provided time. Deleted libraries aren't returned by
+	// Libraries or Library until they are restored or purged.
+	DeleteLibrary(ctx context.Context, id int, t time.Time) error
+	// RestoreLibrary undoes the deletion of a library. sql.ErrNoRows is returned if there isn't a deleted library with the ID.
+	RestoreLibrary(ctx context.Context, id int) error
+
+	// PurgeDeletedLibraries permanently removes the libraries which were deleted before deletedBefore, along with
+	// their quarantined jobs and file snapshots, and returns them. The history entries of their jobs are kept and record the library's folder.
+	PurgeDeletedLibraries(ctx context.Context, deletedBefore time.Time) (purged []Library, err error)
+	// PurgeDeletedLibrary permanently removes a single deleted library like PurgeDeletedLibraries, no matter when it was
+	// deleted. sql.ErrNoRows is returned if there isn't a deleted library with the ID.
+	PurgeDeletedLibrary(ctx context.Context, id int) (Library, error)
 }
 
 // RunnerCommunicatorDataStorer defines how a RunnerCommunicator stores data.
 type RunnerCommunicatorDataStorer interface {
-	DispatchedJob(uuid UUID) (DispatchedJob, error)
-	SaveDispatchedJob(DispatchedJob) error
+	// DispatchedJob returns the dispatched job with the provided UUID or sql.ErrNoRows if there isn't one.
+	DispatchedJob(ctx context.Context, uuid UUID) (DispatchedJob, error)
+
+	// SaveDispatchedJob creates or replaces the dispatched job with the UUID of the provided one. ErrPathDispatched is
+	// returned instead if a job with another UUID is already dispatched for the same path, so that a file is never
+	// transcoded by two Runners at once.
+	SaveDispatchedJob(ctx context.Context, dJob DispatchedJob) error
+
+	// UpdateDispatchedJob replaces the stored dispatched job with the UUID of the provided one. Unlike SaveDispatchedJob,
+	// it returns sql.ErrNoRows instead of creating the job if it doesn't exist, so that a job whose lease was revoked
+	// isn't brought back by a late status update.
+	UpdateDispatchedJob(ctx context.Context, dJob DispatchedJob) error
+
+	// RunnerSeen records that the named Runner has contacted the Controller, creating a record for it if one doesn't exist.
+	// An empty version leaves the stored version unchanged.
+	RunnerSeen(ctx context.Context, name, version string, t time.Time) error
+
+	// RecordRunnerResult increments the completed or failed job counter of the named Runner.
+	RecordRunnerResult(ctx context.Context, name string, failed bool) error
 }
 
 // FileCacheDataStorer defines how the FileCache stores data.
 type FileCacheDataStorer interface {
-	Modtime(path string) (time.Time, error)
-	Metadata(path string) (FileMetadata, error)
+	Modtime(ctx context.Context, path string) (time.Time, error)
+	Metadata(ctx context.Context, path string) (FileMetadata, error)
 
-	SaveModtime(path string, t time.Time) error
-	SaveMetadata(path string, f FileMetadata) error
+	SaveModtime(ctx context.Context, path string, t time.Time) error
+	SaveMetadata(ctx context.Context, path string, f FileMetadata) error
+}
+
+// JobEventDataStorer defines how the log records about jobs are stored for their timelines.
+type JobEventDataStorer interface {
+	// SaveJobEvents records the provided events in a single write.
+	SaveJobEvents(ctx context.Context, events []JobEvent) error
+
+	// DeleteJobEventsBefore deletes the events recorded before the provided time.
+	DeleteJobEventsBefore(ctx context.Context, t time.Time) (deleted int, err error)
 }
 
 // UserInterfacerDataStorer defines how a UserInterfacer stores data.
 type UserInterfacerDataStorer interface {
-	DispatchedJobs() ([]DispatchedJob, error)
+	DispatchedJobs(ctx context.Context) ([]DispatchedJob, error)
+
+	HistoryEntries(ctx context.Context) ([]History, error)
 
-	HistoryEntries() ([]History, error)
+	// HistoryEntry returns the history entry of the job with the provided UUID or sql.ErrNoRows if there isn't one.
+	HistoryEntry(ctx context.Context, uuid UUID) (History, error)
+
+	// HistoryEntryByOriginalPath returns the newest history entry whose original file was kept at the provided path
+	// or sql.ErrNoRows if there isn't one.
+	HistoryEntryByOriginalPath(ctx context.Context, path string) (History, error)
+
+	// MarkOriginalRestored records that the original file of the job with the provided UUID was moved back into place.
+	// sql.ErrNoRows is returned if there isn't a history entry for the job.
+	MarkOriginalRestored(ctx context.Context, uuid UUID) error
+
+	// DeleteLibrary marks the library as deleted at the provided time. Deleted libraries aren't returned by
+	// Libraries or Library until they are restored or purged.
+	DeleteLibrary(ctx context.Context, id int, t time.Time) error
+
+	// DeletedLibraries returns the libraries which are deleted but haven't been purged yet.
+	DeletedLibraries(ctx context.Context) ([]Library, error)
+
+	// RestoreLibrary undoes the deletion of a library. sql.ErrNoRows is returned if there isn't a deleted library with the ID.
+	RestoreLibrary(ctx context.Context, id int) error
+
+	// ClearQuarantine removes the provided path from quarantine and resets its attempt counter.
+	// sql.ErrNoRows is returned if the path isn't quarantined.
+	ClearQuarantine(ctx context.Context, path string) error
+
+	// SkipPaths records the provided paths as completed outside of Encodarr in a single transaction. Paths which are
+	// already skipped keep the time that they were first skipped.
+	SkipPaths(ctx context.Context, skipped []SkippedPath) error
+	// SkippedPaths returns the skipped paths, sorted by path.
+	SkippedPaths(ctx context.Context) ([]SkippedPath, error)
+	// UnskipPath removes the provided path from the skipped paths. sql.ErrNoRows is returned if the path isn't skipped.
+	UnskipPath(ctx context.Context, path string) error
+
+	// BenchmarkResults returns the results of the benchmarks of the provided path, or of every path if it is empty,
+	// newest first.
+	BenchmarkResults(ctx context.Context, path string) ([]BenchmarkResult, error)
+
+	// ImportLibraries saves the settings of the provided libraries in a single transaction.
+	// The queues of libraries which already exist are left untouched, and deleted libraries are restored.
+	ImportLibraries(ctx context.Context, libs []Library) error
+
+	// ImportFileStates saves the provided processed modtimes, keyed by path, and quarantines the provided jobs in a single
+	// transaction. Existing entries for the same paths are replaced.
+	ImportFileStates(ctx context.Context, processed map[string]time.Time, quarantined []QuarantinedJob) error
+
+	// HealthCheckActions returns up to limit of the most recent health checker actions, newest first.
+	HealthCheckActions(ctx context.Context, limit int) ([]HealthCheckAction, error)
+
+	// HealthCheckActionCounts returns how many times the health checker has taken each action.
+	HealthCheckActionCounts(ctx context.Context) (map[StaleJobAction]int, error)
+
+	// JobEvents returns the events recorded for the job with the provided UUID, oldest first.
+	JobEvents(ctx context.Context, uuid UUID) ([]JobEvent, error)
+
+	Runners(ctx context.Context) ([]Runner, error)
+	RenameRunner(ctx context.Context, uuid UUID, displayName string) error
+	DeleteRunner(ctx context.Context, uuid UUID) error
+
+	// DeleteStaleRunners deletes the records of all Runners that haven't been seen since the provided time.
+	DeleteStaleRunners(ctx context.Context, notSeenSince time.Time) (deleted int, err error)
+
+	// SearchFiles returns up to limit files across all library queues, dispatched jobs, and history
+	// whose path matches pattern, ignoring case. more indicates that there were additional matches past limit.
+	SearchFiles(ctx context.Context, pattern string, limit int) (results []SearchResult, more bool, err error)
+
+	// QueryFileSnapshots returns the number of file snapshots of libraries which aren't deleted that match filter,
+	// along with the paths of up to limit of them in path order.
+	QueryFileSnapshots(ctx context.Context, filter FileSnapshotFilter, limit int) (paths []string, count int, err error)
+
+	DatabaseBackuper
+}
 
-	DeleteLibrary(id int) error
+// The DatabaseBackuper interface describes a data storer which can take snapshots of its database while it is in use.
+type DatabaseBackuper interface {
+	// Backup writes a consistent snapshot of the database to w. The snapshot is verified before any of it is written to w.
+	// ErrBackupNotSupported is returned if the database can't be backed up.
+	Backup(w io.Writer) error
 }
 
-// The Logger interface defines how a logger should behave.
+// The Logger interface defines how a logger should behave. A LogFields may be passed after the arguments of the
+// format string, in which case it isn't part of the message but is recorded alongside it.
 type Logger interface {
 	Trace(s string, i ...interface{})
 	Debug(s string, i ...interface{})
@@ -153,7 +501,7 @@ type Logger interface {
 // HTTPServer defines how an HTTPServer should behave.
 type HTTPServer interface {
 	// Start starts the HTTPServer. If Start is called again, it is a no-op.
-	Start(*context.Context, *sync.WaitGroup)
+	Start(context.Context, *sync.WaitGroup)
 
 	Handle(pattern string, handler http.Handler)
 	HandleFunc(pattern string, handlerFunc func(http.ResponseWriter, *http.Request))
@@ -2,16 +2,30 @@ package jobhealth
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/BrenekH/encodarr/controller"
 )
 
-// NewChecker returns a new Checker.
-func NewChecker(ds controller.HealthCheckerDataStorer, ss controller.SettingsStorer, logger controller.Logger) Checker {
+// runnerCheckInterval is how often the Runners are checked for having gone offline.
+const runnerCheckInterval = 5 * time.Second
+
+// NewChecker returns a new Checker. Runners which haven't been seen for offlineThreshold are marked as offline.
+// An offlineThreshold of 0 disables the offline check. After Start, every check is held off for restartGracePeriod so that
+// the Runners which kept working while the Controller was down can reconnect and renew their leases. The jobs which no
+// Runner renewed the lease on by the end of it are requeued.
+func NewChecker(ds controller.HealthCheckerDataStorer, ss controller.SettingsStorer, notifier controller.Notifier, logger controller.Logger, offlineThreshold, restartGracePeriod time.Duration) Checker {
 	return Checker{
-		ds: ds,
-		ss: ss,
+		ds:       ds,
+		ss:       ss,
+		notifier: notifier,
+		ctx:      context.Background(),
+
+		offlineThreshold:   offlineThreshold,
+		restartGracePeriod: restartGracePeriod,
+		notified:           make(map[controller.UUID]time.Time),
+		online:             make(map[string]bool),
 
 		lastCheckTime: time.Unix(0, 0),
 		nowSincer:     timeNowSince{},
@@ -22,8 +36,42 @@ func NewChecker(ds controller.HealthCheckerDataStorer, ss controller.SettingsSto
 
 // Checker implements the controller.HealthChecker interface.
 type Checker struct {
-	ds controller.HealthCheckerDataStorer
-	ss controller.SettingsStorer
+	ds       controller.HealthCheckerDataStorer
+	ss       controller.SettingsStorer
+	notifier controller.Notifier
+
+	// ctx is passed to the data storer. It is replaced by the one given to Start.
+	ctx context.Context
+
+	offlineThreshold   time.Duration
+	restartGracePeriod time.Duration
+
+	// startedAt is when Start was called. Jobs which were dispatched before leases were introduced can't have been
+	// updated while the Controller was down, so the time before it doesn't count towards their stale job timeout.
+	startedAt time.Time
+
+	// reconciled is set once the jobs which weren't claimed during the restart grace period have been requeued.
+	reconciled bool
+
+	// notified holds the lease expiry of each job that the user was notified about, so that jobs which are left
+	// with their Runners are only notified about once until their lease is renewed.
+	notified map[controller.UUID]time.Time
+
+	// online holds whether each Runner was online when they were last checked, keyed by name.
+	online          map[string]bool
+	lastRunnerCheck time.Time
+
+	// noRunnersAlert is how long no Runner may be seen while jobs are queued before the user is alerted. 0 disables it.
+	// noRunnersSince is when a Runner was last seen while the alert is raised, and zero otherwise.
+	noRunnersAlert        time.Duration
+	noRunnersSince        time.Time
+	lastAvailabilityCheck time.Time
+
+	// actionCounters count the actions taken with stale jobs, keyed by action. leasesExpired counts all of them.
+	// They are registered with metrics, which is nil if there isn't a metrics collector.
+	metrics        controller.MetricsCollector
+	actionCounters map[controller.StaleJobAction]controller.Counter
+	leasesExpired  controller.Counter
 
 	lastCheckTime time.Time
 	nowSincer     nowSincer
@@ -31,39 +79,387 @@ type Checker struct {
 	logger controller.Logger
 }
 
-// Run loops through the provided slice of dispatched jobs and checks if any have
-// surpassed the allowed time between updates, if the Health Check timing interval has expired.
-func (c *Checker) Run() (uuidsToNull []controller.UUID) {
+// Run loops through the dispatched jobs and, if the Health Check timing interval has expired, takes away the ones
+// whose lease has expired. The jobs of Runners which kept contacting the Controller without renewing their lease are
+// requeued even if their library only notifies about stale jobs. The jobs of a Runner which goes offline are requeued
+// right away, without waiting for their leases to expire. Nothing is checked until the restart grace period has passed,
+// and then the jobs which no Runner claimed during it are requeued.
+func (c *Checker) Run() (staleJobs []controller.StaleJob) {
+	now := c.nowSincer.Now()
+	if now.Sub(c.startedAt) < c.restartGracePeriod {
+		return
+	}
+
+	if c.restartGracePeriod > 0 && !c.reconciled {
+		c.reconciled = true
+		staleJobs = append(staleJobs, c.requeueUnclaimed()...)
+	}
+
+	for _, runner := range c.checkRunners() {
+		staleJobs = append(staleJobs, c.requeueOfflineJobs(runner, now)...)
+	}
+
 	if c.nowSincer.Since(c.lastCheckTime) >= time.Duration(c.ss.HealthCheckInterval()) {
-		c.lastCheckTime = c.nowSincer.Now()
+		c.lastCheckTime = now
 
-		djs := c.ds.DispatchedJobs()
+		djs := c.ds.DispatchedJobs(c.ctx)
+		lastSeen := c.runnersLastSeen()
+		libSettings := c.libraryStaleJobSettings()
+		dispatched := make(map[controller.UUID]struct{}, len(djs))
 
 		for _, v := range djs {
-			if c.nowSincer.Since(v.LastUpdated) >= time.Duration(c.ss.HealthCheckTimeout()) {
-				// Since DeleteJob may be blocked by an IO error of some sort attempt to delete
-				//   the job up to a hundred times (SQLiteDB.SetMaxOpenConns should've fixed this issue but just in case).
-				jobDeleted := false
-				for i := 0; i < 100; i++ {
-					if err := c.ds.DeleteJob(v.UUID); err == nil {
-						jobDeleted = true
-						break
-					} else {
-						c.logger.Warn("%v", err)
-					}
-					time.Sleep(time.Microsecond * 2)
-				}
-
-				if jobDeleted {
-					uuidsToNull = append(uuidsToNull, v.UUID)
-					c.logger.Warn("Nullified job for %v because the %v runner was unresponsive", v.Job.Path, v.Runner)
-				}
+			dispatched[v.UUID] = struct{}{}
+			timeout, action := c.staleJobSettings(libSettings[v.Job.LibraryID])
+			if v.Job.Benchmark != nil && action == controller.StaleJobNotify {
+				// Nothing is waiting on a benchmark, so it is taken away instead of being left with its Runner.
+				action = controller.StaleJobFail
+			}
+
+			expires := c.leaseExpiry(v, timeout)
+			if now.Before(expires) {
+				continue
+			}
+			sinceExpired := now.Sub(expires)
+
+			var reason string
+			if online, watched := c.online[v.Runner]; watched && !online {
+				reason = fmt.Sprintf("the %v runner is offline and its lease expired %v ago", v.Runner, sinceExpired.Round(time.Second))
+				action = controller.StaleJobRequeue
+			} else if seen, ok := lastSeen[v.Runner]; ok && seen.After(expires) {
+				// Runners renew the leases on the jobs they are working on with every status update and heartbeat,
+				// so a Runner which has kept contacting the Controller without renewing its lease (ex. it restarted)
+				// will never complete the job. That's also why orphaned jobs are requeued instead of only being notified about.
+				reason = fmt.Sprintf("it was orphaned by the %v runner, which was seen %v after its lease expired", v.Runner, seen.Sub(expires).Round(time.Second))
+				action = controller.StaleJobRequeue
+			} else if action == controller.StaleJobNotify {
+				c.notifyStale(v, expires, sinceExpired)
+				continue
+			} else {
+				reason = fmt.Sprintf("the lease of the %v runner expired %v ago", v.Runner, sinceExpired.Round(time.Second))
+			}
+
+			if c.revokeLease(v.UUID, now) {
+				staleJobs = append(staleJobs, controller.StaleJob{DispatchedJob: v, Action: action, Reason: reason})
+				c.recordAction(v, action, reason)
 			}
 		}
+
+		for uuid := range c.notified {
+			if _, ok := dispatched[uuid]; !ok {
+				delete(c.notified, uuid)
+			}
+		}
+	}
+	return
+}
+
+// LeaseDuration returns how long the leases on the jobs of the provided library last by default,
+// which is the library's stale job timeout.
+func (c *Checker) LeaseDuration(libraryID int) time.Duration {
+	timeout, _ := c.staleJobSettings(c.libraryStaleJobSettings()[libraryID])
+	return timeout
+}
+
+// leaseExpiry returns when the lease on dJob expires. Jobs which were dispatched before leases were introduced
+// don't have one, so they are treated as having a lease of the stale job timeout which was last renewed when
+// they were updated.
+func (c *Checker) leaseExpiry(dJob controller.DispatchedJob, timeout time.Duration) time.Time {
+	if !dJob.LeaseExpires.IsZero() {
+		return dJob.LeaseExpires
+	}
+	return latest(dJob.LastUpdated, c.startedAt).Add(timeout)
+}
+
+// checkRunners marks the Runners which haven't been seen for offlineThreshold as offline, notifies the user
+// about them, and returns the names of the ones which went offline since the last check.
+func (c *Checker) checkRunners() (wentOffline []string) {
+	now := c.nowSincer.Now()
+	if c.offlineThreshold <= 0 || now.Sub(c.lastRunnerCheck) < runnerCheckInterval {
+		return
+	}
+	c.lastRunnerCheck = now
+
+	runners, err := c.ds.Runners(c.ctx)
+	if err != nil {
+		c.logger.Error("%v", err)
+		return
+	}
+
+	known := make(map[string]bool, len(runners))
+	for _, r := range runners {
+		known[r.Name] = true
+		sinceSeen := now.Sub(r.LastSeen)
+		online := sinceSeen < c.offlineThreshold
+
+		// Runners are only reported when they go offline while being watched, so that the ones which were already
+		// offline when the Controller started aren't reported on every start.
+		wasOnline, watched := c.online[r.Name]
+		c.online[r.Name] = online
+		if !watched {
+			continue
+		}
+
+		if wasOnline && !online {
+			message := fmt.Sprintf("The %v runner went offline after not being seen for %v", r.Name, sinceSeen.Round(time.Second))
+			c.logger.Warn("%v", message)
+			c.notifier.Notify(controller.Event{
+				Type:    controller.EventRunnerOffline,
+				Message: message,
+				Time:    now,
+				Runner:  r.Name,
+			})
+			wentOffline = append(wentOffline, r.Name)
+		} else if !wasOnline && online {
+			c.logger.Info("The %v runner is back online", r.Name)
+		}
+	}
+
+	for name := range c.online {
+		if !known[name] {
+			delete(c.online, name)
+		}
+	}
+	return
+}
+
+// requeueOfflineJobs takes the jobs of a Runner which went offline away from it without waiting for their leases to
+// expire, since an offline Runner doesn't renew them. A lease which was renewed since the jobs were read is left alone,
+// and if the Runner only lost its connection, its next renewal is rejected and it discards its work.
+func (c *Checker) requeueOfflineJobs(runner string, now time.Time) (staleJobs []controller.StaleJob) {
+	for _, v := range c.ds.DispatchedJobs(c.ctx) {
+		if v.Runner != runner {
+			continue
+		}
+
+		reason := fmt.Sprintf("the %v runner went offline", runner)
+		if c.revokeLease(v.UUID, revokeAsOf(v, now)) {
+			staleJobs = append(staleJobs, controller.StaleJob{DispatchedJob: v, Action: controller.StaleJobRequeue, Reason: reason})
+			c.recordAction(v, controller.StaleJobRequeue, reason)
+		}
+	}
+	return
+}
+
+// requeueUnclaimed takes away the jobs whose lease wasn't renewed since the Controller started, which means that no
+// Runner claimed them through a heartbeat or status update during the restart grace period. Jobs which were dispatched
+// before leases were introduced can't be claimed through heartbeats, so they are left to their stale job timeout.
+func (c *Checker) requeueUnclaimed() (staleJobs []controller.StaleJob) {
+	for _, v := range c.ds.DispatchedJobs(c.ctx) {
+		if v.LeaseExpires.IsZero() || !v.LeaseExpires.Add(-v.LeaseDuration).Before(c.startedAt) {
+			continue
+		}
+
+		reason := fmt.Sprintf("no runner claimed it within the %v restart grace period", c.restartGracePeriod)
+		if c.revokeLease(v.UUID, v.LeaseExpires) {
+			staleJobs = append(staleJobs, controller.StaleJob{DispatchedJob: v, Action: controller.StaleJobRequeue, Reason: reason})
+			c.recordAction(v, controller.StaleJobRequeue, reason)
+		}
 	}
 	return
 }
 
-// Start just satisfies the controller.HealthChecker interface.
-// There is no implemented functionality.
-func (c *Checker) Start(ctx *context.Context) {}
+// revokeAsOf returns the time to revoke the lease on dJob as of so that it is revoked before it expires, unless it was
+// renewed since dJob was read. Jobs which were dispatched before leases were introduced don't have a lease to renew.
+func revokeAsOf(dJob controller.DispatchedJob, now time.Time) time.Time {
+	if dJob.LeaseExpires.IsZero() {
+		return now
+	}
+	return dJob.LeaseExpires
+}
+
+// SetNoRunnersAlert sets how long no Runner may be seen while jobs are queued before the user is alerted.
+// 0 disables the alert.
+func (c *Checker) SetNoRunnersAlert(d time.Duration) {
+	c.noRunnersAlert = d
+}
+
+// CheckRunnersAvailable raises the no runners alert if no Runner has been seen for the no runners alert period while
+// jobsQueued is true, and returns when a Runner was last seen while it is raised, or the zero time otherwise.
+// The alert is cleared as soon as a Runner is seen again.
+func (c *Checker) CheckRunnersAvailable(jobsQueued bool) (noRunnersSince time.Time) {
+	now := c.nowSincer.Now()
+	if c.noRunnersAlert <= 0 || now.Sub(c.lastAvailabilityCheck) < runnerCheckInterval {
+		return c.noRunnersSince
+	}
+	c.lastAvailabilityCheck = now
+
+	runners, err := c.ds.Runners(c.ctx)
+	if err != nil {
+		c.logger.Error("%v", err)
+		return c.noRunnersSince
+	}
+
+	// Runners can't have been seen while the Controller was down, so the time before it started doesn't count
+	lastSeen := c.startedAt
+	for _, r := range runners {
+		lastSeen = latest(lastSeen, r.LastSeen)
+	}
+
+	if now.Sub(lastSeen) < c.noRunnersAlert {
+		if !c.noRunnersSince.IsZero() {
+			c.logger.Info("A runner is available again")
+			c.noRunnersSince = time.Time{}
+		}
+		return
+	}
+
+	if !jobsQueued || !c.noRunnersSince.IsZero() {
+		return c.noRunnersSince
+	}
+	c.noRunnersSince = lastSeen
+
+	message := fmt.Sprintf("No runners are available. None have been seen for %v, but jobs are waiting in the queue", now.Sub(lastSeen).Round(time.Second))
+	c.logger.Warn("%v", message)
+	c.notifier.Notify(controller.Event{
+		Type:    controller.EventNoRunners,
+		Message: message,
+		Time:    now,
+	})
+	return c.noRunnersSince
+}
+
+// staleJobSettings returns the stale job timeout and action of a library with the provided settings,
+// falling back to the global settings for the ones it doesn't override.
+func (c *Checker) staleJobSettings(s controller.StaleJobSettings) (time.Duration, controller.StaleJobAction) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = time.Duration(c.ss.HealthCheckTimeout())
+	}
+
+	action := s.Action
+	if action == "" {
+		action = controller.StaleJobAction(c.ss.StaleJobAction())
+	}
+	if action == "" || !action.Valid() {
+		action = controller.StaleJobRequeue
+	}
+
+	return timeout, action
+}
+
+// notifyStale notifies the user about a job whose lease expired at expires, which is being left with its Runner,
+// unless they were already notified since the lease was last renewed.
+func (c *Checker) notifyStale(dJob controller.DispatchedJob, expires time.Time, sinceExpired time.Duration) {
+	if t, ok := c.notified[dJob.UUID]; ok && t.Equal(expires) {
+		return
+	}
+	c.notified[dJob.UUID] = expires
+
+	message := fmt.Sprintf("The %v runner hasn't renewed its lease on the job for %v, which expired %v ago", dJob.Runner, dJob.Job.Path, sinceExpired.Round(time.Second))
+	c.recordAction(dJob, controller.StaleJobNotify, fmt.Sprintf("the lease of the %v runner expired %v ago and the job was left with it", dJob.Runner, sinceExpired.Round(time.Second)))
+	c.notifier.Notify(controller.Event{
+		Type:        controller.EventJobStale,
+		LibraryID:   dJob.Job.LibraryID,
+		Message:     message,
+		Time:        c.nowSincer.Now(),
+		Annotations: dJob.Job.Annotations,
+		JobUUID:     dJob.UUID,
+		Path:        dJob.Job.Path,
+		Runner:      dJob.Runner,
+	})
+}
+
+// SetMetricsCollector registers the counters of the actions taken with stale jobs with mc.
+func (c *Checker) SetMetricsCollector(mc controller.MetricsCollector) {
+	c.metrics = mc
+	c.actionCounters = map[controller.StaleJobAction]controller.Counter{
+		controller.StaleJobRequeue: mc.Counter("encodarr_stale_jobs_requeued_total", "Total dispatched jobs taken away from their Runners and requeued by the health checker."),
+		controller.StaleJobFail:    mc.Counter("encodarr_stale_jobs_failed_total", "Total dispatched jobs taken away from their Runners and failed by the health checker."),
+	}
+	c.leasesExpired = mc.Counter("encodarr_leases_expired_total", "Total expired leases acted upon by the health checker, including the ones which were only notified about.")
+}
+
+// recordAction logs, counts, and saves an action taken with a stale job, so that the jobs which were requeued or failed
+// by the health checker can be told apart from other problems.
+func (c *Checker) recordAction(dJob controller.DispatchedJob, action controller.StaleJobAction, reason string) {
+	fields := dJob.Job.LogFields()
+	fields["runner"] = dJob.Runner
+	c.logger.Warn("Health check action=%v job=%v runner=%q path=%q reason=%q", action, dJob.UUID, dJob.Runner, dJob.Job.Path, reason, fields)
+
+	if c.metrics != nil {
+		c.metrics.Batch(func() {
+			if counter, ok := c.actionCounters[action]; ok {
+				counter.Add(1)
+			}
+			c.leasesExpired.Add(1)
+		})
+	}
+
+	err := c.ds.SaveHealthCheckAction(c.ctx, controller.HealthCheckAction{
+		Time:      c.nowSincer.Now(),
+		JobUUID:   dJob.UUID,
+		Runner:    dJob.Runner,
+		Path:      dJob.Job.Path,
+		LibraryID: dJob.Job.LibraryID,
+		Action:    action,
+		Reason:    reason,
+	})
+	if err != nil {
+		c.logger.Error("%v", err, fields)
+	}
+}
+
+// revokeLease deletes the dispatched job if its lease is still expired as of now and returns whether or not it was deleted.
+// A job whose Runner renewed its lease since it was read is left alone.
+func (c *Checker) revokeLease(uuid controller.UUID, now time.Time) bool {
+	// Since RevokeLease may be blocked by an IO error of some sort attempt to revoke
+	//   the lease up to a hundred times (SQLiteDB.SetMaxOpenConns should've fixed this issue but just in case).
+	for i := 0; i < 100; i++ {
+		revoked, err := c.ds.RevokeLease(c.ctx, uuid, now)
+		if err == nil {
+			return revoked
+		}
+		c.logger.Warn("%v", err, controller.LogFields{"job_uuid": uuid})
+		if c.ctx.Err() != nil {
+			return false
+		}
+		time.Sleep(time.Microsecond * 2)
+	}
+	return false
+}
+
+// runnersLastSeen returns when each Runner was last seen, keyed by name.
+// Any error is logged and treated as no Runners having been seen, which only disables the orphan check.
+func (c *Checker) runnersLastSeen() map[string]time.Time {
+	lastSeen := make(map[string]time.Time)
+
+	runners, err := c.ds.Runners(c.ctx)
+	if err != nil {
+		c.logger.Error("%v", err)
+		return lastSeen
+	}
+
+	for _, r := range runners {
+		lastSeen[r.Name] = r.LastSeen
+	}
+	return lastSeen
+}
+
+// libraryStaleJobSettings returns the stale job settings of each library, keyed by ID.
+// Any error is logged and treated as no library overriding the global settings.
+func (c *Checker) libraryStaleJobSettings() map[int]controller.StaleJobSettings {
+	settings, err := c.ds.StaleJobSettings(c.ctx)
+	if err != nil {
+		c.logger.Error("%v", err)
+		return make(map[int]controller.StaleJobSettings)
+	}
+	return settings
+}
+
+// Start stores ctx so that the data storer calls made by Run are cancelled when it is done, and starts the restart
+// grace period.
+func (c *Checker) Start(ctx context.Context) {
+	c.ctx = ctx
+	c.startedAt = c.nowSincer.Now()
+	if c.restartGracePeriod > 0 {
+		c.logger.Info("Waiting %v for the Runners to renew the leases on their dispatched jobs before checking them", c.restartGracePeriod)
+	}
+}
+
+// latest returns the later of a and b.
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -1,6 +1,8 @@
 package jobhealth
 
 import (
+	"context"
+	"reflect"
 	"testing"
 	"time"
 
@@ -11,7 +13,7 @@ import (
 func TestTimeSinceAndSSHealthCheckIntervalCalled(t *testing.T) {
 	ds := mockDataStorer{}
 	ss := mockSettingsStorer{}
-	c := NewChecker(&ds, &ss, &mockLogger{})
+	c := NewChecker(&ds, &ss, &mockNotifier{}, &mockLogger{}, 0, 0)
 
 	mNS := mockNowSincer{}
 	c.nowSincer = &mNS
@@ -60,7 +62,7 @@ func TestHealthCheckRunsUnderCorrectConditions(t *testing.T) {
 			ss := mockSettingsStorer{
 				healthCheckInt: test.healthCheckInt,
 			}
-			c := NewChecker(&ds, &ss, &mockLogger{})
+			c := NewChecker(&ds, &ss, &mockNotifier{}, &mockLogger{}, 0, 0)
 
 			mNS := mockNowSincer{
 				sinceResp: test.sinceResp,
@@ -76,107 +78,103 @@ func TestHealthCheckRunsUnderCorrectConditions(t *testing.T) {
 	}
 }
 
-// Various scenarios around dispatched jobs LastUpdated field being higher or lower than HealthCheckTimeout
+// Various scenarios around the lease of a dispatched job expiring
 func TestCorrectNullingBehavior(t *testing.T) {
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
 	tests := []struct {
 		name                    string
-		healthCheckTimeout      uint64
-		jobLastUpdatedDur       time.Duration // Sets what time.Since returns as the duration on the second call
+		dJob                    controller.DispatchedJob
 		expectUUIDToBeNullified bool
 	}{
 		{
-			name:                    "DJob.LastUpdated is smaller than the timeout",
-			healthCheckTimeout:      uint64(time.Second * 32),
-			jobLastUpdatedDur:       time.Second * 16,
+			name:                    "Lease expires after now",
+			dJob:                    controller.DispatchedJob{LastUpdated: now.Add(-time.Hour), LeaseExpires: now.Add(time.Second)},
 			expectUUIDToBeNullified: false,
 		},
 		{
-			name:                    "DJob.LastUpdated is equal to the timeout",
-			healthCheckTimeout:      uint64(time.Second * 32),
-			jobLastUpdatedDur:       time.Second * 32,
+			name:                    "Lease expires now",
+			dJob:                    controller.DispatchedJob{LastUpdated: now.Add(-time.Hour), LeaseExpires: now},
 			expectUUIDToBeNullified: true,
 		},
 		{
-			name:                    "DJob.LastUpdated is larger than the timeout",
-			healthCheckTimeout:      uint64(time.Second * 32),
-			jobLastUpdatedDur:       time.Second * 48,
+			name:                    "Lease expired before now",
+			dJob:                    controller.DispatchedJob{LastUpdated: now.Add(-time.Hour), LeaseExpires: now.Add(-time.Second)},
+			expectUUIDToBeNullified: true,
+		},
+		{
+			// The lease is what counts, so a Runner which renews it without sending status updates keeps its job
+			name:                    "Renewed lease of a job which hasn't been updated for longer than the timeout",
+			dJob:                    controller.DispatchedJob{LastUpdated: now.Add(-time.Hour * 24), LeaseExpires: now.Add(time.Minute)},
+			expectUUIDToBeNullified: false,
+		},
+		{
+			name:                    "Job without a lease updated within the timeout",
+			dJob:                    controller.DispatchedJob{LastUpdated: now.Add(-time.Second * 16)},
+			expectUUIDToBeNullified: false,
+		},
+		{
+			name:                    "Job without a lease updated exactly the timeout ago",
+			dJob:                    controller.DispatchedJob{LastUpdated: now.Add(-time.Second * 32)},
 			expectUUIDToBeNullified: true,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			ds := mockDataStorer{
-				dJobs: []controller.DispatchedJob{
-					{
-						UUID:        "test",
-						Runner:      "TestRunner",
-						Job:         controller.Job{},
-						Status:      controller.JobStatus{},
-						LastUpdated: time.Unix(0, 0),
-					},
-				},
-			}
+			test.dJob.UUID = "test"
+			test.dJob.Runner = "TestRunner"
+			ds := mockDataStorer{dJobs: []controller.DispatchedJob{test.dJob}}
 			ss := mockSettingsStorer{
 				healthCheckInt:     uint64(time.Second * 1),
-				healthCheckTimeout: test.healthCheckTimeout,
+				healthCheckTimeout: uint64(time.Second * 32),
 			}
-			c := NewChecker(&ds, &ss, &mockLogger{})
-
-			mNS := mockNowSincer{
-				sinceResp:  time.Second * 2,
-				sinceResp2: test.jobLastUpdatedDur,
-			}
-			c.nowSincer = &mNS
+			c := NewChecker(&ds, &ss, &mockNotifier{}, &mockLogger{}, 0, 0)
+			c.nowSincer = &mockNowSincer{nowResp: now, sinceResp: time.Second * 2}
 
-			nulledUUIDs := c.Run()
+			nulledUUIDs := staleUUIDs(c.Run())
 
 			if !ds.dJobsCalled {
 				t.Errorf("expected DataStorer.DispatchedJobs() to be called")
 				return
 			}
 
-			if mNS.sinceTimesCalled != 2 {
-				t.Errorf("expected NowSincer.Since() to be called twice but it was called %v times", mNS.sinceTimesCalled)
-				return
-			}
-
-			if len(nulledUUIDs) > 0 && !test.expectUUIDToBeNullified {
-				t.Errorf("received a nullified UUID when one wasn't expected")
+			if nulled := len(nulledUUIDs) == 1; nulled != test.expectUUIDToBeNullified {
+				t.Errorf("expected job to be nullified to be %v but got nullified UUIDs %v", test.expectUUIDToBeNullified, nulledUUIDs)
 			}
 		})
 	}
 }
 
-func TestDSDeleteJobNoNullUUIDsIf100Errors(t *testing.T) {
+func TestDSRevokeLeaseNoNullUUIDsIf100Errors(t *testing.T) {
 	tests := []struct {
 		name            string
-		deleteErrAmount int
+		revokeErrAmount int
 		expectNullUUID  bool
 	}{
 		{
 			name:            "No errors",
-			deleteErrAmount: 0,
+			revokeErrAmount: 0,
 			expectNullUUID:  true,
 		},
 		{
 			name:            "Well below threshold",
-			deleteErrAmount: 50,
+			revokeErrAmount: 50,
 			expectNullUUID:  true,
 		},
 		{
 			name:            "99 (highest amount while still getting null UUIDs)",
-			deleteErrAmount: 99,
+			revokeErrAmount: 99,
 			expectNullUUID:  true,
 		},
 		{
 			name:            "100 (lowest amount while still not getting null UUIDs)",
-			deleteErrAmount: 100,
+			revokeErrAmount: 100,
 			expectNullUUID:  false,
 		},
 		{
 			name:            "Well above threshold",
-			deleteErrAmount: 150,
+			revokeErrAmount: 150,
 			expectNullUUID:  false,
 		},
 	}
@@ -186,39 +184,35 @@ func TestDSDeleteJobNoNullUUIDsIf100Errors(t *testing.T) {
 			ds := mockDataStorer{
 				dJobs: []controller.DispatchedJob{
 					{
-						UUID:        "test",
-						Runner:      "TestRunner",
-						Job:         controller.Job{},
-						Status:      controller.JobStatus{},
-						LastUpdated: time.Unix(0, 0),
+						UUID:         "test",
+						Runner:       "TestRunner",
+						Job:          controller.Job{},
+						Status:       controller.JobStatus{},
+						LastUpdated:  time.Unix(0, 0),
+						LeaseExpires: time.Unix(0, 0).Add(time.Minute),
 					},
 				},
-				deleteErrAmount: test.deleteErrAmount, // 99 should fail, 100 should succeed
+				revokeErrAmount: test.revokeErrAmount, // 99 should fail, 100 should succeed
 			}
 			ss := mockSettingsStorer{
 				healthCheckInt:     uint64(time.Second * 1),
 				healthCheckTimeout: uint64(time.Minute * 1),
 			}
-			c := NewChecker(&ds, &ss, &mockLogger{})
+			c := NewChecker(&ds, &ss, &mockNotifier{}, &mockLogger{}, 0, 0)
 
 			mNS := mockNowSincer{
-				sinceResp:  time.Second * 2,
-				sinceResp2: time.Minute * 2,
+				nowResp:   time.Unix(0, 0).Add(time.Minute * 2),
+				sinceResp: time.Second * 2,
 			}
 			c.nowSincer = &mNS
 
-			nulledUUIDs := c.Run()
+			nulledUUIDs := staleUUIDs(c.Run())
 
 			if !ds.dJobsCalled {
 				t.Errorf("expected DataStorer.DispatchedJobs() to be called")
 				return
 			}
 
-			if mNS.sinceTimesCalled != 2 {
-				t.Errorf("expected NowSincer.Since() to be called twice but it was called %v times", mNS.sinceTimesCalled)
-				return
-			}
-
 			if test.expectNullUUID && len(nulledUUIDs) == 0 {
 				t.Errorf("expected a non-zero nullified UUIDs slice")
 			}
@@ -228,3 +222,479 @@ func TestDSDeleteJobNoNullUUIDsIf100Errors(t *testing.T) {
 		})
 	}
 }
+
+// A lease which its Runner renewed after the dispatched jobs were read isn't revoked
+func TestRenewedLeaseIsNotRevoked(t *testing.T) {
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	ds := mockDataStorer{
+		dJobs:   []controller.DispatchedJob{{UUID: "test", Runner: "TestRunner", LeaseExpires: now.Add(-time.Minute)}},
+		renewed: []controller.UUID{"test"},
+	}
+	ss := mockSettingsStorer{healthCheckInt: uint64(time.Second * 1)}
+	c := NewChecker(&ds, &ss, &mockNotifier{}, &mockLogger{}, 0, 0)
+	c.nowSincer = &mockNowSincer{nowResp: now, sinceResp: time.Second * 2}
+
+	if staleJobs := c.Run(); len(staleJobs) != 0 {
+		t.Errorf("expected the renewed job to be left with its Runner but got %+v", staleJobs)
+	}
+}
+
+// Jobs whose Runner kept contacting the Controller after their lease expired are requeued as orphaned,
+// even if their library only notifies about stale jobs
+func TestOrphanedJobs(t *testing.T) {
+	leaseExpires := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		runners        []controller.Runner
+		expectNullUUID bool
+	}{
+		{
+			name:           "Runner seen after the lease expired",
+			runners:        []controller.Runner{{Name: "TestRunner", LastSeen: leaseExpires.Add(time.Second)}},
+			expectNullUUID: true,
+		},
+		{
+			name:           "Runner seen exactly when the lease expired",
+			runners:        []controller.Runner{{Name: "TestRunner", LastSeen: leaseExpires}},
+			expectNullUUID: false,
+		},
+		{
+			name:           "Runner seen before the lease expired",
+			runners:        []controller.Runner{{Name: "TestRunner", LastSeen: leaseExpires.Add(-time.Minute)}},
+			expectNullUUID: false,
+		},
+		{
+			name:           "Other runner seen after the lease expired",
+			runners:        []controller.Runner{{Name: "OtherRunner", LastSeen: leaseExpires.Add(time.Hour)}},
+			expectNullUUID: false,
+		},
+		{
+			name:           "Unknown runner",
+			runners:        nil,
+			expectNullUUID: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := mockDataStorer{
+				dJobs:   []controller.DispatchedJob{{UUID: "test", Runner: "TestRunner", LastUpdated: leaseExpires.Add(-time.Hour), LeaseExpires: leaseExpires}},
+				runners: test.runners,
+			}
+			ss := mockSettingsStorer{
+				healthCheckInt: uint64(time.Second * 1),
+				staleJobAction: "notify",
+			}
+			c := NewChecker(&ds, &ss, &mockNotifier{}, &mockLogger{}, 0, 0)
+			c.nowSincer = &mockNowSincer{nowResp: leaseExpires.Add(time.Hour), sinceResp: time.Second * 2}
+
+			staleJobs := c.Run()
+
+			nulledUUIDs := staleUUIDs(staleJobs)
+			if nulled := len(nulledUUIDs) == 1 && nulledUUIDs[0] == "test"; nulled != test.expectNullUUID {
+				t.Errorf("expected job to be nullified to be %v but got nullified UUIDs %v", test.expectNullUUID, nulledUUIDs)
+			}
+			if revoked := len(ds.revoked) == 1; revoked != test.expectNullUUID {
+				t.Errorf("expected the lease to be revoked to be %v but got revoked UUIDs %v", test.expectNullUUID, ds.revoked)
+			}
+			for _, v := range staleJobs {
+				if v.Action != controller.StaleJobRequeue {
+					t.Errorf("expected the job to be requeued but got %+v", v)
+				}
+			}
+		})
+	}
+}
+
+// The stale job timeout and action can be overridden per library, and notify-only jobs are left with their Runner.
+// The jobs don't have a lease, so the timeout is applied to when they were last updated.
+func TestStaleJobSettings(t *testing.T) {
+	lastUpdated := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		staleJobAction   string
+		staleJobSettings map[int]controller.StaleJobSettings
+		runners          []controller.Runner
+		benchmark        bool
+		sinceUpdate      time.Duration
+		expectedAction   controller.StaleJobAction // Empty if the job shouldn't be removed
+		expectedEvents   int
+	}{
+		{
+			name:           "Global timeout and action",
+			staleJobAction: "fail",
+			sinceUpdate:    time.Hour * 2,
+			expectedAction: controller.StaleJobFail,
+		},
+		{
+			name:           "Unset global action requeues",
+			sinceUpdate:    time.Hour * 2,
+			expectedAction: controller.StaleJobRequeue,
+		},
+		{
+			name:             "Longer library timeout",
+			staleJobSettings: map[int]controller.StaleJobSettings{1: {Timeout: time.Hour * 30}},
+			sinceUpdate:      time.Hour * 2,
+		},
+		{
+			name:             "Shorter library timeout",
+			staleJobSettings: map[int]controller.StaleJobSettings{1: {Timeout: time.Minute * 5}},
+			sinceUpdate:      time.Minute * 10,
+			expectedAction:   controller.StaleJobRequeue,
+		},
+		{
+			name:             "Other library's timeout",
+			staleJobSettings: map[int]controller.StaleJobSettings{2: {Timeout: time.Minute * 5}},
+			sinceUpdate:      time.Minute * 10,
+		},
+		{
+			name:             "Library action",
+			staleJobAction:   "requeue",
+			staleJobSettings: map[int]controller.StaleJobSettings{1: {Action: controller.StaleJobFail}},
+			sinceUpdate:      time.Hour * 2,
+			expectedAction:   controller.StaleJobFail,
+		},
+		{
+			name:           "Notify only",
+			staleJobAction: "notify",
+			sinceUpdate:    time.Hour * 2,
+			expectedEvents: 1,
+		},
+		{
+			name:           "Orphaned job is requeued instead of notified about",
+			staleJobAction: "notify",
+			runners:        []controller.Runner{{Name: "TestRunner", LastSeen: lastUpdated.Add(time.Minute * 90)}},
+			sinceUpdate:    time.Hour * 2,
+			expectedAction: controller.StaleJobRequeue,
+		},
+		{
+			name:           "Benchmark fails instead of being notified about",
+			staleJobAction: "notify",
+			benchmark:      true,
+			sinceUpdate:    time.Hour * 2,
+			expectedAction: controller.StaleJobFail,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			job := controller.Job{LibraryID: 1}
+			if test.benchmark {
+				job.Benchmark = &controller.Benchmark{}
+			}
+			ds := mockDataStorer{
+				dJobs:            []controller.DispatchedJob{{UUID: "test", Runner: "TestRunner", Job: job, LastUpdated: lastUpdated}},
+				runners:          test.runners,
+				staleJobSettings: test.staleJobSettings,
+			}
+			ss := mockSettingsStorer{
+				healthCheckInt:     uint64(time.Second * 1),
+				healthCheckTimeout: uint64(time.Hour * 1),
+				staleJobAction:     test.staleJobAction,
+			}
+			n := mockNotifier{}
+			c := NewChecker(&ds, &ss, &n, &mockLogger{}, 0, 0)
+			c.nowSincer = &mockNowSincer{nowResp: lastUpdated.Add(test.sinceUpdate), sinceResp: time.Second * 2, sinceResp2: time.Second * 2}
+
+			// The second run checks that a job which is left with its Runner isn't notified about again
+			staleJobs := c.Run()
+			c.Run()
+
+			if test.expectedAction == "" && len(staleJobs) != 0 {
+				t.Errorf("expected the job not to be removed but got %+v", staleJobs)
+			}
+			if test.expectedAction != "" && (len(staleJobs) != 1 || staleJobs[0].Action != test.expectedAction) {
+				t.Errorf("expected the job to be removed with action %v but got %+v", test.expectedAction, staleJobs)
+			}
+			if len(n.events) != test.expectedEvents {
+				t.Errorf("expected %v events but got %+v", test.expectedEvents, n.events)
+			}
+			for _, e := range n.events {
+				if e.Type != controller.EventJobStale || e.LibraryID != 1 {
+					t.Errorf("unexpected event %+v", e)
+				}
+			}
+		})
+	}
+}
+
+// Every action taken with a stale job is saved and counted
+func TestRecordedActions(t *testing.T) {
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	ds := mockDataStorer{dJobs: []controller.DispatchedJob{
+		{UUID: "requeued", Runner: "TestRunner", Job: controller.Job{LibraryID: 1, Path: "/media/a.mkv"}, LeaseExpires: now.Add(-time.Minute)},
+		{UUID: "notified", Runner: "TestRunner", Job: controller.Job{LibraryID: 2, Path: "/media/b.mkv"}, LeaseExpires: now.Add(-time.Minute)},
+		{UUID: "healthy", Runner: "TestRunner", Job: controller.Job{LibraryID: 1, Path: "/media/c.mkv"}, LeaseExpires: now.Add(time.Minute)},
+	}, staleJobSettings: map[int]controller.StaleJobSettings{2: {Action: controller.StaleJobNotify}}}
+	ss := mockSettingsStorer{healthCheckInt: uint64(time.Second * 1)}
+	mc := newMockMetricsCollector()
+	c := NewChecker(&ds, &ss, &mockNotifier{}, &mockLogger{}, 0, 0)
+	c.SetMetricsCollector(mc)
+	c.nowSincer = &mockNowSincer{nowResp: now, sinceResp: time.Second * 2}
+
+	staleJobs := c.Run()
+
+	if len(staleJobs) != 1 || staleJobs[0].DispatchedJob.UUID != "requeued" || staleJobs[0].Action != controller.StaleJobRequeue {
+		t.Errorf("expected the requeued job to be returned but got %+v", staleJobs)
+	}
+
+	if len(ds.actions) != 2 {
+		t.Fatalf("expected 2 recorded actions but got %+v", ds.actions)
+	}
+	expected := map[controller.UUID]controller.StaleJobAction{"requeued": controller.StaleJobRequeue, "notified": controller.StaleJobNotify}
+	for _, a := range ds.actions {
+		if a.Action != expected[a.JobUUID] || a.Runner != "TestRunner" || !a.Time.Equal(now) || a.Reason == "" {
+			t.Errorf("unexpected recorded action %+v", a)
+		}
+	}
+
+	if v := mc.counters["encodarr_stale_jobs_requeued_total"].value; v != 1 {
+		t.Errorf("expected 1 requeued job to be counted but got %v", v)
+	}
+	if v := mc.counters["encodarr_stale_jobs_failed_total"].value; v != 0 {
+		t.Errorf("expected no failed jobs to be counted but got %v", v)
+	}
+	if v := mc.counters["encodarr_leases_expired_total"].value; v != 2 {
+		t.Errorf("expected 2 expired leases to be counted but got %v", v)
+	}
+}
+
+// A renewed lease is notified about again once it expires
+func TestNotifyAgainAfterRenewal(t *testing.T) {
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	ds := mockDataStorer{dJobs: []controller.DispatchedJob{{UUID: "test", Runner: "TestRunner", LeaseExpires: now.Add(-time.Minute)}}}
+	ss := mockSettingsStorer{healthCheckInt: uint64(time.Second * 1), staleJobAction: "notify"}
+	n := mockNotifier{}
+	c := NewChecker(&ds, &ss, &n, &mockLogger{}, 0, 0)
+	mNS := mockNowSincer{nowResp: now, sinceResp: time.Second * 2, sinceResp2: time.Second * 2}
+	c.nowSincer = &mNS
+
+	c.Run()
+	ds.dJobs[0].LeaseExpires = now.Add(time.Minute)
+	mNS.nowResp = now.Add(time.Minute * 2)
+	c.Run()
+
+	if len(n.events) != 2 {
+		t.Errorf("expected 2 events but got %+v", n.events)
+	}
+}
+
+// The default lease duration is the stale job timeout of the job's library
+func TestLeaseDuration(t *testing.T) {
+	ds := mockDataStorer{staleJobSettings: map[int]controller.StaleJobSettings{1: {Timeout: time.Minute * 5}}}
+	ss := mockSettingsStorer{healthCheckTimeout: uint64(time.Hour)}
+	c := NewChecker(&ds, &ss, &mockNotifier{}, &mockLogger{}, 0, 0)
+
+	if d := c.LeaseDuration(1); d != time.Minute*5 {
+		t.Errorf("expected the library's lease duration to be 5m0s but got %v", d)
+	}
+	if d := c.LeaseDuration(2); d != time.Hour {
+		t.Errorf("expected the global lease duration to be 1h0m0s but got %v", d)
+	}
+}
+
+// Runners which miss their heartbeats are reported once, and their jobs are requeued once their lease has expired
+// even if their library only notifies about stale jobs
+func TestOfflineRunners(t *testing.T) {
+	firstSeen := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		runner         string
+		firstSeen      time.Time // When the Runner was last seen as of the first check
+		secondSeen     time.Time // When the Runner was last seen as of the later checks
+		expectNullUUID bool
+		expectEarly    bool // Whether the job is taken away as soon as its Runner goes offline, before its lease expires
+		expectedEvents int
+	}{
+		{
+			name:           "Runner misses its heartbeats",
+			runner:         "TestRunner",
+			firstSeen:      firstSeen,
+			secondSeen:     firstSeen,
+			expectNullUUID: true,
+			expectEarly:    true,
+			expectedEvents: 1,
+		},
+		{
+			name:       "Runner keeps sending heartbeats",
+			runner:     "TestRunner",
+			firstSeen:  firstSeen,
+			secondSeen: firstSeen.Add(time.Minute * 2),
+		},
+		{
+			name:           "Runner already offline when first checked",
+			runner:         "TestRunner",
+			firstSeen:      firstSeen.Add(-time.Hour),
+			secondSeen:     firstSeen.Add(-time.Hour),
+			expectNullUUID: true,
+		},
+		{
+			name:           "Other runner misses its heartbeats",
+			runner:         "OtherRunner",
+			firstSeen:      firstSeen,
+			secondSeen:     firstSeen,
+			expectedEvents: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := mockDataStorer{
+				dJobs:   []controller.DispatchedJob{{UUID: "test", Runner: "TestRunner", LastUpdated: firstSeen, LeaseExpires: firstSeen.Add(time.Second * 150)}},
+				runners: []controller.Runner{{Name: test.runner, LastSeen: test.firstSeen}},
+			}
+			ss := mockSettingsStorer{staleJobAction: "notify", healthCheckTimeout: uint64(time.Hour)}
+			n := mockNotifier{}
+			c := NewChecker(&ds, &ss, &n, &mockLogger{}, time.Second*90, 0)
+
+			mNS := mockNowSincer{nowResp: firstSeen.Add(time.Second * 10)}
+			c.nowSincer = &mNS
+
+			staleJobs := c.Run()
+
+			// The Runner goes offline at 1m30s, which takes the job away before its lease expires at 2m30s,
+			// instead of waiting for the lease or the health check timeout
+			ds.runners[0].LastSeen = test.secondSeen
+			mNS.nowResp = firstSeen.Add(time.Minute * 2)
+			early := c.Run()
+			if taken := len(early) != 0; taken != test.expectEarly {
+				t.Errorf("expected the job to be taken away before its lease expired to be %v but got %+v", test.expectEarly, early)
+			}
+			staleJobs = append(staleJobs, early...)
+
+			mNS.nowResp = firstSeen.Add(time.Minute * 3)
+			staleJobs = append(staleJobs, c.Run()...)
+
+			nulledUUIDs := staleUUIDs(staleJobs)
+			if nulled := len(nulledUUIDs) == 1 && nulledUUIDs[0] == "test"; nulled != test.expectNullUUID {
+				t.Errorf("expected job to be nullified to be %v but got nullified UUIDs %v", test.expectNullUUID, nulledUUIDs)
+			}
+			for _, v := range staleJobs {
+				if v.Action != controller.StaleJobRequeue {
+					t.Errorf("expected the job to be requeued but got %+v", v)
+				}
+			}
+
+			offlineEvents := 0
+			for _, e := range n.events {
+				if e.Type == controller.EventRunnerOffline {
+					offlineEvents++
+				}
+			}
+			if offlineEvents != test.expectedEvents {
+				t.Errorf("expected %v runner offline events but got %+v", test.expectedEvents, n.events)
+			}
+		})
+	}
+}
+
+// The user is alerted once when no Runner has been seen for a while with jobs in the queue, and the alert
+// clears when a Runner is seen again
+func TestCheckRunnersAvailable(t *testing.T) {
+	started := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	ds := mockDataStorer{runners: []controller.Runner{{Name: "TestRunner", LastSeen: started.Add(-time.Hour * 24)}}}
+	n := mockNotifier{}
+	c := NewChecker(&ds, &mockSettingsStorer{}, &n, &mockLogger{}, 0, 0)
+	c.SetNoRunnersAlert(time.Hour)
+
+	mNS := mockNowSincer{nowResp: started}
+	c.nowSincer = &mNS
+
+	ctx := context.Background()
+	c.Start(ctx)
+
+	// The time before the Controller started doesn't count
+	mNS.nowResp = started.Add(time.Minute * 30)
+	if since := c.CheckRunnersAvailable(true); !since.IsZero() {
+		t.Errorf("expected no alert before the alert period passed but got %v", since)
+	}
+
+	// The queue is empty, so there is nothing to alert about
+	mNS.nowResp = started.Add(time.Minute * 61)
+	if since := c.CheckRunnersAvailable(false); !since.IsZero() {
+		t.Errorf("expected no alert with an empty queue but got %v", since)
+	}
+
+	mNS.nowResp = started.Add(time.Minute * 62)
+	if since := c.CheckRunnersAvailable(true); !since.Equal(started) {
+		t.Errorf("expected the alert to be raised since %v but got %v", started, since)
+	}
+
+	mNS.nowResp = started.Add(time.Minute * 63)
+	if since := c.CheckRunnersAvailable(true); !since.Equal(started) {
+		t.Errorf("expected the alert to stay raised since %v but got %v", started, since)
+	}
+
+	if len(n.events) != 1 || n.events[0].Type != controller.EventNoRunners {
+		t.Errorf("expected a single no runners event but got %+v", n.events)
+	}
+
+	ds.runners[0].LastSeen = started.Add(time.Minute * 64)
+	mNS.nowResp = started.Add(time.Minute * 64)
+	if since := c.CheckRunnersAvailable(true); !since.IsZero() {
+		t.Errorf("expected the alert to be cleared once a runner was seen but got %v", since)
+	}
+}
+
+// After a restart, nothing is checked during the grace period, and the leases which weren't renewed by then are revoked,
+// even if they haven't expired yet
+func TestRestartGracePeriod(t *testing.T) {
+	started := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	ds := mockDataStorer{
+		dJobs: []controller.DispatchedJob{
+			// Renewed by its Runner during the grace period
+			{UUID: "renewed", Runner: "TestRunner", LastUpdated: started.Add(-time.Hour), LeaseDuration: time.Minute * 30, LeaseExpires: started.Add(time.Minute * 31)},
+			// Expired while the Controller was down
+			{UUID: "expired", Runner: "OtherRunner", LastUpdated: started.Add(-time.Hour), LeaseDuration: time.Minute * 30, LeaseExpires: started.Add(-time.Minute * 30)},
+			// Still leased, but not claimed by any Runner during the grace period
+			{UUID: "unclaimed", Runner: "OtherRunner", LastUpdated: started.Add(-time.Minute * 10), LeaseDuration: time.Hour, LeaseExpires: started.Add(time.Minute * 50)},
+			// Dispatched before leases were introduced, so the downtime doesn't count towards its timeout
+			{UUID: "legacy", Runner: "OtherRunner", LastUpdated: started.Add(-time.Hour * 3)},
+		},
+	}
+	ss := mockSettingsStorer{healthCheckTimeout: uint64(time.Hour * 2)}
+	c := NewChecker(&ds, &ss, &mockNotifier{}, &mockLogger{}, 0, time.Minute*2)
+
+	mNS := mockNowSincer{nowResp: started}
+	c.nowSincer = &mNS
+
+	ctx := context.Background()
+	c.Start(ctx)
+
+	mNS.nowResp = started.Add(time.Minute)
+	if staleJobs := c.Run(); len(staleJobs) != 0 || ds.dJobsCalled {
+		t.Errorf("expected nothing to be checked during the grace period but got %+v", staleJobs)
+	}
+
+	mNS.nowResp = started.Add(time.Minute * 2)
+	staleJobs := c.Run()
+	if uuids := staleUUIDs(staleJobs); !reflect.DeepEqual(uuids, []controller.UUID{"expired", "unclaimed"}) {
+		t.Errorf("expected the expired and unclaimed jobs to be removed but got %v", uuids)
+	}
+	for _, v := range staleJobs {
+		if v.Action != controller.StaleJobRequeue {
+			t.Errorf("expected the job to be requeued but got %+v", v)
+		}
+	}
+
+	if staleJobs = c.Run(); len(staleJobs) != 0 {
+		t.Errorf("expected the expired jobs to only be removed once but got %+v", staleJobs)
+	}
+}
+
+// staleUUIDs returns the UUIDs of the provided stale jobs.
+func staleUUIDs(staleJobs []controller.StaleJob) []controller.UUID {
+	uuids := make([]controller.UUID, 0, len(staleJobs))
+	for _, v := range staleJobs {
+		uuids = append(uuids, v.DispatchedJob.UUID)
+	}
+	return uuids
+}
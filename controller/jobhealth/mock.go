@@ -1,6 +1,7 @@
 package jobhealth
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -34,22 +35,58 @@ func (m *mockNowSincer) Since(time.Time) time.Duration {
 type mockDataStorer struct {
 	dJobsCalled bool
 
-	dJobs []controller.DispatchedJob
+	dJobs            []controller.DispatchedJob
+	runners          []controller.Runner
+	staleJobSettings map[int]controller.StaleJobSettings
 
-	deleteErrAmount int
+	revokeErrAmount int
+	renewed         []controller.UUID // Jobs whose lease is renewed before RevokeLease is called.
+	revoked         []controller.UUID
+
+	actions []controller.HealthCheckAction
 }
 
-func (m *mockDataStorer) DispatchedJobs() []controller.DispatchedJob {
+func (m *mockDataStorer) DispatchedJobs(ctx context.Context) []controller.DispatchedJob {
 	m.dJobsCalled = true
 	return m.dJobs
 }
 
-func (m *mockDataStorer) DeleteJob(uuid controller.UUID) error {
-	if m.deleteErrAmount == 0 {
-		return nil
+func (m *mockDataStorer) RevokeLease(ctx context.Context, uuid controller.UUID, now time.Time) (bool, error) {
+	if m.revokeErrAmount > 0 {
+		m.revokeErrAmount--
+		return false, fmt.Errorf("random error")
+	}
+	for _, v := range m.renewed {
+		if v == uuid {
+			return false, nil
+		}
+	}
+	for _, v := range m.dJobs {
+		if v.UUID == uuid && v.LeaseExpires.After(now) {
+			return false, nil
+		}
 	}
-	m.deleteErrAmount--
-	return fmt.Errorf("random error")
+	m.revoked = append(m.revoked, uuid)
+	for i, v := range m.dJobs {
+		if v.UUID == uuid {
+			m.dJobs = append(m.dJobs[:i:i], m.dJobs[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+func (m *mockDataStorer) Runners(ctx context.Context) ([]controller.Runner, error) {
+	return m.runners, nil
+}
+
+func (m *mockDataStorer) StaleJobSettings(ctx context.Context) (map[int]controller.StaleJobSettings, error) {
+	return m.staleJobSettings, nil
+}
+
+func (m *mockDataStorer) SaveHealthCheckAction(ctx context.Context, a controller.HealthCheckAction) error {
+	m.actions = append(m.actions, a)
+	return nil
 }
 
 type mockSettingsStorer struct {
@@ -57,6 +94,7 @@ type mockSettingsStorer struct {
 
 	healthCheckInt     uint64
 	healthCheckTimeout uint64
+	staleJobAction     string
 }
 
 func (m *mockSettingsStorer) HealthCheckInterval() uint64 {
@@ -68,13 +106,43 @@ func (m *mockSettingsStorer) HealthCheckTimeout() uint64 {
 	return m.healthCheckTimeout
 }
 
-func (m *mockSettingsStorer) Load() (err error)             { return }
-func (m *mockSettingsStorer) Save() (err error)             { return }
-func (m *mockSettingsStorer) Close() (err error)            { return }
-func (m *mockSettingsStorer) SetHealthCheckInterval(uint64) {}
-func (m *mockSettingsStorer) SetHealthCheckTimeout(uint64)  {}
-func (m *mockSettingsStorer) LogVerbosity() (s string)      { return }
-func (m *mockSettingsStorer) SetLogVerbosity(string)        {}
+func (m *mockSettingsStorer) StaleJobAction() string {
+	return m.staleJobAction
+}
+
+func (m *mockSettingsStorer) Load() (err error)                           { return }
+func (m *mockSettingsStorer) Save() (err error)                           { return }
+func (m *mockSettingsStorer) Close() (err error)                          { return }
+func (m *mockSettingsStorer) CompressQueues() (b bool)                    { return }
+func (m *mockSettingsStorer) SetCompressQueues(bool)                      {}
+func (m *mockSettingsStorer) MediaServer() (s controller.MediaServer)     { return }
+func (m *mockSettingsStorer) SetMediaServer(controller.MediaServer)       {}
+func (m *mockSettingsStorer) Notifications() (n controller.Notifications) { return }
+func (m *mockSettingsStorer) SetNotifications(controller.Notifications)   {}
+func (m *mockSettingsStorer) SetHealthCheckInterval(uint64)               {}
+func (m *mockSettingsStorer) SetHealthCheckTimeout(uint64)                {}
+func (m *mockSettingsStorer) LogVerbosity() (s string)                    { return }
+func (m *mockSettingsStorer) SetLogVerbosity(string)                      {}
+func (m *mockSettingsStorer) LogLevels() (l map[string]string)            { return }
+func (m *mockSettingsStorer) SetLogLevels(map[string]string)              {}
+func (m *mockSettingsStorer) MaxJobAttempts() (n uint64)                  { return }
+func (m *mockSettingsStorer) SetMaxJobAttempts(uint64)                    {}
+func (m *mockSettingsStorer) QueryTimeout() (n uint64)                    { return }
+func (m *mockSettingsStorer) SetQueryTimeout(uint64)                      {}
+func (m *mockSettingsStorer) QuarantineExpiry() (n uint64)                { return }
+func (m *mockSettingsStorer) SetQuarantineExpiry(uint64)                  {}
+func (m *mockSettingsStorer) SetStaleJobAction(string)                    {}
+
+func (m *mockSettingsStorer) Secret(controller.SecretSetting) (s string) { return }
+func (m *mockSettingsStorer) SetSecret(controller.SecretSetting, string) {}
+
+type mockNotifier struct {
+	events []controller.Event
+}
+
+func (m *mockNotifier) Notify(e controller.Event) {
+	m.events = append(m.events, e)
+}
 
 type mockLogger struct{}
 
@@ -84,3 +152,46 @@ func (m *mockLogger) Info(s string, i ...interface{})     {}
 func (m *mockLogger) Warn(s string, i ...interface{})     {}
 func (m *mockLogger) Error(s string, i ...interface{})    {}
 func (m *mockLogger) Critical(s string, i ...interface{}) {}
+
+type mockMetricsCollector struct {
+	counters map[string]*mockCounter
+}
+
+func newMockMetricsCollector() *mockMetricsCollector {
+	return &mockMetricsCollector{counters: make(map[string]*mockCounter)}
+}
+
+func (m *mockMetricsCollector) Counter(name, help string) controller.Counter {
+	if _, ok := m.counters[name]; !ok {
+		m.counters[name] = &mockCounter{}
+	}
+	return m.counters[name]
+}
+
+func (m *mockMetricsCollector) Histogram(name, help string, buckets []float64) controller.Histogram {
+	return &mockHistogram{}
+}
+
+func (m *mockMetricsCollector) Batch(f func()) { f() }
+
+func (m *mockMetricsCollector) Snapshot() controller.MetricsSnapshot {
+	s := controller.MetricsSnapshot{Counters: make(map[string]float64)}
+	for name, v := range m.counters {
+		s.Counters[name] = v.value
+	}
+	return s
+}
+
+type mockCounter struct {
+	value float64
+}
+
+func (m *mockCounter) Add(delta float64) {
+	if delta > 0 {
+		m.value += delta
+	}
+}
+
+type mockHistogram struct{}
+
+func (m *mockHistogram) Observe(value float64) {}
@@ -0,0 +1,137 @@
+package library
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// spaceRetryInterval is how often the imports of the jobs which are awaiting space are retried.
+const spaceRetryInterval = time.Minute
+
+// awaitingSpaceJob is a completed job whose transcoded file couldn't be moved into its library because the library's
+// filesystem is full. The transcoded file is kept where it was received until the import is retried.
+type awaitingSpaceJob struct {
+	cJob controller.CompletedJob
+	dJob controller.DispatchedJob
+	size int64
+}
+
+// SetAwaitingSpaceLimit sets how many bytes of transcoded files may wait for space in their libraries at once.
+// A completed job which would go over the limit fails instead of waiting. It must be called before Start.
+func (m *Manager) SetAwaitingSpaceLimit(bytes int64) {
+	m.awaitingSpaceLimit = bytes
+}
+
+// AwaitingSpaceJobs returns the jobs which have completed but are waiting for space in their library to be imported.
+func (m *Manager) AwaitingSpaceJobs() []controller.Job {
+	m.awaitingSpaceMutex.Lock()
+	defer m.awaitingSpaceMutex.Unlock()
+
+	jobs := make([]controller.Job, 0, len(m.awaitingSpace))
+	for _, w := range m.awaitingSpace {
+		jobs = append(jobs, w.dJob.Job)
+	}
+	return jobs
+}
+
+// StagedFiles returns the transcoded and captions files of the jobs which are waiting for space and of the parts of
+// multi-part sets which are held until the rest of their set completes. These jobs aren't dispatched anymore, but
+// their files are still in the staging directory of the RunnerCommunicator. Like ImportCompletedJobs, it must be
+// called from the goroutine that imports jobs.
+func (m *Manager) StagedFiles() []string {
+	m.awaitingSpaceMutex.Lock()
+	defer m.awaitingSpaceMutex.Unlock()
+
+	files := make([]string, 0, len(m.awaitingSpace))
+	for _, w := range m.awaitingSpace {
+		files = appendStagedFiles(files, w.cJob)
+	}
+	for _, held := range m.heldGroupJobs {
+		for _, h := range held {
+			files = appendStagedFiles(files, h.cJob)
+		}
+	}
+	return files
+}
+
+// appendStagedFiles appends the files that were received for cJob to files.
+func appendStagedFiles(files []string, cJob controller.CompletedJob) []string {
+	files = append(files, cJob.InFile)
+	if cJob.CaptionsFile != "" {
+		files = append(files, cJob.CaptionsFile)
+	}
+	return files
+}
+
+// holdForSpace keeps a completed job whose import ran out of space until retryAwaitingSpace tries it again.
+// If the transcoded file would take the files which are waiting past the limit, the job fails instead.
+func (m *Manager) holdForSpace(cJob controller.CompletedJob, dJob controller.DispatchedJob) {
+	var size int64
+	if info, err := m.fileStater.Stat(cJob.InFile); err == nil {
+		size = info.Size()
+	}
+
+	m.awaitingSpaceMutex.Lock()
+	var waiting int64
+	for _, w := range m.awaitingSpace {
+		waiting += w.size
+	}
+	fits := waiting+size <= m.awaitingSpaceLimit
+	if fits {
+		m.awaitingSpace = append(m.awaitingSpace, awaitingSpaceJob{cJob, dJob, size})
+		m.lastSpaceRetry = time.Now()
+	}
+	m.awaitingSpaceMutex.Unlock()
+
+	if fits {
+		message := fmt.Sprintf("Job for %v completed, but its library doesn't have space for the transcoded file. The import is retried every %v.", dJob.Job.Path, spaceRetryInterval)
+		m.logger.Warn(message, dJob.Job.LogFields())
+		m.notifyJob(controller.EventJobAwaitingSpace, dJob, message)
+		return
+	}
+
+	failMessage := fmt.Sprintf("Discarding the transcoded file of '%v' because its library doesn't have space for it and the %v bytes of transcoded files already waiting for space leave no room for another %v bytes", dJob.Job.Path, waiting, size)
+	m.logger.Error(failMessage, dJob.Job.LogFields())
+	if err := m.fileRemover.Remove(cJob.InFile); err != nil {
+		m.logger.Error("%v", err, dJob.Job.LogFields())
+	}
+
+	cJob.Failed = true
+	cJob.History.Errors = append(cJob.History.Errors, failMessage)
+	m.importCompletedJob(cJob, dJob)
+}
+
+// retryAwaitingSpace retries the imports of the jobs which are awaiting space, at most once every spaceRetryInterval,
+// and returns the IDs of the libraries which had a job imported. Jobs which still don't fit keep waiting.
+func (m *Manager) retryAwaitingSpace() []int {
+	m.awaitingSpaceMutex.Lock()
+	if len(m.awaitingSpace) == 0 || time.Since(m.lastSpaceRetry) < spaceRetryInterval {
+		m.awaitingSpaceMutex.Unlock()
+		return nil
+	}
+	waiting := m.awaitingSpace
+	m.awaitingSpace = nil
+	m.lastSpaceRetry = time.Now()
+	m.awaitingSpaceMutex.Unlock()
+
+	imported := make([]int, 0, len(waiting))
+	stillWaiting := make([]awaitingSpaceJob, 0)
+	for _, w := range waiting {
+		if m.importCompletedJob(w.cJob, w.dJob) {
+			stillWaiting = append(stillWaiting, w)
+			continue
+		}
+		imported = append(imported, w.dJob.Job.LibraryID)
+	}
+
+	m.awaitingSpaceMutex.Lock()
+	m.awaitingSpace = append(stillWaiting, m.awaitingSpace...)
+	m.awaitingSpaceMutex.Unlock()
+
+	if len(stillWaiting) > 0 {
+		m.logger.Debug("%v completed jobs are still waiting for space in their libraries", len(stillWaiting))
+	}
+	return imported
+}
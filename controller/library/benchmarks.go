@@ -0,0 +1,178 @@
+package library
+
+import (
+	"fmt"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// QueueBenchmarks prepares a benchmark job for each of the provided requests in the background, because reading the
+// metadata of a file may take a while. The prepared jobs are kept in memory until they are dispatched, so the ones
+// which haven't been dispatched yet are lost if the Controller restarts.
+func (m *Manager) QueueBenchmarks(reqs []controller.BenchmarkRequest) {
+	for _, req := range reqs {
+		go m.prepareBenchmark(req)
+	}
+}
+
+// prepareBenchmark decides the command of the benchmark job for req and holds the job until PopBenchmarkJob hands it
+// out. A benchmark which can't be prepared is recorded as failed right away.
+func (m *Manager) prepareBenchmark(req controller.BenchmarkRequest) {
+	job := controller.Job{
+		UUID:      req.UUID,
+		LibraryID: req.LibraryID,
+		Path:      req.Path,
+		QueuedAt:  m.now(),
+		Benchmark: &controller.Benchmark{Runner: req.Runner, Settings: req.Settings},
+	}
+
+	lib, err := m.ds.Library(m.ctx, req.LibraryID)
+	if err != nil {
+		m.failBenchmark(job, fmt.Sprintf("Library %v couldn't be read: %v", req.LibraryID, err))
+		return
+	}
+
+	if job.Benchmark.Settings == "" {
+		job.Benchmark.Settings = m.deciderSettings(lib, req.Path)
+	} else if err = m.commandDecider.ValidateSettings(job.Benchmark.Settings); err != nil {
+		m.failBenchmark(job, fmt.Sprintf("Invalid CommandDecider settings: %v", err))
+		return
+	}
+
+	if job.Metadata, err = m.readMetadata(lib, req.Path); err != nil {
+		m.failBenchmark(job, fmt.Sprintf("Failed to read the metadata of %v: %v", req.Path, err))
+		return
+	}
+
+	if job.Command, err = m.commandDecider.Decide(job.Metadata, job.Benchmark.Settings); err != nil {
+		m.failBenchmark(job, fmt.Sprintf("The CommandDecider skipped %v: %v", req.Path, err))
+		return
+	} else if len(job.Command) == 0 {
+		m.failBenchmark(job, fmt.Sprintf("The CommandDecider returned an empty command for %v", req.Path))
+		return
+	}
+
+	if info, err := m.fileStater.Stat(req.Path); err == nil {
+		job.Size = info.Size()
+	}
+
+	m.benchmarkMutex.Lock()
+	m.benchmarks = append(m.benchmarks, job)
+	m.benchmarkMutex.Unlock()
+
+	m.logger.Info("Prepared benchmark %v of %v", job.UUID, job.Path, job.LogFields())
+}
+
+// PopBenchmarkJob returns the oldest prepared benchmark job which may be dispatched to one of the provided waiting
+// Runners and forgets it. Benchmarks of a file which is already dispatched wait until it isn't anymore, so that
+// benchmarks of the same file on several Runners run one after the other. Unlike PopNewJob, benchmarks are handed out
+// even while processing is disabled or the transcode budget is exhausted, since they don't replace any files.
+func (m *Manager) PopBenchmarkJob(waitingRunners []string) (controller.Job, error) {
+	if m.datastoreDown() {
+		return controller.Job{}, controller.ErrNoJobAvailable
+	}
+
+	m.benchmarkMutex.Lock()
+	defer m.benchmarkMutex.Unlock()
+
+	for i, job := range m.benchmarks {
+		if job.Benchmark.Runner != "" && !containsString(waitingRunners, job.Benchmark.Runner) {
+			continue
+		}
+
+		dispatched, err := m.ds.IsPathDispatched(m.ctx, job.Path)
+		if err != nil {
+			if !m.datastoreFailing() {
+				m.logger.Error(err.Error())
+			}
+			return controller.Job{}, err
+		}
+		if dispatched {
+			continue
+		}
+
+		m.benchmarks = append(m.benchmarks[:i], m.benchmarks[i+1:]...)
+		return job, nil
+	}
+
+	return controller.Job{}, controller.ErrNoJobAvailable
+}
+
+// recordBenchmark records the outcome of a completed benchmark job and throws away whatever the Runner uploaded.
+// Runners from before benchmarks were introduced upload the transcoded file like for any other job, so its size is
+// used as the projected size.
+func (m *Manager) recordBenchmark(cJob controller.CompletedJob, dJob controller.DispatchedJob) {
+	r := benchmarkResult(dJob, cJob.Failed, cJob.History.Errors)
+	r.DateTimeCompleted = cJob.History.DateTimeCompleted
+	if cJob.Benchmark != nil {
+		r.Elapsed = cJob.Benchmark.Elapsed
+		r.FPS = cJob.Benchmark.FPS
+		r.ProjectedSize = cJob.Benchmark.ProjectedSize
+	} else if cJob.InFile != "" {
+		if info, err := m.fileStater.Stat(cJob.InFile); err == nil {
+			r.ProjectedSize = info.Size()
+		}
+	}
+
+	m.discardTranscodedFiles(cJob)
+	m.saveBenchmarkResult(r)
+}
+
+// failBenchmark records a benchmark job which never ran as failed.
+func (m *Manager) failBenchmark(job controller.Job, message string) {
+	m.logger.Warn("Benchmark %v failed: %v", job.UUID, message, job.LogFields())
+
+	r := benchmarkResult(controller.DispatchedJob{UUID: job.UUID, Job: job}, true, []string{message})
+	r.DateTimeCompleted = m.now()
+	m.saveBenchmarkResult(r)
+}
+
+// saveBenchmarkResult saves r and logs the outcome.
+func (m *Manager) saveBenchmarkResult(r controller.BenchmarkResult) {
+	fields := controller.LogFields{"library_id": r.LibraryID, "job_uuid": r.UUID}
+	if err := m.ds.SaveBenchmarkResult(m.ctx, r); err != nil {
+		m.logger.Error("error saving the result of benchmark %v: %v", r.UUID, err, fields)
+		return
+	}
+
+	if r.Failed {
+		m.logger.Info("Recorded benchmark %v of %v on runner %v as failed", r.UUID, r.Path, r.Runner, fields)
+	} else {
+		m.logger.Info("Benchmark %v of %v on runner %v took %v at %v fps with a projected size of %v bytes", r.UUID, r.Path, r.Runner, r.Elapsed, r.FPS, r.ProjectedSize, fields)
+	}
+}
+
+// benchmarkResult returns the result of the benchmark job dJob without the measurements of the Runner.
+func benchmarkResult(dJob controller.DispatchedJob, failed bool, errs []string) controller.BenchmarkResult {
+	if errs == nil {
+		errs = []string{}
+	}
+
+	r := controller.BenchmarkResult{
+		UUID:       dJob.UUID,
+		Path:       dJob.Job.Path,
+		LibraryID:  dJob.Job.LibraryID,
+		Runner:     dJob.Runner,
+		Command:    dJob.Job.Command,
+		Failed:     failed,
+		Errors:     errs,
+		SourceSize: dJob.Job.Size,
+	}
+	if dJob.Job.Benchmark != nil {
+		r.Settings = dJob.Job.Benchmark.Settings
+		if r.Runner == "" {
+			r.Runner = dJob.Job.Benchmark.Runner
+		}
+	}
+	return r
+}
+
+// containsString returns whether or not s is one of the elements of a.
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package library
 
 import (
+	"context"
 	"database/sql"
 	"io/fs"
 	"os"
@@ -29,41 +30,45 @@ type Cache struct {
 }
 
 // Read uses the data storer and file.Stat to determine whether or not to call the MetadataReader or return from the cache.
-func (c *Cache) Read(path string) (controller.FileMetadata, error) {
+// The MetadataReader interface doesn't take a context, so the data storer calls are only limited by its query timeout.
+// Any of them failing just disables caching for the call.
+func (c *Cache) Read(path string, opts controller.MetadataReadOptions) (controller.FileMetadata, error) {
+	ctx := context.Background()
+
 	fileInfo, err := c.stater.Stat(path)
 	if err != nil {
 		c.logger.Error("Failed to stat %v, disabling caching for this call: %v", path, err)
-		return c.metadataReader.Read(path)
+		return c.metadataReader.Read(path, opts)
 	}
 
-	storedModtime, err := c.ds.Modtime(path)
+	storedModtime, err := c.ds.Modtime(ctx, path)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			c.logger.Error("Failed to read stored modtime for %v, disabling caching for this call: %v", path, err)
-			return c.metadataReader.Read(path)
+			return c.metadataReader.Read(path, opts)
 		}
 		storedModtime = time.Unix(0, 0)
 	}
 
 	// We have to set the mod times to UTC because the db returns a different time zone format than os.Stat()
 	if fileInfo.ModTime().UTC() == storedModtime.UTC() {
-		storedMetadata, err := c.ds.Metadata(path)
+		storedMetadata, err := c.ds.Metadata(ctx, path)
 		if err != nil {
 			c.logger.Error("Failed to read stored metadata for %v, disabling caching for this call: %v", path, err)
-			return c.metadataReader.Read(path)
+			return c.metadataReader.Read(path, opts)
 		}
 
 		return storedMetadata, nil
 	}
 
-	newMetadata, err := c.metadataReader.Read(path)
+	newMetadata, err := c.metadataReader.Read(path, opts)
 	if err == nil {
-		err = c.ds.SaveMetadata(path, newMetadata)
+		err = c.ds.SaveMetadata(ctx, path, newMetadata)
 		if err != nil {
 			c.logger.Error("Failed to save new metadata for %v: %v", path, err)
 		}
 
-		err = c.ds.SaveModtime(path, fileInfo.ModTime())
+		err = c.ds.SaveModtime(ctx, path, fileInfo.ModTime())
 		if err != nil {
 			c.logger.Error("Failed to save new modtime for %v: %v", path, err)
 		}
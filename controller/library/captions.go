@@ -0,0 +1,25 @@
+package library
+
+import "strings"
+
+// captionsFileToken is the placeholder for the sidecar file that a command extracts closed captions to.
+const captionsFileToken = "ENCODARR_CAPTIONS_FILE"
+
+// extractsCaptions returns whether or not cmd extracts closed captions to a sidecar file.
+func extractsCaptions(cmd []string) bool {
+	for _, arg := range cmd {
+		if arg == captionsFileToken {
+			return true
+		}
+	}
+	return false
+}
+
+// captionsPath returns the path of the sidecar SRT file for the video at videoPath.
+// Players look for subtitles with the same name as the video, so only the extension is changed.
+func captionsPath(videoPath string) string {
+	if i := strings.LastIndex(videoPath, "."); i > strings.LastIndex(videoPath, "/") {
+		videoPath = videoPath[:i]
+	}
+	return videoPath + ".srt"
+}
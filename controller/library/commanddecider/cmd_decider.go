@@ -3,12 +3,54 @@ package commanddecider
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/BrenekH/encodarr/controller"
 )
 
 // codecParams is a map which correlates the TargetVideoCodec settings to the actual parameter to pass to FFMpeg
-var codecParams map[string]string = map[string]string{"HEVC": "hevc", "AVC": "libx264", "VP9": "libvpx-vp9"}
+var codecParams map[string]string = map[string]string{"HEVC": "hevc", "AVC": "libx264", "VP9": "libvpx-vp9", "AV1": "libsvtav1"}
+
+// hardwareCodecParams is a map of hardware acceleration paths (the suffix of the HardwareCodec setting, ex. "vaapi" for "hevc_vaapi")
+// and the FFMpeg encoders they provide for each target codec.
+var hardwareCodecParams map[string]map[string]string = map[string]map[string]string{
+	"vaapi": {"HEVC": "hevc_vaapi", "AVC": "h264_vaapi", "VP9": "vp9_vaapi", "AV1": "av1_vaapi"},
+	"nvenc": {"HEVC": "hevc_nvenc", "AVC": "h264_nvenc", "AV1": "av1_nvenc"},
+	"qsv":   {"HEVC": "hevc_qsv", "AVC": "h264_qsv", "VP9": "vp9_qsv", "AV1": "av1_qsv"},
+}
+
+// resolutionTiers are the keys that may be used in the ResolutionCodecs setting, ordered from highest to lowest.
+// A video track belongs to the first tier whose minimum width or height it meets so that letterboxed content
+// (ex. 3840x1600) is still recognized by its width.
+var resolutionTiers = []struct {
+	name      string
+	minWidth  int
+	minHeight int
+}{
+	{name: "4K", minWidth: 3200, minHeight: 1800},
+	{name: "1080p", minWidth: 1600, minHeight: 900},
+	{name: "720p", minWidth: 1024, minHeight: 600},
+	{name: "SD", minWidth: 0, minHeight: 0},
+}
+
+// frameRateRegex matches the frame rates accepted by the CFRFrameRate setting, which FFMpeg's -r takes as they are.
+var frameRateRegex = regexp.MustCompile(`^([1-9][0-9]*(\.[0-9]+)?|0\.[0-9]*[1-9][0-9]*)(/[1-9][0-9]*)?$`)
+
+// Bit depth policies for the BitDepth setting. An empty policy leaves the pixel format up to FFMpeg.
+const (
+	bitDepthPreserve = "preserve"
+	bitDepthForce8   = "force8"
+	bitDepthForce10  = "force10"
+)
+
+// pixelFormats is a map of bit depths to the pixel format FFMpeg is told to encode with.
+// Software encoders take planar formats while the hardware encoders expect semi-planar ones.
+var pixelFormats map[int]struct{ software, hardware string } = map[int]struct{ software, hardware string }{
+	8:  {software: "yuv420p", hardware: "nv12"},
+	10: {software: "yuv420p10le", hardware: "p010le"},
+}
 
 // New returns a new CmdDecider.
 func New(logger controller.Logger) CmdDecider {
@@ -22,7 +64,7 @@ type CmdDecider struct {
 
 // DefaultSettings returns the default settings string.
 func (c *CmdDecider) DefaultSettings() string {
-	return `{"target_video_codec": "HEVC", "create_stereo_audio": true, "skip_hdr": true, "use_hardware": false, "hardware_codec": "", "hw_device": ""}`
+	return `{"target_video_codec": "HEVC", "resolution_codecs": {}, "create_stereo_audio": true, "skip_hdr": true, "use_hardware": false, "hardware_codec": "", "hw_device": "", "threads": 0, "extract_captions": false, "preserve_chapters": false, "bit_depth": "preserve", "default_audio_languages": [], "default_subtitle_languages": [], "force_cfr": false, "cfr_frame_rate": "", "input_flags": [], "program": ""}`
 }
 
 // Decide uses the file metadata and settings to decide on a command to run, if any is required.
@@ -34,6 +76,16 @@ func (c *CmdDecider) Decide(m controller.FileMetadata, sSettings string) ([]stri
 		return []string{}, err
 	}
 
+	if err = settings.validate(); err != nil {
+		c.logger.Error(err.Error())
+		return []string{}, err
+	}
+
+	m, program, err := settings.selectProgram(m)
+	if err != nil {
+		return []string{}, err
+	}
+
 	stereoAudioTrackExists := true
 	if settings.CreateStereoAudio {
 		stereoAudioTrackExists = false
@@ -44,9 +96,13 @@ func (c *CmdDecider) Decide(m controller.FileMetadata, sSettings string) ([]stri
 		}
 	}
 
+	targetCodec := settings.TargetVideoCodec
+	var targetBitDepth int
 	var alreadyTargetVideoCodec bool
 	if len(m.VideoTracks) > 0 {
-		alreadyTargetVideoCodec = m.VideoTracks[0].Codec == settings.TargetVideoCodec
+		targetCodec = settings.targetCodecFor(m.VideoTracks[0])
+		targetBitDepth = settings.targetBitDepthFor(m.VideoTracks[0])
+		alreadyTargetVideoCodec = m.VideoTracks[0].Codec == targetCodec && hasBitDepth(m.VideoTracks[0], targetBitDepth)
 	} else {
 		// Just because there are no video tracks, doesn't mean that the audio can't be adjusted.
 		// So tell the system that the video is already the target and move on.
@@ -57,30 +113,324 @@ func (c *CmdDecider) Decide(m controller.FileMetadata, sSettings string) ([]stri
 		return []string{}, fmt.Errorf("file already matches requirements")
 	}
 
-	var ffmpegCodecParam string
-	if settings.UseHardware {
-		ffmpegCodecParam = settings.HardwareCodec
-	} else {
-		var ok bool
-		ffmpegCodecParam, ok = codecParams[settings.TargetVideoCodec]
-		if !ok {
-			return []string{}, fmt.Errorf("couldn't identify ffmpeg parameter for '%v' target codec", settings.TargetVideoCodec)
-		}
+	ffmpegCodecParam, err := settings.ffmpegCodec(targetCodec)
+	if err != nil {
+		return []string{}, err
 	}
 
 	cmd := genFFmpegCmd(!stereoAudioTrackExists, !alreadyTargetVideoCodec, ffmpegCodecParam, settings.UseHardware, settings.HWDevice)
+	if pixFmt := pixelFormat(targetBitDepth, settings.UseHardware); pixFmt != "" && !alreadyTargetVideoCodec {
+		cmd = append(cmd, "-pix_fmt", pixFmt)
+	}
+	if settings.ForceCFR && !alreadyTargetVideoCodec && m.VideoTracks[0].VariableFrameRate {
+		cmd = append(cmd, "-vsync", "cfr", "-r", settings.CFRFrameRate)
+	}
+	if settings.Threads > 0 {
+		cmd = append(cmd, "-threads", strconv.Itoa(settings.Threads))
+	}
+
+	if settings.PreserveChapters && m.Chapters {
+		cmd = append(cmd, "-map_chapters", "0")
+	}
+
+	cmd = append(cmd, dispositionArgs(m, settings, !stereoAudioTrackExists)...)
+
+	if settings.ExtractCaptions && m.ClosedCaptions {
+		cmd = withCaptionExtraction(cmd)
+	}
+
+	if program != nil {
+		cmd = withProgram(cmd, program.ID)
+	}
+
+	return withInputFlags(cmd, settings.InputFlags), nil
+}
+
+// TargetVideoCodec returns the video codec that a file with the provided metadata is transcoded to with the provided settings.
+// An empty string is returned if the file doesn't have a video track.
+func (c *CmdDecider) TargetVideoCodec(m controller.FileMetadata, sSettings string) (string, error) {
+	settings := CmdDeciderSettings{}
+	if err := json.Unmarshal([]byte(sSettings), &settings); err != nil {
+		return "", err
+	}
+
+	if err := settings.validate(); err != nil {
+		return "", err
+	}
 
-	return cmd, nil
+	m, _, err := settings.selectProgram(m)
+	if err != nil {
+		return "", err
+	}
+
+	if len(m.VideoTracks) == 0 {
+		return "", nil
+	}
+	return settings.targetCodecFor(m.VideoTracks[0]), nil
+}
+
+// ValidateSettings returns an error if the provided settings string can't be used to decide on commands.
+func (c *CmdDecider) ValidateSettings(sSettings string) error {
+	settings := CmdDeciderSettings{}
+	if err := json.Unmarshal([]byte(sSettings), &settings); err != nil {
+		return err
+	}
+
+	if settings.UseHardware && settings.HardwareCodec == "" {
+		return fmt.Errorf("hardware_codec must be set when use_hardware is enabled")
+	}
+
+	if _, err := settings.ffmpegCodec(settings.TargetVideoCodec); err != nil {
+		return err
+	}
+
+	return settings.validate()
+}
+
+// Annotations returns the annotations setting, which is attached to every job that is queued with the settings.
+func (c *CmdDecider) Annotations(sSettings string) (map[string]string, error) {
+	settings := CmdDeciderSettings{}
+	if err := json.Unmarshal([]byte(sSettings), &settings); err != nil {
+		return nil, err
+	}
+	return settings.Annotations, nil
 }
 
 // CmdDeciderSettings defines the structure to unmarshal the settings string into.
 type CmdDeciderSettings struct {
-	TargetVideoCodec  string `json:"target_video_codec"`
-	CreateStereoAudio bool   `json:"create_stereo_audio"`
-	SkipHDR           bool   `json:"skip_hdr"`
-	UseHardware       bool   `bool:"use_hardware"`
-	HardwareCodec     string `json:"hardware_codec"`
-	HWDevice          string `json:"hw_device"`
+	TargetVideoCodec  string            `json:"target_video_codec"`
+	ResolutionCodecs  map[string]string `json:"resolution_codecs"` // Resolution tier (ex. "SD" or "4K") to target codec. Tiers which aren't present use TargetVideoCodec.
+	CreateStereoAudio bool              `json:"create_stereo_audio"`
+	SkipHDR           bool              `json:"skip_hdr"`
+	UseHardware       bool              `json:"use_hardware"`
+	HardwareCodec     string            `json:"hardware_codec"`
+	HWDevice          string            `json:"hw_device"`
+	Annotations       map[string]string `json:"annotations"`       // Attached to every job queued with these settings so that external tooling can identify them.
+	Threads           int               `json:"threads"`           // Caps the number of threads FFmpeg uses for each job. 0 lets FFmpeg decide.
+	ExtractCaptions   bool              `json:"extract_captions"`  // Saves embedded closed captions to a sidecar SRT file next to the transcoded file.
+	PreserveChapters  bool              `json:"preserve_chapters"` // Copies the chapter markers of the input to the transcoded file.
+	BitDepth          string            `json:"bit_depth"`         // "preserve", "force8" or "force10". Empty leaves the pixel format up to FFMpeg.
+
+	// DefaultAudioLanguages and DefaultSubtitleLanguages are languages (ex. "eng" or "ja") in order of preference.
+	// The first track in the first of them that the file has becomes the default track of its type.
+	DefaultAudioLanguages    []string `json:"default_audio_languages"`
+	DefaultSubtitleLanguages []string `json:"default_subtitle_languages"`
+
+	// ForceCFR makes the video of VFR files constant at CFRFrameRate (ex. "24000/1001" or "25") when it is encoded, which avoids
+	// audio drifting out of sync. Being VFR doesn't cause a file to be transcoded on its own.
+	ForceCFR     bool   `json:"force_cfr"`
+	CFRFrameRate string `json:"cfr_frame_rate"`
+
+	// InputFlags are FFMpeg options for the input file (ex. ["-analyzeduration", "200M", "-probesize", "1G"]), which are
+	// placed right before its -i. They can't add an input or an output.
+	InputFlags []string `json:"input_flags"`
+
+	// Program is the ID of the program (ex. "4") to transcode from files with several programs, like DVR captures of transport
+	// streams. When it is empty, the first program with both video and audio is used. The other programs are dropped.
+	Program string `json:"program"`
+}
+
+// validate returns an error if any of the resolution tiers or mapped codecs are unknown, if a mapped codec
+// isn't supported by the selected hardware acceleration path, if the thread count is negative, if the bit depth policy is unknown,
+// if a default track language is empty, if CFR is forced without a valid frame rate, if the input flags are invalid,
+// or if the program isn't a program ID.
+func (s CmdDeciderSettings) validate() error {
+	if err := validateInputFlags(s.InputFlags); err != nil {
+		return err
+	}
+
+	if id, err := strconv.Atoi(s.Program); s.Program != "" && (err != nil || id < 0) {
+		return fmt.Errorf("invalid program '%v': it must be the ID of a program like 1", s.Program)
+	}
+
+	if s.Threads < 0 {
+		return fmt.Errorf("threads must not be negative, got %v", s.Threads)
+	}
+
+	switch s.BitDepth {
+	case "", bitDepthPreserve, bitDepthForce8, bitDepthForce10:
+	default:
+		return fmt.Errorf("unknown bit_depth '%v'", s.BitDepth)
+	}
+
+	if s.ForceCFR && !frameRateRegex.MatchString(s.CFRFrameRate) {
+		return fmt.Errorf("invalid cfr_frame_rate '%v': it must be a number of frames per second like 25 or 24000/1001", s.CFRFrameRate)
+	}
+
+	for _, l := range append(append([]string{}, s.DefaultAudioLanguages...), s.DefaultSubtitleLanguages...) {
+		if strings.TrimSpace(l) == "" {
+			return fmt.Errorf("default track languages must not be empty")
+		}
+	}
+
+	for tier, codec := range s.ResolutionCodecs {
+		if !isResolutionTier(tier) {
+			return fmt.Errorf("unknown resolution tier '%v'", tier)
+		}
+
+		if _, err := s.ffmpegCodec(codec); err != nil {
+			return fmt.Errorf("invalid codec for resolution tier '%v': %v", tier, err)
+		}
+	}
+	return nil
+}
+
+// selectProgram returns the metadata of only the tracks of the program that is transcoded from the file, along with
+// that program. The metadata is returned as is, with a nil program, for files without several programs to choose from
+// and files without a program that has both video and audio. An error is returned if the file has programs, but not
+// the one that the Program setting asks for.
+func (s CmdDeciderSettings) selectProgram(m controller.FileMetadata) (controller.FileMetadata, *controller.Program, error) {
+	var program *controller.Program
+	if s.Program != "" {
+		if len(m.Programs) == 0 {
+			return m, nil, nil
+		}
+		id, _ := strconv.Atoi(s.Program)
+		for i := range m.Programs {
+			if m.Programs[i].ID == id {
+				program = &m.Programs[i]
+				break
+			}
+		}
+		if program == nil {
+			return m, nil, fmt.Errorf("the file doesn't have the program %v", id)
+		}
+	} else {
+		if len(m.Programs) < 2 {
+			return m, nil, nil
+		}
+		for i := range m.Programs {
+			if hasVideoAndAudio(m, m.Programs[i]) {
+				program = &m.Programs[i]
+				break
+			}
+		}
+		if program == nil {
+			return m, nil, nil
+		}
+	}
+
+	selected := m
+	selected.VideoTracks = make([]controller.VideoTrack, 0, len(m.VideoTracks))
+	for _, v := range m.VideoTracks {
+		if program.Contains(v.Index) {
+			selected.VideoTracks = append(selected.VideoTracks, v)
+		}
+	}
+	selected.AudioTracks = make([]controller.AudioTrack, 0, len(m.AudioTracks))
+	for _, a := range m.AudioTracks {
+		if program.Contains(a.Index) {
+			selected.AudioTracks = append(selected.AudioTracks, a)
+		}
+	}
+	selected.SubtitleTracks = make([]controller.SubtitleTrack, 0, len(m.SubtitleTracks))
+	for _, t := range m.SubtitleTracks {
+		if program.Contains(t.Index) {
+			selected.SubtitleTracks = append(selected.SubtitleTracks, t)
+		}
+	}
+	return selected, program, nil
+}
+
+// hasVideoAndAudio returns whether or not the program has both a video and an audio track of the file.
+func hasVideoAndAudio(m controller.FileMetadata, p controller.Program) bool {
+	var video, audio bool
+	for _, v := range m.VideoTracks {
+		video = video || p.Contains(v.Index)
+	}
+	for _, a := range m.AudioTracks {
+		audio = audio || p.Contains(a.Index)
+	}
+	return video && audio
+}
+
+// targetCodecFor returns the target codec for the resolution of the provided video track.
+func (s CmdDeciderSettings) targetCodecFor(v controller.VideoTrack) string {
+	if codec, ok := s.ResolutionCodecs[resolutionTier(v.Width, v.Height)]; ok {
+		return codec
+	}
+	return s.TargetVideoCodec
+}
+
+// targetBitDepthFor returns the bit depth that the provided video track should be encoded with.
+// 0 is returned if there is no policy or if the policy is to preserve a bit depth that isn't known.
+func (s CmdDeciderSettings) targetBitDepthFor(v controller.VideoTrack) int {
+	switch s.BitDepth {
+	case bitDepthPreserve:
+		return v.BitDepth
+	case bitDepthForce8:
+		return 8
+	case bitDepthForce10:
+		return 10
+	}
+	return 0
+}
+
+// ffmpegCodec returns the FFMpeg encoder to use for the provided target codec.
+// When hardware encoding is enabled, the encoder is chosen from the same acceleration path as HardwareCodec,
+// unless the target is TargetVideoCodec, in which case HardwareCodec itself is used.
+func (s CmdDeciderSettings) ffmpegCodec(targetCodec string) (string, error) {
+	if !s.UseHardware {
+		param, ok := codecParams[targetCodec]
+		if !ok {
+			return "", fmt.Errorf("couldn't identify ffmpeg parameter for '%v' target codec", targetCodec)
+		}
+		return param, nil
+	}
+
+	if targetCodec == s.TargetVideoCodec {
+		return s.HardwareCodec, nil
+	}
+
+	hwPath := s.HardwareCodec[strings.LastIndex(s.HardwareCodec, "_")+1:]
+	encoders, ok := hardwareCodecParams[hwPath]
+	if !ok {
+		return "", fmt.Errorf("couldn't identify hardware acceleration path of '%v'", s.HardwareCodec)
+	}
+
+	param, ok := encoders[targetCodec]
+	if !ok {
+		return "", fmt.Errorf("'%v' target codec is not supported by %v", targetCodec, hwPath)
+	}
+	return param, nil
+}
+
+// hasBitDepth returns whether or not the provided video track is already at the target bit depth.
+// A track of unknown depth is assumed to match so that files aren't transcoded only because the metadata was incomplete.
+func hasBitDepth(v controller.VideoTrack, bitDepth int) bool {
+	return bitDepth == 0 || v.BitDepth == 0 || v.BitDepth == bitDepth
+}
+
+// pixelFormat returns the FFMpeg pixel format for the provided bit depth, or an empty string if there isn't one.
+func pixelFormat(bitDepth int, useHW bool) string {
+	f, ok := pixelFormats[bitDepth]
+	if !ok {
+		return ""
+	}
+	if useHW {
+		return f.hardware
+	}
+	return f.software
+}
+
+// resolutionTier returns the name of the resolution tier that the provided dimensions belong to.
+func resolutionTier(width, height int) string {
+	for _, t := range resolutionTiers {
+		if width >= t.minWidth || height >= t.minHeight {
+			return t.name
+		}
+	}
+	return resolutionTiers[len(resolutionTiers)-1].name
+}
+
+// isResolutionTier returns whether or not the provided name is a known resolution tier.
+func isResolutionTier(name string) bool {
+	for _, t := range resolutionTiers {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
 }
 
 // genFFmpegCmd creates the correct ffmpeg arguments for the input/output filenames and the job parameters.
@@ -101,3 +451,133 @@ func genFFmpegCmd(stereo, encode bool, codec string, useHW bool, hwDevice string
 
 	return s
 }
+
+// validateInputFlags returns an error if the input flags add an input, refer to the files of a job, or have an argument
+// which isn't the value of an option, which FFMpeg would take as an output path.
+func validateInputFlags(flags []string) error {
+	for i, f := range flags {
+		switch {
+		case f == "-i":
+			return fmt.Errorf("input_flags must not contain -i")
+		case strings.Contains(f, "ENCODARR_"):
+			return fmt.Errorf("input_flags must not refer to the files of the job, got '%v'", f)
+		case strings.HasPrefix(f, "-"):
+			continue
+		case i == 0 || !strings.HasPrefix(flags[i-1], "-"):
+			// Every option takes at most one value, so an argument which doesn't follow an option is an output path
+			return fmt.Errorf("input_flags must only contain options and their values, got the output path '%v'", f)
+		}
+	}
+	return nil
+}
+
+// withInputFlags returns cmd with the input flags inserted right before the input file, so that they apply to it.
+func withInputFlags(cmd, flags []string) []string {
+	if len(flags) == 0 {
+		return cmd
+	}
+	for i := 0; i+1 < len(cmd); i++ {
+		if cmd[i] == "-i" && cmd[i+1] == "ENCODARR_INPUT_FILE" {
+			s := make([]string, 0, len(cmd)+len(flags))
+			s = append(s, cmd[:i]...)
+			s = append(s, flags...)
+			return append(s, cmd[i:]...)
+		}
+	}
+	return cmd
+}
+
+// withProgram returns cmd with the streams that it maps from the input file limited to the program with the provided ID
+// (ex. -map 0:a becomes -map 0:p:4:a).
+func withProgram(cmd []string, id int) []string {
+	s := make([]string, len(cmd))
+	copy(s, cmd)
+	for i := 0; i+1 < len(s); i++ {
+		if s[i] == "-map" && strings.HasPrefix(s[i+1], "0:") {
+			s[i+1] = fmt.Sprintf("0:p:%v:%v", id, strings.TrimPrefix(s[i+1], "0:"))
+		}
+	}
+	return s
+}
+
+// captionExtractionArgs reads the closed captions out of the video stream of a second copy of the input
+// and writes them to ENCODARR_CAPTIONS_FILE, which the Runner sends back along with the transcoded file.
+// The Runner replaces ENCODARR_INPUT_FILE inside of the movie filter with an escaped version of the input path.
+var captionExtractionArgs = []string{"-f", "lavfi", "-i", "movie=ENCODARR_INPUT_FILE[out0+subcc]", "-map", "1:s", "-c:s", "srt", "ENCODARR_CAPTIONS_FILE"}
+
+// withCaptionExtraction returns cmd with the caption extraction inserted after the input file.
+// The extraction is its own output, so it has to come before any of the options for the transcoded file.
+func withCaptionExtraction(cmd []string) []string {
+	for i := 0; i+1 < len(cmd); i++ {
+		if cmd[i] == "-i" && cmd[i+1] == "ENCODARR_INPUT_FILE" {
+			s := make([]string, 0, len(cmd)+len(captionExtractionArgs))
+			s = append(s, cmd[:i+2]...)
+			s = append(s, captionExtractionArgs...)
+			return append(s, cmd[i+2:]...)
+		}
+	}
+	return cmd
+}
+
+// languageAliases maps the ISO 639-2 codes of common languages, which ffprobe reports, to the ISO 639-1 codes that
+// MediaInfo reports, so that either can be used in the settings.
+var languageAliases = map[string]string{
+	"eng": "en", "fre": "fr", "fra": "fr", "ger": "de", "deu": "de", "spa": "es", "ita": "it", "por": "pt",
+	"dut": "nl", "nld": "nl", "swe": "sv", "nor": "no", "dan": "da", "fin": "fi", "pol": "pl", "rus": "ru",
+	"jpn": "ja", "kor": "ko", "chi": "zh", "zho": "zh", "hin": "hi", "ara": "ar", "tur": "tr",
+}
+
+// normalizeLanguage returns the lowercase ISO 639-1 code of a language if it is known, so that "eng", "en", and "en-US" match.
+func normalizeLanguage(l string) string {
+	l = strings.ToLower(strings.TrimSpace(l))
+	if i := strings.IndexAny(l, "-_"); i != -1 {
+		l = l[:i]
+	}
+	if alias, ok := languageAliases[l]; ok {
+		return alias
+	}
+	return l
+}
+
+// preferredTrack returns the position of the first of trackLanguages which is in the first of the preferred languages that
+// any track has, or -1 if none of the tracks are in a preferred language.
+func preferredTrack(trackLanguages, preferred []string) int {
+	for _, p := range preferred {
+		p = normalizeLanguage(p)
+		for i, l := range trackLanguages {
+			if l != "" && normalizeLanguage(l) == p {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// dispositionArgs returns the FFMpeg arguments which make the tracks in the preferred languages the default ones
+// and clear the default disposition of the other tracks of the same type. The dispositions of a type are left unchanged
+// if none of its tracks are in a preferred language. stereo is whether the command creates a stereo track, in which case the
+// copies of the original audio tracks come after the stereo ones.
+func dispositionArgs(m controller.FileMetadata, settings CmdDeciderSettings, stereo bool) []string {
+	var args []string
+
+	audioLanguages := make([]string, len(m.AudioTracks))
+	for i, a := range m.AudioTracks {
+		audioLanguages[i] = a.Language
+	}
+	if i := preferredTrack(audioLanguages, settings.DefaultAudioLanguages); i != -1 {
+		if stereo {
+			i += len(m.AudioTracks)
+		}
+		args = append(args, "-disposition:a", "0", fmt.Sprintf("-disposition:a:%v", i), "default")
+	}
+
+	subtitleLanguages := make([]string, len(m.SubtitleTracks))
+	for i, s := range m.SubtitleTracks {
+		subtitleLanguages[i] = s.Language
+	}
+	if i := preferredTrack(subtitleLanguages, settings.DefaultSubtitleLanguages); i != -1 {
+		args = append(args, "-disposition:s", "0", fmt.Sprintf("-disposition:s:%v", i), "default")
+	}
+
+	return args
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+
+	"github.com/BrenekH/encodarr/controller"
 )
 
-// TODO: Test CmdDecider.Decide
+// TODO: Test the rest of CmdDecider.Decide
 
 func TestGenFFmpegCmd(t *testing.T) {
 	tests := []struct {
@@ -59,6 +61,711 @@ func TestGenFFmpegCmd(t *testing.T) {
 	}
 }
 
+func TestDecideResolutionCodec(t *testing.T) {
+	sd := controller.VideoTrack{Codec: "AVC", Width: 720, Height: 480}
+	uhd := controller.VideoTrack{Codec: "AVC", Width: 3840, Height: 2160}
+	letterboxedUHD := controller.VideoTrack{Codec: "AVC", Width: 3840, Height: 1600}
+
+	tests := []struct {
+		name          string
+		settings      string
+		track         controller.VideoTrack
+		expectedCodec string
+	}{
+		{
+			name:          "SD uses mapped codec",
+			settings:      `{"target_video_codec": "HEVC", "resolution_codecs": {"SD": "AV1", "4K": "HEVC"}}`,
+			track:         sd,
+			expectedCodec: "libsvtav1",
+		},
+		{
+			name:          "4K uses mapped codec",
+			settings:      `{"target_video_codec": "AVC", "resolution_codecs": {"SD": "AV1", "4K": "HEVC"}}`,
+			track:         uhd,
+			expectedCodec: "hevc",
+		},
+		{
+			name:          "Letterboxed 4K is recognized by width",
+			settings:      `{"target_video_codec": "AVC", "resolution_codecs": {"SD": "AV1", "4K": "HEVC"}}`,
+			track:         letterboxedUHD,
+			expectedCodec: "hevc",
+		},
+		{
+			name:          "Unmapped tier falls back to target codec",
+			settings:      `{"target_video_codec": "VP9", "resolution_codecs": {"SD": "AV1"}}`,
+			track:         uhd,
+			expectedCodec: "libvpx-vp9",
+		},
+		{
+			name:          "SD uses hardware encoder from the same path",
+			settings:      `{"target_video_codec": "HEVC", "resolution_codecs": {"SD": "AV1", "4K": "HEVC"}, "use_hardware": true, "hardware_codec": "hevc_vaapi"}`,
+			track:         sd,
+			expectedCodec: "av1_vaapi",
+		},
+		{
+			name:          "4K uses configured hardware codec",
+			settings:      `{"target_video_codec": "HEVC", "resolution_codecs": {"SD": "AV1", "4K": "HEVC"}, "use_hardware": true, "hardware_codec": "hevc_vaapi"}`,
+			track:         uhd,
+			expectedCodec: "hevc_vaapi",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(&mockLogger{})
+			cmd, err := c.Decide(controller.FileMetadata{VideoTracks: []controller.VideoTrack{test.track}}, test.settings)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if codec := cmd[len(cmd)-1]; codec != test.expectedCodec {
+				t.Errorf("expected %v but got %v", test.expectedCodec, codec)
+			}
+		})
+	}
+}
+
+func TestTargetVideoCodec(t *testing.T) {
+	settings := `{"target_video_codec": "HEVC", "resolution_codecs": {"SD": "AV1"}}`
+
+	tests := []struct {
+		name          string
+		metadata      controller.FileMetadata
+		expectedCodec string
+	}{
+		{name: "Target codec", metadata: controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080}}}, expectedCodec: "HEVC"},
+		{name: "Mapped codec", metadata: controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 720, Height: 480}}}, expectedCodec: "AV1"},
+		{name: "No video", metadata: controller.FileMetadata{AudioTracks: []controller.AudioTrack{{Channels: 6}}}, expectedCodec: ""},
+		{
+			name: "Selected program",
+			metadata: controller.FileMetadata{
+				VideoTracks: []controller.VideoTrack{{Index: 0, Codec: "MPEG Video", Width: 720, Height: 480}, {Index: 1, Codec: "AVC", Width: 1920, Height: 1080}},
+				AudioTracks: []controller.AudioTrack{{Index: 2, Channels: 6}},
+				Programs:    []controller.Program{{ID: 3, StreamIndexes: []int{0}}, {ID: 4, StreamIndexes: []int{1, 2}}},
+			},
+			expectedCodec: "HEVC",
+		},
+	}
+
+	c := New(&mockLogger{})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			codec, err := c.TargetVideoCodec(test.metadata, settings)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if codec != test.expectedCodec {
+				t.Errorf("expected %q but got %q", test.expectedCodec, codec)
+			}
+		})
+	}
+}
+
+func TestDecideSkipsResolutionAlreadyInMappedCodec(t *testing.T) {
+	c := New(&mockLogger{})
+	m := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AV1", Width: 720, Height: 480}}}
+
+	if _, err := c.Decide(m, `{"target_video_codec": "HEVC", "resolution_codecs": {"SD": "AV1"}}`); err == nil {
+		t.Errorf("expected SD file already in AV1 to not need a command")
+	}
+}
+
+func TestDecideThreads(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		expected []string
+	}{
+		{name: "Auto", settings: `{"target_video_codec": "HEVC", "threads": 0}`, expected: nil},
+		{name: "Not set", settings: `{"target_video_codec": "HEVC"}`, expected: nil},
+		{name: "Capped", settings: `{"target_video_codec": "HEVC", "threads": 4}`, expected: []string{"-threads", "4"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(&mockLogger{})
+			cmd, err := c.Decide(controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080}}}, test.settings)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var threads []string
+			for i, arg := range cmd {
+				if arg == "-threads" && i+1 < len(cmd) {
+					threads = cmd[i : i+2]
+				}
+			}
+			if !reflect.DeepEqual(threads, test.expected) {
+				t.Errorf("expected %v but got %v in %v", test.expected, threads, cmd)
+			}
+		})
+	}
+}
+
+func TestDecideBitDepth(t *testing.T) {
+	eightBit := controller.VideoTrack{Codec: "AVC", Width: 1920, Height: 1080, BitDepth: 8}
+	tenBit := controller.VideoTrack{Codec: "AVC", Width: 1920, Height: 1080, BitDepth: 10}
+	unknown := controller.VideoTrack{Codec: "AVC", Width: 1920, Height: 1080}
+
+	tests := []struct {
+		name     string
+		track    controller.VideoTrack
+		settings string
+		expected []string
+	}{
+		{name: "8-bit No Policy", track: eightBit, settings: `{"target_video_codec": "HEVC"}`, expected: nil},
+		{name: "8-bit Preserve", track: eightBit, settings: `{"target_video_codec": "HEVC", "bit_depth": "preserve"}`, expected: []string{"-pix_fmt", "yuv420p"}},
+		{name: "8-bit Force 8", track: eightBit, settings: `{"target_video_codec": "HEVC", "bit_depth": "force8"}`, expected: []string{"-pix_fmt", "yuv420p"}},
+		{name: "8-bit Force 10", track: eightBit, settings: `{"target_video_codec": "HEVC", "bit_depth": "force10"}`, expected: []string{"-pix_fmt", "yuv420p10le"}},
+		{name: "10-bit No Policy", track: tenBit, settings: `{"target_video_codec": "HEVC"}`, expected: nil},
+		{name: "10-bit Preserve", track: tenBit, settings: `{"target_video_codec": "HEVC", "bit_depth": "preserve"}`, expected: []string{"-pix_fmt", "yuv420p10le"}},
+		{name: "10-bit Force 8", track: tenBit, settings: `{"target_video_codec": "HEVC", "bit_depth": "force8"}`, expected: []string{"-pix_fmt", "yuv420p"}},
+		{name: "10-bit Force 10", track: tenBit, settings: `{"target_video_codec": "HEVC", "bit_depth": "force10"}`, expected: []string{"-pix_fmt", "yuv420p10le"}},
+		{name: "10-bit Preserve Hardware", track: tenBit, settings: `{"target_video_codec": "HEVC", "bit_depth": "preserve", "use_hardware": true, "hardware_codec": "hevc_vaapi"}`, expected: []string{"-pix_fmt", "p010le"}},
+		{name: "8-bit Force 8 Hardware", track: eightBit, settings: `{"target_video_codec": "HEVC", "bit_depth": "force8", "use_hardware": true, "hardware_codec": "hevc_vaapi"}`, expected: []string{"-pix_fmt", "nv12"}},
+		{name: "Unknown Preserve", track: unknown, settings: `{"target_video_codec": "HEVC", "bit_depth": "preserve"}`, expected: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(&mockLogger{})
+			cmd, err := c.Decide(controller.FileMetadata{VideoTracks: []controller.VideoTrack{test.track}}, test.settings)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var pixFmt []string
+			for i, arg := range cmd {
+				if arg == "-pix_fmt" && i+1 < len(cmd) {
+					pixFmt = cmd[i : i+2]
+				}
+			}
+			if !reflect.DeepEqual(pixFmt, test.expected) {
+				t.Errorf("expected %v but got %v in %v", test.expected, pixFmt, cmd)
+			}
+		})
+	}
+}
+
+func TestDecideBitDepthOfTargetCodec(t *testing.T) {
+	tests := []struct {
+		name       string
+		bitDepth   int
+		settings   string
+		expectSkip bool
+	}{
+		{name: "8-bit Preserve", bitDepth: 8, settings: `{"target_video_codec": "HEVC", "bit_depth": "preserve"}`, expectSkip: true},
+		{name: "8-bit Force 8", bitDepth: 8, settings: `{"target_video_codec": "HEVC", "bit_depth": "force8"}`, expectSkip: true},
+		{name: "8-bit Force 10", bitDepth: 8, settings: `{"target_video_codec": "HEVC", "bit_depth": "force10"}`, expectSkip: false},
+		{name: "10-bit Preserve", bitDepth: 10, settings: `{"target_video_codec": "HEVC", "bit_depth": "preserve"}`, expectSkip: true},
+		{name: "10-bit Force 8", bitDepth: 10, settings: `{"target_video_codec": "HEVC", "bit_depth": "force8"}`, expectSkip: false},
+		{name: "10-bit Force 10", bitDepth: 10, settings: `{"target_video_codec": "HEVC", "bit_depth": "force10"}`, expectSkip: true},
+		{name: "Unknown Force 10", bitDepth: 0, settings: `{"target_video_codec": "HEVC", "bit_depth": "force10"}`, expectSkip: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(&mockLogger{})
+			track := controller.VideoTrack{Codec: "HEVC", Width: 1920, Height: 1080, BitDepth: test.bitDepth}
+			_, err := c.Decide(controller.FileMetadata{VideoTracks: []controller.VideoTrack{track}}, test.settings)
+			if (err != nil) != test.expectSkip {
+				t.Errorf("expected skip to be %v but got error %v", test.expectSkip, err)
+			}
+		})
+	}
+}
+
+func TestDecideExtractCaptions(t *testing.T) {
+	captioned := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080}}, ClosedCaptions: true}
+	plain := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080}}}
+
+	tests := []struct {
+		name     string
+		metadata controller.FileMetadata
+		settings string
+		expected []string
+	}{
+		{
+			name:     "Captions extracted",
+			metadata: captioned,
+			settings: `{"target_video_codec": "HEVC", "extract_captions": true}`,
+			expected: []string{"-i", "ENCODARR_INPUT_FILE", "-f", "lavfi", "-i", "movie=ENCODARR_INPUT_FILE[out0+subcc]", "-map", "1:s", "-c:s", "srt", "ENCODARR_CAPTIONS_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"},
+		},
+		{
+			name:     "No captions in file",
+			metadata: plain,
+			settings: `{"target_video_codec": "HEVC", "extract_captions": true}`,
+			expected: []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"},
+		},
+		{
+			name:     "Extraction disabled",
+			metadata: captioned,
+			settings: `{"target_video_codec": "HEVC"}`,
+			expected: []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"},
+		},
+		{
+			name:     "Extracted after hardware device",
+			metadata: captioned,
+			settings: `{"target_video_codec": "HEVC", "use_hardware": true, "hardware_codec": "hevc_vaapi", "hw_device": "/dev/dri/renderD128", "extract_captions": true}`,
+			expected: []string{"-hwaccel_device", "/dev/dri/renderD128", "-i", "ENCODARR_INPUT_FILE", "-f", "lavfi", "-i", "movie=ENCODARR_INPUT_FILE[out0+subcc]", "-map", "1:s", "-c:s", "srt", "ENCODARR_CAPTIONS_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc_vaapi"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(&mockLogger{})
+			cmd, err := c.Decide(test.metadata, test.settings)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(cmd, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, cmd)
+			}
+		})
+	}
+}
+
+func TestDecideInputFlags(t *testing.T) {
+	captioned := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080}}, ClosedCaptions: true}
+
+	tests := []struct {
+		name     string
+		settings string
+		expected []string
+	}{
+		{
+			name:     "Before the input",
+			settings: `{"target_video_codec": "HEVC", "input_flags": ["-analyzeduration", "200M", "-probesize", "1G"]}`,
+			expected: []string{"-analyzeduration", "200M", "-probesize", "1G", "-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"},
+		},
+		{
+			name:     "After hardware device and not before the captions",
+			settings: `{"target_video_codec": "HEVC", "use_hardware": true, "hardware_codec": "hevc_vaapi", "hw_device": "/dev/dri/renderD128", "extract_captions": true, "input_flags": ["-probesize", "1G"]}`,
+			expected: []string{"-hwaccel_device", "/dev/dri/renderD128", "-probesize", "1G", "-i", "ENCODARR_INPUT_FILE", "-f", "lavfi", "-i", "movie=ENCODARR_INPUT_FILE[out0+subcc]", "-map", "1:s", "-c:s", "srt", "ENCODARR_CAPTIONS_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc_vaapi"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(&mockLogger{})
+			cmd, err := c.Decide(captioned, test.settings)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(cmd, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, cmd)
+			}
+		})
+	}
+}
+
+func TestDecideProgram(t *testing.T) {
+	// A DVR capture whose first program is a video-only data service
+	multiProgram := controller.FileMetadata{
+		VideoTracks: []controller.VideoTrack{{Index: 0, Codec: "MPEG Video", Width: 720, Height: 480}, {Index: 1, Codec: "AVC", Width: 1920, Height: 1080}, {Index: 4, Codec: "AVC", Width: 1280, Height: 720}},
+		AudioTracks: []controller.AudioTrack{{Index: 2, Channels: 6}, {Index: 3, Channels: 2}, {Index: 5, Channels: 6}},
+		Programs: []controller.Program{
+			{ID: 3, StreamIndexes: []int{0}},
+			{ID: 4, StreamIndexes: []int{1, 2, 3}},
+			{ID: 5, StreamIndexes: []int{4, 5}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		metadata  controller.FileMetadata
+		settings  string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name:     "First program with video and audio",
+			metadata: multiProgram,
+			settings: `{"target_video_codec": "HEVC", "create_stereo_audio": true}`,
+			expected: []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:p:4:s?", "-map", "0:p:4:a", "-c", "copy", "-map", "0:p:4:v", "-vcodec", "hevc"},
+		},
+		{
+			name:     "Program ID",
+			metadata: multiProgram,
+			settings: `{"target_video_codec": "HEVC", "create_stereo_audio": true, "program": "5"}`,
+			expected: []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:p:5:v", "-map", "0:p:5:s?", "-map", "0:p:5:a", "-map", "0:p:5:a", "-c:v", "hevc", "-c:s", "copy", "-c:a:1", "copy", "-c:a:0", "aac", "-filter:a:0", "pan=stereo|FL=0.5*FC+0.707*FL+0.707*BL+0.5*LFE|FR=0.5*FC+0.707*FR+0.707*BR+0.5*LFE"},
+		},
+		{
+			name:      "Program ID already matching",
+			metadata:  multiProgram,
+			settings:  `{"target_video_codec": "AVC", "program": "4"}`,
+			expectErr: true,
+		},
+		{
+			name:      "Missing program ID",
+			metadata:  multiProgram,
+			settings:  `{"target_video_codec": "HEVC", "program": "7"}`,
+			expectErr: true,
+		},
+		{
+			name:     "Program ID of a file without programs",
+			metadata: controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC"}}},
+			settings: `{"target_video_codec": "HEVC", "program": "4"}`,
+			expected: []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(&mockLogger{})
+			cmd, err := c.Decide(test.metadata, test.settings)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("expected error to be %v but got %v", test.expectErr, err)
+			}
+
+			if !test.expectErr && !reflect.DeepEqual(cmd, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, cmd)
+			}
+		})
+	}
+}
+
+func TestDecidePreserveChapters(t *testing.T) {
+	chaptered := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080}}, Chapters: true}
+	plain := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080}}}
+
+	tests := []struct {
+		name     string
+		metadata controller.FileMetadata
+		settings string
+		expected []string
+	}{
+		{
+			name:     "Chapters preserved",
+			metadata: chaptered,
+			settings: `{"target_video_codec": "HEVC", "preserve_chapters": true}`,
+			expected: []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc", "-map_chapters", "0"},
+		},
+		{
+			name:     "No chapters in file",
+			metadata: plain,
+			settings: `{"target_video_codec": "HEVC", "preserve_chapters": true}`,
+			expected: []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"},
+		},
+		{
+			name:     "Preserving disabled",
+			metadata: chaptered,
+			settings: `{"target_video_codec": "HEVC"}`,
+			expected: []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"},
+		},
+		{
+			name:     "Preserved for the transcoded file when captions are extracted",
+			metadata: controller.FileMetadata{VideoTracks: chaptered.VideoTracks, Chapters: true, ClosedCaptions: true},
+			settings: `{"target_video_codec": "HEVC", "preserve_chapters": true, "extract_captions": true}`,
+			expected: []string{"-i", "ENCODARR_INPUT_FILE", "-f", "lavfi", "-i", "movie=ENCODARR_INPUT_FILE[out0+subcc]", "-map", "1:s", "-c:s", "srt", "ENCODARR_CAPTIONS_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc", "-map_chapters", "0"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(&mockLogger{})
+			cmd, err := c.Decide(test.metadata, test.settings)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(cmd, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, cmd)
+			}
+		})
+	}
+}
+
+func TestDecideDefaultTrackLanguage(t *testing.T) {
+	video := []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080}}
+	multilingual := controller.FileMetadata{
+		VideoTracks:    video,
+		AudioTracks:    []controller.AudioTrack{{Index: 1, Channels: 6, Language: "jpn"}, {Index: 2, Channels: 2, Language: "eng"}},
+		SubtitleTracks: []controller.SubtitleTrack{{Index: 3, Language: "en"}, {Index: 4, Language: "es"}},
+	}
+	transcode := []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"}
+
+	tests := []struct {
+		name     string
+		metadata controller.FileMetadata
+		settings string
+		expected []string
+	}{
+		{
+			name:     "Preferred languages present",
+			metadata: multilingual,
+			settings: `{"target_video_codec": "HEVC", "default_audio_languages": ["en"], "default_subtitle_languages": ["spa", "eng"]}`,
+			expected: append(append([]string{}, transcode...), "-disposition:a", "0", "-disposition:a:1", "default", "-disposition:s", "0", "-disposition:s:1", "default"),
+		},
+		{
+			name:     "Second preference",
+			metadata: multilingual,
+			settings: `{"target_video_codec": "HEVC", "default_audio_languages": ["fre", "ja"]}`,
+			expected: append(append([]string{}, transcode...), "-disposition:a", "0", "-disposition:a:0", "default"),
+		},
+		{
+			name:     "Preferred language absent",
+			metadata: multilingual,
+			settings: `{"target_video_codec": "HEVC", "default_audio_languages": ["ger"], "default_subtitle_languages": ["fr"]}`,
+			expected: transcode,
+		},
+		{
+			name:     "Untagged tracks",
+			metadata: controller.FileMetadata{VideoTracks: video, AudioTracks: []controller.AudioTrack{{Index: 1, Channels: 2}}},
+			settings: `{"target_video_codec": "HEVC", "default_audio_languages": ["eng"]}`,
+			expected: transcode,
+		},
+		{
+			name:     "Copy after the stereo track",
+			metadata: controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "HEVC"}}, AudioTracks: []controller.AudioTrack{{Index: 1, Channels: 6, Language: "jpn"}, {Index: 2, Channels: 6, Language: "eng"}}},
+			settings: `{"target_video_codec": "HEVC", "create_stereo_audio": true, "default_audio_languages": ["eng"]}`,
+			expected: []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:v", "-map", "0:s?", "-map", "0:a", "-map", "0:a", "-c:v", "copy", "-c:s", "copy", "-c:a:1", "copy", "-c:a:0", "aac", "-filter:a:0", "pan=stereo|FL=0.5*FC+0.707*FL+0.707*BL+0.5*LFE|FR=0.5*FC+0.707*FR+0.707*BR+0.5*LFE", "-disposition:a", "0", "-disposition:a:3", "default"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(&mockLogger{})
+			cmd, err := c.Decide(test.metadata, test.settings)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(cmd, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, cmd)
+			}
+		})
+	}
+}
+
+func TestDecideForceCFR(t *testing.T) {
+	vfr := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080, VariableFrameRate: true}}}
+	cfr := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080}}}
+	transcode := []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"}
+
+	tests := []struct {
+		name     string
+		metadata controller.FileMetadata
+		settings string
+		expected []string
+	}{
+		{
+			name:     "VFR forced to CFR",
+			metadata: vfr,
+			settings: `{"target_video_codec": "HEVC", "force_cfr": true, "cfr_frame_rate": "24000/1001"}`,
+			expected: append(append([]string{}, transcode...), "-vsync", "cfr", "-r", "24000/1001"),
+		},
+		{
+			name:     "CFR left alone",
+			metadata: cfr,
+			settings: `{"target_video_codec": "HEVC", "force_cfr": true, "cfr_frame_rate": "24000/1001"}`,
+			expected: transcode,
+		},
+		{
+			name:     "Forcing disabled",
+			metadata: vfr,
+			settings: `{"target_video_codec": "HEVC"}`,
+			expected: transcode,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New(&mockLogger{})
+			cmd, err := c.Decide(test.metadata, test.settings)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(cmd, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, cmd)
+			}
+		})
+	}
+
+	// VFR alone doesn't make a file that is already in the target codec get transcoded
+	c := New(&mockLogger{})
+	hevcVFR := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "HEVC", Width: 1920, Height: 1080, VariableFrameRate: true}}}
+	if _, err := c.Decide(hevcVFR, `{"target_video_codec": "HEVC", "force_cfr": true, "cfr_frame_rate": "25"}`); err == nil {
+		t.Errorf("expected a VFR file in the target codec to be skipped")
+	}
+}
+
+func TestValidateSettings(t *testing.T) {
+	tests := []struct {
+		name      string
+		settings  CmdDeciderSettings
+		expectErr bool
+	}{
+		{
+			name:     "Software codecs",
+			settings: CmdDeciderSettings{TargetVideoCodec: "HEVC", ResolutionCodecs: map[string]string{"SD": "AV1", "4K": "HEVC"}},
+		},
+		{
+			name:      "Unknown resolution tier",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", ResolutionCodecs: map[string]string{"8K": "AV1"}},
+			expectErr: true,
+		},
+		{
+			name:      "Unknown software codec",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", ResolutionCodecs: map[string]string{"SD": "MPEG2"}},
+			expectErr: true,
+		},
+		{
+			name:     "Codec supported by hardware path",
+			settings: CmdDeciderSettings{TargetVideoCodec: "HEVC", ResolutionCodecs: map[string]string{"SD": "AV1"}, UseHardware: true, HardwareCodec: "hevc_nvenc"},
+		},
+		{
+			name:      "Codec not supported by hardware path",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", ResolutionCodecs: map[string]string{"SD": "VP9"}, UseHardware: true, HardwareCodec: "hevc_nvenc"},
+			expectErr: true,
+		},
+		{
+			name:      "Unknown hardware path",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", ResolutionCodecs: map[string]string{"SD": "AV1"}, UseHardware: true, HardwareCodec: "hevc_custom"},
+			expectErr: true,
+		},
+		{
+			name:     "Thread count",
+			settings: CmdDeciderSettings{TargetVideoCodec: "HEVC", Threads: 4},
+		},
+		{
+			name:      "Negative thread count",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", Threads: -1},
+			expectErr: true,
+		},
+		{
+			name:     "Bit depth policy",
+			settings: CmdDeciderSettings{TargetVideoCodec: "HEVC", BitDepth: "force10"},
+		},
+		{
+			name:      "Unknown bit depth policy",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", BitDepth: "force12"},
+			expectErr: true,
+		},
+		{
+			name:     "Forced CFR",
+			settings: CmdDeciderSettings{TargetVideoCodec: "HEVC", ForceCFR: true, CFRFrameRate: "29.97"},
+		},
+		{
+			name:      "Forced CFR without a frame rate",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", ForceCFR: true},
+			expectErr: true,
+		},
+		{
+			name:      "Forced CFR with an invalid frame rate",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", ForceCFR: true, CFRFrameRate: "24000/0"},
+			expectErr: true,
+		},
+		{
+			name:      "Empty default track language",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", DefaultAudioLanguages: []string{"eng", ""}},
+			expectErr: true,
+		},
+		{
+			name:     "Input flags",
+			settings: CmdDeciderSettings{TargetVideoCodec: "HEVC", InputFlags: []string{"-analyzeduration", "200M", "-probesize", "1G", "-itsoffset", "-0.5", "-re"}},
+		},
+		{
+			name:      "Input flags with an input",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", InputFlags: []string{"-i", "/media/other.mkv"}},
+			expectErr: true,
+		},
+		{
+			name:      "Input flags with an output path",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", InputFlags: []string{"-probesize", "1G", "/media/out.mkv"}},
+			expectErr: true,
+		},
+		{
+			name:      "Input flags starting with an output path",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", InputFlags: []string{"/media/out.mkv"}},
+			expectErr: true,
+		},
+		{
+			name:      "Input flags with a placeholder",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", InputFlags: []string{"-f", "ENCODARR_INPUT_FILE"}},
+			expectErr: true,
+		},
+		{
+			name:     "Program ID",
+			settings: CmdDeciderSettings{TargetVideoCodec: "HEVC", Program: "4"},
+		},
+		{
+			name:      "Program which isn't an ID",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", Program: "news"},
+			expectErr: true,
+		},
+		{
+			name:      "Negative program ID",
+			settings:  CmdDeciderSettings{TargetVideoCodec: "HEVC", Program: "-1"},
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.settings.validate()
+			if (err != nil) != test.expectErr {
+				t.Errorf("expected error to be %v but got %v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestCmdDeciderValidateSettings(t *testing.T) {
+	c := New(&mockLogger{})
+
+	tests := []struct {
+		name      string
+		settings  string
+		expectErr bool
+	}{
+		{name: "Default settings", settings: c.DefaultSettings()},
+		{name: "Invalid JSON", settings: `{"target_video_codec": `, expectErr: true},
+		{name: "Unknown target codec", settings: `{"target_video_codec": "MPEG2"}`, expectErr: true},
+		{name: "Hardware without codec", settings: `{"target_video_codec": "HEVC", "use_hardware": true}`, expectErr: true},
+		{name: "Invalid resolution codec", settings: `{"target_video_codec": "HEVC", "resolution_codecs": {"SD": "MPEG2"}}`, expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := c.ValidateSettings(test.settings)
+			if (err != nil) != test.expectErr {
+				t.Errorf("expected error to be %v but got %v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	c := New(&mockLogger{})
+
+	tests := []struct {
+		name      string
+		settings  string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{name: "Default settings", settings: c.DefaultSettings(), expected: nil},
+		{name: "Annotations", settings: `{"target_video_codec": "HEVC", "annotations": {"source": "sonarr"}}`, expected: map[string]string{"source": "sonarr"}},
+		{name: "Invalid JSON", settings: `{"annotations": `, expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := c.Annotations(test.settings)
+			if (err != nil) != test.expectErr {
+				t.Errorf("expected error to be %v but got %v", test.expectErr, err)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, got)
+			}
+		})
+	}
+}
+
 type jobParameters struct {
 	Stereo   bool
 	Encode   bool
@@ -0,0 +1,53 @@
+package library
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// compactInterval is how often Start compacts the dispatched jobs.
+const compactInterval = time.Hour
+
+// CompactDispatched removes the dispatched jobs whose file no longer exists and whose lease isn't active, and returns
+// how many were removed. Such jobs can't be imported anymore, but would otherwise stay dispatched for as long as their
+// library only notifies about stale jobs. A job whose file can't be stated for another reason is kept.
+func (m *Manager) CompactDispatched() (int, error) {
+	dJobs, err := m.ds.DispatchedJobs(m.ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := m.now()
+	removed := 0
+	for _, dJob := range dJobs {
+		if dJob.LeaseExpires.After(now) {
+			continue
+		}
+		if _, err := m.fileStater.Stat(dJob.Job.Path); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		// The data storer checks the lease again, so a job whose lease was renewed since it was read is kept.
+		revoked, err := m.ds.RevokeLease(m.ctx, dJob.UUID, now)
+		if err != nil {
+			return removed, err
+		}
+		if revoked {
+			removed++
+			m.logger.Info("Removed dispatched job %v because %v no longer exists", dJob.UUID, dJob.Job.Path, dJob.Job.LogFields())
+		}
+	}
+	return removed, nil
+}
+
+// compactDispatched calls CompactDispatched and logs the outcome.
+func (m *Manager) compactDispatched() {
+	removed, err := m.CompactDispatched()
+	if err != nil {
+		m.logger.Error("error compacting the dispatched jobs: %v", err)
+	}
+	if removed > 0 {
+		m.logger.Info("Removed %v dispatched jobs whose files no longer exist", removed)
+	}
+}
@@ -0,0 +1,63 @@
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// companionSuffix is appended to the path of a video file to get the path of its companion file, whose settings
+// override the library's CommandDeciderSettings for just that file. For example, movie.mkv.encodarr.json.
+const companionSuffix = ".encodarr.json"
+
+// deciderSettings returns the CommandDeciderSettings to use for videoFilepath. These are the library's settings with
+// the ones from the file's companion file laid over them. A companion file which can't be read, isn't a JSON object,
+// or leads to invalid settings is logged and ignored.
+func (m *Manager) deciderSettings(lib controller.Library, videoFilepath string) string {
+	companionPath := videoFilepath + companionSuffix
+
+	b, err := m.fileReader.ReadFile(companionPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lib.CommandDeciderSettings
+	} else if err != nil {
+		m.logger.Warn("Ignoring companion file %v because of error: %v", companionPath, err)
+		return lib.CommandDeciderSettings
+	}
+
+	settings, err := overlaySettings(lib.CommandDeciderSettings, b)
+	if err != nil {
+		m.logger.Warn("Ignoring companion file %v because it isn't a JSON object: %v", companionPath, err)
+		return lib.CommandDeciderSettings
+	}
+
+	if err = m.commandDecider.ValidateSettings(settings); err != nil {
+		m.logger.Warn("Ignoring companion file %v because it results in invalid settings: %v", companionPath, err)
+		return lib.CommandDeciderSettings
+	}
+
+	m.logger.Trace("Using the settings from %v for %v", companionPath, videoFilepath)
+	return settings
+}
+
+// overlaySettings replaces the top-level keys of the JSON object base with the ones from override.
+func overlaySettings(base string, override []byte) (string, error) {
+	merged := make(map[string]json.RawMessage)
+	if base != "" {
+		if err := json.Unmarshal([]byte(base), &merged); err != nil {
+			return "", err
+		}
+	}
+
+	overrides := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(override, &overrides); err != nil {
+		return "", err
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+
+	b, err := json.Marshal(merged)
+	return string(b), err
+}
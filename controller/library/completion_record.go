@@ -0,0 +1,40 @@
+package library
+
+import (
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// completionRecord breaks down what dJob changed about its file, which had originalSize bytes before it was replaced
+// by a file of newSize bytes. output is what was read back from the transcoded file, if anything.
+func completionRecord(dJob controller.DispatchedJob, output *controller.OutputStats, originalSize, newSize int64) *controller.CompletionRecord {
+	record := controller.NewCompletionRecord(originalSize, newSize)
+
+	// The Runner reports its final elapsed time with the status update it sends before uploading the file
+	if elapsed, err := time.ParseDuration(dJob.Status.JobElapsedTime); err == nil {
+		record.Elapsed = elapsed
+	}
+
+	record.Encoder = videoEncoder(dJob.Job.Command)
+	if len(dJob.Job.Metadata.VideoTracks) > 0 {
+		record.SourceCodec = dJob.Job.Metadata.VideoTracks[0].Codec
+	}
+	if output != nil {
+		record.TargetCodec = output.VideoCodec
+	}
+
+	return &record
+}
+
+// videoEncoder returns the video encoder that the FFmpeg arguments in command select, or an empty string if they
+// don't select one. The last one wins, like it does for FFmpeg.
+func videoEncoder(command []string) (encoder string) {
+	for i := 0; i < len(command)-1; i++ {
+		switch command[i] {
+		case "-c:v", "-vcodec", "-codec:v":
+			encoder = command[i+1]
+		}
+	}
+	return
+}
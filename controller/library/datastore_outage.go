@@ -0,0 +1,153 @@
+package library
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// defaultDatastoreMaxBackoff is the longest that Start waits between attempts to reach the datastore during an outage.
+const defaultDatastoreMaxBackoff = time.Minute
+
+// defaultDatastoreBreakerThreshold is how many failed attempts in a row open the circuit breaker by default.
+const defaultDatastoreBreakerThreshold = 5
+
+// outageLogInterval is how often the failures of an ongoing datastore outage are logged, after the first one.
+const outageLogInterval = time.Minute
+
+// datastoreOutage tracks the failed attempts of Start to reach the datastore, so that Start can back off, the outage
+// is only logged every so often, and a circuit breaker can tell the rest of the Controller that the datastore is down.
+type datastoreOutage struct {
+	maxBackoff       time.Duration
+	breakerThreshold int // 0 never opens the breaker.
+
+	mu         sync.Mutex
+	failures   int
+	since      time.Time
+	lastErr    string
+	lastLogged time.Time
+	suppressed int // The failures since lastLogged which weren't logged.
+}
+
+// SetDatastoreOutagePolicy sets the longest that Start waits between attempts to reach the datastore during an outage,
+// and how many failed attempts in a row open the circuit breaker, which marks the datastore as down until it is reached
+// again. A breakerThreshold of 0 never opens the breaker. It must be called before Start.
+func (m *Manager) SetDatastoreOutagePolicy(maxBackoff time.Duration, breakerThreshold int) {
+	if maxBackoff < time.Second {
+		maxBackoff = time.Second
+	}
+	if breakerThreshold < 0 {
+		breakerThreshold = 0
+	}
+	m.outage.maxBackoff = maxBackoff
+	m.outage.breakerThreshold = breakerThreshold
+}
+
+// Health returns whether or not the datastore can be reached, going by the latest attempts of Start.
+func (m *Manager) Health() controller.DatastoreHealth {
+	o := m.outage
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return controller.DatastoreHealth{
+		Down:         o.breakerOpen(),
+		Failures:     o.failures,
+		FailingSince: o.since,
+		LastError:    o.lastErr,
+	}
+}
+
+// datastoreFailed records that Start failed to reach the datastore with err and returns how long Start waits before
+// trying again, which doubles with every failure in a row from a second up to the max backoff. The first failure
+// and the opening of the breaker are logged right away, and the failures after them at most every outageLogInterval.
+func (m *Manager) datastoreFailed(err error) time.Duration {
+	now := m.now()
+	o := m.outage
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.failures == 0 {
+		o.since = now
+	}
+	o.failures++
+	o.lastErr = err.Error()
+
+	switch {
+	case o.failures == 1:
+		m.logger.Error("Failed to reach the datastore, retrying with a backoff of up to %v: %v", o.maxBackoff, err)
+	case o.failures == o.breakerThreshold:
+		m.logger.Error("The datastore is down after %v failed attempts to reach it since %v: %v", o.failures, o.since.Format(time.RFC3339), err)
+	case now.Sub(o.lastLogged) >= outageLogInterval:
+		m.logger.Error("Still failing to reach the datastore after %v attempts since %v (%v not logged): %v", o.failures, o.since.Format(time.RFC3339), o.suppressed, err)
+	default:
+		o.suppressed++
+		return o.backoff()
+	}
+
+	o.lastLogged = now
+	o.suppressed = 0
+	return o.backoff()
+}
+
+// datastoreReached records that Start reached the datastore, which ends an outage and closes the breaker.
+func (m *Manager) datastoreReached() {
+	o := m.outage
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.failures == 0 {
+		return
+	}
+
+	m.logger.Info("The datastore is reachable again after %v and %v failed attempts", m.now().Sub(o.since).Round(time.Second), o.failures)
+	o.failures = 0
+	o.since = time.Time{}
+	o.lastErr = ""
+	o.suppressed = 0
+}
+
+// datastoreFailing returns whether or not the latest attempt of Start to reach the datastore failed. Errors from the
+// datastore aren't logged elsewhere while it is, because Start already logs the outage.
+func (m *Manager) datastoreFailing() bool {
+	m.outage.mu.Lock()
+	defer m.outage.mu.Unlock()
+	return m.outage.failures > 0
+}
+
+// datastoreDown returns whether or not the breaker is open, in which case the datastore isn't queried for new jobs.
+func (m *Manager) datastoreDown() bool {
+	m.outage.mu.Lock()
+	defer m.outage.mu.Unlock()
+	return m.outage.breakerOpen()
+}
+
+// breakerOpen returns whether or not there have been enough failures in a row to open the breaker.
+// The caller must hold the lock.
+func (o *datastoreOutage) breakerOpen() bool {
+	return o.breakerThreshold > 0 && o.failures >= o.breakerThreshold
+}
+
+// backoff returns how long to wait after the current number of failures in a row. The caller must hold the lock.
+func (o *datastoreOutage) backoff() time.Duration {
+	d := time.Second
+	for i := 1; i < o.failures && d < o.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > o.maxBackoff {
+		d = o.maxBackoff
+	}
+	return d
+}
+
+// waitOrDone waits for d to pass or for ctx to be done, whichever comes first.
+func waitOrDone(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
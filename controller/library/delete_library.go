@@ -0,0 +1,49 @@
+package library
+
+import (
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// DeleteLibrary deletes the library with the provided ID. A soft deleted library is left out of scans, dispatching,
+// and the settings, but it is kept along with its queue so that RestoreLibrary can bring it back until the deleted
+// library retention has passed and it is purged. Otherwise, the library is purged right away, which also works for a
+// library that was already soft deleted.
+func (m *Manager) DeleteLibrary(id int, soft bool) error {
+	if soft {
+		// Deleting a library which doesn't exist or is already deleted does nothing, so check for it first.
+		if _, err := m.ds.Library(m.ctx, id); err != nil {
+			return err
+		}
+	}
+
+	if err := m.ds.DeleteLibrary(m.ctx, id, time.Now()); err != nil {
+		return err
+	}
+	// A running scan would otherwise keep queueing jobs for the deleted library
+	m.CancelScan(id)
+
+	if soft {
+		m.logger.Info("Deleted Library (ID: %v), it can be restored for %v", id, m.deletedLibraryRetention)
+		return nil
+	}
+
+	lib, err := m.ds.PurgeDeletedLibrary(m.ctx, id)
+	if err != nil {
+		return err
+	}
+	m.forgetPurgedLibraries([]controller.Library{lib})
+	return nil
+}
+
+// RestoreLibrary brings back a soft deleted library which hasn't been purged yet, with its queue as it was when it
+// was deleted.
+func (m *Manager) RestoreLibrary(id int) error {
+	if err := m.ds.RestoreLibrary(m.ctx, id); err != nil {
+		return err
+	}
+
+	m.logger.Info("Restored Library (ID: %v)", id)
+	return nil
+}
@@ -0,0 +1,104 @@
+package library
+
+import (
+	"sort"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// dispatchPlanInterval is how often Start plans the order in which the queued jobs are dispatched.
+const dispatchPlanInterval = 5 * time.Second
+
+// maxPlannedPositions is how many of the queued jobs are given a position in the dispatch plan. Planning further
+// wouldn't tell the user much, and every position takes a pass over the queues with queue aging or smallest first.
+const maxPlannedPositions = 1000
+
+// jobDurationWeight is the weight of the latest completed job in the moving average of how long jobs take.
+const jobDurationWeight = 0.2
+
+// dispatchOrder returns the indexes of the libraries which PopNewJob may take a job from, in the order that it tries
+// them. Libraries are sorted by decreasing priority so that the libraries with the higher priority number dispatch
+// jobs first. With queue aging, a library's priority is that of its longest waiting job. Ties go to the library which
+// is listed first. Empty and drained libraries are left out.
+func (m *Manager) dispatchOrder(libs []controller.Library, now time.Time) []int {
+	order := make([]int, 0, len(libs))
+	priorities := make([]float64, len(libs))
+	for i, l := range libs {
+		if l.Queue.Empty() || m.LibraryDrained(l.ID) {
+			continue
+		}
+		priorities[i] = m.effectivePriority(l, now)
+		order = append(order, i)
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return priorities[order[a]] > priorities[order[b]]
+	})
+	return order
+}
+
+// planDispatch returns the position of each queued job in the order that PopNewJob would dispatch them as of now,
+// starting at 1. It pops copies of the queues the same way that PopNewJob does, except that the size a job was queued
+// with stands in for the size of its file so that planning doesn't stat every queued file.
+func (m *Manager) planDispatch(libs []controller.Library, now time.Time) map[controller.UUID]int {
+	queues := make([]controller.Library, len(libs))
+	for i, l := range libs {
+		l.Queue.Items = append([]controller.Job(nil), l.Queue.Items...)
+		queues[i] = l
+	}
+
+	positions := make(map[controller.UUID]int)
+	for len(positions) < maxPlannedPositions {
+		order := m.dispatchOrder(queues, now)
+		if len(order) == 0 {
+			break
+		}
+
+		job, found := m.popNext(&queues[order[0]].Queue, queuedSize)
+		if !found {
+			break
+		}
+		positions[job.UUID] = len(positions) + 1
+	}
+	return positions
+}
+
+// queuedSize is the jobSize that a job was queued with.
+func queuedSize(j controller.Job) (int64, error) {
+	return j.Size, nil
+}
+
+// setPlannedPositions replaces the positions of the queued jobs in the dispatch order.
+func (m *Manager) setPlannedPositions(positions map[controller.UUID]int) {
+	m.planMutex.Lock()
+	defer m.planMutex.Unlock()
+	m.plannedPositions = positions
+}
+
+// observeJobDuration adds how long a completed job took to the moving average of how long jobs take.
+// Zero, which is an unknown duration, is ignored.
+func (m *Manager) observeJobDuration(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	m.planMutex.Lock()
+	defer m.planMutex.Unlock()
+	if m.jobDuration == 0 {
+		m.jobDuration = d
+		return
+	}
+	m.jobDuration += time.Duration(jobDurationWeight * float64(d-m.jobDuration))
+}
+
+// DispatchPlan returns the latest plan of the order in which the queued jobs are dispatched, which Start refreshes
+// every few seconds, along with how long a job usually takes.
+func (m *Manager) DispatchPlan() controller.DispatchPlan {
+	m.planMutex.Lock()
+	plan := controller.DispatchPlan{Positions: m.plannedPositions, TypicalJobDuration: m.jobDuration}
+	m.planMutex.Unlock()
+
+	plan.Paused = !m.ProcessingEnabled() || m.budgetExhausted() || m.datastoreDown()
+	return plan
+}
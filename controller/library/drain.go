@@ -0,0 +1,43 @@
+package library
+
+// DrainLibrary stops PopNewJob from returning the jobs of the library with the provided ID. Unlike disabling
+// processing, the library is still scanned, its queue is kept, and its dispatched jobs are still imported when they
+// complete, so a library can be drained before its folder is taken away without losing any work.
+// Libraries are only drained until UndrainLibrary is called or the Controller restarts.
+func (m *Manager) DrainLibrary(id int) error {
+	if _, err := m.ds.Library(m.ctx, id); err != nil {
+		return err
+	}
+
+	m.drainMutex.Lock()
+	defer m.drainMutex.Unlock()
+	if _, ok := m.drained[id]; ok {
+		return nil
+	}
+	m.drained[id] = struct{}{}
+
+	m.logger.Info("Draining Library (ID: %v), none of its jobs will be dispatched", id)
+	return nil
+}
+
+// UndrainLibrary lets PopNewJob return the jobs of a library which was drained by DrainLibrary again.
+// Undraining a library which isn't drained does nothing.
+func (m *Manager) UndrainLibrary(id int) error {
+	m.drainMutex.Lock()
+	defer m.drainMutex.Unlock()
+	if _, ok := m.drained[id]; !ok {
+		return nil
+	}
+	delete(m.drained, id)
+
+	m.logger.Info("Stopped draining Library (ID: %v), its jobs are dispatched again", id)
+	return nil
+}
+
+// LibraryDrained returns whether or not the library with the provided ID is drained.
+func (m *Manager) LibraryDrained(id int) bool {
+	m.drainMutex.Lock()
+	defer m.drainMutex.Unlock()
+	_, ok := m.drained[id]
+	return ok
+}
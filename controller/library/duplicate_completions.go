@@ -0,0 +1,59 @@
+package library
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// completedSinceQueued returns whether another job for the same file was imported after job was queued and the file
+// hasn't changed since. The file would be replaced by a second transcode of the same source if job was imported too.
+func (m *Manager) completedSinceQueued(job controller.Job) bool {
+	if job.QueuedAt.IsZero() {
+		return false
+	}
+
+	processedModtime, err := m.ds.LastProcessedModtime(m.ctx, job.Path)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			m.logger.Error(err.Error())
+		}
+		return false
+	}
+
+	if !processedModtime.After(job.QueuedAt) {
+		return false
+	}
+	return m.unchangedSinceProcessed(job.Path)
+}
+
+// discardDuplicateCompletion throws away the transcoded files of a completed job whose file was already replaced by
+// another job and records the job as failed without retrying it.
+func (m *Manager) discardDuplicateCompletion(cJob controller.CompletedJob, dJob controller.DispatchedJob) {
+	message := fmt.Sprintf("Discarding completed job %v because %v was already replaced by another job", dJob.UUID, dJob.Job.Path)
+	m.logger.Warn(message, dJob.Job.LogFields())
+
+	m.discardTranscodedFiles(cJob)
+
+	cJob.History.UUID = dJob.UUID
+	cJob.History.Runner = dJob.Runner
+	cJob.History.Failed = true
+	cJob.History.Job = dJob.Job
+	cJob.History.Errors = append(cJob.History.Errors, message)
+	if err := m.ds.PushHistory(m.ctx, cJob.History); err != nil {
+		m.logger.Error("%v", err, dJob.Job.LogFields())
+	}
+}
+
+// discardTranscodedFiles removes the files which a Runner uploaded for cJob.
+func (m *Manager) discardTranscodedFiles(cJob controller.CompletedJob) {
+	for _, f := range []string{cJob.InFile, cJob.CaptionsFile} {
+		if f == "" {
+			continue
+		}
+		if err := m.fileRemover.Remove(f); err != nil {
+			m.logger.Error(err.Error())
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// FFprobeSidecarExt is appended to the path of a media file to get the path of its ffprobe sidecar.
+const FFprobeSidecarExt = ".ffprobe.json"
+
+// NewFFprobeSidecar returns a new FFprobeSidecar.
+func NewFFprobeSidecar(m MetadataReader, l controller.Logger) FFprobeSidecar {
+	return FFprobeSidecar{
+		metadataReader: m,
+		logger:         l,
+		stater:         osStater{},
+		fileReader:     defaultFileReader{},
+	}
+}
+
+// FFprobeSidecar sits in front of a MetadataReader and reads the metadata of a file from the JSON that ffprobe printed
+// for it (ffprobe -print_format json -show_format -show_streams -show_chapters -show_programs) when it is saved next to the file as
+// <file name>.ffprobe.json. The MetadataReader is only called if the sidecar is missing, older than the file, or invalid.
+type FFprobeSidecar struct {
+	metadataReader MetadataReader
+	logger         controller.Logger
+	stater         stater
+	fileReader     fileReader
+}
+
+// Read returns the metadata from the file's sidecar if it is at least as new as the file, and from the MetadataReader otherwise.
+func (f *FFprobeSidecar) Read(path string, opts controller.MetadataReadOptions) (controller.FileMetadata, error) {
+	sidecarPath := path + FFprobeSidecarExt
+
+	sidecarInfo, err := f.stater.Stat(sidecarPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			f.logger.Warn("Failed to stat the ffprobe sidecar %v, probing %v instead: %v", sidecarPath, path, err)
+		}
+		return f.metadataReader.Read(path, opts)
+	}
+
+	fileInfo, err := f.stater.Stat(path)
+	if err != nil {
+		return f.metadataReader.Read(path, opts)
+	}
+	if sidecarInfo.ModTime().Before(fileInfo.ModTime()) {
+		f.logger.Debug("Ignoring the ffprobe sidecar of %v because the file was modified after it", path)
+		return f.metadataReader.Read(path, opts)
+	}
+
+	b, err := f.fileReader.ReadFile(sidecarPath)
+	if err != nil {
+		f.logger.Warn("Failed to read the ffprobe sidecar %v, probing %v instead: %v", sidecarPath, path, err)
+		return f.metadataReader.Read(path, opts)
+	}
+
+	metadata, err := parseFFprobe(b)
+	if err != nil {
+		f.logger.Warn("Invalid ffprobe sidecar %v, probing %v instead: %v", sidecarPath, path, err)
+		return f.metadataReader.Read(path, opts)
+	}
+	return metadata, nil
+}
+
+// ffprobeOutput is the part of ffprobe's JSON output that FileMetadata is read from.
+type ffprobeOutput struct {
+	Streams []struct {
+		Index            int               `json:"index"`
+		CodecName        string            `json:"codec_name"`
+		CodecType        string            `json:"codec_type"`
+		Width            int               `json:"width"`
+		Height           int               `json:"height"`
+		ColorPrimaries   string            `json:"color_primaries"`
+		BitsPerRawSample string            `json:"bits_per_raw_sample"`
+		PixFmt           string            `json:"pix_fmt"`
+		RFrameRate       string            `json:"r_frame_rate"`
+		AvgFrameRate     string            `json:"avg_frame_rate"`
+		Channels         int               `json:"channels"`
+		ClosedCaptions   int               `json:"closed_captions"`
+		Tags             map[string]string `json:"tags"`
+	} `json:"streams"`
+	Format *struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+	Chapters []json.RawMessage `json:"chapters"`
+	Programs []struct {
+		ProgramID int `json:"program_id"`
+		Streams   []struct {
+			Index int `json:"index"`
+		} `json:"streams"`
+	} `json:"programs"`
+}
+
+// parseFFprobe converts the JSON output of ffprobe into a FileMetadata.
+func parseFFprobe(b []byte) (controller.FileMetadata, error) {
+	var out ffprobeOutput
+	if err := json.Unmarshal(b, &out); err != nil {
+		return controller.FileMetadata{}, err
+	}
+	if out.Format == nil || len(out.Streams) == 0 {
+		return controller.FileMetadata{}, fmt.Errorf("it doesn't have the format and streams of the file")
+	}
+
+	duration, err := strconv.ParseFloat(out.Format.Duration, 32)
+	if err != nil {
+		return controller.FileMetadata{}, fmt.Errorf("parsing the duration: %w", err)
+	}
+
+	metadata := controller.FileMetadata{
+		General:        controller.General{Duration: float32(duration)},
+		VideoTracks:    make([]controller.VideoTrack, 0),
+		AudioTracks:    make([]controller.AudioTrack, 0),
+		SubtitleTracks: make([]controller.SubtitleTrack, 0),
+		Chapters:       len(out.Chapters) > 0,
+	}
+
+	for _, s := range out.Streams {
+		switch s.CodecType {
+		case "video":
+			// Cover art is stored as a video stream, but it doesn't have a codec that can be transcoded to
+			if s.CodecName == "mjpeg" || s.CodecName == "png" {
+				continue
+			}
+			if s.ClosedCaptions != 0 {
+				metadata.ClosedCaptions = true
+			}
+
+			// ffprobe only reports bits_per_raw_sample for some codecs, but the pixel format always shows the bit depth
+			bitDepth, err := strconv.Atoi(s.BitsPerRawSample)
+			if err != nil {
+				bitDepth = pixFmtBitDepth(s.PixFmt)
+			}
+
+			metadata.VideoTracks = append(metadata.VideoTracks, controller.VideoTrack{
+				Index:          s.Index,
+				Codec:          ffprobeCodecs[s.CodecName],
+				Width:          s.Width,
+				Height:         s.Height,
+				ColorPrimaries: s.ColorPrimaries,
+				BitDepth:       bitDepth,
+
+				VariableFrameRate: variableFrameRate(s.RFrameRate, s.AvgFrameRate),
+			})
+		case "audio":
+			metadata.AudioTracks = append(metadata.AudioTracks, controller.AudioTrack{Index: s.Index, Channels: s.Channels, Language: s.Tags["language"]})
+		case "subtitle":
+			if s.CodecName == "eia_608" || s.CodecName == "eia_708" {
+				metadata.ClosedCaptions = true
+				continue
+			}
+			metadata.SubtitleTracks = append(metadata.SubtitleTracks, controller.SubtitleTrack{Index: s.Index, Language: s.Tags["language"]})
+		}
+	}
+
+	for _, p := range out.Programs {
+		program := controller.Program{ID: p.ProgramID, StreamIndexes: make([]int, 0, len(p.Streams))}
+		for _, s := range p.Streams {
+			program.StreamIndexes = append(program.StreamIndexes, s.Index)
+		}
+		metadata.Programs = append(metadata.Programs, program)
+	}
+
+	return metadata, nil
+}
+
+// ffprobeCodecs maps ffprobe's codec names to the ones used by VideoTrack.Codec.
+var ffprobeCodecs = map[string]string{
+	"h264": "AVC",
+	"hevc": "HEVC",
+	"vp9":  "VP9",
+	"av1":  "AV1",
+}
+
+// pixFmtBitDepth returns the bit depth of an ffmpeg pixel format (ex. 10 for yuv420p10le), or zero if it can't tell.
+func pixFmtBitDepth(pixFmt string) int {
+	if pixFmt == "" {
+		return 0
+	}
+	for _, depth := range []int{16, 12, 10} {
+		if strings.Contains(pixFmt, fmt.Sprintf("p%v", depth)) {
+			return depth
+		}
+	}
+	return 8
+}
+
+// variableFrameRate returns whether or not a stream is VFR, going by whether its base frame rate (r_frame_rate) differs
+// from its average one (avg_frame_rate). A stream which is missing either rate (ffprobe reports 0/0) is assumed to be CFR.
+func variableFrameRate(rFrameRate, avgFrameRate string) bool {
+	r, avg := parseFrameRate(rFrameRate), parseFrameRate(avgFrameRate)
+	if r == 0 || avg == 0 {
+		return false
+	}
+	return math.Abs(r-avg) > 0.01
+}
+
+// parseFrameRate parses a frame rate like 24000/1001 or 25. 0 is returned if it isn't a valid rate.
+func parseFrameRate(s string) float64 {
+	num, den := s, "1"
+	if i := strings.Index(s, "/"); i != -1 {
+		num, den = s[:i], s[i+1:]
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
@@ -0,0 +1,133 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+const testFFprobeJSON = `{
+	"streams": [
+		{"index": 0, "codec_name": "hevc", "codec_type": "video", "width": 3840, "height": 2160, "pix_fmt": "yuv420p10le", "color_primaries": "bt2020", "r_frame_rate": "24000/1001", "avg_frame_rate": "24000/1001", "closed_captions": 0},
+		{"index": 1, "codec_name": "eac3", "codec_type": "audio", "channels": 6, "tags": {"language": "jpn"}},
+		{"index": 2, "codec_name": "subrip", "codec_type": "subtitle", "tags": {"language": "eng"}},
+		{"index": 3, "codec_name": "mjpeg", "codec_type": "video", "width": 600, "height": 900}
+	],
+	"format": {"duration": "5400.250000"},
+	"chapters": [{"id": 0, "start_time": "0.000000"}]
+}`
+
+func TestFFprobeSidecar(t *testing.T) {
+	probed := controller.FileMetadata{General: controller.General{Duration: 1}}
+	fromSidecar := controller.FileMetadata{
+		General:        controller.General{Duration: 5400.25},
+		VideoTracks:    []controller.VideoTrack{{Index: 0, Codec: "HEVC", Width: 3840, Height: 2160, ColorPrimaries: "bt2020", BitDepth: 10}},
+		AudioTracks:    []controller.AudioTrack{{Index: 1, Channels: 6, Language: "jpn"}},
+		SubtitleTracks: []controller.SubtitleTrack{{Index: 2, Language: "eng"}},
+		Chapters:       true,
+	}
+	fileModtime := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		sidecar        string
+		sidecarModtime time.Time
+		expected       controller.FileMetadata
+		expectedProbes int
+	}{
+		{name: "Fresh Sidecar", sidecar: testFFprobeJSON, sidecarModtime: fileModtime.Add(time.Minute), expected: fromSidecar, expectedProbes: 0},
+		{name: "Stale Sidecar", sidecar: testFFprobeJSON, sidecarModtime: fileModtime.Add(-time.Minute), expected: probed, expectedProbes: 1},
+		{name: "Invalid Sidecar", sidecar: `{"streams": []}`, sidecarModtime: fileModtime.Add(time.Minute), expected: probed, expectedProbes: 1},
+		{name: "No Sidecar", expected: probed, expectedProbes: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "a.mkv")
+			if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, fileModtime, fileModtime); err != nil {
+				t.Fatal(err)
+			}
+			if test.sidecar != "" {
+				if err := os.WriteFile(path+FFprobeSidecarExt, []byte(test.sidecar), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path+FFprobeSidecarExt, test.sidecarModtime, test.sidecarModtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mr := &mockMetadataReader{metadata: probed}
+			f := NewFFprobeSidecar(mr, &mockLogger{})
+
+			opts := controller.MetadataReadOptions{Timeout: time.Minute, Args: []string{"--ParseSpeed=1"}}
+			metadata, err := f.Read(path, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(metadata, test.expected) {
+				t.Errorf("expected %+v but got %+v", test.expected, metadata)
+			}
+			if len(mr.read) != test.expectedProbes {
+				t.Errorf("expected %v probes but got %v", test.expectedProbes, len(mr.read))
+			}
+			if got, ok := mr.readOpts[path]; ok && !reflect.DeepEqual(got, opts) {
+				t.Errorf("expected the probe to use %+v but got %+v", opts, got)
+			}
+		})
+	}
+}
+
+func TestParseFFprobePrograms(t *testing.T) {
+	b := []byte(`{
+	"programs": [
+		{"program_id": 3, "streams": [{"index": 0, "codec_type": "video"}]},
+		{"program_id": 4, "streams": [{"index": 1, "codec_type": "video"}, {"index": 2, "codec_type": "audio"}]}
+	],
+	"streams": [
+		{"index": 0, "codec_name": "mpeg2video", "codec_type": "video", "width": 720, "height": 480},
+		{"index": 1, "codec_name": "h264", "codec_type": "video", "width": 1920, "height": 1080},
+		{"index": 2, "codec_name": "ac3", "codec_type": "audio", "channels": 6}
+	],
+	"format": {"duration": "3600.120000"}
+}`)
+
+	metadata, err := parseFFprobe(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []controller.Program{{ID: 3, StreamIndexes: []int{0}}, {ID: 4, StreamIndexes: []int{1, 2}}}
+	if !reflect.DeepEqual(metadata.Programs, expected) {
+		t.Errorf("expected the programs %+v but got %+v", expected, metadata.Programs)
+	}
+}
+
+func TestVariableFrameRate(t *testing.T) {
+	tests := []struct {
+		name         string
+		rFrameRate   string
+		avgFrameRate string
+		expected     bool
+	}{
+		{name: "Constant", rFrameRate: "24000/1001", avgFrameRate: "24000/1001", expected: false},
+		{name: "Constant With Different Notation", rFrameRate: "25/1", avgFrameRate: "50/2", expected: false},
+		{name: "Variable", rFrameRate: "60/1", avgFrameRate: "8783100/293011", expected: true},
+		{name: "Unknown Average", rFrameRate: "24/1", avgFrameRate: "0/0", expected: false},
+		{name: "Missing", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if vfr := variableFrameRate(test.rFrameRate, test.avgFrameRate); vfr != test.expected {
+				t.Errorf("expected %v but got %v", test.expected, vfr)
+			}
+		})
+	}
+}
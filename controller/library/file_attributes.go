@@ -0,0 +1,36 @@
+package library
+
+import (
+	"io/fs"
+	"time"
+)
+
+// keepOriginalAttributes gives the transcoded file at path the owner and permissions of the original file that it
+// replaced, which is described by original. The modtime of the original is only kept if the library has
+// PreserveModtime set, otherwise the transcoded file keeps the time that it was received.
+// Failures are only logged because the transcoded file has already replaced the original.
+func (m *Manager) keepOriginalAttributes(path string, original fs.FileInfo, libraryID int) {
+	// Changing the owner usually requires privileges that the Controller doesn't have
+	if uid, gid, ok := fileOwner(original); ok {
+		if err := m.fileAttributer.Chown(path, uid, gid); err != nil {
+			m.logger.Warn("Couldn't give %v the owner of its original (uid: %v, gid: %v): %v", path, uid, gid, err)
+		}
+	}
+
+	if err := m.fileAttributer.Chmod(path, original.Mode().Perm()); err != nil {
+		m.logger.Warn("Couldn't give %v the permissions of its original (%v): %v", path, original.Mode().Perm(), err)
+	}
+
+	lib, err := m.ds.Library(m.ctx, libraryID)
+	if err != nil {
+		m.logger.Warn("Not keeping the modtime of the original of %v because its library couldn't be read: %v", path, err)
+		return
+	}
+	if !lib.PreserveModtime {
+		return
+	}
+
+	if err = m.fileAttributer.Chtimes(path, time.Now(), original.ModTime()); err != nil {
+		m.logger.Warn("Couldn't give %v the modtime of its original: %v", path, err)
+	}
+}
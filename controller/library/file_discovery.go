@@ -14,16 +14,25 @@ func GetVideoFilesFromDir(dirToSearch string) ([]string, error) {
 	return filterNonVideoExts(allFiles), nil
 }
 
-// getFilesFromDir returns all files in a directory.
+// getFilesFromDir returns all files in a directory, except for those matched by an .encodarrignore file.
 func getFilesFromDir(dirToSearch string) ([]string, error) {
 	cleanSlashedPath := filepath.ToSlash(filepath.Clean(dirToSearch))
 	files := make([]string, 0)
+	matcher := newIgnoreMatcher()
 
 	filepath.Walk(cleanSlashedPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
 		}
-		if !info.IsDir() {
+		if info.IsDir() {
+			// Like git, the contents of an ignored directory can't be re-included, so the whole directory is skipped.
+			if path != cleanSlashedPath && matcher.ignored(path, true) {
+				return filepath.SkipDir
+			}
+			matcher.loadDir(path)
+			return nil
+		}
+		if !matcher.ignored(path, false) {
 			files = append(files, path)
 		}
 		return nil
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package library
+
+import "io/fs"
+
+// fileOwner always returns false because files don't have numeric owners on this platform.
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,79 @@
+package library
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// snapshotModtimePrecision is the precision that snapshot modtimes are stored with. Postgres only keeps microseconds,
+// so comparing the full modtime would make every file look changed on every scan.
+const snapshotModtimePrecision = time.Microsecond
+
+// refreshFileSnapshot saves a new snapshot of videoFilepath unless known, which holds the modtimes of the library's
+// snapshots, shows that the file hasn't changed since its snapshot was taken.
+func (m *Manager) refreshFileSnapshot(lib controller.Library, videoFilepath string, known map[string]time.Time) {
+	info, err := m.fileStater.Stat(videoFilepath)
+	if err != nil {
+		m.logger.Debug("Not saving a snapshot of %v because it couldn't be stated: %v", videoFilepath, err)
+		return
+	}
+
+	modtime := info.ModTime().Truncate(snapshotModtimePrecision)
+	if t, ok := known[videoFilepath]; ok && t.Equal(modtime) {
+		return
+	}
+
+	metadata, err := m.readMetadata(lib, videoFilepath)
+	if err != nil {
+		m.logger.Debug("Not saving a snapshot of %v because its metadata couldn't be read: %v", videoFilepath, err)
+		return
+	}
+
+	if err = m.ds.SaveFileSnapshot(m.ctx, newFileSnapshot(lib.ID, videoFilepath, info, metadata)); err != nil {
+		m.logger.Error("error saving the snapshot of %v: %v", videoFilepath, err)
+	}
+}
+
+// pruneFileSnapshots deletes the snapshots in known whose files weren't found by the library's scan.
+func (m *Manager) pruneFileSnapshots(libraryID int, known map[string]time.Time, found map[string]struct{}) {
+	stale := make([]string, 0)
+	for path := range known {
+		if _, ok := found[path]; !ok {
+			stale = append(stale, path)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	deleted, err := m.ds.DeleteFileSnapshots(m.ctx, stale)
+	if err != nil {
+		m.logger.Error("error deleting the snapshots of %v files which are no longer in Library %v: %v", len(stale), libraryID, err)
+		return
+	}
+	m.logger.Debug("Deleted the snapshots of %v files which are no longer in Library %v", deleted, libraryID)
+}
+
+// newFileSnapshot creates the snapshot of the file at path from its metadata and file info.
+func newFileSnapshot(libraryID int, path string, info fs.FileInfo, metadata controller.FileMetadata) controller.FileSnapshot {
+	s := controller.FileSnapshot{
+		Path:      path,
+		LibraryID: libraryID,
+		Duration:  metadata.General.Duration,
+		Size:      info.Size(),
+		Container: strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")),
+		Modtime:   info.ModTime().Truncate(snapshotModtimePrecision),
+	}
+	if len(metadata.VideoTracks) > 0 {
+		v := metadata.VideoTracks[0]
+		s.VideoCodec = v.Codec
+		s.Width = v.Width
+		s.Height = v.Height
+		s.HDR = v.HDR()
+	}
+	return s
+}
@@ -0,0 +1,18 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package library
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// filesystemID returns the ID of the device holding the file described by info. ok is false if it isn't known.
+func filesystemID(info fs.FileInfo) (id uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package library
+
+import "io/fs"
+
+// filesystemID always returns false because files don't have a device ID on this platform.
+func filesystemID(info fs.FileInfo) (id uint64, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,156 @@
+package library
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFilename is the name of the files that list paths which should be ignored by library scans.
+const ignoreFilename = ".encodarrignore"
+
+// ignoreRule is a single pattern from an ignore file.
+type ignoreRule struct {
+	base     string   // The slash separated directory that contains the ignore file.
+	segments []string // The pattern split on slashes. Patterns which may match at any depth start with "**".
+	negate   bool
+	dirOnly  bool
+}
+
+// parseIgnoreFile parses the contents of an ignore file found in base using gitignore semantics.
+func parseIgnoreFile(base string, b []byte) []ignoreRule {
+	rules := make([]ignoreRule, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(base, scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// parseIgnoreLine parses a single line of an ignore file. ok is false if the line doesn't contain a pattern.
+func parseIgnoreLine(base, line string) (rule ignoreRule, ok bool) {
+	rule.base = base
+
+	line = strings.TrimSuffix(line, "\r")
+	if !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimRight(line, " ")
+	}
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if line == "" {
+		return rule, false
+	}
+
+	// A slash at the beginning or in the middle of the pattern anchors it to the directory of the ignore file.
+	// Otherwise, it may match at any depth.
+	if strings.Contains(line, "/") {
+		rule.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+	} else {
+		rule.segments = []string{"**", line}
+	}
+
+	return rule, true
+}
+
+// matches returns whether or not the rule matches the provided slash separated path.
+func (r ignoreRule) matches(p string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	rel := p
+	if r.base != "." {
+		rel = strings.TrimPrefix(p, strings.TrimSuffix(r.base, "/")+"/")
+	}
+
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments matches the path segments in name against the pattern segments. A "**" segment matches zero or more segments.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// ignoreMatcher caches the rules which apply to each directory visited during a walk.
+// Directories must be loaded (using loadDir) before anything inside of them is checked.
+type ignoreMatcher struct {
+	rules    map[string][]ignoreRule
+	readFile func(name string) ([]byte, error)
+}
+
+func newIgnoreMatcher() ignoreMatcher {
+	return ignoreMatcher{rules: make(map[string][]ignoreRule), readFile: os.ReadFile}
+}
+
+// loadDir reads the ignore file in dir, if there is one, and caches its rules after the rules inherited from the parent directory.
+func (m *ignoreMatcher) loadDir(dir string) {
+	dir = filepath.ToSlash(dir)
+	inherited := m.rules[path.Dir(dir)]
+
+	b, err := m.readFile(path.Join(dir, ignoreFilename))
+	if err != nil {
+		m.rules[dir] = inherited
+		return
+	}
+
+	// The parent's slice is copied so that sibling directories don't share appended rules.
+	m.rules[dir] = append(append(make([]ignoreRule, 0, len(inherited)), inherited...), parseIgnoreFile(dir, b)...)
+}
+
+// ignored returns whether or not the provided path should be ignored. The last matching rule wins,
+// so rules from deeper ignore files override the ones from their parents.
+func (m *ignoreMatcher) ignored(p string, isDir bool) bool {
+	p = filepath.ToSlash(p)
+
+	ignored := false
+	for _, r := range m.rules[path.Dir(p)] {
+		if r.matches(p, isDir) {
+			ignored = !r.negate
+		}
+	}
+
+	return ignored
+}
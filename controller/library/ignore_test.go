@@ -0,0 +1,146 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIgnoreRuleMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{name: "Basename at root", line: "*.nfo.mkv", path: "/media/a.nfo.mkv", expected: true},
+		{name: "Basename at any depth", line: "sample.mkv", path: "/media/show/s01/sample.mkv", expected: true},
+		{name: "No match", line: "sample.mkv", path: "/media/movie.mkv", expected: false},
+		{name: "Anchored with leading slash", line: "/extras", path: "/media/show/extras", isDir: true, expected: false},
+		{name: "Anchored with leading slash matches at root", line: "/extras", path: "/media/extras", isDir: true, expected: true},
+		{name: "Anchored with middle slash", line: "show/extras", path: "/media/show/extras", isDir: true, expected: true},
+		{name: "Directory pattern matches directory", line: "extras/", path: "/media/show/extras", isDir: true, expected: true},
+		{name: "Directory pattern doesn't match file", line: "extras/", path: "/media/show/extras", isDir: false, expected: false},
+		{name: "Double star in middle", line: "show/**/sample.mkv", path: "/media/show/s01/e01/sample.mkv", expected: true},
+		{name: "Double star matches zero segments", line: "show/**/sample.mkv", path: "/media/show/sample.mkv", expected: true},
+		{name: "Leading double star", line: "**/featurettes", path: "/media/a/b/featurettes", isDir: true, expected: true},
+		{name: "Escaped hash", line: `\#1.mkv`, path: "/media/#1.mkv", expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, ok := parseIgnoreLine("/media", test.line)
+			if !ok {
+				t.Fatalf("expected '%v' to be parsed as a rule", test.line)
+			}
+
+			if out := rule.matches(test.path, test.isDir); out != test.expected {
+				t.Errorf("expected %v but got %v", test.expected, out)
+			}
+		})
+	}
+}
+
+func TestParseIgnoreFileSkipsCommentsAndBlankLines(t *testing.T) {
+	rules := parseIgnoreFile("/media", []byte("# comment\n\n   \n*.mkv\n!keep.mkv\n"))
+
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules but got %v", len(rules))
+	}
+	if rules[0].negate || !rules[1].negate {
+		t.Errorf("expected only the second rule to be negated")
+	}
+}
+
+func TestGetFilesFromDirHonorsIgnoreFiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string // Relative path to contents. Files named .encodarrignore are ignore files.
+		expectedRel []string
+	}{
+		{
+			name: "Negation re-includes a file",
+			files: map[string]string{
+				".encodarrignore": "*.mkv\n!keep.mkv\n",
+				"a.mkv":           "",
+				"keep.mkv":        "",
+				"b.mp4":           "",
+			},
+			expectedRel: []string{".encodarrignore", "b.mp4", "keep.mkv"},
+		},
+		{
+			name: "Ignored directory is skipped",
+			files: map[string]string{
+				".encodarrignore":   "extras/\n",
+				"extras/a.mkv":      "",
+				"show/extras/b.mkv": "",
+				"show/c.mkv":        "",
+			},
+			expectedRel: []string{".encodarrignore", "show/c.mkv"},
+		},
+		{
+			name: "Nested ignore file overrides parent",
+			files: map[string]string{
+				".encodarrignore":      "*.mkv\n",
+				"a.mkv":                "",
+				"keep/.encodarrignore": "!*.mkv\n",
+				"keep/b.mkv":           "",
+				"other/c.mkv":          "",
+			},
+			expectedRel: []string{".encodarrignore", "keep/.encodarrignore", "keep/b.mkv"},
+		},
+		{
+			name: "Nested ignore file doesn't affect siblings",
+			files: map[string]string{
+				"a/.encodarrignore": "*.mkv\n",
+				"a/x.mkv":           "",
+				"b/y.mkv":           "",
+			},
+			expectedRel: []string{"a/.encodarrignore", "b/y.mkv"},
+		},
+		{
+			name: "Anchored pattern is relative to its ignore file",
+			files: map[string]string{
+				"show/.encodarrignore": "/sample.mkv\n",
+				"show/sample.mkv":      "",
+				"show/s01/sample.mkv":  "",
+			},
+			expectedRel: []string{"show/.encodarrignore", "show/s01/sample.mkv"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			for rel, contents := range test.files {
+				p := filepath.Join(root, filepath.FromSlash(rel))
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			files, err := getFilesFromDir(root)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			rootSlashed := filepath.ToSlash(filepath.Clean(root))
+			rel := make([]string, 0, len(files))
+			for _, f := range files {
+				r, _ := filepath.Rel(rootSlashed, f)
+				rel = append(rel, filepath.ToSlash(r))
+			}
+			sort.Strings(rel)
+
+			if !reflect.DeepEqual(rel, test.expectedRel) {
+				t.Errorf("expected %v but got %v", test.expectedRel, rel)
+			}
+		})
+	}
+}
@@ -1,20 +1,38 @@
 package library
 
 import (
+	"context"
 	"io/fs"
+	"time"
 
 	"github.com/BrenekH/encodarr/controller"
 )
 
 // The MetadataReader interface defines how a MetadataReader should behave.
 type MetadataReader interface {
-	Read(path string) (controller.FileMetadata, error)
+	// Read returns the metadata of the file at path, read with the overrides of the file's library.
+	Read(path string, opts controller.MetadataReadOptions) (controller.FileMetadata, error)
 }
 
 // The CommandDecider interface defines how a CommandDecider should behave.
 type CommandDecider interface {
 	Decide(m controller.FileMetadata, cmdDeciderSettings string) (cmd []string, err error)
 	DefaultSettings() string
+
+	// ValidateSettings returns an error describing why the provided settings can't be used, if any.
+	ValidateSettings(cmdDeciderSettings string) error
+
+	// TargetVideoCodec returns the video codec that a file with the provided metadata is transcoded to, or an empty string
+	// if its video isn't transcoded.
+	TargetVideoCodec(m controller.FileMetadata, cmdDeciderSettings string) (string, error)
+
+	// Annotations returns the annotations that the provided settings attach to every job which is queued with them.
+	Annotations(cmdDeciderSettings string) (map[string]string, error)
+}
+
+// MediaServerRefresher tells a media server to rescan the folders of files which were replaced.
+type MediaServerRefresher interface {
+	Refresh(dir string)
 }
 
 // stater is an interface that allows for the mocking of os.Stat for testing.
@@ -35,6 +53,31 @@ type fileMover interface {
 	Move(from string, to string) error
 }
 
+type fileReader interface {
+	ReadFile(name string) ([]byte, error)
+}
+
+type dirReader interface {
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
 type fileStater interface {
 	Stat(path string) (fs.FileInfo, error)
 }
+
+// fileAttributer is an interface that allows for the mocking of os.Chmod, os.Chown, and os.Chtimes for testing.
+type fileAttributer interface {
+	Chmod(name string, mode fs.FileMode) error
+	Chown(name string, uid, gid int) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// loadReporter is an interface that allows for the mocking of controller.CPULoad for testing.
+type loadReporter interface {
+	Load() (float64, error)
+}
+
+// commandRunner is an interface that allows for the mocking of running external commands for testing.
+type commandRunner interface {
+	Run(ctx context.Context, name string, args ...string) (output []byte, err error)
+}
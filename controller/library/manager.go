@@ -2,34 +2,74 @@ package library
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/trash"
 	"github.com/google/uuid"
 )
 
 // NewManager return a new Manager.
-func NewManager(logger controller.Logger, ds controller.LibraryManagerDataStorer, metadataReader MetadataReader, commandDecider CommandDecider) Manager {
+func NewManager(logger controller.Logger, ds controller.LibraryManagerDataStorer, ss controller.SettingsStorer, metadataReader MetadataReader, commandDecider CommandDecider, notifier controller.Notifier, metrics controller.MetricsCollector, paths controller.PathCanonicalizer, deletedLibraryRetention time.Duration) Manager {
 	return Manager{
 		logger:         logger,
 		ds:             ds,
+		ss:             ss,
+		ctx:            context.Background(),
 		metadataReader: metadataReader,
 		commandDecider: commandDecider,
+		notifier:       notifier,
+		paths:          paths,
 		videoFileser:   defaultVideoFileser{},
 		fileRemover:    defaultFileRemover{},
 		fileMover:      defaultFileMover{},
 		fileStater:     defaultFileStater{},
+		fileAttributer: defaultFileAttributer{},
+		dirReader:      defaultDirReader{},
+		fileReader:     defaultFileReader{},
+		commandRunner:  defaultCommandRunner{},
+		loadReporter:   defaultLoadReporter{},
+		reservations:   newPathReservations(),
+		snapshot:       &librarySnapshot{},
 
+		verificationTimeout:     defaultVerificationTimeout,
+		deletedLibraryRetention: deletedLibraryRetention,
+		popStrategy:             PopQueueOrder,
+		metadataReadSlots:       make(chan struct{}, defaultMetadataReadConcurrency),
+
+		metrics:      metrics,
+		bytesRead:    metrics.Counter("encodarr_bytes_read_total", "Total size in bytes of the original files replaced by completed jobs."),
+		bytesWritten: metrics.Counter("encodarr_bytes_written_total", "Total size in bytes of the files which replaced originals."),
+		bytesSaved:   metrics.Counter("encodarr_bytes_saved_total", "Total bytes saved by completed jobs. Jobs which made a file larger don't reduce it."),
+		savingsRatio: metrics.Histogram("encodarr_savings_ratio", "Fraction of each original file's size saved by its completed job. Negative when the file got larger.", savingsRatioBuckets),
+
+		scanMutex:          &sync.Mutex{},
 		lastCheckedTimes:   make(map[int]time.Time),
 		workerCompletedMap: make(map[int]bool),
+		scanCancels:        make(map[int]context.CancelFunc),
+		heldGroupJobs:      make(map[string][]heldGroupJob),
+		awaitingSpaceMutex: &sync.Mutex{},
+		drainMutex:         &sync.Mutex{},
+		planMutex:          &sync.Mutex{},
+		benchmarkMutex:     &sync.Mutex{},
+		drained:            make(map[int]struct{}),
+		sidecarExtensions:  sidecarExtensionSet(DefaultSidecarExtensions),
+		outage:             &datastoreOutage{maxBackoff: defaultDatastoreMaxBackoff, breakerThreshold: defaultDatastoreBreakerThreshold},
+		spaceWaiting:       make(map[int]struct{}),
+		freeSpace:          controller.FreeSpace,
+		now:                time.Now,
 	}
 }
 
@@ -37,80 +77,425 @@ func NewManager(logger controller.Logger, ds controller.LibraryManagerDataStorer
 type Manager struct {
 	logger         controller.Logger
 	ds             controller.LibraryManagerDataStorer
+	ss             controller.SettingsStorer
 	metadataReader MetadataReader
 	commandDecider CommandDecider
+	notifier       controller.Notifier
+	paths          controller.PathCanonicalizer
 	videoFileser   videoFileser
 	fileRemover    fileRemover
 	fileMover      fileMover
 	fileStater     fileStater
+	fileAttributer fileAttributer
+	dirReader      dirReader
+	fileReader     fileReader
+	commandRunner  commandRunner
+	loadReporter   loadReporter
+
+	// ctx is passed to every data storer call. It is replaced by the one given to Start, so that the calls are
+	// cancelled when the Controller shuts down.
+	ctx context.Context
+
+	metrics      controller.MetricsCollector
+	bytesRead    controller.Counter
+	bytesWritten controller.Counter
+	bytesSaved   controller.Counter
+	savingsRatio controller.Histogram
+
+	// verificationTimeout is how long a library's verification command may run before the transcode is rejected.
+	verificationTimeout time.Duration
+
+	// deletedLibraryRetention is how long a deleted library can be restored before it is purged.
+	// lastPurge is when deleted libraries were last purged by Start.
+	deletedLibraryRetention time.Duration
+	lastPurge               time.Time
+
+	// lastCompaction is when the dispatched jobs were last compacted by Start.
+	lastCompaction time.Time
+
+	// lastDispatchPlan is when the dispatch order was last planned by Start.
+	lastDispatchPlan time.Time
+
+	// planMutex guards plannedPositions, the positions of the queued jobs in the dispatch order, and jobDuration,
+	// the moving average of how long the completed jobs took.
+	planMutex        *sync.Mutex
+	plannedPositions map[controller.UUID]int
+	jobDuration      time.Duration
+
+	// benchmarkMutex guards benchmarks, the prepared benchmark jobs which haven't been dispatched yet, oldest first.
+	benchmarkMutex *sync.Mutex
+	benchmarks     []controller.Job
+
+	// popStrategy decides which job of a library's queue is dispatched next.
+	popStrategy PopStrategy
+
+	// queueAging is how much the priority of a queued job rises per day that it waits. 0 disables aging.
+	queueAging float64
+
+	// trash holds the originals of the libraries which move them to the trash. It is nil if there isn't one.
+	trash *trash.Trash
+
+	// maxConcurrentScans is how many libraries may be scanned at once. 0 doesn't limit them.
+	maxConcurrentScans int
+
+	// maxScanLoad is the CPU load, as a percentage of the CPUs, above which no scans are started. 0 disables the limit.
+	// scansDeferredForLoad is whether the last due scans were deferred because of it. It is guarded by scanMutex.
+	maxScanLoad          float64
+	scansDeferredForLoad bool
+
+	// metadataReadSlots limits how many metadata reads may run at once across all scans. Its capacity is the limit.
+	metadataReadSlots chan struct{}
+
+	// processingDisabled is non-zero while the kill switch is engaged. It must be accessed atomically.
+	processingDisabled int32
+
+	// reservations holds the paths which are currently being decided on by a library scan.
+	reservations *pathReservations
+
+	// snapshot holds the libraries as of the last refresh, which happens every tick of Start.
+	snapshot *librarySnapshot
+
+	// scanMutex guards lastCheckedTimes, workerCompletedMap and scanCancels.
+	scanMutex *sync.Mutex
 
 	// lastCheckedTimes is a map of Library ids and the last time that they were checked.
 	lastCheckedTimes map[int]time.Time
 
 	// workerCompletedMap is a map of Library ids and a boolean to indicate whether the goroutine that was spawned is finished
 	workerCompletedMap map[int]bool
+
+	// scanCancels is a map of Library ids and the function which cancels the context of their running scan.
+	scanCancels map[int]context.CancelFunc
+
+	// heldGroupJobs is a map of multi-part group keys and the completed parts that are waiting for the rest of the set.
+	// They are also saved in the datastore, which they are restored from by the first ImportCompletedJobs call after
+	// a restart. heldGroupJobsLoaded is set once they have been restored.
+	heldGroupJobs       map[string][]heldGroupJob
+	heldGroupJobsLoaded bool
+
+	// awaitingSpaceMutex guards awaitingSpace and lastSpaceRetry.
+	awaitingSpaceMutex *sync.Mutex
+
+	// awaitingSpace holds the completed jobs which couldn't be imported because their library is out of space.
+	// Their transcoded files may take up to awaitingSpaceLimit bytes. lastSpaceRetry is when they were last retried.
+	awaitingSpace      []awaitingSpaceJob
+	awaitingSpaceLimit int64
+	lastSpaceRetry     time.Time
+
+	// budgetEntries are the transcoded files imported within the last budgetWindow, oldest first. Once their sizes add up
+	// to budgetBytes, no jobs are dispatched. budgetWasExhausted is whether the budget was reached when it was last checked.
+	budgetBytes        int64
+	budgetWindow       time.Duration
+	budgetEntries      []budgetEntry
+	budgetWasExhausted bool
+
+	// spaceReservationRatio is how much space PopNewJob reserves for each dispatched job, relative to the size of its
+	// original file. 0 disables the reservations. spaceWaiting is the set of libraries whose next job didn't fit the
+	// last time that they were popped from. freeSpace returns the free space on the filesystem holding a folder.
+	spaceReservationRatio float64
+	spaceWaiting          map[int]struct{}
+	freeSpace             func(dir string) (uint64, error)
+
+	// drainMutex guards drained, the IDs of the libraries whose jobs aren't dispatched.
+	drainMutex *sync.Mutex
+	drained    map[int]struct{}
+
+	// sidecarExtensions are the lowercased extensions of the files which are moved along with a video file.
+	sidecarExtensions map[string]struct{}
+
+	// mediaServer is told about the folder of every replaced file. It is nil if there isn't one.
+	mediaServer MediaServerRefresher
+
+	// outage tracks the failed attempts of Start to reach the data store.
+	outage *datastoreOutage
+
+	now func() time.Time
+}
+
+// savingsRatioBuckets are the upper bounds of the encodarr_savings_ratio histogram buckets.
+var savingsRatioBuckets = []float64{-0.5, -0.25, 0, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+
+// defaultVerificationTimeout is how long a verification command may run before it is killed.
+const defaultVerificationTimeout = time.Hour
+
+// purgeInterval is how often Start purges the libraries which have been deleted for longer than the retention period.
+const purgeInterval = time.Hour
+
+// appendBatchSize is how many new jobs a scan collects before adding them to the library's queue.
+const appendBatchSize = 100
+
+// maxLibraryConflictRetries is how many times modifyLibrary re-applies a change after its save conflicted with another one.
+const maxLibraryConflictRetries = 10
+
+// heldGroupJob is a completed part of a multi-part set that hasn't been imported yet.
+type heldGroupJob struct {
+	cJob controller.CompletedJob
+	dJob controller.DispatchedJob
 }
 
 // Start starts the library manager without blocking the thread.
-func (m *Manager) Start(ctx *context.Context, wg *sync.WaitGroup) {
+func (m *Manager) Start(ctx context.Context, wg *sync.WaitGroup) {
+	m.ctx = ctx
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		m.canonicalizeStoredPaths()
+
+		startup := true
 		for {
 			if controller.IsContextFinished(ctx) {
 				return
 			}
 
 			// Check all Libraries for required scans
-			allLibraries, err := m.ds.Libraries()
+			allLibraries, err := m.RefreshLibraries()
 			if err != nil {
-				m.logger.Error("%v", err)
-				time.Sleep(time.Second)
+				waitOrDone(ctx, m.datastoreFailed(err))
 				continue
 			}
+			m.datastoreReached()
 
-			for _, lib := range allLibraries {
-				t, ok := m.lastCheckedTimes[lib.ID]
-				if !ok {
-					m.lastCheckedTimes[lib.ID] = time.Unix(0, 0)
-					t = m.lastCheckedTimes[lib.ID]
-				}
-
-				previousWorkerFinished, ok := m.workerCompletedMap[lib.ID]
-				if !ok {
-					m.workerCompletedMap[lib.ID] = true
-					previousWorkerFinished = m.workerCompletedMap[lib.ID]
-				}
+			if time.Since(m.lastPurge) >= purgeInterval {
+				m.purgeDeletedLibraries()
+				m.lastPurge = time.Now()
+			}
 
-				if time.Since(t) > lib.FsCheckInterval && previousWorkerFinished {
-					m.logger.Debug("Initiating library (ID: %v) update", lib.ID)
-					m.lastCheckedTimes[lib.ID] = time.Now()
-					m.workerCompletedMap[lib.ID] = false
+			if time.Since(m.lastCompaction) >= compactInterval {
+				m.compactDispatched()
+				m.lastCompaction = time.Now()
+			}
 
-					wg.Add(1)
-					go m.updateLibraryQueue(ctx, wg, lib)
-				}
+			if time.Since(m.lastDispatchPlan) >= dispatchPlanInterval {
+				m.setPlannedPositions(m.planDispatch(allLibraries, time.Now()))
+				m.lastDispatchPlan = time.Now()
 			}
+
+			m.scheduleScans(ctx, wg, allLibraries, startup)
+			startup = false
 			time.Sleep(time.Second)
 		}
 	}()
 }
 
-func (m *Manager) updateLibraryQueue(ctx *context.Context, wg *sync.WaitGroup, lib controller.Library) {
+// SetProcessingEnabled engages (false) or releases (true) the kill switch. While processing is disabled, no scans
+// are started and PopNewJob doesn't return any jobs. Scans which are already running are allowed to finish.
+func (m *Manager) SetProcessingEnabled(enabled bool) {
+	var disabled int32 = 1
+	if enabled {
+		disabled = 0
+	}
+	if atomic.SwapInt32(&m.processingDisabled, disabled) == disabled {
+		return
+	}
+
+	if enabled {
+		m.logger.Warn("Processing enabled, scans and dispatches resume")
+	} else {
+		m.logger.Warn("Processing disabled, no scans will be started and no jobs will be dispatched")
+	}
+}
+
+// ProcessingEnabled returns whether or not the kill switch is released.
+func (m *Manager) ProcessingEnabled() bool {
+	return atomic.LoadInt32(&m.processingDisabled) == 0
+}
+
+// SetPopStrategy sets how PopNewJob chooses between the jobs in a library's queue. Unknown strategies are
+// ignored. It must be called before Start.
+func (m *Manager) SetPopStrategy(strategy PopStrategy) {
+	if !strategy.valid() {
+		m.logger.Warn("Unknown pop strategy %q, keeping %q", strategy, m.popStrategy)
+		return
+	}
+	m.popStrategy = strategy
+}
+
+// SetMediaServerRefresher sets what is told about the folder of every file that a transcoded file replaces.
+// It must be called before Start.
+func (m *Manager) SetMediaServerRefresher(r MediaServerRefresher) {
+	m.mediaServer = r
+}
+
+// scheduleScans starts a scan of each library whose FsCheckInterval has elapsed since it was last checked.
+// During startup, libraries which don't scan on startup are treated as if they were just checked.
+func (m *Manager) scheduleScans(ctx context.Context, wg *sync.WaitGroup, libs []controller.Library, startup bool) {
+	if !m.ProcessingEnabled() {
+		return
+	}
+
+	m.scanMutex.Lock()
+	defer m.scanMutex.Unlock()
+
+	due := make([]controller.Library, 0)
+	for _, lib := range libs {
+		t, ok := m.lastCheckedTimes[lib.ID]
+		if !ok {
+			if startup && !lib.ScanOnStartup {
+				m.logger.Debug("Deferring the first scan of library (ID: %v) by %v", lib.ID, lib.FsCheckInterval, controller.LogFields{"library_id": lib.ID})
+				m.lastCheckedTimes[lib.ID] = time.Now()
+			} else {
+				m.lastCheckedTimes[lib.ID] = time.Unix(0, 0)
+			}
+			t = m.lastCheckedTimes[lib.ID]
+		}
+
+		previousWorkerFinished, ok := m.workerCompletedMap[lib.ID]
+		if !ok {
+			m.workerCompletedMap[lib.ID] = true
+			previousWorkerFinished = m.workerCompletedMap[lib.ID]
+		}
+
+		if time.Since(t) > lib.FsCheckInterval && previousWorkerFinished {
+			due = append(due, lib)
+		}
+	}
+
+	if len(due) > 0 && !m.loadAllowsScans() {
+		return
+	}
+
+	// The scans of higher priority libraries are started first, so that they get the concurrent scans
+	sortByPriority(due)
+	running := m.runningScans()
+	for _, lib := range due {
+		if m.maxConcurrentScans > 0 && running >= m.maxConcurrentScans {
+			m.logger.Debug("Deferring the scan of library (ID: %v) because %v scans are running", lib.ID, running, controller.LogFields{"library_id": lib.ID})
+			continue
+		}
+
+		m.logger.Debug("Initiating library (ID: %v) update", lib.ID, controller.LogFields{"library_id": lib.ID})
+		m.lastCheckedTimes[lib.ID] = time.Now()
+		m.workerCompletedMap[lib.ID] = false
+		running++
+
+		// Each scan gets its own context so that it can be cancelled without affecting the others
+		scanCtx, cancel := context.WithCancel(ctx)
+		m.scanCancels[lib.ID] = cancel
+
+		wg.Add(1)
+		go m.updateLibraryQueue(scanCtx, wg, lib)
+	}
+}
+
+// CancelScan cancels the running scan of the library with the provided ID and returns whether there was one.
+// The jobs which the scan already queued are kept.
+func (m *Manager) CancelScan(libraryID int) bool {
+	m.scanMutex.Lock()
+	defer m.scanMutex.Unlock()
+
+	cancel, ok := m.scanCancels[libraryID]
+	if !ok {
+		return false
+	}
+	cancel()
+	delete(m.scanCancels, libraryID)
+	m.logger.Info("Cancelled the scan of Library (ID: %v)", libraryID, controller.LogFields{"library_id": libraryID})
+	return true
+}
+
+func (m *Manager) updateLibraryQueue(ctx context.Context, wg *sync.WaitGroup, lib controller.Library) {
 	defer wg.Done()
-	defer func() { m.workerCompletedMap[lib.ID] = true }()
+	defer func() {
+		m.scanMutex.Lock()
+		m.workerCompletedMap[lib.ID] = true
+		if cancel, ok := m.scanCancels[lib.ID]; ok {
+			cancel()
+			delete(m.scanCancels, lib.ID)
+		}
+		m.scanMutex.Unlock()
+	}()
 
-	// Locate video files
-	discoveredVideos, err := m.videoFileser.VideoFiles(lib.Folder)
+	m.releaseExpiredQuarantines()
+
+	started := time.Now()
+	summary := &scanSummary{}
+	unmasked, multiPartGroups, err := m.discoverFiles(lib, summary)
 	if err != nil {
 		m.logger.Error(err.Error())
 		return
 	}
+	defer func() {
+		m.logger.Info("%v", summary.message(lib.ID, time.Since(started)), controller.LogFields{"library_id": lib.ID})
+	}()
+
+	queued := newQueuedPaths(lib.Queue)
+
+	// The snapshots of the files which the scan doesn't find anymore are pruned once it is done
+	snapshotModtimes, err := m.ds.FileSnapshotModtimes(m.ctx, lib.ID)
+	if err != nil {
+		m.logger.Error("error reading the file snapshots of Library %v: %v", lib.ID, err)
+	}
+	found := make(map[string]struct{}, len(unmasked))
+	for _, videoFilepath := range unmasked {
+		found[videoFilepath] = struct{}{}
+	}
+
+	// New jobs are added to the queue in batches because every write serializes the whole queue.
+	// The scan stops early once the queue holds MaxQueuedBytes and picks up where it left off as the queue drains.
+	concurrency := m.scanConcurrency(lib)
+	budget := newQueueBudget(lib)
+	for start := 0; start < len(unmasked) && !controller.IsContextFinished(ctx) && !budget.full(); start += appendBatchSize {
+		end := start + appendBatchSize
+		if end > len(unmasked) {
+			end = len(unmasked)
+		}
+
+		decided := m.scanBatch(ctx, &lib, unmasked[start:end], concurrency, multiPartGroups, queued, snapshotModtimes, summary)
+		jobs := budget.take(decided)
+		if appended, err := m.queueJobs(lib.ID, jobs); err != nil {
+			summary.record(outcomeFailed, len(jobs))
+		} else {
+			summary.record(outcomeQueued, appended)
+			summary.record(outcomeAlreadyQueued, len(jobs)-appended)
+		}
+		m.releaseReservations(decided)
+	}
+	if budget.full() {
+		m.logger.Debug("Library %v's queue holds %v bytes, which reaches its limit of %v bytes, so no more files are queued", lib.ID, budget.queued, lib.MaxQueuedBytes)
+	}
+
+	if !controller.IsContextFinished(ctx) {
+		m.pruneFileSnapshots(lib.ID, snapshotModtimes, found)
+	}
+}
+
+// discoverFiles locates the video files of lib in its QueueOrder and returns the canonical paths of those which
+// aren't kept originals or masked out, along with the multi-part groups they belong to. The files which are left out
+// are recorded in summary.
+func (m *Manager) discoverFiles(lib controller.Library, summary *scanSummary) ([]string, map[string]multiPartGroup, error) {
+	discoveredVideos, err := m.videoFileser.VideoFiles(lib.Folder)
+	if err != nil {
+		return nil, nil, err
+	}
+	if summary != nil {
+		summary.discovered = len(discoveredVideos)
+	}
+	m.paths.CanonicalizeAll(discoveredVideos)
+	m.sortByQueueOrder(discoveredVideos, lib.QueueOrder)
+
+	// Recognize multi-part files so that they can be handled as a linked group
+	multiPartGroups, err := groupMultiPartFiles(discoveredVideos, lib.MultiPartPatterns)
+	if err != nil {
+		m.logger.Error("Disabling multi-part grouping for Library %v because of invalid pattern: %v", lib.ID, err)
+	}
 
+	unmasked := make([]string, 0, len(discoveredVideos))
+	libraryFolder := m.paths.Canonicalize(lib.Folder)
+	trashFolder := ""
+	if m.trash != nil {
+		trashFolder = m.paths.Canonicalize(m.trash.Dir())
+	}
 	for _, videoFilepath := range discoveredVideos {
-		// Respect context while iterating over discoveredVideos
-		if controller.IsContextFinished(ctx) {
-			break
+		if isKeptOriginal(libraryFolder, videoFilepath) {
+			m.logger.Trace("%v skipped because it is a kept original", videoFilepath)
+			summary.record(outcomeIgnored, 1)
+			continue
+		}
+		if trashFolder != "" && inFolder(trashFolder, videoFilepath) {
+			m.logger.Trace("%v skipped because it is in the trash", videoFilepath)
+			summary.record(outcomeIgnored, 1)
+			continue
 		}
 
 		// Check path against Library path masks
@@ -120,7 +505,11 @@ func (m *Manager) updateLibraryQueue(ctx *context.Context, wg *sync.WaitGroup, l
 				m.logger.Trace("Skipping an empty path mask string")
 				continue
 			}
-			if strings.Contains(videoFilepath, v) {
+			matchPath := videoFilepath
+			if m.paths.FoldCase {
+				matchPath, v = strings.ToLower(matchPath), strings.ToLower(v)
+			}
+			if strings.Contains(matchPath, v) {
 				m.logger.Debug("%v skipped because of a mask (%v)", videoFilepath, v)
 				maskedOut = true
 				break
@@ -128,232 +517,1204 @@ func (m *Manager) updateLibraryQueue(ctx *context.Context, wg *sync.WaitGroup, l
 		}
 		// Use the maskedOut variable to continue the iteration over discovered media and not the path masks
 		if maskedOut {
+			summary.record(outcomeMasked, 1)
 			continue
 		}
 
-		pathDispatched, err := m.ds.IsPathDispatched(videoFilepath)
-		if err != nil {
-			m.logger.Error(err.Error())
-			continue
-		}
+		unmasked = append(unmasked, videoFilepath)
+	}
+	return unmasked, multiPartGroups, nil
+}
 
-		if pathDispatched || lib.Queue.InQueuePath(controller.Job{Path: videoFilepath}) {
-			continue
-		}
+// scanBatch runs scanFile on up to concurrency of the paths at once and returns the new jobs in the order of paths,
+// so that the library's QueueOrder is kept. Paths which haven't been started once ctx is finished are skipped.
+// The outcome of every path which doesn't get a job is recorded in summary.
+func (m *Manager) scanBatch(ctx context.Context, lib *controller.Library, paths []string, concurrency int, multiPartGroups map[string]multiPartGroup, queued *queuedPaths, snapshotModtimes map[string]time.Time, summary *scanSummary) []controller.Job {
+	jobs := make([]controller.Job, len(paths))
+	decided := make([]bool, len(paths))
 
-		// Read file metadata from a MetadataReader
-		fMetadata, err := m.metadataReader.Read(videoFilepath)
-		if err != nil {
-			m.logger.Error("Skipping %v because of error: %v", videoFilepath, err)
-			continue
+	wg := sync.WaitGroup{}
+	workers := make(chan struct{}, concurrency)
+	for i, videoFilepath := range paths {
+		// Respect context while iterating over the paths
+		if controller.IsContextFinished(ctx) {
+			break
 		}
 
-		// Run a CommandDecider against the metadata to determine what FFMpeg command to run
-		commandSlice, err := m.commandDecider.Decide(fMetadata, lib.CommandDeciderSettings)
-		if err != nil {
-			m.logger.Debug("Skipping %v because CommandDecider returned error: %v", videoFilepath, err)
-			continue
-		}
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(i int, videoFilepath string) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			jobs[i], decided[i] = m.scanFile(lib, videoFilepath, multiPartGroups[videoFilepath], queued, snapshotModtimes, summary)
+		}(i, videoFilepath)
+	}
+	wg.Wait()
 
-		// Save to Library queue
-		job := controller.Job{
-			UUID:     controller.UUID(uuid.NewString()),
-			Path:     videoFilepath,
-			Command:  commandSlice,
-			Metadata: fMetadata,
+	newJobs := make([]controller.Job, 0, len(paths))
+	for i, job := range jobs {
+		if decided[i] {
+			newJobs = append(newJobs, job)
 		}
-		lib.Queue.Push(job)
-		m.logger.Info("Added %v to Library %v's queue", videoFilepath, lib.ID)
+	}
+	return newJobs
+}
+
+// scanFile refreshes the snapshot of videoFilepath and returns a new job for it if one is required.
+func (m *Manager) scanFile(lib *controller.Library, videoFilepath string, group multiPartGroup, queued *queuedPaths, snapshotModtimes map[string]time.Time, summary *scanSummary) (controller.Job, bool) {
+	m.refreshFileSnapshot(*lib, videoFilepath, snapshotModtimes)
 
-		m.ds.SaveLibrary(lib)
+	if lib.SkipUnchanged && m.unchangedSinceProcessed(videoFilepath) {
+		m.logger.Trace("%v skipped because it hasn't changed since it was last processed", videoFilepath)
+		summary.record(outcomeUnchanged, 1)
+		return controller.Job{}, false
 	}
+
+	return m.reserveAndDecide(lib, videoFilepath, group, queued, summary)
 }
 
-// ImportCompletedJobs takes a list of completed jobs and imports them and their files into the system.
-func (m *Manager) ImportCompletedJobs(jobs []controller.CompletedJob) {
-	for _, cJob := range jobs {
-		// Pop job from dispatched_jobs
-		dJob, err := m.ds.PopDispatchedJob(cJob.UUID)
-		if err != nil {
+// unchangedSinceProcessed returns whether or not the modtime of videoFilepath hasn't advanced past the modtime it had
+// when a job for it was last completed. Files which have never been processed or can't be stated are considered changed.
+func (m *Manager) unchangedSinceProcessed(videoFilepath string) bool {
+	processedModtime, err := m.ds.LastProcessedModtime(m.ctx, videoFilepath)
+	if err != nil {
+		if err != sql.ErrNoRows {
 			m.logger.Error(err.Error())
-			continue
-		}
-
-		// If job failed, log it, save the history entry to the history table, and continue iterating.
-		if cJob.Failed {
-			m.logger.Warn("Job for file %v failed: %v, %v", dJob.Job.Path, cJob.History.Warnings, cJob.History.Errors)
-			if err = m.ds.PushHistory(cJob.History); err != nil {
-				m.logger.Error(err.Error())
-			}
-			continue
 		}
+		return false
+	}
 
-		//? Somewhere in here should be an evaluation from CommandDecider to detect if any plugins want to make more changes. If they do then the file should be placed in a cache location and not the og file location.
-
-		filename := dJob.Job.Path
+	info, err := m.fileStater.Stat(videoFilepath)
+	if err != nil {
+		return false
+	}
 
-		// Remove old file
-		if err = m.fileRemover.Remove(dJob.Job.Path); err != nil {
-			failMessage := fmt.Sprintf("Failed to remove file '%v' because of error: %v", dJob.Job.Path, err)
-			m.logger.Error(failMessage)
+	return !info.ModTime().After(processedModtime)
+}
 
-			// Set filename to a string with an extra encodarr extension
-			fnExt := filepath.Ext(filename)
-			i := strings.LastIndex(filename, fnExt)
-			fnWoExt := filename[:i] + strings.Replace(filename[i:], fnExt, "", 1)
-			filename = fmt.Sprintf("%v.encodarr%v", fnWoExt, fnExt)
+// reserveAndDecide reserves videoFilepath so that concurrent scans can't decide on the same file at the same time.
+// If the path is already reserved by another scan, it is skipped. The reservation is released straight away unless
+// a job is returned, in which case it is kept until the job has been queued by queueJobs and released by releaseReservations.
+func (m *Manager) reserveAndDecide(lib *controller.Library, videoFilepath string, group multiPartGroup, queued *queuedPaths, summary *scanSummary) (controller.Job, bool) {
+	resolvedPath := resolvePath(videoFilepath)
+	if !m.reservations.Reserve(resolvedPath) {
+		m.logger.Debug("%v skipped because another scan is already deciding on it", videoFilepath)
+		summary.record(outcomeAlreadyQueued, 1)
+		return controller.Job{}, false
+	}
 
-			cJob.History.Warnings = append(cJob.History.Warnings, failMessage)
-		}
+	job, ok := m.decideJob(lib, videoFilepath, group, queued, summary)
+	if !ok {
+		m.reservations.Release(resolvedPath)
+	}
+	return job, ok
+}
 
-		// Change filename to have file extension of InFile
-		inFileExt := filepath.Ext(cJob.InFile)
-		fnExt := filepath.Ext(filename)
-		i := strings.LastIndex(filename, fnExt)
-		fnWoExt := filename[:i] + strings.Replace(filename[i:], fnExt, "", 1)
-		filename = fnWoExt + inFileExt
+// releaseReservations releases the reservations which reserveAndDecide kept for the paths of jobs.
+func (m *Manager) releaseReservations(jobs []controller.Job) {
+	for _, job := range jobs {
+		m.reservations.Release(resolvePath(job.Path))
+	}
+}
 
-		// Move new file to old file location
-		if err = m.fileMover.Move(cJob.InFile, filename); err != nil {
-			failMessage := fmt.Sprintf("Failed to move file '%v' because of error: %v", dJob.Job.Path, err)
-			m.logger.Error(failMessage)
+// decideJob returns a new job for the library's queue from newJob unless videoFilepath is already dispatched or queued.
+// queued holds the paths which are known to be in, or about to be added to, the library's queue and videoFilepath
+// is added to it once a job is returned.
+func (m *Manager) decideJob(lib *controller.Library, videoFilepath string, group multiPartGroup, queued *queuedPaths, summary *scanSummary) (controller.Job, bool) {
+	pathDispatched, err := m.ds.IsPathDispatched(m.ctx, videoFilepath)
+	if err != nil {
+		m.logger.Error(err.Error())
+		summary.record(outcomeFailed, 1)
+		return controller.Job{}, false
+	}
 
-			cJob.History.Errors = append(cJob.History.Errors, failMessage)
-		}
+	if pathDispatched {
+		summary.record(outcomeDispatched, 1)
+		return controller.Job{}, false
+	}
+	if queued.contains(videoFilepath) {
+		summary.record(outcomeAlreadyQueued, 1)
+		return controller.Job{}, false
+	}
 
-		// Save history entry to histroy table
-		if err = m.ds.PushHistory(cJob.History); err != nil {
-			m.logger.Error(err.Error())
-		}
+	job, ok := m.newJob(lib, videoFilepath, group, summary)
+	if ok {
+		queued.add(videoFilepath)
 	}
+	return job, ok
 }
 
-// LibrarySettings returns the current settings of each library in the data store.
-func (m *Manager) LibrarySettings() ([]controller.Library, error) {
-	libs, err := m.ds.Libraries()
-
+// newJob reads the metadata of videoFilepath, runs the CommandDecider against it, and returns a new job if a command
+// is required and the file isn't quarantined or completed externally. If the file is part of a multi-part set, the job is tagged with the group
+// so that the parts are imported together. The reason a file doesn't get a job is recorded in summary.
+func (m *Manager) newJob(lib *controller.Library, videoFilepath string, group multiPartGroup, summary *scanSummary) (controller.Job, bool) {
+	pathQuarantined, err := m.ds.IsPathQuarantined(m.ctx, videoFilepath)
 	if err != nil {
 		m.logger.Error(err.Error())
+		summary.record(outcomeFailed, 1)
+		return controller.Job{}, false
 	}
 
-	return libs, err
-}
+	if pathQuarantined {
+		m.logger.Trace("%v skipped because it is quarantined", videoFilepath)
+		summary.record(outcomeQuarantined, 1)
+		return controller.Job{}, false
+	}
 
-// PopNewJob returns and deletes a job from the library queues in order of priority.
-func (m *Manager) PopNewJob() (controller.Job, error) {
-	// Get every library from DataStorer (m.ds.Libraries())
-	libs, err := m.ds.Libraries()
+	pathSkipped, err := m.ds.IsPathSkipped(m.ctx, videoFilepath)
 	if err != nil {
 		m.logger.Error(err.Error())
-		return controller.Job{}, err
+		summary.record(outcomeFailed, 1)
+		return controller.Job{}, false
 	}
 
-	// Sort libraries by decreasing order so that the libraries with the higher priority number dispatch jobs first.
-	sort.Slice(libs, func(i, j int) bool {
-		return libs[i].Priority > libs[j].Priority
-	})
+	if pathSkipped {
+		m.logger.Trace("%v skipped because it was completed externally", videoFilepath)
+		summary.record(outcomeCompletedExternally, 1)
+		return controller.Job{}, false
+	}
 
-	// Loop through sorted slice looking for a job to return
-	for _, l := range libs {
-		for !l.Queue.Empty() {
-			job, err := l.Queue.Pop()
-			if err != nil {
-				if err != controller.ErrEmptyQueue { // Forgoes logging about an empty queue
-					m.logger.Debug("error while searching for job: %v", err)
-				}
-				continue
-			}
+	// Read file metadata from a MetadataReader
+	fMetadata, err := m.readMetadata(*lib, videoFilepath)
+	if err != nil {
+		m.logger.Error("Skipping %v because of error: %v", videoFilepath, err)
+		summary.record(outcomeFailed, 1)
+		return controller.Job{}, false
+	}
 
-			// Skip queue entry if there is an error while stating the file
-			_, err = m.fileStater.Stat(job.Path)
-			if err != nil {
-				m.logger.Debug("skipping queue entry for %v because of error: %v", job.Path, err)
-				continue
-			}
+	// Run a CommandDecider against the metadata to determine what FFMpeg command to run
+	settings := m.deciderSettings(*lib, videoFilepath)
+	commandSlice, err := m.commandDecider.Decide(fMetadata, settings)
+	if err != nil {
+		m.logger.Debug("Skipping %v because CommandDecider returned error: %v", videoFilepath, err)
+		summary.record(outcomeSkippedByDecider, 1)
+		return controller.Job{}, false
+	}
 
-			// Update library in datastore
-			err = m.ds.SaveLibrary(l)
-			if err != nil {
-				m.logger.Error(err.Error())
-			}
+	// A Runner can't run an empty command, so it is treated as a skip. Unlike the errors which the CommandDecider
+	// returns to skip a file, this points at a problem with the CommandDecider or its settings.
+	if len(commandSlice) == 0 {
+		m.logger.Warn("Skipping %v because CommandDecider returned an empty command", videoFilepath)
+		summary.record(outcomeSkippedByDecider, 1)
+		return controller.Job{}, false
+	}
 
-			return job, nil
-		}
+	annotations, err := m.commandDecider.Annotations(settings)
+	if err != nil {
+		m.logger.Error("Skipping %v because the annotations couldn't be read: %v", videoFilepath, err)
+		summary.record(outcomeFailed, 1)
+		return controller.Job{}, false
 	}
 
-	return controller.Job{}, fmt.Errorf("no available jobs")
+	job := controller.Job{
+		UUID:      controller.UUID(uuid.NewString()),
+		LibraryID: lib.ID,
+		Path:      videoFilepath,
+		Command:   commandSlice,
+		Metadata:  fMetadata,
+
+		Group:     group.Key,
+		GroupSize: group.Size,
+
+		Annotations: annotations,
+	}
+	if extractsCaptions(commandSlice) {
+		job.CaptionsPath = captionsPath(videoFilepath)
+	}
+	if info, err := m.fileStater.Stat(videoFilepath); err == nil {
+		job.Size = info.Size()
+	}
+	return job, true
 }
 
-// UpdateLibrarySettings loops through each entry in the provided map and applies the new settings
-// if the key matches a valid library. However, it will not update the ID and Queue fields.
-// If the key doesn't match a valid library, a brand new one with the provided settings is created.
-func (m *Manager) UpdateLibrarySettings(libSettings map[int]controller.Library) {
-	for k, v := range libSettings {
-		lib, err := m.ds.Library(k)
-		if err != nil {
-			// Save brand new library with key as ID and value as library object
-			v.ID = k
-			v.Queue = controller.LibraryQueue{}
-			v.CommandDeciderSettings = m.commandDecider.DefaultSettings()
+// queueJobs adds the new jobs of a scan to the library's queue and returns how many were added. decideJob only checks
+// the library's own queue, so the jobs whose paths are queued by another library (ex. an overlapping folder) or have
+// been dispatched since are left out. Because the scan keeps the paths of its new jobs reserved until they are queued,
+// another scan either sees them in this library's queue or skips them. Errors are logged before they are returned.
+func (m *Manager) queueJobs(libraryID int, jobs []controller.Job) (int, error) {
+	if len(jobs) == 0 {
+		return 0, nil
+	}
 
-			if err = m.ds.SaveLibrary(v); err != nil {
-				m.logger.Error(err.Error())
-			}
+	libs, err := m.ds.Libraries(m.ctx)
+	if err != nil {
+		m.logger.Error("error reading the queues of the other libraries: %v", err)
+		return 0, err
+	}
+	queuedElsewhere := make(map[string]int)
+	for _, lib := range libs {
+		if lib.ID == libraryID {
 			continue
 		}
-
-		lib.Folder = v.Folder
-		lib.Priority = v.Priority
-		lib.FsCheckInterval = v.FsCheckInterval
-		lib.PathMasks = v.PathMasks
-		lib.CommandDeciderSettings = v.CommandDeciderSettings
-
-		if err = m.ds.SaveLibrary(lib); err != nil {
-			m.logger.Error(err.Error())
+		for _, job := range lib.Queue.Items {
+			queuedElsewhere[job.Path] = lib.ID
 		}
 	}
-}
 
-type defaultVideoFileser struct{}
+	kept := make([]controller.Job, 0, len(jobs))
+	for _, job := range jobs {
+		if otherID, ok := queuedElsewhere[job.Path]; ok {
+			m.logger.Debug("%v skipped because it is already queued by Library %v", job.Path, otherID)
+			continue
+		}
 
-func (d defaultVideoFileser) VideoFiles(dir string) ([]string, error) {
-	return GetVideoFilesFromDir(dir)
-}
+		pathDispatched, err := m.ds.IsPathDispatched(m.ctx, job.Path)
+		if err != nil {
+			m.logger.Error(err.Error())
+			return 0, err
+		}
+		if pathDispatched {
+			m.logger.Debug("%v skipped because it was dispatched while it was being decided on", job.Path)
+			continue
+		}
 
-type defaultFileRemover struct{}
+		kept = append(kept, job)
+	}
 
-func (d defaultFileRemover) Remove(path string) error {
-	return os.Remove(path)
+	return m.appendJobs(libraryID, kept)
 }
 
-type defaultFileMover struct{}
-
-func (d defaultFileMover) Move(from, to string) error {
-	inputFile, err := os.Open(from)
-	if err != nil {
-		return fmt.Errorf("couldn't open source file: %s", err)
+// appendJobs adds jobs to the end of the library's queue in a single write and returns how many were added.
+// Jobs whose paths were queued by someone else in the meantime are left out. Errors are logged before they are returned.
+func (m *Manager) appendJobs(libraryID int, jobs []controller.Job) (int, error) {
+	if len(jobs) == 0 {
+		return 0, nil
 	}
 
-	outputFile, err := os.Create(to)
-	if err != nil {
-		inputFile.Close()
-		return fmt.Errorf("couldn't open dest file: %s", err)
+	now := time.Now()
+	for i := range jobs {
+		if jobs[i].QueuedAt.IsZero() {
+			jobs[i].QueuedAt = now
+		}
 	}
-	defer outputFile.Close()
 
-	_, err = io.Copy(outputFile, inputFile)
-	inputFile.Close()
+	appended, err := m.ds.AppendJobs(m.ctx, libraryID, jobs)
 	if err != nil {
-		return fmt.Errorf("writing to output file failed: %s", err)
+		m.logger.Error("error adding %v jobs to Library %v's queue: %v", len(jobs), libraryID, err)
+		return 0, err
 	}
-
-	// The copy was successful, so now delete the original file
-	err = os.Remove(from)
-	if err != nil {
-		return fmt.Errorf("failed removing original file: %s", err)
+	for _, job := range appended {
+		m.logger.Info("Added %v to Library %v's queue", job.Path, libraryID, job.LogFields())
 	}
+	return len(appended), nil
+}
 
-	return nil
+// modifyLibrary reads the library, applies modify to it, and saves it if modify returns true.
+// Scans, dispatches, and settings updates all modify libraries concurrently, so if another change was saved
+// in between, the library is read again and modify is re-applied instead of overwriting the other change.
+func (m *Manager) modifyLibrary(id int, modify func(*controller.Library) bool) error {
+	for attempt := 0; ; attempt++ {
+		lib, err := m.ds.Library(m.ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if !modify(&lib) {
+			return nil
+		}
+
+		err = m.ds.SaveLibrary(m.ctx, lib)
+		if !errors.Is(err, controller.ErrLibraryConflict) || attempt >= maxLibraryConflictRetries {
+			return err
+		}
+		m.logger.Debug("Re-applying a change to Library %v because it was modified concurrently", id)
+	}
+}
+
+// ImportCompletedJobs takes a list of completed jobs and imports them and their files into the system.
+func (m *Manager) ImportCompletedJobs(jobs []controller.CompletedJob) {
+	// importedLibraries is the set of libraries which had at least one job imported in this call.
+	importedLibraries := make(map[int]struct{})
+	defer func() {
+		for id := range importedLibraries {
+			m.checkLibraryComplete(id)
+		}
+	}()
+
+	if !m.heldGroupJobsLoaded {
+		m.loadHeldGroupJobs()
+	}
+
+	for _, id := range m.retryAwaitingSpace() {
+		importedLibraries[id] = struct{}{}
+	}
+
+	for _, cJob := range jobs {
+		// Pop job from dispatched_jobs
+		dJob, err := m.ds.PopDispatchedJob(m.ctx, cJob.UUID)
+		if err == sql.ErrNoRows && cJob.Benchmark != nil {
+			// A benchmark is never matched with a queued job, because that would replace the original.
+			m.logger.Warn("Discarding benchmark %v because it isn't dispatched anymore", cJob.UUID, controller.LogFields{"job_uuid": cJob.UUID})
+			m.discardTranscodedFiles(cJob)
+			continue
+		} else if err == sql.ErrNoRows {
+			var ok bool
+			if dJob, ok = m.adoptCompletedJob(cJob); !ok {
+				continue
+			}
+		} else if err != nil {
+			m.logger.Error("%v", err, controller.LogFields{"job_uuid": cJob.UUID})
+			continue
+		}
+
+		if dJob.Job.Benchmark != nil {
+			m.recordBenchmark(cJob, dJob)
+			continue
+		}
+
+		if !cJob.Failed && dJob.Job.Group == "" && m.completedSinceQueued(dJob.Job) {
+			m.discardDuplicateCompletion(cJob, dJob)
+			continue
+		}
+
+		if !cJob.Failed {
+			cJob = m.checkOutput(cJob, dJob)
+		}
+		if !cJob.Failed {
+			cJob = m.verifyCompletedJob(cJob, dJob)
+		}
+
+		if dJob.Job.Group == "" {
+			if m.importCompletedJob(cJob, dJob) {
+				m.holdForSpace(cJob, dJob)
+			}
+			importedLibraries[dJob.Job.LibraryID] = struct{}{}
+			continue
+		}
+
+		// Hold parts of a multi-part set until every part has completed so that the set is replaced together.
+		// Parts which were never queued (ex. masked out) or which were re-queued after the rest of their set was
+		// imported would be waited on forever, so a set is also imported once none of its parts are left to complete.
+		held := append(m.heldGroupJobs[dJob.Job.Group], heldGroupJob{cJob, dJob})
+		if len(held) < dJob.Job.GroupSize && m.groupPartsPending(dJob.Job) {
+			m.logger.Debug("Holding %v until all %v parts of its multi-part set have completed", dJob.Job.Path, dJob.Job.GroupSize, dJob.Job.LogFields())
+			if err := m.ds.HoldGroupPart(m.ctx, controller.HeldGroupPart{Completed: cJob, Dispatched: dJob}); err != nil {
+				m.logger.Error("error saving the held part %v, it will be lost if the Controller restarts before its set completes: %v", dJob.Job.Path, err, dJob.Job.LogFields())
+			}
+			m.heldGroupJobs[dJob.Job.Group] = held
+			continue
+		}
+		delete(m.heldGroupJobs, dJob.Job.Group)
+
+		m.importGroup(held)
+		if err := m.ds.ReleaseGroupParts(m.ctx, dJob.Job.Group); err != nil {
+			m.logger.Error("error releasing the held parts of the multi-part set %v: %v", dJob.Job.Group, err)
+		}
+		importedLibraries[dJob.Job.LibraryID] = struct{}{}
+	}
+}
+
+// groupPartsPending returns whether or not any other part of job's multi-part set is still queued or dispatched.
+// If that can't be read, the parts are assumed to be pending so that the set isn't imported early.
+func (m *Manager) groupPartsPending(job controller.Job) bool {
+	lib, err := m.ds.Library(m.ctx, job.LibraryID)
+	if err != nil {
+		m.logger.Error("%v", err, job.LogFields())
+		return true
+	}
+	for _, queued := range lib.Queue.Items {
+		if queued.Group == job.Group && queued.UUID != job.UUID {
+			return true
+		}
+	}
+
+	dJobs, err := m.ds.DispatchedJobs(m.ctx)
+	if err != nil {
+		m.logger.Error("%v", err, job.LogFields())
+		return true
+	}
+	for _, dJob := range dJobs {
+		if dJob.Job.Group == job.Group && dJob.UUID != job.UUID {
+			return true
+		}
+	}
+	return false
+}
+
+// loadHeldGroupJobs restores the held parts of multi-part sets from the datastore. If it can't be read, the next
+// ImportCompletedJobs call tries again.
+func (m *Manager) loadHeldGroupJobs() {
+	parts, err := m.ds.HeldGroupParts(m.ctx)
+	if err != nil {
+		m.logger.Error("error reading the held parts of multi-part sets: %v", err)
+		return
+	}
+	m.heldGroupJobsLoaded = true
+
+	restored := 0
+	for _, p := range parts {
+		group := p.Dispatched.Job.Group
+		if heldGroupContains(m.heldGroupJobs[group], p.Completed.UUID) {
+			continue
+		}
+		m.heldGroupJobs[group] = append(m.heldGroupJobs[group], heldGroupJob{p.Completed, p.Dispatched})
+		restored++
+	}
+	if restored > 0 {
+		m.logger.Info("Restored %v completed parts of multi-part sets which are waiting for the rest of their set", restored)
+	}
+}
+
+// heldGroupContains returns whether or not the part with the provided UUID is in held.
+func heldGroupContains(held []heldGroupJob, uuid controller.UUID) bool {
+	for _, h := range held {
+		if h.dJob.UUID == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLibraryComplete emits an EventLibraryComplete if the library has no queued or dispatched jobs left.
+// It is only called after a job from the library has been imported, so a library which hasn't been scanned yet
+// never fires the event.
+func (m *Manager) checkLibraryComplete(libraryID int) {
+	// A running scan may still add to the queue
+	m.scanMutex.Lock()
+	finished, ok := m.workerCompletedMap[libraryID]
+	m.scanMutex.Unlock()
+	if ok && !finished {
+		return
+	}
+
+	lib, err := m.ds.Library(m.ctx, libraryID)
+	if err != nil {
+		m.logger.Error(err.Error())
+		return
+	}
+
+	if !lib.Queue.Empty() {
+		return
+	}
+
+	count, err := m.ds.DispatchedJobCount(m.ctx, libraryID)
+	if err != nil {
+		m.logger.Error(err.Error())
+		return
+	}
+
+	if count > 0 {
+		return
+	}
+
+	m.notifier.Notify(controller.Event{
+		Type:      controller.EventLibraryComplete,
+		LibraryID: libraryID,
+		Message:   fmt.Sprintf("Library %v (%v) has been fully processed", libraryID, lib.Folder),
+		Time:      time.Now(),
+	})
+}
+
+// importGroup imports every part of a multi-part set. If any of the parts failed, none of the originals are replaced.
+func (m *Manager) importGroup(held []heldGroupJob) {
+	groupFailed := false
+	for _, h := range held {
+		if h.cJob.Failed {
+			groupFailed = true
+			break
+		}
+	}
+
+	for _, h := range held {
+		if groupFailed && !h.cJob.Failed {
+			failMessage := fmt.Sprintf("Not replacing '%v' because another part of its multi-part set failed", h.dJob.Job.Path)
+			m.logger.Warn(failMessage, h.dJob.Job.LogFields())
+
+			if err := m.fileRemover.Remove(h.cJob.InFile); err != nil {
+				m.logger.Error("%v", err, h.dJob.Job.LogFields())
+			}
+
+			h.cJob.Failed = true
+			h.cJob.History.Errors = append(h.cJob.History.Errors, failMessage)
+		}
+
+		if m.importCompletedJob(h.cJob, h.dJob) {
+			m.holdForSpace(h.cJob, h.dJob)
+		}
+	}
+}
+
+// verifyCompletedJob runs the library's verification command, if it has one, against the original file and the transcoded file.
+// If the command fails, the transcoded file is removed and the job is marked as failed so that the original is kept.
+func (m *Manager) verifyCompletedJob(cJob controller.CompletedJob, dJob controller.DispatchedJob) controller.CompletedJob {
+	lib, err := m.ds.Library(m.ctx, dJob.Job.LibraryID)
+	if err != nil {
+		m.logger.Error("%v", err, dJob.Job.LogFields())
+		return cJob
+	}
+
+	if len(lib.VerificationCommand) == 0 {
+		return cJob
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.verificationTimeout)
+	defer cancel()
+
+	args := append(append([]string{}, lib.VerificationCommand[1:]...), dJob.Job.Path, cJob.InFile)
+	output, err := m.commandRunner.Run(ctx, lib.VerificationCommand[0], args...)
+	if err == nil {
+		m.logger.Debug("Verification command passed for %v: %s", dJob.Job.Path, output, dJob.Job.LogFields())
+		return cJob
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %v", m.verificationTimeout)
+	}
+
+	failMessage := fmt.Sprintf("Verification command rejected the transcode of '%v': %v", dJob.Job.Path, err)
+	m.logger.Warn("%v: %s", failMessage, output, dJob.Job.LogFields())
+	return m.rejectCompletedJob(cJob, failMessage)
+}
+
+// importCompletedJob replaces the original file of a dispatched job with the result from the Runner and records the history entry.
+// It returns true without recording anything if the library doesn't have space for the transcoded file, which is left in place
+// so that the import can be retried.
+func (m *Manager) importCompletedJob(cJob controller.CompletedJob, dJob controller.DispatchedJob) (awaitingSpace bool) {
+	var err error
+
+	cJob.History.UUID = dJob.UUID
+	cJob.History.Runner = dJob.Runner
+	cJob.History.Failed = cJob.Failed
+	cJob.History.Job = dJob.Job
+
+	// If job failed, log it, save the history entry to the history table, and either retry or quarantine it.
+	if cJob.Failed {
+		m.logger.Warn("Job for file %v failed: %v, %v", dJob.Job.Path, cJob.History.Warnings, cJob.History.Errors, dJob.Job.LogFields())
+		if err = m.ds.PushHistory(m.ctx, cJob.History); err != nil {
+			m.logger.Error("%v", err, dJob.Job.LogFields())
+		}
+
+		m.notifyJob(controller.EventJobFailed, dJob, fmt.Sprintf("Job for %v failed: %v", dJob.Job.Path, strings.Join(cJob.History.Errors, "; ")))
+
+		if err = m.retryOrQuarantine(dJob.Job, strings.Join(cJob.History.Errors, "; ")); err != nil {
+			m.logger.Error("%v", err, dJob.Job.LogFields())
+		}
+		return false
+	}
+
+	if err = m.ds.ResetJobAttempts(m.ctx, dJob.Job.Path); err != nil {
+		m.logger.Error("%v", err, dJob.Job.LogFields())
+	}
+
+	//? Somewhere in here should be an evaluation from CommandDecider to detect if any plugins want to make more changes. If they do then the file should be placed in a cache location and not the og file location.
+
+	filename := dJob.Job.Path
+
+	// The sizes have to be read before the files are replaced
+	originalInfo, originalStatErr := m.fileStater.Stat(dJob.Job.Path)
+	newInfo, newStatErr := m.fileStater.Stat(cJob.InFile)
+
+	// Move the old file out of the way if the library keeps the originals. Otherwise, it is replaced by the move below.
+	keepFailed := false
+	if cJob.History.OriginalPath, err = m.keepOriginal(dJob.Job); err != nil {
+		keepFailed = true
+		failMessage := fmt.Sprintf("Failed to keep file '%v' because of error: %v", dJob.Job.Path, err)
+		m.logger.Error(failMessage, dJob.Job.LogFields())
+
+		// Set filename to a string with an extra encodarr extension
+		fnExt := filepath.Ext(filename)
+		i := strings.LastIndex(filename, fnExt)
+		fnWoExt := filename[:i] + strings.Replace(filename[i:], fnExt, "", 1)
+		filename = fmt.Sprintf("%v.encodarr%v", fnWoExt, fnExt)
+
+		cJob.History.Warnings = append(cJob.History.Warnings, failMessage)
+	}
+
+	// Change filename to have file extension of InFile
+	inFileExt := filepath.Ext(cJob.InFile)
+	fnExt := filepath.Ext(filename)
+	i := strings.LastIndex(filename, fnExt)
+	fnWoExt := filename[:i] + strings.Replace(filename[i:], fnExt, "", 1)
+	filename = fnWoExt + inFileExt
+
+	// Move new file to old file location. This replaces the original in a single step when the names match,
+	// so that a crash never leaves a partial file where the original was.
+	if moveErr := m.fileMover.Move(cJob.InFile, filename); moveErr != nil {
+		failMessage := fmt.Sprintf("Failed to move file '%v' because of error: %v", dJob.Job.Path, moveErr)
+		m.logger.Error(failMessage, dJob.Job.LogFields())
+
+		cJob.History.Errors = append(cJob.History.Errors, failMessage)
+
+		// A kept original can be put back, so that the file isn't missing from the library
+		if cJob.History.OriginalPath != "" {
+			if err = m.fileMover.Move(cJob.History.OriginalPath, dJob.Job.Path); err != nil {
+				m.logger.Error("Failed to restore the original of %v from %v because of error: %v", dJob.Job.Path, cJob.History.OriginalPath, err, dJob.Job.LogFields())
+			} else {
+				cJob.History.OriginalPath = ""
+			}
+		}
+
+		// The library is left as it was, so the import can be tried again once there is space for the transcoded file.
+		if errors.Is(moveErr, controller.ErrInsufficientSpace) && cJob.History.OriginalPath == "" {
+			return true
+		}
+	} else {
+		// An original which the transcoded file didn't replace because its extension changed is only removed now
+		// that the transcoded file is in place.
+		if !keepFailed && cJob.History.OriginalPath == "" && filename != dJob.Job.Path {
+			if err = m.fileRemover.Remove(dJob.Job.Path); err != nil {
+				failMessage := fmt.Sprintf("Failed to remove file '%v' because of error: %v", dJob.Job.Path, err)
+				m.logger.Error(failMessage, dJob.Job.LogFields())
+				cJob.History.Warnings = append(cJob.History.Warnings, failMessage)
+			}
+		}
+
+		// A kept original stays where it was when keeping it failed, so its sidecars stay with it.
+		if !keepFailed && filename != dJob.Job.Path {
+			m.moveSidecars(dJob.Job, filename)
+		}
+
+		if originalStatErr == nil {
+			m.keepOriginalAttributes(filename, originalInfo, dJob.Job.LibraryID)
+		}
+		m.recordProcessed(filename)
+		m.importCaptions(cJob, dJob.Job)
+		if m.mediaServer != nil {
+			m.mediaServer.Refresh(filepath.Dir(filename))
+		}
+
+		// Only jobs which were imported are counted, and a job can only be imported once because it was popped from the
+		// dispatched jobs. This keeps a Runner resending a completed job from counting it twice.
+		if newStatErr == nil {
+			m.recordBudget(newInfo.Size())
+		}
+		completed := jobEvent(controller.EventJobCompleted, dJob, fmt.Sprintf("Replaced %v with its transcoded file", dJob.Job.Path))
+		if originalStatErr == nil && newStatErr == nil {
+			completed.BytesSaved = originalInfo.Size() - newInfo.Size()
+		}
+		m.notifier.Notify(completed)
+
+		if originalStatErr == nil && newStatErr == nil {
+			m.recordSizes(originalInfo.Size(), newInfo.Size())
+			cJob.History.Completion = completionRecord(dJob, cJob.History.Output, originalInfo.Size(), newInfo.Size())
+			m.observeJobDuration(cJob.History.Completion.Elapsed)
+		} else {
+			m.logger.Debug("not recording the size metrics for %v because of errors: %v, %v", dJob.Job.Path, originalStatErr, newStatErr, dJob.Job.LogFields())
+		}
+	}
+
+	// Save history entry to histroy table
+	if err = m.ds.PushHistory(m.ctx, cJob.History); err != nil {
+		m.logger.Error("%v", err, dJob.Job.LogFields())
+	}
+	return false
+}
+
+// importCaptions moves the closed captions that were received with a completed job to the job's CaptionsPath.
+// A failure is only logged because the transcoded file has already replaced the original.
+func (m *Manager) importCaptions(cJob controller.CompletedJob, job controller.Job) {
+	if cJob.CaptionsFile == "" {
+		return
+	}
+
+	if job.CaptionsPath == "" {
+		m.logger.Warn("Received captions for %v, but the job doesn't have a captions path", job.Path, job.LogFields())
+		if err := m.fileRemover.Remove(cJob.CaptionsFile); err != nil {
+			m.logger.Error("%v", err, job.LogFields())
+		}
+		return
+	}
+
+	if err := m.fileMover.Move(cJob.CaptionsFile, job.CaptionsPath); err != nil {
+		m.logger.Error("Failed to move the captions for %v to %v because of error: %v", job.Path, job.CaptionsPath, err, job.LogFields())
+	}
+}
+
+// notifyJob sends an event about a dispatched job.
+func (m *Manager) notifyJob(eventType controller.EventType, dJob controller.DispatchedJob, message string) {
+	m.notifier.Notify(jobEvent(eventType, dJob, message))
+}
+
+// jobEvent returns an event about a dispatched job which carries the job's path, Runner, and annotations.
+func jobEvent(eventType controller.EventType, dJob controller.DispatchedJob, message string) controller.Event {
+	return controller.Event{
+		Type:        eventType,
+		LibraryID:   dJob.Job.LibraryID,
+		Message:     message,
+		Time:        time.Now(),
+		Annotations: dJob.Job.Annotations,
+		JobUUID:     dJob.UUID,
+		Path:        dJob.Job.Path,
+		Runner:      dJob.Runner,
+	}
+}
+
+// recordSizes adds the sizes of an original file and the file that replaced it to the metrics, in a single batch so
+// that a snapshot never shows the bytes read by a job without the rest of its sizes.
+func (m *Manager) recordSizes(originalSize, newSize int64) {
+	m.metrics.Batch(func() {
+		m.bytesRead.Add(float64(originalSize))
+		m.bytesWritten.Add(float64(newSize))
+		m.bytesSaved.Add(float64(originalSize - newSize))
+
+		if originalSize > 0 {
+			m.savingsRatio.Observe(float64(originalSize-newSize) / float64(originalSize))
+		}
+	})
+}
+
+// MetricsSnapshot returns the values of the metrics at a single point in time.
+func (m *Manager) MetricsSnapshot() controller.MetricsSnapshot {
+	return m.metrics.Snapshot()
+}
+
+// recordProcessed saves the current modtime of the file at path so that libraries which skip unchanged files
+// won't consider it again until it is modified.
+func (m *Manager) recordProcessed(path string) {
+	info, err := m.fileStater.Stat(path)
+	if err != nil {
+		m.logger.Error("error stating %v to record it as processed: %v", path, err)
+		return
+	}
+
+	if err = m.ds.SaveLastProcessedModtime(m.ctx, path, info.ModTime()); err != nil {
+		m.logger.Error(err.Error())
+	}
+}
+
+// ReportJobFailure records a failed attempt of the dispatched job with the provided UUID. If the job hasn't
+// reached the maximum number of attempts it is re-queued, otherwise it is quarantined with the provided reason.
+func (m *Manager) ReportJobFailure(uuid controller.UUID, reason string) error {
+	dJob, err := m.ds.PopDispatchedJob(m.ctx, uuid)
+	if err != nil {
+		return err
+	}
+
+	if dJob.Job.Benchmark != nil {
+		m.recordBenchmark(controller.CompletedJob{UUID: uuid, Failed: true, History: controller.History{DateTimeCompleted: m.now(), Errors: []string{reason}}}, dJob)
+		return nil
+	}
+	return m.retryOrQuarantine(dJob.Job, reason)
+}
+
+// retryOrQuarantine increments the attempt counter of job and either pushes it back onto its library's queue
+// or quarantines it if the maximum number of attempts has been reached.
+func (m *Manager) retryOrQuarantine(job controller.Job, reason string) error {
+	attempts, err := m.ds.IncrementJobAttempts(m.ctx, job.Path)
+	if err != nil {
+		return err
+	}
+
+	maxAttempts := m.ss.MaxJobAttempts()
+	if uint64(attempts) < maxAttempts {
+		// A new UUID prevents the retry from being confused with the failed dispatch (ex. a nullified UUID).
+		// The retry is logged on the timeline of the failed job, which names the new UUID.
+		failedFields := job.LogFields()
+		job.UUID = controller.UUID(uuid.NewString())
+
+		requeued := false
+		err = m.modifyLibrary(job.LibraryID, func(lib *controller.Library) bool {
+			requeued = !lib.Queue.InQueuePath(job)
+			if requeued {
+				lib.Queue.Push(job)
+			}
+			return requeued
+		})
+		if err == nil && requeued {
+			m.logger.Info("Re-queued %v as job %v after failed attempt %v of %v", job.Path, job.UUID, attempts, maxAttempts, failedFields)
+		}
+
+		return err
+	}
+
+	m.logger.Warn("Quarantining %v after %v failed attempts: %v", job.Path, attempts, reason, job.LogFields())
+	err = m.ds.QuarantineJob(m.ctx, controller.QuarantinedJob{
+		Job:                 job,
+		Attempts:            attempts,
+		Reason:              reason,
+		DateTimeQuarantined: m.now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The counter is reset so that the job starts fresh if it is ever taken out of quarantine.
+	return m.ds.ResetJobAttempts(m.ctx, job.Path)
+}
+
+// RedecideQueue re-runs the CommandDecider against every job in the library's queue using the library's current
+// settings, overridden by the job's companion file if it has one, and the metadata that was read when the job was
+// queued. Jobs which now have a different command are updated in place and jobs which should now be skipped are
+// removed. Dispatched jobs are no longer in the queue, so they are left untouched.
+func (m *Manager) RedecideQueue(libraryID int) error {
+	return m.modifyLibrary(libraryID, func(lib *controller.Library) bool {
+		kept := make([]controller.Job, 0, len(lib.Queue.Items))
+		changed := false
+
+		for _, job := range lib.Queue.Items {
+			commandSlice, err := m.commandDecider.Decide(job.Metadata, m.deciderSettings(*lib, job.Path))
+			if err != nil {
+				m.logger.Info("Removed %v from Library %v's queue because CommandDecider returned error: %v", job.Path, lib.ID, err, job.LogFields())
+				changed = true
+				continue
+			}
+			if len(commandSlice) == 0 {
+				m.logger.Warn("Removed %v from Library %v's queue because CommandDecider returned an empty command", job.Path, lib.ID, job.LogFields())
+				changed = true
+				continue
+			}
+
+			if !reflect.DeepEqual(commandSlice, job.Command) {
+				m.logger.Debug("Updated the command of %v in Library %v's queue", job.Path, lib.ID, job.LogFields())
+				job.Command = commandSlice
+				changed = true
+			}
+
+			kept = append(kept, job)
+		}
+
+		lib.Queue.Items = kept
+		return changed
+	})
+}
+
+// ScanLibraries marks the provided libraries to be scanned on the next check, regardless of their FsCheckInterval.
+// Libraries which are already being scanned are left alone.
+func (m *Manager) ScanLibraries(ids []int) {
+	m.scanMutex.Lock()
+	defer m.scanMutex.Unlock()
+
+	for _, id := range ids {
+		if finished, ok := m.workerCompletedMap[id]; ok && !finished {
+			continue
+		}
+		m.logger.Debug("Library (ID: %v) scan requested", id, controller.LogFields{"library_id": id})
+		m.lastCheckedTimes[id] = time.Unix(0, 0)
+	}
+}
+
+// RequeueLibrary forgets the modtimes of every file in the library that has already been processed and requests a scan
+// of it, so that files which would otherwise be skipped as unchanged are queued again if the CommandDecider still
+// wants them encoded. Queued and dispatched jobs are left alone.
+func (m *Manager) RequeueLibrary(libraryID int) error {
+	lib, err := m.ds.Library(m.ctx, libraryID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := m.ds.DeleteProcessedModtimes(m.ctx, folderPrefix(lib.Folder))
+	if err != nil {
+		return err
+	}
+	m.logger.Info("Requeuing Library (ID: %v), forgot %v processed files", libraryID, deleted)
+
+	m.ScanLibraries([]int{libraryID})
+	return nil
+}
+
+// purgeDeletedLibraries permanently removes the libraries which have been deleted for longer than the retention period
+// and forgets the processed modtimes of the files in their folders, unless another library still uses the folder.
+func (m *Manager) purgeDeletedLibraries() {
+	purged, err := m.ds.PurgeDeletedLibraries(m.ctx, time.Now().Add(-m.deletedLibraryRetention))
+	if err != nil {
+		m.logger.Error("error purging deleted libraries: %v", err)
+		return
+	}
+	m.forgetPurgedLibraries(purged)
+}
+
+// forgetPurgedLibraries forgets the processed modtimes of the files in the folders of the purged libraries,
+// unless another library still uses the folder.
+func (m *Manager) forgetPurgedLibraries(purged []controller.Library) {
+	if len(purged) == 0 {
+		return
+	}
+
+	libs, err := m.ds.Libraries(m.ctx)
+	if err != nil {
+		m.logger.Error("error reading libraries to forget the processed files of purged libraries: %v", err)
+		return
+	}
+	inUse := make(map[string]struct{}, len(libs))
+	for _, lib := range libs {
+		inUse[lib.Folder] = struct{}{}
+	}
+
+	for _, lib := range purged {
+		forgotten := 0
+		if _, ok := inUse[lib.Folder]; !ok {
+			if forgotten, err = m.ds.DeleteProcessedModtimes(m.ctx, folderPrefix(lib.Folder)); err != nil {
+				m.logger.Error("error forgetting the processed files of purged Library (ID: %v): %v", lib.ID, err)
+			}
+		}
+		m.logger.Info("Purged Library (ID: %v, Folder: %v) which was deleted at %v, forgot %v processed files", lib.ID, lib.Folder, lib.DeletedAt, forgotten)
+	}
+}
+
+// folderPrefix returns the prefix which the paths of all of the files inside of folder start with.
+func folderPrefix(folder string) string {
+	return strings.TrimSuffix(folder, string(filepath.Separator)) + string(filepath.Separator)
+}
+
+// ScanningLibraries returns the IDs of the libraries which are currently being scanned.
+func (m *Manager) ScanningLibraries() []int {
+	m.scanMutex.Lock()
+	defer m.scanMutex.Unlock()
+
+	ids := make([]int, 0)
+	for id, finished := range m.workerCompletedMap {
+		if !finished {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	return ids
+}
+
+// LibrarySettings returns the settings of each library as of the last refresh of the library snapshot.
+// The snapshot is loaded from the data store if it hasn't been yet.
+func (m *Manager) LibrarySettings() ([]controller.Library, error) {
+	if libs, loaded := m.snapshot.Get(); loaded {
+		return append(make([]controller.Library, 0, len(libs)), libs...), nil
+	}
+
+	libs, err := m.RefreshLibraries()
+	if err != nil && !m.datastoreFailing() {
+		m.logger.Error(err.Error())
+	}
+
+	return libs, err
+}
+
+// canonicalizeStoredPaths rewrites the library folders, queued jobs, and other stored paths which aren't canonical
+// (ex. ones saved by an older version or before a path option was changed). Queued jobs which end up with the same
+// path are merged by keeping the first one. Since canonical paths are left alone, only the first run after an upgrade
+// or option change does any work.
+func (m *Manager) canonicalizeStoredPaths() {
+	libs, err := m.ds.Libraries(m.ctx)
+	if err != nil {
+		m.logger.Error("Failed to canonicalize stored paths: %v", err)
+		return
+	}
+
+	for _, lib := range libs {
+		err = m.modifyLibrary(lib.ID, func(l *controller.Library) bool {
+			changed := false
+			if folder := m.paths.Canonicalize(l.Folder); folder != l.Folder {
+				l.Folder = folder
+				changed = true
+			}
+
+			queue := controller.LibraryQueue{Items: make([]controller.Job, 0, len(l.Queue.Items))}
+			for _, job := range l.Queue.Items {
+				if path := m.paths.Canonicalize(job.Path); path != job.Path {
+					job.Path = path
+					changed = true
+				}
+				if queue.InQueuePath(job) {
+					m.logger.Info("Removing %v from Library %v's queue because it was queued twice under different paths", job.Path, l.ID, job.LogFields())
+					changed = true
+					continue
+				}
+				queue.Push(job)
+			}
+			l.Queue = queue
+
+			return changed
+		})
+		if err != nil {
+			m.logger.Error("Failed to canonicalize the paths of Library %v: %v", lib.ID, err)
+		}
+	}
+
+	changed, err := m.ds.CanonicalizePaths(m.ctx, m.paths.Canonicalize)
+	if err != nil {
+		m.logger.Error("Failed to canonicalize stored paths: %v", err)
+		return
+	}
+	if changed > 0 {
+		m.logger.Info("Canonicalized %v stored paths", changed)
+	}
+}
+
+// RefreshLibraries reloads the library snapshot from the data store and returns the libraries.
+// Start refreshes it every tick, but it should also be called after the libraries are modified
+// so that the read APIs reflect the change right away.
+func (m *Manager) RefreshLibraries() ([]controller.Library, error) {
+	libs, err := m.ds.Libraries(m.ctx)
+	if err != nil {
+		return libs, err
+	}
+
+	m.snapshot.Set(libs)
+	return libs, nil
+}
+
+// PopNewJob returns and deletes a job from the library queues in order of priority. Queue aging only decides which
+// library a job is taken from. The pop strategy still decides which of its jobs is taken.
+func (m *Manager) PopNewJob() (controller.Job, error) {
+	// While the data store is down, runners are told that there isn't a job instead of each request failing against it.
+	if !m.ProcessingEnabled() || m.budgetExhausted() || m.datastoreDown() {
+		return controller.Job{}, controller.ErrNoJobAvailable
+	}
+
+	// Get every library from DataStorer (m.ds.Libraries())
+	libs, err := m.ds.Libraries(m.ctx)
+	if err != nil {
+		if !m.datastoreFailing() {
+			m.logger.Error(err.Error())
+		}
+		return controller.Job{}, err
+	}
+
+	reservations, err := m.spaceReservations(libs)
+	if err != nil {
+		if !m.datastoreFailing() {
+			m.logger.Error(err.Error())
+		}
+		return controller.Job{}, err
+	}
+
+	// Loop through the libraries in dispatch order looking for a job to return
+	for _, i := range m.dispatchOrder(libs, time.Now()) {
+		l := libs[i]
+
+		// The queue is popped from a fresh read of the library so that a job pushed since the libraries were listed isn't lost.
+		// A job which doesn't fit on its library's filesystem is left in the queue by not saving the pop.
+		var job controller.Job
+		found := false
+		err = m.modifyLibrary(l.ID, func(lib *controller.Library) bool {
+			job, found = m.popNext(&lib.Queue, m.statSize)
+			if found && !m.fitsSpace(reservations, *lib, job) {
+				found = false
+			}
+			return found
+		})
+		if err != nil {
+			// The job can't be returned if its removal from the queue wasn't saved, otherwise it would be dispatched twice.
+			m.logger.Error(err.Error())
+			continue
+		}
+
+		if found {
+			return job, nil
+		}
+	}
+
+	return controller.Job{}, controller.ErrNoJobAvailable
+}
+
+// UpdateLibrarySettings loops through each entry in the provided map and applies the new settings
+// if the key matches a valid library. However, it will not update the ID and Queue fields, although the queue
+// is re-decided if the CommandDecider settings changed.
+// If the key doesn't match a valid library, a brand new one with the provided settings is created.
+func (m *Manager) UpdateLibrarySettings(libSettings map[int]controller.Library) {
+	for k, v := range libSettings {
+		v.Folder = m.paths.Canonicalize(v.Folder)
+
+		if _, err := m.ds.Library(m.ctx, k); err != nil {
+			// Save brand new library with key as ID and value as library object
+			v.ID = k
+			v.Queue = controller.LibraryQueue{}
+			v.CommandDeciderSettings = m.commandDecider.DefaultSettings()
+			v.Version = 0
+
+			if err = m.ds.SaveLibrary(m.ctx, v); err != nil {
+				m.logger.Error(err.Error())
+			}
+			continue
+		}
+
+		redecide := false
+		err := m.modifyLibrary(k, func(lib *controller.Library) bool {
+			redecide = lib.CommandDeciderSettings != v.CommandDeciderSettings
+
+			lib.Folder = v.Folder
+			lib.Priority = v.Priority
+			lib.FsCheckInterval = v.FsCheckInterval
+			lib.PathMasks = v.PathMasks
+			lib.MultiPartPatterns = v.MultiPartPatterns
+			lib.SkipUnchanged = v.SkipUnchanged
+			lib.VerificationCommand = v.VerificationCommand
+			lib.ScanOnStartup = v.ScanOnStartup
+			lib.QueueOrder = v.QueueOrder
+			lib.StaleJobTimeout = v.StaleJobTimeout
+			lib.StaleJobAction = v.StaleJobAction
+			lib.MetadataReadConcurrency = v.MetadataReadConcurrency
+			lib.MaxQueuedBytes = v.MaxQueuedBytes
+			lib.OriginalFileHandling = v.OriginalFileHandling
+			lib.PreserveModtime = v.PreserveModtime
+			lib.MoveSidecars = v.MoveSidecars
+			lib.Notifications = v.Notifications
+			lib.MetadataReadTimeout = v.MetadataReadTimeout
+			lib.MetadataReadArgs = v.MetadataReadArgs
+			lib.CommandDeciderSettings = v.CommandDeciderSettings
+			return true
+		})
+		if err != nil {
+			m.logger.Error(err.Error())
+			continue
+		}
+
+		if redecide {
+			if err = m.RedecideQueue(k); err != nil {
+				m.logger.Error(err.Error())
+			}
+		}
+	}
+
+	if len(libSettings) > 0 {
+		if _, err := m.RefreshLibraries(); err != nil {
+			m.logger.Error(err.Error())
+		}
+	}
+}
+
+type defaultVideoFileser struct{}
+
+func (d defaultVideoFileser) VideoFiles(dir string) ([]string, error) {
+	return GetVideoFilesFromDir(dir)
+}
+
+type defaultFileRemover struct{}
+
+func (d defaultFileRemover) Remove(path string) error {
+	return os.Remove(path)
+}
+
+type defaultFileMover struct{}
+
+func (d defaultFileMover) Move(from, to string) error {
+	return controller.MoveFile(from, to)
+}
+
+type defaultFileAttributer struct{}
+
+func (d defaultFileAttributer) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (d defaultFileAttributer) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
+func (d defaultFileAttributer) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+type defaultCommandRunner struct{}
+
+func (d defaultCommandRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+type defaultDirReader struct{}
+
+func (d defaultDirReader) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+type defaultFileReader struct{}
+
+func (d defaultFileReader) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+type defaultLoadReporter struct{}
+
+func (d defaultLoadReporter) Load() (float64, error) {
+	return controller.CPULoad()
 }
 
 type defaultFileStater struct{}
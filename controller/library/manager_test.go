@@ -0,0 +1,3244 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/metrics"
+	"github.com/BrenekH/encodarr/controller/runnercommunicator"
+	"github.com/BrenekH/encodarr/controller/trash"
+)
+
+// Two scans deciding on the same path at the same time should only result in a single queued job.
+func TestConcurrentScansQueuePathOnce(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	mr := &mockMetadataReader{entered: make(chan struct{}), proceed: make(chan struct{})}
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, mr, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+	libA := controller.Library{ID: 0}
+	libB := controller.Library{ID: 1}
+	ds.libraries[libA.ID] = libA
+	ds.libraries[libB.ID] = libB
+	path := "/media/movie.mkv"
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if job, ok := m.reserveAndDecide(&libA, path, multiPartGroup{}, newQueuedPaths(controller.LibraryQueue{}), nil); ok {
+			m.queueJobs(libA.ID, []controller.Job{job})
+			m.releaseReservations([]controller.Job{job})
+		}
+	}()
+
+	// Wait for the first worker to hold the reservation before starting the second one.
+	<-mr.entered
+
+	// The second worker should skip the path without ever reaching the MetadataReader.
+	secondDone := make(chan struct{})
+	go func() {
+		if job, ok := m.reserveAndDecide(&libB, path, multiPartGroup{}, newQueuedPaths(controller.LibraryQueue{}), nil); ok {
+			m.queueJobs(libB.ID, []controller.Job{job})
+			m.releaseReservations([]controller.Job{job})
+		}
+		close(secondDone)
+	}()
+
+	select {
+	case <-secondDone:
+	case <-mr.entered:
+		t.Errorf("expected second scan to skip the reserved path")
+		mr.proceed <- struct{}{}
+		<-secondDone
+	}
+
+	close(mr.proceed)
+	wg.Wait()
+
+	if pushes := len(ds.libraries[libA.ID].Queue.Items) + len(ds.libraries[libB.ID].Queue.Items); pushes != 1 {
+		t.Errorf("expected 1 queued job but got %v", pushes)
+	}
+	if ds.appendJobsCalls != 1 {
+		t.Errorf("expected AppendJobs to be called once but it was called %v times", ds.appendJobsCalls)
+	}
+}
+
+// A path stays reserved until its job is queued and should be able to be reserved again once it has been released.
+func TestReservationReleasedAfterQueue(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+	lib := controller.Library{ID: 0}
+	ds.libraries[lib.ID] = lib
+	path := "/media/movie.mkv"
+	job, ok := m.reserveAndDecide(&lib, path, multiPartGroup{}, newQueuedPaths(controller.LibraryQueue{}), nil)
+	if !ok {
+		t.Fatalf("expected a job for %v", path)
+	}
+
+	if m.reservations.Reserve(resolvePath(path)) {
+		t.Fatalf("expected reservation for %v to be kept until its job is queued", path)
+	}
+
+	if _, err := m.queueJobs(lib.ID, []controller.Job{job}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.releaseReservations([]controller.Job{job})
+
+	if !m.reservations.Reserve(resolvePath(path)) {
+		t.Errorf("expected reservation for %v to be released", path)
+	}
+}
+
+// A file in the folders of two libraries should only be queued by the first one to scan it.
+func TestOverlappingLibrariesQueuePathOnce(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: []string{"/media/tv/a.mkv"}}
+	m.fileStater = &mockFileStater{}
+
+	libA := controller.Library{ID: 0, Folder: "/media"}
+	libB := controller.Library{ID: 1, Folder: "/media/tv"}
+	ds.libraries[libA.ID] = libA
+	ds.libraries[libB.ID] = libB
+
+	for _, lib := range []controller.Library{libA, libB} {
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		m.updateLibraryQueue(context.Background(), &wg, lib)
+	}
+
+	if queue := ds.libraries[libA.ID].Queue.Items; len(queue) != 1 {
+		t.Errorf("expected the first library to queue the file but got %+v", queue)
+	}
+	if queue := ds.libraries[libB.ID].Queue.Items; len(queue) != 0 {
+		t.Errorf("expected the second library to skip the file but got %+v", queue)
+	}
+
+	// A job dispatched while the second library was deciding on the file isn't queued again either
+	ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: libA.ID, Path: "/media/tv/a.mkv"}}
+	if appended, err := m.queueJobs(libB.ID, []controller.Job{{UUID: "b", LibraryID: libB.ID, Path: "/media/tv/a.mkv"}}); err != nil || appended != 0 {
+		t.Errorf("expected the dispatched file to be left out but got %v, %v", appended, err)
+	}
+}
+
+// queueVideoFile decides on videoFilepath and adds its job to the library's queue like a scan would.
+func queueVideoFile(m *Manager, lib *controller.Library, videoFilepath string) {
+	if job, ok := m.decideJob(lib, videoFilepath, multiPartGroup{}, newQueuedPaths(controller.LibraryQueue{}), nil); ok {
+		m.appendJobs(lib.ID, []controller.Job{job})
+	}
+}
+
+// A Runner can't run an empty command, so a scan shouldn't queue a file which the CommandDecider returns one for.
+func TestScanSkipsEmptyCommand(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	cd := &mockCommandDecider{decide: func(f controller.FileMetadata, s string) ([]string, error) {
+		return []string{}, nil
+	}}
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, cd, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: []string{"/media/a.mkv", "/media/b.mkv"}}
+	m.fileStater = &mockFileStater{}
+
+	lib := controller.Library{ID: 1}
+	ds.libraries[lib.ID] = lib
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	m.updateLibraryQueue(ctx, &wg, lib)
+
+	if queue := ds.libraries[lib.ID].Queue.Items; len(queue) != 0 {
+		t.Errorf("expected no jobs to be queued but got %+v", queue)
+	}
+}
+
+func TestScanSkipsKeptOriginals(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: []string{
+		"/media/a.mkv",
+		"/media/a.original.mkv",
+		"/media/.encodarr-originals/Show/b.mkv",
+		"/media/originals/c.mkv",
+		"/media/trash/1/20210801-120000.000000000/d.mkv",
+		"/media/trashed.mkv",
+	}}
+	m.fileStater = &mockFileStater{}
+	tr := trash.New(&mockLogger{}, "/media/trash", 0, 0)
+	m.SetTrash(&tr)
+
+	lib := controller.Library{ID: 1, Folder: "/media"}
+	ds.libraries[lib.ID] = lib
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	m.updateLibraryQueue(ctx, &wg, lib)
+
+	queued := make([]string, 0)
+	for _, v := range ds.libraries[lib.ID].Queue.Items {
+		queued = append(queued, v.Path)
+	}
+	if expected := []string{"/media/a.mkv", "/media/originals/c.mkv", "/media/trashed.mkv"}; !reflect.DeepEqual(queued, expected) {
+		t.Errorf("expected %v to be queued but got %v", expected, queued)
+	}
+}
+
+func TestScanSummary(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	mr := &mockMetadataReader{
+		files: map[string]controller.FileMetadata{"/media/hevc.mkv": {VideoTracks: []controller.VideoTrack{{Codec: "HEVC"}}}},
+		errs:  map[string]error{"/media/corrupt.mkv": errors.New("invalid data found when processing input")},
+	}
+	cd := &mockCommandDecider{decide: func(f controller.FileMetadata, s string) ([]string, error) {
+		if len(f.VideoTracks) > 0 && f.VideoTracks[0].Codec == "HEVC" {
+			return nil, errors.New("already HEVC")
+		}
+		return []string{"-i", "ENCODARR_INPUT_FILE"}, nil
+	}}
+	logger := &infoLogger{}
+	m := NewManager(logger, ds, &mockSettingsStorer{}, mr, cd, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: []string{
+		"/media/new.mkv",
+		"/media/new2.mkv",
+		"/media/new.original.mkv",
+		"/media/extras/trailer.mkv",
+		"/media/unchanged.mkv",
+		"/media/dispatched.mkv",
+		"/media/queued.mkv",
+		"/media/quarantined.mkv",
+		"/media/converted.mkv",
+		"/media/hevc.mkv",
+		"/media/corrupt.mkv",
+	}}
+	processed := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	m.fileStater = &mockFileStater{modTimes: map[string]time.Time{"/media/unchanged.mkv": processed}}
+
+	lib := controller.Library{ID: 1, Folder: "/media", PathMasks: []string{"extras"}, SkipUnchanged: true}
+	lib.Queue.Push(controller.Job{UUID: "q", LibraryID: 1, Path: "/media/queued.mkv"})
+	ds.libraries[lib.ID] = lib
+	ds.processed["/media/unchanged.mkv"] = processed
+	ds.dispatchedJobs["d"] = controller.DispatchedJob{UUID: "d", Job: controller.Job{UUID: "d", LibraryID: 1, Path: "/media/dispatched.mkv"}}
+	ds.quarantined["/media/quarantined.mkv"] = controller.QuarantinedJob{}
+	ds.skipped["/media/converted.mkv"] = true
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	m.updateLibraryQueue(ctx, &wg, lib)
+
+	var summary string
+	for _, v := range logger.infos {
+		if strings.HasPrefix(v, "Scan of Library 1 finished") {
+			summary = v
+		}
+	}
+	expected := "11 discovered, 1 ignored, 1 masked, 1 unchanged, 1 already dispatched, 1 already queued, 1 quarantined, 1 completed externally, 1 skipped by the CommandDecider, 1 failed, 0 left for later, 2 queued"
+	if !strings.HasSuffix(summary, expected) {
+		t.Errorf("expected the summary to end with %q but got %q (logged %v)", expected, summary, logger.infos)
+	}
+}
+
+func TestPreviewScan(t *testing.T) {
+	newManager := func(ds *mockLibraryManagerDataStorer) Manager {
+		cd := &mockCommandDecider{decide: func(f controller.FileMetadata, s string) ([]string, error) {
+			return []string{"-i", "ENCODARR_INPUT_FILE"}, nil
+		}}
+		m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, cd, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+		m.videoFileser = &mockVideoFileser{files: []string{
+			"/media/b.mkv",
+			"/media/extras/c.mkv",
+			"/media/a.mkv",
+			"/media/a.original.mkv",
+		}}
+		m.fileStater = &mockFileStater{}
+		return m
+	}
+	lib := controller.Library{ID: 1, Folder: "/media", PathMasks: []string{"extras"}}
+
+	paths := func(jobs []controller.Job) []string {
+		p := make([]string, 0, len(jobs))
+		for _, v := range jobs {
+			p = append(p, v.Path)
+		}
+		return p
+	}
+
+	scanDS := newMockLibraryManagerDataStorer()
+	scanDS.libraries[lib.ID] = lib
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	scanManager := newManager(scanDS)
+	scanManager.updateLibraryQueue(ctx, &wg, lib)
+	scanned := paths(scanDS.libraries[lib.ID].Queue.Items)
+
+	previewDS := newMockLibraryManagerDataStorer()
+	previewDS.libraries[lib.ID] = lib
+	// The preview ignores dispatched jobs, so it should still include a.mkv
+	previewDS.dispatchedJobs[controller.UUID("1")] = controller.DispatchedJob{UUID: "1", Job: controller.Job{UUID: "1", Path: "/media/a.mkv"}}
+
+	previewManager := newManager(previewDS)
+	jobs, err := previewManager.PreviewScan(lib.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if previewed := paths(jobs); !reflect.DeepEqual(previewed, scanned) {
+		t.Errorf("expected the preview %v to match the scan %v", previewed, scanned)
+	}
+	if len(scanned) != 2 {
+		t.Errorf("expected the scan to queue 2 jobs but got %v", scanned)
+	}
+
+	if stored := previewDS.libraries[lib.ID]; len(stored.Queue.Items) != 0 || stored.Version != lib.Version || previewDS.saveLibraryCalls != 0 {
+		t.Errorf("expected the preview not to modify the library but got %+v", stored)
+	}
+	if len(previewDS.snapshots) != 0 {
+		t.Errorf("expected the preview not to save file snapshots but got %v", previewDS.snapshots)
+	}
+
+	if _, err := previewManager.PreviewScan(2); err == nil {
+		t.Errorf("expected an error for an unknown library")
+	}
+}
+
+func TestScanCompanionFileOverride(t *testing.T) {
+	libSettings := `{"use_hardware": false, "target_video_codec": "HEVC"}`
+
+	tests := []struct {
+		name        string
+		companion   string
+		settingsErr error
+		expected    string
+	}{
+		{name: "No Companion File", expected: libSettings},
+		{name: "Override", companion: `{"target_video_codec": "AV1"}`, expected: `{"target_video_codec":"AV1","use_hardware":false}`},
+		{name: "Malformed Companion File", companion: `{"target_video_codec": `, expected: libSettings},
+		{name: "Not an Object", companion: `["AV1"]`, expected: libSettings},
+		{name: "Invalid Settings", companion: `{"use_hardware": true}`, settingsErr: errors.New("hardware_codec must be set"), expected: libSettings},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			// The settings are put at the end of the command so that the test can see which ones were used.
+			cd := &mockCommandDecider{
+				settingsErr: test.settingsErr,
+				decide: func(f controller.FileMetadata, s string) ([]string, error) {
+					return []string{"-i", "ENCODARR_INPUT_FILE", s}, nil
+				},
+			}
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, cd, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.videoFileser = &mockVideoFileser{files: []string{"/media/a.mkv"}}
+			m.fileStater = &mockFileStater{}
+
+			fr := &mockFileReader{files: map[string]string{}}
+			if test.companion != "" {
+				fr.files["/media/a.mkv.encodarr.json"] = test.companion
+			}
+			m.fileReader = fr
+
+			lib := controller.Library{ID: 1, CommandDeciderSettings: libSettings}
+			ds.libraries[lib.ID] = lib
+
+			ctx := context.Background()
+			wg := sync.WaitGroup{}
+			wg.Add(1)
+			m.updateLibraryQueue(ctx, &wg, lib)
+
+			queue := ds.libraries[lib.ID].Queue.Items
+			if len(queue) != 1 {
+				t.Fatalf("expected 1 queued job but got %+v", queue)
+			}
+
+			expected := []string{"-i", "ENCODARR_INPUT_FILE", test.expected}
+			if !reflect.DeepEqual(queue[0].Command, expected) {
+				t.Errorf("expected command %v but got %v", expected, queue[0].Command)
+			}
+		})
+	}
+}
+
+// A scan stops queuing once the source files of the queued jobs reach the library's MaxQueuedBytes. The file which
+// crosses the limit is still queued.
+func TestScanMaxQueuedBytes(t *testing.T) {
+	files := []string{"/media/a.mkv", "/media/b.mkv", "/media/c.mkv", "/media/d.mkv", "/media/e.mkv"}
+	sizes := map[string]int64{"/media/a.mkv": 40, "/media/b.mkv": 40, "/media/c.mkv": 40, "/media/d.mkv": 40, "/media/e.mkv": 40}
+
+	tests := []struct {
+		name           string
+		maxQueuedBytes int64
+		queue          []controller.Job
+		expected       []string
+	}{
+		{name: "Unlimited", expected: files},
+		{name: "Stops at the Boundary", maxQueuedBytes: 120, expected: files[:3]},
+		{name: "Crossing File is Queued", maxQueuedBytes: 100, expected: files[:3]},
+		{name: "Smaller Than One File", maxQueuedBytes: 10, expected: files[:1]},
+		{
+			name:           "Counts the Existing Queue",
+			maxQueuedBytes: 100,
+			queue:          []controller.Job{{UUID: "z", LibraryID: 1, Path: "/media/z.mkv", Size: 80}},
+			expected:       []string{"/media/z.mkv", "/media/a.mkv"},
+		},
+		{
+			name:           "Full Queue",
+			maxQueuedBytes: 100,
+			queue:          []controller.Job{{UUID: "z", LibraryID: 1, Path: "/media/z.mkv", Size: 100}},
+			expected:       []string{"/media/z.mkv"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.videoFileser = &mockVideoFileser{files: files}
+			m.fileStater = &mockFileStater{sizes: sizes}
+
+			lib := controller.Library{ID: 1, MaxQueuedBytes: test.maxQueuedBytes, Queue: controller.LibraryQueue{Items: test.queue}}
+			ds.libraries[lib.ID] = lib
+
+			ctx := context.Background()
+			wg := sync.WaitGroup{}
+			wg.Add(1)
+			m.updateLibraryQueue(ctx, &wg, lib)
+
+			queued := make([]string, 0)
+			for _, job := range ds.libraries[lib.ID].Queue.Items {
+				queued = append(queued, job.Path)
+				if job.UUID != "z" && job.Size != 40 {
+					t.Errorf("expected the size of %v to be recorded as 40 but got %v", job.Path, job.Size)
+				}
+			}
+			if !reflect.DeepEqual(queued, test.expected) {
+				t.Errorf("expected %v to be queued but got %v", test.expected, queued)
+			}
+		})
+	}
+}
+
+// A scan should add the jobs it decides on to the queue in batches instead of one write per job.
+func TestScanAppendsJobsInBatches(t *testing.T) {
+	files := make([]string, 2*appendBatchSize+1)
+	for i := range files {
+		files[i] = fmt.Sprintf("/media/%v.mkv", i)
+	}
+
+	ds := newMockLibraryManagerDataStorer()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: files}
+	m.fileStater = &mockFileStater{}
+
+	lib := controller.Library{ID: 1}
+	ds.libraries[lib.ID] = lib
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	m.updateLibraryQueue(ctx, &wg, lib)
+
+	if n := len(ds.libraries[lib.ID].Queue.Items); n != len(files) {
+		t.Errorf("expected %v queued jobs but got %v", len(files), n)
+	}
+	if ds.appendJobsCalls != 3 {
+		t.Errorf("expected AppendJobs to be called 3 times but it was called %v times", ds.appendJobsCalls)
+	}
+	if ds.saveLibraryCalls != 0 {
+		t.Errorf("expected SaveLibrary not to be called but it was called %v times", ds.saveLibraryCalls)
+	}
+}
+
+func TestScanMaintainsFileSnapshots(t *testing.T) {
+	unchangedModtime := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	changedModtime := time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	ds := newMockLibraryManagerDataStorer()
+	metadataReader := &mockMetadataReader{metadata: controller.FileMetadata{
+		General:     controller.General{Duration: 1320},
+		VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 3840, Height: 2160, ColorPrimaries: "BT.2020"}},
+	}}
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, metadataReader, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: []string{"/media/changed.MKV", "/media/unchanged.mkv", "/media/Extras/masked.mkv"}}
+	m.fileStater = &mockFileStater{
+		modTimes: map[string]time.Time{"/media/changed.MKV": changedModtime, "/media/unchanged.mkv": unchangedModtime, "/media/Extras/masked.mkv": changedModtime},
+		sizes:    map[string]int64{"/media/changed.MKV": 6e9, "/media/unchanged.mkv": 1e9},
+	}
+
+	lib := controller.Library{ID: 2, PathMasks: []string{"Extras"}}
+	ds.libraries[lib.ID] = lib
+
+	ds.snapshots["/media/changed.MKV"] = controller.FileSnapshot{Path: "/media/changed.MKV", LibraryID: 2, VideoCodec: "HEVC", Modtime: unchangedModtime}
+	ds.snapshots["/media/unchanged.mkv"] = controller.FileSnapshot{Path: "/media/unchanged.mkv", LibraryID: 2, VideoCodec: "HEVC", Modtime: unchangedModtime}
+	ds.snapshots["/media/deleted.mkv"] = controller.FileSnapshot{Path: "/media/deleted.mkv", LibraryID: 2, Modtime: unchangedModtime}
+	ds.snapshots["/media/Extras/masked.mkv"] = controller.FileSnapshot{Path: "/media/Extras/masked.mkv", LibraryID: 2, Modtime: changedModtime}
+	ds.snapshots["/other/a.mkv"] = controller.FileSnapshot{Path: "/other/a.mkv", LibraryID: 3, Modtime: unchangedModtime}
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	m.updateLibraryQueue(ctx, &wg, lib)
+
+	expected := map[string]controller.FileSnapshot{
+		"/media/changed.MKV":   {Path: "/media/changed.MKV", LibraryID: 2, VideoCodec: "AVC", Width: 3840, Height: 2160, Duration: 1320, Size: 6e9, Container: "mkv", HDR: true, Modtime: changedModtime},
+		"/media/unchanged.mkv": {Path: "/media/unchanged.mkv", LibraryID: 2, VideoCodec: "HEVC", Modtime: unchangedModtime},
+		"/other/a.mkv":         {Path: "/other/a.mkv", LibraryID: 3, Modtime: unchangedModtime},
+	}
+	if !reflect.DeepEqual(ds.snapshots, expected) {
+		t.Errorf("expected snapshots %+v but got %+v", expected, ds.snapshots)
+	}
+}
+
+func TestScanQueueOrder(t *testing.T) {
+	// Discovered in path order, but b.mkv is the newest and c.mkv is the oldest. d.mkv can't be stated.
+	files := []string{"/media/a.mkv", "/media/b.mkv", "/media/c.mkv", "/media/d.mkv"}
+	modTimes := map[string]time.Time{
+		"/media/a.mkv": time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC),
+		"/media/b.mkv": time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC),
+		"/media/c.mkv": time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name     string
+		order    controller.QueueOrder
+		expected []string
+	}{
+		{name: "Unset", order: "", expected: []string{"/media/a.mkv", "/media/b.mkv", "/media/c.mkv", "/media/d.mkv"}},
+		{name: "Path", order: controller.QueueByPath, expected: []string{"/media/a.mkv", "/media/b.mkv", "/media/c.mkv", "/media/d.mkv"}},
+		{name: "Oldest first", order: controller.QueueOldestFirst, expected: []string{"/media/c.mkv", "/media/a.mkv", "/media/b.mkv", "/media/d.mkv"}},
+		{name: "Newest first", order: controller.QueueNewestFirst, expected: []string{"/media/b.mkv", "/media/a.mkv", "/media/c.mkv", "/media/d.mkv"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.videoFileser = &mockVideoFileser{files: append([]string{}, files...)}
+			m.fileStater = &unstatableFileStater{mockFileStater: mockFileStater{modTimes: modTimes}, unstatable: "/media/d.mkv"}
+
+			lib := controller.Library{ID: 1, QueueOrder: test.order}
+			ds.libraries[lib.ID] = lib
+
+			ctx := context.Background()
+			wg := sync.WaitGroup{}
+			wg.Add(1)
+			m.updateLibraryQueue(ctx, &wg, lib)
+
+			queued := []string{}
+			for _, job := range ds.libraries[lib.ID].Queue.Items {
+				queued = append(queued, job.Path)
+			}
+			if !reflect.DeepEqual(queued, test.expected) {
+				t.Errorf("expected the files to be queued in the order %v but got %v", test.expected, queued)
+			}
+		})
+	}
+}
+
+// Each library's scan reads up to its own MetadataReadConcurrency files at once, while the global limit bounds the reads
+// of all scans together.
+func TestMetadataReadConcurrency(t *testing.T) {
+	tests := []struct {
+		name             string
+		globalLimit      int
+		fastConcurrency  int
+		slowConcurrency  int
+		expectedMaxFast  int
+		expectedMaxSlow  int
+		expectedMaxTotal int
+	}{
+		{name: "Libraries within the global limit", globalLimit: 4, fastConcurrency: 3, slowConcurrency: 1, expectedMaxFast: 3, expectedMaxSlow: 1, expectedMaxTotal: 4},
+		{name: "Global limit caps the total", globalLimit: 2, fastConcurrency: 4, slowConcurrency: 4, expectedMaxFast: 2, expectedMaxSlow: 2, expectedMaxTotal: 2},
+		{name: "Unset uses the global limit", globalLimit: 3, fastConcurrency: 0, slowConcurrency: 1, expectedMaxFast: 3, expectedMaxSlow: 1, expectedMaxTotal: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := folderVideoFileser{}
+			for i := 0; i < 8; i++ {
+				files["/fast"] = append(files["/fast"], fmt.Sprintf("/fast/%v.mkv", i))
+				files["/slow"] = append(files["/slow"], fmt.Sprintf("/slow/%v.mkv", i))
+			}
+
+			reader := newConcurrencyMetadataReader(10 * time.Millisecond)
+			ds := newMockLibraryManagerDataStorer()
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, reader, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.SetMetadataReadConcurrency(test.globalLimit)
+			m.videoFileser = files
+			m.fileStater = &mockFileStater{}
+
+			fast := controller.Library{ID: 1, Folder: "/fast", MetadataReadConcurrency: test.fastConcurrency}
+			slow := controller.Library{ID: 2, Folder: "/slow", MetadataReadConcurrency: test.slowConcurrency}
+			ds.libraries[fast.ID] = fast
+			ds.libraries[slow.ID] = slow
+
+			ctx := context.Background()
+			wg := sync.WaitGroup{}
+			wg.Add(2)
+			go m.updateLibraryQueue(ctx, &wg, fast)
+			go m.updateLibraryQueue(ctx, &wg, slow)
+			wg.Wait()
+
+			if max := reader.maxPerFolder["/fast"]; max > test.expectedMaxFast || max < 2 {
+				t.Errorf("expected the fast library to read between 2 and %v files at once but it read %v", test.expectedMaxFast, max)
+			}
+			if max := reader.maxPerFolder["/slow"]; max > test.expectedMaxSlow {
+				t.Errorf("expected the slow library to read at most %v files at once but it read %v", test.expectedMaxSlow, max)
+			}
+			if reader.maxTotal > test.expectedMaxTotal {
+				t.Errorf("expected at most %v reads at once but there were %v", test.expectedMaxTotal, reader.maxTotal)
+			}
+
+			// Reading the files at once mustn't change the order that they are queued in
+			for _, lib := range []controller.Library{fast, slow} {
+				queued := []string{}
+				for _, job := range ds.libraries[lib.ID].Queue.Items {
+					queued = append(queued, job.Path)
+				}
+				if !reflect.DeepEqual(queued, files[lib.Folder]) {
+					t.Errorf("expected Library %v to queue %v but got %v", lib.ID, files[lib.Folder], queued)
+				}
+			}
+		})
+	}
+}
+
+func TestMetadataReadOptions(t *testing.T) {
+	reader := &mockMetadataReader{}
+	ds := newMockLibraryManagerDataStorer()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, reader, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = folderVideoFileser{"/tv": {"/tv/a.ts"}, "/movies": {"/movies/b.mkv"}}
+	m.fileStater = &mockFileStater{}
+
+	overridden := controller.Library{ID: 1, Folder: "/tv", MetadataReadTimeout: 5 * time.Minute, MetadataReadArgs: []string{"--ParseSpeed=1"}}
+	global := controller.Library{ID: 2, Folder: "/movies"}
+	ds.libraries[overridden.ID] = overridden
+	ds.libraries[global.ID] = global
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	m.updateLibraryQueue(ctx, &wg, overridden)
+	m.updateLibraryQueue(ctx, &wg, global)
+
+	expected := controller.MetadataReadOptions{Timeout: 5 * time.Minute, Args: []string{"--ParseSpeed=1"}}
+	if opts := reader.readOpts["/tv/a.ts"]; !reflect.DeepEqual(opts, expected) {
+		t.Errorf("expected /tv/a.ts to be read with %+v but got %+v", expected, opts)
+	}
+	if opts, ok := reader.readOpts["/movies/b.mkv"]; !ok || !reflect.DeepEqual(opts, controller.MetadataReadOptions{}) {
+		t.Errorf("expected /movies/b.mkv to be read with the global options but got %+v (read: %v)", opts, ok)
+	}
+}
+
+func TestLibraryCompleteEvent(t *testing.T) {
+	tests := []struct {
+		name           string
+		queue          []controller.Job
+		batches        [][]controller.UUID
+		expectedEvents []int // Expected number of events after each batch
+	}{
+		{
+			name:           "Fires once when the last job completes",
+			batches:        [][]controller.UUID{{"a"}, {"b"}},
+			expectedEvents: []int{0, 1},
+		},
+		{
+			name:           "Fires once when the last jobs complete together",
+			batches:        [][]controller.UUID{{"a", "b"}},
+			expectedEvents: []int{1},
+		},
+		{
+			name:           "Doesn't fire while the queue still has jobs",
+			queue:          []controller.Job{{UUID: "c", LibraryID: 1, Path: "/media/c.mkv"}},
+			batches:        [][]controller.UUID{{"a", "b"}},
+			expectedEvents: []int{0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1, Queue: controller.LibraryQueue{Items: test.queue}}
+			ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/a.mkv"}}
+			ds.dispatchedJobs["b"] = controller.DispatchedJob{UUID: "b", Job: controller.Job{UUID: "b", LibraryID: 1, Path: "/media/b.mkv"}}
+			ds.dispatchedJobs["other"] = controller.DispatchedJob{UUID: "other", Job: controller.Job{UUID: "other", LibraryID: 2, Path: "/other/a.mkv"}}
+
+			n := mockNotifier{}
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &n, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.fileRemover = &mockFileRemover{}
+			m.fileMover = &mockFileMover{}
+
+			for i, batch := range test.batches {
+				cJobs := make([]controller.CompletedJob, 0, len(batch))
+				for _, u := range batch {
+					cJobs = append(cJobs, controller.CompletedJob{UUID: u, InFile: string(u) + ".import.mkv"})
+				}
+
+				m.ImportCompletedJobs(cJobs)
+
+				if got := len(libraryCompleteEvents(n.events)); got != test.expectedEvents[i] {
+					t.Fatalf("expected %v events after batch %v but got %v", test.expectedEvents[i], i, got)
+				}
+			}
+
+			for _, e := range libraryCompleteEvents(n.events) {
+				if e.LibraryID != 1 {
+					t.Errorf("unexpected event: %+v", e)
+				}
+			}
+		})
+	}
+}
+
+// libraryCompleteEvents filters out the job events which are sent alongside the library complete events.
+func libraryCompleteEvents(events []controller.Event) []controller.Event {
+	filtered := make([]controller.Event, 0, len(events))
+	for _, e := range events {
+		if e.Type == controller.EventLibraryComplete {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+func TestReportJobFailure(t *testing.T) {
+	// A failure is reported either directly or by a Runner completing the job as failed.
+	reporters := map[string]func(m *Manager) error{
+		"ReportJobFailure": func(m *Manager) error { return m.ReportJobFailure("a", "ffmpeg exited with code 1") },
+		"Import": func(m *Manager) error {
+			m.ImportCompletedJobs([]controller.CompletedJob{failedJob("a")})
+			return nil
+		},
+	}
+
+	tests := []struct {
+		name              string
+		maxAttempts       uint64
+		previousAttempts  int
+		expectRequeued    bool
+		expectQuarantined bool
+	}{
+		{name: "Re-queued under the limit", maxAttempts: 3, previousAttempts: 0, expectRequeued: true},
+		{name: "Re-queued one below the limit", maxAttempts: 3, previousAttempts: 1, expectRequeued: true},
+		{name: "Quarantined at the limit", maxAttempts: 3, previousAttempts: 2, expectQuarantined: true},
+		{name: "Quarantined immediately without retries", maxAttempts: 1, previousAttempts: 0, expectQuarantined: true},
+	}
+
+	for reporterName, report := range reporters {
+		for _, test := range tests {
+			t.Run(reporterName+"/"+test.name, func(t *testing.T) {
+				path := "/media/a.mkv"
+				ds := newMockLibraryManagerDataStorer()
+				ds.libraries[1] = controller.Library{ID: 1}
+				ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: path}}
+				ds.attempts[path] = test.previousAttempts
+
+				m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{maxJobAttempts: test.maxAttempts}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+				if err := report(&m); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if _, ok := ds.dispatchedJobs["a"]; ok {
+					t.Errorf("expected job to be removed from the dispatched jobs")
+				}
+
+				queue := ds.libraries[1].Queue.Items
+				if requeued := len(queue) == 1 && queue[0].Path == path; requeued != test.expectRequeued {
+					t.Errorf("expected re-queued to be %v but the queue was %v", test.expectRequeued, queue)
+				}
+				if test.expectRequeued && queue[0].UUID == "a" {
+					t.Errorf("expected re-queued job to have a new UUID")
+				}
+
+				q, quarantined := ds.quarantined[path]
+				if quarantined != test.expectQuarantined {
+					t.Fatalf("expected quarantined to be %v but got %v", test.expectQuarantined, quarantined)
+				}
+
+				if quarantined {
+					if q.Reason != "ffmpeg exited with code 1" {
+						t.Errorf("expected reason to be recorded but got '%v'", q.Reason)
+					}
+					if q.Attempts != test.previousAttempts+1 {
+						t.Errorf("expected %v attempts but got %v", test.previousAttempts+1, q.Attempts)
+					}
+				} else if ds.attempts[path] != test.previousAttempts+1 {
+					t.Errorf("expected %v attempts but got %v", test.previousAttempts+1, ds.attempts[path])
+				}
+			})
+		}
+	}
+}
+
+func TestReportJobFailureUnknownJob(t *testing.T) {
+	m := NewManager(&mockLogger{}, newMockLibraryManagerDataStorer(), &mockSettingsStorer{maxJobAttempts: 3}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+	if err := m.ReportJobFailure("missing", ""); err == nil {
+		t.Errorf("expected an error for an unknown job")
+	}
+}
+
+func TestQuarantineExpiry(t *testing.T) {
+	tests := []struct {
+		name          string
+		expiry        time.Duration
+		elapsed       time.Duration
+		expectQueued  bool
+		expectRelease bool
+	}{
+		{name: "Before The Expiry", expiry: 24 * time.Hour, elapsed: 23 * time.Hour},
+		{name: "After The Expiry", expiry: 24 * time.Hour, elapsed: 25 * time.Hour, expectQueued: true, expectRelease: true},
+		{name: "Permanent", expiry: 0, elapsed: 365 * 24 * time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := "/media/a.mkv"
+			ds := newMockLibraryManagerDataStorer()
+			lib := controller.Library{ID: 1, FsCheckInterval: time.Hour}
+			ds.libraries[lib.ID] = lib
+			ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: lib.ID, Path: path}}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{maxJobAttempts: 1, quarantineExpiry: test.expiry}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.videoFileser = &mockVideoFileser{files: []string{path}}
+			m.fileStater = &mockFileStater{}
+
+			now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+			m.now = func() time.Time { return now }
+
+			m.ImportCompletedJobs([]controller.CompletedJob{failedJob("a")})
+			if _, ok := ds.quarantined[path]; !ok {
+				t.Fatalf("expected %v to be quarantined", path)
+			}
+
+			now = now.Add(test.elapsed)
+			ctx := context.Background()
+			wg := sync.WaitGroup{}
+			m.scheduleScans(ctx, &wg, []controller.Library{lib}, false)
+			wg.Wait()
+
+			if _, quarantined := ds.quarantined[path]; quarantined == test.expectRelease {
+				t.Errorf("expected released to be %v", test.expectRelease)
+			}
+			if queued := len(ds.libraries[lib.ID].Queue.Items) == 1; queued != test.expectQueued {
+				t.Errorf("expected queued to be %v but the queue was %v", test.expectQueued, ds.libraries[lib.ID].Queue.Items)
+			}
+		})
+	}
+}
+
+// failedJob returns the job with the provided UUID as it is received from a Runner which failed to transcode it.
+func failedJob(uuid controller.UUID) controller.CompletedJob {
+	return controller.CompletedJob{UUID: uuid, Failed: true, History: controller.History{Errors: []string{"ffmpeg exited with code 1"}}}
+}
+
+func TestHandleStaleJobs(t *testing.T) {
+	tests := []struct {
+		name           string
+		action         controller.StaleJobAction
+		expectAttempts int
+		expectHistory  bool
+	}{
+		{name: "Requeue", action: controller.StaleJobRequeue},
+		{name: "Fail", action: controller.StaleJobFail, expectAttempts: 1, expectHistory: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := "/media/a.mkv"
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1}
+			n := mockNotifier{}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{maxJobAttempts: 3}, &mockMetadataReader{}, &mockCommandDecider{}, &n, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+			m.HandleStaleJobs([]controller.StaleJob{{
+				DispatchedJob: controller.DispatchedJob{UUID: "a", Runner: "Runner", Job: controller.Job{UUID: "a", LibraryID: 1, Path: path}},
+				Action:        test.action,
+				Reason:        "the Runner runner was unresponsive",
+			}})
+
+			queue := ds.libraries[1].Queue.Items
+			if len(queue) != 1 || queue[0].Path != path {
+				t.Fatalf("expected the job to be re-queued but the queue was %v", queue)
+			}
+			if queue[0].UUID == "a" {
+				t.Errorf("expected re-queued job to have a new UUID")
+			}
+
+			if ds.attempts[path] != test.expectAttempts {
+				t.Errorf("expected %v attempts but got %v", test.expectAttempts, ds.attempts[path])
+			}
+
+			if hasHistory := len(ds.history) == 1 && ds.history[0].Failed && ds.history[0].UUID == "a"; hasHistory != test.expectHistory {
+				t.Errorf("expected a failed history entry to be %v but got %+v", test.expectHistory, ds.history)
+			}
+			if notified := len(n.events) == 1 && n.events[0].Type == controller.EventJobFailed; notified != test.expectHistory {
+				t.Errorf("expected a job failed event to be %v but got %+v", test.expectHistory, n.events)
+			}
+		})
+	}
+}
+
+// A quarantined path shouldn't be queued again by a library scan.
+func TestQuarantinedPathNotQueued(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	path := "/media/a.mkv"
+	ds.quarantined[path] = controller.QuarantinedJob{Job: controller.Job{Path: path}}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{maxJobAttempts: 3}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+	lib := controller.Library{ID: 1}
+	queueVideoFile(&m, &lib, path)
+
+	if len(lib.Queue.Items) != 0 {
+		t.Errorf("expected quarantined path to not be queued")
+	}
+}
+
+func TestScanLibraries(t *testing.T) {
+	m := NewManager(&mockLogger{}, newMockLibraryManagerDataStorer(), &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+	now := time.Now()
+	m.lastCheckedTimes[1] = now
+	m.lastCheckedTimes[2] = now
+	m.workerCompletedMap[1] = true
+	m.workerCompletedMap[2] = false
+
+	if scanning := m.ScanningLibraries(); !reflect.DeepEqual(scanning, []int{2}) {
+		t.Errorf("expected [2] to be scanning but got %v", scanning)
+	}
+
+	m.ScanLibraries([]int{1, 2})
+
+	if !m.lastCheckedTimes[1].Equal(time.Unix(0, 0)) {
+		t.Errorf("expected library 1 to be marked for an immediate scan")
+	}
+	if !m.lastCheckedTimes[2].Equal(now) {
+		t.Errorf("expected library 2 to be left alone while it is being scanned")
+	}
+}
+
+func TestRedecideQueue(t *testing.T) {
+	hevc := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "HEVC"}}}
+	avc := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC"}}}
+
+	// Skips files which are already in the target codec and otherwise encodes to it.
+	cd := &mockCommandDecider{decide: func(f controller.FileMetadata, s string) ([]string, error) {
+		if f.VideoTracks[0].Codec == strings.ToUpper(s) {
+			return nil, errors.New("already in target codec")
+		}
+		return []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", s}, nil
+	}}
+
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{
+		ID:                     1,
+		CommandDeciderSettings: "avc",
+		Queue: controller.LibraryQueue{Items: []controller.Job{
+			{UUID: "a", LibraryID: 1, Path: "/media/a.mkv", Metadata: hevc, Command: []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", "avc"}},
+			{UUID: "b", LibraryID: 1, Path: "/media/b.mkv", Metadata: avc, Command: []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", "avc"}},
+		}},
+	}
+	dispatchedCommand := []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", "avc"}
+	ds.dispatchedJobs["c"] = controller.DispatchedJob{UUID: "c", Job: controller.Job{UUID: "c", LibraryID: 1, Path: "/media/c.mkv", Metadata: hevc, Command: dispatchedCommand}}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, cd, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+	m.UpdateLibrarySettings(map[int]controller.Library{1: {CommandDeciderSettings: "hevc"}})
+
+	queue := ds.libraries[1].Queue.Items
+	if len(queue) != 1 {
+		t.Fatalf("expected 1 job to remain queued but got %v", queue)
+	}
+
+	if queue[0].UUID != "b" {
+		t.Errorf("expected job b to remain queued but got %v", queue[0].UUID)
+	}
+	if expected := []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", "hevc"}; !reflect.DeepEqual(queue[0].Command, expected) {
+		t.Errorf("expected command %v but got %v", expected, queue[0].Command)
+	}
+
+	if !reflect.DeepEqual(ds.dispatchedJobs["c"].Job.Command, dispatchedCommand) {
+		t.Errorf("expected dispatched job to be untouched but its command is %v", ds.dispatchedJobs["c"].Job.Command)
+	}
+}
+
+func TestRedecideQueueUnchanged(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Queue: controller.LibraryQueue{Items: []controller.Job{
+		{UUID: "a", LibraryID: 1, Path: "/media/a.mkv", Command: []string{"-i", "ENCODARR_INPUT_FILE"}},
+	}}}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+	if err := m.RedecideQueue(1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ds.saveLibraryCalls != 0 {
+		t.Errorf("expected library to not be saved when nothing changed")
+	}
+}
+
+func TestUpdateLibrarySettingsKeepsEveryField(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media/tv", Version: 1}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+	updated := controller.Library{
+		Folder:                  "/media/movies",
+		Priority:                2,
+		FsCheckInterval:         time.Hour,
+		PathMasks:               []string{"Samples"},
+		MultiPartPatterns:       []string{`(?i)cd(\d+)`},
+		SkipUnchanged:           true,
+		VerificationCommand:     []string{"verify"},
+		ScanOnStartup:           true,
+		QueueOrder:              controller.QueueNewestFirst,
+		StaleJobTimeout:         time.Minute,
+		StaleJobAction:          controller.StaleJobFail,
+		MetadataReadConcurrency: 3,
+		MaxQueuedBytes:          1024,
+		OriginalFileHandling:    controller.OriginalKeepRenamed,
+		PreserveModtime:         true,
+		MoveSidecars:            true,
+		Notifications: controller.LibraryNotifications{
+			Webhooks:      []controller.LibraryWebhook{{Type: controller.NotificationDiscord, URL: "https://discord.example/hook", Events: []controller.EventType{controller.EventJobCompleted}}},
+			ReplaceGlobal: true,
+		},
+		MetadataReadTimeout:    time.Second,
+		MetadataReadArgs:       []string{"--full"},
+		CommandDeciderSettings: "hevc",
+	}
+
+	// Every setting has to be changed by the update for the test to catch one which isn't kept
+	notSettings := map[string]bool{"ID": true, "Queue": true, "Version": true, "DeletedAt": true}
+	uv, sv := reflect.ValueOf(updated), reflect.ValueOf(ds.libraries[1])
+	for i := 0; i < uv.NumField(); i++ {
+		name := uv.Type().Field(i).Name
+		if !notSettings[name] && reflect.DeepEqual(uv.Field(i).Interface(), sv.Field(i).Interface()) {
+			t.Fatalf("expected the update to change %v", name)
+		}
+	}
+
+	m.UpdateLibrarySettings(map[int]controller.Library{1: updated})
+
+	expected := updated
+	expected.ID = 1
+	expected.Version = 2
+	if !reflect.DeepEqual(ds.libraries[1], expected) {
+		t.Errorf("expected library %+v but got %+v", expected, ds.libraries[1])
+	}
+}
+
+func TestMoveJob(t *testing.T) {
+	hevc := controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "HEVC"}}}
+
+	// Skips files which are already in the target codec and otherwise encodes to it.
+	cd := &mockCommandDecider{decide: func(f controller.FileMetadata, s string) ([]string, error) {
+		if f.VideoTracks[0].Codec == strings.ToUpper(s) {
+			return nil, errors.New("already in target codec")
+		}
+		return []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", s}, nil
+	}}
+
+	tests := []struct {
+		name          string
+		uuid          controller.UUID
+		target        int
+		expectedErr   error
+		expectMoved   bool
+		expectedQueue []controller.UUID // Library 2's queue after the call
+	}{
+		{name: "Queued job", uuid: "a", target: 2, expectMoved: true, expectedQueue: []controller.UUID{"z", "a"}},
+		{name: "Dispatched job", uuid: "c", target: 2, expectedErr: controller.ErrJobDispatched, expectedQueue: []controller.UUID{"z"}},
+		{name: "Unknown target", uuid: "a", target: 3, expectedErr: errMockNotFound, expectedQueue: []controller.UUID{"z"}},
+		{name: "Unknown job", uuid: "x", target: 2, expectedErr: controller.ErrJobNotFound, expectedQueue: []controller.UUID{"z"}},
+		{name: "Target library skips the job", uuid: "a", target: 4, expectedErr: controller.ErrJobNotMovable, expectedQueue: []controller.UUID{"z"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1, CommandDeciderSettings: "avc", Queue: controller.LibraryQueue{Items: []controller.Job{
+				{UUID: "a", LibraryID: 1, Path: "/media/a.mkv", Metadata: hevc, Command: []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", "avc"}},
+				{UUID: "b", LibraryID: 1, Path: "/media/b.mkv", Metadata: hevc, Command: []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", "avc"}},
+			}}}
+			ds.libraries[2] = controller.Library{ID: 2, CommandDeciderSettings: "av1", Queue: controller.LibraryQueue{Items: []controller.Job{
+				{UUID: "z", LibraryID: 2, Path: "/media/z.mkv", Metadata: hevc},
+			}}}
+			ds.libraries[4] = controller.Library{ID: 4, CommandDeciderSettings: "hevc"}
+			ds.dispatchedJobs["c"] = controller.DispatchedJob{UUID: "c", Job: controller.Job{UUID: "c", LibraryID: 1, Path: "/media/c.mkv", Metadata: hevc}}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, cd, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+			err := m.MoveJob(test.uuid, test.target)
+			if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error %v but got %v", test.expectedErr, err)
+			}
+			if test.expectedErr == nil && test.expectMoved && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !test.expectMoved && err == nil {
+				t.Errorf("expected an error but got nil")
+			}
+
+			uuids := make([]controller.UUID, 0)
+			for _, v := range ds.libraries[2].Queue.Items {
+				uuids = append(uuids, v.UUID)
+			}
+			if !reflect.DeepEqual(uuids, test.expectedQueue) {
+				t.Errorf("expected Library 2's queue to be %v but got %v", test.expectedQueue, uuids)
+			}
+
+			sourceQueue := ds.libraries[1].Queue.Items
+			if moved := len(sourceQueue) == 1; moved != test.expectMoved {
+				t.Errorf("expected the job to be removed from Library 1's queue to be %v but got %+v", test.expectMoved, sourceQueue)
+			}
+
+			if test.expectMoved {
+				moved := ds.libraries[2].Queue.Items[1]
+				if moved.LibraryID != 2 {
+					t.Errorf("expected the moved job to belong to Library 2 but got %v", moved.LibraryID)
+				}
+				if expected := []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", "av1"}; !reflect.DeepEqual(moved.Command, expected) {
+					t.Errorf("expected the command to be decided under Library 2's settings (%v) but got %v", expected, moved.Command)
+				}
+			}
+		})
+	}
+}
+
+func TestSkipUnchangedFiles(t *testing.T) {
+	processed := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	path := "/media/a.mkv"
+
+	tests := []struct {
+		name          string
+		skipUnchanged bool
+		processed     bool
+		modtime       time.Time
+		expectRead    bool
+	}{
+		{name: "Unchanged file is skipped", skipUnchanged: true, processed: true, modtime: processed, expectRead: false},
+		{name: "Modified file is considered", skipUnchanged: true, processed: true, modtime: processed.Add(time.Second), expectRead: true},
+		{name: "Never processed file is considered", skipUnchanged: true, processed: false, modtime: processed, expectRead: true},
+		{name: "Unchanged file is considered when disabled", skipUnchanged: false, processed: true, modtime: processed, expectRead: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			if test.processed {
+				ds.processed[path] = processed
+			}
+			// An up-to-date snapshot means that the metadata is only read to decide on a job
+			ds.snapshots[path] = controller.FileSnapshot{Path: path, LibraryID: 1, Modtime: test.modtime}
+
+			mr := &mockMetadataReader{}
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, mr, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.videoFileser = &mockVideoFileser{files: []string{path}}
+			m.fileStater = &mockFileStater{modTimes: map[string]time.Time{path: test.modtime}}
+
+			ctx := context.Background()
+			wg := sync.WaitGroup{}
+			wg.Add(1)
+			lib := controller.Library{ID: 1, SkipUnchanged: test.skipUnchanged}
+			ds.libraries[lib.ID] = lib
+			m.updateLibraryQueue(ctx, &wg, lib)
+
+			if read := len(mr.read) > 0; read != test.expectRead {
+				t.Errorf("expected metadata read to be %v but reads were %v", test.expectRead, mr.read)
+			}
+			if queued := len(ds.libraries[1].Queue.Items) > 0; queued != test.expectRead {
+				t.Errorf("expected queued to be %v", test.expectRead)
+			}
+		})
+	}
+}
+
+func TestRequeueLibrary(t *testing.T) {
+	processed := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	path := "/media/tv/a.mkv"
+	otherPath := "/media/tv2/b.mkv"
+
+	ds := newMockLibraryManagerDataStorer()
+	ds.processed[path] = processed
+	ds.processed[otherPath] = processed
+	lib := controller.Library{ID: 1, Folder: "/media/tv", SkipUnchanged: true}
+	ds.libraries[lib.ID] = lib
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: []string{path}}
+	m.fileStater = &mockFileStater{modTimes: map[string]time.Time{path: processed}}
+
+	scan := func() {
+		ctx := context.Background()
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		m.updateLibraryQueue(ctx, &wg, ds.libraries[lib.ID])
+	}
+
+	scan()
+	if len(ds.libraries[lib.ID].Queue.Items) != 0 {
+		t.Fatalf("expected the unchanged file to be skipped before requeuing")
+	}
+
+	if err := m.RequeueLibrary(lib.ID); err != nil {
+		t.Fatalf("RequeueLibrary: %v", err)
+	}
+	if !m.lastCheckedTimes[lib.ID].Equal(time.Unix(0, 0)) {
+		t.Errorf("expected a scan of the library to be requested")
+	}
+	if _, ok := ds.processed[otherPath]; !ok {
+		t.Errorf("expected the processed modtime of a file outside of the library to be kept")
+	}
+
+	scan()
+	if len(ds.libraries[lib.ID].Queue.Items) != 1 {
+		t.Errorf("expected the unchanged file to be queued after requeuing but the queue is %v", ds.libraries[lib.ID].Queue.Items)
+	}
+
+	if err := m.RequeueLibrary(2); err == nil {
+		t.Errorf("expected an error when requeuing an unknown library")
+	}
+}
+
+func TestPurgeDeletedLibraries(t *testing.T) {
+	processed := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	ds := newMockLibraryManagerDataStorer()
+	ds.deletedLibraries[1] = controller.Library{ID: 1, Folder: "/media/old", DeletedAt: time.Now().Add(-2 * time.Hour)}
+	ds.deletedLibraries[2] = controller.Library{ID: 2, Folder: "/media/recent", DeletedAt: time.Now()}
+	ds.deletedLibraries[3] = controller.Library{ID: 3, Folder: "/media/shared", DeletedAt: time.Now().Add(-2 * time.Hour)}
+	ds.libraries[4] = controller.Library{ID: 4, Folder: "/media/shared"}
+	ds.processed["/media/old/a.mkv"] = processed
+	ds.processed["/media/recent/b.mkv"] = processed
+	ds.processed["/media/shared/c.mkv"] = processed
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, time.Hour)
+	m.purgeDeletedLibraries()
+
+	if _, ok := ds.deletedLibraries[1]; ok {
+		t.Errorf("expected the library deleted before the retention period to be purged")
+	}
+	if _, ok := ds.deletedLibraries[2]; !ok {
+		t.Errorf("expected the library deleted within the retention period to be kept")
+	}
+	if _, ok := ds.processed["/media/old/a.mkv"]; ok {
+		t.Errorf("expected the processed modtimes of the purged library to be forgotten")
+	}
+	if _, ok := ds.processed["/media/recent/b.mkv"]; !ok {
+		t.Errorf("expected the processed modtimes of the kept library to be kept")
+	}
+	if _, ok := ds.processed["/media/shared/c.mkv"]; !ok {
+		t.Errorf("expected the processed modtimes of a folder used by another library to be kept")
+	}
+}
+
+func TestDeleteLibrary(t *testing.T) {
+	newManager := func() (*Manager, *mockLibraryManagerDataStorer) {
+		ds := newMockLibraryManagerDataStorer()
+		ds.libraries[1] = controller.Library{ID: 1, Folder: "/media/tv", Queue: controller.LibraryQueue{Items: []controller.Job{{UUID: "a", LibraryID: 1, Path: "/media/tv/a.mkv"}}}}
+		ds.processed["/media/tv/b.mkv"] = time.Now()
+
+		m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, time.Hour)
+		return &m, ds
+	}
+
+	t.Run("Soft Delete and Restore", func(t *testing.T) {
+		m, ds := newManager()
+
+		if err := m.DeleteLibrary(1, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := ds.Library(context.Background(), 1); err == nil {
+			t.Errorf("expected the deleted library to be left out")
+		}
+
+		// The retention hasn't passed, so the library isn't purged.
+		m.purgeDeletedLibraries()
+
+		if err := m.RestoreLibrary(1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		lib, err := ds.Library(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("expected the library to be restored but got %v", err)
+		}
+		if len(lib.Queue.Items) != 1 || lib.Queue.Items[0].UUID != "a" {
+			t.Errorf("expected the queue to be intact but got %+v", lib.Queue.Items)
+		}
+		if !lib.DeletedAt.IsZero() {
+			t.Errorf("expected the deleted time to be cleared but got %v", lib.DeletedAt)
+		}
+	})
+
+	t.Run("Purged After Retention", func(t *testing.T) {
+		m, ds := newManager()
+		m.deletedLibraryRetention = 0
+
+		if err := m.DeleteLibrary(1, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+		m.purgeDeletedLibraries()
+
+		if err := m.RestoreLibrary(1); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows restoring a purged library but got %v", err)
+		}
+		if _, ok := ds.processed["/media/tv/b.mkv"]; ok {
+			t.Errorf("expected the processed modtimes of the purged library to be forgotten")
+		}
+	})
+
+	t.Run("Hard Delete", func(t *testing.T) {
+		m, ds := newManager()
+
+		if err := m.DeleteLibrary(1, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, ok := ds.deletedLibraries[1]; ok {
+			t.Errorf("expected the library to be purged right away")
+		}
+		if err := m.RestoreLibrary(1); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows restoring a purged library but got %v", err)
+		}
+		if _, ok := ds.processed["/media/tv/b.mkv"]; ok {
+			t.Errorf("expected the processed modtimes of the purged library to be forgotten")
+		}
+	})
+
+	t.Run("Unknown Library", func(t *testing.T) {
+		m, _ := newManager()
+
+		if err := m.DeleteLibrary(2, true); err == nil {
+			t.Errorf("expected an error soft deleting an unknown library")
+		}
+		if err := m.DeleteLibrary(2, false); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows hard deleting an unknown library but got %v", err)
+		}
+	})
+}
+
+func TestScanCanonicalizesPaths(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.dispatchedJobs["c"] = controller.DispatchedJob{UUID: "c", Job: controller.Job{UUID: "c", LibraryID: 1, Path: "/media/tv/c.mkv"}}
+	lib := controller.Library{ID: 1, Folder: "/media/tv"}
+	ds.libraries[lib.ID] = lib
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: []string{"/media/tv/a.mkv", "/media/tv//a.mkv", "/media/tv/./b.mkv", "/media/tv//c.mkv"}}
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	m.updateLibraryQueue(ctx, &wg, lib)
+
+	queued := make([]string, 0)
+	for _, job := range ds.libraries[lib.ID].Queue.Items {
+		queued = append(queued, job.Path)
+	}
+	if expected := []string{"/media/tv/a.mkv", "/media/tv/b.mkv"}; !reflect.DeepEqual(queued, expected) {
+		t.Errorf("expected %v to be queued but got %v", expected, queued)
+	}
+
+	m.UpdateLibrarySettings(map[int]controller.Library{2: {Folder: "/media/movies/"}})
+	if folder := ds.libraries[2].Folder; folder != "/media/movies" {
+		t.Errorf("expected the folder of a new library to be canonicalized but got %v", folder)
+	}
+}
+
+func TestCanonicalizeStoredPaths(t *testing.T) {
+	processed := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media/tv/", Version: 1, Queue: controller.LibraryQueue{Items: []controller.Job{
+		{UUID: "a", LibraryID: 1, Path: "/media/tv//a.mkv"},
+		{UUID: "b", LibraryID: 1, Path: "/media/tv/./b.mkv"},
+		{UUID: "c", LibraryID: 1, Path: "/media/tv/a.mkv"},
+	}}}
+	ds.libraries[2] = controller.Library{ID: 2, Folder: "/media/movies", Version: 1}
+	ds.processed["/media/tv//a.mkv"] = processed
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.canonicalizeStoredPaths()
+
+	lib := ds.libraries[1]
+	if lib.Folder != "/media/tv" {
+		t.Errorf("expected the folder to be canonicalized but got %v", lib.Folder)
+	}
+	expected := []controller.Job{{UUID: "a", LibraryID: 1, Path: "/media/tv/a.mkv"}, {UUID: "b", LibraryID: 1, Path: "/media/tv/b.mkv"}}
+	if !reflect.DeepEqual(lib.Queue.Items, expected) {
+		t.Errorf("expected the queue to be %v but got %v", expected, lib.Queue.Items)
+	}
+
+	if ds.libraries[2].Version != 1 {
+		t.Errorf("expected a library with canonical paths to not be saved")
+	}
+
+	if _, ok := ds.processed["/media/tv/a.mkv"]; !ok {
+		t.Errorf("expected the processed modtime to be moved to the canonical path but got %v", ds.processed)
+	}
+}
+
+func TestImportRecordsProcessedModtime(t *testing.T) {
+	modtime := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1}
+	ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/a.mkv"}}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.fileRemover = &mockFileRemover{}
+	m.fileMover = &mockFileMover{}
+	m.fileStater = &mockFileStater{modTimes: map[string]time.Time{"/media/a.mkv": modtime}}
+
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+
+	if got, ok := ds.processed["/media/a.mkv"]; !ok || !got.Equal(modtime) {
+		t.Errorf("expected processed modtime %v but got %v", modtime, got)
+	}
+}
+
+func TestImportOriginalFileHandling(t *testing.T) {
+	tests := []struct {
+		name          string
+		handling      controller.OriginalFileHandling
+		inFile        string
+		expectedPath  string
+		expectedKept  string
+		expectRemoved bool
+	}{
+		{name: "Default", handling: "", inFile: "a.import.mkv", expectedPath: "/media/Show/a.mkv"},
+		{name: "Replace", handling: controller.OriginalReplace, inFile: "a.import.mkv", expectedPath: "/media/Show/a.mkv"},
+		{name: "Replace with a new extension", handling: controller.OriginalReplace, inFile: "a.import.mp4", expectedPath: "/media/Show/a.mp4", expectRemoved: true},
+		{name: "Keep renamed", handling: controller.OriginalKeepRenamed, inFile: "a.import.mkv", expectedPath: "/media/Show/a.mkv", expectedKept: "/media/Show/a.original.mkv"},
+		{name: "Move to folder", handling: controller.OriginalMoveToFolder, inFile: "a.import.mkv", expectedPath: "/media/Show/a.mkv", expectedKept: "/media/.encodarr-originals/Show/a.mkv"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1, Folder: "/media", OriginalFileHandling: test.handling}
+			ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/Show/a.mkv"}}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			fr := mockFileRemover{}
+			fm := mockFileMover{}
+			m.fileRemover = &fr
+			m.fileMover = &fm
+			m.fileStater = &mockFileStater{}
+
+			m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: test.inFile}})
+
+			if fm.moved[test.inFile] != test.expectedPath {
+				t.Errorf("expected the transcoded file to be moved to %v but got moves %v", test.expectedPath, fm.moved)
+			}
+			// An original with the same name is replaced by the move, so it is only removed when the name changed
+			if test.expectRemoved && (len(fr.removed) != 1 || fr.removed[0] != "/media/Show/a.mkv") {
+				t.Errorf("expected the original to be removed but got removals %v", fr.removed)
+			}
+			if !test.expectRemoved && len(fr.removed) != 0 {
+				t.Errorf("expected the original to be replaced instead of removed but got removals %v", fr.removed)
+			}
+			if test.expectedKept != "" && (len(fr.removed) != 0 || fm.moved["/media/Show/a.mkv"] != test.expectedKept) {
+				t.Errorf("expected the original to be kept at %v but got moves %v and removals %v", test.expectedKept, fm.moved, fr.removed)
+			}
+			if len(ds.history) != 1 || ds.history[0].OriginalPath != test.expectedKept {
+				t.Errorf("expected the history entry to record the original at %q but got %+v", test.expectedKept, ds.history)
+			}
+		})
+	}
+}
+
+func TestImportMoveFailureKeepsOriginal(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media"}
+	ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/Show/a.mkv"}}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	fr := &mockFileRemover{}
+	m.fileRemover = fr
+	m.fileMover = &mockFileMover{err: errors.New("no space left on device")}
+	m.fileStater = &mockFileStater{}
+
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mp4"}})
+
+	if len(fr.removed) != 0 {
+		t.Errorf("expected the original to be left alone but got removals %v", fr.removed)
+	}
+	if len(ds.history) != 1 || len(ds.history[0].Errors) != 1 {
+		t.Errorf("expected the failed move to be recorded in the history but got %+v", ds.history)
+	}
+}
+
+func TestImportAwaitingSpace(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media"}
+	ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/Show/a.mkv"}}
+	ds.dispatchedJobs["b"] = controller.DispatchedJob{UUID: "b", Job: controller.Job{UUID: "b", LibraryID: 1, Path: "/media/Show/b.mkv"}}
+
+	n := &mockNotifier{}
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, n, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.SetAwaitingSpaceLimit(150)
+	fr := &mockFileRemover{}
+	fm := &mockFileMover{err: fmt.Errorf("copying: %w", controller.ErrInsufficientSpace)}
+	m.fileRemover = fr
+	m.fileMover = fm
+	m.fileStater = &mockFileStater{sizes: map[string]int64{"a.import.mkv": 100, "b.import.mkv": 100}}
+
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+
+	if len(ds.history) != 0 || len(fr.removed) != 0 {
+		t.Errorf("expected the job to wait without a history entry or removals but got %+v and %v", ds.history, fr.removed)
+	}
+	if jobs := m.AwaitingSpaceJobs(); len(jobs) != 1 || jobs[0].UUID != "a" {
+		t.Errorf("expected job a to be awaiting space but got %+v", jobs)
+	}
+	if len(n.events) != 1 || n.events[0].Type != controller.EventJobAwaitingSpace {
+		t.Errorf("expected a %v event but got %+v", controller.EventJobAwaitingSpace, n.events)
+	}
+
+	// The transcoded file of b doesn't fit next to the one of a, so b fails
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "b", InFile: "b.import.mkv"}})
+
+	if len(m.AwaitingSpaceJobs()) != 1 {
+		t.Errorf("expected only job a to be awaiting space but got %+v", m.AwaitingSpaceJobs())
+	}
+	if len(fr.removed) != 1 || fr.removed[0] != "b.import.mkv" {
+		t.Errorf("expected the transcoded file of b to be removed but got %v", fr.removed)
+	}
+	if len(ds.history) != 1 || !ds.history[0].Failed || ds.history[0].UUID != "b" {
+		t.Errorf("expected job b to fail but got %+v", ds.history)
+	}
+
+	// Once there is space, the next retry imports a
+	fm.err = nil
+	m.lastSpaceRetry = time.Time{}
+	m.ImportCompletedJobs(nil)
+
+	if len(m.AwaitingSpaceJobs()) != 0 {
+		t.Errorf("expected no jobs to be awaiting space but got %+v", m.AwaitingSpaceJobs())
+	}
+	if fm.moved["a.import.mkv"] != "/media/Show/a.mkv" {
+		t.Errorf("expected the transcoded file of a to be imported but got moves %v", fm.moved)
+	}
+	if len(ds.history) != 2 || ds.history[1].Failed || ds.history[1].UUID != "a" {
+		t.Errorf("expected job a to be imported but got %+v", ds.history)
+	}
+}
+
+// A part of a multi-part set isn't dispatched anymore while it waits for the rest of its set, so its staged files have
+// to be kept by the staging cleanup until the set is imported.
+func TestHeldGroupPartSurvivesStagingCleanup(t *testing.T) {
+	const (
+		partA controller.UUID = "0b1e7a1c-3c5b-4d47-9f5e-6a7c1f0a2b3d"
+		partB controller.UUID = "1c2f8b2d-4d6c-4e58-8a6f-7b8d2a1b3c4e"
+	)
+
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media"}
+	ds.dispatchedJobs[partA] = controller.DispatchedJob{UUID: partA, Job: controller.Job{UUID: partA, LibraryID: 1, Path: "/media/Movie/cd1.mkv", Group: "/media/Movie/movie", GroupSize: 2}}
+	ds.dispatchedJobs[partB] = controller.DispatchedJob{UUID: partB, Job: controller.Job{UUID: partB, LibraryID: 1, Path: "/media/Movie/cd2.mkv", Group: "/media/Movie/movie", GroupSize: 2}}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.fileRemover = &mockFileRemover{}
+	m.fileMover = &mockFileMover{}
+	m.fileStater = &mockFileStater{}
+
+	dir := t.TempDir()
+	rc := runnercommunicator.NewRunnerHTTPApiV1(&mockLogger{}, nil, dispatchedJobLookup{ds: ds}, 0)
+	rc.SetStagingDir(dir)
+
+	inFile := filepath.Join(dir, string(partA)+".import.mkv")
+	captionsFile := filepath.Join(dir, string(partA)+".import.srt")
+	for _, p := range []string{inFile, captionsFile} {
+		if err := os.WriteFile(p, []byte("data"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: partA, InFile: inFile, CaptionsFile: captionsFile}})
+	rc.CleanStaging(m.StagedFiles())
+
+	for _, p := range []string{inFile, captionsFile} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("expected the staged file of the held part to be kept but got %v", err)
+		}
+	}
+}
+
+// The completed parts of a multi-part set are saved while they are held, so that a restart doesn't lose them.
+func TestHeldGroupPartsSurviveRestart(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media"}
+	ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/Movie/cd1.mkv", Group: "/media/Movie/movie", GroupSize: 2}}
+	ds.dispatchedJobs["b"] = controller.DispatchedJob{UUID: "b", Job: controller.Job{UUID: "b", LibraryID: 1, Path: "/media/Movie/cd2.mkv", Group: "/media/Movie/movie", GroupSize: 2}}
+
+	newManager := func() (Manager, *mockFileMover) {
+		m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+		fm := &mockFileMover{}
+		m.fileRemover = &mockFileRemover{}
+		m.fileMover = fm
+		m.fileStater = &mockFileStater{}
+		return m, fm
+	}
+
+	m, _ := newManager()
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+	if len(ds.heldParts) != 1 || ds.heldParts[0].Completed.InFile != "a.import.mkv" {
+		t.Fatalf("expected part a to be saved while it is held but got %+v", ds.heldParts)
+	}
+
+	// The Controller restarts before the other part completes
+	m, fm := newManager()
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "b", InFile: "b.import.mkv"}})
+
+	if fm.moved["a.import.mkv"] != "/media/Movie/cd1.mkv" || fm.moved["b.import.mkv"] != "/media/Movie/cd2.mkv" {
+		t.Errorf("expected both parts to be imported but got moves %v", fm.moved)
+	}
+	if len(ds.history) != 2 {
+		t.Errorf("expected a history entry for both parts but got %+v", ds.history)
+	}
+	if len(ds.heldParts) != 0 {
+		t.Errorf("expected the held parts to be released but got %+v", ds.heldParts)
+	}
+}
+
+// A part of a multi-part set which is masked out is never queued, so the rest of the set is imported without it.
+func TestImportGroupWithMaskedPart(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: []string{"/media/Movie/Movie cd1.mkv", "/media/Movie/Movie cd2.mkv"}}
+	fm := &mockFileMover{}
+	m.fileRemover = &mockFileRemover{}
+	m.fileMover = fm
+	m.fileStater = &mockFileStater{}
+
+	lib := controller.Library{ID: 1, Folder: "/media", PathMasks: []string{"cd2"}, MultiPartPatterns: DefaultMultiPartPatterns}
+	ds.libraries[lib.ID] = lib
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	m.updateLibraryQueue(context.Background(), &wg, lib)
+
+	queue := ds.libraries[lib.ID].Queue.Items
+	if len(queue) != 1 || queue[0].Group == "" {
+		t.Fatalf("expected the unmasked part to be queued as part of a set but got %+v", queue)
+	}
+	job := queue[0]
+	ds.libraries[lib.ID] = lib
+	ds.dispatchedJobs[job.UUID] = controller.DispatchedJob{UUID: job.UUID, Job: job}
+
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: job.UUID, InFile: "cd1.import.mkv"}})
+
+	if fm.moved["cd1.import.mkv"] != job.Path {
+		t.Errorf("expected the unmasked part to be imported but got moves %v", fm.moved)
+	}
+	if len(ds.heldParts) != 0 {
+		t.Errorf("expected no parts to be held but got %+v", ds.heldParts)
+	}
+}
+
+// A part which is retried after the rest of its set was imported has nothing left to wait for.
+func TestImportRetriedGroupPart(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media"}
+	// The retry keeps the group of the failed dispatch
+	ds.dispatchedJobs["b2"] = controller.DispatchedJob{UUID: "b2", Job: controller.Job{UUID: "b2", LibraryID: 1, Path: "/media/Movie/cd2.mkv", Group: "/media/Movie/movie", GroupSize: 2}}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	fm := &mockFileMover{}
+	m.fileRemover = &mockFileRemover{}
+	m.fileMover = fm
+	m.fileStater = &mockFileStater{}
+
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "b2", InFile: "b2.import.mkv"}})
+
+	if fm.moved["b2.import.mkv"] != "/media/Movie/cd2.mkv" {
+		t.Errorf("expected the retried part to be imported but got moves %v", fm.moved)
+	}
+	if len(ds.heldParts) != 0 {
+		t.Errorf("expected no parts to be held but got %+v", ds.heldParts)
+	}
+}
+
+// dispatchedJobLookup gives the staging cleanup of the RunnerCommunicator the dispatched jobs of the mock data storer.
+type dispatchedJobLookup struct {
+	controller.RunnerCommunicatorDataStorer
+
+	ds *mockLibraryManagerDataStorer
+}
+
+func (d dispatchedJobLookup) DispatchedJob(ctx context.Context, uuid controller.UUID) (controller.DispatchedJob, error) {
+	d.ds.Lock()
+	defer d.ds.Unlock()
+	dJob, ok := d.ds.dispatchedJobs[uuid]
+	if !ok {
+		return controller.DispatchedJob{}, sql.ErrNoRows
+	}
+	return dJob, nil
+}
+
+func TestImportOriginalToTrash(t *testing.T) {
+	newManager := func(ds *mockLibraryManagerDataStorer, tr *trash.Trash) (Manager, *mockFileRemover, *mockFileMover) {
+		ds.libraries[1] = controller.Library{ID: 1, Folder: "/media", OriginalFileHandling: controller.OriginalMoveToTrash}
+		ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/Show/a.mkv"}}
+
+		m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+		fr := &mockFileRemover{}
+		fm := &mockFileMover{}
+		m.fileRemover = fr
+		m.fileMover = fm
+		m.fileStater = &mockFileStater{}
+		if tr != nil {
+			m.SetTrash(tr)
+		}
+		return m, fr, fm
+	}
+
+	ds := newMockLibraryManagerDataStorer()
+	tr := trash.New(&mockLogger{}, "/trash", 0, 0)
+	m, fr, fm := newManager(ds, &tr)
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+
+	trashed := fm.moved["/media/Show/a.mkv"]
+	if !strings.HasPrefix(trashed, filepath.Join("/trash", "1")+string(filepath.Separator)) || !strings.HasSuffix(trashed, filepath.Join("Show", "a.mkv")) || len(fr.removed) != 0 {
+		t.Errorf("expected the original to be moved into the trash but got moves %v and removals %v", fm.moved, fr.removed)
+	}
+	if len(ds.history) != 1 || ds.history[0].OriginalPath != trashed {
+		t.Errorf("expected the history entry to record the original at %q but got %+v", trashed, ds.history)
+	}
+
+	// Without a trash, the original stays where it is and the transcoded file is imported next to it
+	ds = newMockLibraryManagerDataStorer()
+	m, fr, fm = newManager(ds, nil)
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+
+	if len(fr.removed) != 0 || fm.moved["a.import.mkv"] != "/media/Show/a.encodarr.mkv" {
+		t.Errorf("expected the original to be kept in place but got moves %v and removals %v", fm.moved, fr.removed)
+	}
+}
+
+func TestImportMovesSidecars(t *testing.T) {
+	tests := []struct {
+		name         string
+		moveSidecars bool
+		expected     []string
+	}{
+		{
+			name:         "Disabled",
+			moveSidecars: false,
+			expected:     []string{"a.en.srt", "a.mkv.en.srt", "a.mkv.nfo", "a.mkv.srt", "a.mkv.txt", "a.mp4", "a.mp4.nfo", "b.mkv.srt"},
+		},
+		{
+			name:         "Enabled",
+			moveSidecars: true,
+			// a.en.srt already matches a.mp4, and a.mkv.nfo is kept because a.mp4.nfo already exists
+			expected: []string{"a.en.srt", "a.mkv.nfo", "a.mkv.txt", "a.mp4", "a.mp4.en.srt", "a.mp4.nfo", "a.mp4.srt", "b.mkv.srt"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{"a.mkv", "a.mkv.srt", "a.mkv.en.srt", "a.en.srt", "a.mkv.nfo", "a.mp4.nfo", "a.mkv.txt", "b.mkv.srt", "a.import.mp4"} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1, Folder: dir, MoveSidecars: test.moveSidecars}
+			ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: filepath.Join(dir, "a.mkv")}}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.fileAttributer = &mockFileAttributer{}
+
+			m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: filepath.Join(dir, "a.import.mp4")}})
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, 0, len(entries))
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestImportKeepsOriginalAttributes(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "a.mkv")
+	if err := os.WriteFile(original, []byte("original"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	modtime := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(original, modtime, modtime); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		preserveModtime bool
+		chownErr        error
+	}{
+		{name: "Import Time", preserveModtime: false},
+		{name: "Original Modtime", preserveModtime: true},
+		{name: "Chown Not Permitted", chownErr: os.ErrPermission},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1, Folder: dir, PreserveModtime: test.preserveModtime}
+			ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: original}}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.fileRemover = &mockFileRemover{}
+			m.fileMover = &mockFileMover{}
+			fa := &mockFileAttributer{chownErr: test.chownErr}
+			m.fileAttributer = fa
+
+			m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: filepath.Join(dir, "a.import.mkv")}})
+
+			if len(ds.history) != 1 || len(ds.history[0].Errors) != 0 {
+				t.Fatalf("expected the job to be imported but got history %+v", ds.history)
+			}
+			if mode := fa.modes[original]; mode != 0640 {
+				t.Errorf("expected the transcoded file to get the mode 0640 but got %v", mode)
+			}
+			if runtime.GOOS != "windows" && test.chownErr == nil {
+				if owner, expected := fa.owners[original], [2]int{os.Getuid(), os.Getgid()}; owner != expected {
+					t.Errorf("expected the transcoded file to get the owner %v but got %v", expected, owner)
+				}
+			}
+			if mtime, ok := fa.modtimes[original]; test.preserveModtime != ok || (ok && !mtime.Equal(modtime)) {
+				t.Errorf("expected the modtime to be kept (%v) but got %v", test.preserveModtime, fa.modtimes)
+			}
+		})
+	}
+}
+
+func TestImportDuplicateCompletion(t *testing.T) {
+	queuedAt := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		processed    time.Time
+		modtime      time.Time
+		expectImport bool
+	}{
+		{name: "Never processed", modtime: queuedAt.Add(-time.Hour), expectImport: true},
+		{name: "Processed before queuing", processed: queuedAt.Add(-time.Hour), modtime: queuedAt.Add(-time.Hour), expectImport: true},
+		{name: "Processed after queuing", processed: queuedAt.Add(time.Hour), modtime: queuedAt.Add(time.Hour)},
+		{name: "Changed since processed", processed: queuedAt.Add(time.Hour), modtime: queuedAt.Add(2 * time.Hour), expectImport: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1}
+			ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/a.mkv", QueuedAt: queuedAt}}
+			if !test.processed.IsZero() {
+				ds.processed["/media/a.mkv"] = test.processed
+			}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			fr := mockFileRemover{}
+			fm := mockFileMover{}
+			m.fileRemover = &fr
+			m.fileMover = &fm
+			m.fileStater = &mockFileStater{modTimes: map[string]time.Time{"/media/a.mkv": test.modtime}}
+
+			m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+
+			_, moved := fm.moved["a.import.mkv"]
+			if moved != test.expectImport {
+				t.Errorf("expected the transcoded file to be imported to be %v but got moves %v", test.expectImport, fm.moved)
+			}
+			if len(ds.history) != 1 || ds.history[0].Failed == test.expectImport {
+				t.Errorf("expected a single history entry with failed %v but got %+v", !test.expectImport, ds.history)
+			}
+			if !test.expectImport && (len(fr.removed) != 1 || fr.removed[0] != "a.import.mkv") {
+				t.Errorf("expected the transcoded file to be discarded but got removals %v", fr.removed)
+			}
+		})
+	}
+}
+
+// A completed job which isn't dispatched anymore (ex. it was requeued while the Controller restarted) is imported
+// in place of the queued job for the same file.
+func TestImportUndispatchedCompletedJob(t *testing.T) {
+	tests := []struct {
+		name         string
+		queued       []controller.Job
+		expectImport bool
+	}{
+		{
+			name:         "Queued file",
+			queued:       []controller.Job{{UUID: "b", LibraryID: 1, Path: "/media/b.mkv"}, {UUID: "requeued", LibraryID: 1, Path: "/media/a.mkv"}},
+			expectImport: true,
+		},
+		{
+			name:   "File isn't queued",
+			queued: []controller.Job{{UUID: "b", LibraryID: 1, Path: "/media/b.mkv"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1, Queue: controller.LibraryQueue{Items: test.queued}}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			fr := mockFileRemover{}
+			fm := mockFileMover{}
+			m.fileRemover = &fr
+			m.fileMover = &fm
+			m.fileStater = &mockFileStater{}
+
+			m.ImportCompletedJobs([]controller.CompletedJob{{
+				UUID:    "a",
+				InFile:  "a.import.mkv",
+				History: controller.History{Filename: "/media/a.mkv", Runner: "Runner"},
+			}})
+
+			queue := ds.libraries[1].Queue.Items
+			if len(queue) != 1 || queue[0].UUID != "b" {
+				t.Errorf("expected only job b to remain queued but got %+v", queue)
+			}
+
+			_, moved := fm.moved["a.import.mkv"]
+			if moved != test.expectImport {
+				t.Errorf("expected the transcoded file to be imported to be %v but got moves %v", test.expectImport, fm.moved)
+			}
+			if imported := len(ds.history) == 1 && ds.history[0].UUID == "a" && ds.history[0].Runner == "Runner"; imported != test.expectImport {
+				t.Errorf("expected a history entry to be %v but got %+v", test.expectImport, ds.history)
+			}
+			if !test.expectImport && (len(fr.removed) != 1 || fr.removed[0] != "a.import.mkv") {
+				t.Errorf("expected the transcoded file to be discarded but got removals %v", fr.removed)
+			}
+		})
+	}
+}
+
+func TestImportCaptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		captionsPath  string
+		captionsFile  string
+		expectedMoves map[string]string
+		expectRemoved bool
+	}{
+		{
+			name:          "Captions received",
+			captionsPath:  "/media/a.srt",
+			captionsFile:  "a.import.srt",
+			expectedMoves: map[string]string{"a.import.mkv": "/media/a.mkv", "a.import.srt": "/media/a.srt"},
+		},
+		{
+			name:          "No captions",
+			expectedMoves: map[string]string{"a.import.mkv": "/media/a.mkv"},
+		},
+		{
+			name:          "Unexpected captions",
+			captionsFile:  "a.import.srt",
+			expectedMoves: map[string]string{"a.import.mkv": "/media/a.mkv"},
+			expectRemoved: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1}
+			ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/a.mkv", CaptionsPath: test.captionsPath}}
+
+			remover := &mockFileRemover{}
+			mover := &mockFileMover{}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.fileRemover = remover
+			m.fileMover = mover
+			m.fileStater = &mockFileStater{modTimes: map[string]time.Time{"/media/a.mkv": time.Now()}}
+
+			m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv", CaptionsFile: test.captionsFile}})
+
+			if !reflect.DeepEqual(mover.moved, test.expectedMoves) {
+				t.Errorf("expected moves %v but got %v", test.expectedMoves, mover.moved)
+			}
+
+			removedCaptions := false
+			for _, path := range remover.removed {
+				if path == "a.import.srt" {
+					removedCaptions = true
+				}
+			}
+			if removedCaptions != test.expectRemoved {
+				t.Errorf("expected the captions to be removed to be %v but got %v", test.expectRemoved, removedCaptions)
+			}
+		})
+	}
+}
+
+func TestScanSetsCaptionsPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  []string
+		expected string
+	}{
+		{name: "Extracts captions", command: []string{"-i", "ENCODARR_INPUT_FILE", "-map", "1:s", "ENCODARR_CAPTIONS_FILE"}, expected: "/media/show.s01e01.srt"},
+		{name: "Doesn't extract captions", command: []string{"-i", "ENCODARR_INPUT_FILE"}, expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lib := controller.Library{ID: 1}
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = lib
+
+			decider := &mockCommandDecider{decide: func(controller.FileMetadata, string) ([]string, error) { return test.command, nil }}
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, decider, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+			queueVideoFile(&m, &lib, "/media/show.s01e01.mkv")
+
+			q := ds.libraries[1].Queue.Items
+			if len(q) != 1 {
+				t.Fatalf("expected 1 queued job but got %v", len(q))
+			}
+			if q[0].CaptionsPath != test.expected {
+				t.Errorf("expected captions path %q but got %q", test.expected, q[0].CaptionsPath)
+			}
+		})
+	}
+}
+
+func TestVerificationCommand(t *testing.T) {
+	tests := []struct {
+		name           string
+		command        []string
+		runErr         error
+		expectRun      bool
+		expectImported bool
+	}{
+		{name: "No command", command: nil, expectImported: true},
+		{name: "Passing command", command: []string{"vmaf-check", "--min", "93"}, expectRun: true, expectImported: true},
+		{name: "Failing command", command: []string{"vmaf-check", "--min", "93"}, runErr: errors.New("exit status 1"), expectRun: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := "/media/a.mkv"
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1, VerificationCommand: test.command}
+			ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: path}}
+
+			runner := &mockCommandRunner{output: []byte("VMAF score: 95.2"), err: test.runErr}
+			remover := &mockFileRemover{}
+			mover := &mockFileMover{}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{maxJobAttempts: 3}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.fileRemover = remover
+			m.fileMover = mover
+			m.fileStater = &mockFileStater{modTimes: map[string]time.Time{path: time.Now()}}
+			m.commandRunner = runner
+
+			m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+
+			if test.expectRun {
+				expectedArgs := []string{"--min", "93", path, "a.import.mkv"}
+				if runner.name != "vmaf-check" || !reflect.DeepEqual(runner.args, expectedArgs) {
+					t.Errorf("expected 'vmaf-check %v' to be run but got '%v %v'", expectedArgs, runner.name, runner.args)
+				}
+			} else if runner.name != "" {
+				t.Errorf("expected no command to be run but got '%v'", runner.name)
+			}
+
+			if len(ds.history) != 1 {
+				t.Fatalf("expected 1 history entry but got %v", len(ds.history))
+			}
+			if ds.history[0].Failed == test.expectImported {
+				t.Errorf("expected history failed to be %v", !test.expectImported)
+			}
+
+			if _, processed := ds.processed[path]; processed != test.expectImported {
+				t.Errorf("expected imported to be %v", test.expectImported)
+			}
+
+			if replaced := mover.moved["a.import.mkv"] == path; replaced != test.expectImported {
+				t.Errorf("expected original replaced to be %v but got moves %v", test.expectImported, mover.moved)
+			}
+
+			if !test.expectImported {
+				if !reflect.DeepEqual(remover.removed, []string{"a.import.mkv"}) {
+					t.Errorf("expected only the transcoded file to be removed but removed %v", remover.removed)
+				}
+				if queue := ds.libraries[1].Queue.Items; len(queue) != 1 || queue[0].Path != path {
+					t.Errorf("expected the original to be re-queued but the queue was %v", queue)
+				}
+			}
+		})
+	}
+}
+
+func TestOutputCheck(t *testing.T) {
+	original := controller.FileMetadata{General: controller.General{Duration: 1320}, VideoTracks: []controller.VideoTrack{{Codec: "AVC"}}}
+
+	tests := []struct {
+		name           string
+		output         controller.FileMetadata
+		readErr        error
+		expectImported bool
+		expectedOutput *controller.OutputStats
+	}{
+		{
+			name:           "Matching output",
+			output:         controller.FileMetadata{General: controller.General{Duration: 1319.5}, VideoTracks: []controller.VideoTrack{{Codec: "HEVC"}}},
+			expectImported: true,
+			expectedOutput: &controller.OutputStats{VideoCodec: "HEVC", Duration: 1319.5, Size: 659750000, Bitrate: 4000000},
+		},
+		{
+			name:           "Truncated output",
+			output:         controller.FileMetadata{General: controller.General{Duration: 600}, VideoTracks: []controller.VideoTrack{{Codec: "HEVC"}}},
+			expectedOutput: &controller.OutputStats{VideoCodec: "HEVC", Duration: 600, Size: 659750000, Bitrate: 8796666},
+		},
+		{
+			name:           "Wrong codec",
+			output:         controller.FileMetadata{General: controller.General{Duration: 1320}, VideoTracks: []controller.VideoTrack{{Codec: "AVC"}}},
+			expectedOutput: &controller.OutputStats{VideoCodec: "AVC", Duration: 1320, Size: 659750000, Bitrate: 3998484},
+		},
+		{name: "Unreadable output", readErr: errors.New("invalid data found when processing input")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := "/media/a.mkv"
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1}
+			ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: path, Metadata: original}}
+
+			remover := &mockFileRemover{}
+			mover := &mockFileMover{}
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{maxJobAttempts: 3}, &mockMetadataReader{metadata: test.output, err: test.readErr}, &mockCommandDecider{targetCodec: "HEVC"}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.fileRemover = remover
+			m.fileMover = mover
+			m.fileStater = &mockFileStater{sizes: map[string]int64{"a.import.mkv": 659750000}}
+
+			m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+
+			if len(ds.history) != 1 {
+				t.Fatalf("expected 1 history entry but got %v", len(ds.history))
+			}
+			if ds.history[0].Failed == test.expectImported {
+				t.Errorf("expected history failed to be %v but the errors were %v", !test.expectImported, ds.history[0].Errors)
+			}
+			if !reflect.DeepEqual(ds.history[0].Output, test.expectedOutput) {
+				t.Errorf("expected output %+v but got %+v", test.expectedOutput, ds.history[0].Output)
+			}
+
+			if test.expectImported {
+				if mover.moved["a.import.mkv"] != path || len(remover.removed) != 0 {
+					t.Errorf("expected the original to be replaced but got moves %v and removals %v", mover.moved, remover.removed)
+				}
+				return
+			}
+			if !reflect.DeepEqual(remover.removed, []string{"a.import.mkv"}) {
+				t.Errorf("expected only the transcoded file to be removed but removed %v", remover.removed)
+			}
+			if queue := ds.libraries[1].Queue.Items; len(queue) != 1 || queue[0].Path != path {
+				t.Errorf("expected the original to be re-queued but the queue was %v", queue)
+			}
+		})
+	}
+}
+
+func TestLibrarySettingsSnapshot(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media/tv", Priority: 1}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+	libs, err := m.LibrarySettings()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(libs) != 1 || libs[0].Priority != 1 {
+		t.Fatalf("expected the snapshot to be loaded on the first read but got %v", libs)
+	}
+
+	// Mutations made straight to the data store aren't seen until the snapshot is refreshed
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media/tv", Priority: 5}
+	if libs, _ = m.LibrarySettings(); libs[0].Priority != 1 {
+		t.Errorf("expected the cached priority 1 before a refresh but got %v", libs[0].Priority)
+	}
+
+	if _, err = m.RefreshLibraries(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if libs, _ = m.LibrarySettings(); libs[0].Priority != 5 {
+		t.Errorf("expected priority 5 after a refresh but got %v", libs[0].Priority)
+	}
+
+	// Mutations made through the Manager refresh the snapshot themselves
+	m.UpdateLibrarySettings(map[int]controller.Library{1: {Folder: "/media/movies", Priority: 3}, 2: {Folder: "/media/anime"}})
+
+	libs, _ = m.LibrarySettings()
+	sort.Slice(libs, func(i, j int) bool { return libs[i].ID < libs[j].ID })
+	if len(libs) != 2 || libs[0].Folder != "/media/movies" || libs[0].Priority != 3 || libs[1].Folder != "/media/anime" {
+		t.Errorf("expected the updated settings and new library to be read back but got %v", libs)
+	}
+}
+
+func TestImportSizeMetrics(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1}
+	ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/a.mkv"}}
+	ds.dispatchedJobs["b"] = controller.DispatchedJob{UUID: "b", Job: controller.Job{UUID: "b", LibraryID: 1, Path: "/media/b.mkv"}}
+
+	metrics := newMockMetricsCollector()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, metrics, controller.PathCanonicalizer{}, 0)
+	m.fileRemover = &mockFileRemover{}
+	m.fileMover = &mockFileMover{}
+	m.fileStater = &mockFileStater{sizes: map[string]int64{
+		"/media/a.mkv": 1000, "a.import.mkv": 600,
+		"/media/b.mkv": 500, "b.import.mkv": 700, // The transcode made b larger
+	}}
+
+	jobs := []controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}, {UUID: "b", InFile: "b.import.mkv"}}
+	m.ImportCompletedJobs(jobs)
+
+	// Importing the same jobs again must not count them twice
+	m.ImportCompletedJobs(jobs)
+
+	expectedCounters := map[string]float64{
+		"encodarr_bytes_read_total":    1500,
+		"encodarr_bytes_written_total": 1300,
+		"encodarr_bytes_saved_total":   400,
+	}
+	for name, expected := range expectedCounters {
+		if got := metrics.counters[name].value; got != expected {
+			t.Errorf("expected %v to be %v but got %v", name, expected, got)
+		}
+	}
+
+	if got := metrics.histograms["encodarr_savings_ratio"].observed; !reflect.DeepEqual(got, []float64{0.4, -0.4}) {
+		t.Errorf("expected savings ratios [0.4 -0.4] but got %v", got)
+	}
+}
+
+func TestMetricsSnapshot(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1}
+	ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/a.mkv"}}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, metrics.New(), controller.PathCanonicalizer{}, 0)
+	m.fileRemover = &mockFileRemover{}
+	m.fileMover = &mockFileMover{}
+	m.fileStater = &mockFileStater{sizes: map[string]int64{"/media/a.mkv": 1000, "a.import.mkv": 600}}
+
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+
+	s := m.MetricsSnapshot()
+	for name, expected := range map[string]float64{"encodarr_bytes_read_total": 1000, "encodarr_bytes_written_total": 600, "encodarr_bytes_saved_total": 400} {
+		if s.Counters[name] != expected {
+			t.Errorf("expected %v to be %v but got %v", name, expected, s.Counters[name])
+		}
+	}
+	if h := s.Histograms["encodarr_savings_ratio"]; h.Count != 1 || h.Sum != 0.4 {
+		t.Errorf("expected a single savings ratio of 0.4 but got %+v", h)
+	}
+
+	// Snapshots taken while jobs are imported must never show part of a job
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 250; j++ {
+				m.recordSizes(100, 60)
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		s = m.MetricsSnapshot()
+		read, written, saved := s.Counters["encodarr_bytes_read_total"], s.Counters["encodarr_bytes_written_total"], s.Counters["encodarr_bytes_saved_total"]
+		jobs := s.Histograms["encodarr_savings_ratio"].Count
+		if read-written != saved || read != 1000+100*float64(jobs-1) {
+			t.Fatalf("expected a consistent snapshot but got %v read, %v written, and %v saved by %v jobs", read, written, saved, jobs)
+		}
+	}
+	wg.Wait()
+
+	if jobs := m.MetricsSnapshot().Histograms["encodarr_savings_ratio"].Count; jobs != 1001 {
+		t.Errorf("expected 1001 jobs in the snapshot but got %v", jobs)
+	}
+}
+
+func TestImportCompletionRecord(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1}
+	ds.dispatchedJobs["a"] = controller.DispatchedJob{
+		UUID:   "a",
+		Status: controller.JobStatus{JobElapsedTime: "1h35m0s"},
+		Job: controller.Job{
+			UUID: "a", LibraryID: 1, Path: "/media/a.mkv",
+			Command:  []string{"-i", "ENCODARR_INPUT_FILE", "-map", "0:v", "-vcodec", "hevc_nvenc"},
+			Metadata: controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC"}}},
+		},
+	}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.fileRemover = &mockFileRemover{}
+	m.fileMover = &mockFileMover{}
+	m.fileStater = &mockFileStater{sizes: map[string]int64{"/media/a.mkv": 1000, "a.import.mkv": 600}}
+
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+
+	if len(ds.history) != 1 || ds.history[0].Completion == nil {
+		t.Fatalf("expected a history entry with a completion record but got %+v", ds.history)
+	}
+	expected := controller.CompletionRecord{
+		OriginalSize: 1000, NewSize: 600, SavedBytes: 400, SavedPercent: 40, Elapsed: 95 * time.Minute,
+		Encoder: "hevc_nvenc", SourceCodec: "AVC",
+	}
+	if got := *ds.history[0].Completion; got != expected {
+		t.Errorf("expected %+v but got %+v", expected, got)
+	}
+}
+
+func TestScanOnStartup(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = folderVideoFileser{"/media/1": {"/media/1/a.mkv"}, "/media/2": {"/media/2/a.mkv"}, "/media/3": {"/media/3/a.mkv"}}
+	m.fileStater = &mockFileStater{}
+
+	libs := []controller.Library{
+		{ID: 1, Folder: "/media/1", FsCheckInterval: time.Hour, ScanOnStartup: true},
+		{ID: 2, Folder: "/media/2", FsCheckInterval: time.Hour, ScanOnStartup: false},
+		{ID: 3, Folder: "/media/3", FsCheckInterval: time.Hour, ScanOnStartup: false},
+	}
+	for _, v := range libs {
+		ds.libraries[v.ID] = v
+	}
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	before := time.Now()
+	m.scheduleScans(ctx, &wg, libs[:2], true)
+	wg.Wait()
+
+	if len(ds.libraries[1].Queue.Items) == 0 {
+		t.Errorf("expected library 1 to be scanned on startup")
+	}
+	if len(ds.libraries[2].Queue.Items) != 0 {
+		t.Errorf("expected library 2 not to be scanned on startup but got queue %v", ds.libraries[2].Queue.Items)
+	}
+	if checked := m.lastCheckedTimes[2]; checked.Before(before) {
+		t.Errorf("expected library 2 to be treated as checked at startup but it was last checked at %v", checked)
+	}
+
+	// Libraries added after startup are always scanned right away
+	m.scheduleScans(ctx, &wg, libs[2:], false)
+	wg.Wait()
+
+	if len(ds.libraries[3].Queue.Items) == 0 {
+		t.Errorf("expected library 3 to be scanned when added after startup")
+	}
+}
+
+func TestScanSchedulingPriority(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: []string{"/media/a.mkv"}}
+	m.fileStater = &mockFileStater{}
+	m.SetMaxConcurrentScans(1)
+
+	libs := []controller.Library{
+		{ID: 1, Priority: 1, FsCheckInterval: time.Hour},
+		{ID: 2, Priority: 5, FsCheckInterval: time.Hour},
+		{ID: 3, Priority: 3, FsCheckInterval: time.Hour},
+	}
+	for _, v := range libs {
+		ds.libraries[v.ID] = v
+	}
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	for _, expected := range []int{2, 3, 1} {
+		m.scheduleScans(ctx, &wg, libs, false)
+		wg.Wait()
+
+		scanned := make([]int, 0)
+		for _, v := range libs {
+			if len(ds.libraries[v.ID].Queue.Items) != 0 {
+				scanned = append(scanned, v.ID)
+			}
+			// Only a library which was just scanned has a queue, so clear it to see the next one
+			lib := ds.libraries[v.ID]
+			lib.Queue = controller.LibraryQueue{}
+			ds.libraries[v.ID] = lib
+		}
+		if !reflect.DeepEqual(scanned, []int{expected}) {
+			t.Errorf("expected only library %v to be scanned but got %v", expected, scanned)
+		}
+	}
+}
+
+func TestScanLoadLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		reporter mockLoadReporter
+		scanned  bool
+		disabled bool
+	}{
+		{name: "Below The Limit", reporter: mockLoadReporter{load: 40}, scanned: true},
+		{name: "At The Limit", reporter: mockLoadReporter{load: 75}, scanned: true},
+		{name: "Above The Limit", reporter: mockLoadReporter{load: 90}, scanned: false},
+		{name: "Unreadable", reporter: mockLoadReporter{err: errors.New("no /proc")}, scanned: true},
+		{name: "Unsupported", reporter: mockLoadReporter{err: controller.ErrCPULoadUnsupported}, scanned: true, disabled: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.videoFileser = &mockVideoFileser{files: []string{"/media/a.mkv"}}
+			m.fileStater = &mockFileStater{}
+			reporter := test.reporter
+			m.loadReporter = &reporter
+			m.SetMaxScanLoad(75)
+
+			lib := controller.Library{ID: 1, FsCheckInterval: time.Hour}
+			ds.libraries[lib.ID] = lib
+
+			ctx := context.Background()
+			wg := sync.WaitGroup{}
+			m.scheduleScans(ctx, &wg, []controller.Library{lib}, false)
+			wg.Wait()
+
+			if scanned := len(ds.libraries[lib.ID].Queue.Items) != 0; scanned != test.scanned {
+				t.Errorf("expected scanned to be %v but got %v", test.scanned, scanned)
+			}
+			if disabled := m.maxScanLoad == 0; disabled != test.disabled {
+				t.Errorf("expected the limit to be disabled to be %v but got %v", test.disabled, disabled)
+			}
+			if test.scanned {
+				return
+			}
+
+			// The deferred scan starts as soon as the load drops
+			reporter.load = 20
+			m.scheduleScans(ctx, &wg, []controller.Library{lib}, false)
+			wg.Wait()
+			if len(ds.libraries[lib.ID].Queue.Items) == 0 {
+				t.Errorf("expected the deferred scan to start once the load dropped")
+			}
+			if m.scansDeferredForLoad {
+				t.Errorf("expected scans to no longer be deferred")
+			}
+		})
+	}
+}
+
+func TestSetProcessingEnabled(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: []string{"/media/a.mkv"}}
+	m.fileStater = &mockFileStater{}
+
+	lib := controller.Library{ID: 1, FsCheckInterval: time.Hour}
+	ds.libraries[lib.ID] = lib
+	queueVideoFile(&m, &lib, "/media/b.mkv")
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+
+	m.SetProcessingEnabled(false)
+	if m.ProcessingEnabled() {
+		t.Fatalf("expected processing to be disabled")
+	}
+
+	m.scheduleScans(ctx, &wg, []controller.Library{lib}, false)
+	wg.Wait()
+	if _, ok := m.lastCheckedTimes[lib.ID]; ok {
+		t.Errorf("expected no scan to be scheduled while processing is disabled")
+	}
+	if _, err := m.PopNewJob(); err != controller.ErrNoJobAvailable {
+		t.Errorf("expected ErrNoJobAvailable while processing is disabled but got %v", err)
+	}
+
+	m.SetProcessingEnabled(true)
+	if !m.ProcessingEnabled() {
+		t.Fatalf("expected processing to be enabled")
+	}
+
+	job, err := m.PopNewJob()
+	if err != nil {
+		t.Fatalf("unexpected error after re-enabling processing: %v", err)
+	}
+	if job.Path != "/media/b.mkv" {
+		t.Errorf("expected the queued job to be popped but got %v", job.Path)
+	}
+
+	m.scheduleScans(ctx, &wg, []controller.Library{lib}, false)
+	wg.Wait()
+	if len(ds.libraries[lib.ID].Queue.Items) == 0 {
+		t.Errorf("expected the library to be scanned after re-enabling processing")
+	}
+}
+
+func TestDrainLibrary(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: []string{"/media/a.mkv"}}
+	m.fileStater = &mockFileStater{}
+
+	drained := controller.Library{ID: 1, Priority: 2, FsCheckInterval: time.Hour}
+	other := controller.Library{ID: 2, Priority: 1}
+	ds.libraries[drained.ID] = drained
+	ds.libraries[other.ID] = other
+	queueVideoFile(&m, &drained, "/media/b.mkv")
+	queueVideoFile(&m, &other, "/other/c.mkv")
+
+	if err := m.DrainLibrary(3); err == nil {
+		t.Errorf("expected an error when draining a library which doesn't exist")
+	}
+	if err := m.DrainLibrary(drained.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	job, err := m.PopNewJob()
+	if err != nil || job.Path != "/other/c.mkv" {
+		t.Fatalf("expected the job of the other library to be popped but got %+v, %v", job, err)
+	}
+	if _, err = m.PopNewJob(); err != controller.ErrNoJobAvailable {
+		t.Errorf("expected ErrNoJobAvailable with only the drained library's jobs left but got %v", err)
+	}
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	m.scheduleScans(ctx, &wg, []controller.Library{drained}, false)
+	wg.Wait()
+	if len(ds.libraries[drained.ID].Queue.Items) != 2 {
+		t.Errorf("expected the drained library to still be scanned but its queue is %+v", ds.libraries[drained.ID].Queue.Items)
+	}
+
+	if err = m.UndrainLibrary(drained.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job, err = m.PopNewJob(); err != nil || job.Path != "/media/b.mkv" {
+		t.Errorf("expected the undrained library's job to be popped but got %+v, %v", job, err)
+	}
+}
+
+func TestPopStrategy(t *testing.T) {
+	sizes := map[string]int64{"/media/a.mkv": 300, "/media/b.mkv": 100, "/media/c.mkv": 200, "/media/d.mkv": 100, "/media/low.mkv": 1}
+
+	tests := []struct {
+		name     string
+		strategy PopStrategy
+		expected []string
+	}{
+		{name: "Queue order", strategy: PopQueueOrder, expected: []string{"/media/a.mkv", "/media/b.mkv", "/media/c.mkv", "/media/d.mkv", "/media/low.mkv"}},
+		{name: "Smallest first", strategy: PopSmallestFirst, expected: []string{"/media/b.mkv", "/media/d.mkv", "/media/c.mkv", "/media/a.mkv", "/media/low.mkv"}},
+		{name: "Unknown strategy keeps queue order", strategy: "largest-first", expected: []string{"/media/a.mkv", "/media/b.mkv", "/media/c.mkv", "/media/d.mkv", "/media/low.mkv"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1, Priority: 1, Queue: controller.LibraryQueue{Items: []controller.Job{
+				{UUID: "a", Path: "/media/a.mkv"},
+				{UUID: "b", Path: "/media/b.mkv"},
+				{UUID: "c", Path: "/media/c.mkv"},
+				{UUID: "d", Path: "/media/d.mkv"},
+			}}}
+			ds.libraries[2] = controller.Library{ID: 2, Queue: controller.LibraryQueue{Items: []controller.Job{{UUID: "low", Path: "/media/low.mkv"}}}}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.fileStater = &mockFileStater{sizes: sizes}
+			m.SetPopStrategy(test.strategy)
+
+			for _, expected := range test.expected {
+				job, err := m.PopNewJob()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if job.Path != expected {
+					t.Errorf("expected %v to be popped but got %v", expected, job.Path)
+				}
+			}
+
+			if _, err := m.PopNewJob(); err != controller.ErrNoJobAvailable {
+				t.Errorf("expected ErrNoJobAvailable once the queues are empty but got %v", err)
+			}
+		})
+	}
+}
+
+// With queue aging, a job which has waited long enough is dispatched before the jobs of higher priority libraries
+func TestPopNewJobQueueAging(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		aging    float64
+		expected []string
+	}{
+		{name: "Aging disabled", aging: 0, expected: []string{"/media/fresh.mkv", "/media/old.mkv", "/media/unknown.mkv"}},
+		{name: "Old job outranks fresh ones", aging: 1, expected: []string{"/media/old.mkv", "/media/fresh.mkv", "/media/unknown.mkv"}},
+		{name: "Not aged enough", aging: 0.1, expected: []string{"/media/fresh.mkv", "/media/old.mkv", "/media/unknown.mkv"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1, Priority: 3, Queue: controller.LibraryQueue{Items: []controller.Job{
+				{UUID: "fresh", Path: "/media/fresh.mkv", QueuedAt: now.Add(-time.Hour)},
+			}}}
+			ds.libraries[2] = controller.Library{ID: 2, Priority: 0, Queue: controller.LibraryQueue{Items: []controller.Job{
+				{UUID: "old", Path: "/media/old.mkv", QueuedAt: now.Add(-time.Hour * 24 * 5)},
+			}}}
+			// Jobs queued before QueuedAt was recorded don't age
+			ds.libraries[3] = controller.Library{ID: 3, Priority: -1, Queue: controller.LibraryQueue{Items: []controller.Job{
+				{UUID: "unknown", Path: "/media/unknown.mkv"},
+			}}}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.fileStater = &mockFileStater{}
+			m.SetQueueAging(test.aging)
+
+			for _, expected := range test.expected {
+				job, err := m.PopNewJob()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if job.Path != expected {
+					t.Errorf("expected %v to be popped but got %v", expected, job.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestPopNewJobTranscodeBudget(t *testing.T) {
+	now := time.Now()
+
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media", Queue: controller.LibraryQueue{Items: []controller.Job{
+		{UUID: "c", LibraryID: 1, Path: "/media/c.mkv"},
+		{UUID: "d", LibraryID: 1, Path: "/media/d.mkv"},
+	}}}
+	ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", LibraryID: 1, Path: "/media/a.mkv"}}
+	ds.dispatchedJobs["b"] = controller.DispatchedJob{UUID: "b", Job: controller.Job{UUID: "b", LibraryID: 1, Path: "/media/b.mkv"}}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.fileRemover = &mockFileRemover{}
+	m.fileMover = &mockFileMover{}
+	m.fileStater = &mockFileStater{sizes: map[string]int64{"a.import.mkv": 60, "b.import.mkv": 50}}
+	m.now = func() time.Time { return now }
+	m.SetTranscodeBudget(100, 24*time.Hour)
+
+	// Under the budget
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+	if job, err := m.PopNewJob(); err != nil || job.UUID != "c" {
+		t.Fatalf("expected job c to be dispatched under the budget but got %+v, %v", job, err)
+	}
+
+	// Past the budget
+	now = now.Add(time.Hour)
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "b", InFile: "b.import.mkv"}})
+	if _, err := m.PopNewJob(); err != controller.ErrNoJobAvailable {
+		t.Fatalf("expected no job to be dispatched past the budget but got %v", err)
+	}
+
+	// a leaves the window, which brings the window back under the budget
+	now = now.Add(23 * time.Hour)
+	if job, err := m.PopNewJob(); err != nil || job.UUID != "d" {
+		t.Errorf("expected job d to be dispatched once the window moved on but got %+v, %v", job, err)
+	}
+}
+
+// A job isn't dispatched while it would overcommit the free space on its library's filesystem, and the space that
+// the dispatched jobs reserved is released once they complete.
+func TestPopNewJobSpaceReservation(t *testing.T) {
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/disk1", Priority: 1, Queue: controller.LibraryQueue{Items: []controller.Job{
+		{UUID: "a", LibraryID: 1, Path: "/disk1/a.mkv", Size: 100},
+		{UUID: "b", LibraryID: 1, Path: "/disk1/b.mkv", Size: 100},
+	}}}
+	ds.libraries[2] = controller.Library{ID: 2, Folder: "/disk2", Queue: controller.LibraryQueue{Items: []controller.Job{
+		{UUID: "c", LibraryID: 2, Path: "/disk2/c.mkv", Size: 100},
+	}}}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.fileRemover = &mockFileRemover{}
+	m.fileMover = &mockFileMover{}
+	m.fileStater = &mockFileStater{}
+	m.freeSpace = func(dir string) (uint64, error) { return map[string]uint64{"/disk1": 150, "/disk2": 1000}[dir], nil }
+	m.SetSpaceReservation(1)
+
+	// The dispatches are saved like the RunnerCommunicator does, since they are the reservations.
+	pop := func() (controller.Job, error) {
+		job, err := m.PopNewJob()
+		if err == nil {
+			ds.dispatchedJobs[job.UUID] = controller.DispatchedJob{UUID: job.UUID, Job: job}
+		}
+		return job, err
+	}
+
+	if job, err := pop(); err != nil || job.UUID != "a" {
+		t.Fatalf("expected job a to be dispatched but got %+v, %v", job, err)
+	}
+	// b would take disk1 past its free space, so the other library's job is dispatched instead.
+	if job, err := pop(); err != nil || job.UUID != "c" {
+		t.Fatalf("expected job c to be dispatched instead of overcommitting disk1 but got %+v, %v", job, err)
+	}
+	if _, err := pop(); err != controller.ErrNoJobAvailable {
+		t.Fatalf("expected no job to be dispatched while b doesn't fit but got %v", err)
+	}
+	if queue := ds.libraries[1].Queue.Items; len(queue) != 1 || queue[0].UUID != "b" {
+		t.Errorf("expected job b to stay queued but got %+v", queue)
+	}
+
+	// a completing releases its reservation.
+	m.ImportCompletedJobs([]controller.CompletedJob{{UUID: "a", InFile: "a.import.mkv"}})
+	if job, err := pop(); err != nil || job.UUID != "b" {
+		t.Errorf("expected job b to be dispatched once a completed but got %+v, %v", job, err)
+	}
+}
+
+func TestConcurrentLibraryChangesAreKept(t *testing.T) {
+	tests := []struct {
+		name string
+		// interleaveAt is the library read after which the other change is made.
+		interleaveAt int
+		// first is interrupted by second after its interleaveAt-th read.
+		first, second func(m *Manager)
+	}{
+		{
+			name:         "Queue push during a settings update",
+			interleaveAt: 2, // UpdateLibrarySettings reads the library once to check that it exists
+			first:        updateTestMasks,
+			second:       queueTestFile,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := &interleavingDataStorer{mockLibraryManagerDataStorer: newMockLibraryManagerDataStorer(), interleaveAt: test.interleaveAt}
+			ds.libraries[1] = controller.Library{ID: 1, PathMasks: []string{"Extras"}}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			ds.interleave = func() { test.second(&m) }
+
+			test.first(&m)
+
+			lib := ds.libraries[1]
+			if !reflect.DeepEqual(lib.PathMasks, []string{"Samples"}) {
+				t.Errorf("expected the settings update to be kept but got path masks %v", lib.PathMasks)
+			}
+			if len(lib.Queue.Items) != 1 || lib.Queue.Items[0].Path != "/media/a.mkv" {
+				t.Errorf("expected the queue push to be kept but got queue %v", lib.Queue.Items)
+			}
+		})
+	}
+}
+
+func queueTestFile(m *Manager) {
+	queueVideoFile(m, &controller.Library{ID: 1}, "/media/a.mkv")
+}
+
+func updateTestMasks(m *Manager) {
+	m.UpdateLibrarySettings(map[int]controller.Library{1: {PathMasks: []string{"Samples"}}})
+}
+
+func TestJobAnnotations(t *testing.T) {
+	annotations := map[string]string{"source": "sonarr", "request_id": "42"}
+
+	tests := []struct {
+		name          string
+		failed        bool
+		expectedEvent controller.EventType
+	}{
+		{name: "Completed job", failed: false, expectedEvent: controller.EventJobCompleted},
+		{name: "Failed job", failed: true, expectedEvent: controller.EventJobFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1}
+			notifier := &mockNotifier{}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{maxJobAttempts: 3}, &mockMetadataReader{}, &mockCommandDecider{annotations: annotations}, notifier, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.fileRemover = &mockFileRemover{}
+			m.fileMover = &mockFileMover{}
+			m.fileStater = &mockFileStater{}
+
+			queueVideoFile(&m, &controller.Library{ID: 1}, "/media/a.mkv")
+
+			job, err := m.PopNewJob()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(job.Annotations, annotations) {
+				t.Errorf("expected the queued job to have annotations %v but got %v", annotations, job.Annotations)
+			}
+
+			ds.dispatchedJobs[job.UUID] = controller.DispatchedJob{UUID: job.UUID, Job: job}
+			m.ImportCompletedJobs([]controller.CompletedJob{{UUID: job.UUID, Failed: test.failed, InFile: "a.import.mkv"}})
+
+			found := false
+			for _, e := range notifier.events {
+				if e.Type != test.expectedEvent {
+					continue
+				}
+				found = true
+				if !reflect.DeepEqual(e.Annotations, annotations) {
+					t.Errorf("expected the %v event to have annotations %v but got %v", e.Type, annotations, e.Annotations)
+				}
+			}
+			if !found {
+				t.Errorf("expected a %v event but got %v", test.expectedEvent, notifier.events)
+			}
+		})
+	}
+}
+
+// benchmarkQueueSize is the number of queued paths used by the queue membership benchmarks.
+const benchmarkQueueSize = 50_000
+
+func benchmarkQueue() controller.LibraryQueue {
+	q := controller.LibraryQueue{Items: make([]controller.Job, 0, benchmarkQueueSize)}
+	for i := 0; i < benchmarkQueueSize; i++ {
+		q.Push(controller.Job{UUID: controller.UUID(fmt.Sprint(i)), LibraryID: 1, Path: fmt.Sprintf("/media/tv/%v.mkv", i)})
+	}
+	return q
+}
+
+// BenchmarkQueueMembership compares checking every queued path against the queue itself, which is what scans used to do,
+// with checking it against a queuedPaths built once.
+func BenchmarkQueueMembership(b *testing.B) {
+	q := benchmarkQueue()
+
+	b.Run("InQueuePath", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, job := range q.Items {
+				if !q.InQueuePath(job) {
+					b.Fatalf("expected %v to be queued", job.Path)
+				}
+			}
+		}
+	})
+
+	b.Run("queuedPaths", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			queued := newQueuedPaths(q)
+			for _, job := range q.Items {
+				if !queued.contains(job.Path) {
+					b.Fatalf("expected %v to be queued", job.Path)
+				}
+			}
+		}
+	})
+}
+
+// BenchmarkScanQueuedLibrary scans a library whose files are all already queued.
+func BenchmarkScanQueuedLibrary(b *testing.B) {
+	q := benchmarkQueue()
+	files := make([]string, 0, len(q.Items))
+	for _, job := range q.Items {
+		files = append(files, job.Path)
+	}
+
+	ds := newMockLibraryManagerDataStorer()
+	lib := controller.Library{ID: 1, Folder: "/media/tv", Queue: q}
+	ds.libraries[lib.ID] = lib
+
+	mr := &mockMetadataReader{}
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, mr, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.videoFileser = &mockVideoFileser{files: files}
+
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		m.updateLibraryQueue(ctx, &wg, lib)
+	}
+	b.StopTimer()
+
+	if len(mr.read) != 0 {
+		b.Errorf("expected queued files to be skipped but %v were read", len(mr.read))
+	}
+}
+
+func TestCompactDispatched(t *testing.T) {
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	ds := newMockLibraryManagerDataStorer()
+	ds.dispatchedJobs["stale"] = controller.DispatchedJob{UUID: "stale", Job: controller.Job{UUID: "stale", Path: "/media/gone.mkv"}, LeaseExpires: now.Add(-time.Minute)}
+	ds.dispatchedJobs["unleased"] = controller.DispatchedJob{UUID: "unleased", Job: controller.Job{UUID: "unleased", Path: "/media/also_gone.mkv"}}
+	ds.dispatchedJobs["leased"] = controller.DispatchedJob{UUID: "leased", Job: controller.Job{UUID: "leased", Path: "/media/gone_leased.mkv"}, LeaseExpires: now.Add(time.Hour)}
+	ds.dispatchedJobs["live"] = controller.DispatchedJob{UUID: "live", Job: controller.Job{UUID: "live", Path: "/media/present.mkv"}, LeaseExpires: now.Add(-time.Minute)}
+
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, time.Hour)
+	m.fileStater = &mockFileStater{missing: map[string]bool{"/media/gone.mkv": true, "/media/also_gone.mkv": true, "/media/gone_leased.mkv": true}}
+	m.now = func() time.Time { return now }
+
+	removed, err := m.CompactDispatched()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 dispatched jobs to be removed but got %v", removed)
+	}
+
+	for _, uuid := range []controller.UUID{"stale", "unleased"} {
+		if _, ok := ds.dispatchedJobs[uuid]; ok {
+			t.Errorf("expected the dispatched job %v of a missing file without an active lease to be removed", uuid)
+		}
+	}
+	if _, ok := ds.dispatchedJobs["leased"]; !ok {
+		t.Errorf("expected the dispatched job of a missing file with an active lease to be kept")
+	}
+	if _, ok := ds.dispatchedJobs["live"]; !ok {
+		t.Errorf("expected the dispatched job of an existing file to be kept")
+	}
+
+	t.Run("Stat Error", func(t *testing.T) {
+		ds := newMockLibraryManagerDataStorer()
+		ds.dispatchedJobs["a"] = controller.DispatchedJob{UUID: "a", Job: controller.Job{UUID: "a", Path: "/media/a.mkv"}}
+
+		m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, time.Hour)
+		m.fileStater = &mockFileStater{err: os.ErrPermission}
+
+		if removed, err := m.CompactDispatched(); err != nil || removed != 0 {
+			t.Errorf("expected nothing to be removed but got %v, %v", removed, err)
+		}
+		if _, ok := ds.dispatchedJobs["a"]; !ok {
+			t.Errorf("expected the dispatched job of a file that can't be stated to be kept")
+		}
+	})
+}
+
+func TestCancelScan(t *testing.T) {
+	files := folderVideoFileser{}
+	for i := 0; i < 3*appendBatchSize; i++ {
+		files["/media"] = append(files["/media"], fmt.Sprintf("/media/%v.mkv", i))
+	}
+
+	reader := &mockMetadataReader{entered: make(chan struct{}), proceed: make(chan struct{})}
+	ds := newMockLibraryManagerDataStorer()
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, reader, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.SetMetadataReadConcurrency(1)
+	m.videoFileser = files
+	m.fileStater = &mockFileStater{}
+
+	lib := controller.Library{ID: 1, Folder: "/media", MetadataReadConcurrency: 1}
+	ds.libraries[lib.ID] = lib
+
+	if m.CancelScan(lib.ID) {
+		t.Errorf("expected no scan to be cancelled before one was started")
+	}
+
+	ctx := context.Background()
+	wg := sync.WaitGroup{}
+	m.scheduleScans(ctx, &wg, []controller.Library{lib}, false)
+
+	// Wait for the scan to be reading a file
+	select {
+	case <-reader.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the scan to start")
+	}
+
+	if !m.CancelScan(lib.ID) {
+		t.Fatal("expected the running scan to be cancelled")
+	}
+
+	// Let the reads that were already started finish
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	reader.proceed <- struct{}{}
+	for done := false; !done; {
+		select {
+		case <-reader.entered:
+			reader.proceed <- struct{}{}
+		case <-finished:
+			done = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the cancelled scan to stop")
+		}
+	}
+
+	read := map[string]struct{}{}
+	reader.mu.Lock()
+	for _, path := range reader.read {
+		read[path] = struct{}{}
+	}
+	reader.mu.Unlock()
+	if len(read) > 2 {
+		t.Errorf("expected the cancelled scan to stop after the files in progress but it read %v of %v files", len(read), len(files["/media"]))
+	}
+
+	if m.CancelScan(lib.ID) {
+		t.Errorf("expected no scan to be cancelled after it stopped")
+	}
+	if scanning := m.ScanningLibraries(); len(scanning) != 0 {
+		t.Errorf("expected no library to be scanning but got %v", scanning)
+	}
+}
+
+func TestDatastoreOutage(t *testing.T) {
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media", Queue: controller.LibraryQueue{Items: []controller.Job{
+		{UUID: "a", LibraryID: 1, Path: "/media/a.mkv"},
+	}}}
+
+	logger := &errorLogger{}
+	m := NewManager(logger, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	m.fileStater = &mockFileStater{}
+	m.now = func() time.Time { return now }
+	m.SetDatastoreOutagePolicy(8*time.Second, 3)
+
+	// Outage, simulating the ticks of Start for 10 minutes
+	ds.librariesErr = errors.New("database is locked")
+	start := now
+	expectedBackoffs := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second}
+	for i := 0; now.Sub(start) < 10*time.Minute; i++ {
+		_, err := m.RefreshLibraries()
+		if err == nil {
+			t.Fatalf("expected RefreshLibraries to fail during the outage")
+		}
+		backoff := m.datastoreFailed(err)
+
+		if i < len(expectedBackoffs) && backoff != expectedBackoffs[i] {
+			t.Errorf("expected a backoff of %v after %v failures but got %v", expectedBackoffs[i], i+1, backoff)
+		}
+		if down := m.Health().Down; down != (i >= 2) {
+			t.Errorf("expected the datastore to be down (%v) after %v failures but got %v", i >= 2, i+1, down)
+		}
+		now = now.Add(backoff)
+	}
+
+	h := m.Health()
+	if !h.Down || !h.FailingSince.Equal(start) || h.LastError != "database is locked" || h.Failures < 70 {
+		t.Errorf("expected the datastore to be down since %v after about 75 failures but got %+v", start, h)
+	}
+
+	// The first failure, the opening of the breaker after 3s, and then once per minute
+	if len(logger.errors) != 11 {
+		t.Errorf("expected the outage to be logged about once per minute but it was logged %v times: %v", len(logger.errors), logger.errors)
+	}
+
+	// No job is dispatched and nothing more is logged while the datastore is down
+	logged := len(logger.errors)
+	if _, err := m.PopNewJob(); err != controller.ErrNoJobAvailable {
+		t.Errorf("expected no job to be available while the datastore is down but got %v", err)
+	}
+	if _, err := m.LibrarySettings(); err == nil {
+		t.Errorf("expected LibrarySettings to fail while the datastore is down")
+	}
+	if len(logger.errors) != logged {
+		t.Errorf("expected nothing more to be logged while the datastore is down but got %v", logger.errors[logged:])
+	}
+
+	// Recovery
+	ds.librariesErr = nil
+	if _, err := m.RefreshLibraries(); err != nil {
+		t.Fatalf("expected RefreshLibraries to succeed after the outage but got %v", err)
+	}
+	m.datastoreReached()
+
+	if h := m.Health(); h != (controller.DatastoreHealth{}) {
+		t.Errorf("expected the datastore to be healthy after it was reached but got %+v", h)
+	}
+	if len(logger.infos) != 1 || !strings.Contains(logger.infos[0], "reachable again after 10m") {
+		t.Errorf("expected the recovery to be logged once but got %v", logger.infos)
+	}
+	if job, err := m.PopNewJob(); err != nil || job.UUID != "a" {
+		t.Errorf("expected job a to be dispatched after the datastore was reached but got %+v, %v", job, err)
+	}
+
+	// The next outage starts over
+	logged = len(logger.errors)
+	if backoff := m.datastoreFailed(errors.New("connection refused")); backoff != time.Second {
+		t.Errorf("expected the backoff to start over at 1s but got %v", backoff)
+	}
+	if len(logger.errors) != logged+1 {
+		t.Errorf("expected the start of the next outage to be logged")
+	}
+	if m.Health().Down {
+		t.Errorf("expected the datastore not to be down after a single failure")
+	}
+}
+
+// The dispatch plan puts the queued jobs in the order that PopNewJob dispatches them
+func TestPlanDispatch(t *testing.T) {
+	now := time.Now()
+	sizes := map[string]int64{"/media/a.mkv": 300, "/media/b.mkv": 100, "/media/c.mkv": 200, "/media/old.mkv": 50, "/media/new.mkv": 10, "/media/drained.mkv": 1}
+
+	for _, strategy := range []PopStrategy{PopQueueOrder, PopSmallestFirst} {
+		t.Run(string(strategy), func(t *testing.T) {
+			job := func(uuid string, queuedAt time.Time) controller.Job {
+				path := "/media/" + uuid + ".mkv"
+				return controller.Job{UUID: controller.UUID(uuid), Path: path, Size: sizes[path], QueuedAt: queuedAt}
+			}
+
+			ds := newMockLibraryManagerDataStorer()
+			ds.libraries[1] = controller.Library{ID: 1, Priority: 2, Queue: controller.LibraryQueue{Items: []controller.Job{
+				job("a", now), job("b", now), job("c", now),
+			}}}
+			ds.libraries[2] = controller.Library{ID: 2, Queue: controller.LibraryQueue{Items: []controller.Job{
+				job("new", now), job("old", now.Add(-5*24*time.Hour)),
+			}}}
+			ds.libraries[3] = controller.Library{ID: 3, Priority: 9, Queue: controller.LibraryQueue{Items: []controller.Job{
+				job("drained", now),
+			}}}
+
+			m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.fileStater = &mockFileStater{sizes: sizes}
+			m.SetPopStrategy(strategy)
+			m.SetQueueAging(1)
+			if err := m.DrainLibrary(3); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			libs, _ := ds.Libraries(context.Background())
+			m.setPlannedPositions(m.planDispatch(libs, now))
+			positions := m.DispatchPlan().Positions
+			if len(positions) != 5 {
+				t.Fatalf("expected 5 planned positions without the drained library but got %v", positions)
+			}
+			if _, ok := positions["drained"]; ok {
+				t.Errorf("expected the job of the drained library not to have a position")
+			}
+
+			for position := 1; position <= 5; position++ {
+				popped, err := m.PopNewJob()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if positions[popped.UUID] != position {
+					t.Errorf("expected %v to be planned at position %v but it was at %v", popped.UUID, position, positions[popped.UUID])
+				}
+			}
+		})
+	}
+}
+
+func TestDispatchPlanTypicalJobDuration(t *testing.T) {
+	m := NewManager(&mockLogger{}, newMockLibraryManagerDataStorer(), &mockSettingsStorer{}, &mockMetadataReader{}, &mockCommandDecider{}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+
+	m.observeJobDuration(0)
+	if d := m.DispatchPlan().TypicalJobDuration; d != 0 {
+		t.Errorf("expected an unknown duration to be ignored but got %v", d)
+	}
+
+	m.observeJobDuration(time.Hour)
+	m.observeJobDuration(2 * time.Hour)
+	if d := m.DispatchPlan().TypicalJobDuration; d != 72*time.Minute {
+		t.Errorf("expected the moving average to be 1h12m but got %v", d)
+	}
+
+	m.SetProcessingEnabled(false)
+	if !m.DispatchPlan().Paused {
+		t.Errorf("expected the plan to be paused while processing is disabled")
+	}
+}
+
+func TestBenchmarks(t *testing.T) {
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	ds := newMockLibraryManagerDataStorer()
+	ds.libraries[1] = controller.Library{ID: 1, Folder: "/media", CommandDeciderSettings: "library"}
+	ds.dispatchedJobs["other"] = controller.DispatchedJob{UUID: "other", Job: controller.Job{UUID: "other", LibraryID: 1, Path: "/media/b.mkv"}}
+
+	cd := &mockCommandDecider{decide: func(f controller.FileMetadata, s string) ([]string, error) {
+		return []string{"-i", "ENCODARR_INPUT_FILE", s}, nil
+	}}
+	m := NewManager(&mockLogger{}, ds, &mockSettingsStorer{}, &mockMetadataReader{}, cd, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+	fr := mockFileRemover{}
+	m.fileRemover = &fr
+	m.fileMover = &mockFileMover{}
+	m.fileStater = &mockFileStater{sizes: map[string]int64{"/media/a.mkv": 1000, "/media/b.mkv": 2000}}
+	m.now = func() time.Time { return now }
+	m.SetProcessingEnabled(false)
+
+	m.prepareBenchmark(controller.BenchmarkRequest{UUID: "busy", Path: "/media/b.mkv", LibraryID: 1})
+	m.prepareBenchmark(controller.BenchmarkRequest{UUID: "r2", Path: "/media/a.mkv", LibraryID: 1, Runner: "r2", Settings: "custom"})
+	m.prepareBenchmark(controller.BenchmarkRequest{UUID: "any", Path: "/media/a.mkv", LibraryID: 1})
+
+	// The benchmark of the dispatched file and the one for a Runner which isn't waiting are passed over.
+	job, err := m.PopBenchmarkJob([]string{"r1"})
+	if err != nil || job.UUID != "any" {
+		t.Fatalf("expected benchmark any to be popped even though processing is disabled but got %+v, %v", job, err)
+	}
+	if job.Benchmark == nil || job.Benchmark.Settings != "library" || job.Size != 1000 || !reflect.DeepEqual(job.Command, []string{"-i", "ENCODARR_INPUT_FILE", "library"}) {
+		t.Errorf("expected the benchmark to be decided with the library's settings but got %+v", job)
+	}
+	if _, err = m.PopBenchmarkJob([]string{"r1"}); err != controller.ErrNoJobAvailable {
+		t.Errorf("expected no benchmark for r1 but got %v", err)
+	}
+	if job, err = m.PopBenchmarkJob([]string{"r1", "r2"}); err != nil || job.UUID != "r2" || job.Benchmark.Settings != "custom" {
+		t.Fatalf("expected benchmark r2 with the custom settings but got %+v, %v", job, err)
+	}
+
+	// A completed benchmark is recorded without a history entry, and whatever was uploaded is thrown away.
+	ds.dispatchedJobs["r2"] = controller.DispatchedJob{UUID: "r2", Runner: "r2", Job: job}
+	m.ImportCompletedJobs([]controller.CompletedJob{{
+		UUID:      "r2",
+		InFile:    "r2.import.mkv",
+		History:   controller.History{Filename: "/media/a.mkv", DateTimeCompleted: now},
+		Benchmark: &controller.BenchmarkStats{Elapsed: time.Minute, FPS: 48, ProjectedSize: 400},
+	}})
+	if len(ds.history) != 0 {
+		t.Errorf("expected no history entries but got %+v", ds.history)
+	}
+	if len(fr.removed) != 1 || fr.removed[0] != "r2.import.mkv" {
+		t.Errorf("expected the uploaded file to be discarded but got removals %v", fr.removed)
+	}
+	if len(ds.benchmarks) != 1 {
+		t.Fatalf("expected 1 benchmark result but got %+v", ds.benchmarks)
+	}
+	r := ds.benchmarks[0]
+	if r.UUID != "r2" || r.Runner != "r2" || r.Failed || r.Settings != "custom" || r.SourceSize != 1000 || r.Elapsed != time.Minute || r.FPS != 48 || r.ProjectedSize != 400 {
+		t.Errorf("unexpected benchmark result %+v", r)
+	}
+
+	// A benchmark which can't be decided is recorded as failed right away.
+	cd.decide = func(f controller.FileMetadata, s string) ([]string, error) { return nil, errors.New("skip") }
+	m.prepareBenchmark(controller.BenchmarkRequest{UUID: "skipped", Path: "/media/a.mkv", LibraryID: 1})
+	if len(ds.benchmarks) != 2 || ds.benchmarks[1].UUID != "skipped" || !ds.benchmarks[1].Failed || len(ds.benchmarks[1].Errors) != 1 {
+		t.Errorf("expected benchmark skipped to be recorded as failed but got %+v", ds.benchmarks)
+	}
+}
@@ -1,8 +1,11 @@
 package mediainfo
 
+import "context"
+
 // Commander is an interface that allows for mocking out the os/exec package for testing.
 type Commander interface {
-	Command(name string, args ...string) Cmder
+	// Command returns a command which is killed once ctx is done.
+	Command(ctx context.Context, name string, args ...string) Cmder
 }
 
 // Cmder is an interface for mocking out the exec.Cmd struct.
@@ -1,8 +1,14 @@
 package mediainfo
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/BrenekH/encodarr/controller"
 )
@@ -12,6 +18,10 @@ func NewMetadataReader(logger controller.Logger) MetadataReader {
 	return MetadataReader{
 		logger: logger,
 		cmdr:   execCommander{},
+
+		baseTimeout:   DefaultTimeout,
+		timeoutPerGiB: DefaultTimeoutPerGiB,
+		maxTimeout:    DefaultMaxTimeout,
 	}
 }
 
@@ -20,12 +30,52 @@ type MetadataReader struct {
 	logger controller.Logger
 
 	cmdr Commander
+
+	// baseTimeout, timeoutPerGiB, and maxTimeout decide how long MediaInfo may take to read a file. See SetTimeout.
+	baseTimeout   time.Duration
+	timeoutPerGiB time.Duration
+	maxTimeout    time.Duration
+
+	// extraArgs are passed to MediaInfo before the path of every file, unless the file's library has its own.
+	extraArgs []string
+}
+
+// SetExtraArgs sets the arguments that are passed to MediaInfo before the path of every file whose library doesn't
+// have its own. It must be called before the first Read.
+func (m *MetadataReader) SetExtraArgs(args []string) {
+	m.extraArgs = args
 }
 
-// Read uses MediaInfo to read the file metadata.
-func (m *MetadataReader) Read(path string) (controller.FileMetadata, error) {
-	cmd := m.cmdr.Command("mediainfo", "--Output=JSON", "--Full", path)
+// Read uses MediaInfo to read the file metadata. MediaInfo is killed if it takes longer than the timeout for the file's
+// size, or than opts.Timeout if the file's library sets one. The arguments in opts replace the extra ones of m.
+func (m *MetadataReader) Read(path string, opts controller.MetadataReadOptions) (controller.FileMetadata, error) {
+	ctx := context.Background()
+	timeout := opts.Timeout
+	if timeout <= 0 && m.baseTimeout > 0 {
+		// A file that can't be stat'd gets the base timeout, and MediaInfo reports why it can't be read.
+		var size int64
+		if info, err := os.Stat(path); err == nil {
+			size = info.Size()
+		}
+		timeout = m.timeout(size)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	extraArgs := m.extraArgs
+	if len(opts.Args) > 0 {
+		extraArgs = opts.Args
+	}
+	args := append([]string{"--Output=JSON", "--Full"}, extraArgs...)
+
+	cmd := m.cmdr.Command(ctx, "mediainfo", append(args, path)...)
 	b, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return controller.FileMetadata{}, fmt.Errorf("mediainfo didn't finish reading %v within %v", path, timeout)
+	}
 	if err != nil {
 		return controller.FileMetadata{}, err
 	}
@@ -40,6 +90,9 @@ func (m *MetadataReader) Read(path string) (controller.FileMetadata, error) {
 	vidTracks := make([]controller.VideoTrack, 0)
 	audioTracks := make([]controller.AudioTrack, 0)
 	subtitleTracks := make([]controller.SubtitleTrack, 0)
+	var closedCaptions bool
+	var chapters bool
+	programs := newProgramList()
 
 	for _, v := range mi.Media.Tracks {
 		switch v.Type {
@@ -65,8 +118,18 @@ func (m *MetadataReader) Read(path string) (controller.FileMetadata, error) {
 			}
 
 			vidTrack.ColorPrimaries = v.ColourPrimaries
+			vidTrack.VariableFrameRate = v.FrameRateMode == "VFR"
+
+			// MediaInfo doesn't report the bit depth of every format, so a missing or invalid one is left as unknown.
+			if v.BitDepth != "" {
+				if bitDepth, err := strconv.Atoi(v.BitDepth); err == nil {
+					vidTrack.BitDepth = bitDepth
+				} else {
+					m.logger.Debug("error while converting vidTrack.BitDepth for %v: %v", path, err)
+				}
+			}
 
-			if vidTrack.Index, err = strconv.Atoi(v.StreamOrder); err != nil {
+			if vidTrack.Index, err = parseStreamOrder(v.StreamOrder); err != nil {
 				m.logger.Debug("error while converting vidTrack.Index (StreamOrder) for %v: %v", path, err)
 				return controller.FileMetadata{}, err
 			}
@@ -81,11 +144,12 @@ func (m *MetadataReader) Read(path string) (controller.FileMetadata, error) {
 				return controller.FileMetadata{}, err
 			}
 
+			programs.add(v.MenuID, vidTrack.Index)
 			vidTracks = append(vidTracks, vidTrack)
 		case "Audio":
 			audioTrack := controller.AudioTrack{}
 
-			if audioTrack.Index, err = strconv.Atoi(v.StreamOrder); err != nil {
+			if audioTrack.Index, err = parseStreamOrder(v.StreamOrder); err != nil {
 				m.logger.Debug("error while converting audioTrack.Index (StreamOrder) for %v: %v", path, err)
 				return controller.FileMetadata{}, err
 			}
@@ -95,11 +159,20 @@ func (m *MetadataReader) Read(path string) (controller.FileMetadata, error) {
 				return controller.FileMetadata{}, err
 			}
 
+			audioTrack.Language = v.Language
+
+			programs.add(v.MenuID, audioTrack.Index)
 			audioTracks = append(audioTracks, audioTrack)
 		case "Text":
+			// Closed captions are carried inside of the video stream, so they can't be mapped like a subtitle track.
+			if isClosedCaptionFormat(v.Format) {
+				closedCaptions = true
+				continue
+			}
+
 			textTrack := controller.SubtitleTrack{}
 
-			if textTrack.Index, err = strconv.Atoi(v.StreamOrder); err != nil {
+			if textTrack.Index, err = parseStreamOrder(v.StreamOrder); err != nil {
 				if textTrack.Index, err = strconv.Atoi(v.UniqueID); err != nil {
 					m.logger.Warn("error while converting textTrack.Index (StreamOrder, UniqueID) for %v: %v", path, err)
 					continue
@@ -108,8 +181,13 @@ func (m *MetadataReader) Read(path string) (controller.FileMetadata, error) {
 
 			textTrack.Language = v.Language
 
+			programs.add(v.MenuID, textTrack.Index)
 			subtitleTracks = append(subtitleTracks, textTrack)
 		case "Menu":
+			// Menu tracks also describe things like MPEG-TS programs, but only chapter menus have chapter positions.
+			if v.ChaptersPosBegin != "" {
+				chapters = true
+			}
 		default:
 		}
 	}
@@ -121,5 +199,49 @@ func (m *MetadataReader) Read(path string) (controller.FileMetadata, error) {
 		VideoTracks:    vidTracks,
 		AudioTracks:    audioTracks,
 		SubtitleTracks: subtitleTracks,
+		ClosedCaptions: closedCaptions,
+		Chapters:       chapters,
+		Programs:       programs.programs,
 	}, nil
 }
+
+// parseStreamOrder parses the StreamOrder of a track. MediaInfo reports the StreamOrder of the streams of a transport
+// stream as <container>-<stream> (ex. 0-1), in which case the position of the stream is used.
+func parseStreamOrder(s string) (int, error) {
+	if i := strings.LastIndex(s, "-"); i > 0 {
+		s = s[i+1:]
+	}
+	return strconv.Atoi(s)
+}
+
+// programList groups the tracks of a file into the programs which their MenuID names, in the order that they are first seen.
+type programList struct {
+	programs  []controller.Program
+	positions map[int]int
+}
+
+func newProgramList() *programList {
+	return &programList{positions: make(map[int]int)}
+}
+
+// add adds the track with the provided index to the program with the ID menuID. Tracks without a valid MenuID
+// don't belong to a program.
+func (p *programList) add(menuID string, index int) {
+	id, err := strconv.Atoi(menuID)
+	if err != nil {
+		return
+	}
+
+	pos, ok := p.positions[id]
+	if !ok {
+		pos = len(p.programs)
+		p.positions[id] = pos
+		p.programs = append(p.programs, controller.Program{ID: id})
+	}
+	p.programs[pos].StreamIndexes = append(p.programs[pos].StreamIndexes, index)
+}
+
+// isClosedCaptionFormat returns whether or not the MediaInfo text format is an embedded closed caption format.
+func isClosedCaptionFormat(format string) bool {
+	return format == "EIA-608" || format == "EIA-708"
+}
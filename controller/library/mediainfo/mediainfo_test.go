@@ -0,0 +1,240 @@
+package mediainfo
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func TestReadClosedCaptions(t *testing.T) {
+	tests := []struct {
+		name             string
+		fixture          string
+		expectedCaptions bool
+		expectedTracks   int
+	}{
+		{name: "Embedded EIA-608 Captions", fixture: "testdata/captions.json", expectedCaptions: true, expectedTracks: 0},
+		{name: "No Captions", fixture: "testdata/plain.json", expectedCaptions: false, expectedTracks: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := os.ReadFile(test.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cmdr := &mockCommander{output: b}
+			m := MetadataReader{logger: &mockLogger{}, cmdr: cmdr}
+
+			metadata, err := m.Read("/media/file.mkv", controller.MetadataReadOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(cmdr.lastArgs, []string{"--Output=JSON", "--Full", "/media/file.mkv"}) {
+				t.Errorf("unexpected mediainfo arguments: %v", cmdr.lastArgs)
+			}
+
+			if metadata.ClosedCaptions != test.expectedCaptions {
+				t.Errorf("expected ClosedCaptions to be %v but got %v", test.expectedCaptions, metadata.ClosedCaptions)
+			}
+
+			if len(metadata.SubtitleTracks) != test.expectedTracks {
+				t.Errorf("expected %v subtitle tracks but got %v", test.expectedTracks, metadata.SubtitleTracks)
+			}
+
+			if len(metadata.VideoTracks) != 1 {
+				t.Errorf("expected 1 video track but got %v", metadata.VideoTracks)
+			}
+		})
+	}
+}
+
+func TestReadChapters(t *testing.T) {
+	tests := []struct {
+		name             string
+		fixture          string
+		expectedChapters bool
+	}{
+		{name: "Chapter Menu", fixture: "testdata/chapters.json", expectedChapters: true},
+		{name: "No Chapters", fixture: "testdata/plain.json", expectedChapters: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := os.ReadFile(test.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := MetadataReader{logger: &mockLogger{}, cmdr: &mockCommander{output: b}}
+
+			metadata, err := m.Read("/media/file.mkv", controller.MetadataReadOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if metadata.Chapters != test.expectedChapters {
+				t.Errorf("expected Chapters to be %v but got %v", test.expectedChapters, metadata.Chapters)
+			}
+		})
+	}
+}
+
+func TestReadBitDepth(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		expected int
+	}{
+		{name: "10-bit", fixture: "testdata/plain.json", expected: 10},
+		{name: "8-bit", fixture: "testdata/chapters.json", expected: 8},
+		{name: "Not Reported", fixture: "testdata/captions.json", expected: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := os.ReadFile(test.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := MetadataReader{logger: &mockLogger{}, cmdr: &mockCommander{output: b}}
+
+			metadata, err := m.Read("/media/file.mkv", controller.MetadataReadOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(metadata.VideoTracks) != 1 {
+				t.Fatalf("expected 1 video track but got %v", metadata.VideoTracks)
+			}
+			if metadata.VideoTracks[0].BitDepth != test.expected {
+				t.Errorf("expected a bit depth of %v but got %v", test.expected, metadata.VideoTracks[0].BitDepth)
+			}
+		})
+	}
+}
+
+func TestReadVariableFrameRate(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixture     string
+		expectedVFR bool
+	}{
+		{name: "Variable Frame Rate", fixture: "testdata/vfr.json", expectedVFR: true},
+		{name: "Constant Frame Rate", fixture: "testdata/plain.json", expectedVFR: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := os.ReadFile(test.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := MetadataReader{logger: &mockLogger{}, cmdr: &mockCommander{output: b}}
+
+			metadata, err := m.Read("/media/file.mkv", controller.MetadataReadOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(metadata.VideoTracks) != 1 || metadata.VideoTracks[0].VariableFrameRate != test.expectedVFR {
+				t.Errorf("expected VariableFrameRate to be %v but got %+v", test.expectedVFR, metadata.VideoTracks)
+			}
+		})
+	}
+}
+
+func TestReadPrograms(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		expected []controller.Program
+	}{
+		{
+			name:    "Transport Stream",
+			fixture: "testdata/programs.json",
+			expected: []controller.Program{
+				{ID: 3, StreamIndexes: []int{0}},
+				{ID: 4, StreamIndexes: []int{1, 2, 3}},
+			},
+		},
+		{name: "No Programs", fixture: "testdata/plain.json", expected: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := os.ReadFile(test.fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := MetadataReader{logger: &mockLogger{}, cmdr: &mockCommander{output: b}}
+
+			metadata, err := m.Read("/media/file.ts", controller.MetadataReadOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(metadata.Programs, test.expected) {
+				t.Errorf("expected the programs %+v but got %+v", test.expected, metadata.Programs)
+			}
+		})
+	}
+}
+
+func TestReadOptions(t *testing.T) {
+	b, err := os.ReadFile("testdata/plain.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		opts            controller.MetadataReadOptions
+		expectedArgs    []string
+		expectedTimeout time.Duration
+	}{
+		{
+			name:            "Library Overrides",
+			opts:            controller.MetadataReadOptions{Timeout: 5 * time.Minute, Args: []string{"--ParseSpeed=1"}},
+			expectedArgs:    []string{"--Output=JSON", "--Full", "--ParseSpeed=1", "/media/file.mkv"},
+			expectedTimeout: 5 * time.Minute,
+		},
+		{
+			name:            "Global Defaults",
+			opts:            controller.MetadataReadOptions{},
+			expectedArgs:    []string{"--Output=JSON", "--Full", "--ParseSpeed=0", "/media/file.mkv"},
+			expectedTimeout: DefaultTimeout,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmdr := &mockCommander{output: b}
+			m := NewMetadataReader(&mockLogger{})
+			m.cmdr = cmdr
+			m.SetExtraArgs([]string{"--ParseSpeed=0"})
+
+			start := time.Now()
+			if _, err := m.Read("/media/file.mkv", test.opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(cmdr.lastArgs, test.expectedArgs) {
+				t.Errorf("expected the mediainfo arguments %v but got %v", test.expectedArgs, cmdr.lastArgs)
+			}
+
+			// The file doesn't exist, so the global timeout is the base one.
+			if cmdr.lastDeadline.Before(start.Add(test.expectedTimeout)) || cmdr.lastDeadline.After(time.Now().Add(test.expectedTimeout)) {
+				t.Errorf("expected a timeout of %v but got %v", test.expectedTimeout, cmdr.lastDeadline.Sub(start))
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package mediainfo
+
+import (
+	"context"
+	"time"
+)
+
+type mockCommander struct {
+	output []byte
+	err    error
+
+	lastName     string
+	lastArgs     []string
+	lastDeadline time.Time // Zero if the last command had no deadline.
+}
+
+func (m *mockCommander) Command(ctx context.Context, name string, args ...string) Cmder {
+	m.lastName = name
+	m.lastArgs = args
+	m.lastDeadline, _ = ctx.Deadline()
+	return mockCmder{output: m.output, err: m.err}
+}
+
+type mockCmder struct {
+	output []byte
+	err    error
+}
+
+func (m mockCmder) Output() ([]byte, error) {
+	return m.output, m.err
+}
+
+type mockLogger struct{}
+
+func (m *mockLogger) Trace(s string, i ...interface{})    {}
+func (m *mockLogger) Debug(s string, i ...interface{})    {}
+func (m *mockLogger) Info(s string, i ...interface{})     {}
+func (m *mockLogger) Warn(s string, i ...interface{})     {}
+func (m *mockLogger) Error(s string, i ...interface{})    {}
+func (m *mockLogger) Critical(s string, i ...interface{}) {}
@@ -1,11 +1,14 @@
 package mediainfo
 
-import "os/exec"
+import (
+	"context"
+	"os/exec"
+)
 
 type execCommander struct{}
 
-func (e execCommander) Command(name string, args ...string) Cmder {
-	return exec.Command(name, args...)
+func (e execCommander) Command(ctx context.Context, name string, args ...string) Cmder {
+	return exec.CommandContext(ctx, name, args...)
 }
 
 type mediaInfo struct {
@@ -88,6 +91,7 @@ type track struct {
 	// From Video Track Type
 	ID                             string `json:"ID"`
 	IDString                       string `json:"ID_String"`
+	MenuID                         string `json:"MenuID"` // The program that the track belongs to in a transport stream.
 	FormatInfo                     string `json:"Format_Info"`
 	FormatProfile                  string `json:"Format_Profile"`
 	FormatLevel                    string `json:"Format_Level"`
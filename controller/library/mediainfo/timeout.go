@@ -0,0 +1,42 @@
+package mediainfo
+
+import "time"
+
+const (
+	// DefaultTimeout is how long MediaInfo may take to read an empty file unless SetTimeout is called.
+	DefaultTimeout = time.Minute
+
+	// DefaultTimeoutPerGiB is how much longer MediaInfo may take per GiB of the file unless SetTimeout is called.
+	DefaultTimeoutPerGiB = 10 * time.Second
+
+	// DefaultMaxTimeout is the most time that MediaInfo may take for any file unless SetTimeout is called.
+	DefaultMaxTimeout = 15 * time.Minute
+)
+
+// gib is the number of bytes in a GiB.
+const gib = 1 << 30
+
+// SetTimeout sets how long MediaInfo may take to read a file before it is killed. A file gets base plus perGiB for
+// every GiB of its size, up to max, so that very long recordings aren't timed out while small files still are quickly.
+// A base of 0 disables the timeout. It must be called before the first Read.
+func (m *MetadataReader) SetTimeout(base, perGiB, max time.Duration) {
+	m.baseTimeout = base
+	m.timeoutPerGiB = perGiB
+	m.maxTimeout = max
+}
+
+// timeout returns how long MediaInfo may take to read a file of size bytes, or 0 if it may take as long as it needs.
+func (m *MetadataReader) timeout(size int64) time.Duration {
+	if m.baseTimeout <= 0 {
+		return 0
+	}
+
+	t := m.baseTimeout
+	if size > 0 && m.timeoutPerGiB > 0 {
+		t += time.Duration(float64(m.timeoutPerGiB) * float64(size) / gib)
+	}
+	if m.maxTimeout > 0 && t > m.maxTimeout {
+		t = m.maxTimeout
+	}
+	return t
+}
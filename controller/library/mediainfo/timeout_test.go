@@ -0,0 +1,36 @@
+package mediainfo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	m := NewMetadataReader(&mockLogger{})
+	m.SetTimeout(time.Minute, 10*time.Second, 15*time.Minute)
+
+	tests := []struct {
+		name     string
+		size     int64
+		expected time.Duration
+	}{
+		{name: "Empty File", size: 0, expected: time.Minute},
+		{name: "Half A GiB", size: gib / 2, expected: time.Minute + 5*time.Second},
+		{name: "4 GiB", size: 4 * gib, expected: time.Minute + 40*time.Second},
+		{name: "60 GiB", size: 60 * gib, expected: 11 * time.Minute},
+		{name: "Capped", size: 200 * gib, expected: 15 * time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if timeout := m.timeout(test.size); timeout != test.expected {
+				t.Errorf("expected a timeout of %v but got %v", test.expected, timeout)
+			}
+		})
+	}
+
+	m.SetTimeout(0, 10*time.Second, 15*time.Minute)
+	if timeout := m.timeout(200 * gib); timeout != 0 {
+		t.Errorf("expected no timeout when it is disabled but got %v", timeout)
+	}
+}
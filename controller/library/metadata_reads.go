@@ -0,0 +1,35 @@
+package library
+
+import "github.com/BrenekH/encodarr/controller"
+
+// defaultMetadataReadConcurrency is how many metadata reads may run at once across all scans unless
+// SetMetadataReadConcurrency is called.
+const defaultMetadataReadConcurrency = 4
+
+// SetMetadataReadConcurrency sets how many metadata reads may run at once across all scans. Libraries work on this
+// many files at once unless they set their own MetadataReadConcurrency, which is still capped by it.
+// Values below 1 are ignored. It must be called before Start.
+func (m *Manager) SetMetadataReadConcurrency(n int) {
+	if n < 1 {
+		m.logger.Warn("Invalid metadata read concurrency %v, keeping %v", n, cap(m.metadataReadSlots))
+		return
+	}
+	m.metadataReadSlots = make(chan struct{}, n)
+}
+
+// scanConcurrency returns how many files a scan of lib works on at once.
+func (m *Manager) scanConcurrency(lib controller.Library) int {
+	if lib.MetadataReadConcurrency > 0 {
+		return lib.MetadataReadConcurrency
+	}
+	return cap(m.metadataReadSlots)
+}
+
+// readMetadata reads the metadata of path with the overrides of lib once one of the metadata read slots is free,
+// so that the scans of all libraries together don't exceed the global limit.
+func (m *Manager) readMetadata(lib controller.Library, path string) (controller.FileMetadata, error) {
+	m.metadataReadSlots <- struct{}{}
+	defer func() { <-m.metadataReadSlots }()
+
+	return m.metadataReader.Read(path, lib.MetadataReadOptions())
+}
@@ -0,0 +1,839 @@
+package library
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+var errMockNotFound = errors.New("not found")
+
+type mockLibraryManagerDataStorer struct {
+	sync.Mutex
+
+	libraries      map[int]controller.Library
+	dispatchedJobs map[controller.UUID]controller.DispatchedJob
+	heldParts      []controller.HeldGroupPart
+	history        []controller.History
+	benchmarks     []controller.BenchmarkResult
+	attempts       map[string]int
+	quarantined    map[string]controller.QuarantinedJob
+	skipped        map[string]bool
+	processed      map[string]time.Time
+	snapshots      map[string]controller.FileSnapshot
+
+	// deletedLibraries are the libraries which are waiting to be purged. They aren't returned by Libraries or Library.
+	deletedLibraries map[int]controller.Library
+
+	saveLibraryCalls int
+	appendJobsCalls  int
+
+	// librariesErr is returned by Libraries to simulate an outage.
+	librariesErr error
+}
+
+func newMockLibraryManagerDataStorer() *mockLibraryManagerDataStorer {
+	return &mockLibraryManagerDataStorer{
+		libraries:      make(map[int]controller.Library),
+		dispatchedJobs: make(map[controller.UUID]controller.DispatchedJob),
+		attempts:       make(map[string]int),
+		quarantined:    make(map[string]controller.QuarantinedJob),
+		skipped:        make(map[string]bool),
+		processed:      make(map[string]time.Time),
+		snapshots:      make(map[string]controller.FileSnapshot),
+
+		deletedLibraries: make(map[int]controller.Library),
+	}
+}
+
+func (m *mockLibraryManagerDataStorer) Libraries(ctx context.Context) ([]controller.Library, error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.librariesErr != nil {
+		return nil, m.librariesErr
+	}
+	libs := make([]controller.Library, 0, len(m.libraries))
+	for _, v := range m.libraries {
+		libs = append(libs, v)
+	}
+	return libs, nil
+}
+
+func (m *mockLibraryManagerDataStorer) Library(ctx context.Context, id int) (controller.Library, error) {
+	m.Lock()
+	defer m.Unlock()
+	l, ok := m.libraries[id]
+	if !ok {
+		return controller.Library{}, errMockNotFound
+	}
+	// The queue is copied like the real data storers do, so that changes which aren't saved are lost.
+	if l.Queue.Items != nil {
+		l.Queue.Items = append(make([]controller.Job, 0, len(l.Queue.Items)), l.Queue.Items...)
+	}
+	return l, nil
+}
+
+// SaveLibrary follows the same versioning rules as the real data storers so that lost updates are caught by the tests.
+func (m *mockLibraryManagerDataStorer) SaveLibrary(ctx context.Context, l controller.Library) error {
+	m.Lock()
+	defer m.Unlock()
+	m.saveLibraryCalls++
+	if stored, ok := m.libraries[l.ID]; ok && stored.Version != l.Version {
+		return controller.ErrLibraryConflict
+	}
+	l.Version++
+	m.libraries[l.ID] = l
+	return nil
+}
+
+func (m *mockLibraryManagerDataStorer) AppendJobs(ctx context.Context, libraryID int, jobs []controller.Job) ([]controller.Job, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.appendJobsCalls++
+	l, ok := m.libraries[libraryID]
+	if !ok {
+		return nil, errMockNotFound
+	}
+	l.Queue.Items = append([]controller.Job{}, l.Queue.Items...)
+	appended := l.Queue.PushNew(jobs)
+	l.Version++
+	m.libraries[libraryID] = l
+	return appended, nil
+}
+
+func (m *mockLibraryManagerDataStorer) IsPathDispatched(ctx context.Context, path string) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	for _, v := range m.dispatchedJobs {
+		if v.Job.Path == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockLibraryManagerDataStorer) IsJobDispatched(ctx context.Context, uuid controller.UUID) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	_, ok := m.dispatchedJobs[uuid]
+	return ok, nil
+}
+
+func (m *mockLibraryManagerDataStorer) PopDispatchedJob(ctx context.Context, uuid controller.UUID) (controller.DispatchedJob, error) {
+	m.Lock()
+	defer m.Unlock()
+	dj, ok := m.dispatchedJobs[uuid]
+	if !ok {
+		return controller.DispatchedJob{UUID: uuid}, sql.ErrNoRows
+	}
+	delete(m.dispatchedJobs, uuid)
+	return dj, nil
+}
+
+func (m *mockLibraryManagerDataStorer) DispatchedJobCount(ctx context.Context, libraryID int) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+	count := 0
+	for _, v := range m.dispatchedJobs {
+		if v.Job.LibraryID == libraryID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockLibraryManagerDataStorer) DispatchedJobs(ctx context.Context) ([]controller.DispatchedJob, error) {
+	m.Lock()
+	defer m.Unlock()
+	dJobs := make([]controller.DispatchedJob, 0, len(m.dispatchedJobs))
+	for _, v := range m.dispatchedJobs {
+		dJobs = append(dJobs, v)
+	}
+	return dJobs, nil
+}
+
+func (m *mockLibraryManagerDataStorer) RevokeLease(ctx context.Context, uuid controller.UUID, now time.Time) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	dj, ok := m.dispatchedJobs[uuid]
+	if !ok || dj.LeaseExpires.After(now) {
+		return false, nil
+	}
+	delete(m.dispatchedJobs, uuid)
+	return true, nil
+}
+
+func (m *mockLibraryManagerDataStorer) HoldGroupPart(ctx context.Context, p controller.HeldGroupPart) error {
+	m.Lock()
+	defer m.Unlock()
+	for i, v := range m.heldParts {
+		if v.Completed.UUID == p.Completed.UUID {
+			m.heldParts[i] = p
+			return nil
+		}
+	}
+	m.heldParts = append(m.heldParts, p)
+	return nil
+}
+
+func (m *mockLibraryManagerDataStorer) HeldGroupParts(ctx context.Context) ([]controller.HeldGroupPart, error) {
+	m.Lock()
+	defer m.Unlock()
+	return append([]controller.HeldGroupPart{}, m.heldParts...), nil
+}
+
+func (m *mockLibraryManagerDataStorer) ReleaseGroupParts(ctx context.Context, group string) error {
+	m.Lock()
+	defer m.Unlock()
+	kept := make([]controller.HeldGroupPart, 0, len(m.heldParts))
+	for _, p := range m.heldParts {
+		if p.Dispatched.Job.Group != group {
+			kept = append(kept, p)
+		}
+	}
+	m.heldParts = kept
+	return nil
+}
+
+func (m *mockLibraryManagerDataStorer) PushHistory(ctx context.Context, h controller.History) error {
+	m.Lock()
+	defer m.Unlock()
+	m.history = append(m.history, h)
+	return nil
+}
+
+func (m *mockLibraryManagerDataStorer) SaveBenchmarkResult(ctx context.Context, r controller.BenchmarkResult) error {
+	m.Lock()
+	defer m.Unlock()
+	m.benchmarks = append(m.benchmarks, r)
+	return nil
+}
+
+func (m *mockLibraryManagerDataStorer) IncrementJobAttempts(ctx context.Context, path string) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.attempts[path]++
+	return m.attempts[path], nil
+}
+
+func (m *mockLibraryManagerDataStorer) ResetJobAttempts(ctx context.Context, path string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.attempts, path)
+	return nil
+}
+
+func (m *mockLibraryManagerDataStorer) QuarantineJob(ctx context.Context, q controller.QuarantinedJob) error {
+	m.Lock()
+	defer m.Unlock()
+	m.quarantined[q.Job.Path] = q
+	return nil
+}
+
+func (m *mockLibraryManagerDataStorer) IsPathQuarantined(ctx context.Context, path string) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	_, ok := m.quarantined[path]
+	return ok, nil
+}
+
+func (m *mockLibraryManagerDataStorer) IsPathSkipped(ctx context.Context, path string) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.skipped[path], nil
+}
+
+func (m *mockLibraryManagerDataStorer) ReleaseExpiredQuarantines(ctx context.Context, quarantinedBefore time.Time) ([]string, error) {
+	m.Lock()
+	defer m.Unlock()
+	released := make([]string, 0)
+	for path, q := range m.quarantined {
+		if q.DateTimeQuarantined.Before(quarantinedBefore) {
+			delete(m.quarantined, path)
+			delete(m.attempts, path)
+			released = append(released, path)
+		}
+	}
+	return released, nil
+}
+
+func (m *mockLibraryManagerDataStorer) LastProcessedModtime(ctx context.Context, path string) (time.Time, error) {
+	m.Lock()
+	defer m.Unlock()
+	t, ok := m.processed[path]
+	if !ok {
+		return time.Time{}, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+func (m *mockLibraryManagerDataStorer) SaveLastProcessedModtime(ctx context.Context, path string, t time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	m.processed[path] = t
+	return nil
+}
+
+func (m *mockLibraryManagerDataStorer) CanonicalizePaths(ctx context.Context, canonicalize func(path string) string) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+	changed := 0
+	for path, modtime := range m.processed {
+		if canonical := canonicalize(path); canonical != path {
+			delete(m.processed, path)
+			if t, ok := m.processed[canonical]; !ok || modtime.After(t) {
+				m.processed[canonical] = modtime
+			}
+			changed++
+		}
+	}
+	for path, attempts := range m.attempts {
+		if canonical := canonicalize(path); canonical != path {
+			delete(m.attempts, path)
+			if a, ok := m.attempts[canonical]; !ok || attempts > a {
+				m.attempts[canonical] = attempts
+			}
+			changed++
+		}
+	}
+	for path, q := range m.quarantined {
+		if canonical := canonicalize(path); canonical != path {
+			delete(m.quarantined, path)
+			if _, ok := m.quarantined[canonical]; !ok {
+				q.Job.Path = canonical
+				m.quarantined[canonical] = q
+			}
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+func (m *mockLibraryManagerDataStorer) DeleteProcessedModtimes(ctx context.Context, pathPrefix string) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+	deleted := 0
+	for path := range m.processed {
+		if strings.HasPrefix(path, pathPrefix) {
+			delete(m.processed, path)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *mockLibraryManagerDataStorer) FileSnapshotModtimes(ctx context.Context, libraryID int) (map[string]time.Time, error) {
+	m.Lock()
+	defer m.Unlock()
+	modtimes := make(map[string]time.Time)
+	for path, s := range m.snapshots {
+		if s.LibraryID == libraryID {
+			modtimes[path] = s.Modtime
+		}
+	}
+	return modtimes, nil
+}
+
+func (m *mockLibraryManagerDataStorer) SaveFileSnapshot(ctx context.Context, s controller.FileSnapshot) error {
+	m.Lock()
+	defer m.Unlock()
+	m.snapshots[s.Path] = s
+	return nil
+}
+
+func (m *mockLibraryManagerDataStorer) DeleteFileSnapshots(ctx context.Context, paths []string) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+	deleted := 0
+	for _, path := range paths {
+		if _, ok := m.snapshots[path]; ok {
+			delete(m.snapshots, path)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *mockLibraryManagerDataStorer) PurgeDeletedLibraries(ctx context.Context, deletedBefore time.Time) ([]controller.Library, error) {
+	m.Lock()
+	defer m.Unlock()
+	purged := make([]controller.Library, 0)
+	for id, lib := range m.deletedLibraries {
+		if lib.DeletedAt.Before(deletedBefore) {
+			delete(m.deletedLibraries, id)
+			purged = append(purged, lib)
+		}
+	}
+	return purged, nil
+}
+
+func (m *mockLibraryManagerDataStorer) DeleteLibrary(ctx context.Context, id int, t time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	lib, ok := m.libraries[id]
+	if !ok {
+		return nil
+	}
+	delete(m.libraries, id)
+	lib.DeletedAt = t
+	lib.Version++
+	m.deletedLibraries[id] = lib
+	return nil
+}
+
+func (m *mockLibraryManagerDataStorer) RestoreLibrary(ctx context.Context, id int) error {
+	m.Lock()
+	defer m.Unlock()
+	lib, ok := m.deletedLibraries[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	delete(m.deletedLibraries, id)
+	lib.DeletedAt = time.Time{}
+	lib.Version++
+	m.libraries[id] = lib
+	return nil
+}
+
+func (m *mockLibraryManagerDataStorer) PurgeDeletedLibrary(ctx context.Context, id int) (controller.Library, error) {
+	m.Lock()
+	defer m.Unlock()
+	lib, ok := m.deletedLibraries[id]
+	if !ok {
+		return controller.Library{}, sql.ErrNoRows
+	}
+	delete(m.deletedLibraries, id)
+	return lib, nil
+}
+
+// interleavingDataStorer calls interleave right after the interleaveAt-th library read, which lets a test
+// slip another change in between a read and the save that is based on it.
+type interleavingDataStorer struct {
+	*mockLibraryManagerDataStorer
+	interleaveAt int
+	interleave   func()
+	reads        int
+}
+
+func (m *interleavingDataStorer) Library(ctx context.Context, id int) (controller.Library, error) {
+	l, err := m.mockLibraryManagerDataStorer.Library(ctx, id)
+	m.reads++
+	if m.reads == m.interleaveAt {
+		m.interleave()
+	}
+	return l, err
+}
+
+// mockMetadataReader returns metadata and err, unless files or errs have an entry for the read path. If entered is not nil,
+// a value is sent on it when Read is called and Read blocks until a value is received from proceed. Every path that is read
+// is recorded in read.
+type mockMetadataReader struct {
+	entered  chan struct{}
+	proceed  chan struct{}
+	err      error
+	metadata controller.FileMetadata
+	files    map[string]controller.FileMetadata
+	errs     map[string]error
+
+	mu       sync.Mutex
+	read     []string
+	readOpts map[string]controller.MetadataReadOptions
+}
+
+func (m *mockMetadataReader) Read(path string, opts controller.MetadataReadOptions) (controller.FileMetadata, error) {
+	m.mu.Lock()
+	m.read = append(m.read, path)
+	if m.readOpts == nil {
+		m.readOpts = make(map[string]controller.MetadataReadOptions)
+	}
+	m.readOpts[path] = opts
+	m.mu.Unlock()
+
+	if m.entered != nil {
+		m.entered <- struct{}{}
+		<-m.proceed
+	}
+	if err, ok := m.errs[path]; ok {
+		return controller.FileMetadata{}, err
+	}
+	if f, ok := m.files[path]; ok {
+		return f, nil
+	}
+	return m.metadata, m.err
+}
+
+// concurrencyMetadataReader takes delay to read each file and records the most reads that were in progress at once,
+// in total and per folder.
+type concurrencyMetadataReader struct {
+	delay time.Duration
+
+	mu           sync.Mutex
+	inProgress   map[string]int
+	total        int
+	maxPerFolder map[string]int
+	maxTotal     int
+}
+
+func newConcurrencyMetadataReader(delay time.Duration) *concurrencyMetadataReader {
+	return &concurrencyMetadataReader{delay: delay, inProgress: make(map[string]int), maxPerFolder: make(map[string]int)}
+}
+
+func (m *concurrencyMetadataReader) Read(path string, opts controller.MetadataReadOptions) (controller.FileMetadata, error) {
+	folder := filepath.Dir(path)
+
+	m.mu.Lock()
+	m.inProgress[folder]++
+	m.total++
+	if m.inProgress[folder] > m.maxPerFolder[folder] {
+		m.maxPerFolder[folder] = m.inProgress[folder]
+	}
+	if m.total > m.maxTotal {
+		m.maxTotal = m.total
+	}
+	m.mu.Unlock()
+
+	time.Sleep(m.delay)
+
+	m.mu.Lock()
+	m.inProgress[folder]--
+	m.total--
+	m.mu.Unlock()
+
+	return controller.FileMetadata{}, nil
+}
+
+// mockCommandDecider returns a static command unless decide is set, in which case the call is passed on to it.
+type mockCommandDecider struct {
+	settingsErr error
+	annotations map[string]string
+	decide      func(f controller.FileMetadata, s string) ([]string, error)
+	targetCodec string
+}
+
+func (m *mockCommandDecider) Decide(f controller.FileMetadata, s string) ([]string, error) {
+	if m.decide != nil {
+		return m.decide(f, s)
+	}
+	return []string{"-i", "ENCODARR_INPUT_FILE"}, nil
+}
+
+func (m *mockCommandDecider) DefaultSettings() string {
+	return "{}"
+}
+
+func (m *mockCommandDecider) ValidateSettings(s string) error {
+	return m.settingsErr
+}
+
+func (m *mockCommandDecider) TargetVideoCodec(f controller.FileMetadata, s string) (string, error) {
+	return m.targetCodec, nil
+}
+
+func (m *mockCommandDecider) Annotations(s string) (map[string]string, error) {
+	return m.annotations, nil
+}
+
+type mockLogger struct{}
+
+func (m *mockLogger) Trace(s string, i ...interface{})    {}
+func (m *mockLogger) Debug(s string, i ...interface{})    {}
+func (m *mockLogger) Info(s string, i ...interface{})     {}
+func (m *mockLogger) Warn(s string, i ...interface{})     {}
+func (m *mockLogger) Error(s string, i ...interface{})    {}
+func (m *mockLogger) Critical(s string, i ...interface{}) {}
+
+// infoLogger records the Info messages that are logged.
+type infoLogger struct {
+	mockLogger
+
+	mu    sync.Mutex
+	infos []string
+}
+
+func (m *infoLogger) Info(s string, i ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	args, _ := controller.SplitLogFields(i)
+	m.infos = append(m.infos, fmt.Sprintf(s, args...))
+}
+
+// errorLogger records the errors as well as the infos.
+type errorLogger struct {
+	infoLogger
+
+	errors []string
+}
+
+func (m *errorLogger) Error(s string, i ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	args, _ := controller.SplitLogFields(i)
+	m.errors = append(m.errors, fmt.Sprintf(s, args...))
+}
+
+type mockNotifier struct {
+	events []controller.Event
+}
+
+func (m *mockNotifier) Notify(e controller.Event) {
+	m.events = append(m.events, e)
+}
+
+type mockSettingsStorer struct {
+	maxJobAttempts   uint64
+	quarantineExpiry time.Duration
+}
+
+func (m *mockSettingsStorer) Load() (err error)                           { return }
+func (m *mockSettingsStorer) Save() (err error)                           { return }
+func (m *mockSettingsStorer) Close() (err error)                          { return }
+func (m *mockSettingsStorer) CompressQueues() (b bool)                    { return }
+func (m *mockSettingsStorer) SetCompressQueues(bool)                      {}
+func (m *mockSettingsStorer) MediaServer() (s controller.MediaServer)     { return }
+func (m *mockSettingsStorer) SetMediaServer(controller.MediaServer)       {}
+func (m *mockSettingsStorer) Notifications() (n controller.Notifications) { return }
+func (m *mockSettingsStorer) SetNotifications(controller.Notifications)   {}
+func (m *mockSettingsStorer) HealthCheckInterval() uint64                 { return 0 }
+func (m *mockSettingsStorer) SetHealthCheckInterval(uint64)               {}
+func (m *mockSettingsStorer) HealthCheckTimeout() uint64                  { return 0 }
+func (m *mockSettingsStorer) SetHealthCheckTimeout(uint64)                {}
+func (m *mockSettingsStorer) LogVerbosity() (s string)                    { return }
+func (m *mockSettingsStorer) SetLogVerbosity(string)                      {}
+func (m *mockSettingsStorer) LogLevels() (l map[string]string)            { return }
+func (m *mockSettingsStorer) SetLogLevels(map[string]string)              {}
+func (m *mockSettingsStorer) MaxJobAttempts() uint64                      { return m.maxJobAttempts }
+func (m *mockSettingsStorer) SetMaxJobAttempts(n uint64)                  { m.maxJobAttempts = n }
+func (m *mockSettingsStorer) QueryTimeout() (n uint64)                    { return }
+func (m *mockSettingsStorer) SetQueryTimeout(uint64)                      {}
+func (m *mockSettingsStorer) QuarantineExpiry() uint64                    { return uint64(m.quarantineExpiry) }
+func (m *mockSettingsStorer) SetQuarantineExpiry(uint64)                  {}
+func (m *mockSettingsStorer) StaleJobAction() (s string)                  { return }
+func (m *mockSettingsStorer) SetStaleJobAction(string)                    {}
+
+func (m *mockSettingsStorer) Secret(controller.SecretSetting) (s string) { return }
+func (m *mockSettingsStorer) SetSecret(controller.SecretSetting, string) {}
+
+type mockFileRemover struct {
+	removed []string
+}
+
+func (m *mockFileRemover) Remove(path string) error {
+	m.removed = append(m.removed, path)
+	return nil
+}
+
+// mockFileMover records the destination of every file that is moved in moved, keyed by the source.
+// If err is set, nothing is moved and err is returned instead.
+type mockFileMover struct {
+	moved map[string]string
+	err   error
+}
+
+func (m *mockFileMover) Move(from, to string) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.moved == nil {
+		m.moved = make(map[string]string)
+	}
+	m.moved[from] = to
+	return nil
+}
+
+// mockFileAttributer records the attributes that are given to each file. Chown returns chownErr.
+type mockFileAttributer struct {
+	modes    map[string]fs.FileMode
+	owners   map[string][2]int
+	modtimes map[string]time.Time
+	chownErr error
+}
+
+func (m *mockFileAttributer) Chmod(name string, mode fs.FileMode) error {
+	if m.modes == nil {
+		m.modes = make(map[string]fs.FileMode)
+	}
+	m.modes[name] = mode
+	return nil
+}
+
+func (m *mockFileAttributer) Chown(name string, uid, gid int) error {
+	if m.chownErr != nil {
+		return m.chownErr
+	}
+	if m.owners == nil {
+		m.owners = make(map[string][2]int)
+	}
+	m.owners[name] = [2]int{uid, gid}
+	return nil
+}
+
+func (m *mockFileAttributer) Chtimes(name string, atime, mtime time.Time) error {
+	if m.modtimes == nil {
+		m.modtimes = make(map[string]time.Time)
+	}
+	m.modtimes[name] = mtime
+	return nil
+}
+
+// mockLoadReporter reports load, or err if it is set.
+type mockLoadReporter struct {
+	load float64
+	err  error
+}
+
+func (m *mockLoadReporter) Load() (float64, error) {
+	return m.load, m.err
+}
+
+type mockCommandRunner struct {
+	output []byte
+	err    error
+
+	name string
+	args []string
+}
+
+func (m *mockCommandRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	m.name = name
+	m.args = args
+	return m.output, m.err
+}
+
+type mockVideoFileser struct {
+	files []string
+	err   error
+}
+
+func (m *mockVideoFileser) VideoFiles(dir string) ([]string, error) { return m.files, m.err }
+
+// folderVideoFileser returns the files of the requested folder.
+type folderVideoFileser map[string][]string
+
+func (m folderVideoFileser) VideoFiles(dir string) ([]string, error) { return m[dir], nil }
+
+// mockFileReader returns the contents in files that match the read path, or fs.ErrNotExist.
+type mockFileReader struct {
+	files map[string]string
+}
+
+func (m *mockFileReader) ReadFile(name string) ([]byte, error) {
+	if s, ok := m.files[name]; ok {
+		return []byte(s), nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+// mockFileStater returns a mockFileInfo with the modtime in modTimes and the size in sizes that match the stated path.
+type mockFileStater struct {
+	isDir    bool
+	err      error
+	modTimes map[string]time.Time
+	sizes    map[string]int64
+	missing  map[string]bool
+}
+
+func (m *mockFileStater) Stat(path string) (fs.FileInfo, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.missing[path] {
+		return nil, fs.ErrNotExist
+	}
+	return mockFileInfo{isDir: m.isDir, modTime: m.modTimes[path], size: m.sizes[path]}, nil
+}
+
+// unstatableFileStater behaves like mockFileStater, except that stating the unstatable path fails.
+type unstatableFileStater struct {
+	mockFileStater
+	unstatable string
+}
+
+func (m *unstatableFileStater) Stat(path string) (fs.FileInfo, error) {
+	if path == m.unstatable {
+		return nil, fs.ErrNotExist
+	}
+	return m.mockFileStater.Stat(path)
+}
+
+type mockFileInfo struct {
+	isDir   bool
+	modTime time.Time
+	size    int64
+}
+
+func (m mockFileInfo) Name() string       { return "" }
+func (m mockFileInfo) Size() int64        { return m.size }
+func (m mockFileInfo) Mode() fs.FileMode  { return 0 }
+func (m mockFileInfo) ModTime() time.Time { return m.modTime }
+func (m mockFileInfo) IsDir() bool        { return m.isDir }
+func (m mockFileInfo) Sys() interface{}   { return nil }
+
+type mockDirReader struct {
+	err error
+}
+
+func (m *mockDirReader) ReadDir(name string) ([]fs.DirEntry, error) { return nil, m.err }
+
+type mockMetricsCollector struct {
+	counters   map[string]*mockCounter
+	histograms map[string]*mockHistogram
+}
+
+func newMockMetricsCollector() *mockMetricsCollector {
+	return &mockMetricsCollector{counters: make(map[string]*mockCounter), histograms: make(map[string]*mockHistogram)}
+}
+
+func (m *mockMetricsCollector) Counter(name, help string) controller.Counter {
+	if _, ok := m.counters[name]; !ok {
+		m.counters[name] = &mockCounter{}
+	}
+	return m.counters[name]
+}
+
+func (m *mockMetricsCollector) Histogram(name, help string, buckets []float64) controller.Histogram {
+	if _, ok := m.histograms[name]; !ok {
+		m.histograms[name] = &mockHistogram{}
+	}
+	return m.histograms[name]
+}
+
+func (m *mockMetricsCollector) Batch(f func()) { f() }
+
+func (m *mockMetricsCollector) Snapshot() controller.MetricsSnapshot {
+	s := controller.MetricsSnapshot{Counters: make(map[string]float64), Histograms: make(map[string]controller.HistogramSnapshot)}
+	for name, v := range m.counters {
+		s.Counters[name] = v.value
+	}
+	for name, v := range m.histograms {
+		h := controller.HistogramSnapshot{Count: uint64(len(v.observed))}
+		for _, o := range v.observed {
+			h.Sum += o
+		}
+		s.Histograms[name] = h
+	}
+	return s
+}
+
+type mockCounter struct {
+	value float64
+}
+
+func (m *mockCounter) Add(delta float64) {
+	if delta > 0 {
+		m.value += delta
+	}
+}
+
+type mockHistogram struct {
+	observed []float64
+}
+
+func (m *mockHistogram) Observe(value float64) { m.observed = append(m.observed, value) }
@@ -0,0 +1,130 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// MoveJob moves the queued job with the provided UUID to the end of another library's queue. The command is decided
+// again under the target library's settings using the metadata that was read when the job was queued, and the job
+// isn't moved if the target library would skip it. Dispatched jobs and jobs which are part of a multi-part group
+// can't be moved.
+func (m *Manager) MoveJob(uuid controller.UUID, targetLibraryID int) error {
+	dispatched, err := m.ds.IsJobDispatched(m.ctx, uuid)
+	if err != nil {
+		return err
+	} else if dispatched {
+		return controller.ErrJobDispatched
+	}
+
+	target, err := m.ds.Library(m.ctx, targetLibraryID)
+	if err != nil {
+		return fmt.Errorf("target library %v: %w", targetLibraryID, err)
+	}
+
+	job, err := m.queuedJob(uuid)
+	if err != nil {
+		return err
+	}
+
+	if job.LibraryID == targetLibraryID {
+		return nil
+	}
+	if job.Group != "" {
+		return fmt.Errorf("%w: %v is part of a multi-part group, which has to be queued together", controller.ErrJobNotMovable, job.Path)
+	}
+
+	moved, err := m.redecideJob(job, target)
+	if err != nil {
+		return fmt.Errorf("%w: library %v would skip %v: %v", controller.ErrJobNotMovable, targetLibraryID, job.Path, err)
+	}
+
+	removed := false
+	err = m.modifyLibrary(job.LibraryID, func(lib *controller.Library) bool {
+		removed = false
+		kept := make([]controller.Job, 0, len(lib.Queue.Items))
+		for _, v := range lib.Queue.Items {
+			if v.UUID == uuid {
+				removed = true
+				continue
+			}
+			kept = append(kept, v)
+		}
+		lib.Queue.Items = kept
+		return removed
+	})
+	if err != nil {
+		return err
+	} else if !removed {
+		// The job was dispatched or removed after it was read.
+		return controller.ErrJobNotFound
+	}
+
+	if err = m.pushUnlessQueued(moved); err != nil {
+		// Put the job back so that it isn't lost.
+		if restoreErr := m.pushUnlessQueued(job); restoreErr != nil {
+			m.logger.Error("error restoring %v to Library %v's queue: %v", job.Path, job.LibraryID, restoreErr, job.LogFields())
+		}
+		return err
+	}
+
+	m.logger.Info("Moved %v from Library %v's queue to Library %v's", job.Path, job.LibraryID, targetLibraryID, moved.LogFields())
+	return nil
+}
+
+// queuedJob returns the job with the provided UUID from the queue of whichever library it is in.
+func (m *Manager) queuedJob(uuid controller.UUID) (controller.Job, error) {
+	libs, err := m.ds.Libraries(m.ctx)
+	if err != nil {
+		return controller.Job{}, err
+	}
+
+	for _, lib := range libs {
+		for _, v := range lib.Queue.Items {
+			if v.UUID == uuid {
+				return v, nil
+			}
+		}
+	}
+	return controller.Job{}, controller.ErrJobNotFound
+}
+
+// redecideJob returns a copy of job which belongs to lib, with the command and annotations decided under lib's settings
+// and the job's companion file, if any.
+func (m *Manager) redecideJob(job controller.Job, lib controller.Library) (controller.Job, error) {
+	settings := m.deciderSettings(lib, job.Path)
+	commandSlice, err := m.commandDecider.Decide(job.Metadata, settings)
+	if err != nil {
+		return controller.Job{}, err
+	}
+	if len(commandSlice) == 0 {
+		return controller.Job{}, errors.New("CommandDecider returned an empty command")
+	}
+
+	annotations, err := m.commandDecider.Annotations(settings)
+	if err != nil {
+		return controller.Job{}, err
+	}
+
+	job.LibraryID = lib.ID
+	job.Command = commandSlice
+	job.Annotations = annotations
+	job.CaptionsPath = ""
+	if extractsCaptions(commandSlice) {
+		job.CaptionsPath = captionsPath(job.Path)
+	}
+	return job, nil
+}
+
+// pushUnlessQueued pushes job onto the end of its library's queue unless the library already has a job for its path.
+func (m *Manager) pushUnlessQueued(job controller.Job) error {
+	return m.modifyLibrary(job.LibraryID, func(lib *controller.Library) bool {
+		if lib.Queue.InQueuePath(job) {
+			return false
+		}
+		lib.Queue.Push(job)
+		return true
+	})
+}
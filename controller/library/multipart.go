@@ -0,0 +1,73 @@
+package library
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultMultiPartPatterns are the patterns suggested to users for recognizing multi-part files
+// such as "Movie CD1.avi" and "Movie CD2.avi".
+var DefaultMultiPartPatterns = []string{`(?i)[ _.-]*\b(cd|disc|disk|part|pt)[ _.-]*[0-9]+\b`}
+
+// multiPartGroup describes the multi-part set that a file belongs to.
+type multiPartGroup struct {
+	Key  string
+	Size int
+}
+
+// groupMultiPartFiles uses the provided regular expressions to find files which are parts of the same set.
+// A file is considered a part if one of the patterns matches its name, and two or more parts are considered a set
+// if their names are identical once the matched part marker is removed. The returned map only contains files that are
+// part of a set with at least two members.
+func groupMultiPartFiles(paths []string, patterns []string) (map[string]multiPartGroup, error) {
+	groups := make(map[string]multiPartGroup)
+	if len(patterns) == 0 {
+		return groups, nil
+	}
+
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return groups, err
+		}
+		compiled = append(compiled, re)
+	}
+
+	keys := make(map[string]string)
+	members := make(map[string]int)
+
+	for _, path := range paths {
+		dir, name := filepath.Split(path)
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+
+		for _, re := range compiled {
+			locs := re.FindAllStringIndex(base, -1)
+			if len(locs) == 0 {
+				continue
+			}
+
+			// Use the last match so that titles which contain a marker-like word aren't mistaken for the part number.
+			loc := locs[len(locs)-1]
+			key := dir + base[:loc[0]] + base[loc[1]:] + ext
+
+			keys[path] = key
+			members[key]++
+			break
+		}
+	}
+
+	for path, key := range keys {
+		if members[key] < 2 {
+			continue
+		}
+		groups[path] = multiPartGroup{Key: key, Size: members[key]}
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,74 @@
+package library
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupMultiPartFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		paths    []string
+		patterns []string
+		expected map[string]multiPartGroup
+	}{
+		{
+			name:     "CD1/CD2 pair is grouped",
+			paths:    []string{"/movies/Old Movie CD1.avi", "/movies/Old Movie CD2.avi"},
+			patterns: DefaultMultiPartPatterns,
+			expected: map[string]multiPartGroup{
+				"/movies/Old Movie CD1.avi": {Key: "/movies/Old Movie.avi", Size: 2},
+				"/movies/Old Movie CD2.avi": {Key: "/movies/Old Movie.avi", Size: 2},
+			},
+		},
+		{
+			name:     "Unrelated files are not grouped",
+			paths:    []string{"/movies/Old Movie CD1.avi", "/movies/Old Movie CD2.avi", "/movies/Other Movie.mkv", "/movies/Another Movie CD1.avi"},
+			patterns: DefaultMultiPartPatterns,
+			expected: map[string]multiPartGroup{
+				"/movies/Old Movie CD1.avi": {Key: "/movies/Old Movie.avi", Size: 2},
+				"/movies/Old Movie CD2.avi": {Key: "/movies/Old Movie.avi", Size: 2},
+			},
+		},
+		{
+			name:     "Same name in different directories is not grouped",
+			paths:    []string{"/movies/a/Movie CD1.avi", "/movies/b/Movie CD2.avi"},
+			patterns: DefaultMultiPartPatterns,
+			expected: map[string]multiPartGroup{},
+		},
+		{
+			name:     "Grouping disabled without patterns",
+			paths:    []string{"/movies/Old Movie CD1.avi", "/movies/Old Movie CD2.avi"},
+			patterns: []string{},
+			expected: map[string]multiPartGroup{},
+		},
+		{
+			name:     "Custom pattern",
+			paths:    []string{"/movies/Movie_a.avi", "/movies/Movie_b.avi"},
+			patterns: []string{`_[ab]$`},
+			expected: map[string]multiPartGroup{
+				"/movies/Movie_a.avi": {Key: "/movies/Movie.avi", Size: 2},
+				"/movies/Movie_b.avi": {Key: "/movies/Movie.avi", Size: 2},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			groups, err := groupMultiPartFiles(test.paths, test.patterns)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(groups, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, groups)
+			}
+		})
+	}
+}
+
+func TestGroupMultiPartFilesInvalidPattern(t *testing.T) {
+	if _, err := groupMultiPartFiles([]string{"/movies/Movie CD1.avi"}, []string{"("}); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
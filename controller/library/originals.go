@@ -0,0 +1,87 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/trash"
+)
+
+const (
+	// originalSuffix is added before the extension of the original files which are kept next to their transcoded files.
+	originalSuffix = ".original"
+
+	// originalsFolderName is the folder inside of a library's folder that original files are moved into.
+	originalsFolderName = ".encodarr-originals"
+)
+
+// keptOriginalPath returns where the original file at path is kept when its transcoded file is imported into a library
+// with the provided folder and OriginalFileHandling, or an empty string if the original is replaced.
+func keptOriginalPath(handling controller.OriginalFileHandling, libraryFolder, path string) string {
+	switch handling {
+	case controller.OriginalKeepRenamed:
+		ext := filepath.Ext(path)
+		return strings.TrimSuffix(path, ext) + originalSuffix + ext
+	case controller.OriginalMoveToFolder:
+		rel, err := filepath.Rel(libraryFolder, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			rel = filepath.Base(path)
+		}
+		return filepath.Join(libraryFolder, originalsFolderName, rel)
+	default:
+		return ""
+	}
+}
+
+// isKeptOriginal returns whether or not path is an original file which was kept by a library with the provided folder,
+// regardless of the library's current OriginalFileHandling, so that kept originals are never queued again.
+func isKeptOriginal(libraryFolder, path string) bool {
+	if strings.HasSuffix(strings.TrimSuffix(path, filepath.Ext(path)), originalSuffix) {
+		return true
+	}
+
+	return inFolder(filepath.Join(libraryFolder, originalsFolderName), path)
+}
+
+// inFolder returns whether or not path is somewhere inside of folder.
+func inFolder(folder, path string) bool {
+	return strings.HasPrefix(filepath.ToSlash(path), strings.TrimSuffix(filepath.ToSlash(folder), "/")+"/")
+}
+
+// SetTrash sets the trash that the originals of libraries with the move-to-trash OriginalFileHandling are moved
+// into. Files in the trash are never queued. It must be called before Start.
+func (m *Manager) SetTrash(t *trash.Trash) {
+	m.trash = t
+}
+
+// keepOriginal moves the original file of job to where its library's OriginalFileHandling says to keep it.
+// It returns where the original was kept, which is empty if the original is replaced instead. Replaced originals
+// are left in place so that they are only ever removed once the transcoded file is.
+func (m *Manager) keepOriginal(job controller.Job) (keptPath string, err error) {
+	lib, err := m.ds.Library(m.ctx, job.LibraryID)
+	if err != nil {
+		// The original is only kept if the library says so, so a library which can't be read replaces it
+		m.logger.Warn("Replacing the original of %v because its library couldn't be read: %v", job.Path, err, job.LogFields())
+	}
+
+	if lib.OriginalFileHandling == controller.OriginalMoveToTrash {
+		if m.trash == nil {
+			return "", errors.New("couldn't move it to the trash because there isn't one")
+		}
+		keptPath = m.trash.Path(lib.ID, lib.Folder, job.Path)
+	} else {
+		keptPath = keptOriginalPath(lib.OriginalFileHandling, lib.Folder, job.Path)
+	}
+	if keptPath == "" {
+		return "", nil
+	}
+
+	if err = m.fileMover.Move(job.Path, keptPath); err != nil {
+		return "", fmt.Errorf("couldn't keep it at %v: %v", keptPath, err)
+	}
+	m.logger.Info("Kept the original of %v at %v", job.Path, keptPath, job.LogFields())
+	return keptPath, nil
+}
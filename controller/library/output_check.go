@@ -0,0 +1,77 @@
+package library
+
+import (
+	"fmt"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// durationTolerance is how much shorter than the original the transcoded file of a job may be, as a fraction of
+// the original's duration, before it is considered truncated.
+const durationTolerance = 0.01
+
+// checkOutput reads the metadata of the transcoded file of a completed job and records it on the job's history entry.
+// If the file can't be read, isn't in the video codec that the library's CommandDecider settings target, or is shorter
+// than the original, the transcoded file is removed and the job is marked as failed so that the original is kept.
+func (m *Manager) checkOutput(cJob controller.CompletedJob, dJob controller.DispatchedJob) controller.CompletedJob {
+	// The library's overrides are for its own files, so the transcode is read with the global settings.
+	output, err := m.metadataReader.Read(cJob.InFile, controller.MetadataReadOptions{})
+	if err != nil {
+		failMessage := fmt.Sprintf("Failed to read the metadata of the transcode of '%v': %v", dJob.Job.Path, err)
+		m.logger.Warn(failMessage, dJob.Job.LogFields())
+		return m.rejectCompletedJob(cJob, failMessage)
+	}
+
+	stats := controller.OutputStats{Duration: output.General.Duration}
+	if len(output.VideoTracks) > 0 {
+		stats.VideoCodec = output.VideoTracks[0].Codec
+	}
+	if info, err := m.fileStater.Stat(cJob.InFile); err == nil {
+		stats.Size = info.Size()
+		if stats.Duration > 0 {
+			stats.Bitrate = int64(float64(stats.Size*8) / float64(stats.Duration))
+		}
+	} else {
+		m.logger.Debug("not recording the size of the transcode of %v because of error: %v", dJob.Job.Path, err, dJob.Job.LogFields())
+	}
+	cJob.History.Output = &stats
+
+	original := dJob.Job.Metadata
+	if original.General.Duration > 0 && output.General.Duration < original.General.Duration*(1-durationTolerance) {
+		failMessage := fmt.Sprintf("The transcode of '%v' is truncated: it is %vs long instead of %vs", dJob.Job.Path, output.General.Duration, original.General.Duration)
+		m.logger.Warn(failMessage, dJob.Job.LogFields())
+		return m.rejectCompletedJob(cJob, failMessage)
+	}
+
+	lib, err := m.ds.Library(m.ctx, dJob.Job.LibraryID)
+	if err != nil {
+		m.logger.Error("not checking the video codec of the transcode of %v because of error: %v", dJob.Job.Path, err, dJob.Job.LogFields())
+		return cJob
+	}
+
+	targetCodec, err := m.commandDecider.TargetVideoCodec(original, m.deciderSettings(lib, dJob.Job.Path))
+	if err != nil {
+		m.logger.Error("not checking the video codec of the transcode of %v because of error: %v", dJob.Job.Path, err, dJob.Job.LogFields())
+		return cJob
+	}
+
+	if targetCodec != "" && stats.VideoCodec != targetCodec {
+		failMessage := fmt.Sprintf("The transcode of '%v' has the video codec '%v' instead of '%v'", dJob.Job.Path, stats.VideoCodec, targetCodec)
+		m.logger.Warn(failMessage, dJob.Job.LogFields())
+		return m.rejectCompletedJob(cJob, failMessage)
+	}
+
+	return cJob
+}
+
+// rejectCompletedJob removes the transcoded file of a completed job and marks the job as failed with failMessage
+// so that the original is kept.
+func (m *Manager) rejectCompletedJob(cJob controller.CompletedJob, failMessage string) controller.CompletedJob {
+	if err := m.fileRemover.Remove(cJob.InFile); err != nil {
+		m.logger.Error(err.Error())
+	}
+
+	cJob.Failed = true
+	cJob.History.Errors = append(cJob.History.Errors, failMessage)
+	return cJob
+}
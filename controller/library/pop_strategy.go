@@ -0,0 +1,93 @@
+package library
+
+import "github.com/BrenekH/encodarr/controller"
+
+// PopStrategy decides which job PopNewJob takes from the queue of the highest priority library which has one.
+type PopStrategy string
+
+const (
+	// PopQueueOrder takes the job which has been queued the longest.
+	PopQueueOrder PopStrategy = "queue-order"
+
+	// PopSmallestFirst takes the job with the smallest file so that idle Runners finish something quickly.
+	PopSmallestFirst PopStrategy = "smallest-first"
+)
+
+// valid returns whether or not s is a known strategy.
+func (s PopStrategy) valid() bool {
+	return s == PopQueueOrder || s == PopSmallestFirst
+}
+
+// jobSize returns the size of a job's file or an error if the job can't be dispatched.
+type jobSize func(controller.Job) (int64, error)
+
+// popNext removes and returns the job of q which PopNewJob dispatches next according to the pop strategy. Jobs whose
+// size can't be found are removed along the way.
+func (m *Manager) popNext(q *controller.LibraryQueue, size jobSize) (controller.Job, bool) {
+	if m.popStrategy == PopSmallestFirst {
+		return m.popSmallest(q, size)
+	}
+	return m.popInQueueOrder(q, size)
+}
+
+// statSize is the jobSize of the file on disk, which PopNewJob uses so that it never dispatches a missing file.
+func (m *Manager) statSize(j controller.Job) (int64, error) {
+	info, err := m.fileStater.Stat(j.Path)
+	if err != nil {
+		m.logger.Debug("skipping queue entry for %v because of error: %v", j.Path, err)
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// popInQueueOrder removes and returns the first job in q whose size can be found.
+// Jobs whose size can't be found are removed along the way.
+func (m *Manager) popInQueueOrder(q *controller.LibraryQueue, size jobSize) (controller.Job, bool) {
+	for !q.Empty() {
+		j, err := q.Pop()
+		if err != nil {
+			if err != controller.ErrEmptyQueue { // Forgoes logging about an empty queue
+				m.logger.Debug("error while searching for job: %v", err)
+			}
+			continue
+		}
+
+		// Skip queue entry if its size can't be found
+		if _, err = size(j); err != nil {
+			continue
+		}
+
+		return j, true
+	}
+	return controller.Job{}, false
+}
+
+// popSmallest removes and returns the job in q which is the smallest. Jobs whose size can't be found are removed,
+// just like they are when popping in queue order. Ties go to the job which has been queued the longest.
+func (m *Manager) popSmallest(q *controller.LibraryQueue, size jobSize) (controller.Job, bool) {
+	kept := make([]controller.Job, 0, len(q.Items))
+	smallest := -1
+	var smallestSize int64
+
+	for _, j := range q.Items {
+		n, err := size(j)
+		if err != nil {
+			continue
+		}
+
+		if smallest == -1 || n < smallestSize {
+			smallest = len(kept)
+			smallestSize = n
+		}
+		kept = append(kept, j)
+	}
+
+	if smallest == -1 {
+		q.Items = kept
+		return controller.Job{}, false
+	}
+
+	job := kept[smallest]
+	q.Items = append(kept[:smallest], kept[smallest+1:]...)
+	return job, true
+}
@@ -0,0 +1,33 @@
+package library
+
+import "github.com/BrenekH/encodarr/controller"
+
+// PreviewScan returns the jobs which a fresh scan of the library would queue, as if nothing was dispatched or queued.
+// Discovery, masking, metadata reading, and the CommandDecider are run exactly like the real scan, but neither
+// the library nor its file snapshots are modified and no paths are reserved.
+func (m *Manager) PreviewScan(libraryID int) ([]controller.Job, error) {
+	lib, err := m.ds.Library(m.ctx, libraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	unmasked, multiPartGroups, err := m.discoverFiles(lib, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]controller.Job, 0, len(unmasked))
+	for _, videoFilepath := range unmasked {
+		if lib.SkipUnchanged && m.unchangedSinceProcessed(videoFilepath) {
+			continue
+		}
+
+		if job, ok := m.newJob(&lib, videoFilepath, multiPartGroups[videoFilepath], nil); ok {
+			jobs = append(jobs, job)
+		}
+	}
+
+	// The queue limit is applied as if the queue was empty
+	budget := newQueueBudget(controller.Library{MaxQueuedBytes: lib.MaxQueuedBytes})
+	return budget.take(jobs), nil
+}
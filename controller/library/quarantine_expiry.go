@@ -0,0 +1,21 @@
+package library
+
+import "time"
+
+// releaseExpiredQuarantines takes the files which have been quarantined for longer than the QuarantineExpiry setting
+// out of quarantine, so that the scan which calls it evaluates them again. A QuarantineExpiry of 0 keeps them quarantined.
+func (m *Manager) releaseExpiredQuarantines() {
+	expiry := time.Duration(m.ss.QuarantineExpiry())
+	if expiry <= 0 {
+		return
+	}
+
+	released, err := m.ds.ReleaseExpiredQuarantines(m.ctx, m.now().Add(-expiry))
+	if err != nil {
+		m.logger.Error("error releasing the expired quarantines: %v", err)
+		return
+	}
+	for _, path := range released {
+		m.logger.Info("Released %v from quarantine after %v, it will be evaluated again", path, expiry)
+	}
+}
@@ -0,0 +1,34 @@
+package library
+
+import (
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// SetQueueAging sets how much the priority of a queued job rises for every day that it waits. PopNewJob dispatches
+// from the library whose queued job has the highest effective priority, so that the jobs of low priority libraries
+// aren't starved by a busy high priority library. 0 disables aging, which is the default. It must be called before Start.
+func (m *Manager) SetQueueAging(perDay float64) {
+	if perDay < 0 {
+		m.logger.Warn("Ignoring negative queue aging %v, keeping %v", perDay, m.queueAging)
+		return
+	}
+	m.queueAging = perDay
+}
+
+// effectivePriority returns the highest effective priority of the jobs in lib's queue as of now, or the library's
+// priority if aging is disabled or its queue is empty.
+func (m *Manager) effectivePriority(lib controller.Library, now time.Time) float64 {
+	highest := float64(lib.Priority)
+	if m.queueAging <= 0 {
+		return highest
+	}
+
+	for _, job := range lib.Queue.Items {
+		if p := job.EffectivePriority(lib.Priority, m.queueAging, now); p > highest {
+			highest = p
+		}
+	}
+	return highest
+}
@@ -0,0 +1,36 @@
+package library
+
+import "github.com/BrenekH/encodarr/controller"
+
+// queueBudget keeps track of the bytes of source files in a library's queue while a scan adds to it, so that the scan
+// can stop once the library's MaxQueuedBytes is reached. Jobs which were queued before sizes were recorded count as
+// zero bytes.
+type queueBudget struct {
+	limit  int64
+	queued int64
+}
+
+func newQueueBudget(lib controller.Library) *queueBudget {
+	b := &queueBudget{limit: lib.MaxQueuedBytes}
+	for _, job := range lib.Queue.Items {
+		b.queued += job.Size
+	}
+	return b
+}
+
+// full returns whether or not the queued bytes have reached the limit. A budget without a limit is never full.
+func (b *queueBudget) full() bool {
+	return b.limit > 0 && b.queued >= b.limit
+}
+
+// take returns the leading jobs which fit in the budget and counts them as queued. The job which crosses the limit is
+// still taken, so that a file which is larger than the limit on its own is eventually queued.
+func (b *queueBudget) take(jobs []controller.Job) []controller.Job {
+	for i, job := range jobs {
+		if b.full() {
+			return jobs[:i]
+		}
+		b.queued += job.Size
+	}
+	return jobs
+}
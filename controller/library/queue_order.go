@@ -0,0 +1,38 @@
+package library
+
+import (
+	"sort"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// sortByQueueOrder sorts the discovered paths in place so that they are queued in the provided order.
+// Files which can't be stated are queued after the rest, in the order that they were discovered.
+func (m *Manager) sortByQueueOrder(paths []string, order controller.QueueOrder) {
+	if order != controller.QueueOldestFirst && order != controller.QueueNewestFirst {
+		return
+	}
+
+	modtimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		info, err := m.fileStater.Stat(path)
+		if err != nil {
+			m.logger.Debug("Queueing %v last because it couldn't be stated: %v", path, err)
+			continue
+		}
+		modtimes[path] = info.ModTime()
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		ti, iOk := modtimes[paths[i]]
+		tj, jOk := modtimes[paths[j]]
+		if !iOk || !jOk {
+			return iOk && !jOk
+		}
+		if order == controller.QueueNewestFirst {
+			return ti.After(tj)
+		}
+		return ti.Before(tj)
+	})
+}
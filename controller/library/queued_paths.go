@@ -0,0 +1,39 @@
+package library
+
+import (
+	"sync"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// newQueuedPaths returns a queuedPaths with the path of every job in q.
+func newQueuedPaths(q controller.LibraryQueue) *queuedPaths {
+	p := &queuedPaths{paths: make(map[string]struct{}, len(q.Items))}
+	for _, job := range q.Items {
+		p.add(job.Path)
+	}
+	return p
+}
+
+// queuedPaths is the set of paths in a library's queue. A scan builds it once when it starts and adds the paths
+// that it queues, so checking whether each discovered file is already queued doesn't have to go through the whole queue.
+// It is safe for concurrent use by the files that a scan works on at once.
+type queuedPaths struct {
+	mu    sync.Mutex
+	paths map[string]struct{}
+}
+
+// contains returns whether or not path is in the set.
+func (p *queuedPaths) contains(path string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.paths[path]
+	return ok
+}
+
+// add adds path to the set.
+func (p *queuedPaths) add(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paths[path] = struct{}{}
+}
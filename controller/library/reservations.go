@@ -0,0 +1,54 @@
+package library
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// newPathReservations returns an instantiated pathReservations.
+func newPathReservations() *pathReservations {
+	return &pathReservations{paths: make(map[string]struct{})}
+}
+
+// pathReservations is a short-lived, in-memory set of paths that are currently being decided on by a scan.
+// It prevents two concurrent scans (ex. overlapping libraries) from queuing the same file before either
+// of them has had a chance to record it.
+type pathReservations struct {
+	sync.Mutex
+	paths map[string]struct{}
+}
+
+// Reserve attempts to reserve the provided path. It returns false if the path is already reserved.
+func (p *pathReservations) Reserve(path string) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	if _, ok := p.paths[path]; ok {
+		return false
+	}
+	p.paths[path] = struct{}{}
+	return true
+}
+
+// Release removes the reservation for the provided path.
+func (p *pathReservations) Release(path string) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.paths, path)
+}
+
+// resolvePath returns the absolute, symlink-free version of path so that the same file reached through
+// different library folders results in the same reservation key. If the path cannot be resolved, the
+// cleaned path is returned instead.
+func resolvePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return abs
+	}
+	return resolved
+}
@@ -0,0 +1,80 @@
+package library
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// SetMaxConcurrentScans sets how many libraries may be scanned at once. When more libraries are due for a scan,
+// the ones with the highest Priority are scanned first and the rest wait for a running scan to finish.
+// 0 doesn't limit the scans, which is the default. Negative values are ignored. It must be called before Start.
+func (m *Manager) SetMaxConcurrentScans(n int) {
+	if n < 0 {
+		m.logger.Warn("Ignoring negative max concurrent scans %v, keeping %v", n, m.maxConcurrentScans)
+		return
+	}
+	m.maxConcurrentScans = n
+}
+
+// runningScans returns how many library scans are running. The caller must hold scanMutex.
+func (m *Manager) runningScans() int {
+	running := 0
+	for _, finished := range m.workerCompletedMap {
+		if !finished {
+			running++
+		}
+	}
+	return running
+}
+
+// sortByPriority sorts libs from the highest Priority to the lowest. Libraries with the same Priority keep their order.
+func sortByPriority(libs []controller.Library) {
+	sort.SliceStable(libs, func(i, j int) bool {
+		return libs[i].Priority > libs[j].Priority
+	})
+}
+
+// SetMaxScanLoad sets the CPU load, as a percentage of the CPUs' one-minute load average, above which due scans are
+// deferred until the load drops. 0 disables the limit, which is the default. Negative values are ignored. It must be
+// called before Start.
+func (m *Manager) SetMaxScanLoad(percent float64) {
+	if percent < 0 {
+		m.logger.Warn("Ignoring negative max scan load %v, keeping %v", percent, m.maxScanLoad)
+		return
+	}
+	m.maxScanLoad = percent
+}
+
+// loadAllowsScans returns whether or not the CPU load is low enough to start scans. Scans are allowed if the load can't
+// be read, and the limit is disabled on platforms where it is never available. The caller must hold scanMutex.
+func (m *Manager) loadAllowsScans() bool {
+	if m.maxScanLoad <= 0 {
+		return true
+	}
+
+	load, err := m.loadReporter.Load()
+	if errors.Is(err, controller.ErrCPULoadUnsupported) {
+		m.logger.Warn("Not limiting scans by CPU load: %v", err)
+		m.maxScanLoad = 0
+		return true
+	} else if err != nil {
+		m.logger.Warn("Starting scans without checking the CPU load: %v", err)
+		return true
+	}
+
+	if load > m.maxScanLoad {
+		if !m.scansDeferredForLoad {
+			m.logger.Info("Deferring scans because the CPU load is %.0f%%, above the limit of %v%%", load, m.maxScanLoad)
+			m.scansDeferredForLoad = true
+		}
+		return false
+	}
+
+	if m.scansDeferredForLoad {
+		m.logger.Info("Resuming scans because the CPU load dropped to %.0f%%", load)
+		m.scansDeferredForLoad = false
+	}
+	return true
+}
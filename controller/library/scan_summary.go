@@ -0,0 +1,80 @@
+package library
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// scanOutcome is what a scan did with one of the files it discovered.
+type scanOutcome int
+
+const (
+	// outcomeIgnored files are kept originals or in the trash.
+	outcomeIgnored scanOutcome = iota
+	outcomeMasked
+	outcomeUnchanged
+	outcomeDispatched
+	// outcomeAlreadyQueued files are in the queue already, or are being decided on by another scan.
+	outcomeAlreadyQueued
+	outcomeQuarantined
+	// outcomeCompletedExternally files were recorded as completed outside of Encodarr.
+	outcomeCompletedExternally
+	// outcomeSkippedByDecider files are ones which the CommandDecider doesn't want to change.
+	outcomeSkippedByDecider
+	// outcomeFailed files couldn't be decided on because of an error.
+	outcomeFailed
+	outcomeQueued
+
+	outcomeCount
+)
+
+// scanSummary tallies the outcomes of the files discovered by a single scan so that they can be reported in one line.
+// The workers of a scan record their outcomes at the same time. Recording into a nil scanSummary does nothing.
+type scanSummary struct {
+	discovered int
+	outcomes   [outcomeCount]int64
+}
+
+// record adds n files to the tally of outcome.
+func (s *scanSummary) record(outcome scanOutcome, n int) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.outcomes[outcome], int64(n))
+}
+
+// count returns how many files were recorded with outcome.
+func (s *scanSummary) count(outcome scanOutcome) int64 {
+	return atomic.LoadInt64(&s.outcomes[outcome])
+}
+
+// deferred returns how many of the discovered files weren't decided on or queued, either because the queue
+// reached its limit or because the scan was stopped. A later scan picks them up.
+func (s *scanSummary) deferred() int64 {
+	n := int64(s.discovered)
+	for o := scanOutcome(0); o < outcomeCount; o++ {
+		n -= s.count(o)
+	}
+	return n
+}
+
+// message returns the summary of the scan of the library with the provided ID, which took duration.
+func (s *scanSummary) message(libraryID int, duration time.Duration) string {
+	return fmt.Sprintf("Scan of Library %v finished in %v: %v discovered, %v ignored, %v masked, %v unchanged, %v already dispatched, %v already queued, %v quarantined, %v completed externally, %v skipped by the CommandDecider, %v failed, %v left for later, %v queued",
+		libraryID,
+		duration.Round(time.Millisecond),
+		s.discovered,
+		s.count(outcomeIgnored),
+		s.count(outcomeMasked),
+		s.count(outcomeUnchanged),
+		s.count(outcomeDispatched),
+		s.count(outcomeAlreadyQueued),
+		s.count(outcomeQuarantined),
+		s.count(outcomeCompletedExternally),
+		s.count(outcomeSkippedByDecider),
+		s.count(outcomeFailed),
+		s.deferred(),
+		s.count(outcomeQueued),
+	)
+}
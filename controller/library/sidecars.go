@@ -0,0 +1,92 @@
+package library
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// DefaultSidecarExtensions are the extensions of the files which are recognized as sidecars of a video file.
+var DefaultSidecarExtensions = []string{".srt", ".ass", ".ssa", ".sub", ".idx", ".vtt", ".nfo"}
+
+// SetSidecarExtensions sets the extensions of the files which are moved along with a video file in libraries which
+// have MoveSidecars set. The extensions are matched case insensitively. It must be called before Start.
+func (m *Manager) SetSidecarExtensions(extensions []string) {
+	m.sidecarExtensions = sidecarExtensionSet(extensions)
+}
+
+// sidecarExtensionSet returns the lowercased extensions as a set.
+func sidecarExtensionSet(extensions []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(extensions))
+	for _, ext := range extensions {
+		set[strings.ToLower(ext)] = struct{}{}
+	}
+	return set
+}
+
+// moveSidecars renames the sidecar files of job's file so that they match the path of its transcoded file, to,
+// if the job's library has MoveSidecars set.
+//
+// A sidecar is a file with a recognized extension in the same folder as the video file whose name starts with either the
+// full name of the video file (ex. Movie.mkv.srt) or its name without the extension, followed by a dot (ex. Movie.srt
+// and Movie.en.srt). Whatever is between that and the extension, like a language, is kept. A sidecar whose new path is
+// already taken is left where it is.
+func (m *Manager) moveSidecars(job controller.Job, to string) {
+	lib, err := m.ds.Library(m.ctx, job.LibraryID)
+	if err != nil {
+		m.logger.Warn("Not moving the sidecar files of %v because its library couldn't be read: %v", job.Path, err, job.LogFields())
+		return
+	}
+	if !lib.MoveSidecars {
+		return
+	}
+
+	from := job.Path
+	entries, err := m.dirReader.ReadDir(filepath.Dir(from))
+	if err != nil {
+		m.logger.Warn("Couldn't look for the sidecar files of %v: %v", from, err, job.LogFields())
+		return
+	}
+
+	fromName, toName := filepath.Base(from), filepath.Base(to)
+	fromStem := strings.TrimSuffix(fromName, filepath.Ext(fromName))
+	toStem := strings.TrimSuffix(toName, filepath.Ext(toName))
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == fromName {
+			continue
+		}
+		if _, ok := m.sidecarExtensions[strings.ToLower(filepath.Ext(name))]; !ok {
+			continue
+		}
+
+		var newName string
+		switch {
+		case strings.HasPrefix(name, fromName+"."):
+			newName = toName + strings.TrimPrefix(name, fromName)
+		case strings.HasPrefix(name, fromStem+"."):
+			newName = toStem + strings.TrimPrefix(name, fromStem)
+		default:
+			continue
+		}
+
+		oldPath := filepath.Join(filepath.Dir(from), name)
+		newPath := filepath.Join(filepath.Dir(to), newName)
+		if newPath == oldPath {
+			continue
+		}
+
+		if _, err := m.fileStater.Stat(newPath); err == nil {
+			m.logger.Warn("Not moving sidecar %v to %v because a file is already there", oldPath, newPath, job.LogFields())
+			continue
+		}
+
+		if err := m.fileMover.Move(oldPath, newPath); err != nil {
+			m.logger.Warn("Failed to move sidecar %v to %v: %v", oldPath, newPath, err, job.LogFields())
+			continue
+		}
+		m.logger.Info("Moved sidecar %v to %v", oldPath, newPath, job.LogFields())
+	}
+}
@@ -0,0 +1,31 @@
+package library
+
+import (
+	"sync"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// librarySnapshot is a cached copy of the libraries in the data store. The read APIs are served from it
+// so that they don't query the data store every time they are called.
+type librarySnapshot struct {
+	sync.RWMutex
+	libraries []controller.Library
+	loaded    bool
+}
+
+// Get returns the cached libraries and whether the snapshot has been loaded yet.
+// The returned slice is never modified, only replaced by Set.
+func (s *librarySnapshot) Get() ([]controller.Library, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.libraries, s.loaded
+}
+
+// Set replaces the cached libraries.
+func (s *librarySnapshot) Set(libs []controller.Library) {
+	s.Lock()
+	defer s.Unlock()
+	s.libraries = libs
+	s.loaded = true
+}
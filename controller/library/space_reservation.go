@@ -0,0 +1,106 @@
+package library
+
+import (
+	"fmt"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// SetSpaceReservation makes PopNewJob reserve ratio times the size of the original file of each job it dispatches on
+// the filesystem of the job's library, as an estimate of the transcoded file's size. A job isn't dispatched while the
+// reservations of the dispatched jobs on its filesystem and its own would take more than the free space on it.
+// A ratio of 0 disables the reservations. It must be called before Start.
+func (m *Manager) SetSpaceReservation(ratio float64) {
+	if ratio < 0 {
+		ratio = 0
+	}
+	m.spaceReservationRatio = ratio
+}
+
+// spaceReservations is the space reserved on each filesystem by the dispatched jobs, along with the free space on it.
+// The reservations are the dispatched jobs themselves, so a job's reservation is released when it completes, fails,
+// or its lease expires, and the reservations survive restarts.
+type spaceReservations struct {
+	reserved map[string]int64
+	free     map[string]int64 // -1 if the free space on the filesystem can't be checked.
+}
+
+// spaceReservations returns the space reserved by the dispatched jobs of libs. It is nil if reservations are disabled.
+func (m *Manager) spaceReservations(libs []controller.Library) (*spaceReservations, error) {
+	if m.spaceReservationRatio <= 0 {
+		return nil, nil
+	}
+
+	dJobs, err := m.ds.DispatchedJobs(m.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	folders := make(map[int]string, len(libs))
+	for _, l := range libs {
+		folders[l.ID] = l.Folder
+	}
+
+	r := &spaceReservations{reserved: make(map[string]int64), free: make(map[string]int64)}
+	for _, dJob := range dJobs {
+		// Benchmarks never replace their original, so they don't need any space.
+		if folder, ok := folders[dJob.Job.LibraryID]; ok && dJob.Job.Benchmark == nil {
+			r.reserved[m.filesystemKey(folder)] += m.estimatedOutputSize(dJob.Job)
+		}
+	}
+	return r, nil
+}
+
+// fitsSpace returns whether or not the estimated size of job's transcoded file fits on the filesystem of lib next to
+// the reservations of the dispatched jobs. Jobs always fit when the free space can't be checked. Once the job is
+// dispatched, it reserves the space.
+func (m *Manager) fitsSpace(r *spaceReservations, lib controller.Library, job controller.Job) bool {
+	if r == nil {
+		return true
+	}
+
+	key := m.filesystemKey(lib.Folder)
+	free, ok := r.free[key]
+	if !ok {
+		free = -1
+		if n, err := m.freeSpace(lib.Folder); err == nil {
+			free = int64(n)
+		} else if err != controller.ErrFreeSpaceUnsupported {
+			m.logger.Debug("not reserving space for jobs of Library %v because its free space couldn't be checked: %v", lib.ID, err)
+		}
+		r.free[key] = free
+	}
+
+	size := m.estimatedOutputSize(job)
+	fits := free < 0 || r.reserved[key]+size <= free
+	m.logSpaceWait(lib.ID, fits, fmt.Sprintf("%v bytes are reserved by dispatched jobs and %v are free, which leaves no room for the %v bytes of %v", r.reserved[key], free, size, job.Path))
+	return fits
+}
+
+// logSpaceWait logs when a library starts and stops waiting for space on its filesystem to dispatch its next job.
+func (m *Manager) logSpaceWait(libraryID int, fits bool, reason string) {
+	_, waiting := m.spaceWaiting[libraryID]
+	switch {
+	case !fits && !waiting:
+		m.spaceWaiting[libraryID] = struct{}{}
+		m.logger.Info("Pausing dispatching from Library %v because %v", libraryID, reason, controller.LogFields{"library_id": libraryID})
+	case fits && waiting:
+		delete(m.spaceWaiting, libraryID)
+		m.logger.Info("Resuming dispatching from Library %v because its filesystem has room for the next job again", libraryID, controller.LogFields{"library_id": libraryID})
+	}
+}
+
+// estimatedOutputSize is the space reserved for the transcoded file of job.
+func (m *Manager) estimatedOutputSize(job controller.Job) int64 {
+	return int64(float64(job.Size) * m.spaceReservationRatio)
+}
+
+// filesystemKey identifies the filesystem that folder is on, or is folder itself if the filesystem can't be found.
+func (m *Manager) filesystemKey(folder string) string {
+	if info, err := m.fileStater.Stat(folder); err == nil {
+		if id, ok := filesystemID(info); ok {
+			return fmt.Sprintf("dev:%v", id)
+		}
+	}
+	return folder
+}
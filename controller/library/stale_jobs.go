@@ -0,0 +1,122 @@
+package library
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/google/uuid"
+)
+
+// HandleStaleJobs puts the stale jobs whose action is StaleJobRequeue back in their libraries' queues and
+// records the ones whose action is StaleJobFail as failed, which counts towards the maximum number of attempts.
+// Stale benchmark jobs are recorded as failed benchmarks no matter the action, and are never requeued.
+func (m *Manager) HandleStaleJobs(staleJobs []controller.StaleJob) {
+	for _, v := range staleJobs {
+		if v.DispatchedJob.Job.Benchmark != nil {
+			m.recordBenchmark(controller.CompletedJob{
+				UUID:    v.DispatchedJob.UUID,
+				Failed:  true,
+				History: controller.History{DateTimeCompleted: m.now(), Errors: []string{fmt.Sprintf("The job was stale because %v", v.Reason)}},
+			}, v.DispatchedJob)
+			continue
+		}
+
+		if v.Action == controller.StaleJobFail {
+			// The job is imported as a failed job so that it gets a history entry and a notification like
+			// the jobs which the Runners report as failed.
+			m.importCompletedJob(controller.CompletedJob{
+				UUID:   v.DispatchedJob.UUID,
+				Failed: true,
+				History: controller.History{
+					Filename:          v.DispatchedJob.Job.Path,
+					DateTimeCompleted: time.Now(),
+					Warnings:          []string{},
+					Errors:            []string{fmt.Sprintf("The job was stale because %v", v.Reason)},
+				},
+			}, v.DispatchedJob)
+			continue
+		}
+
+		if err := m.requeueStaleJob(v.DispatchedJob.Job); err != nil {
+			m.logger.Error("error re-queuing the stale job for %v: %v", v.DispatchedJob.Job.Path, err, v.DispatchedJob.Job.LogFields())
+		}
+	}
+}
+
+// requeueStaleJob pushes job back onto its library's queue without counting it as a failed attempt.
+func (m *Manager) requeueStaleJob(job controller.Job) error {
+	// A new UUID keeps the stale Runner from reporting on the requeued job. The requeue is logged on the timeline
+	// of the stale job, which names the new UUID.
+	staleFields := job.LogFields()
+	job.UUID = controller.UUID(uuid.NewString())
+
+	requeued := false
+	err := m.modifyLibrary(job.LibraryID, func(lib *controller.Library) bool {
+		requeued = !lib.Queue.InQueuePath(job)
+		if requeued {
+			lib.Queue.Push(job)
+		}
+		return requeued
+	})
+	if err == nil && requeued {
+		m.logger.Info("Re-queued stale job for %v as job %v", job.Path, job.UUID, staleFields)
+	}
+
+	return err
+}
+
+// adoptCompletedJob matches a completed job which isn't dispatched anymore with the queued job for the same file,
+// which is removed from the queue so that the file isn't processed twice. This happens when the Controller forgot that
+// the job was taken away from its Runner (ex. it restarted) and the Runner finished it anyway. If the file isn't queued,
+// including when it has been dispatched again, the completed job is discarded.
+func (m *Manager) adoptCompletedJob(cJob controller.CompletedJob) (controller.DispatchedJob, bool) {
+	job, found, err := m.removeQueuedPath(cJob.History.Filename)
+	if err != nil {
+		m.logger.Error("error finding the queued job for %v: %v", cJob.History.Filename, err, controller.LogFields{"job_uuid": cJob.UUID})
+	} else if !found {
+		m.logger.Warn("Discarding completed job %v because %v isn't queued anymore", cJob.UUID, cJob.History.Filename, controller.LogFields{"job_uuid": cJob.UUID})
+	}
+
+	if err != nil || !found {
+		m.discardTranscodedFiles(cJob)
+		return controller.DispatchedJob{}, false
+	}
+
+	m.logger.Info("Importing completed job %v for %v even though it wasn't dispatched anymore", cJob.UUID, job.Path, controller.LogFields{"library_id": job.LibraryID, "job_uuid": cJob.UUID})
+	return controller.DispatchedJob{UUID: cJob.UUID, Runner: cJob.History.Runner, Job: job, LastUpdated: time.Now()}, true
+}
+
+// removeQueuedPath removes the job for path from whichever library's queue it is in and returns it.
+func (m *Manager) removeQueuedPath(path string) (job controller.Job, found bool, err error) {
+	if path == "" {
+		return controller.Job{}, false, nil
+	}
+
+	libs, err := m.ds.Libraries(m.ctx)
+	if err != nil {
+		return controller.Job{}, false, err
+	}
+
+	for _, lib := range libs {
+		if !lib.Queue.InQueuePath(controller.Job{Path: path}) {
+			continue
+		}
+
+		err = m.modifyLibrary(lib.ID, func(l *controller.Library) bool {
+			found = false
+			kept := make([]controller.Job, 0, len(l.Queue.Items))
+			for _, v := range l.Queue.Items {
+				if v.Path == path && !found {
+					job, found = v, true
+					continue
+				}
+				kept = append(kept, v)
+			}
+			l.Queue.Items = kept
+			return found
+		})
+		return job, found, err
+	}
+	return controller.Job{}, false, nil
+}
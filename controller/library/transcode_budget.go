@@ -0,0 +1,58 @@
+package library
+
+import (
+	"time"
+)
+
+// budgetEntry is the size of a transcoded file which was imported at a point in time.
+type budgetEntry struct {
+	at   time.Time
+	size int64
+}
+
+// SetTranscodeBudget sets how many bytes of transcoded files may be imported within window before PopNewJob stops
+// dispatching jobs. Dispatching resumes once enough of the imports are older than window. A budget of 0 disables it.
+// It must be called before Start.
+func (m *Manager) SetTranscodeBudget(bytes int64, window time.Duration) {
+	m.budgetBytes = bytes
+	m.budgetWindow = window
+}
+
+// recordBudget counts a transcoded file of size bytes against the transcode budget.
+func (m *Manager) recordBudget(size int64) {
+	if m.budgetBytes <= 0 {
+		return
+	}
+	m.budgetEntries = append(m.budgetEntries, budgetEntry{at: m.now(), size: size})
+}
+
+// budgetExhausted returns whether the transcoded files imported within the budget's window have reached the budget.
+// Imports which are older than the window are forgotten.
+func (m *Manager) budgetExhausted() bool {
+	if m.budgetBytes <= 0 {
+		return false
+	}
+
+	now := m.now()
+	var used int64
+	kept := m.budgetEntries[:0]
+	for _, e := range m.budgetEntries {
+		if now.Sub(e.at) >= m.budgetWindow {
+			continue
+		}
+		kept = append(kept, e)
+		used += e.size
+	}
+	m.budgetEntries = kept
+
+	exhausted := used >= m.budgetBytes
+	if exhausted != m.budgetWasExhausted {
+		if exhausted {
+			m.logger.Info("Pausing dispatching because %v bytes of transcoded files were imported in the last %v, which reaches the budget of %v bytes", used, m.budgetWindow, m.budgetBytes)
+		} else {
+			m.logger.Info("Resuming dispatching because the transcoded files imported in the last %v are under the budget again", m.budgetWindow)
+		}
+		m.budgetWasExhausted = exhausted
+	}
+	return exhausted
+}
@@ -0,0 +1,88 @@
+package library
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// maxProbeAttempts is the number of files ValidateLibrary tries to read metadata from before giving up.
+const maxProbeAttempts int = 5
+
+// ValidateLibrary checks that the provided library can be scanned and processed, without modifying anything.
+// The folder must exist and be readable, the multi-part patterns and command decider settings must be valid,
+// and the MetadataReader must be able to read at least one of the video files in the folder.
+func (m *Manager) ValidateLibrary(lib controller.Library) []controller.ValidationIssue {
+	issues := []controller.ValidationIssue{}
+	addIssue := func(severity controller.ValidationSeverity, field, format string, a ...interface{}) {
+		issues = append(issues, controller.ValidationIssue{Severity: severity, Field: field, Message: fmt.Sprintf(format, a...)})
+	}
+
+	for i, v := range lib.PathMasks {
+		if v == "" {
+			addIssue(controller.ValidationWarning, "path_masks", "path mask %v is empty and will be ignored", i)
+		}
+	}
+
+	for _, p := range lib.MultiPartPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			addIssue(controller.ValidationError, "multi_part_patterns", "invalid pattern '%v': %v", p, err)
+		}
+	}
+
+	if len(lib.VerificationCommand) > 0 && lib.VerificationCommand[0] == "" {
+		addIssue(controller.ValidationError, "verification_command", "verification command must start with an executable")
+	}
+
+	if err := m.commandDecider.ValidateSettings(lib.CommandDeciderSettings); err != nil {
+		addIssue(controller.ValidationError, "command_decider_settings", "invalid command decider settings: %v", err)
+	}
+
+	if lib.Folder == "" {
+		addIssue(controller.ValidationError, "folder", "folder must not be empty")
+		return issues
+	}
+
+	info, err := m.fileStater.Stat(lib.Folder)
+	if err != nil {
+		addIssue(controller.ValidationError, "folder", "folder '%v' couldn't be accessed: %v", lib.Folder, err)
+		return issues
+	} else if !info.IsDir() {
+		addIssue(controller.ValidationError, "folder", "'%v' is not a folder", lib.Folder)
+		return issues
+	}
+
+	if _, err = m.dirReader.ReadDir(lib.Folder); err != nil {
+		addIssue(controller.ValidationError, "folder", "folder '%v' couldn't be read: %v", lib.Folder, err)
+		return issues
+	}
+
+	videoFiles, err := m.videoFileser.VideoFiles(lib.Folder)
+	if err != nil {
+		addIssue(controller.ValidationError, "folder", "couldn't search '%v' for video files: %v", lib.Folder, err)
+		return issues
+	}
+
+	if len(videoFiles) == 0 {
+		addIssue(controller.ValidationWarning, "folder", "no video files were found in '%v'", lib.Folder)
+		return issues
+	}
+
+	if len(videoFiles) > maxProbeAttempts {
+		videoFiles = videoFiles[:maxProbeAttempts]
+	}
+
+	var probeErr error
+	for _, v := range videoFiles {
+		if _, probeErr = m.metadataReader.Read(v, lib.MetadataReadOptions()); probeErr == nil {
+			break
+		}
+	}
+
+	if probeErr != nil {
+		addIssue(controller.ValidationError, "folder", "couldn't read metadata from any of the %v video files tried: %v", len(videoFiles), probeErr)
+	}
+
+	return issues
+}
@@ -0,0 +1,138 @@
+package library
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func TestValidateLibrary(t *testing.T) {
+	validLib := controller.Library{Folder: "/media", PathMasks: []string{"sample"}, MultiPartPatterns: DefaultMultiPartPatterns, CommandDeciderSettings: "{}"}
+
+	tests := []struct {
+		name           string
+		lib            controller.Library
+		settingsErr    error
+		stater         mockFileStater
+		dirReaderErr   error
+		videoFileser   mockVideoFileser
+		metadataErr    error
+		expectedIssues []controller.ValidationIssue
+	}{
+		{
+			name:         "Valid library",
+			lib:          validLib,
+			stater:       mockFileStater{isDir: true},
+			videoFileser: mockVideoFileser{files: []string{"/media/a.mkv"}},
+		},
+		{
+			name:         "Empty path mask",
+			lib:          controller.Library{Folder: "/media", PathMasks: []string{""}},
+			stater:       mockFileStater{isDir: true},
+			videoFileser: mockVideoFileser{files: []string{"/media/a.mkv"}},
+			expectedIssues: []controller.ValidationIssue{
+				{Severity: controller.ValidationWarning, Field: "path_masks"},
+			},
+		},
+		{
+			name:         "Invalid multi-part pattern",
+			lib:          controller.Library{Folder: "/media", MultiPartPatterns: []string{"("}},
+			stater:       mockFileStater{isDir: true},
+			videoFileser: mockVideoFileser{files: []string{"/media/a.mkv"}},
+			expectedIssues: []controller.ValidationIssue{
+				{Severity: controller.ValidationError, Field: "multi_part_patterns"},
+			},
+		},
+		{
+			name:         "Verification command without an executable",
+			lib:          controller.Library{Folder: "/media", VerificationCommand: []string{"", "--min-vmaf", "93"}},
+			stater:       mockFileStater{isDir: true},
+			videoFileser: mockVideoFileser{files: []string{"/media/a.mkv"}},
+			expectedIssues: []controller.ValidationIssue{
+				{Severity: controller.ValidationError, Field: "verification_command"},
+			},
+		},
+		{
+			name:         "Invalid command decider settings",
+			lib:          validLib,
+			settingsErr:  errors.New("unknown codec"),
+			stater:       mockFileStater{isDir: true},
+			videoFileser: mockVideoFileser{files: []string{"/media/a.mkv"}},
+			expectedIssues: []controller.ValidationIssue{
+				{Severity: controller.ValidationError, Field: "command_decider_settings"},
+			},
+		},
+		{
+			name:   "Missing folder",
+			lib:    validLib,
+			stater: mockFileStater{err: fs.ErrNotExist},
+			expectedIssues: []controller.ValidationIssue{
+				{Severity: controller.ValidationError, Field: "folder"},
+			},
+		},
+		{
+			name:   "Folder is a file",
+			lib:    validLib,
+			stater: mockFileStater{isDir: false},
+			expectedIssues: []controller.ValidationIssue{
+				{Severity: controller.ValidationError, Field: "folder"},
+			},
+		},
+		{
+			name:         "Unreadable folder",
+			lib:          validLib,
+			stater:       mockFileStater{isDir: true},
+			dirReaderErr: fs.ErrPermission,
+			expectedIssues: []controller.ValidationIssue{
+				{Severity: controller.ValidationError, Field: "folder"},
+			},
+		},
+		{
+			name:         "No video files",
+			lib:          validLib,
+			stater:       mockFileStater{isDir: true},
+			videoFileser: mockVideoFileser{files: []string{}},
+			expectedIssues: []controller.ValidationIssue{
+				{Severity: controller.ValidationWarning, Field: "folder"},
+			},
+		},
+		{
+			name:         "Metadata can't be read",
+			lib:          validLib,
+			stater:       mockFileStater{isDir: true},
+			videoFileser: mockVideoFileser{files: []string{"/media/a.mkv", "/media/b.mkv"}},
+			metadataErr:  errors.New("exit status 1"),
+			expectedIssues: []controller.ValidationIssue{
+				{Severity: controller.ValidationError, Field: "folder"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewManager(&mockLogger{}, newMockLibraryManagerDataStorer(), &mockSettingsStorer{}, &mockMetadataReader{err: test.metadataErr}, &mockCommandDecider{settingsErr: test.settingsErr}, &mockNotifier{}, newMockMetricsCollector(), controller.PathCanonicalizer{}, 0)
+			m.fileStater = &test.stater
+			m.dirReader = &mockDirReader{err: test.dirReaderErr}
+			m.videoFileser = &test.videoFileser
+
+			issues := m.ValidateLibrary(test.lib)
+
+			// Messages are meant for users, so only the severity and field are compared.
+			for i := range issues {
+				issues[i].Message = ""
+			}
+
+			expected := test.expectedIssues
+			if expected == nil {
+				expected = []controller.ValidationIssue{}
+			}
+
+			if !reflect.DeepEqual(issues, expected) {
+				t.Errorf("expected %v but got %v", expected, issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readLogFiles returns the names of the files in dir and their combined contents.
+func readLogFiles(t *testing.T, dir string) (names []string, contents string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		names = append(names, e.Name())
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(data)
+	}
+	sort.Strings(names)
+	return names, b.String()
+}
+
+func TestFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	f, err := OpenFile(filepath.Join(dir, "controller.log"), Rotation{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err = f.Write([]byte(line)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	names, _ := readLogFiles(t, dir)
+	expected := []string{"controller-2021-08-01T12-00-01.000.log", "controller-2021-08-01T12-00-02.000.log", "controller.log"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected the files %v but got %v", expected, names)
+	}
+
+	b, _ := os.ReadFile(filepath.Join(dir, "controller.log"))
+	if string(b) != "third\n" {
+		t.Errorf("expected the current file to only have the last record but got %q", b)
+	}
+}
+
+func TestFileRemovesOldBackups(t *testing.T) {
+	tests := []struct {
+		name     string
+		rotation Rotation
+		expected []string
+	}{
+		{
+			name:     "Max Backups",
+			rotation: Rotation{MaxSize: 1, MaxBackups: 2},
+			expected: []string{"runner-2021-08-03T00-00-00.000.log", "runner-2021-08-04T00-00-00.000.log", "runner.log"},
+		},
+		{
+			name:     "Max Age",
+			rotation: Rotation{MaxSize: 1, MaxAge: 36 * time.Hour},
+			expected: []string{"runner-2021-08-03T00-00-00.000.log", "runner-2021-08-04T00-00-00.000.log", "runner.log"},
+		},
+		{
+			name:     "Keep All",
+			rotation: Rotation{MaxSize: 1},
+			expected: []string{"runner-2021-08-01T00-00-00.000.log", "runner-2021-08-02T00-00-00.000.log", "runner-2021-08-03T00-00-00.000.log", "runner-2021-08-04T00-00-00.000.log", "runner.log"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// Files which aren't rotated logs are left alone
+			os.WriteFile(filepath.Join(dir, "runner-notes.log"), nil, 0644)
+
+			f, err := OpenFile(filepath.Join(dir, "runner.log"), test.rotation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			now := time.Date(2021, time.July, 31, 0, 0, 0, 0, time.UTC)
+			f.now = func() time.Time { return now }
+			for i := 0; i < 5; i++ {
+				if _, err = f.Write([]byte("record\n")); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				now = now.Add(24 * time.Hour)
+			}
+
+			names, _ := readLogFiles(t, dir)
+			expected := append([]string{"runner-notes.log"}, test.expected...)
+			sort.Strings(expected)
+			if !reflect.DeepEqual(names, expected) {
+				t.Errorf("expected the files %v but got %v", expected, names)
+			}
+		})
+	}
+}
+
+func TestFileConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	f, err := OpenFile(filepath.Join(dir, "controller.log"), Rotation{MaxSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rotations int
+	f.now = func() time.Time {
+		rotations++
+		return time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC).Add(time.Duration(rotations) * time.Millisecond)
+	}
+
+	r := NewRoot(FormatText)
+	r.AddOutput(f, LevelInfo)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l := r.NewLogger(fmt.Sprintf("worker%v", i))
+			for j := 0; j < 100; j++ {
+				l.Info("record %v of worker %v", j, i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	f.Close()
+
+	names, contents := readLogFiles(t, dir)
+	if len(names) < 2 {
+		t.Errorf("expected the file to be rotated but got %v", names)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+	if len(lines) != 800 {
+		t.Fatalf("expected 800 records but got %v", len(lines))
+	}
+	record := regexp.MustCompile(`^[^|]+\|worker\d\|\d+\|INFO\|record \d+ of worker \d$`)
+	for _, line := range lines {
+		if !record.MatchString(line) {
+			t.Errorf("expected every record to be intact but got %q", line)
+		}
+	}
+
+	if _, err = f.Write([]byte("closed\n")); err == nil {
+		t.Errorf("expected an error writing to a closed file")
+	}
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatText formats rec as datetime|component|line|level|message, followed by its fields in key order.
+// Field values containing spaces or quotes are quoted.
+func formatText(rec record) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%v|%v|%v|%v|%v", rec.time.Format(time.RFC3339Nano), rec.component, rec.line, rec.level, rec.message)
+
+	for _, k := range sortedKeys(rec.fields) {
+		v := fmt.Sprint(rec.fields[k])
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(&b, " %v=%v", k, v)
+	}
+
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// reservedKeys are the keys of every JSON record, which fields can't replace.
+var reservedKeys = map[string]struct{}{"time": {}, "level": {}, "component": {}, "line": {}, "message": {}}
+
+// formatJSON formats rec as a JSON object on a single line. The fields follow the reserved keys in key order,
+// and a field named like a reserved key is prefixed with field_.
+func formatJSON(rec record) []byte {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	writeJSONPair(&b, "time", rec.time.Format(time.RFC3339Nano), true)
+	writeJSONPair(&b, "level", rec.level.String(), false)
+	writeJSONPair(&b, "component", rec.component, false)
+	writeJSONPair(&b, "line", rec.line, false)
+	writeJSONPair(&b, "message", rec.message, false)
+
+	for _, k := range sortedKeys(rec.fields) {
+		key := k
+		if _, ok := reservedKeys[k]; ok {
+			key = "field_" + k
+		}
+		writeJSONPair(&b, key, rec.fields[k], false)
+	}
+
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// writeJSONPair writes "key":value to b, preceded by a comma unless it is the first pair. Values which can't be
+// marshaled are written as their fmt representation.
+func writeJSONPair(b *bytes.Buffer, key string, value interface{}, first bool) {
+	if !first {
+		b.WriteByte(',')
+	}
+
+	k, _ := json.Marshal(key)
+	b.Write(k)
+	b.WriteByte(':')
+
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
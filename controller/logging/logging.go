@@ -0,0 +1,271 @@
+// Package logging implements the controller.Logger interface with plain text or JSON output and log levels which can
+// be overridden for each component.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// Level is the severity of a log record.
+type Level int
+
+const (
+	LevelTrace    Level = 0
+	LevelDebug    Level = 10
+	LevelInfo     Level = 20
+	LevelWarn     Level = 30
+	LevelError    Level = 40
+	LevelCritical Level = 50
+)
+
+var levelNames = map[Level]string{
+	LevelTrace:    "TRACE",
+	LevelDebug:    "DEBUG",
+	LevelInfo:     "INFO",
+	LevelWarn:     "WARNING",
+	LevelError:    "ERROR",
+	LevelCritical: "CRITICAL",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the Level named by s, which is one of the values of the LogVerbosity setting.
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "TRACE":
+		return LevelTrace, nil
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO":
+		return LevelInfo, nil
+	case "WARN", "WARNING":
+		return LevelWarn, nil
+	case "ERROR":
+		return LevelError, nil
+	case "CRITICAL":
+		return LevelCritical, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level '%v'", s)
+}
+
+// Format is how log records are written.
+type Format string
+
+const (
+	// FormatText writes each record as a line of |-separated values, followed by its fields as key=value pairs.
+	FormatText Format = "text"
+
+	// FormatJSON writes each record as a JSON object on its own line, with its fields as top-level keys.
+	FormatJSON Format = "json"
+)
+
+// Valid returns whether or not f is a known Format.
+func (f Format) Valid() bool {
+	return f == FormatText || f == FormatJSON
+}
+
+// Root writes the records of the Loggers created from it to its outputs.
+type Root struct {
+	format Format
+	now    func() time.Time
+	exit   func(code int)
+
+	mu              sync.RWMutex
+	outputs         []*Output
+	hooks           []hook
+	componentLevels map[string]Level
+}
+
+// Entry is a log record as it is passed to a hook.
+type Entry struct {
+	Time      time.Time
+	Level     Level
+	Component string
+	Message   string
+	Fields    controller.LogFields
+}
+
+type hook struct {
+	level Level
+	fn    func(Entry)
+}
+
+// Output is a destination of log records. Records below its level aren't written to it, unless the level of their
+// component is overridden.
+type Output struct {
+	root  *Root
+	w     io.Writer
+	level Level
+	mu    sync.Mutex
+}
+
+// NewRoot returns a new Root which writes its records in the provided format.
+func NewRoot(format Format) *Root {
+	return &Root{format: format, now: time.Now, exit: os.Exit}
+}
+
+// AddOutput makes r write the records at or above level to w.
+func (r *Root) AddOutput(w io.Writer, level Level) *Output {
+	o := &Output{root: r, w: w, level: level}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outputs = append(r.outputs, o)
+	return o
+}
+
+// AddHook makes r call fn with every record at or above level, regardless of the component levels. fn is called
+// from the goroutine which logged the record, so it must not block or log through r.
+func (r *Root) AddHook(level Level, fn func(Entry)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, hook{level: level, fn: fn})
+}
+
+// SetLevel sets the level below which records aren't written to o.
+func (o *Output) SetLevel(level Level) {
+	o.root.mu.Lock()
+	defer o.root.mu.Unlock()
+	o.level = level
+}
+
+// SetComponentLevels replaces the levels which override the level of every output for the components they name.
+// A name also applies to the components below it, so library applies to library.Manager and library/mediainfo,
+// unless a longer name applies to them too.
+func (r *Root) SetComponentLevels(levels map[string]Level) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.componentLevels = levels
+}
+
+// componentLevel returns the level which overrides the output levels for component. ok is false if there isn't one.
+// It must be called with r.mu held.
+func (r *Root) componentLevel(component string) (level Level, ok bool) {
+	matched := -1
+	for name, l := range r.componentLevels {
+		if len(name) > matched && (component == name || (strings.HasPrefix(component, name) && strings.ContainsRune("./", rune(component[len(name)])))) {
+			level, ok, matched = l, true, len(name)
+		}
+	}
+	return level, ok
+}
+
+// NewLogger returns a Logger whose records are tagged with component.
+func (r *Root) NewLogger(component string) Logger {
+	return Logger{component: component, root: r}
+}
+
+// record is a log record which is waiting to be formatted.
+type record struct {
+	time      time.Time
+	level     Level
+	component string
+	line      int
+	message   string
+	fields    controller.LogFields
+}
+
+// write writes rec to every output which accepts it and passes it to the hooks.
+func (r *Root) write(rec record) {
+	r.mu.RLock()
+	override, overridden := r.componentLevel(rec.component)
+	outputs := make([]*Output, 0, len(r.outputs))
+	for _, o := range r.outputs {
+		if (overridden && rec.level >= override) || (!overridden && rec.level >= o.level) {
+			outputs = append(outputs, o)
+		}
+	}
+	hooks := make([]hook, 0, len(r.hooks))
+	for _, h := range r.hooks {
+		if rec.level >= h.level {
+			hooks = append(hooks, h)
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, h := range hooks {
+		h.fn(Entry{Time: rec.time, Level: rec.level, Component: rec.component, Message: rec.message, Fields: rec.fields})
+	}
+
+	if len(outputs) == 0 {
+		return
+	}
+
+	var b []byte
+	if r.format == FormatJSON {
+		b = formatJSON(rec)
+	} else {
+		b = formatText(rec)
+	}
+
+	for _, o := range outputs {
+		o.mu.Lock()
+		if _, err := o.w.Write(b); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing a log record: %v\n", err)
+		}
+		o.mu.Unlock()
+	}
+}
+
+// Logger satisfies the controller.Logger interface by writing its records to its Root, tagged with its component.
+type Logger struct {
+	component string
+	root      *Root
+}
+
+func (l *Logger) log(level Level, s string, i []interface{}) {
+	_, _, line, ok := runtime.Caller(2)
+	if !ok {
+		line = -1
+	}
+
+	args, fields := controller.SplitLogFields(i)
+	l.root.write(record{
+		time:      l.root.now(),
+		level:     level,
+		component: l.component,
+		line:      line,
+		message:   fmt.Sprintf(s, args...),
+		fields:    fields,
+	})
+}
+
+// Trace records a log record with the level Trace.
+func (l *Logger) Trace(s string, i ...interface{}) {
+	l.log(LevelTrace, s, i)
+}
+
+// Debug records a log record with the level Debug.
+func (l *Logger) Debug(s string, i ...interface{}) {
+	l.log(LevelDebug, s, i)
+}
+
+// Info records a log record with the level Info.
+func (l *Logger) Info(s string, i ...interface{}) {
+	l.log(LevelInfo, s, i)
+}
+
+// Warn records a log record with the level Warn.
+func (l *Logger) Warn(s string, i ...interface{}) {
+	l.log(LevelWarn, s, i)
+}
+
+// Error records a log record with the level Error.
+func (l *Logger) Error(s string, i ...interface{}) {
+	l.log(LevelError, s, i)
+}
+
+// Critical records a log record with the level Critical and then exits with the status 1.
+func (l *Logger) Critical(s string, i ...interface{}) {
+	l.log(LevelCritical, s, i)
+	l.root.exit(1)
+}
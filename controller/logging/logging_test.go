@@ -0,0 +1,166 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func newTestRoot(format Format) (*Root, *bytes.Buffer) {
+	r := NewRoot(format)
+	r.now = func() time.Time { return time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC) }
+	var b bytes.Buffer
+	r.AddOutput(&b, LevelInfo)
+	return r, &b
+}
+
+func TestTextFormat(t *testing.T) {
+	r, b := newTestRoot(FormatText)
+	l := r.NewLogger("library.Manager")
+
+	l.Info("Scanned %v files", 3, controller.LogFields{"library_id": 1, "path": "/media/a b.mkv"})
+
+	fields := strings.Split(strings.TrimSuffix(b.String(), "\n"), "|")
+	if len(fields) != 5 {
+		t.Fatalf("expected 5 |-separated values but got %q", b.String())
+	}
+	if fields[0] != "2021-08-01T12:00:00Z" || fields[1] != "library.Manager" || fields[3] != "INFO" {
+		t.Errorf("unexpected record %q", b.String())
+	}
+	if expected := `Scanned 3 files library_id=1 path="/media/a b.mkv"`; fields[4] != expected {
+		t.Errorf("expected the message %q but got %q", expected, fields[4])
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	r, b := newTestRoot(FormatJSON)
+	l := r.NewLogger("runnerCommunicator")
+
+	l.Warn("Job %v failed", "abc", controller.LogFields{"job_uuid": controller.UUID("abc"), "message": "shadowed"})
+
+	var rec map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &rec); err != nil {
+		t.Fatalf("expected a JSON record but got %q: %v", b.String(), err)
+	}
+
+	expected := map[string]interface{}{
+		"time":          "2021-08-01T12:00:00Z",
+		"level":         "WARNING",
+		"component":     "runnerCommunicator",
+		"message":       "Job abc failed",
+		"job_uuid":      "abc",
+		"field_message": "shadowed",
+	}
+	for k, v := range expected {
+		if rec[k] != v {
+			t.Errorf("expected %v to be %v but got %v", k, v, rec[k])
+		}
+	}
+	if _, ok := rec["line"].(float64); !ok {
+		t.Errorf("expected the line number in %q", b.String())
+	}
+	if strings.Count(b.String(), "\n") != 1 {
+		t.Errorf("expected a single line but got %q", b.String())
+	}
+}
+
+func TestComponentLevels(t *testing.T) {
+	tests := []struct {
+		name      string
+		component string
+		levels    map[string]Level
+		expected  bool
+	}{
+		{name: "Output Level", component: "library.Manager", expected: false},
+		{name: "Exact Override", component: "library.Manager", levels: map[string]Level{"library.Manager": LevelDebug}, expected: true},
+		{name: "Parent Override", component: "library/mediainfo.MetadataReader", levels: map[string]Level{"library": LevelDebug}, expected: true},
+		{name: "Longest Override Wins", component: "library.Manager", levels: map[string]Level{"library": LevelDebug, "library.Manager": LevelError}, expected: false},
+		{name: "Prefix Of Another Name", component: "libraryX", levels: map[string]Level{"library": LevelDebug}, expected: false},
+		{name: "Other Component", component: "runnerCommunicator", levels: map[string]Level{"library": LevelDebug}, expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, b := newTestRoot(FormatText)
+			r.SetComponentLevels(test.levels)
+			l := r.NewLogger(test.component)
+
+			l.Debug("Debug record")
+
+			if written := b.Len() > 0; written != test.expected {
+				t.Errorf("expected the debug record to be written to be %v", test.expected)
+			}
+		})
+	}
+}
+
+func TestOutputLevels(t *testing.T) {
+	r, info := newTestRoot(FormatText)
+	var debug bytes.Buffer
+	o := r.AddOutput(&debug, LevelError)
+	o.SetLevel(LevelDebug)
+	l := r.NewLogger("main")
+
+	l.Debug("Debug record")
+
+	if info.Len() != 0 {
+		t.Errorf("expected the debug record to not be written to the info output but got %q", info.String())
+	}
+	if debug.Len() == 0 {
+		t.Errorf("expected the debug record to be written to the debug output")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	r, _ := newTestRoot(FormatText)
+	r.SetComponentLevels(map[string]Level{"runnerCommunicator": LevelError})
+	entries := make([]Entry, 0)
+	r.AddHook(LevelInfo, func(e Entry) { entries = append(entries, e) })
+	l := r.NewLogger("runnerCommunicator")
+
+	l.Debug("Debug record")
+	l.Info("Dispatched job %v", "abc", controller.LogFields{"job_uuid": controller.UUID("abc")})
+
+	// The component level only applies to the outputs
+	if len(entries) != 1 {
+		t.Fatalf("expected only the info record to be passed to the hook but got %+v", entries)
+	}
+	e := entries[0]
+	if e.Level != LevelInfo || e.Component != "runnerCommunicator" || e.Message != "Dispatched job abc" || e.Fields["job_uuid"] != controller.UUID("abc") {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if !e.Time.Equal(time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the time of the record but got %v", e.Time)
+	}
+}
+
+func TestCritical(t *testing.T) {
+	r, b := newTestRoot(FormatText)
+	code := -1
+	r.exit = func(c int) { code = c }
+	l := r.NewLogger("main")
+
+	l.Critical("Fatal")
+
+	if code != 1 {
+		t.Errorf("expected an exit with the status 1 but got %v", code)
+	}
+	if !strings.Contains(b.String(), "|CRITICAL|Fatal") {
+		t.Errorf("expected the critical record but got %q", b.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, expected := range map[string]Level{"TRACE": LevelTrace, "WARN": LevelWarn, "WARNING": LevelWarn, "CRITICAL": LevelCritical} {
+		if l, err := ParseLevel(s); err != nil || l != expected {
+			t.Errorf("expected %v to be %v but got %v, %v", s, expected, l, err)
+		}
+	}
+	if _, err := ParseLevel("LOUD"); err == nil {
+		t.Errorf("expected an error for an unknown level")
+	}
+}
@@ -0,0 +1,29 @@
+package mediaserver
+
+import "github.com/BrenekH/encodarr/controller"
+
+type mockLogger struct{}
+
+func (m *mockLogger) Trace(s string, i ...interface{})    {}
+func (m *mockLogger) Debug(s string, i ...interface{})    {}
+func (m *mockLogger) Info(s string, i ...interface{})     {}
+func (m *mockLogger) Warn(s string, i ...interface{})     {}
+func (m *mockLogger) Error(s string, i ...interface{})    {}
+func (m *mockLogger) Critical(s string, i ...interface{}) {}
+
+// mockSettingsStorer only implements the media server settings. The other methods panic.
+type mockSettingsStorer struct {
+	controller.SettingsStorer
+
+	server controller.MediaServer
+	token  string
+}
+
+func (m *mockSettingsStorer) MediaServer() controller.MediaServer { return m.server }
+
+func (m *mockSettingsStorer) Secret(name controller.SecretSetting) string {
+	if name == controller.SecretMediaServerToken {
+		return m.token
+	}
+	return ""
+}
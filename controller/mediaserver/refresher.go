@@ -0,0 +1,247 @@
+// Package mediaserver tells media servers (Plex, Jellyfin, and Emby) to rescan the folders of files that were replaced,
+// so that they don't keep serving the metadata of the originals until their next scheduled scan.
+package mediaserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+const (
+	// defaultInterval is how long the folders which need to be rescanned are collected before the media server is told
+	// about them, so that a burst of completed jobs only causes one rescan of each folder.
+	defaultInterval = 30 * time.Second
+
+	// maxAttempts is how many times a rescan request is sent before it is given up on.
+	maxAttempts = 3
+
+	// defaultRetryDelay is how long is waited after the first failed attempt. Every retry waits longer than the last.
+	defaultRetryDelay = 5 * time.Second
+
+	requestTimeout = 30 * time.Second
+)
+
+// errNoPlexSection is returned when none of the Plex library sections contain the folder that should be rescanned.
+// Retrying doesn't help with it.
+var errNoPlexSection = errors.New("no Plex library section contains the folder")
+
+// New returns a new Refresher which reads the media server to use from ss.
+func New(logger controller.Logger, ss controller.SettingsStorer) Refresher {
+	return Refresher{
+		logger:     logger,
+		ss:         ss,
+		client:     &http.Client{Timeout: requestTimeout},
+		interval:   defaultInterval,
+		retryDelay: defaultRetryDelay,
+		mu:         &sync.Mutex{},
+		pending:    make(map[target]struct{}),
+	}
+}
+
+// Refresher collects the folders of replaced files and tells the media server to rescan them.
+// Failures are only logged, since the files have already been replaced by then.
+type Refresher struct {
+	logger     controller.Logger
+	ss         controller.SettingsStorer
+	client     *http.Client
+	interval   time.Duration
+	retryDelay time.Duration
+
+	mu      *sync.Mutex
+	pending map[target]struct{}
+}
+
+// target is a folder to rescan on a media server. The server and token are read when the folder is added,
+// so that a change of settings doesn't send the folders which were already collected to the new server.
+type target struct {
+	server controller.MediaServer
+	token  string
+	dir    string
+}
+
+// Refresh adds dir to the folders that are rescanned on the next interval. It does nothing if there isn't a media server.
+func (r *Refresher) Refresh(dir string) {
+	server := r.ss.MediaServer()
+	if server.Type == controller.MediaServerNone {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[target{server: server, token: r.ss.Secret(controller.SecretMediaServerToken), dir: dir}] = struct{}{}
+}
+
+// Start sends the collected folders to the media server every interval without blocking the thread.
+func (r *Refresher) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			r.flush(ctx)
+		}
+	}()
+}
+
+// flush tells the media server to rescan every collected folder.
+func (r *Refresher) flush(ctx context.Context) {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[target]struct{})
+	r.mu.Unlock()
+
+	for t := range pending {
+		if err := r.refreshWithRetries(ctx, t); err != nil {
+			r.logger.Warn("Failed to tell %v at %v to rescan %v: %v", t.server.Type, t.server.URL, t.dir, err)
+		}
+	}
+}
+
+// refreshWithRetries sends the rescan request for t, retrying it with a growing delay if it fails.
+func (r *Refresher) refreshWithRetries(ctx context.Context, t target) (err error) {
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = r.refresh(ctx, t); err == nil {
+			r.logger.Debug("Told %v to rescan %v", t.server.Type, t.dir)
+			return nil
+		}
+		if errors.Is(err, errNoPlexSection) || attempt == maxAttempts {
+			break
+		}
+
+		r.logger.Debug("Attempt %v of telling %v to rescan %v failed, retrying: %v", attempt, t.server.Type, t.dir, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.retryDelay * time.Duration(attempt)):
+		}
+	}
+	return err
+}
+
+// refresh sends a single rescan request for t.
+func (r *Refresher) refresh(ctx context.Context, t target) error {
+	switch t.server.Type {
+	case controller.MediaServerPlex:
+		return r.refreshPlex(ctx, t)
+	case controller.MediaServerJellyfin, controller.MediaServerEmby:
+		return r.refreshJellyfin(ctx, t)
+	default:
+		return fmt.Errorf("unknown media server type '%v'", t.server.Type)
+	}
+}
+
+// plexSections is the part of the response to /library/sections that the folders of the sections are read from.
+type plexSections struct {
+	MediaContainer struct {
+		Directory []struct {
+			Key      string `json:"key"`
+			Location []struct {
+				Path string `json:"path"`
+			} `json:"Location"`
+		} `json:"Directory"`
+	} `json:"MediaContainer"`
+}
+
+// refreshPlex starts a partial scan of the folder in the Plex library section which contains it.
+func (r *Refresher) refreshPlex(ctx context.Context, t target) error {
+	b, err := r.do(ctx, t, http.MethodGet, "/library/sections", nil, nil)
+	if err != nil {
+		return err
+	}
+
+	var sections plexSections
+	if err = json.Unmarshal(b, &sections); err != nil {
+		return fmt.Errorf("parsing the library sections: %w", err)
+	}
+
+	for _, section := range sections.MediaContainer.Directory {
+		for _, location := range section.Location {
+			if !inFolder(t.dir, location.Path) {
+				continue
+			}
+			query := url.Values{"path": []string{t.dir}}
+			_, err = r.do(ctx, t, http.MethodGet, "/library/sections/"+url.PathEscape(section.Key)+"/refresh", query, nil)
+			return err
+		}
+	}
+	return errNoPlexSection
+}
+
+// refreshJellyfin tells Jellyfin or Emby that the folder was modified, which makes them rescan it.
+func (r *Refresher) refreshJellyfin(ctx context.Context, t target) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"Updates": []map[string]string{{"Path": t.dir, "UpdateType": "Modified"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.do(ctx, t, http.MethodPost, "/Library/Media/Updated", nil, body)
+	return err
+}
+
+// do sends a request to endpoint on t's server, authenticated with t's token, and returns the body of a successful response.
+func (r *Refresher) do(ctx context.Context, t target, method, endpoint string, query url.Values, body []byte) ([]byte, error) {
+	u, err := url.Parse(t.server.URL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + endpoint
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if t.server.Type == controller.MediaServerPlex {
+		req.Header.Set("X-Plex-Token", t.token)
+	} else {
+		req.Header.Set("X-Emby-Token", t.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%v %v returned %v", method, endpoint, resp.Status)
+	}
+	return b, nil
+}
+
+// inFolder returns whether or not dir is folder or inside of it. Windows paths are compared with forward slashes.
+func inFolder(dir, folder string) bool {
+	folder = strings.TrimSuffix(path.Clean(strings.ReplaceAll(folder, `\`, "/")), "/")
+	dir = path.Clean(strings.ReplaceAll(dir, `\`, "/"))
+	return dir == folder || strings.HasPrefix(dir, folder+"/")
+}
@@ -0,0 +1,120 @@
+package mediaserver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// recordingServer records every request that it receives as "<method> <path>?<query> <token> <body>" and responds
+// with the status in statuses for the request's number, or 200, and the body in responses for its path.
+type recordingServer struct {
+	mu        sync.Mutex
+	requests  []string
+	statuses  []int
+	responses map[string]string
+}
+
+func (s *recordingServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := r.Header.Get("X-Plex-Token") + r.Header.Get("X-Emby-Token")
+	body, _ := io.ReadAll(r.Body)
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI()+" "+token+" "+string(body))
+
+	if n := len(s.requests) - 1; n < len(s.statuses) {
+		rw.WriteHeader(s.statuses[n])
+		return
+	}
+	rw.Write([]byte(s.responses[r.URL.Path]))
+}
+
+func TestRefresh(t *testing.T) {
+	plexSections := `{"MediaContainer": {"Directory": [
+		{"key": "1", "Location": [{"path": "/media/movies"}]},
+		{"key": "2", "Location": [{"path": "/media/tv"}, {"path": "/media/anime"}]}
+	]}}`
+
+	tests := []struct {
+		name       string
+		serverType controller.MediaServerType
+		statuses   []int
+		dirs       []string
+		expected   []string
+	}{
+		{
+			name:       "Plex",
+			serverType: controller.MediaServerPlex,
+			dirs:       []string{"/media/anime/Show/Season 1", "/media/anime/Show/Season 1"},
+			expected: []string{
+				"GET /library/sections token ",
+				"GET /library/sections/2/refresh?path=%2Fmedia%2Fanime%2FShow%2FSeason+1 token ",
+			},
+		},
+		{
+			name:       "Plex Without A Matching Section",
+			serverType: controller.MediaServerPlex,
+			dirs:       []string{"/media/animeextra/Show"},
+			expected:   []string{"GET /library/sections token "},
+		},
+		{
+			name:       "Jellyfin",
+			serverType: controller.MediaServerJellyfin,
+			dirs:       []string{"/media/movies/Movie"},
+			expected:   []string{`POST /Library/Media/Updated token {"Updates":[{"Path":"/media/movies/Movie","UpdateType":"Modified"}]}`},
+		},
+		{
+			name:       "Emby Retried",
+			serverType: controller.MediaServerEmby,
+			statuses:   []int{http.StatusServiceUnavailable},
+			dirs:       []string{"/media/movies/Movie"},
+			expected: []string{
+				`POST /Library/Media/Updated token {"Updates":[{"Path":"/media/movies/Movie","UpdateType":"Modified"}]}`,
+				`POST /Library/Media/Updated token {"Updates":[{"Path":"/media/movies/Movie","UpdateType":"Modified"}]}`,
+			},
+		},
+		{
+			name:       "Gives Up",
+			serverType: controller.MediaServerJellyfin,
+			statuses:   []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			dirs:       []string{"/media/movies/Movie"},
+			expected: []string{
+				`POST /Library/Media/Updated token {"Updates":[{"Path":"/media/movies/Movie","UpdateType":"Modified"}]}`,
+				`POST /Library/Media/Updated token {"Updates":[{"Path":"/media/movies/Movie","UpdateType":"Modified"}]}`,
+				`POST /Library/Media/Updated token {"Updates":[{"Path":"/media/movies/Movie","UpdateType":"Modified"}]}`,
+			},
+		},
+		{
+			name:     "No Media Server",
+			dirs:     []string{"/media/movies/Movie"},
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rs := &recordingServer{statuses: test.statuses, responses: map[string]string{"/library/sections": plexSections}}
+			server := httptest.NewServer(rs)
+			defer server.Close()
+
+			r := New(&mockLogger{}, &mockSettingsStorer{server: controller.MediaServer{Type: test.serverType, URL: server.URL}, token: "token"})
+			r.retryDelay = 0
+
+			for _, dir := range test.dirs {
+				r.Refresh(dir)
+			}
+			r.flush(context.Background())
+
+			if !reflect.DeepEqual(rs.requests, test.expected) {
+				t.Errorf("expected requests %q but got %q", test.expected, rs.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/BrenekH/encodarr/controller/storertest"
+)
+
+func TestStorerContract(t *testing.T) {
+	storertest.Run(t, func(t *testing.T) storertest.Storers {
+		db := NewDatabase()
+
+		hc := NewHealthCheckerAdapter(db)
+		lm := NewLibraryManagerAdapter(db)
+		rc := NewRunnerCommunicatorAdapter(db)
+		fc := NewFileCacheAdapter(db)
+		je := NewJobEventAdapter(db)
+		ui := NewUserInterfacerAdapter(db)
+
+		return storertest.Storers{HealthChecker: &hc, LibraryManager: &lm, RunnerCommunicator: &rc, FileCache: &fc, JobEvents: &je, UserInterfacer: &ui}
+	})
+}
@@ -0,0 +1,200 @@
+// Package memory provides data storers that keep the Controller's state in memory. Nothing is persisted, which makes
+// them useful for tests and ephemeral deployments. None of their operations wait on I/O, so the contexts passed to
+// them are ignored.
+package memory
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// NewDatabase returns an instantiated, empty Database.
+func NewDatabase() *Database {
+	return &Database{
+		libraries:   make(map[int]controller.Library),
+		attempts:    make(map[string]int),
+		quarantined: make(map[string]controller.QuarantinedJob),
+		processed:   make(map[string]time.Time),
+		skipped:     make(map[string]time.Time),
+		files:       make(map[string]file),
+		snapshots:   make(map[string]controller.FileSnapshot),
+	}
+}
+
+// Database holds all of the data shared by the in-memory adapters. Everything that goes in or comes out
+// is deep-copied so that callers can't mutate the stored state.
+type Database struct {
+	mu sync.RWMutex
+
+	libraries map[int]controller.Library
+
+	// dispatchedJobs, heldGroupParts, history, runners, healthCheckActions, jobEvents, and benchmarks are slices to
+	// keep the insertion order, like the SQL databases.
+	dispatchedJobs     []controller.DispatchedJob
+	heldGroupParts     []controller.HeldGroupPart
+	history            []controller.History
+	runners            []controller.Runner
+	healthCheckActions []controller.HealthCheckAction
+	jobEvents          []controller.JobEvent
+	benchmarks         []controller.BenchmarkResult
+
+	attempts    map[string]int
+	quarantined map[string]controller.QuarantinedJob
+	processed   map[string]time.Time
+	skipped     map[string]time.Time // The time that each skipped path was skipped.
+	files       map[string]file
+	snapshots   map[string]controller.FileSnapshot
+}
+
+// file is an entry of the file cache. A nil field hasn't been saved yet.
+type file struct {
+	modtime  *time.Time
+	metadata *controller.FileMetadata
+}
+
+// dispatchedJobIndex returns the index of the dispatched job with the provided UUID or -1 if it doesn't exist.
+// The caller must hold the lock.
+func (d *Database) dispatchedJobIndex(uuid controller.UUID) int {
+	for i, v := range d.dispatchedJobs {
+		if v.UUID == uuid {
+			return i
+		}
+	}
+	return -1
+}
+
+// deleteLibrary marks the library with the provided ID as deleted at t, unless it already is.
+// The caller must hold the lock for writing.
+func (d *Database) deleteLibrary(id int, t time.Time) {
+	lib, ok := d.libraries[id]
+	if !ok || !lib.DeletedAt.IsZero() {
+		return
+	}
+
+	lib.DeletedAt = t
+	lib.Version++
+	d.libraries[id] = lib
+}
+
+// restoreLibrary clears the deleted mark of the library with the provided ID or returns sql.ErrNoRows if it isn't deleted.
+// The caller must hold the lock for writing.
+func (d *Database) restoreLibrary(id int) error {
+	lib, ok := d.libraries[id]
+	if !ok || lib.DeletedAt.IsZero() {
+		return sql.ErrNoRows
+	}
+
+	lib.DeletedAt = time.Time{}
+	lib.Version++
+	d.libraries[id] = lib
+	return nil
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+func copyMetadata(m controller.FileMetadata) controller.FileMetadata {
+	if m.VideoTracks != nil {
+		m.VideoTracks = append([]controller.VideoTrack{}, m.VideoTracks...)
+	}
+	if m.AudioTracks != nil {
+		m.AudioTracks = append([]controller.AudioTrack{}, m.AudioTracks...)
+	}
+	if m.SubtitleTracks != nil {
+		m.SubtitleTracks = append([]controller.SubtitleTrack{}, m.SubtitleTracks...)
+	}
+	if m.Programs != nil {
+		programs := make([]controller.Program, 0, len(m.Programs))
+		for _, p := range m.Programs {
+			p.StreamIndexes = append([]int{}, p.StreamIndexes...)
+			programs = append(programs, p)
+		}
+		m.Programs = programs
+	}
+	return m
+}
+
+func copyJob(j controller.Job) controller.Job {
+	j.Command = copyStrings(j.Command)
+	j.Metadata = copyMetadata(j.Metadata)
+	if j.Annotations != nil {
+		annotations := make(map[string]string, len(j.Annotations))
+		for k, v := range j.Annotations {
+			annotations[k] = v
+		}
+		j.Annotations = annotations
+	}
+	if j.Benchmark != nil {
+		b := *j.Benchmark
+		j.Benchmark = &b
+	}
+	return j
+}
+
+func copyBenchmarkResult(r controller.BenchmarkResult) controller.BenchmarkResult {
+	r.Command = copyStrings(r.Command)
+	r.Errors = copyStrings(r.Errors)
+	return r
+}
+
+func copyLibrary(l controller.Library) controller.Library {
+	if l.Queue.Items != nil {
+		items := make([]controller.Job, 0, len(l.Queue.Items))
+		for _, j := range l.Queue.Items {
+			items = append(items, copyJob(j))
+		}
+		l.Queue.Items = items
+	}
+	l.PathMasks = copyStrings(l.PathMasks)
+	l.MultiPartPatterns = copyStrings(l.MultiPartPatterns)
+	l.VerificationCommand = copyStrings(l.VerificationCommand)
+	l.MetadataReadArgs = copyStrings(l.MetadataReadArgs)
+	if l.Notifications.Webhooks != nil {
+		webhooks := make([]controller.LibraryWebhook, 0, len(l.Notifications.Webhooks))
+		for _, w := range l.Notifications.Webhooks {
+			if w.Events != nil {
+				w.Events = append([]controller.EventType{}, w.Events...)
+			}
+			webhooks = append(webhooks, w)
+		}
+		l.Notifications.Webhooks = webhooks
+	}
+	return l
+}
+
+func copyDispatchedJob(d controller.DispatchedJob) controller.DispatchedJob {
+	d.Job = copyJob(d.Job)
+	return d
+}
+
+func copyHeldGroupPart(p controller.HeldGroupPart) controller.HeldGroupPart {
+	p.Completed.History = copyHistory(p.Completed.History)
+	if p.Completed.Benchmark != nil {
+		b := *p.Completed.Benchmark
+		p.Completed.Benchmark = &b
+	}
+	p.Dispatched = copyDispatchedJob(p.Dispatched)
+	return p
+}
+
+func copyHistory(h controller.History) controller.History {
+	h.Warnings = copyStrings(h.Warnings)
+	h.Errors = copyStrings(h.Errors)
+	h.Job = copyJob(h.Job)
+	if h.Output != nil {
+		output := *h.Output
+		h.Output = &output
+	}
+	if h.Completion != nil {
+		completion := *h.Completion
+		h.Completion = &completion
+	}
+	return h
+}
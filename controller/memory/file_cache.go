@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// NewFileCacheAdapter returns an instantiated FileCacheAdapter.
+func NewFileCacheAdapter(db *Database) FileCacheAdapter {
+	return FileCacheAdapter{db: db}
+}
+
+// FileCacheAdapter satisfies the controller.FilesCacheDataStorer interface using an in-memory Database.
+type FileCacheAdapter struct {
+	db *Database
+}
+
+// Modtime returns the modtime associated with the provided path.
+func (a *FileCacheAdapter) Modtime(ctx context.Context, path string) (time.Time, error) {
+	a.db.mu.RLock()
+	defer a.db.mu.RUnlock()
+
+	f, ok := a.db.files[path]
+	if !ok || f.modtime == nil {
+		return time.Now(), sql.ErrNoRows
+	}
+	return *f.modtime, nil
+}
+
+// Metadata returns the metadata associated with the provided path.
+func (a *FileCacheAdapter) Metadata(ctx context.Context, path string) (controller.FileMetadata, error) {
+	a.db.mu.RLock()
+	defer a.db.mu.RUnlock()
+
+	f, ok := a.db.files[path]
+	if !ok || f.metadata == nil {
+		return controller.FileMetadata{}, sql.ErrNoRows
+	}
+	return copyMetadata(*f.metadata), nil
+}
+
+// SaveModtime updates the modtime that is associated with the provided path.
+func (a *FileCacheAdapter) SaveModtime(ctx context.Context, path string, t time.Time) error {
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	f := a.db.files[path]
+	f.modtime = &t
+	a.db.files[path] = f
+	return nil
+}
+
+// SaveMetadata updates the metadata that is associated with the provided path.
+func (a *FileCacheAdapter) SaveMetadata(ctx context.Context, path string, m controller.FileMetadata) error {
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	m = copyMetadata(m)
+	f := a.db.files[path]
+	f.metadata = &m
+	a.db.files[path] = f
+	return nil
+}
@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// NewHealthCheckerAdapter returns a new instantiated HealthCheckerAdapter.
+func NewHealthCheckerAdapter(db *Database) HealthCheckerAdapter {
+	return HealthCheckerAdapter{db: db}
+}
+
+// HealthCheckerAdapter satisfies the controller.HealthCheckerDataStorer interface using an in-memory Database.
+type HealthCheckerAdapter struct {
+	db *Database
+}
+
+// DispatchedJobs returns all of the dispatched jobs.
+func (h *HealthCheckerAdapter) DispatchedJobs(ctx context.Context) []controller.DispatchedJob {
+	h.db.mu.RLock()
+	defer h.db.mu.RUnlock()
+
+	returnSlice := make([]controller.DispatchedJob, 0, len(h.db.dispatchedJobs))
+	for _, v := range h.db.dispatchedJobs {
+		returnSlice = append(returnSlice, copyDispatchedJob(v))
+	}
+	return returnSlice
+}
+
+// RevokeLease deletes a specific dispatched job if its lease expired at or before now.
+func (h *HealthCheckerAdapter) RevokeLease(ctx context.Context, uuid controller.UUID, now time.Time) (bool, error) {
+	h.db.mu.Lock()
+	defer h.db.mu.Unlock()
+
+	i := h.db.dispatchedJobIndex(uuid)
+	if i == -1 || h.db.dispatchedJobs[i].LeaseExpires.After(now) {
+		return false, nil
+	}
+
+	h.db.dispatchedJobs = append(h.db.dispatchedJobs[:i], h.db.dispatchedJobs[i+1:]...)
+	return true, nil
+}
+
+// Runners returns every Runner which has contacted the Controller.
+func (h *HealthCheckerAdapter) Runners(ctx context.Context) ([]controller.Runner, error) {
+	h.db.mu.RLock()
+	defer h.db.mu.RUnlock()
+
+	return append(make([]controller.Runner, 0, len(h.db.runners)), h.db.runners...), nil
+}
+
+// StaleJobSettings returns the stale job settings of every library, including the deleted ones which may still
+// have dispatched jobs.
+func (h *HealthCheckerAdapter) StaleJobSettings(ctx context.Context) (map[int]controller.StaleJobSettings, error) {
+	h.db.mu.RLock()
+	defer h.db.mu.RUnlock()
+
+	settings := make(map[int]controller.StaleJobSettings, len(h.db.libraries))
+	for id, v := range h.db.libraries {
+		settings[id] = controller.StaleJobSettings{Timeout: v.StaleJobTimeout, Action: v.StaleJobAction}
+	}
+	return settings, nil
+}
+
+// SaveHealthCheckAction records an action of the health checker.
+func (h *HealthCheckerAdapter) SaveHealthCheckAction(ctx context.Context, a controller.HealthCheckAction) error {
+	h.db.mu.Lock()
+	defer h.db.mu.Unlock()
+
+	h.db.healthCheckActions = append(h.db.healthCheckActions, a)
+	return nil
+}
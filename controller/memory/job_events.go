@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// NewJobEventAdapter returns a new instantiated JobEventAdapter.
+func NewJobEventAdapter(db *Database) JobEventAdapter {
+	return JobEventAdapter{db: db}
+}
+
+// JobEventAdapter satisfies the controller.JobEventDataStorer interface using an in-memory Database.
+type JobEventAdapter struct {
+	db *Database
+}
+
+// SaveJobEvents appends the provided events to the job event log.
+func (a *JobEventAdapter) SaveJobEvents(ctx context.Context, events []controller.JobEvent) error {
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	a.db.jobEvents = append(a.db.jobEvents, events...)
+	return nil
+}
+
+// DeleteJobEventsBefore deletes the events which were recorded before t.
+func (a *JobEventAdapter) DeleteJobEventsBefore(ctx context.Context, t time.Time) (int, error) {
+	a.db.mu.Lock()
+	defer a.db.mu.Unlock()
+
+	kept := make([]controller.JobEvent, 0, len(a.db.jobEvents))
+	for _, v := range a.db.jobEvents {
+		if !v.Time.Before(t) {
+			kept = append(kept, v)
+		}
+	}
+	deleted := len(a.db.jobEvents) - len(kept)
+	a.db.jobEvents = kept
+	return deleted, nil
+}
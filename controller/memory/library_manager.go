@@ -0,0 +1,510 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// NewLibraryManagerAdapter returns an instantiated LibraryManagerAdapter
+func NewLibraryManagerAdapter(db *Database) LibraryManagerAdapter {
+	return LibraryManagerAdapter{db: db}
+}
+
+// LibraryManagerAdapter is a struct that satisfies the interface that connects a LibraryManager
+// to a storage medium.
+type LibraryManagerAdapter struct {
+	db *Database
+}
+
+// Libraries returns all of the libraries which aren't deleted, sorted by ID.
+func (l *LibraryManagerAdapter) Libraries(ctx context.Context) ([]controller.Library, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	returnSlice := make([]controller.Library, 0, len(l.db.libraries))
+	for _, v := range l.db.libraries {
+		if v.DeletedAt.IsZero() {
+			returnSlice = append(returnSlice, copyLibrary(v))
+		}
+	}
+	sort.Slice(returnSlice, func(i, j int) bool { return returnSlice[i].ID < returnSlice[j].ID })
+
+	return returnSlice, nil
+}
+
+// Library returns a specific library unless it is deleted.
+func (l *LibraryManagerAdapter) Library(ctx context.Context, id int) (controller.Library, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	lib, ok := l.db.libraries[id]
+	if !ok || !lib.DeletedAt.IsZero() {
+		return controller.Library{}, sql.ErrNoRows
+	}
+	return copyLibrary(lib), nil
+}
+
+// SaveLibrary creates the library if its Version is 0, or replaces the stored library if the Versions match.
+// controller.ErrLibraryConflict is returned when another caller saved the library first.
+func (l *LibraryManagerAdapter) SaveLibrary(ctx context.Context, lib controller.Library) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	stored, ok := l.db.libraries[lib.ID]
+	if ok != (lib.Version != 0) || stored.Version != lib.Version {
+		return controller.ErrLibraryConflict
+	}
+
+	lib = copyLibrary(lib)
+	lib.Version++
+	l.db.libraries[lib.ID] = lib
+	return nil
+}
+
+// AppendJobs adds the jobs whose paths aren't already queued to the library's queue.
+func (l *LibraryManagerAdapter) AppendJobs(ctx context.Context, libraryID int, jobs []controller.Job) ([]controller.Job, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	lib, ok := l.db.libraries[libraryID]
+	if !ok || !lib.DeletedAt.IsZero() {
+		return nil, sql.ErrNoRows
+	}
+
+	lib = copyLibrary(lib)
+	queued := len(lib.Queue.Items)
+	appended := lib.Queue.PushNew(jobs)
+	if len(appended) == 0 {
+		return appended, nil
+	}
+	for i := queued; i < len(lib.Queue.Items); i++ {
+		lib.Queue.Items[i] = copyJob(lib.Queue.Items[i])
+	}
+
+	lib.Version++
+	l.db.libraries[libraryID] = lib
+	return appended, nil
+}
+
+// IsPathDispatched returns whether or not any dispatched job has the provided path.
+func (l *LibraryManagerAdapter) IsPathDispatched(ctx context.Context, path string) (bool, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	for _, v := range l.db.dispatchedJobs {
+		if v.Job.Path == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IsJobDispatched returns whether or not the job with the provided UUID has been dispatched.
+func (l *LibraryManagerAdapter) IsJobDispatched(ctx context.Context, uuid controller.UUID) (bool, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	return l.db.dispatchedJobIndex(uuid) != -1, nil
+}
+
+// DispatchedJobCount counts the dispatched jobs which belong to the provided library.
+func (l *LibraryManagerAdapter) DispatchedJobCount(ctx context.Context, libraryID int) (int, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	count := 0
+	for _, v := range l.db.dispatchedJobs {
+		if v.Job.LibraryID == libraryID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DispatchedJobs returns all of the dispatched jobs.
+func (l *LibraryManagerAdapter) DispatchedJobs(ctx context.Context) ([]controller.DispatchedJob, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	returnSlice := make([]controller.DispatchedJob, 0, len(l.db.dispatchedJobs))
+	for _, v := range l.db.dispatchedJobs {
+		returnSlice = append(returnSlice, copyDispatchedJob(v))
+	}
+	return returnSlice, nil
+}
+
+// RevokeLease deletes a specific dispatched job if its lease expired at or before now.
+func (l *LibraryManagerAdapter) RevokeLease(ctx context.Context, uuid controller.UUID, now time.Time) (bool, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	i := l.db.dispatchedJobIndex(uuid)
+	if i == -1 || l.db.dispatchedJobs[i].LeaseExpires.After(now) {
+		return false, nil
+	}
+
+	l.db.dispatchedJobs = append(l.db.dispatchedJobs[:i], l.db.dispatchedJobs[i+1:]...)
+	return true, nil
+}
+
+// PopDispatchedJob returns a specific dispatched job and removes it.
+func (l *LibraryManagerAdapter) PopDispatchedJob(ctx context.Context, uuid controller.UUID) (controller.DispatchedJob, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	i := l.db.dispatchedJobIndex(uuid)
+	if i == -1 {
+		return controller.DispatchedJob{UUID: uuid}, sql.ErrNoRows
+	}
+
+	dJob := l.db.dispatchedJobs[i]
+	l.db.dispatchedJobs = append(l.db.dispatchedJobs[:i], l.db.dispatchedJobs[i+1:]...)
+
+	return dJob, nil
+}
+
+// PushHistory adds an entry to the history.
+func (l *LibraryManagerAdapter) PushHistory(ctx context.Context, h controller.History) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	l.db.history = append(l.db.history, copyHistory(h))
+	return nil
+}
+
+// HoldGroupPart saves a held part of a multi-part set, replacing the one with the same UUID.
+func (l *LibraryManagerAdapter) HoldGroupPart(ctx context.Context, p controller.HeldGroupPart) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	for i, v := range l.db.heldGroupParts {
+		if v.Completed.UUID == p.Completed.UUID {
+			l.db.heldGroupParts[i] = copyHeldGroupPart(p)
+			return nil
+		}
+	}
+	l.db.heldGroupParts = append(l.db.heldGroupParts, copyHeldGroupPart(p))
+	return nil
+}
+
+// HeldGroupParts returns the held parts of multi-part sets in insertion order.
+func (l *LibraryManagerAdapter) HeldGroupParts(ctx context.Context) ([]controller.HeldGroupPart, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	parts := make([]controller.HeldGroupPart, 0, len(l.db.heldGroupParts))
+	for _, p := range l.db.heldGroupParts {
+		parts = append(parts, copyHeldGroupPart(p))
+	}
+	return parts, nil
+}
+
+// ReleaseGroupParts deletes the held parts of the provided multi-part set.
+func (l *LibraryManagerAdapter) ReleaseGroupParts(ctx context.Context, group string) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	kept := l.db.heldGroupParts[:0]
+	for _, p := range l.db.heldGroupParts {
+		if p.Dispatched.Job.Group != group {
+			kept = append(kept, p)
+		}
+	}
+	l.db.heldGroupParts = kept
+	return nil
+}
+
+// SaveBenchmarkResult adds a benchmark result to the benchmarks slice.
+func (l *LibraryManagerAdapter) SaveBenchmarkResult(ctx context.Context, r controller.BenchmarkResult) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	l.db.benchmarks = append(l.db.benchmarks, copyBenchmarkResult(r))
+	return nil
+}
+
+// IncrementJobAttempts increments the attempt counter of the provided path and returns the new value.
+func (l *LibraryManagerAdapter) IncrementJobAttempts(ctx context.Context, path string) (int, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	l.db.attempts[path]++
+	return l.db.attempts[path], nil
+}
+
+// ResetJobAttempts deletes the attempt counter of the provided path.
+func (l *LibraryManagerAdapter) ResetJobAttempts(ctx context.Context, path string) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	delete(l.db.attempts, path)
+	return nil
+}
+
+// QuarantineJob quarantines the provided job, replacing any previous entry for the same path.
+func (l *LibraryManagerAdapter) QuarantineJob(ctx context.Context, q controller.QuarantinedJob) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	q.Job = copyJob(q.Job)
+	l.db.quarantined[q.Job.Path] = q
+	return nil
+}
+
+// IsPathQuarantined returns whether or not a job for the provided path is quarantined.
+func (l *LibraryManagerAdapter) IsPathQuarantined(ctx context.Context, path string) (bool, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	_, ok := l.db.quarantined[path]
+	return ok, nil
+}
+
+// IsPathSkipped returns whether or not the provided path is skipped.
+func (l *LibraryManagerAdapter) IsPathSkipped(ctx context.Context, path string) (bool, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	_, ok := l.db.skipped[path]
+	return ok, nil
+}
+
+// ReleaseExpiredQuarantines takes the jobs which were quarantined before quarantinedBefore out of quarantine,
+// resets their attempt counters, and returns their paths.
+func (l *LibraryManagerAdapter) ReleaseExpiredQuarantines(ctx context.Context, quarantinedBefore time.Time) ([]string, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	released := make([]string, 0)
+	for path, q := range l.db.quarantined {
+		if q.DateTimeQuarantined.Before(quarantinedBefore) {
+			delete(l.db.quarantined, path)
+			delete(l.db.attempts, path)
+			released = append(released, path)
+		}
+	}
+	sort.Strings(released)
+	return released, nil
+}
+
+// LastProcessedModtime returns the modtime that the provided path had when a job for it was last completed.
+func (l *LibraryManagerAdapter) LastProcessedModtime(ctx context.Context, path string) (time.Time, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	t, ok := l.db.processed[path]
+	if !ok {
+		return time.Time{}, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+// SaveLastProcessedModtime updates the modtime that the provided path had when a job for it was last completed.
+func (l *LibraryManagerAdapter) SaveLastProcessedModtime(ctx context.Context, path string, t time.Time) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	l.db.processed[path] = t
+	return nil
+}
+
+// CanonicalizePaths rewrites the paths of the processed modtimes, job attempts, quarantined jobs, and skipped paths with
+// canonicalize. Entries which end up with the same path are merged by keeping the latest modtime, the highest attempt
+// count, the quarantined job which was already at the canonical path, and the earliest skip.
+func (l *LibraryManagerAdapter) CanonicalizePaths(ctx context.Context, canonicalize func(path string) string) (int, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	changed := 0
+
+	for path, modtime := range l.db.processed {
+		canonical := canonicalize(path)
+		if canonical == path {
+			continue
+		}
+		delete(l.db.processed, path)
+		if t, ok := l.db.processed[canonical]; !ok || modtime.After(t) {
+			l.db.processed[canonical] = modtime
+		}
+		changed++
+	}
+
+	for path, attempts := range l.db.attempts {
+		canonical := canonicalize(path)
+		if canonical == path {
+			continue
+		}
+		delete(l.db.attempts, path)
+		if a, ok := l.db.attempts[canonical]; !ok || attempts > a {
+			l.db.attempts[canonical] = attempts
+		}
+		changed++
+	}
+
+	for path, skipped := range l.db.skipped {
+		canonical := canonicalize(path)
+		if canonical == path {
+			continue
+		}
+		delete(l.db.skipped, path)
+		if t, ok := l.db.skipped[canonical]; !ok || skipped.Before(t) {
+			l.db.skipped[canonical] = skipped
+		}
+		changed++
+	}
+
+	// The canonical paths are collected first so that a quarantined job which is already at its canonical path
+	// isn't replaced by one which is moved there, regardless of the map's iteration order.
+	quarantined := make(map[string]controller.QuarantinedJob, len(l.db.quarantined))
+	for path, q := range l.db.quarantined {
+		if canonicalize(path) == path {
+			quarantined[path] = q
+		}
+	}
+	for path, q := range l.db.quarantined {
+		canonical := canonicalize(path)
+		if canonical == path {
+			continue
+		}
+		if _, ok := quarantined[canonical]; !ok {
+			q.Job.Path = canonical
+			quarantined[canonical] = q
+		}
+		changed++
+	}
+	l.db.quarantined = quarantined
+
+	return changed, nil
+}
+
+// DeleteLibrary marks the specified library as deleted at t. Its version is incremented so that saves which
+// started before the deletion conflict instead of succeeding.
+func (l *LibraryManagerAdapter) DeleteLibrary(ctx context.Context, id int, t time.Time) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	l.db.deleteLibrary(id, t)
+	return nil
+}
+
+// RestoreLibrary clears the deleted mark of the specified library.
+func (l *LibraryManagerAdapter) RestoreLibrary(ctx context.Context, id int) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	return l.db.restoreLibrary(id)
+}
+
+// PurgeDeletedLibraries removes the libraries which were deleted before deletedBefore, their quarantined jobs,
+// and their file snapshots.
+func (l *LibraryManagerAdapter) PurgeDeletedLibraries(ctx context.Context, deletedBefore time.Time) ([]controller.Library, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	purged := make([]controller.Library, 0)
+	for _, lib := range l.db.libraries {
+		if lib.DeletedAt.IsZero() || !lib.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+		purged = append(purged, l.purgeLibrary(lib))
+	}
+	sort.Slice(purged, func(i, j int) bool { return purged[i].ID < purged[j].ID })
+
+	return purged, nil
+}
+
+// PurgeDeletedLibrary removes the specified library, its quarantined jobs, and its file snapshots, no matter when
+// the library was deleted. sql.ErrNoRows is returned if the library isn't marked as deleted.
+func (l *LibraryManagerAdapter) PurgeDeletedLibrary(ctx context.Context, id int) (controller.Library, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	lib, ok := l.db.libraries[id]
+	if !ok || lib.DeletedAt.IsZero() {
+		return controller.Library{}, sql.ErrNoRows
+	}
+	return l.purgeLibrary(lib), nil
+}
+
+// purgeLibrary removes lib along with its quarantined jobs and file snapshots, and records its folder in the history
+// of its jobs. l.db.mu must be held for writing.
+func (l *LibraryManagerAdapter) purgeLibrary(lib controller.Library) controller.Library {
+	for i, h := range l.db.history {
+		if h.Job.LibraryID == lib.ID && h.LibraryFolder == "" {
+			l.db.history[i].LibraryFolder = lib.Folder
+		}
+	}
+
+	for path, q := range l.db.quarantined {
+		if q.Job.LibraryID == lib.ID {
+			delete(l.db.quarantined, path)
+		}
+	}
+
+	for path, snapshot := range l.db.snapshots {
+		if snapshot.LibraryID == lib.ID {
+			delete(l.db.snapshots, path)
+		}
+	}
+
+	delete(l.db.libraries, lib.ID)
+	return copyLibrary(lib)
+}
+
+// FileSnapshotModtimes returns the modtimes of the file snapshots of the provided library.
+func (l *LibraryManagerAdapter) FileSnapshotModtimes(ctx context.Context, libraryID int) (map[string]time.Time, error) {
+	l.db.mu.RLock()
+	defer l.db.mu.RUnlock()
+
+	modtimes := make(map[string]time.Time)
+	for path, snapshot := range l.db.snapshots {
+		if snapshot.LibraryID == libraryID {
+			modtimes[path] = snapshot.Modtime
+		}
+	}
+	return modtimes, nil
+}
+
+// SaveFileSnapshot replaces the snapshot of the file at s.Path.
+func (l *LibraryManagerAdapter) SaveFileSnapshot(ctx context.Context, s controller.FileSnapshot) error {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	l.db.snapshots[s.Path] = s
+	return nil
+}
+
+// DeleteFileSnapshots deletes the snapshots of the provided paths.
+func (l *LibraryManagerAdapter) DeleteFileSnapshots(ctx context.Context, paths []string) (int, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	deleted := 0
+	for _, path := range paths {
+		if _, ok := l.db.snapshots[path]; ok {
+			delete(l.db.snapshots, path)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// DeleteProcessedModtimes forgets the modtimes of every path starting with pathPrefix.
+func (l *LibraryManagerAdapter) DeleteProcessedModtimes(ctx context.Context, pathPrefix string) (int, error) {
+	l.db.mu.Lock()
+	defer l.db.mu.Unlock()
+
+	deleted := 0
+	for path := range l.db.processed {
+		if strings.HasPrefix(path, pathPrefix) {
+			delete(l.db.processed, path)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
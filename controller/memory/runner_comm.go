@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/google/uuid"
+)
+
+// NewRunnerCommunicatorAdapter returns an instantiated RunnerCommunicatorAdapter.
+func NewRunnerCommunicatorAdapter(db *Database) RunnerCommunicatorAdapter {
+	return RunnerCommunicatorAdapter{db: db}
+}
+
+// RunnerCommunicatorAdapter is a struct that satisfies the interface that connects a RunnerCommunicator
+// to a storage medium.
+type RunnerCommunicatorAdapter struct {
+	db *Database
+}
+
+// DispatchedJob returns the dispatched job with the provided uuid.
+func (r *RunnerCommunicatorAdapter) DispatchedJob(ctx context.Context, uuid controller.UUID) (controller.DispatchedJob, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	i := r.db.dispatchedJobIndex(uuid)
+	if i == -1 {
+		return controller.DispatchedJob{UUID: uuid}, sql.ErrNoRows
+	}
+	return copyDispatchedJob(r.db.dispatchedJobs[i]), nil
+}
+
+// SaveDispatchedJob creates or replaces the dispatched job with the UUID of the provided one, unless a job with another
+// UUID is already dispatched for the same path.
+func (r *RunnerCommunicatorAdapter) SaveDispatchedJob(ctx context.Context, dJob controller.DispatchedJob) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, v := range r.db.dispatchedJobs {
+		if v.Job.Path == dJob.Job.Path && v.UUID != dJob.UUID {
+			return controller.ErrPathDispatched
+		}
+	}
+
+	dJob = copyDispatchedJob(dJob)
+	if i := r.db.dispatchedJobIndex(dJob.UUID); i != -1 {
+		r.db.dispatchedJobs[i] = dJob
+		return nil
+	}
+
+	r.db.dispatchedJobs = append(r.db.dispatchedJobs, dJob)
+	return nil
+}
+
+// UpdateDispatchedJob replaces the dispatched job with the UUID of the provided one, and returns sql.ErrNoRows if it doesn't exist.
+func (r *RunnerCommunicatorAdapter) UpdateDispatchedJob(ctx context.Context, dJob controller.DispatchedJob) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i := r.db.dispatchedJobIndex(dJob.UUID)
+	if i == -1 {
+		return sql.ErrNoRows
+	}
+	r.db.dispatchedJobs[i] = copyDispatchedJob(dJob)
+	return nil
+}
+
+// RunnerSeen updates the last seen time and version of the named Runner, creating it if it doesn't exist.
+func (r *RunnerCommunicatorAdapter) RunnerSeen(ctx context.Context, name, version string, t time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for i, v := range r.db.runners {
+		if v.Name == name {
+			r.db.runners[i].LastSeen = t
+			if version != "" {
+				r.db.runners[i].Version = version
+			}
+			return nil
+		}
+	}
+
+	r.db.runners = append(r.db.runners, controller.Runner{
+		UUID:        controller.UUID(uuid.NewString()),
+		Name:        name,
+		DisplayName: name,
+		Version:     version,
+		LastSeen:    t,
+	})
+	return nil
+}
+
+// RecordRunnerResult increments either the completed or failed job counter of the named Runner.
+func (r *RunnerCommunicatorAdapter) RecordRunnerResult(ctx context.Context, name string, failed bool) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for i, v := range r.db.runners {
+		if v.Name == name {
+			if failed {
+				r.db.runners[i].JobsFailed++
+			} else {
+				r.db.runners[i].JobsCompleted++
+			}
+			return nil
+		}
+	}
+	return nil
+}
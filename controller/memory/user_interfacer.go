@@ -0,0 +1,466 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// NewUserInterfacerAdapter returns an instantiated UserInterfacerAdapter.
+func NewUserInterfacerAdapter(db *Database) UserInterfacerAdapter {
+	return UserInterfacerAdapter{db: db}
+}
+
+// UserInterfacerAdapter is a struct that satisfies the interface that connects a UserInterfacer
+// to a storage medium.
+type UserInterfacerAdapter struct {
+	db *Database
+}
+
+// DispatchedJobs returns all of the dispatched jobs.
+func (u *UserInterfacerAdapter) DispatchedJobs(ctx context.Context) ([]controller.DispatchedJob, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	returnSlice := make([]controller.DispatchedJob, 0, len(u.db.dispatchedJobs))
+	for _, v := range u.db.dispatchedJobs {
+		returnSlice = append(returnSlice, copyDispatchedJob(v))
+	}
+	return returnSlice, nil
+}
+
+// HistoryEntries returns all of the history entries in the order they were added.
+func (u *UserInterfacerAdapter) HistoryEntries(ctx context.Context) ([]controller.History, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	returnSlice := make([]controller.History, 0, len(u.db.history))
+	for _, v := range u.db.history {
+		returnSlice = append(returnSlice, copyHistory(v))
+	}
+	return returnSlice, nil
+}
+
+// HistoryEntry returns the history entry with the provided job UUID.
+func (u *UserInterfacerAdapter) HistoryEntry(ctx context.Context, uuid controller.UUID) (controller.History, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	for _, v := range u.db.history {
+		if v.UUID == uuid {
+			return copyHistory(v), nil
+		}
+	}
+	return controller.History{}, sql.ErrNoRows
+}
+
+// HistoryEntryByOriginalPath returns the newest history entry whose original file was kept at the provided path.
+func (u *UserInterfacerAdapter) HistoryEntryByOriginalPath(ctx context.Context, path string) (controller.History, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	found := -1
+	for i, v := range u.db.history {
+		if v.OriginalPath == path && (found == -1 || v.DateTimeCompleted.After(u.db.history[found].DateTimeCompleted)) {
+			found = i
+		}
+	}
+	if found == -1 {
+		return controller.History{}, sql.ErrNoRows
+	}
+	return copyHistory(u.db.history[found]), nil
+}
+
+// MarkOriginalRestored sets OriginalRestored on the history entry with the provided job UUID.
+func (u *UserInterfacerAdapter) MarkOriginalRestored(ctx context.Context, uuid controller.UUID) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	for i, v := range u.db.history {
+		if v.UUID == uuid {
+			u.db.history[i].OriginalRestored = true
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// DeleteLibrary marks the specified library as deleted at t. Its version is incremented so that saves which
+// started before the deletion conflict instead of succeeding.
+func (u *UserInterfacerAdapter) DeleteLibrary(ctx context.Context, id int, t time.Time) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	u.db.deleteLibrary(id, t)
+	return nil
+}
+
+// DeletedLibraries returns the libraries which are marked as deleted, sorted by ID.
+func (u *UserInterfacerAdapter) DeletedLibraries(ctx context.Context) ([]controller.Library, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	returnSlice := make([]controller.Library, 0)
+	for _, v := range u.db.libraries {
+		if !v.DeletedAt.IsZero() {
+			returnSlice = append(returnSlice, copyLibrary(v))
+		}
+	}
+	sort.Slice(returnSlice, func(i, j int) bool { return returnSlice[i].ID < returnSlice[j].ID })
+
+	return returnSlice, nil
+}
+
+// RestoreLibrary clears the deleted mark of the specified library.
+func (u *UserInterfacerAdapter) RestoreLibrary(ctx context.Context, id int) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	return u.db.restoreLibrary(id)
+}
+
+// ImportLibraries saves the provided libraries while keeping the queues of the ones which already exist.
+// The lock is held for the whole import, so it is applied atomically.
+func (u *UserInterfacerAdapter) ImportLibraries(ctx context.Context, libs []controller.Library) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	for _, lib := range libs {
+		lib = copyLibrary(lib)
+		lib.Version = 1
+		if existing, ok := u.db.libraries[lib.ID]; ok {
+			lib.Queue = existing.Queue
+			lib.Version = existing.Version + 1
+		}
+		lib.DeletedAt = time.Time{}
+		u.db.libraries[lib.ID] = lib
+	}
+	return nil
+}
+
+// ImportFileStates saves the provided processed modtimes and quarantines the provided jobs.
+func (u *UserInterfacerAdapter) ImportFileStates(ctx context.Context, processed map[string]time.Time, quarantined []controller.QuarantinedJob) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	for path, t := range processed {
+		u.db.processed[path] = t
+	}
+	for _, q := range quarantined {
+		q.Job = copyJob(q.Job)
+		u.db.quarantined[q.Job.Path] = q
+	}
+	return nil
+}
+
+// ClearQuarantine takes the provided path out of quarantine and resets its attempt counter.
+func (u *UserInterfacerAdapter) ClearQuarantine(ctx context.Context, path string) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	if _, ok := u.db.quarantined[path]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(u.db.quarantined, path)
+	delete(u.db.attempts, path)
+	return nil
+}
+
+// SkipPaths skips the provided paths. Paths which are already skipped keep the time that they were first skipped.
+func (u *UserInterfacerAdapter) SkipPaths(ctx context.Context, skipped []controller.SkippedPath) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	for _, s := range skipped {
+		if _, ok := u.db.skipped[s.Path]; !ok {
+			u.db.skipped[s.Path] = s.DateTimeSkipped
+		}
+	}
+	return nil
+}
+
+// SkippedPaths returns the skipped paths, sorted by path.
+func (u *UserInterfacerAdapter) SkippedPaths(ctx context.Context) ([]controller.SkippedPath, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	skipped := make([]controller.SkippedPath, 0, len(u.db.skipped))
+	for path, t := range u.db.skipped {
+		skipped = append(skipped, controller.SkippedPath{Path: path, DateTimeSkipped: t})
+	}
+	sort.Slice(skipped, func(i, j int) bool { return skipped[i].Path < skipped[j].Path })
+	return skipped, nil
+}
+
+// UnskipPath removes the provided path from the skipped paths.
+func (u *UserInterfacerAdapter) UnskipPath(ctx context.Context, path string) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	if _, ok := u.db.skipped[path]; !ok {
+		return sql.ErrNoRows
+	}
+
+	delete(u.db.skipped, path)
+	return nil
+}
+
+// BenchmarkResults returns the benchmark results of the provided path, or of every path if it is empty, newest first.
+func (u *UserInterfacerAdapter) BenchmarkResults(ctx context.Context, path string) ([]controller.BenchmarkResult, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	results := make([]controller.BenchmarkResult, 0)
+	for _, r := range u.db.benchmarks {
+		if path == "" || r.Path == path {
+			results = append(results, copyBenchmarkResult(r))
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].DateTimeCompleted.After(results[j].DateTimeCompleted) })
+	return results, nil
+}
+
+// Runners returns all of the Runners in the order they were first seen.
+func (u *UserInterfacerAdapter) Runners(ctx context.Context) ([]controller.Runner, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	return append(make([]controller.Runner, 0, len(u.db.runners)), u.db.runners...), nil
+}
+
+// RenameRunner changes the display name of the specified Runner.
+func (u *UserInterfacerAdapter) RenameRunner(ctx context.Context, uuid controller.UUID, displayName string) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	for i, v := range u.db.runners {
+		if v.UUID == uuid {
+			u.db.runners[i].DisplayName = displayName
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// DeleteRunner deletes the specified Runner.
+func (u *UserInterfacerAdapter) DeleteRunner(ctx context.Context, uuid controller.UUID) error {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	for i, v := range u.db.runners {
+		if v.UUID == uuid {
+			u.db.runners = append(u.db.runners[:i], u.db.runners[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// DeleteStaleRunners deletes every Runner which was last seen before notSeenSince.
+func (u *UserInterfacerAdapter) DeleteStaleRunners(ctx context.Context, notSeenSince time.Time) (int, error) {
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	kept := make([]controller.Runner, 0, len(u.db.runners))
+	for _, v := range u.db.runners {
+		if !v.LastSeen.Before(notSeenSince) {
+			kept = append(kept, v)
+		}
+	}
+
+	deleted := len(u.db.runners) - len(kept)
+	u.db.runners = kept
+	return deleted, nil
+}
+
+// QueryFileSnapshots counts the file snapshots of libraries which aren't deleted that match filter and returns
+// the paths of up to limit of them in path order.
+func (u *UserInterfacerAdapter) QueryFileSnapshots(ctx context.Context, filter controller.FileSnapshotFilter, limit int) ([]string, int, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	matched := make([]string, 0)
+	for path, snapshot := range u.db.snapshots {
+		if lib, ok := u.db.libraries[snapshot.LibraryID]; ok && lib.DeletedAt.IsZero() && snapshotMatches(snapshot, filter) {
+			matched = append(matched, path)
+		}
+	}
+	sort.Strings(matched)
+
+	if len(matched) > limit {
+		return matched[:limit], len(matched), nil
+	}
+	return matched, len(matched), nil
+}
+
+// snapshotMatches returns whether or not s is selected by every field of filter.
+func snapshotMatches(s controller.FileSnapshot, filter controller.FileSnapshotFilter) bool {
+	switch {
+	case filter.LibraryID != nil && s.LibraryID != *filter.LibraryID:
+		return false
+	case filter.VideoCodec != "" && !strings.EqualFold(s.VideoCodec, filter.VideoCodec):
+		return false
+	case filter.Container != "" && !strings.EqualFold(s.Container, filter.Container):
+		return false
+	case filter.HDR != nil && s.HDR != *filter.HDR:
+		return false
+	case filter.MinHeight > 0 && s.Height < filter.MinHeight, filter.MaxHeight > 0 && s.Height > filter.MaxHeight:
+		return false
+	case filter.MinSize > 0 && s.Size < filter.MinSize, filter.MaxSize > 0 && s.Size > filter.MaxSize:
+		return false
+	case filter.MinDuration > 0 && s.Duration < filter.MinDuration, filter.MaxDuration > 0 && s.Duration > filter.MaxDuration:
+		return false
+	}
+	return true
+}
+
+// SearchFiles finds files in the library queues, dispatched jobs, and history whose path matches pattern, ignoring case.
+// If pattern contains a '*' or '?', it is treated as a glob against the whole path. Otherwise, it is treated as a substring.
+func (u *UserInterfacerAdapter) SearchFiles(ctx context.Context, pattern string, limit int) ([]controller.SearchResult, bool, error) {
+	match, err := pathMatcher(pattern)
+	if err != nil {
+		return nil, false, err
+	}
+
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	results := make([]controller.SearchResult, 0)
+
+	// Collect one more than the limit so that we know if more results are available.
+	full := func() bool { return len(results) > limit }
+
+	// Library queues
+	ids := make([]int, 0, len(u.db.libraries))
+	for id, lib := range u.db.libraries {
+		if lib.DeletedAt.IsZero() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		for _, j := range u.db.libraries[id].Queue.Items {
+			if !full() && match(j.Path) {
+				results = append(results, controller.SearchResult{Location: "queue", LibraryID: id, UUID: j.UUID, Path: j.Path, State: "queued"})
+			}
+		}
+	}
+
+	// Dispatched jobs
+	for _, d := range u.db.dispatchedJobs {
+		if !full() && match(d.Job.Path) {
+			state := d.Status.Stage
+			if state == "" {
+				state = "dispatched"
+			}
+			results = append(results, controller.SearchResult{Location: "dispatched", LibraryID: d.Job.LibraryID, UUID: d.UUID, Path: d.Job.Path, State: state})
+		}
+	}
+
+	// History, newest first
+	history := append([]controller.History{}, u.db.history...)
+	sort.SliceStable(history, func(i, j int) bool { return history[i].DateTimeCompleted.After(history[j].DateTimeCompleted) })
+
+	for _, h := range history {
+		if !full() && match(h.Filename) {
+			state := "completed"
+			if len(h.Errors) > 0 {
+				state = "failed"
+			}
+			// Entries recorded without the job details don't have a job, so their library isn't known.
+			libraryID := -1
+			if h.Job.UUID != "" {
+				libraryID = h.Job.LibraryID
+			}
+			results = append(results, controller.SearchResult{Location: "history", LibraryID: libraryID, UUID: h.UUID, Path: h.Filename, State: state})
+		}
+	}
+
+	if len(results) > limit {
+		return results[:limit], true, nil
+	}
+	return results, false, nil
+}
+
+// pathMatcher returns a function that reports whether a path matches the provided substring or glob pattern, ignoring case.
+func pathMatcher(pattern string) (func(string) bool, error) {
+	if !strings.ContainsAny(pattern, "*?") {
+		lowerPattern := strings.ToLower(pattern)
+		return func(path string) bool {
+			return strings.Contains(strings.ToLower(path), lowerPattern)
+		}, nil
+	}
+
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
+// Backup always returns controller.ErrBackupNotSupported because there is no database to back up.
+func (u *UserInterfacerAdapter) Backup(w io.Writer) error {
+	return controller.ErrBackupNotSupported
+}
+
+// HealthCheckActions returns up to limit of the most recent health checker actions, newest first.
+func (u *UserInterfacerAdapter) HealthCheckActions(ctx context.Context, limit int) ([]controller.HealthCheckAction, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	actions := append(make([]controller.HealthCheckAction, 0, len(u.db.healthCheckActions)), u.db.healthCheckActions...)
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].Time.After(actions[j].Time) })
+	if len(actions) > limit {
+		actions = actions[:limit]
+	}
+	return actions, nil
+}
+
+// HealthCheckActionCounts returns how many times the health checker has taken each action.
+func (u *UserInterfacerAdapter) HealthCheckActionCounts(ctx context.Context) (map[controller.StaleJobAction]int, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	counts := make(map[controller.StaleJobAction]int)
+	for _, v := range u.db.healthCheckActions {
+		counts[v.Action]++
+	}
+	return counts, nil
+}
+
+// JobEvents returns the events of the job with the provided UUID, oldest first.
+func (u *UserInterfacerAdapter) JobEvents(ctx context.Context, uuid controller.UUID) ([]controller.JobEvent, error) {
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	events := make([]controller.JobEvent, 0)
+	for _, v := range u.db.jobEvents {
+		if v.JobUUID == uuid {
+			events = append(events, v)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, nil
+}
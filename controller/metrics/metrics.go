@@ -0,0 +1,241 @@
+// Package metrics provides a metrics collector which exposes its metrics in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// New returns an instantiated Collector.
+func New() *Collector {
+	return &Collector{
+		counters:   make(map[string]*counter),
+		histograms: make(map[string]*histogram),
+	}
+}
+
+// Collector satisfies the controller.MetricsCollector interface. It also satisfies http.Handler,
+// which serves the collected metrics in the Prometheus text format.
+// Counters and histograms share a namespace, so a name should only be used for one of them.
+type Collector struct {
+	mu         sync.Mutex
+	counters   map[string]*counter
+	histograms map[string]*histogram
+
+	// batchMu is held by Batch for reading and by Snapshot for writing, so that a snapshot is never taken in the
+	// middle of a batch. Single updates don't need it because each metric is updated atomically.
+	batchMu sync.RWMutex
+}
+
+// Counter returns the named counter, registering it with the provided help text if it doesn't exist yet.
+func (c *Collector) Counter(name, help string) controller.Counter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.counters[name]; ok {
+		return v
+	}
+
+	v := &counter{help: help}
+	c.counters[name] = v
+	return v
+}
+
+// Histogram returns the named histogram, registering it with the provided help text and bucket upper bounds
+// if it doesn't exist yet. The buckets are sorted, and a +Inf bucket is always included.
+func (c *Collector) Histogram(name, help string, buckets []float64) controller.Histogram {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.histograms[name]; ok {
+		return v
+	}
+
+	bounds := append([]float64{}, buckets...)
+	sort.Float64s(bounds)
+	if len(bounds) == 0 || !math.IsInf(bounds[len(bounds)-1], 1) {
+		bounds = append(bounds, math.Inf(1))
+	}
+
+	v := &histogram{help: help, bounds: bounds, counts: make([]uint64, len(bounds))}
+	c.histograms[name] = v
+	return v
+}
+
+// Batch runs f, which updates several metrics that belong together, so that a snapshot sees all or none of its updates.
+// f must not call Batch or Snapshot.
+func (c *Collector) Batch(f func()) {
+	c.batchMu.RLock()
+	defer c.batchMu.RUnlock()
+	f()
+}
+
+// Snapshot returns the values of every metric. No metrics are updated while it is taken, so they are all from the
+// same point in time and never include part of a batch.
+func (c *Collector) Snapshot() controller.MetricsSnapshot {
+	c.batchMu.Lock()
+	defer c.batchMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := controller.MetricsSnapshot{
+		Time:       time.Now(),
+		Counters:   make(map[string]float64, len(c.counters)),
+		Histograms: make(map[string]controller.HistogramSnapshot, len(c.histograms)),
+	}
+	for name, v := range c.counters {
+		s.Counters[name] = v.snapshot()
+	}
+	for name, v := range c.histograms {
+		s.Histograms[name] = v.snapshot()
+	}
+	return s
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WritePrometheus(w)
+}
+
+// WritePrometheus writes every metric to w in the Prometheus text format, sorted by name.
+func (c *Collector) WritePrometheus(w io.Writer) error {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.counters)+len(c.histograms))
+	for name := range c.counters {
+		names = append(names, name)
+	}
+	for name := range c.histograms {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		c.mu.Lock()
+		cnt, isCounter := c.counters[name]
+		hist := c.histograms[name]
+		c.mu.Unlock()
+
+		var err error
+		if isCounter {
+			err = cnt.write(w, name)
+		} else {
+			err = hist.write(w, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type counter struct {
+	mu    sync.Mutex
+	help  string
+	value float64
+}
+
+func (c *counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value += delta
+}
+
+func (c *counter) write(w io.Writer, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v counter\n%v %v\n", name, c.help, name, name, formatFloat(c.value))
+	return err
+}
+
+func (c *counter) snapshot() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+type histogram struct {
+	mu     sync.Mutex
+	help   string
+	bounds []float64
+	counts []uint64 // counts[i] is the number of observations in the bucket with the upper bound bounds[i], but not the ones below it.
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (h *histogram) snapshot() controller.HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := controller.HistogramSnapshot{Buckets: make([]controller.HistogramBucket, 0, len(h.bounds)), Sum: h.sum, Count: h.count}
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		if !math.IsInf(bound, 1) {
+			s.Buckets = append(s.Buckets, controller.HistogramBucket{UpperBound: bound, Count: cumulative})
+		}
+	}
+	return s
+}
+
+func (h *histogram) write(w io.Writer, name string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v histogram\n", name, h.help, name); err != nil {
+		return err
+	}
+
+	// Prometheus buckets are cumulative
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		if _, err := fmt.Fprintf(w, "%v_bucket{le=\"%v\"} %v\n", name, formatFloat(bound), cumulative); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%v_sum %v\n%v_count %v\n", name, formatFloat(h.sum), name, h.count)
+	return err
+}
+
+// formatFloat formats f the way that the Prometheus text format expects.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
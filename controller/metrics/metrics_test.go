@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	c := New()
+
+	read := c.Counter("encodarr_bytes_read_total", "Total bytes read.")
+	read.Add(1500)
+	read.Add(-20) // Ignored because counters can't go down
+	c.Counter("encodarr_bytes_read_total", "Registering again returns the same counter.").Add(500)
+
+	ratio := c.Histogram("encodarr_ratio", "Ratios.", []float64{0.5, 0.25})
+	ratio.Observe(0.1)
+	ratio.Observe(0.3)
+	ratio.Observe(0.9)
+
+	expected := `# HELP encodarr_bytes_read_total Total bytes read.
+# TYPE encodarr_bytes_read_total counter
+encodarr_bytes_read_total 2000
+# HELP encodarr_ratio Ratios.
+# TYPE encodarr_ratio histogram
+encodarr_ratio_bucket{le="0.25"} 1
+encodarr_ratio_bucket{le="0.5"} 2
+encodarr_ratio_bucket{le="+Inf"} 3
+encodarr_ratio_sum 1.3
+encodarr_ratio_count 3
+`
+
+	var b bytes.Buffer
+	if err := c.WritePrometheus(&b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if b.String() != expected {
+		t.Errorf("expected:\n%v\nbut got:\n%v", expected, b.String())
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	c := New()
+
+	c.Counter("encodarr_bytes_read_total", "Total bytes read.").Add(2000)
+	ratio := c.Histogram("encodarr_ratio", "Ratios.", []float64{0.5, 0.25})
+	ratio.Observe(0.1)
+	ratio.Observe(0.3)
+	ratio.Observe(0.9)
+
+	s := c.Snapshot()
+
+	if s.Time.IsZero() {
+		t.Errorf("expected the time of the snapshot to be set")
+	}
+	if s.Counters["encodarr_bytes_read_total"] != 2000 {
+		t.Errorf("expected the counter to be 2000 but got %v", s.Counters["encodarr_bytes_read_total"])
+	}
+
+	expected := controller.HistogramSnapshot{
+		Buckets: []controller.HistogramBucket{{UpperBound: 0.25, Count: 1}, {UpperBound: 0.5, Count: 2}},
+		Sum:     1.3,
+		Count:   3,
+	}
+	if !reflect.DeepEqual(s.Histograms["encodarr_ratio"], expected) {
+		t.Errorf("expected the histogram %+v but got %+v", expected, s.Histograms["encodarr_ratio"])
+	}
+
+	// The +Inf bucket is left out so that the snapshot can be marshaled
+	if _, err := json.Marshal(s); err != nil {
+		t.Errorf("unexpected error marshaling the snapshot: %v", err)
+	}
+}
+
+func TestSnapshotDuringBatches(t *testing.T) {
+	c := New()
+	jobs := c.Counter("encodarr_jobs_total", "Jobs.")
+	read := c.Counter("encodarr_bytes_read_total", "Bytes read.")
+	sizes := c.Histogram("encodarr_sizes", "Sizes.", []float64{1, 2})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				c.Batch(func() {
+					jobs.Add(1)
+					read.Add(2)
+					sizes.Observe(2)
+				})
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		s := c.Snapshot()
+		n := s.Counters["encodarr_jobs_total"]
+		if s.Counters["encodarr_bytes_read_total"] != 2*n || float64(s.Histograms["encodarr_sizes"].Count) != n {
+			t.Fatalf("expected a consistent snapshot but got %v jobs, %v bytes, and %v observations", n, s.Counters["encodarr_bytes_read_total"], s.Histograms["encodarr_sizes"].Count)
+		}
+	}
+	wg.Wait()
+
+	if s := c.Snapshot(); s.Counters["encodarr_jobs_total"] != 2000 {
+		t.Errorf("expected 2000 jobs after every batch but got %v", s.Counters["encodarr_jobs_total"])
+	}
+}
@@ -3,31 +3,55 @@ package controller
 import (
 	"context"
 	"sync"
+	"time"
 )
 
 type mockHealthChecker struct {
-	runCalled   bool
-	startCalled bool
+	runCalled                   bool
+	leaseDurationCalled         bool
+	checkRunnersAvailableCalled bool
+	startCalled                 bool
 }
 
-func (m *mockHealthChecker) Start(ctx *context.Context) {
+func (m *mockHealthChecker) Start(ctx context.Context) {
 	m.startCalled = true
 }
 
-func (m *mockHealthChecker) Run() (uuidsToNull []UUID) {
+func (m *mockHealthChecker) Run() (staleJobs []StaleJob) {
 	m.runCalled = true
 	return
 }
 
+func (m *mockHealthChecker) LeaseDuration(int) time.Duration {
+	m.leaseDurationCalled = true
+	return time.Hour
+}
+
+func (m *mockHealthChecker) CheckRunnersAvailable(bool) (t time.Time) {
+	m.checkRunnersAvailableCalled = true
+	return
+}
+
 type mockLibraryManager struct {
 	importCalled            bool
 	libSettingsCalled       bool
 	popJobCalled            bool
 	updateLibSettingsCalled bool
+	scanLibrariesCalled     bool
+	scanningLibsCalled      bool
+	awaitingSpaceCalled     bool
+	metricsSnapshotCalled   bool
+	requeueLibraryCalled    bool
+	handleStaleJobsCalled   bool
+	healthCalled            bool
+	dispatchPlanCalled      bool
+	queueBenchmarksCalled   bool
+	popBenchmarkCalled      bool
+	stagedFilesCalled       bool
 	startCalled             bool
 }
 
-func (m *mockLibraryManager) Start(ctx *context.Context, wg *sync.WaitGroup) {
+func (m *mockLibraryManager) Start(ctx context.Context, wg *sync.WaitGroup) {
 	m.startCalled = true
 }
 
@@ -49,16 +73,69 @@ func (m *mockLibraryManager) UpdateLibrarySettings(map[int]Library) {
 	m.updateLibSettingsCalled = true
 }
 
+func (m *mockLibraryManager) ScanLibraries([]int) {
+	m.scanLibrariesCalled = true
+}
+
+func (m *mockLibraryManager) ScanningLibraries() (ids []int) {
+	m.scanningLibsCalled = true
+	return
+}
+
+func (m *mockLibraryManager) AwaitingSpaceJobs() (jobs []Job) {
+	m.awaitingSpaceCalled = true
+	return
+}
+
+func (m *mockLibraryManager) StagedFiles() (files []string) {
+	m.stagedFilesCalled = true
+	return
+}
+
+func (m *mockLibraryManager) MetricsSnapshot() (s MetricsSnapshot) {
+	m.metricsSnapshotCalled = true
+	return
+}
+
+func (m *mockLibraryManager) RequeueLibrary(int) error {
+	m.requeueLibraryCalled = true
+	return nil
+}
+
+func (m *mockLibraryManager) HandleStaleJobs([]StaleJob) {
+	m.handleStaleJobsCalled = true
+}
+
+func (m *mockLibraryManager) Health() (h DatastoreHealth) {
+	m.healthCalled = true
+	return
+}
+
+func (m *mockLibraryManager) DispatchPlan() (p DispatchPlan) {
+	m.dispatchPlanCalled = true
+	return
+}
+
+func (m *mockLibraryManager) QueueBenchmarks([]BenchmarkRequest) {
+	m.queueBenchmarksCalled = true
+}
+
+func (m *mockLibraryManager) PopBenchmarkJob([]string) (Job, error) {
+	m.popBenchmarkCalled = true
+	return Job{}, ErrNoJobAvailable
+}
+
 type mockRunnerCommunicator struct {
 	completedJobsCalled  bool
 	newJobCalled         bool
 	needNewJobCalled     bool
 	nullUUIDsCalled      bool
 	waitingRunnersCalled bool
+	cleanStagingCalled   bool
 	startCalled          bool
 }
 
-func (m *mockRunnerCommunicator) Start(ctx *context.Context, wg *sync.WaitGroup) {
+func (m *mockRunnerCommunicator) Start(ctx context.Context, wg *sync.WaitGroup) {
 	m.startCalled = true
 }
 
@@ -67,7 +144,7 @@ func (m *mockRunnerCommunicator) CompletedJobs() (j []CompletedJob) {
 	return
 }
 
-func (m *mockRunnerCommunicator) NewJob(Job) {
+func (m *mockRunnerCommunicator) NewJob(Job, time.Duration) {
 	m.newJobCalled = true
 }
 
@@ -86,14 +163,27 @@ func (m *mockRunnerCommunicator) WaitingRunners() (runnerNames []string) {
 	return
 }
 
-type mockUserInterfacer struct {
-	newLibSettingsCalled    bool
-	setLibSettingsCalled    bool
-	setWaitingRunnersCalled bool
-	startCalled             bool
+func (m *mockRunnerCommunicator) CleanStaging([]string) {
+	m.cleanStagingCalled = true
 }
 
-func (m *mockUserInterfacer) Start(ctx *context.Context, wg *sync.WaitGroup) {
+type mockUserInterfacer struct {
+	newLibSettingsCalled     bool
+	setLibSettingsCalled     bool
+	setWaitingRunnersCalled  bool
+	scanRequestsCalled       bool
+	setScanningLibsCalled    bool
+	setAwaitingSpaceCalled   bool
+	requeueRequestsCalled    bool
+	setNoRunnersSinceCalled  bool
+	setMetricsSnapshotCalled bool
+	setDatastoreHealthCalled bool
+	setDispatchPlanCalled    bool
+	benchmarkRequestsCalled  bool
+	startCalled              bool
+}
+
+func (m *mockUserInterfacer) Start(ctx context.Context, wg *sync.WaitGroup) {
 	m.startCalled = true
 }
 
@@ -110,6 +200,46 @@ func (m *mockUserInterfacer) SetWaitingRunners(runnerNames []string) {
 	m.setWaitingRunnersCalled = true
 }
 
+func (m *mockUserInterfacer) ScanRequests() (ids []int) {
+	m.scanRequestsCalled = true
+	return
+}
+
+func (m *mockUserInterfacer) RequeueRequests() (ids []int) {
+	m.requeueRequestsCalled = true
+	ids = append(ids, 1)
+	return
+}
+
+func (m *mockUserInterfacer) SetScanningLibraries([]int) {
+	m.setScanningLibsCalled = true
+}
+
+func (m *mockUserInterfacer) SetAwaitingSpaceJobs([]Job) {
+	m.setAwaitingSpaceCalled = true
+}
+
+func (m *mockUserInterfacer) SetNoRunnersSince(time.Time) {
+	m.setNoRunnersSinceCalled = true
+}
+
+func (m *mockUserInterfacer) SetMetricsSnapshot(MetricsSnapshot) {
+	m.setMetricsSnapshotCalled = true
+}
+
+func (m *mockUserInterfacer) SetDatastoreHealth(DatastoreHealth) {
+	m.setDatastoreHealthCalled = true
+}
+
+func (m *mockUserInterfacer) SetDispatchPlan(DispatchPlan) {
+	m.setDispatchPlanCalled = true
+}
+
+func (m *mockUserInterfacer) BenchmarkRequests() (r []BenchmarkRequest) {
+	m.benchmarkRequestsCalled = true
+	return
+}
+
 type mockLogger struct{}
 
 func (m *mockLogger) Trace(s string, i ...interface{})    {}
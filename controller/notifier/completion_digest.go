@@ -0,0 +1,136 @@
+package notifier
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// maxDigestPaths is how many paths the message of a job_completion_digest lists before the rest are only counted.
+const maxDigestPaths = 20
+
+// ParseCompletionDigest returns the window of the CompletionDigest of a channel. An empty CompletionDigest returns 0.
+func ParseCompletionDigest(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	window, err := time.ParseDuration(s)
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("invalid completion_digest '%v': it must be a positive duration like 15m", s)
+	}
+	return window, nil
+}
+
+// completionBatches holds the job_completed events of the channels with a CompletionDigest until their windows end.
+type completionBatches struct {
+	mu      *sync.Mutex
+	batches map[string]*completionBatch
+}
+
+// completionBatch is the events which are waiting to be summarized for a channel.
+type completionBatch struct {
+	channel controller.NotificationChannel
+	url     string // The URL of a library's webhook. It is empty for the global channels.
+	since   time.Time
+	ends    time.Time
+	events  []controller.Event
+}
+
+// add batches e for the channel c, which is a webhook of a library if url is set, and returns whether it did.
+// Events aren't batched for channels without a valid CompletionDigest.
+func (b *completionBatches) add(c controller.NotificationChannel, url string, e controller.Event, now time.Time) bool {
+	window, err := ParseCompletionDigest(c.CompletionDigest)
+	if err != nil || window == 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := c.Name + "\x00" + url
+	batch, ok := b.batches[key]
+	if !ok {
+		batch = &completionBatch{channel: c, url: url, since: now, ends: now.Add(window)}
+		b.batches[key] = batch
+	}
+	batch.events = append(batch.events, e)
+	return true
+}
+
+// due removes and returns the batches whose window ended at or before now.
+func (b *completionBatches) due(now time.Time) []*completionBatch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	due := []*completionBatch{}
+	for key, batch := range b.batches {
+		if !batch.ends.After(now) {
+			due = append(due, batch)
+			delete(b.batches, key)
+		}
+	}
+	return due
+}
+
+// flushCompletions queues a job_completion_digest for each channel whose batch is due.
+func (d *Dispatcher) flushCompletions() {
+	for _, batch := range d.completions.due(d.now()) {
+		e := completionDigestEvent(batch.since, batch.events, d.now())
+
+		var dl delivery
+		var err error
+		if batch.url == "" {
+			dl, err = d.prepare(batch.channel, e)
+		} else {
+			dl, err = d.prepareWebhook(batch.channel, batch.url, e)
+		}
+		if err != nil {
+			d.logger.Warn("Not sending the %v event to the %v notification channel: %v", e.Type, batch.channel.Name, err)
+			continue
+		}
+
+		d.logger.Debug("Sending a digest of %v completed jobs to the %v notification channel", len(batch.events), batch.channel.Name)
+		d.enqueue(dl)
+	}
+}
+
+// completionDigestEvent summarizes the job_completed events which were batched since the provided time.
+func completionDigestEvent(since time.Time, events []controller.Event, now time.Time) controller.Event {
+	c := controller.CompletionDigest{Since: since, Count: len(events), Jobs: make([]controller.CompletionDigestJob, 0, len(events))}
+	for _, e := range events {
+		c.BytesSaved += e.BytesSaved
+		c.Jobs = append(c.Jobs, controller.CompletionDigestJob{LibraryID: e.LibraryID, JobUUID: e.JobUUID, Path: e.Path, BytesSaved: e.BytesSaved})
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Since %v, %v jobs were completed, saving %v", since.Format("2006-01-02 15:04"), c.Count, formatBytes(c.BytesSaved))
+	for i, j := range c.Jobs {
+		if i == maxDigestPaths {
+			fmt.Fprintf(&b, "\nand %v more", len(c.Jobs)-maxDigestPaths)
+			break
+		}
+		fmt.Fprintf(&b, "\n%v", j.Path)
+	}
+
+	e := controller.Event{
+		Type:        controller.EventJobCompletionDigest,
+		Message:     b.String(),
+		Time:        now,
+		BytesSaved:  c.BytesSaved,
+		Completions: &c,
+	}
+	// A digest is about a library if all of its jobs are, like the digests of the webhooks of a library
+	if len(c.Jobs) > 0 {
+		e.LibraryID = c.Jobs[0].LibraryID
+		for _, j := range c.Jobs {
+			if j.LibraryID != e.LibraryID {
+				e.LibraryID = 0
+				break
+			}
+		}
+	}
+	return e
+}
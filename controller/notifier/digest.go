@@ -0,0 +1,153 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// weekdays maps the lowercase names of the days of the week that a weekly digest can be sent on to their time.Weekday.
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// ParseDigestSchedule returns the time of day and, for a weekly digest, the day of the week of the provided settings.
+// weekly is false if weekday is empty.
+func ParseDigestSchedule(timeOfDay, weekday string) (t time.Time, day time.Weekday, weekly bool, err error) {
+	if t, err = time.Parse("15:04", timeOfDay); err != nil {
+		return t, day, false, fmt.Errorf("invalid digest_time '%v': it must be a time of day like 08:00", timeOfDay)
+	}
+	if weekday == "" {
+		return t, day, false, nil
+	}
+	if day, weekly = weekdays[strings.ToLower(weekday)]; !weekly {
+		return t, day, false, fmt.Errorf("invalid digest_weekday '%v': it must be the name of a day like monday", weekday)
+	}
+	return t, day, true, nil
+}
+
+// digest tallies the completed and failed jobs since the last digest.
+type digest struct {
+	mu *sync.Mutex
+
+	// since is when the tally started, and last is when the last digest was emitted.
+	since time.Time
+	last  time.Time
+
+	completed  int
+	failed     int
+	bytesSaved int64
+}
+
+// start begins the first tally at now. A digest which was due before now isn't emitted.
+func (g *digest) start(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.since, g.last = now, now
+}
+
+// record adds e to the tally if it is about a job.
+func (g *digest) record(e controller.Event) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch e.Type {
+	case controller.EventJobCompleted:
+		g.completed++
+		g.bytesSaved += e.BytesSaved
+	case controller.EventJobFailed:
+		g.failed++
+	}
+}
+
+// due returns the tally and starts a new one if the digest has been due since the last digest.
+// The digest is due every day at timeOfDay, or only on weekday if it is set.
+func (g *digest) due(now time.Time, timeOfDay, weekday string) (controller.DigestSummary, bool) {
+	if timeOfDay == "" {
+		return controller.DigestSummary{}, false
+	}
+	t, day, weekly, err := ParseDigestSchedule(timeOfDay, weekday)
+	if err != nil {
+		return controller.DigestSummary{}, false
+	}
+
+	// The most recent time that the digest was due at
+	at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	for at.After(now) || (weekly && at.Weekday() != day) {
+		at = at.AddDate(0, 0, -1)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.last.Before(at) {
+		return controller.DigestSummary{}, false
+	}
+
+	s := controller.DigestSummary{Period: "daily", Since: g.since, Completed: g.completed, Failed: g.failed, BytesSaved: g.bytesSaved}
+	if weekly {
+		s.Period = "weekly"
+	}
+	g.since, g.last = now, now
+	g.completed, g.failed, g.bytesSaved = 0, 0, 0
+	return s, true
+}
+
+// checkDigest emits the digest if it is due.
+func (d *Dispatcher) checkDigest(ctx context.Context) {
+	n := d.ss.Notifications()
+	s, ok := d.digest.due(d.now(), n.DigestTime, n.DigestWeekday)
+	if !ok {
+		return
+	}
+	d.addQueueStatus(ctx, &s)
+
+	message := fmt.Sprintf("Since %v, %v jobs were completed and %v failed, saving %v", s.Since.Format("2006-01-02 15:04"), s.Completed, s.Failed, formatBytes(s.BytesSaved))
+	if d.lds != nil && d.uids != nil {
+		message += fmt.Sprintf(". %v jobs are queued, %v are running, and %v have been saved in total", s.Queued, s.Dispatched, formatBytes(s.TotalBytesSaved))
+	}
+
+	d.Notify(controller.Event{
+		Type:       controller.EventDailyDigest,
+		Message:    message,
+		Time:       d.now(),
+		BytesSaved: s.BytesSaved,
+		Digest:     &s,
+	})
+}
+
+// addQueueStatus fills in the queued and dispatched jobs and the savings of every completed job, if the data storers are set.
+// Whatever can't be read is left at zero, so that the digest is still sent.
+func (d *Dispatcher) addQueueStatus(ctx context.Context, s *controller.DigestSummary) {
+	if d.lds == nil || d.uids == nil {
+		return
+	}
+
+	if libs, err := d.lds.Libraries(ctx); err == nil {
+		for _, l := range libs {
+			s.Queued += len(l.Queue.Items)
+		}
+	} else {
+		d.logger.Warn("Failed to read the queues for the digest: %v", err)
+	}
+
+	if dJobs, err := d.uids.DispatchedJobs(ctx); err == nil {
+		s.Dispatched = len(dJobs)
+	} else {
+		d.logger.Warn("Failed to read the dispatched jobs for the digest: %v", err)
+	}
+
+	if history, err := d.uids.HistoryEntries(ctx); err == nil {
+		for _, h := range history {
+			if h.Completion != nil {
+				s.TotalBytesSaved += h.Completion.SavedBytes
+			}
+		}
+	} else {
+		d.logger.Warn("Failed to read the history for the digest: %v", err)
+	}
+}
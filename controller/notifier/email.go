@@ -0,0 +1,211 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// maxSubjectLength is how many characters of an event's message are used as the subject of its email.
+const maxSubjectLength = 80
+
+// digestHTML is the HTML part of digest emails, with the event as its data.
+const digestHTML = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<h2>Encodarr {{.Digest.Period}} digest</h2>
+<p>Since {{.Digest.Since.Format "2006-01-02 15:04"}}</p>
+<table cellpadding="4">
+<tr><td>Jobs completed</td><td><b>{{.Digest.Completed}}</b></td></tr>
+<tr><td>Jobs failed</td><td><b>{{.Digest.Failed}}</b></td></tr>
+<tr><td>Space saved</td><td><b>{{bytes .Digest.BytesSaved}}</b></td></tr>
+<tr><td>Jobs queued</td><td><b>{{.Digest.Queued}}</b></td></tr>
+<tr><td>Jobs running</td><td><b>{{.Digest.Dispatched}}</b></td></tr>
+<tr><td>Space saved in total</td><td><b>{{bytes .Digest.TotalBytesSaved}}</b></td></tr>
+</table>
+</body>
+</html>
+`
+
+var digestTemplate = htmltemplate.Must(htmltemplate.New("digest").Funcs(htmltemplate.FuncMap{"bytes": formatBytes}).Parse(digestHTML))
+
+// emailSender sends messages to the recipients of email channels through the SMTP server in the settings.
+type emailSender struct {
+	ss      controller.SettingsStorer
+	timeout time.Duration
+}
+
+// Send emails the text of msg to the channel's recipients. Digests also get an HTML part with their summary.
+// The returned errors include the SMTP server's reply, so that a test notification shows why it wasn't sent.
+func (s *emailSender) Send(ctx context.Context, msg Message) error {
+	n := s.ss.Notifications()
+	if n.SMTP == nil || n.SMTP.Host == "" {
+		return errors.New("the SMTP server isn't set")
+	}
+	if len(msg.Channel.Recipients) == 0 {
+		return errors.New("the channel doesn't have any recipients")
+	}
+
+	body, err := buildEmail(*n.SMTP, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return sendMail(ctx, *n.SMTP, s.ss.Secret(controller.SecretSMTPPassword), msg.Channel.Recipients, body)
+}
+
+// sendMail delivers body to recipients through the SMTP server described by cfg.
+func sendMail(ctx context.Context, cfg controller.SMTPSettings, password string, recipients []string, body []byte) error {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address '%v': %w", cfg.From, err)
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("connecting to %v: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+	if cfg.TLS == controller.SMTPImplicitTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("connecting to %v: %w", addr, err)
+	}
+	defer c.Close()
+
+	if cfg.TLS == "" || cfg.TLS == controller.SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%v doesn't support STARTTLS", addr)
+		}
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starting TLS: %w", err)
+		}
+	}
+
+	if cfg.Username != "" {
+		if err = c.Auth(smtp.PlainAuth("", cfg.Username, password, cfg.Host)); err != nil {
+			return fmt.Errorf("authenticating as %v: %w", cfg.Username, err)
+		}
+	}
+
+	if err = c.Mail(from.Address); err != nil {
+		return fmt.Errorf("sending from %v: %w", from.Address, err)
+	}
+	for _, r := range recipients {
+		if err = c.Rcpt(r); err != nil {
+			return fmt.Errorf("sending to %v: %w", r, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("sending the message: %w", err)
+	}
+	if _, err = w.Write(body); err != nil {
+		return fmt.Errorf("sending the message: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("sending the message: %w", err)
+	}
+
+	return c.Quit()
+}
+
+// buildEmail returns the headers and body of the email for msg. It is a plain text email, unless msg is a digest,
+// in which case it also has an HTML part.
+func buildEmail(cfg controller.SMTPSettings, msg Message, now time.Time) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %v\r\n", cfg.From)
+	fmt.Fprintf(&b, "To: %v\r\n", strings.Join(msg.Channel.Recipients, ", "))
+	fmt.Fprintf(&b, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", emailSubject(msg.Event)))
+	fmt.Fprintf(&b, "Date: %v\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.Event.Digest == nil {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&b, msg.Text); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	var html bytes.Buffer
+	if err := digestTemplate.Execute(&html, msg.Event); err != nil {
+		return nil, err
+	}
+
+	mw := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%v\r\n\r\n", mw.Boundary())
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", html.String()},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(pw, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeQuotedPrintable writes s to w with the quoted-printable encoding.
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// emailSubject returns the subject of the email for e.
+func emailSubject(e controller.Event) string {
+	switch {
+	case e.Digest != nil:
+		return fmt.Sprintf("Encodarr %v digest", e.Digest.Period)
+	case e.Type == "test":
+		return "Encodarr test notification"
+	}
+
+	subject := strings.SplitN(e.Message, "\n", 2)[0]
+	if r := []rune(subject); len(r) > maxSubjectLength {
+		subject = string(r[:maxSubjectLength-1]) + "…"
+	}
+	return "Encodarr: " + subject
+}
@@ -0,0 +1,227 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// fakeSMTPServer accepts one connection at a time and records the commands and message it receives.
+// It only offers STARTTLS if startTLS is true, and rejects every login except user:password.
+type fakeSMTPServer struct {
+	listener net.Listener
+	startTLS bool
+
+	mu       sync.Mutex
+	commands []string
+	data     string
+}
+
+func newFakeSMTPServer(t *testing.T, startTLS bool) *fakeSMTPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: l, startTLS: startTLS}
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+		case "EHLO":
+			if s.startTLS {
+				reply("250-localhost")
+				reply("250-STARTTLS")
+			} else {
+				reply("250-localhost")
+			}
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			if line == "AUTH PLAIN "+base64.StdEncoding.EncodeToString([]byte("\x00user\x00password")) {
+				reply("235 2.7.0 Authentication successful")
+			} else {
+				reply("535 5.7.8 Authentication credentials invalid")
+			}
+		case "DATA":
+			reply("354 Go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				b.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = b.String()
+			s.mu.Unlock()
+			reply("250 2.0.0 OK")
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSendMail(t *testing.T) {
+	tests := []struct {
+		name             string
+		startTLS         bool
+		tls              controller.SMTPTLSMode
+		password         string
+		expectedErr      string
+		expectedCommands []string
+	}{
+		{
+			name:     "Sent",
+			tls:      controller.SMTPNoTLS,
+			password: "password",
+			expectedCommands: []string{
+				"MAIL FROM:<encodarr@example.com>",
+				"RCPT TO:<a@example.com>",
+				"RCPT TO:<b@example.com>",
+			},
+		},
+		{
+			name:        "Wrong Password",
+			tls:         controller.SMTPNoTLS,
+			password:    "wrong",
+			expectedErr: "5.7.8 Authentication credentials invalid",
+		},
+		{
+			name:        "No STARTTLS",
+			password:    "password",
+			expectedErr: "doesn't support STARTTLS",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newFakeSMTPServer(t, test.startTLS)
+			defer s.listener.Close()
+
+			cfg := controller.SMTPSettings{Host: "127.0.0.1", Port: s.port(), Username: "user", From: "Encodarr <encodarr@example.com>", TLS: test.tls}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := sendMail(ctx, cfg, test.password, []string{"a@example.com", "b@example.com"}, []byte("Subject: Hi\r\n\r\nHello\r\n"))
+			if test.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+					t.Errorf("expected an error containing %q but got %v", test.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for _, c := range test.expectedCommands {
+				if !contains(s.commands, c) {
+					t.Errorf("expected the command %q in %q", c, s.commands)
+				}
+			}
+			if s.data != "Subject: Hi\r\n\r\nHello\r\n" {
+				t.Errorf("expected the message to be sent but got %q", s.data)
+			}
+		})
+	}
+}
+
+func TestBuildEmail(t *testing.T) {
+	cfg := controller.SMTPSettings{From: "encodarr@example.com"}
+	now := time.Date(2021, time.August, 1, 8, 0, 0, 0, time.UTC)
+	channel := controller.NotificationChannel{Name: "mail", Type: controller.NotificationEmail, Recipients: []string{"a@example.com", "b@example.com"}}
+
+	b, err := buildEmail(cfg, Message{Channel: channel, Text: "Job failed: /media/Ünïcode.mkv", Event: controller.Event{Type: controller.EventJobFailed, Message: "Job failed: /media/Ünïcode.mkv"}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := string(b)
+	for _, expected := range []string{
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: =?utf-8?q?Encodarr:_Job_failed:_/media/=C3=9Cn=C3=AFcode.mkv?=\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"Job failed: /media/=C3=9Cn=C3=AFcode.mkv",
+	} {
+		if !strings.Contains(email, expected) {
+			t.Errorf("expected %q in the email %q", expected, email)
+		}
+	}
+
+	summary := &controller.DigestSummary{Period: "weekly", Since: now.Add(-7 * 24 * time.Hour), Completed: 3, BytesSaved: 3 << 30}
+	b, err = buildEmail(cfg, Message{Channel: channel, Text: "Digest", Event: controller.Event{Type: controller.EventDailyDigest, Digest: summary}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email = string(b)
+	for _, expected := range []string{
+		"Subject: Encodarr weekly digest\r\n",
+		"Content-Type: multipart/alternative; boundary=",
+		"Content-Type: text/html; charset=utf-8",
+		"<b>3.0 GiB</b>",
+	} {
+		if !strings.Contains(email, expected) {
+			t.Errorf("expected %q in the email %q", expected, email)
+		}
+	}
+}
+
+func TestEmailSubject(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	if s := emailSubject(controller.Event{Message: long}); len([]rune(s)) != len("Encodarr: ")+maxSubjectLength {
+		t.Errorf("expected a long message to be shortened but got %q", s)
+	}
+	if s := emailSubject(controller.Event{Message: "First line\nSecond line"}); s != "Encodarr: First line" {
+		t.Errorf("expected only the first line of the message but got %q", s)
+	}
+}
+
+func contains(s []string, v string) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
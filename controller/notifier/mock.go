@@ -0,0 +1,79 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+type mockLogger struct{}
+
+func (m *mockLogger) Trace(s string, i ...interface{})    {}
+func (m *mockLogger) Debug(s string, i ...interface{})    {}
+func (m *mockLogger) Info(s string, i ...interface{})     {}
+func (m *mockLogger) Warn(s string, i ...interface{})     {}
+func (m *mockLogger) Error(s string, i ...interface{})    {}
+func (m *mockLogger) Critical(s string, i ...interface{}) {}
+
+// mockSettingsStorer only implements the notification settings. The other methods panic.
+type mockSettingsStorer struct {
+	controller.SettingsStorer
+
+	notifications controller.Notifications
+	secrets       map[controller.SecretSetting]string
+}
+
+func (m *mockSettingsStorer) Notifications() controller.Notifications { return m.notifications }
+
+func (m *mockSettingsStorer) Secret(name controller.SecretSetting) string { return m.secrets[name] }
+
+// mockSender records the messages that it is asked to send and fails the first failures of them.
+type mockSender struct {
+	failures int
+	sent     []string
+}
+
+func (m *mockSender) Send(ctx context.Context, msg Message) error {
+	m.sent = append(m.sent, msg.URL+" "+msg.Text)
+	if len(m.sent) <= m.failures {
+		return errors.New("webhook unavailable")
+	}
+	return nil
+}
+
+// mockLibraryManagerDataStorer only implements Libraries and Library. The other methods panic.
+type mockLibraryManagerDataStorer struct {
+	controller.LibraryManagerDataStorer
+
+	libraries []controller.Library
+}
+
+func (m *mockLibraryManagerDataStorer) Libraries(ctx context.Context) ([]controller.Library, error) {
+	return m.libraries, nil
+}
+
+func (m *mockLibraryManagerDataStorer) Library(ctx context.Context, id int) (controller.Library, error) {
+	for _, l := range m.libraries {
+		if l.ID == id {
+			return l, nil
+		}
+	}
+	return controller.Library{}, errors.New("library not found")
+}
+
+// mockUserInterfacerDataStorer only implements DispatchedJobs and HistoryEntries. The other methods panic.
+type mockUserInterfacerDataStorer struct {
+	controller.UserInterfacerDataStorer
+
+	dispatched []controller.DispatchedJob
+	history    []controller.History
+}
+
+func (m *mockUserInterfacerDataStorer) DispatchedJobs(ctx context.Context) ([]controller.DispatchedJob, error) {
+	return m.dispatched, nil
+}
+
+func (m *mockUserInterfacerDataStorer) HistoryEntries(ctx context.Context) ([]controller.History, error) {
+	return m.history, nil
+}
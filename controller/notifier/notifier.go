@@ -0,0 +1,394 @@
+// Package notifier delivers controller events to the user.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+const (
+	// queueSize is how many messages may wait to be delivered. Messages for a full queue are dropped, so that
+	// notifying never blocks the caller.
+	queueSize = 256
+
+	// maxAttempts is how many times a message is sent before it is given up on.
+	maxAttempts = 3
+
+	// defaultRetryDelay is how long is waited after the first failed attempt. Every retry waits longer than the last.
+	defaultRetryDelay = 5 * time.Second
+
+	// digestCheckInterval is how often Start checks whether the digest is due.
+	digestCheckInterval = time.Minute
+
+	// completionCheckInterval is how often Start checks whether the windows of the batched job_completed events have ended.
+	completionCheckInterval = time.Second
+
+	requestTimeout = 30 * time.Second
+
+	// DefaultTemplate is the template of the channels which don't have their own.
+	DefaultTemplate = "[{{.Type}}] {{.Message}}"
+)
+
+// ErrUnknownChannel is returned by SendTest when there isn't a notification channel with the provided name.
+var ErrUnknownChannel = errors.New("unknown notification channel")
+
+// New returns a new Dispatcher which reads the notification channels from ss.
+func New(logger controller.Logger, ss controller.SettingsStorer) Dispatcher {
+	client := &http.Client{Timeout: requestTimeout}
+	return Dispatcher{
+		logger: logger,
+		ss:     ss,
+		senders: map[controller.NotificationSenderType]Sender{
+			controller.NotificationDiscord: &discordSender{client: client},
+			controller.NotificationSlack:   &slackSender{client: client},
+			controller.NotificationEmail:   &emailSender{ss: ss, timeout: requestTimeout},
+			controller.NotificationNtfy:    &ntfySender{client: client},
+			controller.NotificationGotify:  &gotifySender{client: client},
+		},
+		deliveries: make(chan delivery, queueSize),
+		retryDelay: defaultRetryDelay,
+		now:        time.Now,
+		digest:     &digest{mu: &sync.Mutex{}},
+		completions: &completionBatches{
+			mu:      &sync.Mutex{},
+			batches: make(map[string]*completionBatch),
+		},
+	}
+}
+
+// Dispatcher satisfies the controller.Notifier interface by logging every event it receives and sending it to the
+// notification channels which are subscribed to its type. Sending happens in the background, so a slow or
+// unreachable channel never holds up the caller.
+type Dispatcher struct {
+	logger     controller.Logger
+	ss         controller.SettingsStorer
+	senders    map[controller.NotificationSenderType]Sender
+	deliveries chan delivery
+	retryDelay time.Duration
+	now        func() time.Time
+
+	// digest tallies the jobs for the next digest, which reads the queues from lds and the history from uids.
+	// The webhooks of the libraries are also read from lds. Both are nil if they weren't set.
+	digest *digest
+	lds    controller.LibraryManagerDataStorer
+	uids   controller.UserInterfacerDataStorer
+
+	// completions holds the job_completed events of the channels with a CompletionDigest until their windows end.
+	completions *completionBatches
+}
+
+// delivery is a rendered message which is waiting to be sent by sender.
+type delivery struct {
+	sender Sender
+	msg    Message
+}
+
+// Message is a rendered event which is sent to a channel.
+type Message struct {
+	Channel controller.NotificationChannel
+	URL     string // The webhook URL of the channel, or the server of an ntfy or Gotify channel. It is empty for email channels.
+	Token   string // The access token of an ntfy or Gotify channel, if it has one.
+	Text    string // The event rendered with the channel's template.
+	Event   controller.Event
+
+	// ClickURL is the page of the web interface that the event is about, or empty if there isn't a WebURL.
+	ClickURL string
+}
+
+// TestResult is the outcome of sending a test notification to a channel. Err is nil if it was sent.
+type TestResult struct {
+	Channel string
+	Err     error
+}
+
+// SetSender sets the Sender that sends the messages of the channels with the provided type, replacing the built-in one if there is one.
+// It must be called before Start.
+func (d *Dispatcher) SetSender(t controller.NotificationSenderType, s Sender) {
+	d.senders[t] = s
+}
+
+// SetDataStorers sets where the webhooks of the libraries are read from, and where the digest reads the queued and
+// dispatched jobs and the savings of every completed job from. Without them, events are only sent to the global
+// notification channels and the digest only shows what happened since the previous one. It must be called before Start.
+func (d *Dispatcher) SetDataStorers(lds controller.LibraryManagerDataStorer, uids controller.UserInterfacerDataStorer) {
+	d.lds = lds
+	d.uids = uids
+}
+
+// Notify logs the provided event, including its annotations if it has any, and queues it for the channels which are subscribed to it.
+// An event about a library is also queued for the webhooks of the library which are subscribed to it, and only for them
+// if the library replaces the global channels. A job_completed event is batched instead for the channels with a CompletionDigest.
+func (d *Dispatcher) Notify(e controller.Event) {
+	fields := eventLogFields(e)
+	if len(e.Annotations) > 0 {
+		d.logger.Info("[%v] %v %v", e.Type, e.Message, e.Annotations, fields)
+	} else {
+		d.logger.Info("[%v] %v", e.Type, e.Message, fields)
+	}
+
+	d.digest.record(e)
+
+	libNotifications := d.libraryNotifications(e)
+
+	if !libNotifications.ReplaceGlobal {
+		for _, c := range d.ss.Notifications().Channels {
+			if !subscribed(c, e.Type) {
+				continue
+			}
+			if e.Type == controller.EventJobCompleted && d.completions.add(c, "", e, d.now()) {
+				continue
+			}
+
+			dl, err := d.prepare(c, e)
+			if err != nil {
+				d.logger.Warn("Not sending the %v event to the %v notification channel: %v", e.Type, c.Name, err, fields)
+				continue
+			}
+			d.enqueue(dl)
+		}
+	}
+
+	for i, w := range libNotifications.Webhooks {
+		c := controller.NotificationChannel{
+			Name:             fmt.Sprintf("library %v webhook %v", e.LibraryID, i+1),
+			Type:             w.Type,
+			Events:           w.Events,
+			Template:         w.Template,
+			CompletionDigest: w.CompletionDigest,
+		}
+		if !subscribed(c, e.Type) {
+			continue
+		}
+		if e.Type == controller.EventJobCompleted && d.completions.add(c, w.URL, e, d.now()) {
+			continue
+		}
+
+		dl, err := d.prepareWebhook(c, w.URL, e)
+		if err != nil {
+			d.logger.Warn("Not sending the %v event to the %v: %v", e.Type, c.Name, err, fields)
+			continue
+		}
+		d.enqueue(dl)
+	}
+}
+
+// eventLogFields returns the fields which tie the log records about e to its library and job. An event which isn't
+// about a job is left off the timelines.
+func eventLogFields(e controller.Event) controller.LogFields {
+	fields := controller.LogFields{}
+	if e.Type.AboutLibrary() {
+		fields["library_id"] = e.LibraryID
+	}
+	if e.JobUUID != "" {
+		fields["job_uuid"] = e.JobUUID
+	}
+	return fields
+}
+
+// libraryNotifications returns the webhooks of the library that e is about. They are empty if e isn't about a library
+// or the library can't be read.
+func (d *Dispatcher) libraryNotifications(e controller.Event) controller.LibraryNotifications {
+	if d.lds == nil || !e.Type.AboutLibrary() {
+		return controller.LibraryNotifications{}
+	}
+
+	lib, err := d.lds.Library(context.Background(), e.LibraryID)
+	if err != nil {
+		d.logger.Debug("Not sending the %v event to the webhooks of library %v because it couldn't be read: %v", e.Type, e.LibraryID, err)
+		return controller.LibraryNotifications{}
+	}
+	return lib.Notifications
+}
+
+// enqueue queues dl to be sent, dropping it if the queue is full.
+func (d *Dispatcher) enqueue(dl delivery) {
+	select {
+	case d.deliveries <- dl:
+	default:
+		d.logger.Warn("Dropped the %v event for the %v notification channel because too many messages are waiting to be sent", dl.msg.Event.Type, dl.msg.Channel.Name)
+	}
+}
+
+// Start sends the queued messages and emits the digests without blocking the thread. The job_completed events which
+// are still batched when ctx is cancelled aren't sent.
+func (d *Dispatcher) Start(ctx context.Context, wg *sync.WaitGroup) {
+	d.digest.start(d.now())
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(digestCheckInterval)
+		defer ticker.Stop()
+		completionTicker := time.NewTicker(completionCheckInterval)
+		defer completionTicker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case dl := <-d.deliveries:
+				d.deliver(ctx, dl)
+			case <-ticker.C:
+				d.checkDigest(ctx)
+			case <-completionTicker.C:
+				d.flushCompletions()
+			}
+		}
+	}()
+}
+
+// SendTest immediately sends a test message to the channel with the provided name, or to every channel if it is empty,
+// without retrying. ErrUnknownChannel is returned if there isn't a channel with the name.
+func (d *Dispatcher) SendTest(ctx context.Context, channel string) ([]TestResult, error) {
+	e := controller.Event{
+		Type:    "test",
+		Message: "This is a test notification from Encodarr",
+		Time:    d.now(),
+	}
+
+	results := []TestResult{}
+	for _, c := range d.ss.Notifications().Channels {
+		if channel != "" && c.Name != channel {
+			continue
+		}
+
+		dl, err := d.prepare(c, e)
+		if err == nil {
+			err = dl.sender.Send(ctx, dl.msg)
+		}
+		results = append(results, TestResult{Channel: c.Name, Err: err})
+	}
+
+	if channel != "" && len(results) == 0 {
+		return nil, ErrUnknownChannel
+	}
+	return results, nil
+}
+
+// prepare renders e for the channel c.
+func (d *Dispatcher) prepare(c controller.NotificationChannel, e controller.Event) (delivery, error) {
+	sender, ok := d.senders[c.Type]
+	if !ok {
+		return delivery{}, fmt.Errorf("unknown notification channel type '%v'", c.Type)
+	}
+
+	msg := Message{Channel: c, Event: e}
+	switch c.Type {
+	case controller.NotificationEmail:
+		// Email channels send to their recipients through the SMTP server instead of a webhook
+	case controller.NotificationNtfy, controller.NotificationGotify:
+		msg.URL = c.Server
+		msg.Token = d.ss.Secret(controller.NotificationTokenSecret(c.Name))
+		if msg.Token == "" && c.Type == controller.NotificationGotify {
+			return delivery{}, fmt.Errorf("the %v secret isn't set", controller.NotificationTokenSecret(c.Name))
+		}
+		msg.ClickURL = clickURL(d.ss.Notifications().WebURL, e)
+	default:
+		msg.URL = d.ss.Secret(controller.NotificationWebhookSecret(c.Name))
+		if msg.URL == "" {
+			return delivery{}, fmt.Errorf("the %v secret isn't set", controller.NotificationWebhookSecret(c.Name))
+		}
+	}
+
+	var err error
+	if msg.Text, err = render(c.Template, e); err != nil {
+		return delivery{}, err
+	}
+
+	return delivery{sender: sender, msg: msg}, nil
+}
+
+// prepareWebhook renders e for the channel c of a library, which posts to the webhook at url instead of the one in its secret.
+func (d *Dispatcher) prepareWebhook(c controller.NotificationChannel, url string, e controller.Event) (delivery, error) {
+	sender, ok := d.senders[c.Type]
+	if !ok {
+		return delivery{}, fmt.Errorf("unknown notification channel type '%v'", c.Type)
+	}
+
+	text, err := render(c.Template, e)
+	if err != nil {
+		return delivery{}, err
+	}
+
+	return delivery{sender: sender, msg: Message{Channel: c, URL: url, Text: text, Event: e}}, nil
+}
+
+// deliver sends dl, retrying it with a growing delay if it fails.
+func (d *Dispatcher) deliver(ctx context.Context, dl delivery) {
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = dl.sender.Send(ctx, dl.msg); err == nil {
+			return
+		}
+		if attempt == maxAttempts {
+			break
+		}
+
+		d.logger.Debug("Attempt %v of sending to the %v notification channel failed, retrying: %v", attempt, dl.msg.Channel.Name, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.retryDelay * time.Duration(attempt)):
+		}
+	}
+	d.logger.Warn("Failed to send to the %v notification channel: %v", dl.msg.Channel.Name, err)
+}
+
+// subscribed returns whether or not the channel c receives the events of type t.
+func subscribed(c controller.NotificationChannel, t controller.EventType) bool {
+	for _, v := range c.Events {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTemplate parses the template of a notification channel. Besides the built-in functions, templates can use
+// bytes, which formats a number of bytes (ex. {{bytes .BytesSaved}} shows 1.5 GiB).
+func ParseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	return template.New("notification").Funcs(template.FuncMap{"bytes": formatBytes}).Parse(text)
+}
+
+// render executes the channel template text with e as its data.
+func render(text string, e controller.Event) (string, error) {
+	t, err := ParseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err = t.Execute(&b, e); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// formatBytes formats n with the largest binary unit that keeps it at or above 1.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%v B", n)
+	}
+
+	value := float64(n)
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := -1
+	for (value >= unit || value <= -unit) && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %v", value, units[i])
+}
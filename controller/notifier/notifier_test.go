@@ -0,0 +1,349 @@
+package notifier
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func newTestDispatcher(channels ...controller.NotificationChannel) (Dispatcher, *mockSender) {
+	ss := &mockSettingsStorer{
+		notifications: controller.Notifications{Channels: channels, DigestTime: "08:00"},
+		secrets:       make(map[controller.SecretSetting]string),
+	}
+	for _, c := range channels {
+		if c.Name != "no-url" {
+			ss.secrets[controller.NotificationWebhookSecret(c.Name)] = "https://hooks/" + c.Name
+		}
+	}
+
+	sender := &mockSender{}
+	d := New(&mockLogger{}, ss)
+	d.SetSender(controller.NotificationDiscord, sender)
+	d.SetSender(controller.NotificationSlack, sender)
+	d.retryDelay = 0
+	return d, sender
+}
+
+func TestNotifyRouting(t *testing.T) {
+	d, sender := newTestDispatcher(
+		controller.NotificationChannel{Name: "failures", Type: controller.NotificationDiscord, Events: []controller.EventType{controller.EventJobFailed, controller.EventRunnerOffline}, Template: "{{.Path}} failed on {{.Runner}}"},
+		controller.NotificationChannel{Name: "summaries", Type: controller.NotificationSlack, Events: []controller.EventType{controller.EventDailyDigest, controller.EventJobCompleted}},
+		controller.NotificationChannel{Name: "no-url", Type: controller.NotificationSlack, Events: []controller.EventType{controller.EventJobFailed}},
+	)
+
+	d.Notify(controller.Event{Type: controller.EventJobFailed, Message: "Job for /media/a.mkv failed", Path: "/media/a.mkv", Runner: "runner-1"})
+	d.Notify(controller.Event{Type: controller.EventJobCompleted, Message: "Replaced /media/b.mkv with its transcoded file"})
+	d.Notify(controller.Event{Type: controller.EventLibraryComplete, Message: "Library 1 (/media) has been fully processed"})
+
+	close(d.deliveries)
+	for dl := range d.deliveries {
+		d.deliver(context.Background(), dl)
+	}
+
+	expected := []string{
+		"https://hooks/failures /media/a.mkv failed on runner-1",
+		"https://hooks/summaries [job_completed] Replaced /media/b.mkv with its transcoded file",
+	}
+	if !reflect.DeepEqual(sender.sent, expected) {
+		t.Errorf("expected %q to be sent but got %q", expected, sender.sent)
+	}
+}
+
+func TestNotifyLibraryWebhooks(t *testing.T) {
+	d, sender := newTestDispatcher(controller.NotificationChannel{Name: "failures", Type: controller.NotificationDiscord, Events: []controller.EventType{controller.EventJobFailed}})
+	d.SetDataStorers(&mockLibraryManagerDataStorer{libraries: []controller.Library{
+		{ID: 1, Notifications: controller.LibraryNotifications{
+			Webhooks: []controller.LibraryWebhook{{Type: controller.NotificationSlack, URL: "https://hooks/movies", Events: []controller.EventType{controller.EventJobFailed, controller.EventLibraryComplete}}},
+		}},
+		{ID: 2, Notifications: controller.LibraryNotifications{
+			Webhooks:      []controller.LibraryWebhook{{Type: controller.NotificationDiscord, URL: "https://hooks/anime", Events: []controller.EventType{controller.EventJobFailed}, Template: "{{.Path}} failed"}},
+			ReplaceGlobal: true,
+		}},
+	}}, &mockUserInterfacerDataStorer{})
+
+	d.Notify(controller.Event{Type: controller.EventJobFailed, LibraryID: 1, Message: "Job for /movies/a.mkv failed", Path: "/movies/a.mkv"})
+	d.Notify(controller.Event{Type: controller.EventJobFailed, LibraryID: 2, Message: "Job for /anime/b.mkv failed", Path: "/anime/b.mkv"})
+	d.Notify(controller.Event{Type: controller.EventJobFailed, LibraryID: 3, Message: "Job for /tv/c.mkv failed", Path: "/tv/c.mkv"})
+	d.Notify(controller.Event{Type: controller.EventJobCompleted, LibraryID: 1, Message: "Replaced /movies/d.mkv with its transcoded file"})
+	d.Notify(controller.Event{Type: controller.EventRunnerOffline, Message: "The runner-1 runner went offline"})
+
+	close(d.deliveries)
+	for dl := range d.deliveries {
+		d.deliver(context.Background(), dl)
+	}
+
+	expected := []string{
+		"https://hooks/failures [job_failed] Job for /movies/a.mkv failed",
+		"https://hooks/movies [job_failed] Job for /movies/a.mkv failed",
+		"https://hooks/anime /anime/b.mkv failed",
+		"https://hooks/failures [job_failed] Job for /tv/c.mkv failed",
+	}
+	if !reflect.DeepEqual(sender.sent, expected) {
+		t.Errorf("expected %q to be sent but got %q", expected, sender.sent)
+	}
+}
+
+func TestNotifyNeverBlocks(t *testing.T) {
+	d, _ := newTestDispatcher(controller.NotificationChannel{Name: "failures", Type: controller.NotificationDiscord, Events: []controller.EventType{controller.EventJobFailed}})
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < queueSize+10; i++ {
+			d.Notify(controller.Event{Type: controller.EventJobFailed})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify blocked on a full queue")
+	}
+	if len(d.deliveries) != queueSize {
+		t.Errorf("expected %v queued messages but got %v", queueSize, len(d.deliveries))
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int
+		expectedSends int
+	}{
+		{name: "First Attempt", failures: 0, expectedSends: 1},
+		{name: "Retried", failures: 2, expectedSends: 3},
+		{name: "Gives Up", failures: 5, expectedSends: maxAttempts},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, sender := newTestDispatcher()
+			sender.failures = test.failures
+
+			d.deliver(context.Background(), delivery{sender: sender, msg: Message{Channel: controller.NotificationChannel{Name: "failures"}, URL: "https://hooks/failures", Text: "text"}})
+
+			if len(sender.sent) != test.expectedSends {
+				t.Errorf("expected %v sends but got %v", test.expectedSends, len(sender.sent))
+			}
+		})
+	}
+}
+
+func TestDigest(t *testing.T) {
+	start := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC) // A Sunday
+	g := &digest{mu: &sync.Mutex{}}
+	g.start(start)
+
+	g.record(controller.Event{Type: controller.EventJobCompleted, BytesSaved: 1 << 30})
+	g.record(controller.Event{Type: controller.EventJobCompleted, BytesSaved: 1 << 29})
+	g.record(controller.Event{Type: controller.EventJobFailed})
+	g.record(controller.Event{Type: controller.EventRunnerOffline})
+
+	if _, ok := g.due(start.Add(time.Hour), "08:00", ""); ok {
+		t.Errorf("expected no digest before the next digest time")
+	}
+	if _, ok := g.due(start.Add(24*time.Hour), "", ""); ok {
+		t.Errorf("expected no digest while it is disabled")
+	}
+
+	s, ok := g.due(start.Add(20*time.Hour+time.Minute), "08:00", "")
+	expected := controller.DigestSummary{Period: "daily", Since: start, Completed: 2, Failed: 1, BytesSaved: 1<<30 + 1<<29}
+	if !ok || !reflect.DeepEqual(s, expected) {
+		t.Errorf("expected the digest %+v but got %+v, %v", expected, s, ok)
+	}
+
+	if _, ok = g.due(start.Add(20*time.Hour+2*time.Minute), "08:00", ""); ok {
+		t.Errorf("expected only one digest per day")
+	}
+	if s, ok = g.due(start.Add(44*time.Hour), "08:00", ""); !ok || s.Completed != 0 || s.BytesSaved != 0 {
+		t.Errorf("expected a digest with a new tally the next day but got %+v, %v", s, ok)
+	}
+
+	// Weekly on Wednesdays, which is the 4th
+	if _, ok = g.due(start.Add(66*time.Hour), "08:00", "wednesday"); ok {
+		t.Errorf("expected no weekly digest before its day")
+	}
+	if s, ok = g.due(start.Add(68*time.Hour+time.Minute), "08:00", "Wednesday"); !ok || s.Period != "weekly" {
+		t.Errorf("expected a weekly digest on its day but got %+v, %v", s, ok)
+	}
+}
+
+func TestCheckDigest(t *testing.T) {
+	d, sender := newTestDispatcher(controller.NotificationChannel{Name: "summaries", Type: controller.NotificationSlack, Events: []controller.EventType{controller.EventDailyDigest}})
+	d.SetDataStorers(
+		&mockLibraryManagerDataStorer{libraries: []controller.Library{
+			{ID: 1, Queue: controller.LibraryQueue{Items: []controller.Job{{UUID: "a"}, {UUID: "b"}}}},
+			{ID: 2, Queue: controller.LibraryQueue{Items: []controller.Job{{UUID: "c"}}}},
+		}},
+		&mockUserInterfacerDataStorer{
+			dispatched: []controller.DispatchedJob{{UUID: "d"}},
+			history:    []controller.History{{Completion: &controller.CompletionRecord{SavedBytes: 3 << 30}}, {Failed: true}},
+		},
+	)
+
+	now := time.Date(2021, time.August, 1, 7, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	d.digest.start(now)
+	d.Notify(controller.Event{Type: controller.EventJobCompleted, BytesSaved: 1 << 30})
+
+	now = now.Add(time.Hour)
+	d.checkDigest(context.Background())
+
+	close(d.deliveries)
+	for dl := range d.deliveries {
+		if dl.msg.Event.Digest == nil || dl.msg.Event.Digest.Queued != 3 || dl.msg.Event.Digest.Dispatched != 1 || dl.msg.Event.Digest.TotalBytesSaved != 3<<30 {
+			t.Errorf("expected the digest to have the queue status but got %+v", dl.msg.Event.Digest)
+		}
+		d.deliver(context.Background(), dl)
+	}
+
+	expected := []string{"https://hooks/summaries [daily_digest] Since 2021-08-01 07:00, 1 jobs were completed and 0 failed, saving 1.0 GiB. 3 jobs are queued, 1 are running, and 3.0 GiB have been saved in total"}
+	if !reflect.DeepEqual(sender.sent, expected) {
+		t.Errorf("expected %q to be sent but got %q", expected, sender.sent)
+	}
+}
+
+func TestCompletionDigest(t *testing.T) {
+	d, sender := newTestDispatcher(
+		controller.NotificationChannel{Name: "batched", Type: controller.NotificationSlack, Events: []controller.EventType{controller.EventJobCompleted, controller.EventJobFailed}, CompletionDigest: "10m"},
+		controller.NotificationChannel{Name: "every", Type: controller.NotificationDiscord, Events: []controller.EventType{controller.EventJobCompleted}},
+	)
+	d.SetDataStorers(&mockLibraryManagerDataStorer{libraries: []controller.Library{
+		{ID: 1, Notifications: controller.LibraryNotifications{
+			Webhooks:      []controller.LibraryWebhook{{Type: controller.NotificationDiscord, URL: "https://hooks/movies", Events: []controller.EventType{controller.EventJobCompleted}, Template: "{{.Completions.Count}} done", CompletionDigest: "5m"}},
+			ReplaceGlobal: true,
+		}},
+	}}, &mockUserInterfacerDataStorer{})
+
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	d.Notify(controller.Event{Type: controller.EventJobCompleted, LibraryID: 2, JobUUID: "a", Path: "/tv/a.mkv", Message: "Replaced /tv/a.mkv with its transcoded file", BytesSaved: 1 << 30})
+	now = now.Add(time.Minute)
+	d.Notify(controller.Event{Type: controller.EventJobCompleted, LibraryID: 1, JobUUID: "b", Path: "/movies/b.mkv", Message: "Replaced /movies/b.mkv with its transcoded file", BytesSaved: 1 << 29})
+	d.Notify(controller.Event{Type: controller.EventJobFailed, LibraryID: 2, Message: "Job for /tv/c.mkv failed"})
+	now = now.Add(time.Minute)
+	d.Notify(controller.Event{Type: controller.EventJobCompleted, LibraryID: 2, JobUUID: "d", Path: "/tv/d.mkv", Message: "Replaced /tv/d.mkv with its transcoded file", BytesSaved: 1 << 29})
+
+	// The channel without a CompletionDigest gets every event right away, and the batched channel only its other events
+	if len(d.deliveries) != 3 {
+		t.Fatalf("expected 3 messages to be queued before the windows end but got %v", len(d.deliveries))
+	}
+
+	now = now.Add(4 * time.Minute)
+	d.flushCompletions()
+	if len(d.deliveries) != 4 {
+		t.Fatalf("expected the digest of the library webhook to be queued after its window but got %v messages", len(d.deliveries))
+	}
+
+	now = now.Add(4 * time.Minute)
+	d.flushCompletions()
+	d.flushCompletions()
+
+	close(d.deliveries)
+	digests := map[string]*controller.CompletionDigest{}
+	for dl := range d.deliveries {
+		if dl.msg.Event.Type == controller.EventJobCompletionDigest {
+			digests[dl.msg.Channel.Name] = dl.msg.Event.Completions
+		}
+		d.deliver(context.Background(), dl)
+	}
+
+	expectedDigests := map[string]*controller.CompletionDigest{
+		"batched": {Since: now.Add(-10 * time.Minute), Count: 2, BytesSaved: 1<<30 + 1<<29, Jobs: []controller.CompletionDigestJob{
+			{LibraryID: 2, JobUUID: "a", Path: "/tv/a.mkv", BytesSaved: 1 << 30},
+			{LibraryID: 2, JobUUID: "d", Path: "/tv/d.mkv", BytesSaved: 1 << 29},
+		}},
+		"library 1 webhook 1": {Since: now.Add(-9 * time.Minute), Count: 1, BytesSaved: 1 << 29, Jobs: []controller.CompletionDigestJob{
+			{LibraryID: 1, JobUUID: "b", Path: "/movies/b.mkv", BytesSaved: 1 << 29},
+		}},
+	}
+	if !reflect.DeepEqual(digests, expectedDigests) {
+		t.Errorf("expected the digests %+v but got %+v", expectedDigests, digests)
+	}
+
+	expected := []string{
+		"https://hooks/every [job_completed] Replaced /tv/a.mkv with its transcoded file",
+		"https://hooks/batched [job_failed] Job for /tv/c.mkv failed",
+		"https://hooks/every [job_completed] Replaced /tv/d.mkv with its transcoded file",
+		"https://hooks/movies 1 done",
+		"https://hooks/batched [job_completion_digest] Since 2021-08-01 12:00, 2 jobs were completed, saving 1.5 GiB\n/tv/a.mkv\n/tv/d.mkv",
+	}
+	if !reflect.DeepEqual(sender.sent, expected) {
+		t.Errorf("expected %q to be sent but got %q", expected, sender.sent)
+	}
+}
+
+func TestSendTest(t *testing.T) {
+	d, sender := newTestDispatcher(
+		controller.NotificationChannel{Name: "failures", Type: controller.NotificationDiscord, Events: []controller.EventType{controller.EventJobFailed}},
+		controller.NotificationChannel{Name: "no-url", Type: controller.NotificationSlack, Events: []controller.EventType{controller.EventJobFailed}},
+	)
+
+	results, err := d.SendTest(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].Channel != "failures" || results[0].Err != nil || results[1].Channel != "no-url" || results[1].Err == nil {
+		t.Errorf("expected the test to be sent to failures but not no-url, got %+v", results)
+	}
+	if len(sender.sent) != 1 || !strings.Contains(sender.sent[0], "test notification") {
+		t.Errorf("expected one test message to be sent but got %q", sender.sent)
+	}
+
+	if results, err = d.SendTest(context.Background(), "failures"); err != nil || len(results) != 1 {
+		t.Errorf("expected the test to be sent to only the named channel but got %+v, %v", results, err)
+	}
+	if _, err = d.SendTest(context.Background(), "summaries"); err != ErrUnknownChannel {
+		t.Errorf("expected ErrUnknownChannel but got %v", err)
+	}
+}
+
+func TestSenders(t *testing.T) {
+	tests := []struct {
+		name         string
+		sender       Sender
+		text         string
+		expectedBody string
+	}{
+		{name: "Discord", sender: &discordSender{client: http.DefaultClient}, text: "hello", expectedBody: `{"content":"hello"}`},
+		{name: "Discord Too Long", sender: &discordSender{client: http.DefaultClient}, text: strings.Repeat("a", discordMessageLimit+1), expectedBody: `{"content":"` + strings.Repeat("a", discordMessageLimit-1) + `…"}`},
+		{name: "Slack", sender: &slackSender{client: http.DefaultClient}, text: "hello", expectedBody: `{"text":"hello"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body string
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				body = string(b)
+				rw.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			if err := test.sender.Send(context.Background(), Message{URL: server.URL, Text: test.text}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if body != test.expectedBody {
+				t.Errorf("expected the body %v but got %v", test.expectedBody, body)
+			}
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	if err := (&slackSender{client: http.DefaultClient}).Send(context.Background(), Message{URL: server.URL, Text: "hello"}); err == nil {
+		t.Errorf("expected an error for an unsuccessful response")
+	}
+}
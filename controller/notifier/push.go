@@ -0,0 +1,106 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// priority is how urgently a push notification is shown on the phone.
+type priority int
+
+const (
+	priorityLow priority = iota
+	priorityDefault
+	priorityHigh
+)
+
+// eventPriority returns the priority of the push notifications for events of type t. Events that need the user's
+// attention are high, the digests are low, and everything else uses the default.
+func eventPriority(t controller.EventType) priority {
+	switch t {
+	case controller.EventJobFailed, controller.EventRunnerOffline, controller.EventNoRunners:
+		return priorityHigh
+	case controller.EventDailyDigest, controller.EventJobCompletionDigest:
+		return priorityLow
+	default:
+		return priorityDefault
+	}
+}
+
+// ntfyPriorities and gotifyPriorities map the priorities to the values of each service. ntfy goes from 1 (min)
+// to 5 (urgent), and Gotify's clients show a sound and a pop-up from 4 and up to 10.
+var (
+	ntfyPriorities   = map[priority]int{priorityLow: 2, priorityDefault: 3, priorityHigh: 4}
+	gotifyPriorities = map[priority]int{priorityLow: 2, priorityDefault: 5, priorityHigh: 8}
+)
+
+// pushTitle returns the title of the push notification for e, such as "Encodarr: job failed".
+func pushTitle(e controller.Event) string {
+	return "Encodarr: " + strings.ReplaceAll(string(e.Type), "_", " ")
+}
+
+// clickURL returns the page of the web interface at webURL that e is about: the details of its job, or the web interface
+// itself for events that aren't about a job. An empty string is returned if webURL is empty.
+func clickURL(webURL string, e controller.Event) string {
+	if webURL == "" {
+		return ""
+	}
+	webURL = strings.TrimSuffix(webURL, "/")
+	if e.JobUUID == "" {
+		return webURL + "/"
+	}
+	return webURL + "/api/web/v1/job/" + url.PathEscape(string(e.JobUUID))
+}
+
+// ntfySender publishes messages to a topic on an ntfy server.
+type ntfySender struct {
+	client *http.Client
+}
+
+// Send publishes the text of msg to the channel's topic, authenticated with the channel's token if it has one.
+func (s *ntfySender) Send(ctx context.Context, msg Message) error {
+	body := map[string]interface{}{
+		"topic":    msg.Channel.Topic,
+		"title":    pushTitle(msg.Event),
+		"message":  msg.Text,
+		"priority": ntfyPriorities[eventPriority(msg.Event.Type)],
+	}
+	if msg.ClickURL != "" {
+		body["click"] = msg.ClickURL
+	}
+
+	header := http.Header{}
+	if msg.Token != "" {
+		header.Set("Authorization", "Bearer "+msg.Token)
+	}
+
+	// Publishing JSON goes to the root of the server, with the topic in the body
+	return postJSON(ctx, s.client, strings.TrimSuffix(msg.URL, "/")+"/", header, body)
+}
+
+// gotifySender pushes messages to a Gotify server as one of its applications.
+type gotifySender struct {
+	client *http.Client
+}
+
+// Send pushes the text of msg with the channel's application token.
+func (s *gotifySender) Send(ctx context.Context, msg Message) error {
+	body := map[string]interface{}{
+		"title":    pushTitle(msg.Event),
+		"message":  msg.Text,
+		"priority": gotifyPriorities[eventPriority(msg.Event.Type)],
+	}
+	if msg.ClickURL != "" {
+		body["extras"] = map[string]interface{}{
+			"client::notification": map[string]interface{}{"click": map[string]string{"url": msg.ClickURL}},
+		}
+	}
+
+	header := http.Header{}
+	header.Set("X-Gotify-Key", msg.Token)
+	return postJSON(ctx, s.client, strings.TrimSuffix(msg.URL, "/")+"/message", header, body)
+}
@@ -0,0 +1,134 @@
+package notifier
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func TestPushSenders(t *testing.T) {
+	failed := controller.Event{Type: controller.EventJobFailed, JobUUID: "abc"}
+	completed := controller.Event{Type: controller.EventJobCompleted}
+
+	tests := []struct {
+		name     string
+		sender   Sender
+		msg      Message
+		expected string
+	}{
+		{
+			name:     "ntfy Failure",
+			sender:   &ntfySender{client: http.DefaultClient},
+			msg:      Message{Channel: controller.NotificationChannel{Topic: "encodarr"}, Token: "tk", Text: "failed", Event: failed, ClickURL: "http://encodarr.lan/api/web/v1/job/abc"},
+			expected: `POST / Bearer tk  {"click":"http://encodarr.lan/api/web/v1/job/abc","message":"failed","priority":4,"title":"Encodarr: job failed","topic":"encodarr"}`,
+		},
+		{
+			name:     "ntfy Completion",
+			sender:   &ntfySender{client: http.DefaultClient},
+			msg:      Message{Channel: controller.NotificationChannel{Topic: "encodarr"}, Text: "done", Event: completed},
+			expected: `POST /   {"message":"done","priority":3,"title":"Encodarr: job completed","topic":"encodarr"}`,
+		},
+		{
+			name:     "Gotify Failure",
+			sender:   &gotifySender{client: http.DefaultClient},
+			msg:      Message{Token: "app", Text: "failed", Event: failed, ClickURL: "http://encodarr.lan/api/web/v1/job/abc"},
+			expected: `POST /message  app {"extras":{"client::notification":{"click":{"url":"http://encodarr.lan/api/web/v1/job/abc"}}},"message":"failed","priority":8,"title":"Encodarr: job failed"}`,
+		},
+		{
+			name:     "Gotify Completion",
+			sender:   &gotifySender{client: http.DefaultClient},
+			msg:      Message{Token: "app", Text: "done", Event: completed},
+			expected: `POST /message  app {"message":"done","priority":5,"title":"Encodarr: job completed"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var request string
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				request = r.Method + " " + r.URL.Path + " " + r.Header.Get("Authorization") + " " + r.Header.Get("X-Gotify-Key") + " " + string(b)
+			}))
+			defer server.Close()
+
+			test.msg.URL = server.URL
+			if err := test.sender.Send(context.Background(), test.msg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if request != test.expected {
+				t.Errorf("expected the request %v but got %v", test.expected, request)
+			}
+		})
+	}
+}
+
+func TestClickURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		webURL   string
+		event    controller.Event
+		expected string
+	}{
+		{name: "Job", webURL: "http://encodarr.lan:8123/", event: controller.Event{JobUUID: "abc"}, expected: "http://encodarr.lan:8123/api/web/v1/job/abc"},
+		{name: "Not About A Job", webURL: "http://encodarr.lan:8123", event: controller.Event{}, expected: "http://encodarr.lan:8123/"},
+		{name: "No Web URL", event: controller.Event{JobUUID: "abc"}, expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if u := clickURL(test.webURL, test.event); u != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, u)
+			}
+		})
+	}
+}
+
+func TestSendTestPush(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/message" && r.Header.Get("X-Gotify-Key") != "app" {
+			rw.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	ss := &mockSettingsStorer{
+		notifications: controller.Notifications{
+			Channels: []controller.NotificationChannel{
+				{Name: "phone", Type: controller.NotificationNtfy, Server: server.URL, Topic: "encodarr"},
+				{Name: "gotify", Type: controller.NotificationGotify, Server: server.URL},
+				{Name: "untokened", Type: controller.NotificationGotify, Server: server.URL},
+			},
+			WebURL: "http://encodarr.lan",
+		},
+		secrets: map[controller.SecretSetting]string{controller.NotificationTokenSecret("gotify"): "app"},
+	}
+	d := New(&mockLogger{}, ss)
+
+	results, err := d.SendTest(context.Background(), "gotify")
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Errorf("expected the gotify channel to be sent to but got %v, %v", results, err)
+	}
+
+	results, err = d.SendTest(context.Background(), "")
+	if err != nil || len(results) != 3 {
+		t.Fatalf("expected a result for every channel but got %v, %v", results, err)
+	}
+	if results[0].Err != nil || results[1].Err != nil || results[2].Err == nil {
+		t.Errorf("expected only the channel without a token to fail but got %v", results)
+	}
+
+	if expected := []string{"/message", "/", "/message"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected requests to %v but got %v", expected, paths)
+	}
+}
@@ -0,0 +1,79 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// discordMessageLimit is the most characters that Discord accepts in the content of a message.
+const discordMessageLimit = 2000
+
+// A Sender sends messages to a kind of notification channel.
+type Sender interface {
+	// Send sends msg to its channel. The returned error is shown by the test notifications, so it should say what went wrong.
+	Send(ctx context.Context, msg Message) error
+}
+
+// discordSender posts messages to Discord webhooks.
+type discordSender struct {
+	client *http.Client
+}
+
+// Send posts the text of msg to the Discord webhook, cutting it short if it is longer than Discord allows.
+func (s *discordSender) Send(ctx context.Context, msg Message) error {
+	text := msg.Text
+	if r := []rune(text); len(r) > discordMessageLimit {
+		text = string(r[:discordMessageLimit-1]) + "…"
+	}
+	return postJSON(ctx, s.client, msg.URL, nil, map[string]string{"content": text})
+}
+
+// slackSender posts messages to Slack incoming webhooks.
+type slackSender struct {
+	client *http.Client
+}
+
+// Send posts the text of msg to the Slack incoming webhook.
+func (s *slackSender) Send(ctx context.Context, msg Message) error {
+	return postJSON(ctx, s.client, msg.URL, nil, map[string]string{"text": msg.Text})
+}
+
+// postJSON posts v as JSON to webhookURL with the provided extra headers and returns an error if the response isn't successful.
+func postJSON(ctx context.Context, client *http.Client, webhookURL string, header http.Header, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.New("the webhook URL is invalid")
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL is left out of the error because it is a secret.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("posting the message: %w", urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("the webhook returned %v: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// NewPathCanonicalizer returns a PathCanonicalizer for the operating system the Controller is running on.
+func NewPathCanonicalizer(resolveSymlinks, foldCase bool) PathCanonicalizer {
+	return PathCanonicalizer{
+		ResolveSymlinks: resolveSymlinks,
+		FoldCase:        foldCase,
+		Windows:         runtime.GOOS == "windows",
+	}
+}
+
+// PathCanonicalizer converts paths into the single form in which they are stored and compared, so that different
+// spellings of the same file (ex. /media/tv/show.mkv and /media/tv//show.mkv) aren't treated as different files.
+type PathCanonicalizer struct {
+	// ResolveSymlinks replaces paths which exist with their symlink-free version, so that a file reached through
+	// a linked folder or a different mount prefix has the same canonical path.
+	ResolveSymlinks bool
+
+	// FoldCase spells every part of a path which exists like it is spelled on disk, so that paths which only differ
+	// in case have the same canonical path while the files keep their names. Parts which don't exist are kept as they
+	// are. It should only be enabled when the media is on a case-insensitive filesystem.
+	FoldCase bool
+
+	// Windows treats backslashes as separators and drive letters as case-insensitive.
+	Windows bool
+}
+
+// Canonicalize returns the canonical form of p. Canonical paths are cleaned, don't have a trailing separator,
+// and use forward slashes like the paths found by library scans.
+func (c PathCanonicalizer) Canonicalize(p string) string {
+	return c.canonicalize(p, nil)
+}
+
+// CanonicalizeAll replaces every path in paths with its canonical form. When case is folded, it is faster than
+// calling Canonicalize for each of them, because the folders which the paths share are only listed once.
+func (c PathCanonicalizer) CanonicalizeAll(paths []string) {
+	dirs := make(map[string][]string)
+	for i, p := range paths {
+		paths[i] = c.canonicalize(p, dirs)
+	}
+}
+
+// canonicalize returns the canonical form of p. dirs caches the names in the folders which were listed to fold case,
+// and may be nil.
+func (c PathCanonicalizer) canonicalize(p string, dirs map[string][]string) string {
+	if p == "" {
+		return ""
+	}
+
+	if c.Windows {
+		p = strings.ReplaceAll(p, `\`, "/")
+	}
+	p = path.Clean(p)
+
+	if c.ResolveSymlinks {
+		if resolved, err := filepath.EvalSymlinks(filepath.FromSlash(p)); err == nil {
+			p = path.Clean(filepath.ToSlash(resolved))
+		}
+	}
+
+	if c.Windows && len(p) >= 2 && p[1] == ':' {
+		p = strings.ToUpper(p[:1]) + p[1:]
+	}
+
+	if c.FoldCase {
+		p = c.onDiskCase(p, dirs)
+	}
+
+	return p
+}
+
+// onDiskCase returns p with each of its parts spelled like the matching file or folder on disk. Once a part doesn't
+// match anything, it and the rest of p are kept as they are. An exact match is preferred over one in another case.
+func (c PathCanonicalizer) onDiskCase(p string, dirs map[string][]string) string {
+	resolved, rest := "", p
+	if strings.HasPrefix(p, "/") {
+		resolved, rest = "/", p[1:]
+	} else if c.Windows && len(p) >= 3 && p[1] == ':' && p[2] == '/' {
+		resolved, rest = p[:3], p[3:]
+	}
+	if rest == "" || rest == "." {
+		return p
+	}
+
+	parts := strings.Split(rest, "/")
+	for i, part := range parts {
+		names, ok := dirs[resolved]
+		if !ok {
+			names = listNames(resolved)
+			if dirs != nil {
+				dirs[resolved] = names
+			}
+		}
+
+		match := ""
+		for _, name := range names {
+			if name == part {
+				match = name
+				break
+			}
+			if match == "" && strings.EqualFold(name, part) {
+				match = name
+			}
+		}
+		if match == "" {
+			return path.Join(resolved, strings.Join(parts[i:], "/"))
+		}
+		resolved = path.Join(resolved, match)
+	}
+	return resolved
+}
+
+// listNames returns the names in the folder dir, or nil if it can't be read.
+func listNames(dir string) []string {
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(filepath.FromSlash(dir))
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
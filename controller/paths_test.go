@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	unix := PathCanonicalizer{}
+	windows := PathCanonicalizer{Windows: true}
+	folded := PathCanonicalizer{FoldCase: true}
+
+	tests := []struct {
+		name string
+		c    PathCanonicalizer
+		in   string
+		out  string
+	}{
+		{name: "Canonical path", c: unix, in: "/media/tv/show.mkv", out: "/media/tv/show.mkv"},
+		{name: "Empty path", c: unix, in: "", out: ""},
+		{name: "Trailing slash", c: unix, in: "/media/tv/", out: "/media/tv"},
+		{name: "Root", c: unix, in: "/", out: "/"},
+		{name: "Repeated slashes", c: unix, in: "/media/tv//show.mkv", out: "/media/tv/show.mkv"},
+		{name: "Dot segments", c: unix, in: "/media/./tv/../tv/show.mkv", out: "/media/tv/show.mkv"},
+		{name: "Backslash is a file name character outside of Windows", c: unix, in: `/media/a\b.mkv`, out: `/media/a\b.mkv`},
+		{name: "Case is kept", c: unix, in: "/Media/Show.mkv", out: "/Media/Show.mkv"},
+		{name: "Windows separators", c: windows, in: `C:\Media\TV\show.mkv`, out: "C:/Media/TV/show.mkv"},
+		{name: "Windows lower-case drive letter", c: windows, in: `c:\Media\show.mkv`, out: "C:/Media/show.mkv"},
+		{name: "Windows trailing separator", c: windows, in: `C:\Media\TV\`, out: "C:/Media/TV"},
+		{name: "Windows dot segments", c: windows, in: `c:\Media\.\TV\..\show.mkv`, out: "C:/Media/show.mkv"},
+		{name: "Folded case keeps paths which don't exist", c: folded, in: "/Missing/TV/Show.MKV", out: "/Missing/TV/Show.MKV"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if out := test.c.Canonicalize(test.in); out != test.out {
+				t.Errorf("expected %q but got %q", test.out, out)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeResolvesSymlinks(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "media")
+	link := filepath.Join(dir, "link")
+	if err := os.Mkdir(target, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks aren't supported: %v", err)
+	}
+
+	c := PathCanonicalizer{ResolveSymlinks: true}
+	if out := c.Canonicalize(filepath.ToSlash(link) + "/"); out != filepath.ToSlash(target) {
+		t.Errorf("expected %q but got %q", filepath.ToSlash(target), out)
+	}
+
+	missing := filepath.ToSlash(link) + "/missing.mkv"
+	if out := c.Canonicalize(missing); out != missing {
+		t.Errorf("expected a path which doesn't exist to only be cleaned but got %q", out)
+	}
+
+	if out := (PathCanonicalizer{}).Canonicalize(filepath.ToSlash(link)); out != filepath.ToSlash(link) {
+		t.Errorf("expected symlinks to be kept when resolving is disabled but got %q", out)
+	}
+}
+
+func TestCanonicalizeFoldsCaseToOnDiskCase(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "TV"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "TV", "Show.MKV"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.ToSlash(dir)
+
+	c := PathCanonicalizer{FoldCase: true}
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{name: "On-disk case", in: base + "/TV/Show.MKV", out: base + "/TV/Show.MKV"},
+		{name: "Other case", in: base + "/tv/show.mkv", out: base + "/TV/Show.MKV"},
+		{name: "Missing file", in: base + "/tv/Other.mkv", out: base + "/TV/Other.mkv"},
+		{name: "Missing folder", in: base + "/movies/Film.mkv", out: base + "/movies/Film.mkv"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if out := c.Canonicalize(test.in); out != test.out {
+				t.Errorf("expected %q but got %q", test.out, out)
+			}
+		})
+	}
+
+	paths := []string{base + "/tv/SHOW.mkv", base + "/Tv/show.MKV"}
+	c.CanonicalizeAll(paths)
+	for _, p := range paths {
+		if p != base+"/TV/Show.MKV" {
+			t.Errorf("expected CanonicalizeAll to return %q but got %q", base+"/TV/Show.MKV", p)
+		}
+	}
+}
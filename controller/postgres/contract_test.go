@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"os"
+	"testing"
+
+	"github.com/BrenekH/encodarr/controller/storertest"
+)
+
+// testDSNEnvVar names the environment variable that points the contract tests at a PostgreSQL server.
+// The tests empty every table in the database that it points to, so it must not be a production database.
+const testDSNEnvVar = "ENCODARR_TEST_POSTGRES_DSN"
+
+func TestStorerContract(t *testing.T) {
+	dsn := os.Getenv(testDSNEnvVar)
+	if dsn == "" {
+		t.Skipf("%v is not set", testDSNEnvVar)
+	}
+
+	storertest.Run(t, func(t *testing.T) storertest.Storers {
+		db, err := NewDatabase(dsn, &mockLogger{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Client.Close() })
+
+		// Every subtest expects empty storage.
+		_, err = db.Client.Exec("TRUNCATE libraries, files, history, dispatched_jobs, runners, job_attempts, quarantined_jobs, processed_files, job_events, skipped_paths, benchmarks, held_group_parts, file_snapshots, health_check_actions;")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hc := NewHealthCheckerAdapter(&db, &mockLogger{})
+		lm := NewLibraryManagerAdapter(&db, &mockLogger{})
+		rc := NewRunnerCommunicatorAdapter(&db, &mockLogger{})
+		fc := NewFileCacheAdapter(&db)
+		je := NewJobEventAdapter(&db)
+		ui := NewUserInterfacerAdapter(&db, &mockLogger{})
+
+		return storertest.Storers{HealthChecker: &hc, LibraryManager: &lm, RunnerCommunicator: &rc, FileCache: &fc, JobEvents: &je, UserInterfacer: &ui}
+	})
+}
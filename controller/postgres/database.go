@@ -0,0 +1,56 @@
+// Package postgres provides data storers that save the Controller's state in a PostgreSQL database.
+//
+// The PostgreSQL driver is only compiled in when building with the postgres build tag.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+const targetMigrationVersion uint = 26
+
+// Database is a wrapper around the database driver client
+type Database struct {
+	Client *sql.DB
+
+	// queryTimeout returns how long a single data storer call may take. Calls aren't limited if it is nil or returns 0.
+	queryTimeout func() time.Duration
+}
+
+// NewDatabase connects to the PostgreSQL server described by dsn and migrates the schema to the target version.
+func NewDatabase(dsn string, logger controller.Logger) (Database, error) {
+	client, err := open(dsn)
+	if err != nil {
+		return Database{Client: client}, err
+	}
+
+	if err = client.Ping(); err != nil {
+		return Database{Client: client}, err
+	}
+
+	err = gotoDBVer(client, targetMigrationVersion, logger)
+
+	return Database{Client: client}, err
+}
+
+// SetQueryTimeout sets the function which returns how long a single call to one of the adapters may take.
+// It is called for every call, so the timeout can be changed while the Controller is running.
+func (d *Database) SetQueryTimeout(timeout func() time.Duration) {
+	d.queryTimeout = timeout
+}
+
+// withTimeout returns a copy of ctx which is cancelled once the query timeout has elapsed.
+func (d *Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.queryTimeout == nil || d.queryTimeout() <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d.queryTimeout())
+}
@@ -0,0 +1,62 @@
+//go:build postgres
+// +build postgres
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq" // The PostgreSQL database driver
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// open opens a connection pool to the PostgreSQL server described by dsn.
+func open(dsn string) (*sql.DB, error) {
+	return sql.Open("postgres", dsn)
+}
+
+// gotoDBVer uses github.com/golang-migrate/migrate to move the db version up to the passed target version.
+// A database with a newer schema than targetVersion is left untouched and ErrDatabaseTooNew is returned.
+// Unlike the SQLite database, the migrations are read straight from the executable because a PostgreSQL server
+// is expected to have its own backup strategy.
+func gotoDBVer(client *sql.DB, targetVersion uint, logger controller.Logger) error {
+	src, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+
+	dbDriver, err := postgres.WithInstance(client, &postgres.Config{})
+	if err != nil {
+		return err
+	}
+
+	mig, err := migrate.NewWithInstance("iofs", src, "postgres", dbDriver)
+	if err != nil {
+		return err
+	}
+
+	currentVer, dirty, err := mig.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return err
+	}
+
+	if dirty {
+		return fmt.Errorf("database schema version %v is dirty because a migration failed part way through", currentVer)
+	}
+
+	if currentVer > targetVersion {
+		return fmt.Errorf("%w: database is at schema version %v but this Controller only supports up to version %v", controller.ErrDatabaseTooNew, currentVer, targetVersion)
+	}
+
+	if currentVer == targetVersion {
+		return nil
+	}
+
+	logger.Info("Migrating database to schema version %v.", targetVersion)
+	return mig.Migrate(targetVersion)
+}
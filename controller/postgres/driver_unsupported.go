@@ -0,0 +1,24 @@
+//go:build !postgres
+// +build !postgres
+
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// ErrNotSupported is returned by NewDatabase when the executable was built without the PostgreSQL driver.
+var ErrNotSupported = errors.New("this build of the Controller does not support PostgreSQL, rebuild it with the postgres build tag")
+
+// open always returns ErrNotSupported.
+func open(dsn string) (*sql.DB, error) {
+	return nil, ErrNotSupported
+}
+
+// gotoDBVer always returns ErrNotSupported.
+func gotoDBVer(client *sql.DB, targetVersion uint, logger controller.Logger) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// NewFileCacheAdapter returns an instantiated FileCacheAdapter.
+func NewFileCacheAdapter(db *Database) FileCacheAdapter {
+	return FileCacheAdapter{db: db}
+}
+
+// FileCacheAdapter satisfies the controller.FilesCacheDataStorer interface by turning interface
+// requests into SQL requests that are passed on to an underlying PostgreSQL database.
+type FileCacheAdapter struct {
+	db *Database
+}
+
+// Modtime uses a SQL SELECT statement to obtain the modtime associated with the provided path.
+func (a *FileCacheAdapter) Modtime(ctx context.Context, path string) (time.Time, error) {
+	ctx, cancel := a.db.withTimeout(ctx)
+	defer cancel()
+
+	row := a.db.Client.QueryRowContext(ctx, "SELECT modtime FROM files WHERE path = $1 AND modtime IS NOT NULL;", path)
+
+	var storedModtime time.Time
+
+	err := row.Scan(&storedModtime)
+	if err != nil {
+		return time.Now(), err
+	}
+
+	return storedModtime, nil
+}
+
+// Metadata uses a SQL SELECT statement to obtain the metadata associated with the provided path.
+func (a *FileCacheAdapter) Metadata(ctx context.Context, path string) (controller.FileMetadata, error) {
+	ctx, cancel := a.db.withTimeout(ctx)
+	defer cancel()
+
+	row := a.db.Client.QueryRowContext(ctx, "SELECT metadata FROM files WHERE path = $1 AND metadata IS NOT NULL;", path)
+
+	var storedMetadataBytes []byte
+
+	err := row.Scan(&storedMetadataBytes)
+	if err != nil {
+		return controller.FileMetadata{}, err
+	}
+
+	var storedMetadata controller.FileMetadata
+
+	err = json.Unmarshal(storedMetadataBytes, &storedMetadata)
+	if err != nil {
+		return controller.FileMetadata{}, err
+	}
+
+	return storedMetadata, nil
+}
+
+// SaveModtime uses the UPSERT syntax to update the modtime that is associated with the provided path in the database.
+func (a *FileCacheAdapter) SaveModtime(ctx context.Context, path string, t time.Time) error {
+	ctx, cancel := a.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := a.db.Client.ExecContext(ctx, "INSERT INTO files (path, modtime) VALUES ($1, $2) ON CONFLICT(path) DO UPDATE SET modtime=$2;",
+		path,
+		t,
+	)
+	return err
+}
+
+// SaveMetadata uses the UPSERT syntax to update the metadata that is associated with the provided path in the database.
+func (a *FileCacheAdapter) SaveMetadata(ctx context.Context, path string, f controller.FileMetadata) error {
+	ctx, cancel := a.db.withTimeout(ctx)
+	defer cancel()
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.db.Client.ExecContext(ctx, "INSERT INTO files (path, metadata) VALUES ($1, $2) ON CONFLICT(path) DO UPDATE SET metadata=$2;",
+		path,
+		string(b),
+	)
+	return err
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS quarantined_jobs;
+DROP TABLE IF EXISTS job_attempts;
+DROP TABLE IF EXISTS runners;
+DROP TABLE IF EXISTS dispatched_jobs;
+DROP TABLE IF EXISTS history;
+DROP TABLE IF EXISTS files;
+DROP TABLE IF EXISTS libraries;
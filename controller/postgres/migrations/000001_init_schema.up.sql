@@ -0,0 +1,63 @@
+CREATE TABLE IF NOT EXISTS libraries (
+    id integer PRIMARY KEY,
+    folder text,
+    priority integer,
+    fs_check_interval text,
+    cmd_decider_settings text DEFAULT '',
+    queue jsonb,
+    path_masks jsonb,
+    multi_part_patterns jsonb DEFAULT '[]'
+);
+
+CREATE TABLE IF NOT EXISTS files (
+    path text PRIMARY KEY,
+    modtime timestamptz,
+    metadata jsonb
+);
+
+CREATE TABLE IF NOT EXISTS history (
+    time_completed timestamptz,
+    filename text,
+    warnings jsonb,
+    errors jsonb,
+    uuid text,
+    runner text,
+    failed boolean DEFAULT false,
+    job jsonb
+);
+
+CREATE INDEX IF NOT EXISTS history_filename ON history(filename);
+CREATE INDEX IF NOT EXISTS history_uuid ON history(uuid);
+
+CREATE TABLE IF NOT EXISTS dispatched_jobs (
+    uuid text PRIMARY KEY,
+    job jsonb,
+    status jsonb,
+    runner text,
+    last_updated timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS dispatched_jobs_path ON dispatched_jobs((job->>'path'));
+
+CREATE TABLE IF NOT EXISTS runners (
+    uuid text NOT NULL UNIQUE,
+    name text NOT NULL UNIQUE,
+    display_name text,
+    version text,
+    last_seen timestamptz,
+    jobs_completed integer DEFAULT 0,
+    jobs_failed integer DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS job_attempts (
+    path text PRIMARY KEY,
+    attempts integer DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS quarantined_jobs (
+    path text PRIMARY KEY,
+    job jsonb,
+    attempts integer,
+    reason text,
+    time_quarantined timestamptz
+);
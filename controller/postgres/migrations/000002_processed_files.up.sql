@@ -0,0 +1,6 @@
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS skip_unchanged boolean DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS processed_files (
+    path text PRIMARY KEY,
+    modtime timestamptz
+);
@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS verification_command jsonb DEFAULT '[]';
@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS scan_on_startup boolean DEFAULT true;
@@ -0,0 +1,3 @@
+DELETE FROM libraries WHERE deleted_at IS NOT NULL;
+ALTER TABLE libraries DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE history DROP COLUMN IF EXISTS library_folder;
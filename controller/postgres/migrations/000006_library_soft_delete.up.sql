@@ -0,0 +1,2 @@
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+ALTER TABLE history ADD COLUMN IF NOT EXISTS library_folder text;
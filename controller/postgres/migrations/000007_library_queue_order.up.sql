@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS queue_order text DEFAULT 'path';
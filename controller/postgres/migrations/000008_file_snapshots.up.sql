@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS file_snapshots (
+    path text PRIMARY KEY,
+    library_id integer,
+    video_codec text,
+    width integer,
+    height integer,
+    duration real,
+    size bigint,
+    container text,
+    hdr boolean,
+    modtime timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS file_snapshots_library_id ON file_snapshots(library_id);
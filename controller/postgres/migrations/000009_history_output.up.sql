@@ -0,0 +1 @@
+ALTER TABLE history ADD COLUMN IF NOT EXISTS output jsonb;
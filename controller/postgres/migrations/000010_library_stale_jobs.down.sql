@@ -0,0 +1,2 @@
+ALTER TABLE libraries DROP COLUMN IF EXISTS stale_job_action;
+ALTER TABLE libraries DROP COLUMN IF EXISTS stale_job_timeout;
@@ -0,0 +1,2 @@
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS stale_job_timeout text DEFAULT '0s';
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS stale_job_action text DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE libraries DROP COLUMN IF EXISTS metadata_read_concurrency;
@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS metadata_read_concurrency integer DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE dispatched_jobs DROP COLUMN IF EXISTS lease_expires;
+ALTER TABLE dispatched_jobs DROP COLUMN IF EXISTS lease_duration;
@@ -0,0 +1,2 @@
+ALTER TABLE dispatched_jobs ADD COLUMN IF NOT EXISTS lease_duration text DEFAULT '0s';
+ALTER TABLE dispatched_jobs ADD COLUMN IF NOT EXISTS lease_expires bigint DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE libraries DROP COLUMN IF EXISTS max_queued_bytes;
@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS max_queued_bytes bigint DEFAULT 0;
@@ -0,0 +1,8 @@
+DELETE FROM dispatched_jobs WHERE EXISTS (
+    SELECT 1 FROM dispatched_jobs AS newer
+    WHERE newer.job->>'path' = dispatched_jobs.job->>'path'
+    AND (newer.last_updated > dispatched_jobs.last_updated OR (newer.last_updated = dispatched_jobs.last_updated AND newer.uuid > dispatched_jobs.uuid))
+);
+
+DROP INDEX IF EXISTS dispatched_jobs_path;
+CREATE UNIQUE INDEX IF NOT EXISTS dispatched_jobs_path ON dispatched_jobs((job->>'path'));
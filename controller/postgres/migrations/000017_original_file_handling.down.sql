@@ -0,0 +1,2 @@
+ALTER TABLE libraries DROP COLUMN IF EXISTS original_file_handling;
+ALTER TABLE history DROP COLUMN IF EXISTS original_path;
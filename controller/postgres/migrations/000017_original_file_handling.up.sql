@@ -0,0 +1,2 @@
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS original_file_handling text DEFAULT '';
+ALTER TABLE history ADD COLUMN IF NOT EXISTS original_path text DEFAULT '';
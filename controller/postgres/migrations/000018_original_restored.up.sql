@@ -0,0 +1 @@
+ALTER TABLE history ADD COLUMN IF NOT EXISTS original_restored boolean DEFAULT false;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS job_events (
+    id bigserial PRIMARY KEY,
+    time timestamptz,
+    job_uuid text,
+    library_id integer,
+    component text,
+    level text,
+    message text
+);
+
+CREATE INDEX IF NOT EXISTS job_events_job_uuid ON job_events(job_uuid);
+CREATE INDEX IF NOT EXISTS job_events_time ON job_events(time);
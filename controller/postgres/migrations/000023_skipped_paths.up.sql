@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS skipped_paths (
+    path text PRIMARY KEY,
+    time_skipped timestamptz
+);
@@ -0,0 +1,2 @@
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS metadata_read_timeout text DEFAULT '0s';
+ALTER TABLE libraries ADD COLUMN IF NOT EXISTS metadata_read_args jsonb DEFAULT '[]';
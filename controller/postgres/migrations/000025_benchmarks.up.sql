@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS benchmarks (
+    uuid text,
+    path text,
+    library_id integer,
+    runner text,
+    settings text,
+    command jsonb,
+    failed boolean DEFAULT false,
+    errors jsonb,
+    source_size bigint,
+    time_completed timestamptz,
+    elapsed text,
+    fps double precision,
+    projected_size bigint
+);
+
+CREATE INDEX IF NOT EXISTS benchmarks_path ON benchmarks(path);
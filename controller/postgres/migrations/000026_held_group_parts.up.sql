@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS held_group_parts (
+    id bigserial PRIMARY KEY,
+    uuid text NOT NULL UNIQUE,
+    group_key text,
+    completed_job jsonb,
+    output jsonb,
+    in_file text,
+    captions_file text,
+    dispatched_job jsonb
+);
@@ -0,0 +1,792 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// NewUserInterfacerAdapter returns an instantiated UserInterfacerAdapter.
+func NewUserInterfacerAdapter(db *Database, logger controller.Logger) UserInterfacerAdapter {
+	return UserInterfacerAdapter{db: db, logger: logger}
+}
+
+// UserInterfacerAdapter is a struct that satisfies the interface that connects a UserInterfacer
+// to a storage medium.
+type UserInterfacerAdapter struct {
+	db     *Database
+	logger controller.Logger
+}
+
+// DispatchedJobs returns the content of the dispatched jobs table.
+func (u *UserInterfacerAdapter) DispatchedJobs(ctx context.Context) ([]controller.DispatchedJob, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	return dispatchedJobs(ctx, u.db, u.logger)
+}
+
+// dispatchedJobs returns the content of the dispatched jobs table. It is shared by the adapters which read the
+// dispatched jobs. Rows which can't be read are logged and skipped.
+func dispatchedJobs(ctx context.Context, db *Database, logger controller.Logger) ([]controller.DispatchedJob, error) {
+	returnSlice := make([]controller.DispatchedJob, 0)
+
+	rows, err := db.Client.QueryContext(ctx, "SELECT uuid, runner, job, status, last_updated, lease_duration, lease_expires FROM dispatched_jobs;")
+	if err != nil {
+		return returnSlice, err
+	}
+
+	for rows.Next() {
+		// Variables to scan into
+		dj := controller.DispatchedJob{}
+		bJ := []byte("") // bytesJob. For intermediate loading into when scanning the rows
+		bS := []byte("") // bytesStatus. For intermediate loading into when scanning the rows
+		var leaseDuration string
+		var leaseExpires int64
+
+		err = rows.Scan(&dj.UUID, &dj.Runner, &bJ, &bS, &dj.LastUpdated, &leaseDuration, &leaseExpires)
+		if err != nil {
+			logger.Error(err.Error())
+			continue
+		}
+
+		err = setLease(&dj, leaseDuration, leaseExpires)
+		if err != nil {
+			logger.Error(err.Error())
+			continue
+		}
+
+		err = json.Unmarshal(bJ, &dj.Job)
+		if err != nil {
+			logger.Error(err.Error())
+			continue
+		}
+
+		err = json.Unmarshal(bS, &dj.Status)
+		if err != nil {
+			logger.Error(err.Error())
+			continue
+		}
+
+		returnSlice = append(returnSlice, dj)
+	}
+	rows.Close()
+
+	return returnSlice, nil
+}
+
+// HistoryEntries returns the content of the history table.
+func (u *UserInterfacerAdapter) HistoryEntries(ctx context.Context) ([]controller.History, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	returnSlice := make([]controller.History, 0)
+
+	rows, err := u.db.Client.QueryContext(ctx, "SELECT time_completed, filename, warnings, errors FROM history;")
+	if err != nil {
+		return returnSlice, err
+	}
+
+	for rows.Next() {
+		dh := controller.History{}
+		bW := []byte("")
+		bE := []byte("")
+
+		err = rows.Scan(&dh.DateTimeCompleted, &dh.Filename, &bW, &bE)
+		if err != nil {
+			u.logger.Error(err.Error())
+			continue
+		}
+
+		err = json.Unmarshal(bW, &dh.Warnings)
+		if err != nil {
+			u.logger.Error(err.Error())
+			continue
+		}
+
+		err = json.Unmarshal(bE, &dh.Errors)
+		if err != nil {
+			u.logger.Error(err.Error())
+			continue
+		}
+
+		returnSlice = append(returnSlice, dh)
+	}
+	rows.Close()
+
+	return returnSlice, nil
+}
+
+// HistoryEntry returns the history entry with the provided job UUID.
+func (u *UserInterfacerAdapter) HistoryEntry(ctx context.Context, uuid controller.UUID) (controller.History, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	return scanHistoryEntry(u.db.Client.QueryRowContext(ctx, "SELECT "+historyEntryColumns+" FROM history WHERE uuid = $1;", uuid))
+}
+
+// HistoryEntryByOriginalPath returns the newest history entry whose original file was kept at the provided path.
+func (u *UserInterfacerAdapter) HistoryEntryByOriginalPath(ctx context.Context, path string) (controller.History, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	return scanHistoryEntry(u.db.Client.QueryRowContext(ctx, "SELECT "+historyEntryColumns+" FROM history WHERE original_path = $1 ORDER BY time_completed DESC LIMIT 1;", path))
+}
+
+// MarkOriginalRestored sets the original_restored column of the history entry with the provided job UUID.
+func (u *UserInterfacerAdapter) MarkOriginalRestored(ctx context.Context, uuid controller.UUID) error {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	res, err := u.db.Client.ExecContext(ctx, "UPDATE history SET original_restored = true WHERE uuid = $1;", uuid)
+	if err != nil {
+		return err
+	}
+	return errIfNoRowsAffected(res)
+}
+
+// historyEntryColumns are the columns of the history table which scanHistoryEntry reads.
+const historyEntryColumns = "time_completed, filename, warnings, errors, uuid, COALESCE(runner, ''), COALESCE(failed, false), job, COALESCE(library_folder, ''), COALESCE(output, 'null'::jsonb), COALESCE(completion, 'null'::jsonb), COALESCE(original_path, ''), COALESCE(original_restored, false)"
+
+// scanHistoryEntry reads a history entry from a row holding the historyEntryColumns.
+func scanHistoryEntry(row *sql.Row) (controller.History, error) {
+	h := controller.History{}
+	bW := []byte("")
+	bE := []byte("")
+	bJ := []byte("")
+	bO := []byte("")
+	bC := []byte("")
+
+	if err := row.Scan(&h.DateTimeCompleted, &h.Filename, &bW, &bE, &h.UUID, &h.Runner, &h.Failed, &bJ, &h.LibraryFolder, &bO, &bC, &h.OriginalPath, &h.OriginalRestored); err != nil {
+		return h, err
+	}
+
+	if err := json.Unmarshal(bW, &h.Warnings); err != nil {
+		return h, err
+	}
+
+	if err := json.Unmarshal(bE, &h.Errors); err != nil {
+		return h, err
+	}
+
+	if err := json.Unmarshal(bJ, &h.Job); err != nil {
+		return h, err
+	}
+
+	if err := json.Unmarshal(bO, &h.Output); err != nil {
+		return h, err
+	}
+
+	if err := json.Unmarshal(bC, &h.Completion); err != nil {
+		return h, err
+	}
+
+	return h, nil
+}
+
+// DeleteLibrary marks the specified library as deleted at t. Its version is incremented so that saves which
+// started before the deletion conflict instead of succeeding.
+func (u *UserInterfacerAdapter) DeleteLibrary(ctx context.Context, id int, t time.Time) error {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	return deleteLibrary(ctx, u.db, id, t)
+}
+
+// deleteLibrary marks the specified library as deleted at t. It is shared by the adapters which delete libraries.
+func deleteLibrary(ctx context.Context, db *Database, id int, t time.Time) error {
+	_, err := db.Client.ExecContext(ctx, "UPDATE libraries SET deleted_at = $2, version = version + 1 WHERE id = $1 AND deleted_at IS NULL;", id, t)
+	return err
+}
+
+// DeletedLibraries returns the libraries which are marked as deleted.
+func (u *UserInterfacerAdapter) DeletedLibraries(ctx context.Context) ([]controller.Library, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := u.db.Client.QueryContext(ctx, "SELECT id, folder, priority, fs_check_interval, cmd_decider_settings, queue, path_masks, multi_part_patterns, skip_unchanged, verification_command, scan_on_startup, queue_order, stale_job_timeout, stale_job_action, metadata_read_concurrency, max_queued_bytes, original_file_handling, preserve_modtime, move_sidecars, notifications, metadata_read_timeout, metadata_read_args, version, deleted_at FROM libraries WHERE deleted_at IS NOT NULL;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	returnSlice := make([]controller.Library, 0)
+	for rows.Next() {
+		d := dbLibrary{}
+		if err = rows.Scan(&d.ID, &d.Folder, &d.Priority, &d.FsCheckInterval, &d.CommandDeciderSettings, &d.Queue, &d.PathMasks, &d.MultiPartPatterns, &d.SkipUnchanged, &d.VerificationCommand, &d.ScanOnStartup, &d.QueueOrder, &d.StaleJobTimeout, &d.StaleJobAction, &d.MetadataReadConcurrency, &d.MaxQueuedBytes, &d.OriginalFileHandling, &d.PreserveModtime, &d.MoveSidecars, &d.Notifications, &d.MetadataReadTimeout, &d.MetadataReadArgs, &d.Version, &d.DeletedAt); err != nil {
+			return nil, err
+		}
+
+		lib, err := fromDBLibrary(d)
+		if err != nil {
+			return nil, err
+		}
+		returnSlice = append(returnSlice, lib)
+	}
+
+	return returnSlice, rows.Err()
+}
+
+// RestoreLibrary clears the deleted mark of the specified library.
+func (u *UserInterfacerAdapter) RestoreLibrary(ctx context.Context, id int) error {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	return restoreLibrary(ctx, u.db, id)
+}
+
+// restoreLibrary clears the deleted mark of the specified library. It is shared by the adapters which restore libraries.
+func restoreLibrary(ctx context.Context, db *Database, id int) error {
+	res, err := db.Client.ExecContext(ctx, "UPDATE libraries SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL;", id)
+	if err != nil {
+		return err
+	}
+	return errIfNoRowsAffected(res)
+}
+
+// ImportLibraries uses the UPSERT syntax inside of a transaction to save the provided libraries.
+func (u *UserInterfacerAdapter) ImportLibraries(ctx context.Context, libs []controller.Library) error {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := u.db.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, lib := range libs {
+		d, err := toDBLibrary(lib)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO libraries (id, folder, priority, fs_check_interval, cmd_decider_settings, queue, path_masks, multi_part_patterns, skip_unchanged, verification_command, scan_on_startup, queue_order, stale_job_timeout, stale_job_action, metadata_read_concurrency, max_queued_bytes, original_file_handling, preserve_modtime, move_sidecars, notifications, metadata_read_timeout, metadata_read_args, version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, 1) ON CONFLICT(id) DO UPDATE SET folder=$2, priority=$3, fs_check_interval=$4, cmd_decider_settings=$5, path_masks=$7, multi_part_patterns=$8, skip_unchanged=$9, verification_command=$10, scan_on_startup=$11, queue_order=$12, stale_job_timeout=$13, stale_job_action=$14, metadata_read_concurrency=$15, max_queued_bytes=$16, original_file_handling=$17, preserve_modtime=$18, move_sidecars=$19, notifications=$20, metadata_read_timeout=$21, metadata_read_args=$22, version=libraries.version + 1, deleted_at=NULL;",
+			d.ID,
+			d.Folder,
+			d.Priority,
+			d.FsCheckInterval,
+			d.CommandDeciderSettings,
+			string(d.Queue),
+			string(d.PathMasks),
+			string(d.MultiPartPatterns),
+			d.SkipUnchanged,
+			string(d.VerificationCommand),
+			d.ScanOnStartup,
+			d.QueueOrder,
+			d.StaleJobTimeout,
+			d.StaleJobAction,
+			d.MetadataReadConcurrency,
+			d.MaxQueuedBytes,
+			d.OriginalFileHandling,
+			d.PreserveModtime,
+			d.MoveSidecars,
+			string(d.Notifications),
+			d.MetadataReadTimeout,
+			string(d.MetadataReadArgs),
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ImportFileStates uses SQL INSERT statements in a single transaction to save the provided processed modtimes and quarantined jobs.
+func (u *UserInterfacerAdapter) ImportFileStates(ctx context.Context, processed map[string]time.Time, quarantined []controller.QuarantinedJob) error {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := u.db.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for path, t := range processed {
+		if _, err = tx.ExecContext(ctx, "INSERT INTO processed_files (path, modtime) VALUES ($1, $2) ON CONFLICT(path) DO UPDATE SET modtime=$2;", path, t); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, q := range quarantined {
+		bJob, err := json.Marshal(q.Job)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO quarantined_jobs (path, job, attempts, reason, time_quarantined) VALUES ($1, $2, $3, $4, $5) ON CONFLICT(path) DO UPDATE SET job=$2, attempts=$3, reason=$4, time_quarantined=$5;",
+			q.Job.Path,
+			string(bJob),
+			q.Attempts,
+			q.Reason,
+			q.DateTimeQuarantined,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ClearQuarantine deletes the provided path from the quarantined_jobs and job_attempts tables inside of a transaction.
+func (u *UserInterfacerAdapter) ClearQuarantine(ctx context.Context, path string) error {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := u.db.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM quarantined_jobs WHERE path = $1;", path)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = errIfNoRowsAffected(res); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM job_attempts WHERE path = $1;", path); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SkipPaths uses SQL INSERT statements in a single transaction to add the provided paths to the skipped_paths table.
+func (u *UserInterfacerAdapter) SkipPaths(ctx context.Context, skipped []controller.SkippedPath) error {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := u.db.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, s := range skipped {
+		if _, err = tx.ExecContext(ctx, "INSERT INTO skipped_paths (path, time_skipped) VALUES ($1, $2) ON CONFLICT(path) DO NOTHING;", s.Path, s.DateTimeSkipped); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SkippedPaths returns the content of the skipped_paths table, sorted by path.
+func (u *UserInterfacerAdapter) SkippedPaths(ctx context.Context) ([]controller.SkippedPath, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := u.db.Client.QueryContext(ctx, "SELECT path, time_skipped FROM skipped_paths ORDER BY path;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skipped := make([]controller.SkippedPath, 0)
+	for rows.Next() {
+		var s controller.SkippedPath
+		if err = rows.Scan(&s.Path, &s.DateTimeSkipped); err != nil {
+			return nil, err
+		}
+		skipped = append(skipped, s)
+	}
+	return skipped, rows.Err()
+}
+
+// UnskipPath deletes the provided path from the skipped_paths table.
+func (u *UserInterfacerAdapter) UnskipPath(ctx context.Context, path string) error {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	res, err := u.db.Client.ExecContext(ctx, "DELETE FROM skipped_paths WHERE path = $1;", path)
+	if err != nil {
+		return err
+	}
+	return errIfNoRowsAffected(res)
+}
+
+// BenchmarkResults returns the rows of the benchmarks table for the provided path, or every row if it is empty,
+// newest first.
+func (u *UserInterfacerAdapter) BenchmarkResults(ctx context.Context, path string) ([]controller.BenchmarkResult, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := u.db.Client.QueryContext(ctx, "SELECT uuid, path, library_id, runner, settings, command, failed, errors, source_size, time_completed, elapsed, fps, projected_size FROM benchmarks WHERE $1 = '' OR path = $1 ORDER BY time_completed DESC;", path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]controller.BenchmarkResult, 0)
+	for rows.Next() {
+		var r controller.BenchmarkResult
+		var bC, bE []byte
+		var elapsed string
+		if err = rows.Scan(&r.UUID, &r.Path, &r.LibraryID, &r.Runner, &r.Settings, &bC, &r.Failed, &bE, &r.SourceSize, &r.DateTimeCompleted, &elapsed, &r.FPS, &r.ProjectedSize); err != nil {
+			return nil, err
+		}
+
+		if err = json.Unmarshal(bC, &r.Command); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(bE, &r.Errors); err != nil {
+			return nil, err
+		}
+		if r.Elapsed, err = time.ParseDuration(elapsed); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// Runners returns the content of the runners table.
+func (u *UserInterfacerAdapter) Runners(ctx context.Context) ([]controller.Runner, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	return runners(ctx, u.db, u.logger)
+}
+
+// runners returns the content of the runners table. It is shared by the adapters which read the Runners.
+func runners(ctx context.Context, db *Database, logger controller.Logger) ([]controller.Runner, error) {
+	returnSlice := make([]controller.Runner, 0)
+
+	rows, err := db.Client.QueryContext(ctx, "SELECT uuid, name, display_name, version, last_seen, jobs_completed, jobs_failed FROM runners;")
+	if err != nil {
+		return returnSlice, err
+	}
+
+	for rows.Next() {
+		r := controller.Runner{}
+		if err = rows.Scan(&r.UUID, &r.Name, &r.DisplayName, &r.Version, &r.LastSeen, &r.JobsCompleted, &r.JobsFailed); err != nil {
+			logger.Error(err.Error())
+			continue
+		}
+		returnSlice = append(returnSlice, r)
+	}
+	rows.Close()
+
+	return returnSlice, nil
+}
+
+// RenameRunner changes the display name of the specified Runner.
+func (u *UserInterfacerAdapter) RenameRunner(ctx context.Context, uuid controller.UUID, displayName string) error {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	res, err := u.db.Client.ExecContext(ctx, "UPDATE runners SET display_name = $1 WHERE uuid = $2;", displayName, uuid)
+	if err != nil {
+		return err
+	}
+	return errIfNoRowsAffected(res)
+}
+
+// DeleteRunner deletes the specified Runner from the runners table.
+func (u *UserInterfacerAdapter) DeleteRunner(ctx context.Context, uuid controller.UUID) error {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	res, err := u.db.Client.ExecContext(ctx, "DELETE FROM runners WHERE uuid = $1;", uuid)
+	if err != nil {
+		return err
+	}
+	return errIfNoRowsAffected(res)
+}
+
+// DeleteStaleRunners deletes every Runner which was last seen before notSeenSince.
+func (u *UserInterfacerAdapter) DeleteStaleRunners(ctx context.Context, notSeenSince time.Time) (int, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	res, err := u.db.Client.ExecContext(ctx, "DELETE FROM runners WHERE last_seen < $1;", notSeenSince.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// errIfNoRowsAffected returns sql.ErrNoRows if the result didn't affect any rows.
+func errIfNoRowsAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SearchFiles uses SQL ILIKE queries to find files in the library queues, dispatched jobs, and history tables whose path
+// matches pattern. If pattern contains a '*' or '?', it is treated as a glob against the whole path. Otherwise, it is
+// treated as a substring.
+func (u *UserInterfacerAdapter) SearchFiles(ctx context.Context, pattern string, limit int) ([]controller.SearchResult, bool, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	likePattern := toLikePattern(pattern)
+	results := make([]controller.SearchResult, 0)
+
+	// Query for one more than the limit so that we know if more results are available.
+	remaining := func() int { return limit + 1 - len(results) }
+
+	// Library queues
+	// A nil queue is stored as a JSON null instead of an array, which jsonb_array_elements refuses to expand.
+	rows, err := u.db.Client.QueryContext(ctx, `SELECT l.id, q->>'uuid', q->>'path'
+		FROM libraries l, jsonb_array_elements(CASE jsonb_typeof(l.queue->'Items') WHEN 'array' THEN l.queue->'Items' ELSE '[]'::jsonb END) q
+		WHERE l.deleted_at IS NULL AND q->>'path' ILIKE $1 ESCAPE '\' LIMIT $2;`, likePattern, remaining())
+	if err != nil {
+		return results, false, err
+	}
+	for rows.Next() {
+		r := controller.SearchResult{Location: "queue", State: "queued"}
+		if err = rows.Scan(&r.LibraryID, &r.UUID, &r.Path); err != nil {
+			u.logger.Error(err.Error())
+			continue
+		}
+		results = append(results, r)
+	}
+	rows.Close()
+
+	// Dispatched jobs
+	if remaining() > 0 {
+		rows, err = u.db.Client.QueryContext(ctx, `SELECT uuid, COALESCE((job->>'library_id')::int, -1), job->>'path', status FROM dispatched_jobs
+			WHERE job->>'path' ILIKE $1 ESCAPE '\' LIMIT $2;`, likePattern, remaining())
+		if err != nil {
+			return results, false, err
+		}
+		for rows.Next() {
+			r := controller.SearchResult{Location: "dispatched"}
+			bS := []byte("")
+			if err = rows.Scan(&r.UUID, &r.LibraryID, &r.Path, &bS); err != nil {
+				u.logger.Error(err.Error())
+				continue
+			}
+
+			status := controller.JobStatus{}
+			if err = json.Unmarshal(bS, &status); err != nil {
+				u.logger.Error(err.Error())
+			}
+			r.State = status.Stage
+			if r.State == "" {
+				r.State = "dispatched"
+			}
+
+			results = append(results, r)
+		}
+		rows.Close()
+	}
+
+	// History
+	if remaining() > 0 {
+		// Entries recorded without the job details don't have a job, so their library isn't known.
+		rows, err = u.db.Client.QueryContext(ctx, `SELECT COALESCE(uuid, ''),
+				CASE WHEN COALESCE(job->>'uuid', '') = '' THEN -1 ELSE COALESCE((job->>'library_id')::int, -1) END,
+				filename, errors
+			FROM history WHERE filename ILIKE $1 ESCAPE '\' ORDER BY time_completed DESC LIMIT $2;`, likePattern, remaining())
+		if err != nil {
+			return results, false, err
+		}
+		for rows.Next() {
+			r := controller.SearchResult{Location: "history", State: "completed"}
+			bE := []byte("")
+			if err = rows.Scan(&r.UUID, &r.LibraryID, &r.Path, &bE); err != nil {
+				u.logger.Error(err.Error())
+				continue
+			}
+
+			var errs []string
+			if err = json.Unmarshal(bE, &errs); err == nil && len(errs) > 0 {
+				r.State = "failed"
+			}
+
+			results = append(results, r)
+		}
+		rows.Close()
+	}
+
+	if len(results) > limit {
+		return results[:limit], true, nil
+	}
+	return results, false, nil
+}
+
+// toLikePattern converts a substring or glob search pattern into an SQL LIKE pattern that uses '\' as the escape character.
+func toLikePattern(pattern string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(pattern)
+
+	if !strings.ContainsAny(pattern, "*?") {
+		return "%" + escaped + "%"
+	}
+
+	return strings.NewReplacer("*", "%", "?", "_").Replace(escaped)
+}
+
+// QueryFileSnapshots uses SQL SELECT statements to count the file snapshots that match filter and to obtain
+// the paths of up to limit of them.
+func (u *UserInterfacerAdapter) QueryFileSnapshots(ctx context.Context, filter controller.FileSnapshotFilter, limit int) ([]string, int, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	where, args := fileSnapshotConditions(filter)
+
+	var count int
+	if err := u.db.Client.QueryRowContext(ctx, "SELECT count(*) FROM file_snapshots WHERE "+where+";", args...).Scan(&count); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := u.db.Client.QueryContext(ctx, fmt.Sprintf("SELECT path FROM file_snapshots WHERE %v ORDER BY path LIMIT $%v;", where, len(args)+1), append(args, limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	paths := make([]string, 0)
+	for rows.Next() {
+		var path string
+		if err = rows.Scan(&path); err != nil {
+			return nil, 0, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, count, rows.Err()
+}
+
+// fileSnapshotConditions returns the WHERE clause that selects the file snapshots of libraries which aren't
+// deleted that match filter, and the arguments for its placeholders.
+func fileSnapshotConditions(filter controller.FileSnapshotFilter) (string, []interface{}) {
+	conditions := []string{"library_id IN (SELECT id FROM libraries WHERE deleted_at IS NULL)"}
+	args := make([]interface{}, 0)
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.LibraryID != nil {
+		add("library_id = $%v", *filter.LibraryID)
+	}
+	if filter.VideoCodec != "" {
+		add("lower(video_codec) = lower($%v)", filter.VideoCodec)
+	}
+	if filter.Container != "" {
+		add("lower(container) = lower($%v)", filter.Container)
+	}
+	if filter.HDR != nil {
+		add("hdr = $%v", *filter.HDR)
+	}
+	if filter.MinHeight > 0 {
+		add("height >= $%v", filter.MinHeight)
+	}
+	if filter.MaxHeight > 0 {
+		add("height <= $%v", filter.MaxHeight)
+	}
+	if filter.MinSize > 0 {
+		add("size >= $%v", filter.MinSize)
+	}
+	if filter.MaxSize > 0 {
+		add("size <= $%v", filter.MaxSize)
+	}
+	if filter.MinDuration > 0 {
+		add("duration >= $%v", filter.MinDuration)
+	}
+	if filter.MaxDuration > 0 {
+		add("duration <= $%v", filter.MaxDuration)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// Backup always returns controller.ErrBackupNotSupported. PostgreSQL databases should be backed up with pg_dump.
+func (u *UserInterfacerAdapter) Backup(w io.Writer) error {
+	return controller.ErrBackupNotSupported
+}
+
+// HealthCheckActions returns up to limit of the most recent rows of the health_check_actions table, newest first.
+func (u *UserInterfacerAdapter) HealthCheckActions(ctx context.Context, limit int) ([]controller.HealthCheckAction, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := u.db.Client.QueryContext(ctx, "SELECT time, job_uuid, runner, path, library_id, action, reason FROM health_check_actions ORDER BY time DESC LIMIT $1;", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := make([]controller.HealthCheckAction, 0)
+	for rows.Next() {
+		var a controller.HealthCheckAction
+		if err = rows.Scan(&a.Time, &a.JobUUID, &a.Runner, &a.Path, &a.LibraryID, &a.Action, &a.Reason); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+
+	return actions, rows.Err()
+}
+
+// HealthCheckActionCounts counts the rows of the health_check_actions table by action.
+func (u *UserInterfacerAdapter) HealthCheckActionCounts(ctx context.Context) (map[controller.StaleJobAction]int, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := u.db.Client.QueryContext(ctx, "SELECT action, COUNT(*) FROM health_check_actions GROUP BY action;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[controller.StaleJobAction]int)
+	for rows.Next() {
+		var action controller.StaleJobAction
+		var count int
+		if err = rows.Scan(&action, &count); err != nil {
+			return nil, err
+		}
+		counts[action] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// JobEvents returns the rows of the job_events table which belong to the job with the provided UUID, oldest first.
+func (u *UserInterfacerAdapter) JobEvents(ctx context.Context, uuid controller.UUID) ([]controller.JobEvent, error) {
+	ctx, cancel := u.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := u.db.Client.QueryContext(ctx, "SELECT time, job_uuid, library_id, component, level, message FROM job_events WHERE job_uuid = $1 ORDER BY time ASC, id ASC;", uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]controller.JobEvent, 0)
+	for rows.Next() {
+		var e controller.JobEvent
+		if err = rows.Scan(&e.Time, &e.JobUUID, &e.LibraryID, &e.Component, &e.Level, &e.Message); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
@@ -8,7 +8,7 @@ import (
 
 // Run is the "top-level" function for running the Encodarr Controller. It calls all of the injected
 // dependencies in order to operate.
-func Run(ctx *context.Context, logger Logger, hc HealthChecker, lm LibraryManager, rc RunnerCommunicator, ui UserInterfacer, setLogLvl func(), testMode bool) {
+func Run(ctx context.Context, logger Logger, hc HealthChecker, lm LibraryManager, rc RunnerCommunicator, ui UserInterfacer, setLogLvl func(), testMode bool) {
 	wg := sync.WaitGroup{}
 	hc.Start(ctx)
 	lm.Start(ctx, &wg)
@@ -33,33 +33,66 @@ func Run(ctx *context.Context, logger Logger, hc HealthChecker, lm LibraryManage
 			break
 		}
 
-		// Run health check and null any unresponsive Runners
-		uuidsToNull := hc.Run()
+		// Run health check, null the jobs whose leases expired, and requeue or fail them
+		staleJobs := hc.Run()
+		uuidsToNull := make([]UUID, 0, len(staleJobs))
+		for _, v := range staleJobs {
+			uuidsToNull = append(uuidsToNull, v.DispatchedJob.UUID)
+		}
 		rc.NullifyUUIDs(uuidsToNull)
+		lm.HandleStaleJobs(staleJobs)
 
-		// Update the UserInterfacer library settings cache
+		// Update the UserInterfacer library settings cache and alert the user if jobs are waiting without any Runners
 		if ls, err := lm.LibrarySettings(); err == nil {
 			ui.SetLibrarySettings(ls)
+			ui.SetNoRunnersSince(hc.CheckRunnersAvailable(jobsQueued(ls)))
 		}
 
 		// Apply user changes to library settings
 		lsUserChanges := ui.NewLibrarySettings()
 		lm.UpdateLibrarySettings(lsUserChanges)
 
+		// Requeue the libraries the user asked for. This also starts a scan of them.
+		for _, id := range ui.RequeueRequests() {
+			if err := lm.RequeueLibrary(id); err != nil {
+				logger.Error("Failed to requeue Library (ID: %v): %v", id, err)
+			}
+		}
+
+		// Start user requested library scans and show which libraries are being scanned
+		lm.ScanLibraries(ui.ScanRequests())
+		ui.SetScanningLibraries(lm.ScanningLibraries())
+
 		// Update waiting runners to be shown to the user
 		wr := rc.WaitingRunners()
 		ui.SetWaitingRunners(wr)
 
-		// Send new job to the RunnerCommunicator if there is a waiting Runner
+		// Prepare the benchmarks the user asked for
+		lm.QueueBenchmarks(ui.BenchmarkRequests())
+
+		// Send new job to the RunnerCommunicator if there is a waiting Runner. Benchmarks go before the queued jobs.
 		if rc.NeedNewJob() {
-			if nj, err := lm.PopNewJob(); err == nil {
-				rc.NewJob(nj)
+			if bj, err := lm.PopBenchmarkJob(wr); err == nil {
+				rc.NewJob(bj, hc.LeaseDuration(bj.LibraryID))
+			} else if nj, err := lm.PopNewJob(); err == nil {
+				rc.NewJob(nj, hc.LeaseDuration(nj.LibraryID))
 			}
 		}
 
-		// Import completed jobs
+		// Import completed jobs and show which of them are waiting for space in their library
 		cj := rc.CompletedJobs()
 		lm.ImportCompletedJobs(cj)
+		ui.SetAwaitingSpaceJobs(lm.AwaitingSpaceJobs())
+
+		// Remove the received files which were left behind, ex. by a crash while a job was being received
+		rc.CleanStaging(lm.StagedFiles())
+
+		// Show where the queued jobs are in the dispatch order
+		ui.SetDispatchPlan(lm.DispatchPlan())
+
+		// Show the latest metrics and whether the datastore is down
+		ui.SetMetricsSnapshot(lm.MetricsSnapshot())
+		ui.SetDatastoreHealth(lm.Health())
 
 		// Apply the log level to the actual handler
 		setLogLvl()
@@ -68,3 +101,13 @@ func Run(ctx *context.Context, logger Logger, hc HealthChecker, lm LibraryManage
 	// Wait for goroutines to shut down
 	wg.Wait()
 }
+
+// jobsQueued returns whether or not any of the provided libraries has a job in its queue.
+func jobsQueued(libs []Library) bool {
+	for _, lib := range libs {
+		if !lib.Queue.Empty() {
+			return true
+		}
+	}
+	return false
+}
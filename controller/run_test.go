@@ -14,7 +14,7 @@ func TestRunFuncsCalled(t *testing.T) {
 	mRunnerCommunicator := mockRunnerCommunicator{}
 	mUserInterfacer := mockUserInterfacer{}
 
-	Run(&ctx, &mLogger, &mHealthChecker, &mLibraryManager, &mRunnerCommunicator, &mUserInterfacer, func() {}, true)
+	Run(ctx, &mLogger, &mHealthChecker, &mLibraryManager, &mRunnerCommunicator, &mUserInterfacer, func() {}, true)
 
 	// Check that HealthChecker methods were run
 	if !mHealthChecker.startCalled {
@@ -23,6 +23,12 @@ func TestRunFuncsCalled(t *testing.T) {
 	if !mHealthChecker.runCalled {
 		t.Errorf("HealthChecker.Run() wasn't called")
 	}
+	if !mHealthChecker.leaseDurationCalled {
+		t.Errorf("HealthChecker.LeaseDuration() wasn't called")
+	}
+	if !mHealthChecker.checkRunnersAvailableCalled {
+		t.Errorf("HealthChecker.CheckRunnersAvailable() wasn't called")
+	}
 
 	// Check that LibraryManager methods were run
 	if !mLibraryManager.startCalled {
@@ -40,6 +46,39 @@ func TestRunFuncsCalled(t *testing.T) {
 	if !mLibraryManager.updateLibSettingsCalled {
 		t.Errorf("LibraryManager.UpdateLibrarySettings wasn't called")
 	}
+	if !mLibraryManager.scanLibrariesCalled {
+		t.Errorf("LibraryManager.ScanLibraries() wasn't called")
+	}
+	if !mLibraryManager.scanningLibsCalled {
+		t.Errorf("LibraryManager.ScanningLibraries() wasn't called")
+	}
+	if !mLibraryManager.awaitingSpaceCalled {
+		t.Errorf("LibraryManager.AwaitingSpaceJobs() wasn't called")
+	}
+	if !mLibraryManager.stagedFilesCalled {
+		t.Errorf("LibraryManager.StagedFiles() wasn't called")
+	}
+	if !mLibraryManager.metricsSnapshotCalled {
+		t.Errorf("LibraryManager.MetricsSnapshot() wasn't called")
+	}
+	if !mLibraryManager.requeueLibraryCalled {
+		t.Errorf("LibraryManager.RequeueLibrary() wasn't called")
+	}
+	if !mLibraryManager.handleStaleJobsCalled {
+		t.Errorf("LibraryManager.HandleStaleJobs() wasn't called")
+	}
+	if !mLibraryManager.healthCalled {
+		t.Errorf("LibraryManager.Health() wasn't called")
+	}
+	if !mLibraryManager.dispatchPlanCalled {
+		t.Errorf("LibraryManager.DispatchPlan() wasn't called")
+	}
+	if !mLibraryManager.queueBenchmarksCalled {
+		t.Errorf("LibraryManager.QueueBenchmarks() wasn't called")
+	}
+	if !mLibraryManager.popBenchmarkCalled {
+		t.Errorf("LibraryManager.PopBenchmarkJob() wasn't called")
+	}
 
 	// Check that RunnerCommunicator methods were run
 	if !mRunnerCommunicator.startCalled {
@@ -57,6 +96,9 @@ func TestRunFuncsCalled(t *testing.T) {
 	if !mRunnerCommunicator.nullUUIDsCalled {
 		t.Errorf("RunnerCommunicator.NullifyUUIDs() wasn't called")
 	}
+	if !mRunnerCommunicator.cleanStagingCalled {
+		t.Errorf("RunnerCommunicator.CleanStaging() wasn't called")
+	}
 	if !mRunnerCommunicator.waitingRunnersCalled {
 		t.Errorf("RunnerCommunicator.WaitingRunners() wasn't called")
 	}
@@ -74,10 +116,37 @@ func TestRunFuncsCalled(t *testing.T) {
 	if !mUserInterfacer.setWaitingRunnersCalled {
 		t.Errorf("UserInterfacer.SetWaitingRunners() wasn't called")
 	}
+	if !mUserInterfacer.scanRequestsCalled {
+		t.Errorf("UserInterfacer.ScanRequests() wasn't called")
+	}
+	if !mUserInterfacer.requeueRequestsCalled {
+		t.Errorf("UserInterfacer.RequeueRequests() wasn't called")
+	}
+	if !mUserInterfacer.setScanningLibsCalled {
+		t.Errorf("UserInterfacer.SetScanningLibraries() wasn't called")
+	}
+	if !mUserInterfacer.setAwaitingSpaceCalled {
+		t.Errorf("UserInterfacer.SetAwaitingSpaceJobs() wasn't called")
+	}
+	if !mUserInterfacer.setNoRunnersSinceCalled {
+		t.Errorf("UserInterfacer.SetNoRunnersSince() wasn't called")
+	}
+	if !mUserInterfacer.setMetricsSnapshotCalled {
+		t.Errorf("UserInterfacer.SetMetricsSnapshot() wasn't called")
+	}
+	if !mUserInterfacer.setDatastoreHealthCalled {
+		t.Errorf("UserInterfacer.SetDatastoreHealth() wasn't called")
+	}
+	if !mUserInterfacer.setDispatchPlanCalled {
+		t.Errorf("UserInterfacer.SetDispatchPlan() wasn't called")
+	}
+	if !mUserInterfacer.benchmarkRequestsCalled {
+		t.Errorf("UserInterfacer.BenchmarkRequests() wasn't called")
+	}
 }
 
 // Test to write
-//   - rc.NullifyUUIDs() is called with the return value of hc.Run()
+//   - rc.NullifyUUIDs() is called with the UUIDs of the return value of hc.Run()
 //   - ui.SetLibrarySettings() is called with the return value of lm.LibrarySettings()
 //   - lm.UpdateLibrarySettings() is called with the return value of ui.NewLibrarySettings()
 //   - ui.SetLibraryQueues() is called with the return value of lm.LibraryQueues()
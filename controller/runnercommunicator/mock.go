@@ -0,0 +1,32 @@
+package runnercommunicator
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+type mockLogger struct{}
+
+func (m *mockLogger) Trace(s string, i ...interface{})    {}
+func (m *mockLogger) Debug(s string, i ...interface{})    {}
+func (m *mockLogger) Info(s string, i ...interface{})     {}
+func (m *mockLogger) Warn(s string, i ...interface{})     {}
+func (m *mockLogger) Error(s string, i ...interface{})    {}
+func (m *mockLogger) Critical(s string, i ...interface{}) {}
+
+// mockDataStorer only implements DispatchedJob, which returns the jobs in dispatched.
+type mockDataStorer struct {
+	controller.RunnerCommunicatorDataStorer
+
+	dispatched map[controller.UUID]controller.DispatchedJob
+}
+
+func (m *mockDataStorer) DispatchedJob(ctx context.Context, uuid controller.UUID) (controller.DispatchedJob, error) {
+	dJob, ok := m.dispatched[uuid]
+	if !ok {
+		return controller.DispatchedJob{}, sql.ErrNoRows
+	}
+	return dJob, nil
+}
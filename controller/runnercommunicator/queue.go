@@ -2,14 +2,18 @@ package runnercommunicator
 
 import (
 	"sync"
+	"time"
 
 	"github.com/BrenekH/encodarr/controller"
 )
 
 type waitingRunner struct {
 	Name         string
-	CallbackChan chan controller.Job
+	CallbackChan chan controller.DispatchedJob
 	UUID         string
+
+	// RequestedLease is how long the Runner asked for the lease on its job to last. 0 if it didn't ask.
+	RequestedLease time.Duration
 }
 
 func newQueue() queue {
@@ -31,6 +35,13 @@ func (q *queue) Push(item waitingRunner) {
 	q.items = append(q.items, item)
 }
 
+// PushFront inserts an item at the start of a LibraryQueue, so that it is popped next.
+func (q *queue) PushFront(item waitingRunner) {
+	q.Lock()
+	defer q.Unlock()
+	q.items = append([]waitingRunner{item}, q.items...)
+}
+
 // Pop removes and returns the first item of a LibraryQueue.
 func (q *queue) Pop() (waitingRunner, error) {
 	q.Lock()
@@ -44,6 +55,19 @@ func (q *queue) Pop() (waitingRunner, error) {
 	return item, nil
 }
 
+// PopNamed removes and returns the first item with the provided Runner name.
+func (q *queue) PopNamed(name string) (waitingRunner, error) {
+	q.Lock()
+	defer q.Unlock()
+	for index, v := range q.items {
+		if v.Name == name {
+			q.items = append(q.items[:index], q.items[index+1:]...)
+			return v, nil
+		}
+	}
+	return waitingRunner{}, controller.ErrEmptyQueue
+}
+
 // Remove deletes the first item that has the uuid provided.
 func (q *queue) Remove(uuid string) {
 	q.Lock()
@@ -2,8 +2,9 @@ package runnercommunicator
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"net/http"
 	"os"
@@ -15,15 +16,20 @@ import (
 	"github.com/google/uuid"
 )
 
-// NewRunnerHTTPApiV1 returns a new RunnerHTTPApiV1.
-func NewRunnerHTTPApiV1(logger controller.Logger, httpServer controller.HTTPServer, ds controller.RunnerCommunicatorDataStorer) RunnerHTTPApiV1 {
+// NewRunnerHTTPApiV1 returns a new RunnerHTTPApiV1. Runners may ask for leases on their jobs which last longer than
+// the default, up to maxLeaseDuration.
+func NewRunnerHTTPApiV1(logger controller.Logger, httpServer controller.HTTPServer, ds controller.RunnerCommunicatorDataStorer, maxLeaseDuration time.Duration) RunnerHTTPApiV1 {
 	return RunnerHTTPApiV1{
-		logger:         logger,
-		httpServer:     httpServer,
-		ds:             ds,
-		nullifiedUUIDs: make([]controller.UUID, 0),
-		wrQueue:        newQueue(),
-		completedJobs:  make(chan controller.CompletedJob),
+		logger:           logger,
+		httpServer:       httpServer,
+		ds:               ds,
+		ctx:              context.Background(),
+		maxLeaseDuration: maxLeaseDuration,
+		nullifiedUUIDs:   make([]controller.UUID, 0),
+		wrQueue:          newQueue(),
+		completedJobs:    make(chan controller.CompletedJob),
+		receivingMu:      &sync.Mutex{},
+		receiving:        make(map[controller.UUID]int),
 	}
 }
 
@@ -33,19 +39,35 @@ type RunnerHTTPApiV1 struct {
 	httpServer controller.HTTPServer
 	ds         controller.RunnerCommunicatorDataStorer
 
+	// ctx is passed to the data storer calls which aren't made on behalf of a request. It is replaced by the one given to Start.
+	ctx context.Context
+
+	maxLeaseDuration time.Duration
+
 	nullifiedUUIDs []controller.UUID
 	completedJobs  chan controller.CompletedJob
 	wrQueue        queue
+
+	// stagingDir is where the files received from the Runners are kept until they are imported. They are named after
+	// their job's UUID. lastStagingCleanup is when CleanStaging last looked for files which were left behind.
+	stagingDir         string
+	lastStagingCleanup time.Time
+
+	// receivingMu guards receiving, the number of requests which are receiving each job.
+	receivingMu *sync.Mutex
+	receiving   map[controller.UUID]int
 }
 
 // Start starts the HTTP server. It does not block the thread.
-func (r *RunnerHTTPApiV1) Start(ctx *context.Context, wg *sync.WaitGroup) {
+func (r *RunnerHTTPApiV1) Start(ctx context.Context, wg *sync.WaitGroup) {
+	r.ctx = ctx
 	r.httpServer.Start(ctx, wg)
 
 	// Add handlers to r.httpServer
 	r.httpServer.HandleFunc("/api/runner/v1/job/request", r.requestJob)
 	r.httpServer.HandleFunc("/api/runner/v1/job/status", r.jobStatus)
 	r.httpServer.HandleFunc("/api/runner/v1/job/complete", r.jobComplete)
+	r.httpServer.HandleFunc("/api/runner/v1/heartbeat", r.heartbeat)
 }
 
 // CompletedJobs returns any completed jobs as told by the Runners.
@@ -60,27 +82,49 @@ func (r *RunnerHTTPApiV1) CompletedJobs() (j []controller.CompletedJob) {
 	}
 }
 
-// NewJob sends a new job to the next running in the queue.
-func (r *RunnerHTTPApiV1) NewJob(cJob controller.Job) {
-	wr, err := r.wrQueue.Pop()
-	if err != nil {
+// NewJob sends a new job to the next running in the queue, along with a lease on it which lasts for leaseDuration
+// or as long as the Runner asked for, whichever is longer. The job is dropped if its path is already dispatched.
+// A benchmark job for a specific Runner is sent to that Runner, and dropped if it stopped waiting in the meantime.
+func (r *RunnerHTTPApiV1) NewJob(cJob controller.Job, leaseDuration time.Duration) {
+	var wr waitingRunner
+	var err error
+	if cJob.Benchmark != nil && cJob.Benchmark.Runner != "" {
+		if wr, err = r.wrQueue.PopNamed(cJob.Benchmark.Runner); err != nil {
+			r.logger.Warn("Not dispatching benchmark %v because runner %v isn't waiting anymore", cJob.UUID, cJob.Benchmark.Runner, cJob.LogFields())
+			return
+		}
+	} else if wr, err = r.wrQueue.Pop(); err != nil {
 		r.logger.Error("NewJob was called but got error from Pop: %v", err)
 	}
 
 	// Add job to dispatched jobs
+	now := time.Now()
 	dJob := controller.DispatchedJob{
-		UUID:        cJob.UUID,
-		Runner:      wr.Name,
-		Job:         cJob,
-		Status:      controller.JobStatus{},
-		LastUpdated: time.Now(),
+		UUID:          cJob.UUID,
+		Runner:        wr.Name,
+		Job:           cJob,
+		Status:        controller.JobStatus{},
+		LastUpdated:   now,
+		LeaseDuration: negotiateLease(leaseDuration, wr.RequestedLease, r.maxLeaseDuration),
 	}
-	err = r.ds.SaveDispatchedJob(dJob)
-	if err != nil {
-		r.logger.Error("error saving new dispatched job: %v", err)
+	dJob = dJob.RenewLease(now)
+
+	err = r.ds.SaveDispatchedJob(r.ctx, dJob)
+	if errors.Is(err, controller.ErrPathDispatched) {
+		// The file is already being transcoded by another Runner (ex. a scan queued it again before the first job was
+		// saved), so this job is dropped and the Runner keeps its place for the next one.
+		r.logger.Warn("Not dispatching job %v because %v is already dispatched", cJob.UUID, cJob.Path, cJob.LogFields())
+		r.wrQueue.PushFront(wr)
+		return
+	} else if err != nil {
+		r.logger.Error("error saving new dispatched job: %v", err, cJob.LogFields())
 	}
 
-	wr.CallbackChan <- cJob
+	fields := cJob.LogFields()
+	fields["runner"] = wr.Name
+	r.logger.Info("Dispatched job %v for %v to runner %v", cJob.UUID, cJob.Path, wr.Name, fields)
+
+	wr.CallbackChan <- dJob
 }
 
 // NeedNewJob returns a boolean indicating whether or not there are waiting runners.
@@ -104,6 +148,28 @@ func (r *RunnerHTTPApiV1) WaitingRunners() (runnerNames []string) {
 	return
 }
 
+// renewLease returns dJob with its lease renewed as of now on behalf of runnerName. If the job is recorded as dispatched
+// to another Runner (ex. the Runner was renamed while the Controller was down), it is re-associated with runnerName.
+func (r *RunnerHTTPApiV1) renewLease(dJob controller.DispatchedJob, runnerName string, now time.Time) controller.DispatchedJob {
+	if runnerName != "" && dJob.Runner != runnerName {
+		fields := dJob.Job.LogFields()
+		fields["runner"] = runnerName
+		r.logger.Info("Re-associating job %v with runner %v (was %v)", dJob.UUID, runnerName, dJob.Runner, fields)
+		dJob.Runner = runnerName
+	}
+	return dJob.RenewLease(now)
+}
+
+// isNullified returns whether or not the job with the provided UUID was taken away from its Runner.
+func (r *RunnerHTTPApiV1) isNullified(uuid controller.UUID) bool {
+	for _, v := range r.nullifiedUUIDs {
+		if v == uuid {
+			return true
+		}
+	}
+	return false
+}
+
 // requestJob is an HTTP handler which handles Runner job requests.
 func (r *RunnerHTTPApiV1) requestJob(w http.ResponseWriter, hr *http.Request) {
 	r.logger.Trace("%+v", hr)
@@ -113,16 +179,27 @@ func (r *RunnerHTTPApiV1) requestJob(w http.ResponseWriter, hr *http.Request) {
 		runnerName := hr.Header.Get("X-Encodarr-Runner-Name")
 		r.logger.Info("Received request from %v @ %v", runnerName, hr.RemoteAddr)
 
+		r.runnerSeen(hr.Context(), runnerName, hr.Header.Get("X-Encodarr-Runner-Version"))
+
+		// Older Runners don't ask for a lease duration
+		var requestedLease time.Duration
+		if h := hr.Header.Get("X-Encodarr-Lease-Duration"); h != "" {
+			var err error
+			if requestedLease, err = time.ParseDuration(h); err != nil {
+				r.logger.Warn("Ignoring invalid lease duration '%v' requested by %v: %v", h, runnerName, err)
+			}
+		}
+
 		// Add callback channel to waiting runners queue
-		receiveChan := make(chan controller.Job)
+		receiveChan := make(chan controller.DispatchedJob)
 		requestUUID := uuid.NewString()
-		r.wrQueue.Push(waitingRunner{Name: runnerName, CallbackChan: receiveChan, UUID: requestUUID})
+		r.wrQueue.Push(waitingRunner{Name: runnerName, CallbackChan: receiveChan, UUID: requestUUID, RequestedLease: requestedLease})
 
 		// Check for a returned job
-		var jobToSend controller.Job
+		var dJob controller.DispatchedJob
 		var ok bool
 		select {
-		case jobToSend, ok = <-receiveChan:
+		case dJob, ok = <-receiveChan:
 			break
 		case <-hr.Context().Done():
 			r.wrQueue.Remove(requestUUID)
@@ -137,20 +214,23 @@ func (r *RunnerHTTPApiV1) requestJob(w http.ResponseWriter, hr *http.Request) {
 			return
 		}
 
+		jobToSend := dJob.Job
+
 		// Marshal Job into json to be sent in a header
 		jobJSONBytes, err := json.Marshal(jobToSend)
 		if err != nil {
-			r.logger.Error("error marshaling Job to json: %v", err)
+			r.logger.Error("error marshaling Job to json: %v", err, jobToSend.LogFields())
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("X-Encodarr-Job-Info", string(jobJSONBytes))
+		w.Header().Set("X-Encodarr-Lease-Duration", dJob.LeaseDuration.String())
 
 		// Respond with file
 		w.Header().Set("Content-Type", inferMIMETypeFromExt(filepath.Ext(jobToSend.Path)))
 		file, err := os.Open(jobToSend.Path)
 		if err != nil {
-			r.logger.Error("error opening %v: %v", jobToSend.Path, err)
+			r.logger.Error("error opening %v: %v", jobToSend.Path, err, jobToSend.LogFields())
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -163,7 +243,7 @@ func (r *RunnerHTTPApiV1) requestJob(w http.ResponseWriter, hr *http.Request) {
 			bytesRead, err := file.Read(buffer)
 			if err != nil {
 				if err != io.EOF {
-					r.logger.Error("error writing to HTTP Writer: %v", err)
+					r.logger.Error("error writing to HTTP Writer: %v", err, jobToSend.LogFields())
 					w.WriteHeader(http.StatusInternalServerError)
 					return
 				}
@@ -171,6 +251,7 @@ func (r *RunnerHTTPApiV1) requestJob(w http.ResponseWriter, hr *http.Request) {
 			}
 			w.Write(buffer[:bytesRead])
 		}
+		r.logger.Info("Sent %v to runner %v for job %v", jobToSend.Path, runnerName, jobToSend.UUID, jobToSend.LogFields())
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -196,33 +277,50 @@ func (r *RunnerHTTPApiV1) jobStatus(w http.ResponseWriter, hr *http.Request) {
 		}
 
 		// Check ijs.UUID against nullified UUIDs
-		for _, v := range r.nullifiedUUIDs {
-			if v == ijs.UUID {
-				w.WriteHeader(http.StatusConflict) // Send the 409 error code to signal to the Runner to indicate that the job has been nullified.
-				return
-			}
+		if r.isNullified(ijs.UUID) {
+			w.WriteHeader(http.StatusConflict) // Send the 409 error code to signal to the Runner to indicate that the job has been nullified.
+			return
 		}
 
-		// Get existing DispatchedJob from datastore
-		dJob, err := r.ds.DispatchedJob(ijs.UUID)
-		if err != nil {
+		// Get existing DispatchedJob from datastore. A job which doesn't exist anymore was taken away from the Runner
+		// (ex. by the health checker before the Controller restarted, which forgets the nullified UUIDs) and has most
+		// likely been re-queued, so the Runner is told to drop it just like a nullified job.
+		dJob, err := r.ds.DispatchedJob(hr.Context(), ijs.UUID)
+		if err == sql.ErrNoRows {
+			r.logger.Warn("Received a status update for job %v, which isn't dispatched anymore", ijs.UUID, controller.LogFields{"job_uuid": ijs.UUID})
+			w.WriteHeader(http.StatusConflict)
+			return
+		} else if err != nil {
 			r.logger.Error(err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
+		// Every status update renews the Runner's lease so that the health check won't take the job away
+		dJob.LastUpdated = time.Now()
+		dJob = r.renewLease(dJob, hr.Header.Get("X-Encodarr-Runner-Name"), dJob.LastUpdated)
+		if ijs.Status.Stage != dJob.Status.Stage {
+			r.logger.Info("Job %v entered the stage '%v' on runner %v", dJob.UUID, ijs.Status.Stage, dJob.Runner, dJob.Job.LogFields())
+		}
 		dJob.Status = ijs.Status
 
-		// Update the LastUpdated time so that the health check won't null this Runner
-		dJob.LastUpdated = time.Now()
+		r.runnerSeen(hr.Context(), dJob.Runner, "")
 
-		// Store DispatchedJob into datastore
-		if err = r.ds.SaveDispatchedJob(dJob); err != nil {
+		// Store DispatchedJob into datastore. The lease may have been revoked since the job was read,
+		// in which case the renewal is rejected.
+		if err = r.ds.UpdateDispatchedJob(hr.Context(), dJob); err == sql.ErrNoRows {
+			fields := dJob.Job.LogFields()
+			fields["runner"] = dJob.Runner
+			r.logger.Warn("Rejected the lease renewal of job %v, which was taken away from %v", ijs.UUID, dJob.Runner, fields)
+			w.WriteHeader(http.StatusConflict)
+			return
+		} else if err != nil {
 			r.logger.Error(err.Error())
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
+		w.Header().Set("X-Encodarr-Lease-Duration", dJob.LeaseDuration.String())
 		w.WriteHeader(http.StatusOK)
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -253,38 +351,197 @@ func (r *RunnerHTTPApiV1) jobComplete(w http.ResponseWriter, hr *http.Request) {
 			return
 		}
 
-		// If UUID was nullified, respond with 409 error code and exit
-		for _, v := range r.nullifiedUUIDs {
-			if v == cJob.UUID {
-				w.WriteHeader(http.StatusConflict)
+		// The UUID names the staged files, so it can't be anything else.
+		if _, err = uuid.Parse(string(cJob.UUID)); err != nil {
+			r.logger.Debug("received history entry with invalid UUID %q", cJob.UUID)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// If UUID was nullified, respond with 409 error code and exit. This keeps a job which was re-queued while
+		// its Runner was stale from being imported twice.
+		if r.isNullified(cJob.UUID) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		// Update the Runner's statistics. A job which isn't dispatched anymore is still accepted, because the
+		// Controller may have forgotten that it was taken away (ex. it restarted). The LibraryManager matches it with
+		// the queued job for the same file instead.
+		runnerName := hr.Header.Get("X-Encodarr-Runner-Name")
+		fields := controller.LogFields{"job_uuid": cJob.UUID}
+		benchmark := cJob.Benchmark != nil
+		if dJob, err := r.ds.DispatchedJob(hr.Context(), cJob.UUID); err == nil {
+			runnerName = dJob.Runner
+			fields = dJob.Job.LogFields()
+			benchmark = benchmark || dJob.Job.Benchmark != nil
+		} else if err == sql.ErrNoRows {
+			r.logger.Warn("Received job %v for %v as completed, but it isn't dispatched anymore", cJob.UUID, cJob.History.Filename, fields)
+			cJob.History.Runner = runnerName
+		} else {
+			r.logger.Debug("couldn't find dispatched job %v to record runner statistics: %v", cJob.UUID, err, fields)
+		}
+
+		// Benchmarks don't count towards the Runner's statistics.
+		if runnerName != "" {
+			r.runnerSeen(hr.Context(), runnerName, "")
+		}
+		if runnerName != "" && !benchmark {
+			if err = r.ds.RecordRunnerResult(hr.Context(), runnerName, cJob.Failed); err != nil {
+				r.logger.Error("error recording result for runner %v: %v", runnerName, err)
+			}
+		}
+
+		// The staged files of the job aren't cleaned up until it has been handed to CompletedJobs.
+		r.startReceiving(cJob.UUID)
+		defer r.doneReceiving(cJob.UUID)
+
+		// If job didn't fail, write file to the staging directory. Runners don't send the transcoded file of a benchmark,
+		// unless they are from before benchmarks were introduced, in which case it is thrown away when the job is imported.
+		if !cJob.Failed && cJob.Benchmark == nil {
+			if status, err := r.receiveFiles(hr, &cJob); err != nil {
+				r.logger.Warn("Failed to receive the files of job %v: %v", cJob.UUID, err, fields)
+				w.WriteHeader(status)
 				return
 			}
 		}
 
-		// If job didn't fail, write file to disk
-		if !cJob.Failed {
-			fileReader, fileHeader, err := hr.FormFile("file")
-			if err != nil {
-				r.logger.Debug("error accessing form file: %v", err)
+		if benchmark {
+			r.logger.Info("Received benchmark %v from runner %v", cJob.UUID, runnerName, fields)
+		} else if cJob.Failed {
+			r.logger.Info("Received job %v from runner %v as failed", cJob.UUID, runnerName, fields)
+		} else {
+			r.logger.Info("Received job %v from runner %v as completed", cJob.UUID, runnerName, fields)
+		}
+
+		// Add controller.CompletedJob to channel for CompletedJobs to pick up from
+		r.completedJobs <- cJob
+
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// receiveFiles streams the transcoded file and, if the job's command extracted them, the closed captions in the
+// multipart body of hr into the staging directory, and sets their paths in cJob. The files are streamed instead of
+// parsed with the rest of the form, because that would put the parts in temporary files outside of the staging
+// directory. On error, the files which were received are removed and the status to respond with is returned.
+func (r *RunnerHTTPApiV1) receiveFiles(hr *http.Request, cJob *controller.CompletedJob) (int, error) {
+	mr, err := hr.MultipartReader()
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	removeReceived := func() {
+		for _, p := range []string{cJob.InFile, cJob.CaptionsFile} {
+			if p == "" {
+				continue
+			}
+			if err := os.Remove(p); err != nil {
+				r.logger.Warn(err.Error())
+			}
+		}
+		cJob.InFile, cJob.CaptionsFile = "", ""
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			removeReceived()
+			return http.StatusBadRequest, err
+		}
+
+		var dest *string
+		var ext string
+		switch part.FormName() {
+		case "file":
+			dest, ext = &cJob.InFile, filepath.Ext(part.FileName())
+		case "captions":
+			// Closed captions are only sent when the job's command extracted them
+			dest, ext = &cJob.CaptionsFile, ".srt"
+		default:
+			part.Close()
+			continue
+		}
+
+		*dest = r.stagedPath(cJob.UUID, ext)
+		status, err := copyToFile(*dest, part)
+		part.Close()
+		if err != nil {
+			removeReceived()
+			return status, err
+		}
+	}
+
+	if cJob.InFile == "" {
+		removeReceived()
+		return http.StatusBadRequest, errors.New("the request doesn't have a file")
+	}
+	return http.StatusOK, nil
+}
+
+// copyToFile creates or truncates the file at p and copies src into it. The status to respond with is returned
+// on error, which is a bad request if src couldn't be read.
+func copyToFile(p string, src io.Reader) (int, error) {
+	f, err := os.Create(p)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if _, err = io.Copy(f, src); err != nil {
+		f.Close()
+		return http.StatusBadRequest, err
+	}
+	if err = f.Close(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// heartbeat is an HTTP handler which Runners ping periodically, even when they are idle, so that the
+// health checker can tell when they go offline.
+func (r *RunnerHTTPApiV1) heartbeat(w http.ResponseWriter, hr *http.Request) {
+	r.logger.Trace("%+v", hr)
+	switch hr.Method {
+	case http.MethodPost:
+		runnerName := hr.Header.Get("X-Encodarr-Runner-Name")
+		if runnerName == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		r.runnerSeen(hr.Context(), runnerName, hr.Header.Get("X-Encodarr-Runner-Version"))
+
+		// Older Runners don't send the jobs they are working on
+		ihb := incomingHeartbeat{}
+		if b, err := io.ReadAll(hr.Body); err == nil && len(b) > 0 {
+			if err = json.Unmarshal(b, &ihb); err != nil {
+				r.logger.Debug("error unmarshalling heartbeat: %v", err)
 				w.WriteHeader(http.StatusBadRequest)
 				return
 			}
-			defer fileReader.Close()
+		}
+
+		// The leases on the jobs are renewed, which keeps them from expiring while their results are being uploaded
+		for _, uuid := range ihb.Jobs {
+			if r.isNullified(uuid) {
+				continue
+			}
 
-			// Copy to intermediate file
-			cJob.InFile = fmt.Sprintf("%v.import%v", cJob.UUID, filepath.Ext(fileHeader.Filename))
-			f, err := os.Create(cJob.InFile) // TODO: Mock out for testing
+			dJob, err := r.ds.DispatchedJob(hr.Context(), uuid)
 			if err != nil {
-				r.logger.Debug("error opening receiving file: %v", err)
-				w.WriteHeader(http.StatusInternalServerError)
-				return
+				r.logger.Debug("runner %v claimed job %v, which isn't dispatched: %v", runnerName, uuid, err)
+				continue
 			}
-			io.Copy(f, fileReader)
-			f.Close()
-		}
 
-		// Add controller.CompletedJob to channel for CompletedJobs to pick up from
-		r.completedJobs <- cJob
+			dJob = r.renewLease(dJob, runnerName, time.Now())
+			if err = r.ds.UpdateDispatchedJob(hr.Context(), dJob); err != nil && err != sql.ErrNoRows {
+				r.logger.Error("error renewing the lease of runner %v on job %v: %v", runnerName, uuid, err)
+			}
+		}
 
 		w.WriteHeader(http.StatusOK)
 	default:
@@ -292,6 +549,35 @@ func (r *RunnerHTTPApiV1) jobComplete(w http.ResponseWriter, hr *http.Request) {
 	}
 }
 
+// negotiateLease returns how long the lease on a job lasts when the Runner asked for requested. Runners may ask for
+// a lease which lasts longer than leaseDuration (ex. because they report their status slowly), up to maxLeaseDuration,
+// but never for a shorter one.
+func negotiateLease(leaseDuration, requested, maxLeaseDuration time.Duration) time.Duration {
+	if requested > maxLeaseDuration {
+		requested = maxLeaseDuration
+	}
+	if requested > leaseDuration {
+		return requested
+	}
+	return leaseDuration
+}
+
+// runnerSeen records that a Runner has contacted the Controller.
+func (r *RunnerHTTPApiV1) runnerSeen(ctx context.Context, name, version string) {
+	if name == "" {
+		return
+	}
+
+	if err := r.ds.RunnerSeen(ctx, name, version, time.Now()); err != nil {
+		r.logger.Error("error recording runner %v as seen: %v", name, err)
+	}
+}
+
+// incomingHeartbeat defines the structure of the heartbeats from Runners.
+type incomingHeartbeat struct {
+	Jobs []controller.UUID `json:"jobs"` // The jobs which the Runner is working on.
+}
+
 // incomingJobStatus defines the structure of the job status from Runners.
 type incomingJobStatus struct {
 	UUID   controller.UUID      `json:"uuid"`
@@ -0,0 +1,136 @@
+package runnercommunicator
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/google/uuid"
+)
+
+// stagingCleanupInterval is how often CleanStaging looks for files which were left behind in the staging directory,
+// after the first time.
+const stagingCleanupInterval = time.Hour
+
+// SetStagingDir sets the directory that the files received from the Runners are kept in until they are imported.
+// It must be called before Start.
+func (r *RunnerHTTPApiV1) SetStagingDir(dir string) {
+	r.stagingDir = dir
+}
+
+// CleanStaging removes the staged files which don't belong to a dispatched job or a job which is being received, and
+// aren't in keep. Such files are left behind when the Controller crashes while receiving or importing a job.
+// The files are removed on the first call and then at most every stagingCleanupInterval. CleanStaging must be called
+// from the same goroutine as the imports, so that a file isn't removed between its job's dispatch record being
+// removed and the file being imported.
+func (r *RunnerHTTPApiV1) CleanStaging(keep []string) {
+	if !r.lastStagingCleanup.IsZero() && time.Since(r.lastStagingCleanup) < stagingCleanupInterval {
+		return
+	}
+	r.lastStagingCleanup = time.Now()
+
+	entries, err := os.ReadDir(r.stagingDir)
+	if err != nil {
+		r.logger.Error("failed to read the staging directory %v: %v", r.stagingDir, err)
+		return
+	}
+
+	kept := make(map[string]struct{}, len(keep))
+	for _, p := range keep {
+		kept[filepath.Clean(p)] = struct{}{}
+	}
+
+	removed := 0
+	var reclaimed int64
+	for _, e := range entries {
+		jobUUID, ok := stagedJob(e.Name())
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		p := filepath.Join(r.stagingDir, e.Name())
+		if _, ok := kept[p]; ok {
+			continue
+		}
+
+		if _, err := r.ds.DispatchedJob(r.ctx, jobUUID); err == nil {
+			continue
+		} else if err != sql.ErrNoRows {
+			// Nothing is removed if it isn't known which jobs are dispatched.
+			r.logger.Error("error checking whether job %v is dispatched while cleaning the staging directory: %v", jobUUID, err)
+			return
+		}
+
+		var size int64
+		if info, err := e.Info(); err == nil {
+			size = info.Size()
+		}
+
+		if ok, err := r.removeUnlessReceiving(jobUUID, p); err != nil {
+			r.logger.Error("failed to remove the staged file %v: %v", p, err)
+		} else if ok {
+			r.logger.Info("Removed the staged file %v of job %v (%v bytes) because the job isn't dispatched anymore", p, jobUUID, size, controller.LogFields{"job_uuid": jobUUID})
+			removed++
+			reclaimed += size
+		}
+	}
+
+	if removed > 0 {
+		r.logger.Info("Reclaimed %v bytes by removing %v staged files which were left behind", reclaimed, removed)
+	}
+}
+
+// stagedPath returns the path that the file with the extension ext, which was received for the job with the provided
+// UUID, is staged at.
+func (r *RunnerHTTPApiV1) stagedPath(jobUUID controller.UUID, ext string) string {
+	return filepath.Join(r.stagingDir, fmt.Sprintf("%v.import%v", jobUUID, ext))
+}
+
+// stagedJob returns the UUID of the job that the staged file with the provided name was received for.
+// ok is false if name isn't the name of a staged file.
+func stagedJob(name string) (jobUUID controller.UUID, ok bool) {
+	i := strings.Index(name, ".import")
+	if i < 0 {
+		return "", false
+	}
+	if _, err := uuid.Parse(name[:i]); err != nil {
+		return "", false
+	}
+	return controller.UUID(name[:i]), true
+}
+
+// startReceiving marks the job with the provided UUID as being received, which keeps CleanStaging from removing its
+// files even if it isn't dispatched. doneReceiving must be called once the job has been handed to CompletedJobs.
+func (r *RunnerHTTPApiV1) startReceiving(jobUUID controller.UUID) {
+	r.receivingMu.Lock()
+	defer r.receivingMu.Unlock()
+	r.receiving[jobUUID]++
+}
+
+// doneReceiving undoes startReceiving.
+func (r *RunnerHTTPApiV1) doneReceiving(jobUUID controller.UUID) {
+	r.receivingMu.Lock()
+	defer r.receivingMu.Unlock()
+	if r.receiving[jobUUID]--; r.receiving[jobUUID] <= 0 {
+		delete(r.receiving, jobUUID)
+	}
+}
+
+// removeUnlessReceiving removes the file at p and returns true, unless the job with the provided UUID is being received.
+// The lock is held while removing, so that a job which starts being received can't have its new file removed.
+func (r *RunnerHTTPApiV1) removeUnlessReceiving(jobUUID controller.UUID, p string) (bool, error) {
+	r.receivingMu.Lock()
+	defer r.receivingMu.Unlock()
+	if r.receiving[jobUUID] > 0 {
+		return false, nil
+	}
+	if err := os.Remove(p); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
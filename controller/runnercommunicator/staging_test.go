@@ -0,0 +1,83 @@
+package runnercommunicator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func TestStagedJob(t *testing.T) {
+	tests := []struct {
+		name         string
+		expectedUUID controller.UUID
+		expectedOk   bool
+	}{
+		{name: "0b1e7a1c-3c5b-4d47-9f5e-6a7c1f0a2b3d.import.mkv", expectedUUID: "0b1e7a1c-3c5b-4d47-9f5e-6a7c1f0a2b3d", expectedOk: true},
+		{name: "0b1e7a1c-3c5b-4d47-9f5e-6a7c1f0a2b3d.import.srt", expectedUUID: "0b1e7a1c-3c5b-4d47-9f5e-6a7c1f0a2b3d", expectedOk: true},
+		{name: "0b1e7a1c-3c5b-4d47-9f5e-6a7c1f0a2b3d.mkv"},
+		{name: "../movie.import.mkv"},
+		{name: "notes.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jobUUID, ok := stagedJob(test.name)
+			if ok != test.expectedOk || jobUUID != test.expectedUUID {
+				t.Errorf("expected (%v, %v) but got (%v, %v)", test.expectedUUID, test.expectedOk, jobUUID, ok)
+			}
+		})
+	}
+}
+
+func TestCleanStaging(t *testing.T) {
+	const (
+		orphaned   controller.UUID = "0b1e7a1c-3c5b-4d47-9f5e-6a7c1f0a2b3d"
+		dispatched controller.UUID = "1c2f8b2d-4d6c-4e58-8a6f-7b8d2a1b3c4e"
+		receiving  controller.UUID = "2d3a9c3e-5e7d-4f69-9b7a-8c9e3b2c4d5f"
+		awaiting   controller.UUID = "3e4b0d4f-6f8e-4a7a-8c8b-9d0f4c3d5e6a"
+	)
+
+	dir := t.TempDir()
+	ds := &mockDataStorer{dispatched: map[controller.UUID]controller.DispatchedJob{dispatched: {}}}
+	r := NewRunnerHTTPApiV1(&mockLogger{}, nil, ds, 0)
+	r.SetStagingDir(dir)
+
+	files := map[string]bool{ // File name to whether or not it is expected to be kept
+		string(orphaned) + ".import.mkv":   false,
+		string(orphaned) + ".import.srt":   false,
+		string(dispatched) + ".import.mkv": true,
+		string(receiving) + ".import.mkv":  true,
+		string(awaiting) + ".import.mkv":   true,
+		"notes.txt":                        true,
+	}
+	for name := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r.startReceiving(receiving)
+	r.CleanStaging([]string{filepath.Join(dir, string(awaiting)+".import.mkv")})
+
+	for name, kept := range files {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != kept {
+			t.Errorf("expected %v to be kept: %v, but got err %v", name, kept, err)
+		}
+	}
+
+	// The files aren't checked again until stagingCleanupInterval has passed.
+	r.doneReceiving(receiving)
+	r.CleanStaging(nil)
+	if _, err := os.Stat(filepath.Join(dir, string(receiving)+".import.mkv")); err != nil {
+		t.Errorf("expected the cleanup to be rate limited but got %v", err)
+	}
+
+	r.lastStagingCleanup = time.Now().Add(-stagingCleanupInterval)
+	r.CleanStaging(nil)
+	if _, err := os.Stat(filepath.Join(dir, string(receiving)+".import.mkv")); !os.IsNotExist(err) {
+		t.Errorf("expected the file of the received job to be removed but got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package settings
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrSecretsKeyMissing is returned by NewStore when the settings hold encrypted values but the key file
+// that they were encrypted with doesn't exist.
+var ErrSecretsKeyMissing = errors.New("settings contain encrypted values but the secrets key file is missing")
+
+// keySize is the size in bytes of the AES-256 keys used to encrypt secrets.
+const keySize = 32
+
+// encryptedPrefix marks a value in the settings file as encrypted. Values without it are plaintext,
+// which are encrypted the next time the settings are loaded.
+const encryptedPrefix = "enc:v1:"
+
+// loadOrCreateKey reads the key-encryption key from path. If the file doesn't exist, a new key is generated and saved
+// to it, unless mustExist is true.
+func loadOrCreateKey(path string, mustExist bool) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("secrets key file %v is not a base64 encoded %v byte key", path, keySize)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if mustExist {
+		return nil, fmt.Errorf("%w: %v", ErrSecretsKeyMissing, path)
+	}
+
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// newKey returns a random AES-256 key.
+func newKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// isEncrypted returns whether or not value was produced by encrypt.
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// encrypt seals plaintext with AES-GCM under key. The random nonce is stored in front of the ciphertext.
+func encrypt(key, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// decrypt opens a value produced by encrypt.
+func decrypt(key []byte, value string) ([]byte, error) {
+	if !isEncrypted(value) {
+		return nil, errors.New("value is not encrypted")
+	}
+
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < gcm.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+
+	return gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
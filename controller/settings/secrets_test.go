@@ -0,0 +1,152 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func TestSecretsEncryptedAtRest(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := dir + "/secrets.key"
+
+	ss, err := NewStore(dir, keyFile)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if _, err = os.Stat(keyFile); err != nil {
+		t.Fatalf("expected the key file to be generated: %v", err)
+	}
+
+	ss.SetSecret(controller.SecretSMTPPassword, "hunter2")
+	if err = ss.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	ss.Close()
+
+	b, err := os.ReadFile(dir + "/settings.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "hunter2") {
+		t.Errorf("expected the secret to be encrypted in the settings file but got %s", b)
+	}
+
+	ss, err = NewStore(dir, keyFile)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer ss.Close()
+	if v := ss.Secret(controller.SecretSMTPPassword); v != "hunter2" {
+		t.Errorf("expected the secret to be decrypted but got %q", v)
+	}
+
+	ss.SetSecret(controller.SecretSMTPPassword, "")
+	if v := ss.Secret(controller.SecretSMTPPassword); v != "" {
+		t.Errorf("expected an empty value to clear the secret but got %q", v)
+	}
+}
+
+func TestPlaintextSecretsAreEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	settingsFile := `{"HealthCheckInterval": 60000000000, "HealthCheckTimeout": 3600000000000, "LogVerbosity": "INFO", "MaxJobAttempts": 3, "Secrets": {"runner_token": "plain"}}`
+	if err := os.WriteFile(dir+"/settings.json", []byte(settingsFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err := NewStore(dir, dir+"/secrets.key")
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer ss.Close()
+
+	if v := ss.Secret(controller.SecretRunnerToken); v != "plain" {
+		t.Errorf("expected the plaintext secret to be read but got %q", v)
+	}
+
+	b, err := os.ReadFile(dir + "/settings.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "plain") {
+		t.Errorf("expected the plaintext secret to be encrypted on load but got %s", b)
+	}
+}
+
+func TestSecretsKeyFileProblems(t *testing.T) {
+	newEncryptedStore := func(t *testing.T) (dir string) {
+		dir = t.TempDir()
+		ss, err := NewStore(dir, dir+"/secrets.key")
+		if err != nil {
+			t.Fatalf("NewStore: %v", err)
+		}
+		ss.SetSecret(controller.SecretWebhookSigningSecret, "secret")
+		if err = ss.Save(); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		ss.Close()
+		return dir
+	}
+
+	t.Run("Missing key file", func(t *testing.T) {
+		dir := newEncryptedStore(t)
+		if err := os.Remove(dir + "/secrets.key"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewStore(dir, dir+"/secrets.key"); !errors.Is(err, ErrSecretsKeyMissing) {
+			t.Errorf("expected ErrSecretsKeyMissing but got %v", err)
+		}
+		if _, err := os.Stat(dir + "/secrets.key"); err == nil {
+			t.Errorf("expected a new key file not to be generated for encrypted settings")
+		}
+	})
+
+	t.Run("Different key file", func(t *testing.T) {
+		dir := newEncryptedStore(t)
+		if _, err := loadOrCreateKey(dir+"/other.key", false); err != nil {
+			t.Fatal(err)
+		}
+
+		ss, err := NewStore(dir, dir+"/other.key")
+		if err == nil {
+			ss.Close()
+			t.Fatalf("expected an error when opening the settings with a different key")
+		}
+		if errors.Is(err, ErrSecretsKeyMissing) {
+			t.Errorf("expected a decryption error but got %v", err)
+		}
+	})
+}
+
+func TestSecretsConcurrentAccess(t *testing.T) {
+	ss := defaultSettings()
+	ss.file = &mockReadWriteSeekCloser{}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			ss.SetSecret(controller.SecretRunnerToken, fmt.Sprint(i))
+			ss.SetLogLevels(map[string]string{"runnerCommunicator": "DEBUG"})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			ss.Secret(controller.SecretRunnerToken)
+			ss.LogLevels()
+		}
+	}()
+	wg.Wait()
+
+	if v := ss.Secret(controller.SecretRunnerToken); v != "999" {
+		t.Errorf("expected the last secret to be kept but got %q", v)
+	}
+}
@@ -3,8 +3,10 @@ package settings
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/BrenekH/encodarr/controller"
@@ -18,9 +20,28 @@ type readWriteSeekCloser interface {
 
 // Store satisfies the controller.SettingsStorer interface using a JSON file.
 type Store struct {
+	compressQueues      bool
 	healthCheckInterval uint64
 	healthCheckTimeout  uint64
 	logVerbosity        string
+	logLevels           map[string]string
+	maxJobAttempts      uint64
+	mediaServer         controller.MediaServer
+	notifications       controller.Notifications
+	quarantineExpiry    uint64
+	queryTimeout        uint64
+	staleJobAction      string
+
+	// secrets holds the decrypted values of the sensitive settings.
+	secrets map[controller.SecretSetting]string
+
+	// mapsMu guards logLevels and secrets, which are read by other goroutines while the settings are updated.
+	mapsMu *sync.RWMutex
+
+	// keyEncryptionKey is read from the secrets key file and encrypts dataKey, which encrypts the secrets.
+	// Only dataKey has to be re-encrypted if the key file is replaced.
+	keyEncryptionKey []byte
+	dataKey          []byte
 
 	file   readWriteSeekCloser
 	closed bool
@@ -29,9 +50,21 @@ type Store struct {
 // settings a marshaling struct used for converting between a slice of bytes and the parsed values
 // in SettingsStore.
 type settings struct {
+	CompressQueues      bool
 	HealthCheckInterval uint64
 	HealthCheckTimeout  uint64
 	LogVerbosity        string
+	LogLevels           map[string]string `json:",omitempty"`
+	MaxJobAttempts      uint64
+	MediaServer         controller.MediaServer
+	Notifications       controller.Notifications
+	QuarantineExpiry    uint64
+	QueryTimeout        uint64
+	StaleJobAction      string
+
+	// DataKey is the encrypted key that the Secrets are encrypted with.
+	DataKey string                              `json:",omitempty"`
+	Secrets map[controller.SecretSetting]string `json:",omitempty"`
 }
 
 // Load loads the settings from the file.
@@ -46,15 +79,99 @@ func (s *Store) Load() error {
 		return err
 	}
 
-	se := settings{}
+	// MaxJobAttempts, QueryTimeout, and StaleJobAction are pre-filled so that settings files from before they existed keep the defaults.
+	se := settings{MaxJobAttempts: s.maxJobAttempts, QueryTimeout: s.queryTimeout, StaleJobAction: s.staleJobAction}
 	err = json.Unmarshal(b, &se)
 	if err != nil {
 		return err
 	}
 
+	secrets, plaintext, err := s.openSecrets(se)
+	if err != nil {
+		return err
+	}
+
+	s.compressQueues = se.CompressQueues
 	s.healthCheckInterval = se.HealthCheckInterval
 	s.healthCheckTimeout = se.HealthCheckTimeout
 	s.logVerbosity = se.LogVerbosity
+	s.maxJobAttempts = se.MaxJobAttempts
+	s.mediaServer = se.MediaServer
+	s.notifications = se.Notifications
+	s.quarantineExpiry = se.QuarantineExpiry
+	s.queryTimeout = se.QueryTimeout
+	s.staleJobAction = se.StaleJobAction
+
+	s.mapsMu.Lock()
+	s.logLevels = se.LogLevels
+	s.secrets = secrets
+	s.mapsMu.Unlock()
+
+	// Secrets which were written to the file in plaintext are encrypted right away
+	if plaintext {
+		return s.Save()
+	}
+
+	return nil
+}
+
+// openSecrets decrypts the secrets in se. plaintext is true if any of them weren't encrypted.
+func (s *Store) openSecrets(se settings) (secrets map[controller.SecretSetting]string, plaintext bool, err error) {
+	secrets = make(map[controller.SecretSetting]string, len(se.Secrets))
+
+	if se.DataKey != "" {
+		if s.keyEncryptionKey == nil {
+			return nil, false, ErrSecretsKeyMissing
+		}
+		if s.dataKey, err = decrypt(s.keyEncryptionKey, se.DataKey); err != nil {
+			return nil, false, fmt.Errorf("failed to decrypt the settings data key, the secrets key file may not be the one they were encrypted with: %w", err)
+		}
+	}
+
+	for name, v := range se.Secrets {
+		if !isEncrypted(v) {
+			secrets[name] = v
+			plaintext = true
+			continue
+		}
+
+		if s.dataKey == nil {
+			return nil, false, fmt.Errorf("secret %v is encrypted but the settings don't have a data key", name)
+		}
+		b, err := decrypt(s.dataKey, v)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to decrypt secret %v: %w", name, err)
+		}
+		secrets[name] = string(b)
+	}
+
+	return secrets, plaintext, nil
+}
+
+// sealSecrets encrypts the secrets into se, generating the data key if there isn't one yet.
+func (s *Store) sealSecrets(se *settings) (err error) {
+	if len(s.secrets) == 0 {
+		return nil
+	}
+	if s.keyEncryptionKey == nil {
+		return ErrSecretsKeyMissing
+	}
+
+	if s.dataKey == nil {
+		if s.dataKey, err = newKey(); err != nil {
+			return err
+		}
+	}
+	if se.DataKey, err = encrypt(s.keyEncryptionKey, s.dataKey); err != nil {
+		return err
+	}
+
+	se.Secrets = make(map[controller.SecretSetting]string, len(s.secrets))
+	for name, v := range s.secrets {
+		if se.Secrets[name], err = encrypt(s.dataKey, []byte(v)); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -65,17 +182,32 @@ func (s *Store) Save() error {
 		return controller.ErrClosed
 	}
 
-	// Erase current contents
-	s.file.Truncate(0)
-
-	// Move file pointer to start
-	s.file.Seek(0, io.SeekStart)
+	s.mapsMu.Lock()
+	defer s.mapsMu.Unlock()
 
 	se := settings{
+		CompressQueues:      s.compressQueues,
 		HealthCheckInterval: s.healthCheckInterval,
 		HealthCheckTimeout:  s.healthCheckTimeout,
 		LogVerbosity:        s.logVerbosity,
+		LogLevels:           s.logLevels,
+		MaxJobAttempts:      s.maxJobAttempts,
+		MediaServer:         s.mediaServer,
+		Notifications:       s.notifications,
+		QuarantineExpiry:    s.quarantineExpiry,
+		QueryTimeout:        s.queryTimeout,
+		StaleJobAction:      s.staleJobAction,
+	}
+	if err := s.sealSecrets(&se); err != nil {
+		return err
 	}
+
+	// Erase current contents
+	s.file.Truncate(0)
+
+	// Move file pointer to start
+	s.file.Seek(0, io.SeekStart)
+
 	b, err := json.MarshalIndent(se, "", "\t")
 	if err != nil {
 		return err
@@ -94,6 +226,16 @@ func (s *Store) Close() error {
 
 // SettingsStore Getters and Setters
 
+// CompressQueues returns whether or not the library queues are compressed when they are saved.
+func (s *Store) CompressQueues() bool {
+	return s.compressQueues
+}
+
+// SetCompressQueues sets whether or not the library queues are compressed when they are saved.
+func (s *Store) SetCompressQueues(b bool) {
+	s.compressQueues = b
+}
+
 // HealthCheckInterval returns the currently set health check interval.
 func (s *Store) HealthCheckInterval() uint64 {
 	return s.healthCheckInterval
@@ -124,8 +266,114 @@ func (s *Store) SetLogVerbosity(n string) {
 	s.logVerbosity = n
 }
 
-// NewStore returns an instantiated SettingsStore.
-func NewStore(configDir string) (Store, error) {
+// LogLevels returns the log verbosities which override the log verbosity for the components they name.
+func (s *Store) LogLevels() map[string]string {
+	s.mapsMu.RLock()
+	defer s.mapsMu.RUnlock()
+	return copyLogLevels(s.logLevels)
+}
+
+// SetLogLevels sets the log verbosities which override the log verbosity for the components they name.
+func (s *Store) SetLogLevels(m map[string]string) {
+	s.mapsMu.Lock()
+	defer s.mapsMu.Unlock()
+	s.logLevels = copyLogLevels(m)
+}
+
+// copyLogLevels returns a copy of m, so that the stored log levels aren't shared with the callers.
+func copyLogLevels(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// MaxJobAttempts returns the currently set maximum number of attempts for a job.
+func (s *Store) MaxJobAttempts() uint64 {
+	return s.maxJobAttempts
+}
+
+// SetMaxJobAttempts sets the maximum number of attempts for a job to the provided value.
+func (s *Store) SetMaxJobAttempts(n uint64) {
+	s.maxJobAttempts = n
+}
+
+// MediaServer returns the media server which is told to rescan the folders of replaced files.
+func (s *Store) MediaServer() controller.MediaServer {
+	return s.mediaServer
+}
+
+// SetMediaServer sets the media server which is told to rescan the folders of replaced files.
+func (s *Store) SetMediaServer(m controller.MediaServer) {
+	s.mediaServer = m
+}
+
+// Notifications returns the channels that events are posted to and when the daily digest is sent.
+func (s *Store) Notifications() controller.Notifications {
+	return s.notifications
+}
+
+// SetNotifications sets the channels that events are posted to and when the daily digest is sent.
+func (s *Store) SetNotifications(n controller.Notifications) {
+	s.notifications = n
+}
+
+// QuarantineExpiry returns how long a job stays quarantined before its file is evaluated again. 0 keeps jobs quarantined.
+func (s *Store) QuarantineExpiry() uint64 {
+	return s.quarantineExpiry
+}
+
+// SetQuarantineExpiry sets how long a job stays quarantined before its file is evaluated again to the provided value.
+func (s *Store) SetQuarantineExpiry(n uint64) {
+	s.quarantineExpiry = n
+}
+
+// QueryTimeout returns the currently set timeout of a single data storer call.
+func (s *Store) QueryTimeout() uint64 {
+	return s.queryTimeout
+}
+
+// SetQueryTimeout sets the timeout of a single data storer call to the provided value.
+func (s *Store) SetQueryTimeout(n uint64) {
+	s.queryTimeout = n
+}
+
+// StaleJobAction returns the currently set action for stale jobs.
+func (s *Store) StaleJobAction() string {
+	return s.staleJobAction
+}
+
+// SetStaleJobAction sets the action for stale jobs to the provided value.
+func (s *Store) SetStaleJobAction(a string) {
+	s.staleJobAction = a
+}
+
+// Secret returns the value of the provided sensitive setting, or an empty string if it isn't set.
+func (s *Store) Secret(name controller.SecretSetting) string {
+	s.mapsMu.RLock()
+	defer s.mapsMu.RUnlock()
+	return s.secrets[name]
+}
+
+// SetSecret sets the provided sensitive setting to v. An empty v clears the setting.
+func (s *Store) SetSecret(name controller.SecretSetting, v string) {
+	s.mapsMu.Lock()
+	defer s.mapsMu.Unlock()
+	if v == "" {
+		delete(s.secrets, name)
+		return
+	}
+	s.secrets[name] = v
+}
+
+// NewStore returns an instantiated SettingsStore. Sensitive settings are encrypted using the key in keyFile,
+// which is generated if it doesn't exist. ErrSecretsKeyMissing is returned if the settings were encrypted
+// with a key file which no longer exists.
+func NewStore(configDir, keyFile string) (Store, error) {
 	// Setup a SettingsStore struct with sensible defaults
 	s := defaultSettings()
 
@@ -148,6 +396,11 @@ func NewStore(configDir string) (Store, error) {
 		}
 	}
 
+	s.keyEncryptionKey, err = loadOrCreateKey(keyFile, hasEncryptedValues(b))
+	if err != nil {
+		return s, err
+	}
+
 	err = s.Load()
 	return s, err
 }
@@ -158,5 +411,27 @@ func defaultSettings() Store {
 		healthCheckInterval: uint64(1 * time.Minute),
 		healthCheckTimeout:  uint64(1 * time.Hour),
 		logVerbosity:        "INFO",
+		maxJobAttempts:      3,
+		queryTimeout:        uint64(30 * time.Second),
+		staleJobAction:      string(controller.StaleJobRequeue),
+		secrets:             make(map[controller.SecretSetting]string),
+		mapsMu:              &sync.RWMutex{},
+	}
+}
+
+// hasEncryptedValues returns whether or not the settings file contents b hold any encrypted values.
+func hasEncryptedValues(b []byte) bool {
+	se := settings{}
+	if err := json.Unmarshal(b, &se); err != nil {
+		return false
+	}
+	if se.DataKey != "" {
+		return true
+	}
+	for _, v := range se.Secrets {
+		if isEncrypted(v) {
+			return true
+		}
 	}
+	return false
 }
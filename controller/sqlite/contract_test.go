@@ -0,0 +1,26 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/BrenekH/encodarr/controller/storertest"
+)
+
+func TestStorerContract(t *testing.T) {
+	storertest.Run(t, func(t *testing.T) storertest.Storers {
+		db, err := NewDatabase(t.TempDir(), &mockLogger{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Client.Close() })
+
+		hc := NewHealthCheckerAdapter(&db, &mockLogger{})
+		lm := NewLibraryManagerAdapter(&db, &mockLogger{})
+		rc := NewRunnerCommunicatorAdapter(&db, &mockLogger{})
+		fc := NewFileCacheAdapter(&db)
+		je := NewJobEventAdapter(&db)
+		ui := NewUserInterfacerAdapter(&db, &mockLogger{})
+
+		return storertest.Storers{HealthChecker: &hc, LibraryManager: &lm, RunnerCommunicator: &rc, FileCache: &fc, JobEvents: &je, UserInterfacer: &ui}
+	})
+}
@@ -1,13 +1,18 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"sync"
+	"time"
 
-	_ "modernc.org/sqlite" // The SQLite database driver
+	"modernc.org/sqlite" // The SQLite database driver
+	sqlite3 "modernc.org/sqlite/lib"
 
 	"github.com/BrenekH/encodarr/controller"
 	"github.com/golang-migrate/migrate/v4"
@@ -18,11 +23,23 @@ import (
 //go:embed migrations
 var migrations embed.FS
 
-const targetMigrationVersion uint = 2
+const targetMigrationVersion uint = 32
+
+// busyTimeout is how long SQLite waits for another connection to release a lock before returning SQLITE_BUSY.
+const busyTimeout = 5 * time.Second
+
+// maxBusyRetries is how many times a write is retried after SQLite has returned SQLITE_BUSY.
+const maxBusyRetries = 5
 
 // Database is a wrapper around the database driver client
 type Database struct {
 	Client *sql.DB
+
+	// queryTimeout returns how long a single data storer call may take. Calls aren't limited if it is nil or returns 0.
+	queryTimeout func() time.Duration
+
+	// compressQueues returns whether or not library queues are compressed when they are saved. They aren't if it is nil.
+	compressQueues func() bool
 }
 
 // NewDatabase returns an instantiated SQLiteDatabase.
@@ -35,18 +52,168 @@ func NewDatabase(configDir string, logger controller.Logger) (Database, error) {
 		return Database{Client: client}, err
 	}
 
-	// Set max connections to 1 to prevent "database is locked" errors
+	// Set max connections to 1 to prevent "database is locked" errors. This also serializes the writes of this process,
+	// so only other processes (like the migration tool) can hold the lock.
 	client.SetMaxOpenConns(1)
 
-	err = gotoDBVer(dbFilename, targetMigrationVersion, configDir, dbBackupFilename, logger)
+	if _, err = client.Exec(fmt.Sprintf("PRAGMA busy_timeout = %d;", busyTimeout.Milliseconds())); err != nil {
+		return Database{Client: client}, err
+	}
+
+	// Move everything in the write-ahead log into the database file so that the backup made before migrating is complete.
+	if _, err = client.Exec("PRAGMA wal_checkpoint(TRUNCATE);"); err != nil {
+		return Database{Client: client}, err
+	}
+
+	if err = gotoDBVer(dbFilename, targetMigrationVersion, configDir, dbBackupFilename, logger); err != nil {
+		return Database{Client: client}, err
+	}
+
+	// The write-ahead log lets reads happen at the same time as a write instead of waiting for it.
+	// The journal mode is saved in the database file, so it stays enabled for other connections too.
+	_, err = client.Exec("PRAGMA journal_mode = WAL;")
 
 	return Database{Client: client}, err
 }
 
-// gotoDBVer uses github.com/golang-migrate/migrate to move the db version up or down to the passed target version.
+// SetQueryTimeout sets the function which returns how long a single call to one of the adapters may take.
+// It is called for every call, so the timeout can be changed while the Controller is running.
+func (d *Database) SetQueryTimeout(timeout func() time.Duration) {
+	d.queryTimeout = timeout
+}
+
+// withTimeout returns a context for a single adapter call which is done when ctx is, or once the query timeout
+// has elapsed. The returned function must be called when the call returns.
+//
+// Unlike the contexts of the context package, it is never done after that function has been called. modernc.org/sqlite
+// interrupts the connection whenever the context of a finished statement is cancelled, which either interrupts the next
+// statement run on it or crashes if it has been closed.
+func (d *Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	var timeout time.Duration
+	if d.queryTimeout != nil {
+		timeout = d.queryTimeout()
+	}
+	if timeout <= 0 && ctx.Done() == nil {
+		return ctx, func() {}
+	}
+
+	c := &callContext{Context: ctx, done: make(chan struct{}), released: make(chan struct{})}
+	var timer *time.Timer
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer = time.NewTimer(timeout)
+		expired = timer.C
+		c.deadline = time.Now().Add(timeout)
+	}
+
+	go func() {
+		if timer != nil {
+			defer timer.Stop()
+		}
+
+		select {
+		case <-ctx.Done():
+			c.finish(ctx.Err())
+		case <-expired:
+			c.finish(context.DeadlineExceeded)
+		case <-c.released:
+		}
+	}()
+
+	return c, c.release
+}
+
+// callContext is the context returned by Database.withTimeout.
+type callContext struct {
+	context.Context
+	deadline time.Time
+
+	done     chan struct{}
+	released chan struct{}
+
+	mu         sync.Mutex
+	err        error
+	isReleased bool
+}
+
+func (c *callContext) Deadline() (time.Time, bool) {
+	parent, ok := c.Context.Deadline()
+	if c.deadline.IsZero() || (ok && parent.Before(c.deadline)) {
+		return parent, ok
+	}
+	return c.deadline, true
+}
+
+func (c *callContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *callContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// finish makes c done with err, unless it has already been released.
+func (c *callContext) finish(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isReleased {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
+
+// release stops c from becoming done.
+func (c *callContext) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.isReleased {
+		c.isReleased = true
+		close(c.released)
+	}
+}
+
+// exec calls d.Client.ExecContext and retries it if the database is still busy after the busy timeout.
+func (d *Database) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var res sql.Result
+	err := retryOnBusy(ctx, func() (err error) {
+		res, err = d.Client.ExecContext(ctx, query, args...)
+		return
+	})
+	return res, err
+}
+
+// retryOnBusy calls f until it doesn't return SQLITE_BUSY, maxBusyRetries is reached, or ctx is done.
+func retryOnBusy(ctx context.Context, f func() error) error {
+	err := f()
+	for i := 1; i <= maxBusyRetries && isBusy(err); i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(i) * 100 * time.Millisecond):
+		}
+		err = f()
+	}
+	return err
+}
+
+// isBusy returns whether err is SQLITE_BUSY, including its extended result codes.
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code()&0xff == sqlite3.SQLITE_BUSY
+}
+
+// gotoDBVer uses github.com/golang-migrate/migrate to move the db version up to the passed target version.
+// Each migration is applied in its own transaction and the database is backed up before any are applied.
+// A database with a newer schema than targetVersion is left untouched and ErrDatabaseTooNew is returned.
 func gotoDBVer(dbFilename string, targetVersion uint, configDir string, backupFilename string, logger controller.Logger) error {
 	// Instead of directly using the embedded files, write them out to {configDir}/migrations. This allows the files for downgrading the
-	// database to be present even when the executable doesn't contain them.
+	// database to be present for the migrate CLI even when the executable doesn't contain them.
 	fsMigrationsDir := configDir + "/migrations"
 
 	if err := os.MkdirAll(fsMigrationsDir, 0777); err != nil {
@@ -94,10 +261,11 @@ func gotoDBVer(dbFilename string, targetVersion uint, configDir string, backupFi
 	}
 	defer mig.Close()
 
-	currentVer, _, err := mig.Version()
+	currentVer, dirty, err := mig.Version()
 	if err != nil {
 		if err == migrate.ErrNilVersion {
-			// DB is likely before golang-migrate was introduced. Upgrade to new version
+			// DB is likely before golang-migrate was introduced. The first migration only creates tables which don't exist yet,
+			// so it adopts the existing tables as version 1 before the rest of the migrations are applied.
 			logger.Warn("Database does not have a schema version. Attempting to migrate up.")
 			err = backupFile(dbFilename, backupFilename, logger)
 			if err != nil {
@@ -109,6 +277,14 @@ func gotoDBVer(dbFilename string, targetVersion uint, configDir string, backupFi
 		return err
 	}
 
+	if dirty {
+		return fmt.Errorf("database schema version %v is dirty because a migration failed part way through, restore %v to recover", currentVer, backupFilename)
+	}
+
+	if currentVer > targetVersion {
+		return fmt.Errorf("%w: database is at schema version %v but this Controller only supports up to version %v, upgrade the Controller or restore %v", controller.ErrDatabaseTooNew, currentVer, targetVersion, backupFilename)
+	}
+
 	if currentVer == targetVersion {
 		return nil
 	}
@@ -118,7 +294,7 @@ func gotoDBVer(dbFilename string, targetVersion uint, configDir string, backupFi
 		return err
 	}
 
-	logger.Info("Migrating database to schema version %v.", targetVersion)
+	logger.Info("Migrating database from schema version %v to %v.", currentVer, targetVersion)
 	return mig.Migrate(targetVersion)
 }
 
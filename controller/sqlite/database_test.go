@@ -0,0 +1,286 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// The fixtures in testdata are dumps of databases created by previous releases of the Controller.
+// pre_migration.sql predates golang-migrate and schema_v8.sql is the schema from the last release.
+
+func TestMigrateFixtures(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+	}{
+		{name: "Pre-migration database", fixture: "testdata/pre_migration.sql"},
+		{name: "Schema version 8", fixture: "testdata/schema_v8.sql"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configDir := t.TempDir()
+			loadFixture(t, configDir, test.fixture)
+
+			db, err := NewDatabase(configDir, &mockLogger{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer db.Client.Close()
+
+			if v := schemaVersion(t, db.Client); v != targetMigrationVersion {
+				t.Errorf("expected schema version %v but got %v", targetMigrationVersion, v)
+			}
+
+			if _, err := os.Stat(configDir + "/data.db.backup"); err != nil {
+				t.Errorf("expected the database to be backed up: %v", err)
+			}
+
+			lm := NewLibraryManagerAdapter(&db, &mockLogger{})
+			lib, err := lm.Library(context.Background(), 1)
+			if err != nil {
+				t.Fatalf("unexpected error reading library: %v", err)
+			}
+
+			if lib.Folder != "/media/tv" || lib.Priority != 2 || !reflect.DeepEqual(lib.PathMasks, []string{"sample"}) {
+				t.Errorf("library settings weren't kept: %+v", lib)
+			}
+			if len(lib.Queue.Items) != 1 || lib.Queue.Items[0].Path != "/media/tv/a.mkv" {
+				t.Errorf("library queue wasn't kept: %+v", lib.Queue.Items)
+			}
+			if len(lib.VerificationCommand) != 0 {
+				t.Errorf("expected no verification command but got %v", lib.VerificationCommand)
+			}
+
+			ui := NewUserInterfacerAdapter(&db, &mockLogger{})
+			history, err := ui.HistoryEntries(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error reading history: %v", err)
+			}
+			if len(history) != 1 || history[0].Filename != "/media/tv/b.mkv" {
+				t.Errorf("history wasn't kept: %+v", history)
+			}
+		})
+	}
+}
+
+func TestMigrateRefusesInvalidVersions(t *testing.T) {
+	tests := []struct {
+		name         string
+		version      uint
+		dirty        bool
+		expectTooNew bool
+	}{
+		{name: "Newer than the binary", version: targetMigrationVersion + 1, expectTooNew: true},
+		{name: "Dirty", version: 8, dirty: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configDir := t.TempDir()
+			client := loadFixture(t, configDir, "testdata/schema_v8.sql")
+			if _, err := client.Exec("UPDATE schema_migrations SET version = $1, dirty = $2;", test.version, test.dirty); err != nil {
+				t.Fatal(err)
+			}
+			client.Close()
+
+			db, err := NewDatabase(configDir, &mockLogger{})
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			defer db.Client.Close()
+
+			if errors.Is(err, controller.ErrDatabaseTooNew) != test.expectTooNew {
+				t.Errorf("expected ErrDatabaseTooNew to be %v but got: %v", test.expectTooNew, err)
+			}
+
+			if v := schemaVersion(t, db.Client); v != test.version {
+				t.Errorf("expected schema version to stay at %v but got %v", test.version, v)
+			}
+		})
+	}
+}
+
+// loadFixture creates data.db in configDir from the SQL dump at path and returns an open client to it.
+func loadFixture(t *testing.T, configDir, path string) *sql.DB {
+	t.Helper()
+
+	dump, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := sql.Open("sqlite", configDir+"/data.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	if _, err = client.Exec(string(dump)); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func schemaVersion(t *testing.T, client *sql.DB) uint {
+	t.Helper()
+
+	var v uint
+	if err := client.QueryRow("SELECT version FROM schema_migrations;").Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// Scans save libraries while Runners update their dispatched jobs, the user imports a config, and the web UI reads
+// the libraries. Two handles to the same file are used so that the writes actually contend for the database lock,
+// like they would with the migrate tool or another process.
+func TestConcurrentWrites(t *testing.T) {
+	configDir := t.TempDir()
+
+	scanDB, err := NewDatabase(configDir, &mockLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scanDB.Client.Close()
+
+	runnerDB, err := NewDatabase(configDir, &mockLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runnerDB.Client.Close()
+
+	lm := NewLibraryManagerAdapter(&scanDB, &mockLogger{})
+	rc := NewRunnerCommunicatorAdapter(&runnerDB, &mockLogger{})
+	ui := NewUserInterfacerAdapter(&runnerDB, &mockLogger{})
+
+	const writers = 8
+	const writes = 200
+
+	var wg sync.WaitGroup
+	errs := make(chan error, (2*writers+2)*writes)
+	hammer := func(f func(i int) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				if err := f(i); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	for w := 0; w < writers; w++ {
+		w := w
+		hammer(func(i int) error {
+			// Every writer owns its library, so each save is based on the previous one
+			return lm.SaveLibrary(context.Background(), controller.Library{ID: w, Version: i, Folder: "/media", Queue: controller.LibraryQueue{Items: []controller.Job{{Path: fmt.Sprintf("/media/%v.mkv", i)}}}})
+		})
+		hammer(func(i int) error {
+			return rc.SaveDispatchedJob(context.Background(), controller.DispatchedJob{UUID: controller.UUID(fmt.Sprint(w)), Job: controller.Job{Path: fmt.Sprintf("/media/dispatched%v.mkv", w)}, Runner: "Runner", Status: controller.JobStatus{Percentage: fmt.Sprint(i)}, LastUpdated: time.Now()})
+		})
+	}
+	hammer(func(i int) error {
+		return ui.ImportLibraries(context.Background(), []controller.Library{{ID: writers, Folder: "/media/imported"}})
+	})
+	hammer(func(i int) error {
+		_, err := lm.Libraries(context.Background())
+		return err
+	})
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// A call that is stuck waiting for the database (here for the only connection, which an open transaction holds)
+// must give up as soon as its context is cancelled or the query timeout elapses.
+func TestSlowCallsAreAborted(t *testing.T) {
+	tests := []struct {
+		name         string
+		queryTimeout time.Duration
+		cancelAfter  time.Duration
+		expectedErr  error
+	}{
+		{name: "Cancelled context", cancelAfter: 50 * time.Millisecond, expectedErr: context.Canceled},
+		{name: "Query timeout", queryTimeout: 50 * time.Millisecond, expectedErr: context.DeadlineExceeded},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := NewDatabase(t.TempDir(), &mockLogger{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Client.Close()
+			db.SetQueryTimeout(func() time.Duration { return test.queryTimeout })
+
+			tx, err := db.Client.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancelAfter > 0 {
+				time.AfterFunc(test.cancelAfter, cancel)
+			}
+
+			lm := NewLibraryManagerAdapter(&db, &mockLogger{})
+			start := time.Now()
+			_, err = lm.Libraries(ctx)
+
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected %v but got %v", test.expectedErr, err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected the call to be aborted promptly but it took %v", elapsed)
+			}
+		})
+	}
+}
+
+// IsPathDispatched is called for every file of every scan, so it must use the dispatched_jobs_path index
+// instead of scanning the table.
+func TestIsPathDispatchedUsesIndex(t *testing.T) {
+	db, err := NewDatabase(t.TempDir(), &mockLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Client.Close()
+
+	rows, err := db.Client.Query("EXPLAIN QUERY PLAN "+isPathDispatchedQuery, "/media/a.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	plan := ""
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err = rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan += detail + "\n"
+	}
+
+	if !strings.Contains(plan, "USING INDEX dispatched_jobs_path") {
+		t.Errorf("expected the lookup to use the dispatched_jobs_path index but the plan was:\n%v", plan)
+	}
+}
@@ -1,6 +1,7 @@
 package sqlite
 
 import (
+	"context"
 	"encoding/json"
 	"time"
 
@@ -19,8 +20,11 @@ type FileCacheAdapter struct {
 }
 
 // Modtime uses a SQL SELECT statement to obtain the modtime associated with the provided path.
-func (a *FileCacheAdapter) Modtime(path string) (time.Time, error) {
-	row := a.db.Client.QueryRow("SELECT modtime FROM files WHERE path = $1;", path)
+func (a *FileCacheAdapter) Modtime(ctx context.Context, path string) (time.Time, error) {
+	ctx, cancel := a.db.withTimeout(ctx)
+	defer cancel()
+
+	row := a.db.Client.QueryRowContext(ctx, "SELECT modtime FROM files WHERE path = $1;", path)
 
 	var storedModtime time.Time
 
@@ -33,8 +37,11 @@ func (a *FileCacheAdapter) Modtime(path string) (time.Time, error) {
 }
 
 // Metadata uses a SQL SELECT statement to obtain the metadata associated with the provided path.
-func (a *FileCacheAdapter) Metadata(path string) (controller.FileMetadata, error) {
-	row := a.db.Client.QueryRow("SELECT metadata FROM files WHERE path = $1;", path)
+func (a *FileCacheAdapter) Metadata(ctx context.Context, path string) (controller.FileMetadata, error) {
+	ctx, cancel := a.db.withTimeout(ctx)
+	defer cancel()
+
+	row := a.db.Client.QueryRowContext(ctx, "SELECT metadata FROM files WHERE path = $1;", path)
 
 	var storedMetadataBytes []byte
 
@@ -54,8 +61,11 @@ func (a *FileCacheAdapter) Metadata(path string) (controller.FileMetadata, error
 }
 
 // SaveModtime uses the UPSERT syntax to update the modtime that is associated with the provided path in the database.
-func (a *FileCacheAdapter) SaveModtime(path string, t time.Time) error {
-	_, err := a.db.Client.Exec("INSERT INTO files (path, modtime) VALUES ($1, $2) ON CONFLICT(path) DO UPDATE SET path=$1, modtime=$2;",
+func (a *FileCacheAdapter) SaveModtime(ctx context.Context, path string, t time.Time) error {
+	ctx, cancel := a.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := a.db.exec(ctx, "INSERT INTO files (path, modtime) VALUES ($1, $2) ON CONFLICT(path) DO UPDATE SET path=$1, modtime=$2;",
 		path,
 		t,
 	)
@@ -67,13 +77,16 @@ func (a *FileCacheAdapter) SaveModtime(path string, t time.Time) error {
 }
 
 // SaveMetadata uses the UPSERT syntax to update the metadata that is associated with the provided path in the database.
-func (a *FileCacheAdapter) SaveMetadata(path string, f controller.FileMetadata) error {
+func (a *FileCacheAdapter) SaveMetadata(ctx context.Context, path string, f controller.FileMetadata) error {
+	ctx, cancel := a.db.withTimeout(ctx)
+	defer cancel()
+
 	b, err := json.Marshal(f)
 	if err != nil {
 		return err
 	}
 
-	_, err = a.db.Client.Exec("INSERT INTO files (path, metadata) VALUES ($1, $2) ON CONFLICT(path) DO UPDATE SET path=$1, metadata=$2;",
+	_, err = a.db.exec(ctx, "INSERT INTO files (path, metadata) VALUES ($1, $2) ON CONFLICT(path) DO UPDATE SET path=$1, metadata=$2;",
 		path,
 		b,
 	)
@@ -1,7 +1,9 @@
 package sqlite
 
 import (
+	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/BrenekH/encodarr/controller"
 )
@@ -19,10 +21,13 @@ type HealthCheckerAdapter struct {
 }
 
 // DispatchedJobs returns all of the dispatched jobs in the database.
-func (h *HealthCheckerAdapter) DispatchedJobs() []controller.DispatchedJob {
+func (h *HealthCheckerAdapter) DispatchedJobs(ctx context.Context) []controller.DispatchedJob {
+	ctx, cancel := h.db.withTimeout(ctx)
+	defer cancel()
+
 	returnSlice := make([]controller.DispatchedJob, 0)
 
-	rows, err := h.db.Client.Query("SELECT uuid, runner, job, status, last_updated FROM dispatched_jobs;")
+	rows, err := h.db.Client.QueryContext(ctx, "SELECT uuid, runner, job, status, last_updated, lease_duration, lease_expires FROM dispatched_jobs;")
 	if err != nil {
 		h.logger.Error("%v", err)
 		return returnSlice
@@ -33,8 +38,16 @@ func (h *HealthCheckerAdapter) DispatchedJobs() []controller.DispatchedJob {
 		dj := controller.DispatchedJob{}
 		bJ := []byte("") // bytesJob. For intermediate loading into when scanning the rows
 		bS := []byte("") // bytesStatus. For intermediate loading into when scanning the rows
+		var leaseDuration string
+		var leaseExpires int64
+
+		err = rows.Scan(&dj.UUID, &dj.Runner, &bJ, &bS, &dj.LastUpdated, &leaseDuration, &leaseExpires)
+		if err != nil {
+			h.logger.Error("%v", err)
+			continue
+		}
 
-		err = rows.Scan(&dj.UUID, &dj.Runner, &bJ, &bS, &dj.LastUpdated)
+		err = setLease(&dj, leaseDuration, leaseExpires)
 		if err != nil {
 			h.logger.Error("%v", err)
 			continue
@@ -59,8 +72,72 @@ func (h *HealthCheckerAdapter) DispatchedJobs() []controller.DispatchedJob {
 	return returnSlice
 }
 
-// DeleteJob deletes a specific job from the database.
-func (h *HealthCheckerAdapter) DeleteJob(uuid controller.UUID) error {
-	_, err := h.db.Client.Exec("DELETE FROM dispatched_jobs WHERE uuid = $1;", uuid)
+// RevokeLease deletes a specific job from the database if its lease expired at or before now.
+func (h *HealthCheckerAdapter) RevokeLease(ctx context.Context, uuid controller.UUID, now time.Time) (bool, error) {
+	ctx, cancel := h.db.withTimeout(ctx)
+	defer cancel()
+
+	return revokeLease(ctx, h.db, uuid, now)
+}
+
+// revokeLease deletes the dispatched job with the provided UUID if its lease expired at or before now. It is shared by
+// the adapters which take dispatched jobs away.
+func revokeLease(ctx context.Context, db *Database, uuid controller.UUID, now time.Time) (bool, error) {
+	result, err := db.exec(ctx, "DELETE FROM dispatched_jobs WHERE uuid = $1 AND lease_expires <= $2;", uuid, now.UnixNano())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// Runners returns the content of the runners table.
+func (h *HealthCheckerAdapter) Runners(ctx context.Context) ([]controller.Runner, error) {
+	ctx, cancel := h.db.withTimeout(ctx)
+	defer cancel()
+
+	return runners(ctx, h.db, h.logger)
+}
+
+// StaleJobSettings returns the stale job settings of every library, including the deleted ones which may still
+// have dispatched jobs.
+func (h *HealthCheckerAdapter) StaleJobSettings(ctx context.Context) (map[int]controller.StaleJobSettings, error) {
+	ctx, cancel := h.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := h.db.Client.QueryContext(ctx, "SELECT id, stale_job_timeout, stale_job_action FROM libraries;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[int]controller.StaleJobSettings)
+	for rows.Next() {
+		var id int
+		var timeout, action string
+		if err = rows.Scan(&id, &timeout, &action); err != nil {
+			return nil, err
+		}
+
+		s := controller.StaleJobSettings{Action: controller.StaleJobAction(action)}
+		if timeout != "" {
+			if s.Timeout, err = time.ParseDuration(timeout); err != nil {
+				return nil, err
+			}
+		}
+		settings[id] = s
+	}
+
+	return settings, rows.Err()
+}
+
+// SaveHealthCheckAction inserts an action of the health checker into the health_check_actions table.
+func (h *HealthCheckerAdapter) SaveHealthCheckAction(ctx context.Context, a controller.HealthCheckAction) error {
+	ctx, cancel := h.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := h.db.exec(ctx, "INSERT INTO health_check_actions (time, job_uuid, runner, path, library_id, action, reason) VALUES ($1, $2, $3, $4, $5, $6, $7);",
+		a.Time, a.JobUUID, a.Runner, a.Path, a.LibraryID, a.Action, a.Reason)
 	return err
 }
@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// NewJobEventAdapter returns an instantiated JobEventAdapter.
+func NewJobEventAdapter(db *Database) JobEventAdapter {
+	return JobEventAdapter{db: db}
+}
+
+// JobEventAdapter satisfies the controller.JobEventDataStorer interface by turning interface
+// requests into SQL requests that are passed on to an underlying SQLiteDatabase.
+type JobEventAdapter struct {
+	db *Database
+}
+
+// SaveJobEvents inserts the provided events into the job_events table with a single INSERT statement.
+func (a *JobEventAdapter) SaveJobEvents(ctx context.Context, events []controller.JobEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ctx, cancel := a.db.withTimeout(ctx)
+	defer cancel()
+
+	values := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*6)
+	for i, e := range events {
+		n := i * 6
+		values = append(values, fmt.Sprintf("($%v, $%v, $%v, $%v, $%v, $%v)", n+1, n+2, n+3, n+4, n+5, n+6))
+		args = append(args, e.Time.UTC(), e.JobUUID, e.LibraryID, e.Component, e.Level, e.Message)
+	}
+
+	_, err := a.db.exec(ctx, "INSERT INTO job_events (time, job_uuid, library_id, component, level, message) VALUES "+strings.Join(values, ", ")+";", args...)
+	return err
+}
+
+// DeleteJobEventsBefore deletes the rows of the job_events table which were recorded before t.
+func (a *JobEventAdapter) DeleteJobEventsBefore(ctx context.Context, t time.Time) (int, error) {
+	ctx, cancel := a.db.withTimeout(ctx)
+	defer cancel()
+
+	res, err := a.db.exec(ctx, "DELETE FROM job_events WHERE time < $1;", t.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -1,7 +1,10 @@
 package sqlite
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"sort"
 	"time"
 
 	"github.com/BrenekH/encodarr/controller"
@@ -23,8 +26,11 @@ type LibraryManagerAdapter struct {
 }
 
 // Libraries returns all of the libraries available in the database.
-func (l *LibraryManagerAdapter) Libraries() ([]controller.Library, error) {
-	rows, err := l.db.Client.Query("SELECT id, folder, priority, fs_check_interval, cmd_decider_settings, queue, path_masks FROM libraries;")
+func (l *LibraryManagerAdapter) Libraries(ctx context.Context) ([]controller.Library, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := l.db.Client.QueryContext(ctx, "SELECT id, folder, priority, fs_check_interval, cmd_decider_settings, queue, path_masks, multi_part_patterns, skip_unchanged, verification_command, scan_on_startup, queue_order, stale_job_timeout, stale_job_action, metadata_read_concurrency, max_queued_bytes, original_file_handling, preserve_modtime, move_sidecars, notifications, metadata_read_timeout, metadata_read_args, version FROM libraries WHERE deleted_at IS NULL;")
 	if err != nil {
 		return nil, err
 	}
@@ -34,7 +40,7 @@ func (l *LibraryManagerAdapter) Libraries() ([]controller.Library, error) {
 		// Struct to scan into
 		d := dbLibrary{}
 
-		if err = rows.Scan(&d.ID, &d.Folder, &d.Priority, &d.FsCheckInterval, &d.CommandDeciderSettings, &d.Queue, &d.PathMasks); err != nil {
+		if err = rows.Scan(&d.ID, &d.Folder, &d.Priority, &d.FsCheckInterval, &d.CommandDeciderSettings, &d.Queue, &d.PathMasks, &d.MultiPartPatterns, &d.SkipUnchanged, &d.VerificationCommand, &d.ScanOnStartup, &d.QueueOrder, &d.StaleJobTimeout, &d.StaleJobAction, &d.MetadataReadConcurrency, &d.MaxQueuedBytes, &d.OriginalFileHandling, &d.PreserveModtime, &d.MoveSidecars, &d.Notifications, &d.MetadataReadTimeout, &d.MetadataReadArgs, &d.Version); err != nil {
 			l.logger.Error(err.Error())
 			continue
 		}
@@ -53,12 +59,15 @@ func (l *LibraryManagerAdapter) Libraries() ([]controller.Library, error) {
 }
 
 // Library returns a specific library in the database.
-func (l *LibraryManagerAdapter) Library(id int) (controller.Library, error) {
-	row := l.db.Client.QueryRow("SELECT id, folder, priority, fs_check_interval, cmd_decider_settings, queue, path_masks FROM libraries WHERE id = $1;", id)
+func (l *LibraryManagerAdapter) Library(ctx context.Context, id int) (controller.Library, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	row := l.db.Client.QueryRowContext(ctx, "SELECT id, folder, priority, fs_check_interval, cmd_decider_settings, queue, path_masks, multi_part_patterns, skip_unchanged, verification_command, scan_on_startup, queue_order, stale_job_timeout, stale_job_action, metadata_read_concurrency, max_queued_bytes, original_file_handling, preserve_modtime, move_sidecars, notifications, metadata_read_timeout, metadata_read_args, version FROM libraries WHERE id = $1 AND deleted_at IS NULL;", id)
 
 	d := dbLibrary{}
 
-	err := row.Scan(&d.ID, &d.Folder, &d.Priority, &d.FsCheckInterval, &d.CommandDeciderSettings, &d.Queue, &d.PathMasks)
+	err := row.Scan(&d.ID, &d.Folder, &d.Priority, &d.FsCheckInterval, &d.CommandDeciderSettings, &d.Queue, &d.PathMasks, &d.MultiPartPatterns, &d.SkipUnchanged, &d.VerificationCommand, &d.ScanOnStartup, &d.QueueOrder, &d.StaleJobTimeout, &d.StaleJobAction, &d.MetadataReadConcurrency, &d.MaxQueuedBytes, &d.OriginalFileHandling, &d.PreserveModtime, &d.MoveSidecars, &d.Notifications, &d.MetadataReadTimeout, &d.MetadataReadArgs, &d.Version)
 	if err != nil {
 		return controller.Library{}, err
 	}
@@ -67,13 +76,23 @@ func (l *LibraryManagerAdapter) Library(id int) (controller.Library, error) {
 }
 
 // SaveLibrary puts the provided controller.Library into the database.
-func (l *LibraryManagerAdapter) SaveLibrary(lib controller.Library) error {
-	d, err := toDBLibrary(lib)
+// A library with a Version of 0 is created, otherwise the stored library is only replaced if its Version still matches.
+// controller.ErrLibraryConflict is returned when another caller saved the library first.
+func (l *LibraryManagerAdapter) SaveLibrary(ctx context.Context, lib controller.Library) error {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	d, err := toDBLibrary(lib, l.db.shouldCompressQueues())
 	if err != nil {
 		return err
 	}
 
-	_, err = l.db.Client.Exec("INSERT INTO libraries (id, folder, priority, fs_check_interval, cmd_decider_settings, queue, path_masks) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT(id) DO UPDATE SET id=$1, folder=$2, priority=$3, fs_check_interval=$4, cmd_decider_settings=$5, queue=$6, path_masks=$7;",
+	query := "INSERT INTO libraries (id, folder, priority, fs_check_interval, cmd_decider_settings, queue, path_masks, multi_part_patterns, skip_unchanged, verification_command, scan_on_startup, version, queue_order, stale_job_timeout, stale_job_action, metadata_read_concurrency, max_queued_bytes, original_file_handling, preserve_modtime, move_sidecars, notifications, metadata_read_timeout, metadata_read_args) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12 + 1, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23) ON CONFLICT(id) DO NOTHING;"
+	if d.Version != 0 {
+		query = "UPDATE libraries SET folder=$2, priority=$3, fs_check_interval=$4, cmd_decider_settings=$5, queue=$6, path_masks=$7, multi_part_patterns=$8, skip_unchanged=$9, verification_command=$10, scan_on_startup=$11, queue_order=$13, stale_job_timeout=$14, stale_job_action=$15, metadata_read_concurrency=$16, max_queued_bytes=$17, original_file_handling=$18, preserve_modtime=$19, move_sidecars=$20, notifications=$21, metadata_read_timeout=$22, metadata_read_args=$23, version=$12 + 1 WHERE id = $1 AND version = $12;"
+	}
+
+	res, err := l.db.exec(ctx, query,
 		d.ID,
 		d.Folder,
 		d.Priority,
@@ -81,63 +100,171 @@ func (l *LibraryManagerAdapter) SaveLibrary(lib controller.Library) error {
 		d.CommandDeciderSettings,
 		d.Queue,
 		d.PathMasks,
+		d.MultiPartPatterns,
+		d.SkipUnchanged,
+		d.VerificationCommand,
+		d.ScanOnStartup,
+		d.Version,
+		d.QueueOrder,
+		d.StaleJobTimeout,
+		d.StaleJobAction,
+		d.MetadataReadConcurrency,
+		d.MaxQueuedBytes,
+		d.OriginalFileHandling,
+		d.PreserveModtime,
+		d.MoveSidecars,
+		d.Notifications,
+		d.MetadataReadTimeout,
+		d.MetadataReadArgs,
 	)
 	if err != nil {
 		l.logger.Error(err.Error())
 		return err
 	}
 
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return controller.ErrLibraryConflict
+	}
+
 	return nil
 }
 
-// IsPathDispatched loops through the dispatched_jobs table to determine if any jobs with the provided path have already been dispatched.
-func (l *LibraryManagerAdapter) IsPathDispatched(path string) (bool, error) {
-	rows, err := l.db.Client.Query("SELECT job FROM dispatched_jobs;")
+// AppendJobs adds the jobs whose paths aren't already queued to the library's queue in a single transaction.
+// The whole transaction is retried if the database is busy.
+func (l *LibraryManagerAdapter) AppendJobs(ctx context.Context, libraryID int, jobs []controller.Job) (appended []controller.Job, err error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	err = retryOnBusy(ctx, func() (err error) {
+		appended, err = l.appendJobs(ctx, libraryID, jobs)
+		return
+	})
+	return appended, err
+}
+
+func (l *LibraryManagerAdapter) appendJobs(ctx context.Context, libraryID int, jobs []controller.Job) ([]controller.Job, error) {
+	tx, err := l.db.Client.BeginTx(ctx, nil)
 	if err != nil {
-		return true, nil
+		return nil, err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	for rows.Next() {
-		bJob := []byte{}
+	var bQueue []byte
+	if err = tx.QueryRowContext(ctx, "SELECT queue FROM libraries WHERE id = $1 AND deleted_at IS NULL;", libraryID).Scan(&bQueue); err != nil {
+		return nil, err
+	}
 
-		if err = rows.Scan(&bJob); err != nil {
-			return true, err
-		}
+	var queue controller.LibraryQueue
+	if err = decodeQueue(bQueue, &queue); err != nil {
+		return nil, err
+	}
 
-		job := controller.Job{}
-		err = json.Unmarshal(bJob, &job)
-		if err != nil {
-			return true, err
-		}
+	appended := queue.PushNew(jobs)
+	if len(appended) == 0 {
+		return appended, nil
+	}
 
-		if job.Path == path {
-			return true, nil
-		}
+	if bQueue, err = encodeQueue(queue, l.db.shouldCompressQueues()); err != nil {
+		return nil, err
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE libraries SET queue = $2, version = version + 1 WHERE id = $1;", libraryID, bQueue); err != nil {
+		return nil, err
+	}
+
+	return appended, tx.Commit()
+}
+
+// isPathDispatchedQuery matches the expression of the dispatched_jobs_path index so that the lookup doesn't scan the table.
+const isPathDispatchedQuery = "SELECT EXISTS(SELECT 1 FROM dispatched_jobs WHERE json_extract(CAST(job AS TEXT), '$.path') = $1);"
+
+// IsPathDispatched uses a SQL SELECT statement to determine if any jobs with the provided path have already been dispatched.
+func (l *LibraryManagerAdapter) IsPathDispatched(ctx context.Context, path string) (bool, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	var dispatched bool
+	err := l.db.Client.QueryRowContext(ctx, isPathDispatchedQuery, path).Scan(&dispatched)
+	if err != nil {
+		return true, err
 	}
+	return dispatched, nil
+}
+
+// IsJobDispatched uses a SQL SELECT statement to determine if the job with the provided UUID has been dispatched.
+func (l *LibraryManagerAdapter) IsJobDispatched(ctx context.Context, uuid controller.UUID) (bool, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	var dispatched bool
+	err := l.db.Client.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM dispatched_jobs WHERE uuid = $1);", uuid).Scan(&dispatched)
+	if err != nil {
+		return true, err
+	}
+	return dispatched, nil
+}
+
+// DispatchedJobCount uses a SQL SELECT statement to count the dispatched jobs which belong to the provided library.
+func (l *LibraryManagerAdapter) DispatchedJobCount(ctx context.Context, libraryID int) (int, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	row := l.db.Client.QueryRowContext(ctx, "SELECT COUNT(*) FROM dispatched_jobs WHERE json_extract(CAST(job AS TEXT), '$.library_id') = $1;", libraryID)
+
+	var count int
+	err := row.Scan(&count)
+	return count, err
+}
+
+// DispatchedJobs returns the content of the dispatched jobs table.
+func (l *LibraryManagerAdapter) DispatchedJobs(ctx context.Context) ([]controller.DispatchedJob, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	return dispatchedJobs(ctx, l.db, l.logger)
+}
+
+// RevokeLease deletes a specific job from the database if its lease expired at or before now.
+func (l *LibraryManagerAdapter) RevokeLease(ctx context.Context, uuid controller.UUID, now time.Time) (bool, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
 
-	return false, nil
+	return revokeLease(ctx, l.db, uuid, now)
 }
 
 // PopDispatchedJob returns a specific dispatched job and removes it from the database.
-func (l *LibraryManagerAdapter) PopDispatchedJob(uuid controller.UUID) (controller.DispatchedJob, error) {
+func (l *LibraryManagerAdapter) PopDispatchedJob(ctx context.Context, uuid controller.UUID) (controller.DispatchedJob, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
 	// Get data from table
-	row := l.db.Client.QueryRow("SELECT job, status, runner, last_updated FROM dispatched_jobs WHERE uuid = $1", uuid)
+	row := l.db.Client.QueryRowContext(ctx, "SELECT job, status, runner, last_updated, lease_duration, lease_expires FROM dispatched_jobs WHERE uuid = $1", uuid)
 
 	dJob := controller.DispatchedJob{UUID: uuid}
 	bJob := []byte{}
 	bStatus := []byte{}
+	var leaseDuration string
+	var leaseExpires int64
 
 	err := row.Scan(
 		&bJob,
 		&bStatus,
 		&dJob.Runner,
 		&dJob.LastUpdated,
+		&leaseDuration,
+		&leaseExpires,
 	)
 	if err != nil {
 		return dJob, err
 	}
 
+	if err = setLease(&dJob, leaseDuration, leaseExpires); err != nil {
+		return dJob, err
+	}
+
 	if err = json.Unmarshal(bJob, &dJob.Job); err != nil {
 		return dJob, err
 	}
@@ -147,15 +274,95 @@ func (l *LibraryManagerAdapter) PopDispatchedJob(uuid controller.UUID) (controll
 	}
 
 	// Delete data from table
-	if _, err = l.db.Client.Exec("DELETE FROM dispatched_jobs WHERE uuid = $1;", uuid); err != nil {
+	if _, err = l.db.exec(ctx, "DELETE FROM dispatched_jobs WHERE uuid = $1;", uuid); err != nil {
 		return dJob, err
 	}
 
 	return dJob, nil
 }
 
+// HoldGroupPart uses the UPSERT syntax to save a held part of a multi-part set to the held_group_parts table.
+func (l *LibraryManagerAdapter) HoldGroupPart(ctx context.Context, p controller.HeldGroupPart) error {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	bC, err := json.Marshal(p.Completed)
+	if err != nil {
+		return err
+	}
+
+	bO, err := json.Marshal(p.Completed.History.Output)
+	if err != nil {
+		return err
+	}
+
+	bD, err := json.Marshal(p.Dispatched)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.db.exec(ctx, `INSERT INTO held_group_parts (uuid, group_key, completed_job, output, in_file, captions_file, dispatched_job)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT(uuid) DO UPDATE SET group_key=$2, completed_job=$3, output=$4, in_file=$5, captions_file=$6, dispatched_job=$7;`,
+		p.Completed.UUID,
+		p.Dispatched.Job.Group,
+		bC,
+		bO,
+		p.Completed.InFile,
+		p.Completed.CaptionsFile,
+		bD,
+	)
+	return err
+}
+
+// HeldGroupParts returns the held parts of multi-part sets from the held_group_parts table in insertion order.
+func (l *LibraryManagerAdapter) HeldGroupParts(ctx context.Context) ([]controller.HeldGroupPart, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := l.db.Client.QueryContext(ctx, "SELECT completed_job, output, in_file, captions_file, dispatched_job FROM held_group_parts ORDER BY rowid;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parts := make([]controller.HeldGroupPart, 0)
+	for rows.Next() {
+		var p controller.HeldGroupPart
+		var bC, bO, bD []byte
+		if err = rows.Scan(&bC, &bO, &p.Completed.InFile, &p.Completed.CaptionsFile, &bD); err != nil {
+			return nil, err
+		}
+
+		// InFile and CaptionsFile aren't part of the JSON, so they are kept while it is unmarshalled.
+		if err = json.Unmarshal(bC, &p.Completed); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(bO, &p.Completed.History.Output); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(bD, &p.Dispatched); err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+	return parts, rows.Err()
+}
+
+// ReleaseGroupParts deletes the held parts of the provided multi-part set from the held_group_parts table.
+func (l *LibraryManagerAdapter) ReleaseGroupParts(ctx context.Context, group string) error {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := l.db.exec(ctx, "DELETE FROM held_group_parts WHERE group_key = $1;", group)
+	return err
+}
+
 // PushHistory adds an entry to the history table.
-func (l *LibraryManagerAdapter) PushHistory(h controller.History) error {
+func (l *LibraryManagerAdapter) PushHistory(ctx context.Context, h controller.History) error {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
 	bW, err := json.Marshal(h.Warnings)
 	if err != nil {
 		return err
@@ -166,33 +373,660 @@ func (l *LibraryManagerAdapter) PushHistory(h controller.History) error {
 		return err
 	}
 
-	_, err = l.db.Client.Exec("INSERT INTO history (time_completed, filename, warnings, errors) VALUES ($1, $2, $3, $4);",
+	bJ, err := json.Marshal(h.Job)
+	if err != nil {
+		return err
+	}
+
+	bO, err := json.Marshal(h.Output)
+	if err != nil {
+		return err
+	}
+
+	bC, err := json.Marshal(h.Completion)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.db.exec(ctx, "INSERT INTO history (time_completed, filename, warnings, errors, uuid, runner, failed, job, output, completion, original_path) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);",
 		h.DateTimeCompleted,
 		h.Filename,
 		bW,
 		bE,
+		h.UUID,
+		h.Runner,
+		h.Failed,
+		bJ,
+		bO,
+		bC,
+		h.OriginalPath,
+	)
+	return err
+}
+
+// SaveBenchmarkResult adds a benchmark result to the benchmarks table.
+func (l *LibraryManagerAdapter) SaveBenchmarkResult(ctx context.Context, r controller.BenchmarkResult) error {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	bC, err := json.Marshal(r.Command)
+	if err != nil {
+		return err
+	}
+
+	bE, err := json.Marshal(r.Errors)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.db.exec(ctx, "INSERT INTO benchmarks (uuid, path, library_id, runner, settings, command, failed, errors, source_size, time_completed, elapsed, fps, projected_size) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);",
+		r.UUID,
+		r.Path,
+		r.LibraryID,
+		r.Runner,
+		r.Settings,
+		bC,
+		r.Failed,
+		bE,
+		r.SourceSize,
+		r.DateTimeCompleted,
+		r.Elapsed.String(),
+		r.FPS,
+		r.ProjectedSize,
+	)
+	return err
+}
+
+// IncrementJobAttempts uses the UPSERT syntax to increment the attempt counter of the provided path and returns the new value.
+func (l *LibraryManagerAdapter) IncrementJobAttempts(ctx context.Context, path string) (int, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := l.db.exec(ctx, "INSERT INTO job_attempts (path, attempts) VALUES ($1, 1) ON CONFLICT(path) DO UPDATE SET attempts = attempts + 1;", path)
+	if err != nil {
+		return 0, err
+	}
+
+	var attempts int
+	err = l.db.Client.QueryRowContext(ctx, "SELECT attempts FROM job_attempts WHERE path = $1;", path).Scan(&attempts)
+	return attempts, err
+}
+
+// ResetJobAttempts deletes the attempt counter of the provided path.
+func (l *LibraryManagerAdapter) ResetJobAttempts(ctx context.Context, path string) error {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := l.db.exec(ctx, "DELETE FROM job_attempts WHERE path = $1;", path)
+	return err
+}
+
+// QuarantineJob adds the provided job to the quarantined_jobs table, replacing any previous entry for the same path.
+func (l *LibraryManagerAdapter) QuarantineJob(ctx context.Context, q controller.QuarantinedJob) error {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	bJob, err := json.Marshal(q.Job)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.db.exec(ctx, "INSERT INTO quarantined_jobs (path, job, attempts, reason, time_quarantined) VALUES ($1, $2, $3, $4, $5) ON CONFLICT(path) DO UPDATE SET job=$2, attempts=$3, reason=$4, time_quarantined=$5;",
+		q.Job.Path,
+		bJob,
+		q.Attempts,
+		q.Reason,
+		q.DateTimeQuarantined,
+	)
+	return err
+}
+
+// IsPathQuarantined returns whether or not a job for the provided path is in the quarantined_jobs table.
+func (l *LibraryManagerAdapter) IsPathQuarantined(ctx context.Context, path string) (bool, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := l.db.Client.QueryRowContext(ctx, "SELECT COUNT(*) FROM quarantined_jobs WHERE path = $1;", path).Scan(&count)
+	return count > 0, err
+}
+
+// IsPathSkipped returns whether or not the provided path is in the skipped_paths table.
+func (l *LibraryManagerAdapter) IsPathSkipped(ctx context.Context, path string) (bool, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	var count int
+	err := l.db.Client.QueryRowContext(ctx, "SELECT COUNT(*) FROM skipped_paths WHERE path = $1;", path).Scan(&count)
+	return count > 0, err
+}
+
+// ReleaseExpiredQuarantines deletes the quarantined jobs which were quarantined before quarantinedBefore, along with
+// their attempt counters, in a single transaction and returns their paths. The times are compared after they are read,
+// because they are stored as text in whichever time zone they were quarantined in.
+func (l *LibraryManagerAdapter) ReleaseExpiredQuarantines(ctx context.Context, quarantinedBefore time.Time) (released []string, err error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	err = retryOnBusy(ctx, func() error {
+		released, err = l.releaseExpiredQuarantines(ctx, quarantinedBefore)
+		return err
+	})
+	return released, err
+}
+
+func (l *LibraryManagerAdapter) releaseExpiredQuarantines(ctx context.Context, quarantinedBefore time.Time) ([]string, error) {
+	tx, err := l.db.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT path, time_quarantined FROM quarantined_jobs;")
+	if err != nil {
+		return nil, err
+	}
+
+	released := make([]string, 0)
+	for rows.Next() {
+		var path string
+		var quarantined time.Time
+		if err = rows.Scan(&path, &quarantined); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if quarantined.Before(quarantinedBefore) {
+			released = append(released, path)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, path := range released {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM quarantined_jobs WHERE path = $1;", path); err != nil {
+			return nil, err
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM job_attempts WHERE path = $1;", path); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(released)
+	return released, tx.Commit()
+}
+
+// LastProcessedModtime uses a SQL SELECT statement to obtain the modtime that the provided path had when a job for it was last completed.
+func (l *LibraryManagerAdapter) LastProcessedModtime(ctx context.Context, path string) (time.Time, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	var modtime time.Time
+	err := l.db.Client.QueryRowContext(ctx, "SELECT modtime FROM processed_files WHERE path = $1;", path).Scan(&modtime)
+	return modtime, err
+}
+
+// SaveLastProcessedModtime uses the UPSERT syntax to update the modtime that the provided path had when a job for it was last completed.
+func (l *LibraryManagerAdapter) SaveLastProcessedModtime(ctx context.Context, path string, t time.Time) error {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := l.db.exec(ctx, "INSERT INTO processed_files (path, modtime) VALUES ($1, $2) ON CONFLICT(path) DO UPDATE SET modtime=$2;", path, t)
+	return err
+}
+
+// DeleteProcessedModtimes uses a SQL DELETE statement to forget the modtimes of every path starting with pathPrefix.
+func (l *LibraryManagerAdapter) DeleteProcessedModtimes(ctx context.Context, pathPrefix string) (int, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	res, err := l.db.exec(ctx, "DELETE FROM processed_files WHERE substr(path, 1, length($1)) = $1;", pathPrefix)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
+
+// FileSnapshotModtimes uses a SQL SELECT statement to obtain the modtimes of the file snapshots of the provided library.
+func (l *LibraryManagerAdapter) FileSnapshotModtimes(ctx context.Context, libraryID int) (map[string]time.Time, error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := l.db.Client.QueryContext(ctx, "SELECT path, modtime FROM file_snapshots WHERE library_id = $1;", libraryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	modtimes := make(map[string]time.Time)
+	for rows.Next() {
+		var path string
+		var modtime time.Time
+		if err = rows.Scan(&path, &modtime); err != nil {
+			return nil, err
+		}
+		modtimes[path] = modtime
+	}
+	return modtimes, rows.Err()
+}
+
+// SaveFileSnapshot uses the UPSERT syntax to replace the snapshot of the file at s.Path.
+func (l *LibraryManagerAdapter) SaveFileSnapshot(ctx context.Context, s controller.FileSnapshot) error {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := l.db.exec(ctx, `INSERT INTO file_snapshots (path, library_id, video_codec, width, height, duration, size, container, hdr, modtime)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT(path) DO UPDATE SET library_id=$2, video_codec=$3, width=$4, height=$5, duration=$6, size=$7, container=$8, hdr=$9, modtime=$10;`,
+		s.Path, s.LibraryID, s.VideoCodec, s.Width, s.Height, s.Duration, s.Size, s.Container, s.HDR, s.Modtime,
 	)
 	return err
 }
 
+// DeleteFileSnapshots deletes the snapshots of the provided paths in a single transaction.
+// The whole transaction is retried if the database is busy.
+func (l *LibraryManagerAdapter) DeleteFileSnapshots(ctx context.Context, paths []string) (deleted int, err error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	err = retryOnBusy(ctx, func() (err error) {
+		deleted, err = l.deleteFileSnapshots(ctx, paths)
+		return
+	})
+	return deleted, err
+}
+
+func (l *LibraryManagerAdapter) deleteFileSnapshots(ctx context.Context, paths []string) (int, error) {
+	tx, err := l.db.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	deleted := 0
+	for _, path := range paths {
+		res, err := tx.ExecContext(ctx, "DELETE FROM file_snapshots WHERE path = $1;", path)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		deleted += int(n)
+	}
+
+	return deleted, tx.Commit()
+}
+
+// DeleteLibrary marks the specified library as deleted at t. Its version is incremented so that saves which
+// started before the deletion conflict instead of succeeding.
+func (l *LibraryManagerAdapter) DeleteLibrary(ctx context.Context, id int, t time.Time) error {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	return deleteLibrary(ctx, l.db, id, t)
+}
+
+// RestoreLibrary clears the deleted mark of the specified library.
+func (l *LibraryManagerAdapter) RestoreLibrary(ctx context.Context, id int) error {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	return restoreLibrary(ctx, l.db, id)
+}
+
+// PurgeDeletedLibraries deletes the libraries which were deleted before deletedBefore, their quarantined jobs,
+// and their file snapshots in a single transaction. The whole transaction is retried if the database is busy.
+func (l *LibraryManagerAdapter) PurgeDeletedLibraries(ctx context.Context, deletedBefore time.Time) (purged []controller.Library, err error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	err = retryOnBusy(ctx, func() (err error) {
+		purged, err = l.purgeDeletedLibraries(ctx, "deleted_at < $1", deletedBefore.UTC())
+		return
+	})
+	return purged, err
+}
+
+// PurgeDeletedLibrary deletes the specified library, its quarantined jobs, and its file snapshots in a single
+// transaction, no matter when the library was deleted. sql.ErrNoRows is returned if the library isn't marked as deleted.
+func (l *LibraryManagerAdapter) PurgeDeletedLibrary(ctx context.Context, id int) (lib controller.Library, err error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	err = retryOnBusy(ctx, func() error {
+		purged, err := l.purgeDeletedLibraries(ctx, "id = $1 AND deleted_at IS NOT NULL", id)
+		if err != nil {
+			return err
+		} else if len(purged) == 0 {
+			return sql.ErrNoRows
+		}
+		lib = purged[0]
+		return nil
+	})
+	return lib, err
+}
+
+// purgeDeletedLibraries deletes the libraries which match condition, which is applied with args.
+func (l *LibraryManagerAdapter) purgeDeletedLibraries(ctx context.Context, condition string, args ...interface{}) ([]controller.Library, error) {
+	tx, err := l.db.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, folder, priority, fs_check_interval, cmd_decider_settings, queue, path_masks, multi_part_patterns, skip_unchanged, verification_command, scan_on_startup, queue_order, stale_job_timeout, stale_job_action, metadata_read_concurrency, max_queued_bytes, original_file_handling, preserve_modtime, move_sidecars, notifications, metadata_read_timeout, metadata_read_args, version, deleted_at FROM libraries WHERE "+condition+";", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	purged := make([]controller.Library, 0)
+	for rows.Next() {
+		d := dbLibrary{}
+		if err = rows.Scan(&d.ID, &d.Folder, &d.Priority, &d.FsCheckInterval, &d.CommandDeciderSettings, &d.Queue, &d.PathMasks, &d.MultiPartPatterns, &d.SkipUnchanged, &d.VerificationCommand, &d.ScanOnStartup, &d.QueueOrder, &d.StaleJobTimeout, &d.StaleJobAction, &d.MetadataReadConcurrency, &d.MaxQueuedBytes, &d.OriginalFileHandling, &d.PreserveModtime, &d.MoveSidecars, &d.Notifications, &d.MetadataReadTimeout, &d.MetadataReadArgs, &d.Version, &d.DeletedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		lib, err := fromDBLibrary(d)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		purged = append(purged, lib)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, lib := range purged {
+		if _, err = tx.ExecContext(ctx, "UPDATE history SET library_folder = $2 WHERE library_folder IS NULL AND json_extract(CAST(job AS TEXT), '$.library_id') = $1;", lib.ID, lib.Folder); err != nil {
+			return nil, err
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM quarantined_jobs WHERE json_extract(CAST(job AS TEXT), '$.library_id') = $1;", lib.ID); err != nil {
+			return nil, err
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM file_snapshots WHERE library_id = $1;", lib.ID); err != nil {
+			return nil, err
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM libraries WHERE id = $1;", lib.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return purged, tx.Commit()
+}
+
+// CanonicalizePaths rewrites the paths of the processed_files, job_attempts, quarantined_jobs, and skipped_paths tables with
+// canonicalize in a single transaction. Rows which end up with the same path are merged by keeping the latest modtime, the
+// highest attempt count, the quarantined job which was already at the canonical path, and the earliest skip.
+func (l *LibraryManagerAdapter) CanonicalizePaths(ctx context.Context, canonicalize func(path string) string) (changed int, err error) {
+	ctx, cancel := l.db.withTimeout(ctx)
+	defer cancel()
+
+	err = retryOnBusy(ctx, func() (err error) {
+		changed, err = l.canonicalizePaths(ctx, canonicalize)
+		return
+	})
+	return changed, err
+}
+
+func (l *LibraryManagerAdapter) canonicalizePaths(ctx context.Context, canonicalize func(path string) string) (changed int, err error) {
+	tx, err := l.db.Client.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, f := range []func(context.Context, *sql.Tx, func(string) string) (int, error){canonicalizeProcessedFiles, canonicalizeJobAttempts, canonicalizeQuarantinedJobs, canonicalizeSkippedPaths} {
+		n, err := f(ctx, tx, canonicalize)
+		if err != nil {
+			return 0, err
+		}
+		changed += n
+	}
+
+	return changed, tx.Commit()
+}
+
+// canonicalizeProcessedFiles canonicalizes the paths of the processed_files table, keeping the latest modtime of merged rows.
+func canonicalizeProcessedFiles(ctx context.Context, tx *sql.Tx, canonicalize func(string) string) (int, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT path, modtime FROM processed_files;")
+	if err != nil {
+		return 0, err
+	}
+
+	merged := make(map[string]time.Time)
+	toMove := make([]string, 0)
+	for rows.Next() {
+		var path string
+		var modtime time.Time
+		if err = rows.Scan(&path, &modtime); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		canonical := canonicalize(path)
+		if canonical != path {
+			toMove = append(toMove, path)
+		}
+		if t, ok := merged[canonical]; !ok || modtime.After(t) {
+			merged[canonical] = modtime
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, path := range toMove {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM processed_files WHERE path = $1;", path); err != nil {
+			return 0, err
+		}
+		canonical := canonicalize(path)
+		if _, err = tx.ExecContext(ctx, "INSERT INTO processed_files (path, modtime) VALUES ($1, $2) ON CONFLICT(path) DO UPDATE SET modtime=$2;", canonical, merged[canonical]); err != nil {
+			return 0, err
+		}
+	}
+	return len(toMove), nil
+}
+
+// canonicalizeSkippedPaths canonicalizes the paths of the skipped_paths table, keeping the earliest skip of merged rows.
+func canonicalizeSkippedPaths(ctx context.Context, tx *sql.Tx, canonicalize func(string) string) (int, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT path, time_skipped FROM skipped_paths;")
+	if err != nil {
+		return 0, err
+	}
+
+	merged := make(map[string]time.Time)
+	toMove := make([]string, 0)
+	for rows.Next() {
+		var path string
+		var skipped time.Time
+		if err = rows.Scan(&path, &skipped); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		canonical := canonicalize(path)
+		if canonical != path {
+			toMove = append(toMove, path)
+		}
+		if t, ok := merged[canonical]; !ok || skipped.Before(t) {
+			merged[canonical] = skipped
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, path := range toMove {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM skipped_paths WHERE path = $1;", path); err != nil {
+			return 0, err
+		}
+		canonical := canonicalize(path)
+		if _, err = tx.ExecContext(ctx, "INSERT INTO skipped_paths (path, time_skipped) VALUES ($1, $2) ON CONFLICT(path) DO UPDATE SET time_skipped=$2;", canonical, merged[canonical]); err != nil {
+			return 0, err
+		}
+	}
+	return len(toMove), nil
+}
+
+// canonicalizeJobAttempts canonicalizes the paths of the job_attempts table, keeping the highest attempt count of merged rows.
+func canonicalizeJobAttempts(ctx context.Context, tx *sql.Tx, canonicalize func(string) string) (int, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT path, attempts FROM job_attempts;")
+	if err != nil {
+		return 0, err
+	}
+
+	merged := make(map[string]int)
+	toMove := make([]string, 0)
+	for rows.Next() {
+		var path string
+		var attempts int
+		if err = rows.Scan(&path, &attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		canonical := canonicalize(path)
+		if canonical != path {
+			toMove = append(toMove, path)
+		}
+		if a, ok := merged[canonical]; !ok || attempts > a {
+			merged[canonical] = attempts
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, path := range toMove {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM job_attempts WHERE path = $1;", path); err != nil {
+			return 0, err
+		}
+		canonical := canonicalize(path)
+		if _, err = tx.ExecContext(ctx, "INSERT INTO job_attempts (path, attempts) VALUES ($1, $2) ON CONFLICT(path) DO UPDATE SET attempts=$2;", canonical, merged[canonical]); err != nil {
+			return 0, err
+		}
+	}
+	return len(toMove), nil
+}
+
+// canonicalizeQuarantinedJobs canonicalizes the paths of the quarantined_jobs table, including the paths of the jobs themselves.
+// A quarantined job which is already at the canonical path is kept over the ones being moved to it.
+func canonicalizeQuarantinedJobs(ctx context.Context, tx *sql.Tx, canonicalize func(string) string) (int, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT path, job FROM quarantined_jobs;")
+	if err != nil {
+		return 0, err
+	}
+
+	present := make(map[string]bool)
+	toMove := make(map[string][]byte)
+	order := make([]string, 0)
+	for rows.Next() {
+		var path string
+		var bJob []byte
+		if err = rows.Scan(&path, &bJob); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		present[path] = true
+		if canonicalize(path) != path {
+			toMove[path] = bJob
+			order = append(order, path)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, path := range order {
+		canonical := canonicalize(path)
+		if present[canonical] {
+			if _, err = tx.ExecContext(ctx, "DELETE FROM quarantined_jobs WHERE path = $1;", path); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		var job controller.Job
+		if err = json.Unmarshal(toMove[path], &job); err != nil {
+			return 0, err
+		}
+		job.Path = canonical
+		bJob, err := json.Marshal(job)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err = tx.ExecContext(ctx, "UPDATE quarantined_jobs SET path = $1, job = $2 WHERE path = $3;", canonical, bJob, path); err != nil {
+			return 0, err
+		}
+		present[canonical] = true
+	}
+	return len(order), nil
+}
+
 // dbLibrary is an interim struct for converting to and from the data types in memory and in the database.
 type dbLibrary struct {
-	ID                     int
-	Folder                 string
-	Priority               int
-	CommandDeciderSettings string
-	FsCheckInterval        string
-	Queue                  []byte
-	PathMasks              []byte
+	ID                      int
+	Folder                  string
+	Priority                int
+	CommandDeciderSettings  string
+	FsCheckInterval         string
+	Queue                   []byte
+	PathMasks               []byte
+	MultiPartPatterns       []byte
+	SkipUnchanged           bool
+	VerificationCommand     []byte
+	ScanOnStartup           bool
+	QueueOrder              string
+	StaleJobTimeout         string
+	StaleJobAction          string
+	MetadataReadConcurrency int
+	MaxQueuedBytes          int64
+	OriginalFileHandling    string
+	PreserveModtime         bool
+	MoveSidecars            bool
+	Notifications           []byte
+	MetadataReadTimeout     string
+	MetadataReadArgs        []byte
+	Version                 int
+	DeletedAt               sql.NullTime
 }
 
 // fromDBLibrary sets the instantiated variables according to the decoded information from the provided dBLibrary.
 func fromDBLibrary(d dbLibrary) (controller.Library, error) {
 	l := controller.Library{
-		ID:                     d.ID,
-		Folder:                 d.Folder,
-		Priority:               d.Priority,
-		CommandDeciderSettings: d.CommandDeciderSettings,
+		ID:                      d.ID,
+		Folder:                  d.Folder,
+		Priority:                d.Priority,
+		CommandDeciderSettings:  d.CommandDeciderSettings,
+		SkipUnchanged:           d.SkipUnchanged,
+		ScanOnStartup:           d.ScanOnStartup,
+		QueueOrder:              controller.QueueOrder(d.QueueOrder),
+		StaleJobAction:          controller.StaleJobAction(d.StaleJobAction),
+		MetadataReadConcurrency: d.MetadataReadConcurrency,
+		MaxQueuedBytes:          d.MaxQueuedBytes,
+		OriginalFileHandling:    controller.OriginalFileHandling(d.OriginalFileHandling),
+		PreserveModtime:         d.PreserveModtime,
+		MoveSidecars:            d.MoveSidecars,
+		Version:                 d.Version,
+	}
+	if d.DeletedAt.Valid {
+		l.DeletedAt = d.DeletedAt.Time
 	}
 
 	var err error
@@ -203,7 +1037,21 @@ func fromDBLibrary(d dbLibrary) (controller.Library, error) {
 		}
 	}
 
-	if err = json.Unmarshal(d.Queue, &l.Queue); err != nil {
+	if d.StaleJobTimeout != "" {
+		l.StaleJobTimeout, err = time.ParseDuration(d.StaleJobTimeout)
+		if err != nil {
+			return l, err
+		}
+	}
+
+	if d.MetadataReadTimeout != "" {
+		l.MetadataReadTimeout, err = time.ParseDuration(d.MetadataReadTimeout)
+		if err != nil {
+			return l, err
+		}
+	}
+
+	if err = decodeQueue(d.Queue, &l.Queue); err != nil {
 		return l, err
 	}
 
@@ -211,19 +1059,48 @@ func fromDBLibrary(d dbLibrary) (controller.Library, error) {
 		return l, err
 	}
 
+	if err = json.Unmarshal(d.MultiPartPatterns, &l.MultiPartPatterns); err != nil {
+		return l, err
+	}
+
+	if err = json.Unmarshal(d.VerificationCommand, &l.VerificationCommand); err != nil {
+		return l, err
+	}
+
+	if err = json.Unmarshal(d.Notifications, &l.Notifications); err != nil {
+		return l, err
+	}
+
+	if err = json.Unmarshal(d.MetadataReadArgs, &l.MetadataReadArgs); err != nil {
+		return l, err
+	}
+
 	return l, nil
 }
 
 // toDBLibrary returns an instance of dbLibrary with all of the necessary conversions to save data into the database.
-func toDBLibrary(lib controller.Library) (d dbLibrary, err error) {
+// The queue is gzip compressed if compressQueue is true.
+func toDBLibrary(lib controller.Library, compressQueue bool) (d dbLibrary, err error) {
 	d.ID = lib.ID
 	d.Folder = lib.Folder
 	d.Priority = lib.Priority
 	d.CommandDeciderSettings = lib.CommandDeciderSettings
+	d.SkipUnchanged = lib.SkipUnchanged
+	d.ScanOnStartup = lib.ScanOnStartup
+	d.QueueOrder = string(lib.QueueOrder)
+	d.StaleJobAction = string(lib.StaleJobAction)
+	d.MetadataReadConcurrency = lib.MetadataReadConcurrency
+	d.MaxQueuedBytes = lib.MaxQueuedBytes
+	d.OriginalFileHandling = string(lib.OriginalFileHandling)
+	d.PreserveModtime = lib.PreserveModtime
+	d.MoveSidecars = lib.MoveSidecars
+	d.Version = lib.Version
 
 	d.FsCheckInterval = lib.FsCheckInterval.String()
+	d.StaleJobTimeout = lib.StaleJobTimeout.String()
+	d.MetadataReadTimeout = lib.MetadataReadTimeout.String()
 
-	d.Queue, err = json.Marshal(lib.Queue)
+	d.Queue, err = encodeQueue(lib.Queue, compressQueue)
 	if err != nil {
 		return
 	}
@@ -233,5 +1110,25 @@ func toDBLibrary(lib controller.Library) (d dbLibrary, err error) {
 		return
 	}
 
+	d.MultiPartPatterns, err = json.Marshal(lib.MultiPartPatterns)
+	if err != nil {
+		return
+	}
+
+	d.VerificationCommand, err = json.Marshal(lib.VerificationCommand)
+	if err != nil {
+		return
+	}
+
+	d.Notifications, err = json.Marshal(lib.Notifications)
+	if err != nil {
+		return
+	}
+
+	d.MetadataReadArgs, err = json.Marshal(lib.MetadataReadArgs)
+	if err != nil {
+		return
+	}
+
 	return
 }
@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// benchmarkJobCount is the number of jobs queued by BenchmarkQueueJobs, which is about what a scan of a new large library finds.
+const benchmarkJobCount = 10_000
+
+// benchmarkAppendBatchSize matches the batch size used by library scans.
+const benchmarkAppendBatchSize = 100
+
+func benchmarkJobs() []controller.Job {
+	jobs := make([]controller.Job, benchmarkJobCount)
+	for i := range jobs {
+		jobs[i] = controller.Job{
+			UUID:      controller.UUID(fmt.Sprint(i)),
+			LibraryID: 1,
+			Path:      fmt.Sprintf("/media/tv/show/season/%v.mkv", i),
+			Command:   []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", "libx265", "ENCODARR_OUTPUT_FILE"},
+			Metadata:  controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080}}},
+		}
+	}
+	return jobs
+}
+
+// BenchmarkQueueJobs compares queuing every job with its own read and SaveLibrary, which is what scans used to do,
+// with adding them in batches with AppendJobs.
+func BenchmarkQueueJobs(b *testing.B) {
+	jobs := benchmarkJobs()
+
+	newAdapter := func(b *testing.B) *LibraryManagerAdapter {
+		db, err := NewDatabase(b.TempDir(), &mockLogger{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { db.Client.Close() })
+
+		lm := NewLibraryManagerAdapter(&db, &mockLogger{})
+		if err = lm.SaveLibrary(context.Background(), controller.Library{ID: 1}); err != nil {
+			b.Fatal(err)
+		}
+		return &lm
+	}
+
+	b.Run("SaveLibrary", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			lm := newAdapter(b)
+			b.StartTimer()
+
+			for _, job := range jobs {
+				lib, err := lm.Library(context.Background(), 1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				lib.Queue.Push(job)
+				if err = lm.SaveLibrary(context.Background(), lib); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("AppendJobs", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			lm := newAdapter(b)
+			b.StartTimer()
+
+			for start := 0; start < len(jobs); start += benchmarkAppendBatchSize {
+				if _, err := lm.AppendJobs(context.Background(), 1, jobs[start:start+benchmarkAppendBatchSize]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func TestCompressedQueues(t *testing.T) {
+	db, err := NewDatabase(t.TempDir(), &mockLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Client.Close()
+
+	compress := false
+	db.SetCompressQueues(func() bool { return compress })
+	ctx := context.Background()
+	lm := NewLibraryManagerAdapter(&db, &mockLogger{})
+	ui := NewUserInterfacerAdapter(&db, &mockLogger{})
+
+	rawQueue := func(id int) []byte {
+		var b []byte
+		if err := db.Client.QueryRow("SELECT queue FROM libraries WHERE id = $1;", id).Scan(&b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	queuedPaths := func(id int) []string {
+		lib, err := lm.Library(ctx, id)
+		if err != nil {
+			t.Fatalf("unexpected error reading library %v: %v", id, err)
+		}
+		paths := make([]string, 0, len(lib.Queue.Items))
+		for _, j := range lib.Queue.Items {
+			paths = append(paths, j.Path)
+		}
+		return paths
+	}
+
+	// Library 1 is saved before compression is turned on, like the queues of existing databases.
+	lib := controller.Library{ID: 1}
+	lib.Queue.Push(controller.Job{UUID: "a", LibraryID: 1, Path: "/media/1/a.mkv"})
+	if err = lm.SaveLibrary(ctx, lib); err != nil {
+		t.Fatal(err)
+	}
+
+	compress = true
+	lib = controller.Library{ID: 2}
+	lib.Queue.Push(controller.Job{UUID: "b", LibraryID: 2, Path: "/media/2/b.mkv"})
+	if err = lm.SaveLibrary(ctx, lib); err != nil {
+		t.Fatal(err)
+	}
+
+	if raw := rawQueue(1); bytes.HasPrefix(raw, gzipMagic) {
+		t.Errorf("expected the queue saved before compression was turned on to be left alone")
+	}
+	if raw := rawQueue(2); !bytes.HasPrefix(raw, gzipMagic) {
+		t.Errorf("expected the queue to be saved compressed but got %q", raw)
+	}
+
+	if paths := queuedPaths(1); !reflect.DeepEqual(paths, []string{"/media/1/a.mkv"}) {
+		t.Errorf("expected the uncompressed queue to be read but got %v", paths)
+	}
+	if paths := queuedPaths(2); !reflect.DeepEqual(paths, []string{"/media/2/b.mkv"}) {
+		t.Errorf("expected the compressed queue to be read but got %v", paths)
+	}
+
+	// Appending to the old queue compresses it.
+	if _, err = lm.AppendJobs(ctx, 1, []controller.Job{{UUID: "c", LibraryID: 1, Path: "/media/1/c.mkv"}}); err != nil {
+		t.Fatal(err)
+	}
+	if raw := rawQueue(1); !bytes.HasPrefix(raw, gzipMagic) {
+		t.Errorf("expected the appended queue to be saved compressed")
+	}
+	if paths := queuedPaths(1); !reflect.DeepEqual(paths, []string{"/media/1/a.mkv", "/media/1/c.mkv"}) {
+		t.Errorf("expected the appended queue to be read back but got %v", paths)
+	}
+
+	// Turning compression back off still reads the compressed queues and saves them uncompressed again.
+	compress = false
+	if _, err = lm.AppendJobs(ctx, 2, []controller.Job{{UUID: "d", LibraryID: 2, Path: "/media/2/d.mkv"}}); err != nil {
+		t.Fatal(err)
+	}
+	if raw := rawQueue(2); bytes.HasPrefix(raw, gzipMagic) {
+		t.Errorf("expected the queue to be saved uncompressed after turning compression off")
+	}
+	if paths := queuedPaths(2); !reflect.DeepEqual(paths, []string{"/media/2/b.mkv", "/media/2/d.mkv"}) {
+		t.Errorf("expected the queue to be read back after turning compression off but got %v", paths)
+	}
+
+	// Searches look inside both kinds of queues.
+	results, _, err := ui.SearchFiles(ctx, "/media/", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make([]string, 0, len(results))
+	for _, r := range results {
+		found = append(found, r.Path)
+	}
+	sort.Strings(found)
+	if expected := []string{"/media/1/a.mkv", "/media/1/c.mkv", "/media/2/b.mkv", "/media/2/d.mkv"}; !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected search results %v but got %v", expected, found)
+	}
+}
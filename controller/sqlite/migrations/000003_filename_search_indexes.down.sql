@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS history_filename;
+
+DROP INDEX IF EXISTS dispatched_jobs_path;
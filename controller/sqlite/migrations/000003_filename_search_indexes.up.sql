@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS history_filename ON history(filename);
+
+CREATE INDEX IF NOT EXISTS dispatched_jobs_path ON dispatched_jobs(json_extract(CAST(job AS TEXT), '$.path'));
@@ -0,0 +1 @@
+ALTER TABLE libraries DROP COLUMN multi_part_patterns;
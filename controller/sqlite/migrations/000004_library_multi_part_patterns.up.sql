@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN multi_part_patterns binary DEFAULT '[]';
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS runners (
+    uuid text NOT NULL UNIQUE,
+    name text NOT NULL UNIQUE,
+    display_name text,
+    version text,
+    last_seen timestamp,
+    jobs_completed integer DEFAULT 0,
+    jobs_failed integer DEFAULT 0
+);
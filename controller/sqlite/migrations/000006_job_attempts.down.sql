@@ -0,0 +1,2 @@
+DROP TABLE quarantined_jobs;
+DROP TABLE job_attempts;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS job_attempts (
+    path text NOT NULL UNIQUE,
+    attempts integer DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS quarantined_jobs (
+    path text NOT NULL UNIQUE,
+    job binary,
+    attempts integer,
+    reason text,
+    time_quarantined timestamp
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS history_uuid;
+
+ALTER TABLE history DROP COLUMN job;
+ALTER TABLE history DROP COLUMN failed;
+ALTER TABLE history DROP COLUMN runner;
+ALTER TABLE history DROP COLUMN uuid;
@@ -0,0 +1,6 @@
+ALTER TABLE history ADD COLUMN uuid text;
+ALTER TABLE history ADD COLUMN runner text;
+ALTER TABLE history ADD COLUMN failed boolean DEFAULT false;
+ALTER TABLE history ADD COLUMN job binary;
+
+CREATE INDEX IF NOT EXISTS history_uuid ON history(uuid);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS processed_files;
+
+ALTER TABLE libraries DROP COLUMN skip_unchanged;
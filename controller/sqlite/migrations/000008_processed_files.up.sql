@@ -0,0 +1,6 @@
+ALTER TABLE libraries ADD COLUMN skip_unchanged boolean DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS processed_files (
+    path text NOT NULL UNIQUE,
+    modtime timestamp
+);
@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN verification_command binary DEFAULT '[]';
@@ -0,0 +1 @@
+ALTER TABLE libraries DROP COLUMN scan_on_startup;
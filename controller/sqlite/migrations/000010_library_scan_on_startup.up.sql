@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN scan_on_startup boolean DEFAULT true;
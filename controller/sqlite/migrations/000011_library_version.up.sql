@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN version integer NOT NULL DEFAULT 1;
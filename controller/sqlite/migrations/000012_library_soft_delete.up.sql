@@ -0,0 +1,2 @@
+ALTER TABLE libraries ADD COLUMN deleted_at timestamp;
+ALTER TABLE history ADD COLUMN library_folder text;
@@ -0,0 +1 @@
+ALTER TABLE libraries DROP COLUMN queue_order;
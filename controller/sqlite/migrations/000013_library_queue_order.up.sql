@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN queue_order text DEFAULT 'path';
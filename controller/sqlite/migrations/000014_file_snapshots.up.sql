@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS file_snapshots (
+    path text NOT NULL UNIQUE,
+    library_id integer,
+    video_codec text,
+    width integer,
+    height integer,
+    duration real,
+    size integer,
+    container text,
+    hdr boolean,
+    modtime timestamp
+);
+
+CREATE INDEX IF NOT EXISTS file_snapshots_library_id ON file_snapshots(library_id);
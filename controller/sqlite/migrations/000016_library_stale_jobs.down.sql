@@ -0,0 +1,2 @@
+ALTER TABLE libraries DROP COLUMN stale_job_action;
+ALTER TABLE libraries DROP COLUMN stale_job_timeout;
@@ -0,0 +1 @@
+ALTER TABLE libraries DROP COLUMN metadata_read_concurrency;
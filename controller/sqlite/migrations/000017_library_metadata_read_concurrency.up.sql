@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN metadata_read_concurrency integer DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE dispatched_jobs ADD COLUMN lease_duration text DEFAULT '0s';
+ALTER TABLE dispatched_jobs ADD COLUMN lease_expires integer DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN max_queued_bytes integer DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS dispatched_jobs_path;
+CREATE INDEX IF NOT EXISTS dispatched_jobs_path ON dispatched_jobs(json_extract(CAST(job AS TEXT), '$.path'));
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS health_check_actions (
+    time timestamp,
+    job_uuid text,
+    runner text,
+    path text,
+    library_id integer,
+    action text,
+    reason text
+);
+
+CREATE INDEX IF NOT EXISTS health_check_actions_time ON health_check_actions(time);
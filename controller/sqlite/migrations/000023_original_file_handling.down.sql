@@ -0,0 +1,2 @@
+ALTER TABLE libraries DROP COLUMN original_file_handling;
+ALTER TABLE history DROP COLUMN original_path;
@@ -0,0 +1,2 @@
+ALTER TABLE libraries ADD COLUMN original_file_handling text DEFAULT '';
+ALTER TABLE history ADD COLUMN original_path text DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE history ADD COLUMN original_restored boolean DEFAULT false;
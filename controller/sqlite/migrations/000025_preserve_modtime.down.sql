@@ -0,0 +1 @@
+ALTER TABLE libraries DROP COLUMN preserve_modtime;
@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN preserve_modtime boolean DEFAULT false;
@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN move_sidecars boolean DEFAULT false;
@@ -0,0 +1 @@
+ALTER TABLE libraries ADD COLUMN notifications binary DEFAULT '{}';
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS skipped_paths (
+    path text NOT NULL UNIQUE,
+    time_skipped timestamp
+);
@@ -0,0 +1,2 @@
+ALTER TABLE libraries DROP COLUMN metadata_read_args;
+ALTER TABLE libraries DROP COLUMN metadata_read_timeout;
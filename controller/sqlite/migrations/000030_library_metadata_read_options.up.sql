@@ -0,0 +1,2 @@
+ALTER TABLE libraries ADD COLUMN metadata_read_timeout text DEFAULT '0s';
+ALTER TABLE libraries ADD COLUMN metadata_read_args binary DEFAULT '[]';
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS benchmarks (
+    uuid text,
+    path text,
+    library_id integer,
+    runner text,
+    settings text,
+    command binary,
+    failed boolean DEFAULT false,
+    errors binary,
+    source_size integer,
+    time_completed timestamp,
+    elapsed text,
+    fps real,
+    projected_size integer
+);
+
+CREATE INDEX IF NOT EXISTS benchmarks_path ON benchmarks(path);
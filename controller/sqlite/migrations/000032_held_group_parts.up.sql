@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS held_group_parts (
+    uuid text NOT NULL UNIQUE,
+    group_key text,
+    completed_job binary,
+    output binary,
+    in_file text,
+    captions_file text,
+    dispatched_job binary
+);
@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// gzipMagic is the start of every gzip stream. A JSON document can never start with it,
+// so it tells compressed queues apart from the ones which were saved uncompressed.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// SetCompressQueues sets the function which returns whether or not library queues are gzip compressed when they are saved.
+// It is called for every save, so compression can be turned on and off while the Controller is running.
+func (d *Database) SetCompressQueues(compress func() bool) {
+	d.compressQueues = compress
+}
+
+// shouldCompressQueues returns whether or not library queues are compressed when they are saved.
+func (d *Database) shouldCompressQueues() bool {
+	return d.compressQueues != nil && d.compressQueues()
+}
+
+// encodeQueue returns queue as JSON, which is gzip compressed if compress is true.
+func encodeQueue(queue controller.LibraryQueue, compress bool) ([]byte, error) {
+	b, err := json.Marshal(queue)
+	if err != nil || !compress {
+		return b, err
+	}
+
+	var buf bytes.Buffer
+	// Queues are saved often, so writing them quickly matters more than the last few percent of size.
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeQueue parses a queue saved by encodeQueue, whether it was compressed or not.
+func decodeQueue(b []byte, queue *controller.LibraryQueue) error {
+	b, err := queueJSON(b)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, queue)
+}
+
+// queueJSON returns the JSON of a saved queue, decompressing it if it was compressed.
+func queueJSON(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, gzipMagic) {
+		return b, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
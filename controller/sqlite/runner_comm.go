@@ -1,9 +1,13 @@
 package sqlite
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"time"
 
 	"github.com/BrenekH/encodarr/controller"
+	"github.com/google/uuid"
 )
 
 // NewRunnerCommunicatorAdapter returns an instantiated RunnerCommunicatorAdapter.
@@ -19,19 +23,25 @@ type RunnerCommunicatorAdapter struct {
 }
 
 // DispatchedJob uses the provided uuid to retrieve a dispatched job from the database.
-func (r *RunnerCommunicatorAdapter) DispatchedJob(uuid controller.UUID) (controller.DispatchedJob, error) {
-	row := r.db.Client.QueryRow("SELECT job, status, runner, last_updated FROM dispatched_jobs WHERE uuid = $1;", uuid)
+func (r *RunnerCommunicatorAdapter) DispatchedJob(ctx context.Context, uuid controller.UUID) (controller.DispatchedJob, error) {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	row := r.db.Client.QueryRowContext(ctx, "SELECT job, status, runner, last_updated, lease_duration, lease_expires FROM dispatched_jobs WHERE uuid = $1;", uuid)
 
 	d := controller.DispatchedJob{UUID: uuid}
 	bJob := []byte{}
 	bStatus := []byte{}
+	var leaseDuration string
+	var leaseExpires int64
 
-	row.Scan(
-		&bJob,
-		&bStatus,
-		&d.Runner,
-		&d.LastUpdated,
-	)
+	if err := row.Scan(&bJob, &bStatus, &d.Runner, &d.LastUpdated, &leaseDuration, &leaseExpires); err != nil {
+		return d, err
+	}
+
+	if err := setLease(&d, leaseDuration, leaseExpires); err != nil {
+		return d, err
+	}
 
 	if err := json.Unmarshal(bJob, &d.Job); err != nil {
 		return d, err
@@ -44,8 +54,12 @@ func (r *RunnerCommunicatorAdapter) DispatchedJob(uuid controller.UUID) (control
 	return d, nil
 }
 
-// SaveDispatchedJob saves the provided dispatched job to the database.
-func (r *RunnerCommunicatorAdapter) SaveDispatchedJob(dJob controller.DispatchedJob) error {
+// SaveDispatchedJob saves the provided dispatched job to the database. The unique dispatched_jobs_path index rejects
+// the job if another one is already dispatched for its path.
+func (r *RunnerCommunicatorAdapter) SaveDispatchedJob(ctx context.Context, dJob controller.DispatchedJob) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
 	bJob, err := json.Marshal(dJob.Job)
 	if err != nil {
 		return err
@@ -56,12 +70,110 @@ func (r *RunnerCommunicatorAdapter) SaveDispatchedJob(dJob controller.Dispatched
 		return err
 	}
 
-	_, err = r.db.Client.Exec("INSERT INTO dispatched_jobs (uuid, job, status, runner, last_updated) VALUES ($1, $2, $3, $4, $5) ON CONFLICT(uuid) DO UPDATE SET uuid=$1, job=$2, status=$3, runner=$4, last_updated=$5;",
+	_, err = r.db.exec(ctx, "INSERT INTO dispatched_jobs (uuid, job, status, runner, last_updated, lease_duration, lease_expires) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT(uuid) DO UPDATE SET uuid=$1, job=$2, status=$3, runner=$4, last_updated=$5, lease_duration=$6, lease_expires=$7;",
 		dJob.UUID,
 		bJob,
 		bStatus,
 		dJob.Runner,
 		dJob.LastUpdated,
+		dJob.LeaseDuration.String(),
+		leaseExpiresColumn(dJob),
 	)
+	if err != nil && r.pathDispatchedByOther(ctx, dJob) {
+		return controller.ErrPathDispatched
+	}
 	return err
 }
+
+// pathDispatchedByOther returns whether a job with another UUID is dispatched for the path of dJob, which is what
+// makes the unique dispatched_jobs_path index reject the insert.
+func (r *RunnerCommunicatorAdapter) pathDispatchedByOther(ctx context.Context, dJob controller.DispatchedJob) bool {
+	var dispatched bool
+	err := r.db.Client.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM dispatched_jobs WHERE json_extract(CAST(job AS TEXT), '$.path') = $1 AND uuid != $2);", dJob.Job.Path, dJob.UUID).Scan(&dispatched)
+	return err == nil && dispatched
+}
+
+// UpdateDispatchedJob uses a SQL UPDATE statement to replace the stored dispatched job, and returns
+// sql.ErrNoRows if it doesn't exist.
+func (r *RunnerCommunicatorAdapter) UpdateDispatchedJob(ctx context.Context, dJob controller.DispatchedJob) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	bJob, err := json.Marshal(dJob.Job)
+	if err != nil {
+		return err
+	}
+
+	bStatus, err := json.Marshal(dJob.Status)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.exec(ctx, "UPDATE dispatched_jobs SET job=$2, status=$3, runner=$4, last_updated=$5, lease_duration=$6, lease_expires=$7 WHERE uuid = $1;",
+		dJob.UUID,
+		bJob,
+		bStatus,
+		dJob.Runner,
+		dJob.LastUpdated,
+		dJob.LeaseDuration.String(),
+		leaseExpiresColumn(dJob),
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RunnerSeen uses the UPSERT syntax to update the last seen time and version of the named Runner.
+func (r *RunnerCommunicatorAdapter) RunnerSeen(ctx context.Context, name, version string, t time.Time) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.db.exec(ctx, "INSERT INTO runners (uuid, name, display_name, version, last_seen) VALUES ($1, $2, $2, $3, $4) ON CONFLICT(name) DO UPDATE SET last_seen=$4, version=CASE WHEN $3 = '' THEN version ELSE $3 END;",
+		uuid.NewString(),
+		name,
+		version,
+		t.UTC(),
+	)
+	return err
+}
+
+// RecordRunnerResult increments either the jobs_completed or jobs_failed column of the named Runner.
+func (r *RunnerCommunicatorAdapter) RecordRunnerResult(ctx context.Context, name string, failed bool) error {
+	ctx, cancel := r.db.withTimeout(ctx)
+	defer cancel()
+
+	query := "UPDATE runners SET jobs_completed = jobs_completed + 1 WHERE name = $1;"
+	if failed {
+		query = "UPDATE runners SET jobs_failed = jobs_failed + 1 WHERE name = $1;"
+	}
+
+	_, err := r.db.exec(ctx, query, name)
+	return err
+}
+
+// setLease sets the lease of dJob from its stored columns. The expiry is stored as Unix nanoseconds so that RevokeLease
+// can compare it in SQL, with 0 meaning that the job was dispatched before leases were introduced.
+func setLease(dJob *controller.DispatchedJob, duration string, expires int64) (err error) {
+	if dJob.LeaseDuration, err = time.ParseDuration(duration); err != nil {
+		return err
+	}
+	if expires != 0 {
+		dJob.LeaseExpires = time.Unix(0, expires)
+	}
+	return nil
+}
+
+// leaseExpiresColumn returns the value of the lease_expires column for dJob.
+func leaseExpiresColumn(dJob controller.DispatchedJob) int64 {
+	if dJob.LeaseExpires.IsZero() {
+		return 0
+	}
+	return dJob.LeaseExpires.UnixNano()
+}
@@ -0,0 +1,34 @@
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE libraries (
+    ID integer PRIMARY KEY,
+    folder text,
+    priority integer,
+    fs_check_interval text,
+    pipeline binary,
+    queue binary,
+    file_cache binary,
+    path_masks binary
+);
+INSERT INTO libraries VALUES(1,'/media/tv',2,'15m0s','{"stages":[]}','{"Items":[{"uuid":"5d1c0f36-2b5e-4b1a-9d1e-6a2f3c4b5d6e","path":"/media/tv/a.mkv","command":["-c:v","libx265"],"metadata":{}}]}','{}','["sample"]');
+CREATE TABLE files (
+    path text UNIQUE,
+    modtime timestamp,
+    mediainfo binary
+);
+INSERT INTO files VALUES('/media/tv/a.mkv','2021-06-01 12:00:00+00:00','{}');
+CREATE TABLE history (
+    time_completed timestamp,
+    filename text,
+    warnings binary,
+    errors binary
+);
+INSERT INTO history VALUES('2021-06-02 08:30:00+00:00','/media/tv/b.mkv','[]','[]');
+CREATE TABLE dispatched_jobs (
+    uuid text NOT NULL UNIQUE,
+    job binary,
+    status binary,
+    runner text,
+    last_updated timestamp
+);
+COMMIT;
@@ -0,0 +1,62 @@
+PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE libraries (
+    ID integer PRIMARY KEY,
+    folder text,
+    priority integer,
+    fs_check_interval text,
+    queue binary,
+    path_masks binary
+, cmd_decider_settings text DEFAULT '', multi_part_patterns binary DEFAULT '[]', skip_unchanged boolean DEFAULT false);
+INSERT INTO libraries VALUES(1,'/media/tv',2,'15m0s','{"Items":[{"uuid":"5d1c0f36-2b5e-4b1a-9d1e-6a2f3c4b5d6e","path":"/media/tv/a.mkv","command":["-c:v","libx265"],"metadata":{}}]}','["sample"]','{"target_video_codec":"HEVC"}','["(?i)cd\\d+"]',1);
+CREATE TABLE files (
+    path text UNIQUE,
+    modtime timestamp, metadata binary);
+INSERT INTO files VALUES('/media/tv/a.mkv','2021-06-01 12:00:00+00:00','{}');
+CREATE TABLE history (
+    time_completed timestamp,
+    filename text,
+    warnings binary,
+    errors binary
+, uuid text, runner text, failed boolean DEFAULT false, job binary);
+INSERT INTO history VALUES('2021-06-02 08:30:00+00:00','/media/tv/b.mkv','[]','[]','b','Runner 1',0,'{}');
+CREATE TABLE dispatched_jobs (
+    uuid text NOT NULL UNIQUE,
+    job binary,
+    status binary,
+    runner text,
+    last_updated timestamp
+);
+CREATE TABLE runners (
+    uuid text NOT NULL UNIQUE,
+    name text NOT NULL UNIQUE,
+    display_name text,
+    version text,
+    last_seen timestamp,
+    jobs_completed integer DEFAULT 0,
+    jobs_failed integer DEFAULT 0
+);
+INSERT INTO runners VALUES('r1','runner-1','Runner 1','0.3.0','2021-06-02 08:30:00+00:00',4,1);
+CREATE TABLE job_attempts (
+    path text NOT NULL UNIQUE,
+    attempts integer DEFAULT 0
+);
+CREATE TABLE quarantined_jobs (
+    path text NOT NULL UNIQUE,
+    job binary,
+    attempts integer,
+    reason text,
+    time_quarantined timestamp
+);
+CREATE TABLE processed_files (
+    path text NOT NULL UNIQUE,
+    modtime timestamp
+);
+INSERT INTO processed_files VALUES('/media/tv/b.mkv','2021-06-01 12:00:00+00:00');
+CREATE TABLE schema_migrations (version uint64,dirty bool);
+INSERT INTO schema_migrations VALUES(8,0);
+CREATE INDEX history_filename ON history(filename);
+CREATE INDEX dispatched_jobs_path ON dispatched_jobs(json_extract(CAST(job AS TEXT), '$.path'));
+CREATE INDEX history_uuid ON history(uuid);
+CREATE UNIQUE INDEX version_unique ON schema_migrations (version);
+COMMIT;
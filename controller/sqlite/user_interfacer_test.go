@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func TestToLikePattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		expected string
+	}{
+		{name: "Substring", in: "S01E02", expected: "%S01E02%"},
+		{name: "Glob", in: "*S01E0?.mkv", expected: "%S01E0_.mkv"},
+		{name: "Escape LIKE wildcards in substring", in: "100%_done", expected: `%100\%\_done%`},
+		{name: "Escape LIKE wildcards in glob", in: "*100%*", expected: `%100\%%`},
+		{name: "Escape backslash", in: `C:\Movies`, expected: `%C:\\Movies%`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := toLikePattern(test.in)
+			if out != test.expected {
+				t.Errorf("expected %v but got %v", test.expected, out)
+			}
+		})
+	}
+}
+
+func TestBackup(t *testing.T) {
+	db, err := NewDatabase(t.TempDir(), &mockLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Client.Close()
+
+	lm := NewLibraryManagerAdapter(&db, &mockLogger{})
+	if err = lm.SaveLibrary(context.Background(), controller.Library{ID: 1, Folder: "/media/tv"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	ui := NewUserInterfacerAdapter(&db, &mockLogger{})
+	if err = ui.Backup(&b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The snapshot is a database of its own, so restoring it is just a matter of using it as data.db.
+	restoreDir := t.TempDir()
+	if err = os.WriteFile(restoreDir+"/data.db", b.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = integrityCheck(restoreDir + "/data.db"); err != nil {
+		t.Errorf("unexpected integrity check error: %v", err)
+	}
+
+	restored, err := NewDatabase(restoreDir, &mockLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Client.Close()
+
+	restoredLM := NewLibraryManagerAdapter(&restored, &mockLogger{})
+	if lib, err := restoredLM.Library(context.Background(), 1); err != nil || lib.Folder != "/media/tv" {
+		t.Errorf("expected the library to be in the backup but got %+v, %v", lib, err)
+	}
+}
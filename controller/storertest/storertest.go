@@ -0,0 +1,1892 @@
+// Package storertest implements a contract test suite for the data storer interfaces defined in the controller package.
+// Every data storer implementation should pass it so that the backends don't drift apart.
+package storertest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// Storers groups the data storers of a single backend. All of them must share the same underlying storage.
+type Storers struct {
+	HealthChecker      controller.HealthCheckerDataStorer
+	LibraryManager     controller.LibraryManagerDataStorer
+	RunnerCommunicator controller.RunnerCommunicatorDataStorer
+	FileCache          controller.FileCacheDataStorer
+	JobEvents          controller.JobEventDataStorer
+	UserInterfacer     controller.UserInterfacerDataStorer
+}
+
+// Run runs the contract test suite. newStorers is called at the start of every subtest and must return storers
+// that are backed by empty storage.
+func Run(t *testing.T, newStorers func(t *testing.T) Storers) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Storers)
+	}{
+		{"LibraryRoundTrip", testLibraryRoundTrip},
+		{"LibraryNotFound", testLibraryNotFound},
+		{"SaveLibraryUpdates", testSaveLibraryUpdates},
+		{"ConcurrentSaveLibrary", testConcurrentSaveLibrary},
+		{"SaveLibraryConflict", testSaveLibraryConflict},
+		{"ConcurrentLibraryModifications", testConcurrentLibraryModifications},
+		{"LibraryIsolation", testLibraryIsolation},
+		{"AppendJobs", testAppendJobs},
+		{"ConcurrentAppendJobs", testConcurrentAppendJobs},
+		{"DeleteLibrary", testDeleteLibrary},
+		{"RestoreLibrary", testRestoreLibrary},
+		{"PurgeDeletedLibraries", testPurgeDeletedLibraries},
+		{"PurgeDeletedLibrary", testPurgeDeletedLibrary},
+		{"ImportLibrariesKeepsQueue", testImportLibrariesKeepsQueue},
+		{"DispatchedPathLifecycle", testDispatchedPathLifecycle},
+		{"DispatchedPathUnique", testDispatchedPathUnique},
+		{"DispatchedJobNotFound", testDispatchedJobNotFound},
+		{"DispatchedJobCount", testDispatchedJobCount},
+		{"UpdateDispatchedJob", testUpdateDispatchedJob},
+		{"RevokeLease", testRevokeLease},
+		{"LibraryManagerRevokeLease", testLibraryManagerRevokeLease},
+		{"HealthCheckActions", testHealthCheckActions},
+		{"StaleJobSettings", testStaleJobSettings},
+		{"JobEvents", testJobEvents},
+		{"History", testHistory},
+		{"RestoredOriginals", testRestoredOriginals},
+		{"JobAttempts", testJobAttempts},
+		{"Quarantine", testQuarantine},
+		{"ReleaseExpiredQuarantines", testReleaseExpiredQuarantines},
+		{"SkippedPaths", testSkippedPaths},
+		{"BenchmarkResults", testBenchmarkResults},
+		{"HeldGroupParts", testHeldGroupParts},
+		{"ImportFileStates", testImportFileStates},
+		{"LastProcessedModtime", testLastProcessedModtime},
+		{"DeleteProcessedModtimes", testDeleteProcessedModtimes},
+		{"CanonicalizePaths", testCanonicalizePaths},
+		{"Runners", testRunners},
+		{"FileCache", testFileCache},
+		{"SearchFiles", testSearchFiles},
+		{"FileSnapshots", testFileSnapshots},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newStorers(t))
+		})
+	}
+}
+
+// timestamp returns a time that every backend can store without losing precision.
+func timestamp(minutes int) time.Time {
+	return time.Date(2021, time.August, 1, 12, minutes, 0, 0, time.UTC)
+}
+
+func testLibrary(id int) controller.Library {
+	return controller.Library{
+		ID:                      id,
+		Folder:                  fmt.Sprintf("/media/library%v", id),
+		Priority:                id,
+		FsCheckInterval:         15 * time.Minute,
+		Queue:                   controller.LibraryQueue{Items: []controller.Job{testJob("q", id, fmt.Sprintf("/media/library%v/queued.mkv", id))}},
+		PathMasks:               []string{"Extras"},
+		MultiPartPatterns:       []string{`(?i)cd(\d+)`},
+		SkipUnchanged:           true,
+		VerificationCommand:     []string{"/usr/local/bin/verify.sh", "--min-vmaf", "93"},
+		ScanOnStartup:           true,
+		QueueOrder:              controller.QueueNewestFirst,
+		StaleJobTimeout:         30 * time.Hour,
+		StaleJobAction:          controller.StaleJobNotify,
+		MetadataReadConcurrency: 8,
+		MaxQueuedBytes:          50 << 30,
+		OriginalFileHandling:    controller.OriginalKeepRenamed,
+		PreserveModtime:         true,
+		MoveSidecars:            true,
+		Notifications: controller.LibraryNotifications{
+			Webhooks:      []controller.LibraryWebhook{{Type: controller.NotificationDiscord, URL: "https://discord.com/api/webhooks/1/abc", Events: []controller.EventType{controller.EventJobFailed}, Template: "{{.Path}} failed"}},
+			ReplaceGlobal: true,
+		},
+		MetadataReadTimeout:    5 * time.Minute,
+		MetadataReadArgs:       []string{"--ParseSpeed=1"},
+		CommandDeciderSettings: `{"target_video_codec":"HEVC"}`,
+	}
+}
+
+func testJob(uuid controller.UUID, libraryID int, path string) controller.Job {
+	return controller.Job{
+		UUID:      uuid,
+		LibraryID: libraryID,
+		Path:      path,
+		Command:   []string{"-i", "ENCODARR_INPUT_FILE", "ENCODARR_OUTPUT_FILE"},
+		Metadata:  controller.FileMetadata{VideoTracks: []controller.VideoTrack{{Codec: "AVC", Width: 1920, Height: 1080}}},
+
+		Annotations: map[string]string{"source": "sonarr", "request_id": string(uuid)},
+	}
+}
+
+func testDispatchedJob(uuid controller.UUID, libraryID int, path string) controller.DispatchedJob {
+	return controller.DispatchedJob{
+		UUID:          uuid,
+		Runner:        "runner",
+		Job:           testJob(uuid, libraryID, path),
+		Status:        controller.JobStatus{Stage: "Running FFmpeg", Percentage: "50"},
+		LastUpdated:   timestamp(0),
+		LeaseDuration: time.Hour,
+		LeaseExpires:  timestamp(60),
+	}
+}
+
+func testLibraryRoundTrip(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	want := testLibrary(1)
+	if err := s.LibraryManager.SaveLibrary(ctx, want); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+	want.Version = 1
+
+	got, err := s.LibraryManager.Library(ctx, 1)
+	if err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+
+	libs, err := s.LibraryManager.Libraries(ctx)
+	if err != nil {
+		t.Fatalf("Libraries: %v", err)
+	}
+	if len(libs) != 1 || !reflect.DeepEqual(libs[0], want) {
+		t.Errorf("expected [%+v] but got %+v", want, libs)
+	}
+}
+
+func testLibraryNotFound(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if _, err := s.LibraryManager.Library(ctx, 1); err == nil {
+		t.Errorf("expected an error for an unknown library")
+	}
+
+	libs, err := s.LibraryManager.Libraries(ctx)
+	if err != nil {
+		t.Fatalf("Libraries: %v", err)
+	}
+	if libs == nil || len(libs) != 0 {
+		t.Errorf("expected an empty, non-nil slice but got %#v", libs)
+	}
+}
+
+func testSaveLibraryUpdates(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if err := s.LibraryManager.SaveLibrary(ctx, testLibrary(1)); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	lib, err := s.LibraryManager.Library(ctx, 1)
+	if err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	lib.Folder = "/media/moved"
+	lib.Queue = controller.LibraryQueue{}
+	lib.PathMasks = []string{}
+	if err := s.LibraryManager.SaveLibrary(ctx, lib); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	got, err := s.LibraryManager.Library(ctx, 1)
+	if err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	if got.Folder != "/media/moved" {
+		t.Errorf("expected folder to be updated but got %v", got.Folder)
+	}
+	if len(got.Queue.Items) != 0 {
+		t.Errorf("expected SaveLibrary to replace the queue but got %v", got.Queue.Items)
+	}
+	if len(got.PathMasks) != 0 {
+		t.Errorf("expected SaveLibrary to replace the path masks but got %v", got.PathMasks)
+	}
+	if got.Version != 2 {
+		t.Errorf("expected the version to be incremented to 2 but got %v", got.Version)
+	}
+}
+
+// Library scans save their libraries from separate goroutines, so concurrent saves must not fail or be lost.
+func testConcurrentSaveLibrary(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n*2)
+
+	for i := 1; i <= n; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			// Save twice so that both the insert and update paths run concurrently.
+			lib := testLibrary(id)
+			for j := 0; j < 2; j++ {
+				if err := s.LibraryManager.SaveLibrary(ctx, lib); err != nil {
+					errs <- err
+				}
+				lib.Version++
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("SaveLibrary: %v", err)
+	}
+
+	libs, err := s.LibraryManager.Libraries(ctx)
+	if err != nil {
+		t.Fatalf("Libraries: %v", err)
+	}
+	if len(libs) != n {
+		t.Errorf("expected %v libraries but got %v", n, len(libs))
+	}
+}
+
+// A save based on an outdated read must be rejected instead of overwriting the newer library.
+func testSaveLibraryConflict(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if err := s.LibraryManager.SaveLibrary(ctx, testLibrary(1)); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	first, err := s.LibraryManager.Library(ctx, 1)
+	if err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	second := first
+
+	first.PathMasks = []string{"Samples"}
+	if err = s.LibraryManager.SaveLibrary(ctx, first); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	second.Queue = controller.LibraryQueue{}
+	if err = s.LibraryManager.SaveLibrary(ctx, second); !errors.Is(err, controller.ErrLibraryConflict) {
+		t.Errorf("expected saving an outdated library to return ErrLibraryConflict but got %v", err)
+	}
+
+	if err = s.LibraryManager.SaveLibrary(ctx, testLibrary(1)); !errors.Is(err, controller.ErrLibraryConflict) {
+		t.Errorf("expected creating an existing library to return ErrLibraryConflict but got %v", err)
+	}
+
+	got, err := s.LibraryManager.Library(ctx, 1)
+	if err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	if !reflect.DeepEqual(got.PathMasks, first.PathMasks) || !reflect.DeepEqual(got.Queue, first.Queue) {
+		t.Errorf("expected the first save to be kept but got %+v", got)
+	}
+
+	// A deleted library must not be brought back by a save that was based on it
+	if err = s.UserInterfacer.DeleteLibrary(ctx, 1, timestamp(0)); err != nil {
+		t.Fatalf("DeleteLibrary: %v", err)
+	}
+	if err = s.LibraryManager.SaveLibrary(ctx, got); !errors.Is(err, controller.ErrLibraryConflict) {
+		t.Errorf("expected saving a deleted library to return ErrLibraryConflict but got %v", err)
+	}
+}
+
+// Concurrent read-modify-write cycles which retry on conflicts must not lose any of the modifications.
+func testConcurrentLibraryModifications(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if err := s.LibraryManager.SaveLibrary(ctx, controller.Library{ID: 1}); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				lib, err := s.LibraryManager.Library(ctx, 1)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				lib.Queue.Push(testJob(controller.UUID(fmt.Sprint(i)), 1, fmt.Sprintf("/media/%v.mkv", i)))
+				err = s.LibraryManager.SaveLibrary(ctx, lib)
+				if !errors.Is(err, controller.ErrLibraryConflict) {
+					if err != nil {
+						errs <- err
+					}
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	got, err := s.LibraryManager.Library(ctx, 1)
+	if err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	if len(got.Queue.Items) != n {
+		t.Errorf("expected %v queued jobs but got %v", n, len(got.Queue.Items))
+	}
+	if got.Version != n+1 {
+		t.Errorf("expected version %v but got %v", n+1, got.Version)
+	}
+}
+
+func testAppendJobs(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	lib := testLibrary(1)
+	if err := s.LibraryManager.SaveLibrary(ctx, lib); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	jobs := []controller.Job{
+		testJob("a", 1, "/media/library1/a.mkv"),
+		lib.Queue.Items[0],
+		testJob("b", 1, "/media/library1/b.mkv"),
+		testJob("a2", 1, "/media/library1/a.mkv"),
+	}
+	appended, err := s.LibraryManager.AppendJobs(ctx, 1, jobs)
+	if err != nil {
+		t.Fatalf("AppendJobs: %v", err)
+	}
+	if want := []controller.Job{jobs[0], jobs[2]}; !reflect.DeepEqual(appended, want) {
+		t.Errorf("expected the jobs which weren't queued to be appended but got %+v", appended)
+	}
+	jobs[0].Command[0] = "mutated"
+
+	got, err := s.LibraryManager.Library(ctx, 1)
+	if err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	want := []controller.Job{lib.Queue.Items[0], testJob("a", 1, "/media/library1/a.mkv"), jobs[2]}
+	if !reflect.DeepEqual(got.Queue.Items, want) {
+		t.Errorf("expected queue %+v but got %+v", want, got.Queue.Items)
+	}
+	if got.Version != 2 {
+		t.Errorf("expected appending to bump the version to 2 but got %v", got.Version)
+	}
+
+	// Nothing is written when every job is already queued
+	if appended, err = s.LibraryManager.AppendJobs(ctx, 1, jobs); err != nil || len(appended) != 0 {
+		t.Errorf("expected no jobs to be appended but got %+v, %v", appended, err)
+	}
+	if got, _ = s.LibraryManager.Library(ctx, 1); got.Version != 2 {
+		t.Errorf("expected the version to stay at 2 but got %v", got.Version)
+	}
+
+	if _, err = s.LibraryManager.AppendJobs(ctx, 2, jobs); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for an unknown library but got %v", err)
+	}
+	if err = s.UserInterfacer.DeleteLibrary(ctx, 1, timestamp(0)); err != nil {
+		t.Fatalf("DeleteLibrary: %v", err)
+	}
+	if _, err = s.LibraryManager.AppendJobs(ctx, 1, []controller.Job{testJob("c", 1, "/media/library1/c.mkv")}); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows for a deleted library but got %v", err)
+	}
+}
+
+// Concurrent appends must not lose any of the jobs.
+func testConcurrentAppendJobs(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if err := s.LibraryManager.SaveLibrary(ctx, controller.Library{ID: 1}); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			jobs := []controller.Job{
+				testJob(controller.UUID(fmt.Sprintf("%v-a", i)), 1, fmt.Sprintf("/media/%v-a.mkv", i)),
+				testJob(controller.UUID(fmt.Sprintf("%v-b", i)), 1, fmt.Sprintf("/media/%v-b.mkv", i)),
+			}
+			if _, err := s.LibraryManager.AppendJobs(ctx, 1, jobs); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	got, err := s.LibraryManager.Library(ctx, 1)
+	if err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	if len(got.Queue.Items) != 2*n {
+		t.Errorf("expected %v queued jobs but got %v", 2*n, len(got.Queue.Items))
+	}
+}
+
+// Callers must not be able to change the stored state by mutating the values that they saved or received.
+func testLibraryIsolation(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	lib := testLibrary(1)
+	if err := s.LibraryManager.SaveLibrary(ctx, lib); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+	lib.PathMasks[0] = "mutated"
+	lib.Queue.Items[0].Command[0] = "mutated"
+
+	got, err := s.LibraryManager.Library(ctx, 1)
+	if err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	got.PathMasks[0] = "mutated"
+	got.Queue.Items[0].Metadata.VideoTracks[0].Codec = "mutated"
+
+	if got, err = s.LibraryManager.Library(ctx, 1); err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	want := testLibrary(1)
+	want.Version = 1
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the stored library to be unchanged but got %+v", got)
+	}
+}
+
+func testDeleteLibrary(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	for _, id := range []int{1, 2} {
+		if err := s.LibraryManager.SaveLibrary(ctx, testLibrary(id)); err != nil {
+			t.Fatalf("SaveLibrary: %v", err)
+		}
+	}
+
+	if err := s.UserInterfacer.DeleteLibrary(ctx, 1, timestamp(0)); err != nil {
+		t.Fatalf("DeleteLibrary: %v", err)
+	}
+
+	if _, err := s.LibraryManager.Library(ctx, 1); err == nil {
+		t.Errorf("expected library to be deleted")
+	}
+
+	libs, err := s.LibraryManager.Libraries(ctx)
+	if err != nil {
+		t.Fatalf("Libraries: %v", err)
+	}
+	if len(libs) != 1 || libs[0].ID != 2 {
+		t.Errorf("expected only library 2 to be listed but got %+v", libs)
+	}
+
+	if results, _, err := s.UserInterfacer.SearchFiles(ctx, "queued", 10); err != nil {
+		t.Fatalf("SearchFiles: %v", err)
+	} else if len(results) != 1 || results[0].LibraryID != 2 {
+		t.Errorf("expected only the queue of library 2 to be searched but got %+v", results)
+	}
+
+	deleted, err := s.UserInterfacer.DeletedLibraries(ctx)
+	if err != nil {
+		t.Fatalf("DeletedLibraries: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != 1 || !deleted[0].DeletedAt.Equal(timestamp(0)) {
+		t.Errorf("expected library 1 to be deleted at %v but got %+v", timestamp(0), deleted)
+	}
+
+	// Deleting a library again doesn't move its deletion time
+	if err = s.UserInterfacer.DeleteLibrary(ctx, 1, timestamp(5)); err != nil {
+		t.Fatalf("DeleteLibrary: %v", err)
+	}
+	if deleted, err = s.UserInterfacer.DeletedLibraries(ctx); err != nil {
+		t.Fatalf("DeletedLibraries: %v", err)
+	} else if len(deleted) != 1 || !deleted[0].DeletedAt.Equal(timestamp(0)) {
+		t.Errorf("expected the deletion time to stay at %v but got %+v", timestamp(0), deleted)
+	}
+}
+
+func testRestoreLibrary(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	lib := testLibrary(1)
+	if err := s.LibraryManager.SaveLibrary(ctx, lib); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	if err := s.UserInterfacer.RestoreLibrary(ctx, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows when restoring a library which isn't deleted but got %v", err)
+	}
+
+	if err := s.UserInterfacer.DeleteLibrary(ctx, 1, timestamp(0)); err != nil {
+		t.Fatalf("DeleteLibrary: %v", err)
+	}
+	if err := s.UserInterfacer.RestoreLibrary(ctx, 1); err != nil {
+		t.Fatalf("RestoreLibrary: %v", err)
+	}
+
+	got, err := s.LibraryManager.Library(ctx, 1)
+	if err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	if !got.DeletedAt.IsZero() || !reflect.DeepEqual(got.Queue, lib.Queue) || got.Folder != lib.Folder {
+		t.Errorf("expected the library to be restored with its queue but got %+v", got)
+	}
+
+	if deleted, err := s.UserInterfacer.DeletedLibraries(ctx); err != nil {
+		t.Fatalf("DeletedLibraries: %v", err)
+	} else if len(deleted) != 0 {
+		t.Errorf("expected no deleted libraries but got %+v", deleted)
+	}
+
+	// Importing a deleted library restores it
+	if err = s.UserInterfacer.DeleteLibrary(ctx, 1, timestamp(0)); err != nil {
+		t.Fatalf("DeleteLibrary: %v", err)
+	}
+	if err = s.UserInterfacer.ImportLibraries(ctx, []controller.Library{testLibrary(1)}); err != nil {
+		t.Fatalf("ImportLibraries: %v", err)
+	}
+	if _, err = s.LibraryManager.Library(ctx, 1); err != nil {
+		t.Errorf("expected ImportLibraries to restore the library: %v", err)
+	}
+}
+
+func testPurgeDeletedLibraries(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	for _, id := range []int{1, 2, 3} {
+		if err := s.LibraryManager.SaveLibrary(ctx, testLibrary(id)); err != nil {
+			t.Fatalf("SaveLibrary: %v", err)
+		}
+		if err := s.LibraryManager.PushHistory(ctx, controller.History{
+			Filename:          fmt.Sprintf("/media/library%v/done.mkv", id),
+			DateTimeCompleted: timestamp(0),
+			Warnings:          []string{},
+			Errors:            []string{},
+			UUID:              controller.UUID(fmt.Sprint(id)),
+			Job:               testJob(controller.UUID(fmt.Sprint(id)), id, fmt.Sprintf("/media/library%v/done.mkv", id)),
+		}); err != nil {
+			t.Fatalf("PushHistory: %v", err)
+		}
+		q := controller.QuarantinedJob{Job: testJob("q", id, fmt.Sprintf("/media/library%v/broken.mkv", id)), Attempts: 3, DateTimeQuarantined: timestamp(0)}
+		if err := s.LibraryManager.QuarantineJob(ctx, q); err != nil {
+			t.Fatalf("QuarantineJob: %v", err)
+		}
+	}
+
+	// Library 1 is past the retention period and library 2 isn't. Library 3 isn't deleted.
+	if err := s.UserInterfacer.DeleteLibrary(ctx, 1, timestamp(0)); err != nil {
+		t.Fatalf("DeleteLibrary: %v", err)
+	}
+	if err := s.UserInterfacer.DeleteLibrary(ctx, 2, timestamp(10)); err != nil {
+		t.Fatalf("DeleteLibrary: %v", err)
+	}
+
+	purged, err := s.LibraryManager.PurgeDeletedLibraries(ctx, timestamp(5))
+	if err != nil {
+		t.Fatalf("PurgeDeletedLibraries: %v", err)
+	}
+	if len(purged) != 1 || purged[0].ID != 1 || purged[0].Folder != testLibrary(1).Folder {
+		t.Errorf("expected library 1 to be purged but got %+v", purged)
+	}
+
+	deleted, err := s.UserInterfacer.DeletedLibraries(ctx)
+	if err != nil {
+		t.Fatalf("DeletedLibraries: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != 2 {
+		t.Errorf("expected library 2 to still be restorable but got %+v", deleted)
+	}
+	if err = s.UserInterfacer.RestoreLibrary(ctx, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows when restoring a purged library but got %v", err)
+	}
+
+	for id, quarantined := range map[int]bool{1: false, 2: true, 3: true} {
+		if got, err := s.LibraryManager.IsPathQuarantined(ctx, fmt.Sprintf("/media/library%v/broken.mkv", id)); err != nil {
+			t.Fatalf("IsPathQuarantined: %v", err)
+		} else if got != quarantined {
+			t.Errorf("expected the quarantined job of library %v to be kept to be %v", id, quarantined)
+		}
+	}
+
+	for id, folder := range map[int]string{1: testLibrary(1).Folder, 2: "", 3: ""} {
+		h, err := s.UserInterfacer.HistoryEntry(ctx, controller.UUID(fmt.Sprint(id)))
+		if err != nil {
+			t.Fatalf("expected the history of library %v to be kept: %v", id, err)
+		}
+		if h.LibraryFolder != folder || h.Job.LibraryID != id {
+			t.Errorf("expected the history of library %v to have library folder %q but got %+v", id, folder, h)
+		}
+	}
+}
+
+// testPurgeDeletedLibrary makes sure that a single deleted library can be purged right away through the library
+// manager, which deletes and restores libraries the same way as the user interfacer.
+func testPurgeDeletedLibrary(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	for _, id := range []int{1, 2} {
+		if err := s.LibraryManager.SaveLibrary(ctx, testLibrary(id)); err != nil {
+			t.Fatalf("SaveLibrary: %v", err)
+		}
+		if err := s.LibraryManager.DeleteLibrary(ctx, id, timestamp(10)); err != nil {
+			t.Fatalf("DeleteLibrary: %v", err)
+		}
+	}
+	if _, err := s.LibraryManager.Library(ctx, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows reading a deleted library but got %v", err)
+	}
+
+	lib, err := s.LibraryManager.PurgeDeletedLibrary(ctx, 1)
+	if err != nil {
+		t.Fatalf("PurgeDeletedLibrary: %v", err)
+	}
+	if lib.ID != 1 || lib.Folder != testLibrary(1).Folder {
+		t.Errorf("expected library 1 to be purged but got %+v", lib)
+	}
+	if _, err = s.LibraryManager.PurgeDeletedLibrary(ctx, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows purging a library twice but got %v", err)
+	}
+	if err = s.LibraryManager.RestoreLibrary(ctx, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows restoring a purged library but got %v", err)
+	}
+
+	// Library 2 was deleted at the same time but is left alone.
+	if err = s.LibraryManager.RestoreLibrary(ctx, 2); err != nil {
+		t.Fatalf("RestoreLibrary: %v", err)
+	}
+	if _, err = s.LibraryManager.Library(ctx, 2); err != nil {
+		t.Errorf("expected library 2 to be restored but got %v", err)
+	}
+
+	// A library which isn't deleted can't be purged.
+	if _, err = s.LibraryManager.PurgeDeletedLibrary(ctx, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows purging a library which isn't deleted but got %v", err)
+	}
+}
+
+func testImportLibrariesKeepsQueue(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	existing := testLibrary(1)
+	if err := s.LibraryManager.SaveLibrary(ctx, existing); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	imported := testLibrary(1)
+	imported.Folder = "/media/imported"
+	imported.Queue = controller.LibraryQueue{}
+	newLib := testLibrary(2)
+
+	if err := s.UserInterfacer.ImportLibraries(ctx, []controller.Library{imported, newLib}); err != nil {
+		t.Fatalf("ImportLibraries: %v", err)
+	}
+
+	got, err := s.LibraryManager.Library(ctx, 1)
+	if err != nil {
+		t.Fatalf("Library: %v", err)
+	}
+	if got.Folder != "/media/imported" {
+		t.Errorf("expected folder to be imported but got %v", got.Folder)
+	}
+	if !reflect.DeepEqual(got.Queue, existing.Queue) {
+		t.Errorf("expected ImportLibraries to keep the existing queue %v but got %v", existing.Queue, got.Queue)
+	}
+
+	if got.Version != 2 {
+		t.Errorf("expected ImportLibraries to increment the version to 2 but got %v", got.Version)
+	}
+
+	newLib.Version = 1
+	if got, err = s.LibraryManager.Library(ctx, 2); err != nil {
+		t.Errorf("expected new library to be created: %v", err)
+	} else if !reflect.DeepEqual(got, newLib) {
+		t.Errorf("expected %+v but got %+v", newLib, got)
+	}
+}
+
+func testDispatchedPathLifecycle(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	path := "/media/Show/S01E01.mkv"
+	isDispatched := func(p string) bool {
+		t.Helper()
+		dispatched, err := s.LibraryManager.IsPathDispatched(ctx, p)
+		if err != nil {
+			t.Fatalf("IsPathDispatched: %v", err)
+		}
+		return dispatched
+	}
+
+	if isDispatched(path) {
+		t.Errorf("expected path to not be dispatched before SaveDispatchedJob")
+	}
+	if dispatched, err := s.LibraryManager.IsJobDispatched(ctx, "a"); err != nil || dispatched {
+		t.Errorf("expected job to not be dispatched before SaveDispatchedJob but got %v, %v", dispatched, err)
+	}
+
+	dJob := testDispatchedJob("a", 1, path)
+	if err := s.RunnerCommunicator.SaveDispatchedJob(ctx, dJob); err != nil {
+		t.Fatalf("SaveDispatchedJob: %v", err)
+	}
+
+	if !isDispatched(path) {
+		t.Errorf("expected path to be dispatched after SaveDispatchedJob")
+	}
+	if dispatched, err := s.LibraryManager.IsJobDispatched(ctx, "a"); err != nil || !dispatched {
+		t.Errorf("expected job to be dispatched after SaveDispatchedJob but got %v, %v", dispatched, err)
+	}
+	if isDispatched(strings.ToLower(path)) {
+		t.Errorf("expected IsPathDispatched to be case-sensitive")
+	}
+
+	got, err := s.RunnerCommunicator.DispatchedJob(ctx, "a")
+	if err != nil {
+		t.Fatalf("DispatchedJob: %v", err)
+	}
+	if !reflect.DeepEqual(got.Job, dJob.Job) || got.Status != dJob.Status || got.Runner != dJob.Runner || !got.LastUpdated.Equal(dJob.LastUpdated) {
+		t.Errorf("expected %+v but got %+v", dJob, got)
+	}
+	if got.LeaseDuration != dJob.LeaseDuration || !got.LeaseExpires.Equal(dJob.LeaseExpires) {
+		t.Errorf("expected a lease of %v expiring at %v but got %v expiring at %v", dJob.LeaseDuration, dJob.LeaseExpires, got.LeaseDuration, got.LeaseExpires)
+	}
+
+	// Status updates replace the stored job.
+	dJob.Status.Percentage = "75"
+	dJob.LastUpdated = timestamp(1)
+	if err = s.RunnerCommunicator.SaveDispatchedJob(ctx, dJob); err != nil {
+		t.Fatalf("SaveDispatchedJob: %v", err)
+	}
+
+	dJobs, err := s.UserInterfacer.DispatchedJobs(ctx)
+	if err != nil {
+		t.Fatalf("DispatchedJobs: %v", err)
+	}
+	if len(dJobs) != 1 || dJobs[0].Status.Percentage != "75" || !dJobs[0].LastUpdated.Equal(timestamp(1)) {
+		t.Errorf("expected a single updated dispatched job but got %+v", dJobs)
+	}
+
+	popped, err := s.LibraryManager.PopDispatchedJob(ctx, "a")
+	if err != nil {
+		t.Fatalf("PopDispatchedJob: %v", err)
+	}
+	if popped.UUID != "a" || popped.Job.Path != path || popped.Status.Percentage != "75" {
+		t.Errorf("expected the dispatched job to be popped but got %+v", popped)
+	}
+
+	if isDispatched(path) {
+		t.Errorf("expected path to not be dispatched after PopDispatchedJob")
+	}
+	if _, err = s.LibraryManager.PopDispatchedJob(ctx, "a"); err == nil {
+		t.Errorf("expected an error when popping a job twice")
+	}
+}
+
+func testDispatchedPathUnique(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	path := "/media/Show/S01E01.mkv"
+	if err := s.RunnerCommunicator.SaveDispatchedJob(ctx, testDispatchedJob("a", 1, path)); err != nil {
+		t.Fatalf("SaveDispatchedJob: %v", err)
+	}
+
+	if err := s.RunnerCommunicator.SaveDispatchedJob(ctx, testDispatchedJob("b", 1, path)); !errors.Is(err, controller.ErrPathDispatched) {
+		t.Errorf("expected ErrPathDispatched when dispatching a second job for the same path but got %v", err)
+	}
+	if dispatched, err := s.LibraryManager.IsJobDispatched(ctx, "b"); err != nil || dispatched {
+		t.Errorf("expected the second job to not be dispatched but got %v, %v", dispatched, err)
+	}
+
+	// Updates to the job which holds the path are still allowed.
+	if err := s.RunnerCommunicator.SaveDispatchedJob(ctx, testDispatchedJob("a", 1, path)); err != nil {
+		t.Errorf("expected the dispatched job to be updatable but got %v", err)
+	}
+
+	if _, err := s.LibraryManager.PopDispatchedJob(ctx, "a"); err != nil {
+		t.Fatalf("PopDispatchedJob: %v", err)
+	}
+	if err := s.RunnerCommunicator.SaveDispatchedJob(ctx, testDispatchedJob("b", 1, path)); err != nil {
+		t.Errorf("expected the path to be dispatchable again after the first job was popped but got %v", err)
+	}
+}
+
+func testDispatchedJobNotFound(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if _, err := s.RunnerCommunicator.DispatchedJob(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown dispatched job but got %v", err)
+	}
+}
+
+func testDispatchedJobCount(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	for i, libraryID := range []int{1, 1, 2} {
+		uuid := controller.UUID(fmt.Sprint(i))
+		if err := s.RunnerCommunicator.SaveDispatchedJob(ctx, testDispatchedJob(uuid, libraryID, fmt.Sprintf("/media/%v.mkv", i))); err != nil {
+			t.Fatalf("SaveDispatchedJob: %v", err)
+		}
+	}
+
+	for libraryID, expected := range map[int]int{1: 2, 2: 1, 3: 0} {
+		count, err := s.LibraryManager.DispatchedJobCount(ctx, libraryID)
+		if err != nil {
+			t.Fatalf("DispatchedJobCount: %v", err)
+		}
+		if count != expected {
+			t.Errorf("expected %v dispatched jobs for library %v but got %v", expected, libraryID, count)
+		}
+	}
+}
+
+func testUpdateDispatchedJob(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	dJob := testDispatchedJob("a", 1, "/media/a.mkv")
+	if err := s.RunnerCommunicator.UpdateDispatchedJob(ctx, dJob); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows when updating a job which isn't dispatched but got %v", err)
+	}
+	if dJobs := s.HealthChecker.DispatchedJobs(ctx); len(dJobs) != 0 {
+		t.Errorf("expected UpdateDispatchedJob to not create the job but got %+v", dJobs)
+	}
+
+	if err := s.RunnerCommunicator.SaveDispatchedJob(ctx, dJob); err != nil {
+		t.Fatalf("SaveDispatchedJob: %v", err)
+	}
+
+	dJob.Status.Percentage = "75"
+	dJob = dJob.RenewLease(timestamp(30))
+	if err := s.RunnerCommunicator.UpdateDispatchedJob(ctx, dJob); err != nil {
+		t.Fatalf("UpdateDispatchedJob: %v", err)
+	}
+
+	got, err := s.RunnerCommunicator.DispatchedJob(ctx, "a")
+	if err != nil {
+		t.Fatalf("DispatchedJob: %v", err)
+	}
+	if got.Status.Percentage != "75" || !got.LeaseExpires.Equal(timestamp(90)) {
+		t.Errorf("expected the status and lease to be updated but got %+v", got)
+	}
+}
+
+func testRevokeLease(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if err := s.RunnerCommunicator.SaveDispatchedJob(ctx, testDispatchedJob("a", 1, "/media/a.mkv")); err != nil {
+		t.Fatalf("SaveDispatchedJob: %v", err)
+	}
+
+	// Jobs which were dispatched before leases were introduced don't have an expiry, so they can always be revoked.
+	legacy := testDispatchedJob("b", 1, "/media/b.mkv")
+	legacy.LeaseDuration, legacy.LeaseExpires = 0, time.Time{}
+	if err := s.RunnerCommunicator.SaveDispatchedJob(ctx, legacy); err != nil {
+		t.Fatalf("SaveDispatchedJob: %v", err)
+	}
+
+	if revoked, err := s.HealthChecker.RevokeLease(ctx, "a", timestamp(59)); err != nil || revoked {
+		t.Errorf("expected a lease which hasn't expired to not be revoked but got %v, %v", revoked, err)
+	}
+	if revoked, err := s.HealthChecker.RevokeLease(ctx, "a", timestamp(60)); err != nil || !revoked {
+		t.Errorf("expected an expired lease to be revoked but got %v, %v", revoked, err)
+	}
+	if revoked, err := s.HealthChecker.RevokeLease(ctx, "a", timestamp(61)); err != nil || revoked {
+		t.Errorf("expected a lease to only be revoked once but got %v, %v", revoked, err)
+	}
+	if revoked, err := s.HealthChecker.RevokeLease(ctx, "b", timestamp(0)); err != nil || !revoked {
+		t.Errorf("expected a job without a lease to be revoked but got %v, %v", revoked, err)
+	}
+
+	if dJobs := s.HealthChecker.DispatchedJobs(ctx); dJobs == nil || len(dJobs) != 0 {
+		t.Errorf("expected an empty, non-nil slice but got %#v", dJobs)
+	}
+}
+
+func testLibraryManagerRevokeLease(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if err := s.RunnerCommunicator.SaveDispatchedJob(ctx, testDispatchedJob("a", 1, "/media/a.mkv")); err != nil {
+		t.Fatalf("SaveDispatchedJob: %v", err)
+	}
+
+	dJobs, err := s.LibraryManager.DispatchedJobs(ctx)
+	if err != nil {
+		t.Fatalf("DispatchedJobs: %v", err)
+	}
+	if len(dJobs) != 1 || dJobs[0].UUID != "a" || dJobs[0].Job.Path != "/media/a.mkv" {
+		t.Errorf("expected the dispatched job to be listed but got %+v", dJobs)
+	}
+
+	if revoked, err := s.LibraryManager.RevokeLease(ctx, "a", timestamp(59)); err != nil || revoked {
+		t.Errorf("expected a lease which hasn't expired to not be revoked but got %v, %v", revoked, err)
+	}
+	if revoked, err := s.LibraryManager.RevokeLease(ctx, "a", timestamp(60)); err != nil || !revoked {
+		t.Errorf("expected an expired lease to be revoked but got %v, %v", revoked, err)
+	}
+
+	dJobs, err = s.LibraryManager.DispatchedJobs(ctx)
+	if err != nil {
+		t.Fatalf("DispatchedJobs: %v", err)
+	}
+	if dJobs == nil || len(dJobs) != 0 {
+		t.Errorf("expected an empty, non-nil slice but got %#v", dJobs)
+	}
+}
+
+func testHealthCheckActions(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	actions := []controller.HealthCheckAction{
+		{Time: timestamp(0), JobUUID: "a", Runner: "Runner", Path: "/media/a.mkv", LibraryID: 1, Action: controller.StaleJobRequeue, Reason: "the lease expired"},
+		{Time: timestamp(2), JobUUID: "b", Runner: "Runner", Path: "/media/b.mkv", LibraryID: 1, Action: controller.StaleJobNotify, Reason: "the lease expired"},
+		{Time: timestamp(1), JobUUID: "c", Runner: "Other", Path: "/media/c.mkv", LibraryID: 2, Action: controller.StaleJobRequeue, Reason: "the runner is offline"},
+	}
+	for _, a := range actions {
+		if err := s.HealthChecker.SaveHealthCheckAction(ctx, a); err != nil {
+			t.Fatalf("SaveHealthCheckAction: %v", err)
+		}
+	}
+
+	got, err := s.UserInterfacer.HealthCheckActions(ctx, 2)
+	if err != nil {
+		t.Fatalf("HealthCheckActions: %v", err)
+	}
+	if len(got) != 2 || got[0].JobUUID != "b" || got[1].JobUUID != "c" {
+		t.Fatalf("expected the 2 newest actions but got %+v", got)
+	}
+	if want := actions[2]; got[1].Runner != want.Runner || got[1].Path != want.Path || got[1].LibraryID != want.LibraryID ||
+		got[1].Action != want.Action || got[1].Reason != want.Reason || !got[1].Time.Equal(want.Time) {
+		t.Errorf("expected %+v but got %+v", want, got[1])
+	}
+
+	counts, err := s.UserInterfacer.HealthCheckActionCounts(ctx)
+	if err != nil {
+		t.Fatalf("HealthCheckActionCounts: %v", err)
+	}
+	expected := map[controller.StaleJobAction]int{controller.StaleJobRequeue: 2, controller.StaleJobNotify: 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected counts %v but got %v", expected, counts)
+	}
+}
+
+func testJobEvents(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if err := s.JobEvents.SaveJobEvents(ctx, nil); err != nil {
+		t.Fatalf("SaveJobEvents with no events: %v", err)
+	}
+
+	events := []controller.JobEvent{
+		{Time: timestamp(1), JobUUID: "a", LibraryID: 1, Component: "runnerCommunicator", Level: "INFO", Message: "Dispatched job a"},
+		{Time: timestamp(0), JobUUID: "a", LibraryID: 1, Component: "library.Manager", Level: "INFO", Message: "Queued job a"},
+		{Time: timestamp(1), JobUUID: "b", LibraryID: -1, Component: "runnerCommunicator", Level: "WARNING", Message: "Job b failed"},
+		{Time: timestamp(1), JobUUID: "a", LibraryID: 1, Component: "runnerCommunicator", Level: "INFO", Message: "Sent the file of job a"},
+	}
+	if err := s.JobEvents.SaveJobEvents(ctx, events); err != nil {
+		t.Fatalf("SaveJobEvents: %v", err)
+	}
+
+	got, err := s.UserInterfacer.JobEvents(ctx, "a")
+	if err != nil {
+		t.Fatalf("JobEvents: %v", err)
+	}
+	// Events recorded at the same time keep the order they were saved in
+	expected := []controller.JobEvent{events[1], events[0], events[3]}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v events but got %+v", len(expected), got)
+	}
+	for i, want := range expected {
+		if got[i].JobUUID != want.JobUUID || got[i].LibraryID != want.LibraryID || got[i].Component != want.Component ||
+			got[i].Level != want.Level || got[i].Message != want.Message || !got[i].Time.Equal(want.Time) {
+			t.Errorf("expected %+v at %v but got %+v", want, i, got[i])
+		}
+	}
+
+	if got, err = s.UserInterfacer.JobEvents(ctx, "c"); err != nil || got == nil || len(got) != 0 {
+		t.Errorf("expected an empty, non-nil slice for an unknown job but got %#v, %v", got, err)
+	}
+
+	deleted, err := s.JobEvents.DeleteJobEventsBefore(ctx, timestamp(1))
+	if err != nil {
+		t.Fatalf("DeleteJobEventsBefore: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 deleted event but got %v", deleted)
+	}
+	if got, _ = s.UserInterfacer.JobEvents(ctx, "a"); len(got) != 2 {
+		t.Errorf("expected the 2 newer events of a to be kept but got %+v", got)
+	}
+}
+
+func testStaleJobSettings(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	lib := testLibrary(1)
+	if err := s.LibraryManager.SaveLibrary(ctx, lib); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	// A library which doesn't override the global settings
+	defaults := testLibrary(2)
+	defaults.StaleJobTimeout, defaults.StaleJobAction = 0, ""
+	if err := s.LibraryManager.SaveLibrary(ctx, defaults); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	settings, err := s.HealthChecker.StaleJobSettings(ctx)
+	if err != nil {
+		t.Fatalf("StaleJobSettings: %v", err)
+	}
+
+	expected := map[int]controller.StaleJobSettings{
+		1: {Timeout: 30 * time.Hour, Action: controller.StaleJobNotify},
+		2: {},
+	}
+	if !reflect.DeepEqual(settings, expected) {
+		t.Errorf("expected %+v but got %+v", expected, settings)
+	}
+}
+
+func testHistory(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	h := controller.History{
+		Filename:          "/media/a.mkv",
+		DateTimeCompleted: timestamp(0),
+		Warnings:          []string{"warning"},
+		Errors:            []string{},
+		UUID:              "a",
+		Runner:            "runner",
+		Failed:            false,
+		Job:               testJob("a", 1, "/media/a.mkv"),
+		Output:            &controller.OutputStats{VideoCodec: "HEVC", Duration: 1320.5, Size: 6e8, Bitrate: 3634986},
+		Completion: &controller.CompletionRecord{
+			OriginalSize: 1e9, NewSize: 6e8, SavedBytes: 4e8, SavedPercent: 40, Elapsed: 95 * time.Minute,
+			Encoder: "libx265", SourceCodec: "AVC", TargetCodec: "HEVC",
+		},
+		OriginalPath: "/media/a.original.mkv",
+	}
+	if err := s.LibraryManager.PushHistory(ctx, h); err != nil {
+		t.Fatalf("PushHistory: %v", err)
+	}
+	// Entries of jobs which failed on the Runner don't have an output.
+	if err := s.LibraryManager.PushHistory(ctx, controller.History{Filename: "/media/b.mkv", DateTimeCompleted: timestamp(1), Warnings: []string{}, Errors: []string{"failed"}, UUID: "b", Failed: true}); err != nil {
+		t.Fatalf("PushHistory: %v", err)
+	}
+
+	entries, err := s.UserInterfacer.HistoryEntries(ctx)
+	if err != nil {
+		t.Fatalf("HistoryEntries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Filename != h.Filename || !entries[0].DateTimeCompleted.Equal(h.DateTimeCompleted) || !reflect.DeepEqual(entries[0].Warnings, h.Warnings) {
+		t.Errorf("expected [%+v] but got %+v", h, entries)
+	}
+
+	got, err := s.UserInterfacer.HistoryEntry(ctx, "a")
+	if err != nil {
+		t.Fatalf("HistoryEntry: %v", err)
+	}
+	if got.UUID != h.UUID || got.Runner != h.Runner || got.Failed != h.Failed || !reflect.DeepEqual(got.Job, h.Job) || !reflect.DeepEqual(got.Output, h.Output) {
+		t.Errorf("expected %+v but got %+v", h, got)
+	}
+	if !reflect.DeepEqual(got.Completion, h.Completion) || got.OriginalPath != h.OriginalPath {
+		t.Errorf("expected completion %+v and original path %v but got %+v and %v", h.Completion, h.OriginalPath, got.Completion, got.OriginalPath)
+	}
+
+	if got, err = s.UserInterfacer.HistoryEntry(ctx, "b"); err != nil {
+		t.Fatalf("HistoryEntry: %v", err)
+	} else if got.Output != nil || got.Completion != nil {
+		t.Errorf("expected no output or completion but got %+v, %+v", got.Output, got.Completion)
+	}
+
+	if _, err = s.UserInterfacer.HistoryEntry(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown history entry but got %v", err)
+	}
+}
+
+func testRestoredOriginals(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	// The same file was trashed twice, so the newer entry is the one which is found by the original path
+	for i, uuid := range []controller.UUID{"a", "b"} {
+		h := controller.History{Filename: "/media/a.mkv", DateTimeCompleted: timestamp(i), Warnings: []string{}, Errors: []string{}, UUID: uuid, OriginalPath: "/trash/1/a.mkv"}
+		if err := s.LibraryManager.PushHistory(ctx, h); err != nil {
+			t.Fatalf("PushHistory: %v", err)
+		}
+	}
+
+	got, err := s.UserInterfacer.HistoryEntryByOriginalPath(ctx, "/trash/1/a.mkv")
+	if err != nil {
+		t.Fatalf("HistoryEntryByOriginalPath: %v", err)
+	}
+	if got.UUID != "b" || got.OriginalRestored {
+		t.Errorf("expected the unrestored entry b but got %+v", got)
+	}
+	if _, err = s.UserInterfacer.HistoryEntryByOriginalPath(ctx, "/trash/1/missing.mkv"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown original path but got %v", err)
+	}
+
+	if err = s.UserInterfacer.MarkOriginalRestored(ctx, "b"); err != nil {
+		t.Fatalf("MarkOriginalRestored: %v", err)
+	}
+	if got, err = s.UserInterfacer.HistoryEntry(ctx, "b"); err != nil || !got.OriginalRestored {
+		t.Errorf("expected entry b to be restored but got %+v (%v)", got, err)
+	}
+	if got, err = s.UserInterfacer.HistoryEntry(ctx, "a"); err != nil || got.OriginalRestored {
+		t.Errorf("expected entry a not to be restored but got %+v (%v)", got, err)
+	}
+	if err = s.UserInterfacer.MarkOriginalRestored(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown history entry but got %v", err)
+	}
+}
+
+func testJobAttempts(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	path := "/media/a.mkv"
+	for expected := 1; expected <= 2; expected++ {
+		attempts, err := s.LibraryManager.IncrementJobAttempts(ctx, path)
+		if err != nil {
+			t.Fatalf("IncrementJobAttempts: %v", err)
+		}
+		if attempts != expected {
+			t.Errorf("expected %v attempts but got %v", expected, attempts)
+		}
+	}
+
+	if err := s.LibraryManager.ResetJobAttempts(ctx, path); err != nil {
+		t.Fatalf("ResetJobAttempts: %v", err)
+	}
+
+	if attempts, err := s.LibraryManager.IncrementJobAttempts(ctx, path); err != nil {
+		t.Fatalf("IncrementJobAttempts: %v", err)
+	} else if attempts != 1 {
+		t.Errorf("expected the counter to restart at 1 after a reset but got %v", attempts)
+	}
+}
+
+func testQuarantine(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	path := "/media/a.mkv"
+
+	if err := s.UserInterfacer.ClearQuarantine(ctx, path); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows when clearing a path which isn't quarantined but got %v", err)
+	}
+
+	if _, err := s.LibraryManager.IncrementJobAttempts(ctx, path); err != nil {
+		t.Fatalf("IncrementJobAttempts: %v", err)
+	}
+
+	q := controller.QuarantinedJob{Job: testJob("a", 1, path), Attempts: 3, Reason: "ffmpeg exited with code 1", DateTimeQuarantined: timestamp(0)}
+	if err := s.LibraryManager.QuarantineJob(ctx, q); err != nil {
+		t.Fatalf("QuarantineJob: %v", err)
+	}
+	// Quarantining the same path again replaces the entry.
+	if err := s.LibraryManager.QuarantineJob(ctx, q); err != nil {
+		t.Fatalf("QuarantineJob: %v", err)
+	}
+
+	if quarantined, err := s.LibraryManager.IsPathQuarantined(ctx, path); err != nil {
+		t.Fatalf("IsPathQuarantined: %v", err)
+	} else if !quarantined {
+		t.Errorf("expected path to be quarantined")
+	}
+
+	if err := s.UserInterfacer.ClearQuarantine(ctx, path); err != nil {
+		t.Fatalf("ClearQuarantine: %v", err)
+	}
+
+	if quarantined, err := s.LibraryManager.IsPathQuarantined(ctx, path); err != nil {
+		t.Fatalf("IsPathQuarantined: %v", err)
+	} else if quarantined {
+		t.Errorf("expected path to no longer be quarantined")
+	}
+
+	if attempts, err := s.LibraryManager.IncrementJobAttempts(ctx, path); err != nil {
+		t.Fatalf("IncrementJobAttempts: %v", err)
+	} else if attempts != 1 {
+		t.Errorf("expected ClearQuarantine to reset the attempt counter but got %v attempts", attempts)
+	}
+}
+
+func testSkippedPaths(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if err := s.UserInterfacer.UnskipPath(ctx, "/media/a.mkv"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows when unskipping a path which isn't skipped but got %v", err)
+	}
+
+	skipped := []controller.SkippedPath{{Path: "/media/b.mkv", DateTimeSkipped: timestamp(0)}, {Path: "/media/a.mkv", DateTimeSkipped: timestamp(0)}}
+	if err := s.UserInterfacer.SkipPaths(ctx, skipped); err != nil {
+		t.Fatalf("SkipPaths: %v", err)
+	}
+	// Skipping a path again keeps the time that it was first skipped.
+	if err := s.UserInterfacer.SkipPaths(ctx, []controller.SkippedPath{{Path: "/media/a.mkv", DateTimeSkipped: timestamp(5)}}); err != nil {
+		t.Fatalf("SkipPaths: %v", err)
+	}
+
+	got, err := s.UserInterfacer.SkippedPaths(ctx)
+	if err != nil {
+		t.Fatalf("SkippedPaths: %v", err)
+	}
+	if len(got) != 2 || got[0].Path != "/media/a.mkv" || got[1].Path != "/media/b.mkv" {
+		t.Fatalf("expected the skipped paths to be sorted by path but got %+v", got)
+	}
+	if !got[0].DateTimeSkipped.Equal(timestamp(0)) {
+		t.Errorf("expected %v to keep the time it was first skipped but got %v", got[0].Path, got[0].DateTimeSkipped)
+	}
+
+	// Skipped paths are kept apart from quarantined jobs.
+	if quarantined, err := s.LibraryManager.IsPathQuarantined(ctx, "/media/a.mkv"); err != nil {
+		t.Fatalf("IsPathQuarantined: %v", err)
+	} else if quarantined {
+		t.Errorf("expected a skipped path to not be quarantined")
+	}
+
+	if err := s.UserInterfacer.UnskipPath(ctx, "/media/a.mkv"); err != nil {
+		t.Fatalf("UnskipPath: %v", err)
+	}
+
+	for path, want := range map[string]bool{"/media/a.mkv": false, "/media/b.mkv": true} {
+		if skipped, err := s.LibraryManager.IsPathSkipped(ctx, path); err != nil {
+			t.Fatalf("IsPathSkipped: %v", err)
+		} else if skipped != want {
+			t.Errorf("expected %v to be skipped to be %v but got %v", path, want, skipped)
+		}
+	}
+}
+
+func testBenchmarkResults(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	results := []controller.BenchmarkResult{
+		{UUID: "a", Path: "/media/a.mkv", LibraryID: 1, Runner: "Runner", Settings: `{"crf":28}`, Command: []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", "libx265"},
+			Errors: []string{}, SourceSize: 1000, DateTimeCompleted: timestamp(0), Elapsed: 90 * time.Second, FPS: 41.5, ProjectedSize: 400},
+		{UUID: "b", Path: "/media/b.mkv", LibraryID: 1, Runner: "Runner", Failed: true, Errors: []string{"FFmpeg returned exit code: 1"},
+			DateTimeCompleted: timestamp(2)},
+		{UUID: "c", Path: "/media/a.mkv", LibraryID: 1, Runner: "Other", Settings: `{"crf":28}`, Command: []string{"-i", "ENCODARR_INPUT_FILE", "-c:v", "libx265"},
+			Errors: []string{}, SourceSize: 1000, DateTimeCompleted: timestamp(1), Elapsed: 3 * time.Minute, FPS: 20.75, ProjectedSize: 410},
+	}
+	for _, r := range results {
+		if err := s.LibraryManager.SaveBenchmarkResult(ctx, r); err != nil {
+			t.Fatalf("SaveBenchmarkResult: %v", err)
+		}
+	}
+
+	got, err := s.UserInterfacer.BenchmarkResults(ctx, "/media/a.mkv")
+	if err != nil {
+		t.Fatalf("BenchmarkResults: %v", err)
+	}
+	if len(got) != 2 || got[0].UUID != "c" || got[1].UUID != "a" {
+		t.Fatalf("expected the 2 results of /media/a.mkv newest first but got %+v", got)
+	}
+	got[1].DateTimeCompleted = got[1].DateTimeCompleted.UTC()
+	if !reflect.DeepEqual(got[1], results[0]) {
+		t.Errorf("expected %+v but got %+v", results[0], got[1])
+	}
+
+	all, err := s.UserInterfacer.BenchmarkResults(ctx, "")
+	if err != nil {
+		t.Fatalf("BenchmarkResults: %v", err)
+	}
+	if len(all) != 3 || all[0].UUID != "b" || !all[0].Failed || !reflect.DeepEqual(all[0].Errors, results[1].Errors) {
+		t.Errorf("expected every result newest first but got %+v", all)
+	}
+}
+
+func testHeldGroupParts(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	part := func(uuid controller.UUID, path, group string) controller.HeldGroupPart {
+		dJob := testDispatchedJob(uuid, 1, path)
+		dJob.Job.Group = group
+		dJob.Job.GroupSize = 2
+		return controller.HeldGroupPart{
+			Completed: controller.CompletedJob{
+				UUID: uuid,
+				History: controller.History{
+					Filename:          path,
+					DateTimeCompleted: timestamp(5),
+					Warnings:          []string{"audio track 2 was dropped"},
+					Output:            &controller.OutputStats{VideoCodec: "HEVC", Duration: 2700, Size: 500, Bitrate: 1},
+				},
+				InFile:       "/staging/" + string(uuid) + ".import.mkv",
+				CaptionsFile: "/staging/" + string(uuid) + ".import.srt",
+			},
+			Dispatched: dJob,
+		}
+	}
+
+	a := part("a", "/media/Movie/cd1.mkv", "/media/Movie/movie")
+	parts := []controller.HeldGroupPart{a, part("b", "/media/Show/cd1.mkv", "/media/Show/show"), part("c", "/media/Movie/cd2.mkv", "/media/Movie/movie")}
+	for _, p := range parts {
+		if err := s.LibraryManager.HoldGroupPart(ctx, p); err != nil {
+			t.Fatalf("HoldGroupPart: %v", err)
+		}
+	}
+
+	// Holding a part again replaces it
+	a.Completed.InFile = "/staging/a.import.mp4"
+	parts[0] = a
+	if err := s.LibraryManager.HoldGroupPart(ctx, a); err != nil {
+		t.Fatalf("HoldGroupPart: %v", err)
+	}
+
+	got, err := s.LibraryManager.HeldGroupParts(ctx)
+	if err != nil {
+		t.Fatalf("HeldGroupParts: %v", err)
+	}
+	if !reflect.DeepEqual(got, parts) {
+		t.Errorf("expected %+v but got %+v", parts, got)
+	}
+
+	if err := s.LibraryManager.ReleaseGroupParts(ctx, "/media/Movie/movie"); err != nil {
+		t.Fatalf("ReleaseGroupParts: %v", err)
+	}
+	got, err = s.LibraryManager.HeldGroupParts(ctx)
+	if err != nil {
+		t.Fatalf("HeldGroupParts: %v", err)
+	}
+	if len(got) != 1 || got[0].Completed.UUID != "b" {
+		t.Errorf("expected only the part of the other set to be held but got %+v", got)
+	}
+}
+
+func testReleaseExpiredQuarantines(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	// b was quarantined two hours after a in UTC, but in a time zone two hours ahead, so both are as old as each other
+	quarantined := map[string]time.Time{
+		"/media/a.mkv": timestamp(0),
+		"/media/b.mkv": timestamp(0).In(time.FixedZone("CEST", 2*60*60)),
+		"/media/c.mkv": timestamp(30),
+	}
+	for path, t0 := range quarantined {
+		if _, err := s.LibraryManager.IncrementJobAttempts(ctx, path); err != nil {
+			t.Fatalf("IncrementJobAttempts: %v", err)
+		}
+		q := controller.QuarantinedJob{Job: testJob(controller.UUID(path), 1, path), Attempts: 3, Reason: "ffmpeg exited with code 1", DateTimeQuarantined: t0}
+		if err := s.LibraryManager.QuarantineJob(ctx, q); err != nil {
+			t.Fatalf("QuarantineJob: %v", err)
+		}
+	}
+
+	released, err := s.LibraryManager.ReleaseExpiredQuarantines(ctx, timestamp(10))
+	if err != nil {
+		t.Fatalf("ReleaseExpiredQuarantines: %v", err)
+	}
+	if expected := []string{"/media/a.mkv", "/media/b.mkv"}; !reflect.DeepEqual(released, expected) {
+		t.Errorf("expected %v to be released but got %v", expected, released)
+	}
+
+	for path, expected := range map[string]bool{"/media/a.mkv": false, "/media/b.mkv": false, "/media/c.mkv": true} {
+		if got, err := s.LibraryManager.IsPathQuarantined(ctx, path); err != nil {
+			t.Fatalf("IsPathQuarantined: %v", err)
+		} else if got != expected {
+			t.Errorf("expected %v to be quarantined to be %v but got %v", path, expected, got)
+		}
+	}
+
+	if attempts, err := s.LibraryManager.IncrementJobAttempts(ctx, "/media/a.mkv"); err != nil {
+		t.Fatalf("IncrementJobAttempts: %v", err)
+	} else if attempts != 1 {
+		t.Errorf("expected releasing a quarantine to reset the attempt counter but got %v attempts", attempts)
+	}
+
+	if released, err = s.LibraryManager.ReleaseExpiredQuarantines(ctx, timestamp(10)); err != nil {
+		t.Fatalf("ReleaseExpiredQuarantines: %v", err)
+	} else if len(released) != 0 {
+		t.Errorf("expected nothing to be released again but got %v", released)
+	}
+}
+
+func testImportFileStates(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if err := s.LibraryManager.SaveLastProcessedModtime(ctx, "/media/a.mkv", timestamp(0)); err != nil {
+		t.Fatalf("SaveLastProcessedModtime: %v", err)
+	}
+
+	processed := map[string]time.Time{"/media/a.mkv": timestamp(5), "/media/b.mkv": timestamp(6)}
+	quarantined := []controller.QuarantinedJob{{Job: testJob("c", 1, "/media/c.mkv"), Reason: "errored in Tdarr", DateTimeQuarantined: timestamp(7)}}
+	if err := s.UserInterfacer.ImportFileStates(ctx, processed, quarantined); err != nil {
+		t.Fatalf("ImportFileStates: %v", err)
+	}
+
+	for path, expected := range processed {
+		if modtime, err := s.LibraryManager.LastProcessedModtime(ctx, path); err != nil {
+			t.Errorf("LastProcessedModtime(%v): %v", path, err)
+		} else if !modtime.Equal(expected) {
+			t.Errorf("expected the processed modtime of %v to be %v but got %v", path, expected, modtime)
+		}
+	}
+
+	if q, err := s.LibraryManager.IsPathQuarantined(ctx, "/media/c.mkv"); err != nil {
+		t.Fatalf("IsPathQuarantined: %v", err)
+	} else if !q {
+		t.Errorf("expected the imported job to be quarantined")
+	}
+}
+
+func testLastProcessedModtime(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	path := "/media/a.mkv"
+
+	if _, err := s.LibraryManager.LastProcessedModtime(ctx, path); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a path which was never processed but got %v", err)
+	}
+
+	for _, modtime := range []time.Time{timestamp(0), timestamp(1)} {
+		if err := s.LibraryManager.SaveLastProcessedModtime(ctx, path, modtime); err != nil {
+			t.Fatalf("SaveLastProcessedModtime: %v", err)
+		}
+
+		got, err := s.LibraryManager.LastProcessedModtime(ctx, path)
+		if err != nil {
+			t.Fatalf("LastProcessedModtime: %v", err)
+		}
+		if !got.Equal(modtime) {
+			t.Errorf("expected %v but got %v", modtime, got)
+		}
+	}
+}
+
+func testDeleteProcessedModtimes(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	for _, path := range []string{"/media/tv/a.mkv", "/media/tv/season 1/b.mkv", "/media/tv2/c.mkv", "/media/movies/d.mkv"} {
+		if err := s.LibraryManager.SaveLastProcessedModtime(ctx, path, timestamp(0)); err != nil {
+			t.Fatalf("SaveLastProcessedModtime: %v", err)
+		}
+	}
+
+	deleted, err := s.LibraryManager.DeleteProcessedModtimes(ctx, "/media/tv/")
+	if err != nil {
+		t.Fatalf("DeleteProcessedModtimes: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("expected 2 deleted paths but got %v", deleted)
+	}
+
+	for path, wantKept := range map[string]bool{
+		"/media/tv/a.mkv":          false,
+		"/media/tv/season 1/b.mkv": false,
+		"/media/tv2/c.mkv":         true,
+		"/media/movies/d.mkv":      true,
+	} {
+		_, err := s.LibraryManager.LastProcessedModtime(ctx, path)
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("%v: expected kept=%v but got error %v", path, wantKept, err)
+		}
+	}
+}
+
+func testCanonicalizePaths(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	processed := map[string]time.Time{"/media/a.mkv": timestamp(0), "/media//a.mkv": timestamp(1), "/media/./b.mkv": timestamp(0)}
+	for path, modtime := range processed {
+		if err := s.LibraryManager.SaveLastProcessedModtime(ctx, path, modtime); err != nil {
+			t.Fatalf("SaveLastProcessedModtime: %v", err)
+		}
+	}
+
+	for path, attempts := range map[string]int{"/media/a.mkv": 1, "/media//a.mkv": 3} {
+		for i := 0; i < attempts; i++ {
+			if _, err := s.LibraryManager.IncrementJobAttempts(ctx, path); err != nil {
+				t.Fatalf("IncrementJobAttempts: %v", err)
+			}
+		}
+	}
+
+	q := controller.QuarantinedJob{Job: testJob("c", 1, "/media/c.mkv/"), Attempts: 3, Reason: "ffmpeg exited with code 1", DateTimeQuarantined: timestamp(0)}
+	if err := s.LibraryManager.QuarantineJob(ctx, q); err != nil {
+		t.Fatalf("QuarantineJob: %v", err)
+	}
+
+	if err := s.UserInterfacer.SkipPaths(ctx, []controller.SkippedPath{{Path: "/media/d.mkv", DateTimeSkipped: timestamp(2)}, {Path: "/media//d.mkv", DateTimeSkipped: timestamp(1)}}); err != nil {
+		t.Fatalf("SkipPaths: %v", err)
+	}
+
+	changed, err := s.LibraryManager.CanonicalizePaths(ctx, controller.PathCanonicalizer{}.Canonicalize)
+	if err != nil {
+		t.Fatalf("CanonicalizePaths: %v", err)
+	}
+	if changed != 5 {
+		t.Errorf("expected 5 changed paths but got %v", changed)
+	}
+
+	for path, want := range map[string]time.Time{"/media/a.mkv": timestamp(1), "/media/b.mkv": timestamp(0)} {
+		got, err := s.LibraryManager.LastProcessedModtime(ctx, path)
+		if err != nil {
+			t.Errorf("LastProcessedModtime(%v): %v", path, err)
+		} else if !got.Equal(want) {
+			t.Errorf("expected the merged modtime of %v to be %v but got %v", path, want, got)
+		}
+	}
+	for _, path := range []string{"/media//a.mkv", "/media/./b.mkv"} {
+		if _, err := s.LibraryManager.LastProcessedModtime(ctx, path); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected the modtime of %v to be moved but got %v", path, err)
+		}
+	}
+
+	if attempts, err := s.LibraryManager.IncrementJobAttempts(ctx, "/media/a.mkv"); err != nil {
+		t.Fatalf("IncrementJobAttempts: %v", err)
+	} else if attempts != 4 {
+		t.Errorf("expected the highest attempt count to be kept but got %v attempts after incrementing", attempts)
+	}
+
+	if quarantined, err := s.LibraryManager.IsPathQuarantined(ctx, "/media/c.mkv"); err != nil {
+		t.Fatalf("IsPathQuarantined: %v", err)
+	} else if !quarantined {
+		t.Errorf("expected the quarantined job to be moved to the canonical path")
+	}
+	if quarantined, err := s.LibraryManager.IsPathQuarantined(ctx, "/media/c.mkv/"); err != nil {
+		t.Fatalf("IsPathQuarantined: %v", err)
+	} else if quarantined {
+		t.Errorf("expected the quarantined job to no longer be at the old path")
+	}
+
+	if skipped, err := s.UserInterfacer.SkippedPaths(ctx); err != nil {
+		t.Fatalf("SkippedPaths: %v", err)
+	} else if len(skipped) != 1 || skipped[0].Path != "/media/d.mkv" || !skipped[0].DateTimeSkipped.Equal(timestamp(1)) {
+		t.Errorf("expected the skipped paths to be merged into /media/d.mkv with the earliest time but got %+v", skipped)
+	}
+
+	if changed, err = s.LibraryManager.CanonicalizePaths(ctx, controller.PathCanonicalizer{}.Canonicalize); err != nil {
+		t.Fatalf("CanonicalizePaths: %v", err)
+	} else if changed != 0 {
+		t.Errorf("expected canonical paths to be left alone but %v were changed", changed)
+	}
+}
+
+func testRunners(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	if err := s.RunnerCommunicator.RunnerSeen(ctx, "runner", "1.0.0", timestamp(0)); err != nil {
+		t.Fatalf("RunnerSeen: %v", err)
+	}
+	// An empty version leaves the stored version alone.
+	if err := s.RunnerCommunicator.RunnerSeen(ctx, "runner", "", timestamp(5)); err != nil {
+		t.Fatalf("RunnerSeen: %v", err)
+	}
+	if err := s.RunnerCommunicator.RecordRunnerResult(ctx, "runner", false); err != nil {
+		t.Fatalf("RecordRunnerResult: %v", err)
+	}
+	if err := s.RunnerCommunicator.RecordRunnerResult(ctx, "runner", true); err != nil {
+		t.Fatalf("RecordRunnerResult: %v", err)
+	}
+	if err := s.RunnerCommunicator.RunnerSeen(ctx, "stale", "1.0.0", timestamp(0)); err != nil {
+		t.Fatalf("RunnerSeen: %v", err)
+	}
+
+	runners, err := s.UserInterfacer.Runners(ctx)
+	if err != nil {
+		t.Fatalf("Runners: %v", err)
+	}
+	if len(runners) != 2 {
+		t.Fatalf("expected 2 runners but got %+v", runners)
+	}
+
+	var r controller.Runner
+	for _, v := range runners {
+		if v.Name == "runner" {
+			r = v
+		}
+	}
+	if r.UUID == "" || r.DisplayName != "runner" || r.Version != "1.0.0" || !r.LastSeen.Equal(timestamp(5)) || r.JobsCompleted != 1 || r.JobsFailed != 1 {
+		t.Errorf("unexpected runner record: %+v", r)
+	}
+
+	// The HealthChecker cross-references dispatched jobs against the same records
+	hcRunners, err := s.HealthChecker.Runners(ctx)
+	if err != nil {
+		t.Fatalf("HealthChecker.Runners: %v", err)
+	}
+	if len(hcRunners) != len(runners) {
+		t.Errorf("expected the HealthChecker to see %v runners but got %+v", len(runners), hcRunners)
+	}
+
+	if err = s.UserInterfacer.RenameRunner(ctx, r.UUID, "Living Room"); err != nil {
+		t.Fatalf("RenameRunner: %v", err)
+	}
+	if err = s.UserInterfacer.RenameRunner(ctx, "missing", "x"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows when renaming an unknown runner but got %v", err)
+	}
+
+	deleted, err := s.UserInterfacer.DeleteStaleRunners(ctx, timestamp(1))
+	if err != nil {
+		t.Fatalf("DeleteStaleRunners: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 stale runner to be deleted but got %v", deleted)
+	}
+
+	if runners, err = s.UserInterfacer.Runners(ctx); err != nil {
+		t.Fatalf("Runners: %v", err)
+	}
+	if len(runners) != 1 || runners[0].DisplayName != "Living Room" {
+		t.Errorf("expected only the renamed runner to remain but got %+v", runners)
+	}
+
+	if err = s.UserInterfacer.DeleteRunner(ctx, r.UUID); err != nil {
+		t.Fatalf("DeleteRunner: %v", err)
+	}
+	if err = s.UserInterfacer.DeleteRunner(ctx, r.UUID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows when deleting an unknown runner but got %v", err)
+	}
+}
+
+func testFileCache(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	path := "/media/a.mkv"
+
+	if _, err := s.FileCache.Modtime(ctx, path); err == nil {
+		t.Errorf("expected an error for an unknown modtime")
+	}
+	if _, err := s.FileCache.Metadata(ctx, path); err == nil {
+		t.Errorf("expected an error for unknown metadata")
+	}
+
+	metadata := testJob("a", 1, path).Metadata
+	if err := s.FileCache.SaveModtime(ctx, path, timestamp(0)); err != nil {
+		t.Fatalf("SaveModtime: %v", err)
+	}
+	if err := s.FileCache.SaveMetadata(ctx, path, metadata); err != nil {
+		t.Fatalf("SaveMetadata: %v", err)
+	}
+
+	// Saving the metadata must not clear the modtime and vice versa.
+	if modtime, err := s.FileCache.Modtime(ctx, path); err != nil {
+		t.Fatalf("Modtime: %v", err)
+	} else if !modtime.Equal(timestamp(0)) {
+		t.Errorf("expected modtime %v but got %v", timestamp(0), modtime)
+	}
+
+	if err := s.FileCache.SaveModtime(ctx, path, timestamp(1)); err != nil {
+		t.Fatalf("SaveModtime: %v", err)
+	}
+
+	if got, err := s.FileCache.Metadata(ctx, path); err != nil {
+		t.Fatalf("Metadata: %v", err)
+	} else if !reflect.DeepEqual(got, metadata) {
+		t.Errorf("expected metadata %+v but got %+v", metadata, got)
+	}
+}
+
+func testSearchFiles(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	lib := testLibrary(1)
+	lib.Queue = controller.LibraryQueue{Items: []controller.Job{
+		testJob("q1", 1, "/media/Show/S01E01.mkv"),
+		testJob("q2", 1, "/media/Movie (2020).mkv"),
+	}}
+	if err := s.LibraryManager.SaveLibrary(ctx, lib); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+	// Libraries with an empty queue must not break the search.
+	if err := s.LibraryManager.SaveLibrary(ctx, controller.Library{ID: 2}); err != nil {
+		t.Fatalf("SaveLibrary: %v", err)
+	}
+
+	if err := s.RunnerCommunicator.SaveDispatchedJob(ctx, testDispatchedJob("d1", 1, "/media/Show/S01E02.mkv")); err != nil {
+		t.Fatalf("SaveDispatchedJob: %v", err)
+	}
+
+	if err := s.LibraryManager.PushHistory(ctx, controller.History{UUID: "h1", Job: testJob("h1", 1, "/media/Show/S01E03.mkv"), Filename: "/media/Show/S01E03.mkv", DateTimeCompleted: timestamp(0), Warnings: []string{}, Errors: []string{"failed"}}); err != nil {
+		t.Fatalf("PushHistory: %v", err)
+	}
+	// Entries recorded before the job details were kept don't know their job.
+	if err := s.LibraryManager.PushHistory(ctx, controller.History{Filename: "/media/Old/S02E01.mkv", DateTimeCompleted: timestamp(0), Warnings: []string{}, Errors: []string{}}); err != nil {
+		t.Fatalf("PushHistory: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		pattern       string
+		limit         int
+		expectedPaths []string
+		expectedMore  bool
+	}{
+		{name: "Substring across locations", pattern: "S01E0", limit: 10, expectedPaths: []string{"/media/Show/S01E01.mkv", "/media/Show/S01E02.mkv", "/media/Show/S01E03.mkv"}},
+		{name: "Glob", pattern: "*E02.mkv", limit: 10, expectedPaths: []string{"/media/Show/S01E02.mkv"}},
+		{name: "Case-insensitive", pattern: "s01e01", limit: 10, expectedPaths: []string{"/media/Show/S01E01.mkv"}},
+		{name: "Limit", pattern: "S01E0", limit: 2, expectedPaths: []string{"/media/Show/S01E01.mkv", "/media/Show/S01E02.mkv"}, expectedMore: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, more, err := s.UserInterfacer.SearchFiles(ctx, test.pattern, test.limit)
+			if err != nil {
+				t.Fatalf("SearchFiles: %v", err)
+			}
+
+			paths := make([]string, 0, len(results))
+			for _, r := range results {
+				paths = append(paths, r.Path)
+			}
+
+			if !reflect.DeepEqual(paths, test.expectedPaths) {
+				t.Errorf("expected %v but got %v", test.expectedPaths, paths)
+			}
+			if more != test.expectedMore {
+				t.Errorf("expected more to be %v but got %v", test.expectedMore, more)
+			}
+		})
+	}
+
+	results, _, err := s.UserInterfacer.SearchFiles(ctx, "S01E0", 10)
+	if err != nil {
+		t.Fatalf("SearchFiles: %v", err)
+	}
+	for _, r := range results {
+		switch r.Location {
+		case "queue":
+			if r.LibraryID != 1 || r.State != "queued" || r.UUID != "q1" {
+				t.Errorf("unexpected queue result: %+v", r)
+			}
+		case "dispatched":
+			if r.LibraryID != 1 || r.UUID != "d1" || r.State != "Running FFmpeg" {
+				t.Errorf("unexpected dispatched result: %+v", r)
+			}
+		case "history":
+			if r.LibraryID != 1 || r.UUID != "h1" || r.State != "failed" {
+				t.Errorf("unexpected history result: %+v", r)
+			}
+		}
+	}
+
+	results, _, err = s.UserInterfacer.SearchFiles(ctx, "S02E01", 10)
+	if err != nil {
+		t.Fatalf("SearchFiles: %v", err)
+	}
+	if len(results) != 1 || results[0].LibraryID != -1 || results[0].UUID != "" || results[0].State != "completed" {
+		t.Errorf("expected the history entry without job details to have an unknown library and UUID but got %+v", results)
+	}
+}
+
+func testFileSnapshots(t *testing.T, s Storers) {
+	ctx := context.Background()
+
+	for _, id := range []int{1, 2, 3} {
+		if err := s.LibraryManager.SaveLibrary(ctx, testLibrary(id)); err != nil {
+			t.Fatalf("SaveLibrary: %v", err)
+		}
+	}
+
+	snapshots := []controller.FileSnapshot{
+		{Path: "/media/library1/big.mkv", LibraryID: 1, VideoCodec: "h264", Width: 1920, Height: 1080, Duration: 5400, Size: 6e9, Container: "mkv", Modtime: timestamp(0)},
+		{Path: "/media/library1/small.mkv", LibraryID: 1, VideoCodec: "h264", Width: 1280, Height: 720, Duration: 1320, Size: 5e8, Container: "mkv", Modtime: timestamp(0)},
+		{Path: "/media/library1/hdr.mp4", LibraryID: 1, VideoCodec: "HEVC", Width: 3840, Height: 2160, Duration: 7200, Size: 2e10, Container: "mp4", HDR: true, Modtime: timestamp(0)},
+		{Path: "/media/library2/big.mkv", LibraryID: 2, VideoCodec: "AVC", Width: 1920, Height: 1080, Duration: 5400, Size: 7e9, Container: "mkv", Modtime: timestamp(0)},
+		{Path: "/media/library3/big.mkv", LibraryID: 3, VideoCodec: "h264", Width: 1920, Height: 1080, Duration: 5400, Size: 7e9, Container: "mkv", Modtime: timestamp(0)},
+	}
+	for _, snapshot := range snapshots {
+		if err := s.LibraryManager.SaveFileSnapshot(ctx, snapshot); err != nil {
+			t.Fatalf("SaveFileSnapshot: %v", err)
+		}
+	}
+
+	// Saving a snapshot again replaces it.
+	updated := snapshots[1]
+	updated.Size, updated.Modtime = 5e9+1, timestamp(1)
+	if err := s.LibraryManager.SaveFileSnapshot(ctx, updated); err != nil {
+		t.Fatalf("SaveFileSnapshot: %v", err)
+	}
+
+	modtimes, err := s.LibraryManager.FileSnapshotModtimes(ctx, 1)
+	if err != nil {
+		t.Fatalf("FileSnapshotModtimes: %v", err)
+	}
+	if len(modtimes) != 3 || !modtimes["/media/library1/small.mkv"].Equal(timestamp(1)) || !modtimes["/media/library1/big.mkv"].Equal(timestamp(0)) {
+		t.Errorf("unexpected modtimes for library 1: %v", modtimes)
+	}
+
+	// The snapshots of deleted libraries aren't queried.
+	if err = s.UserInterfacer.DeleteLibrary(ctx, 3, timestamp(0)); err != nil {
+		t.Fatalf("DeleteLibrary: %v", err)
+	}
+
+	one, two, yes := 1, 2, true
+	tests := []struct {
+		name          string
+		filter        controller.FileSnapshotFilter
+		limit         int
+		expectedPaths []string
+		expectedCount int
+	}{
+		{name: "No filters", limit: 10, expectedPaths: []string{"/media/library1/big.mkv", "/media/library1/hdr.mp4", "/media/library1/small.mkv", "/media/library2/big.mkv"}, expectedCount: 4},
+		{name: "Large h264 files of a library", filter: controller.FileSnapshotFilter{LibraryID: &one, VideoCodec: "H264", MinSize: 5e9}, limit: 10, expectedPaths: []string{"/media/library1/big.mkv", "/media/library1/small.mkv"}, expectedCount: 2},
+		{name: "Library", filter: controller.FileSnapshotFilter{LibraryID: &two}, limit: 10, expectedPaths: []string{"/media/library2/big.mkv"}, expectedCount: 1},
+		{name: "HDR", filter: controller.FileSnapshotFilter{HDR: &yes}, limit: 10, expectedPaths: []string{"/media/library1/hdr.mp4"}, expectedCount: 1},
+		{name: "Container", filter: controller.FileSnapshotFilter{Container: "MP4"}, limit: 10, expectedPaths: []string{"/media/library1/hdr.mp4"}, expectedCount: 1},
+		{name: "Height range", filter: controller.FileSnapshotFilter{MinHeight: 720, MaxHeight: 1080}, limit: 10, expectedPaths: []string{"/media/library1/big.mkv", "/media/library1/small.mkv", "/media/library2/big.mkv"}, expectedCount: 3},
+		{name: "Duration range", filter: controller.FileSnapshotFilter{MinDuration: 3600, MaxDuration: 6000}, limit: 10, expectedPaths: []string{"/media/library1/big.mkv", "/media/library2/big.mkv"}, expectedCount: 2},
+		{name: "Maximum size", filter: controller.FileSnapshotFilter{MaxSize: 6e9}, limit: 10, expectedPaths: []string{"/media/library1/big.mkv", "/media/library1/small.mkv"}, expectedCount: 2},
+		{name: "Limit", limit: 1, expectedPaths: []string{"/media/library1/big.mkv"}, expectedCount: 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			paths, count, err := s.UserInterfacer.QueryFileSnapshots(ctx, test.filter, test.limit)
+			if err != nil {
+				t.Fatalf("QueryFileSnapshots: %v", err)
+			}
+			if !reflect.DeepEqual(paths, test.expectedPaths) {
+				t.Errorf("expected paths %v but got %v", test.expectedPaths, paths)
+			}
+			if count != test.expectedCount {
+				t.Errorf("expected count %v but got %v", test.expectedCount, count)
+			}
+		})
+	}
+
+	deleted, err := s.LibraryManager.DeleteFileSnapshots(ctx, []string{"/media/library1/big.mkv", "/media/library1/missing.mkv"})
+	if err != nil {
+		t.Fatalf("DeleteFileSnapshots: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 snapshot to be deleted but got %v", deleted)
+	}
+	if modtimes, err = s.LibraryManager.FileSnapshotModtimes(ctx, 1); err != nil {
+		t.Fatalf("FileSnapshotModtimes: %v", err)
+	} else if _, ok := modtimes["/media/library1/big.mkv"]; ok || len(modtimes) != 2 {
+		t.Errorf("expected the deleted snapshot to be gone but got %v", modtimes)
+	}
+
+	// Purging a library deletes its snapshots.
+	if _, err = s.LibraryManager.PurgeDeletedLibraries(ctx, timestamp(5)); err != nil {
+		t.Fatalf("PurgeDeletedLibraries: %v", err)
+	}
+	if modtimes, err = s.LibraryManager.FileSnapshotModtimes(ctx, 3); err != nil {
+		t.Fatalf("FileSnapshotModtimes: %v", err)
+	} else if len(modtimes) != 0 {
+		t.Errorf("expected the snapshots of the purged library to be deleted but got %v", modtimes)
+	}
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"reflect"
+	"strings"
 	"time"
 )
 
@@ -10,10 +11,44 @@ type UUID string
 
 // Job represents a job to be carried out by a Runner.
 type Job struct {
-	UUID     UUID         `json:"uuid"`
-	Path     string       `json:"path"`
-	Command  []string     `json:"command"`
-	Metadata FileMetadata `json:"metadata"`
+	UUID      UUID         `json:"uuid"`
+	LibraryID int          `json:"library_id"`
+	Path      string       `json:"path"`
+	Command   []string     `json:"command"`
+	Metadata  FileMetadata `json:"metadata"`
+
+	// Group identifies the multi-part set (ex. CD1/CD2) that the job belongs to, if any.
+	// GroupSize is the number of files in the set, which includes any parts that never get a job (ex. masked out).
+	Group     string `json:"group,omitempty"`
+	GroupSize int    `json:"group_size,omitempty"`
+
+	// Annotations are arbitrary key/value pairs for external tooling (ex. the system or request that the file came from).
+	// They aren't used by the Controller, but are passed along with the job to the events about it.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Size is the size of the source file in bytes when the job was queued. It is zero for jobs which were queued before
+	// sizes were recorded.
+	Size int64 `json:"size,omitempty"`
+
+	// CaptionsPath is where the closed captions extracted by the job's command are saved alongside the
+	// transcoded file. It is empty if the command doesn't extract captions.
+	CaptionsPath string `json:"captions_path,omitempty"`
+
+	// QueuedAt is when the job was first added to a library's queue. It is kept when the job is requeued, so that the
+	// job doesn't lose the priority it gained while waiting. It is zero for jobs which were queued before it was recorded.
+	QueuedAt time.Time `json:"queued_at"`
+
+	// Benchmark is set if the job is a benchmark, whose transcoded file is thrown away instead of replacing the original.
+	Benchmark *Benchmark `json:"benchmark,omitempty"`
+}
+
+// EffectivePriority returns the priority of j in a library with the provided priority, raised by agingPerDay for every
+// day that j has been queued as of now. Jobs without a QueuedAt don't age.
+func (j Job) EffectivePriority(libraryPriority int, agingPerDay float64, now time.Time) float64 {
+	if agingPerDay <= 0 || j.QueuedAt.IsZero() || !now.After(j.QueuedAt) {
+		return float64(libraryPriority)
+	}
+	return float64(libraryPriority) + agingPerDay*now.Sub(j.QueuedAt).Hours()/24
 }
 
 // CompletedJob represents a job that has been completed by a Runner.
@@ -22,6 +57,13 @@ type CompletedJob struct {
 	Failed  bool    `json:"failed"`
 	History History `json:"history"`
 	InFile  string  `json:"-"`
+
+	// CaptionsFile is the intermediate file that holds the closed captions received from the Runner, if any.
+	CaptionsFile string `json:"-"`
+
+	// Benchmark is what the Runner measured if the job was a benchmark. Runners from before benchmarks were introduced
+	// don't send it, and upload the transcoded file instead.
+	Benchmark *BenchmarkStats `json:"benchmark,omitempty"`
 }
 
 // History represents a previously completed job.
@@ -30,15 +72,493 @@ type History struct {
 	DateTimeCompleted time.Time `json:"datetime_completed"`
 	Warnings          []string  `json:"warnings"`
 	Errors            []string  `json:"errors"`
+
+	// The following fields are filled in by the Controller when the job is imported.
+	UUID   UUID   `json:"-"`
+	Runner string `json:"-"`
+	Failed bool   `json:"-"`
+	Job    Job    `json:"-"`
+
+	// LibraryFolder is the folder of the job's library. It is only filled in once the library has been purged,
+	// so that the entry can still be attributed to it.
+	LibraryFolder string `json:"-"`
+
+	// Output is what the Controller read back from the transcoded file before importing it. It is nil if the file
+	// wasn't read, like when the Runner reported the job as failed.
+	Output *OutputStats `json:"-"`
+
+	// Completion breaks down what the job changed about the file. It is nil unless the transcoded file was imported.
+	Completion *CompletionRecord `json:"-"`
+
+	// OriginalPath is where the original file was kept when the transcoded file was imported. It is empty if the
+	// original was replaced.
+	OriginalPath string `json:"-"`
+
+	// OriginalRestored is whether the kept original file was moved back into place from the trash.
+	OriginalRestored bool `json:"-"`
+}
+
+// OutputStats describes the transcoded file of a completed job.
+type OutputStats struct {
+	VideoCodec string  `json:"video_codec"` // Codec of the first video track. Empty if the file doesn't have one.
+	Duration   float32 `json:"duration"`    // In seconds
+	Size       int64   `json:"size"`        // In bytes
+	Bitrate    int64   `json:"bitrate"`     // Overall bitrate in bits per second, calculated from the size and duration.
+}
+
+// CompletionRecord breaks down what an imported job changed about its file.
+type CompletionRecord struct {
+	OriginalSize int64         `json:"original_size"` // In bytes
+	NewSize      int64         `json:"new_size"`      // In bytes
+	SavedBytes   int64         `json:"saved_bytes"`   // Negative when the file got larger.
+	SavedPercent float64       `json:"saved_percent"` // Percentage of OriginalSize that was saved. Negative when the file got larger.
+	Elapsed      time.Duration `json:"elapsed"`       // How long the Runner took, as last reported by it. Zero if it is unknown.
+	Encoder      string        `json:"encoder"`       // Video encoder passed to FFmpeg (ex. "libx265" or "copy"). Empty if the command doesn't set one.
+	SourceCodec  string        `json:"source_codec"`  // Codec of the first video track of the original file.
+	TargetCodec  string        `json:"target_codec"`  // Codec of the first video track of the transcoded file. Empty if it wasn't read back.
+}
+
+// NewCompletionRecord returns a CompletionRecord with the savings of replacing a file of originalSize bytes with one
+// of newSize bytes. The percentage is zero if originalSize is zero, since there was nothing to save.
+func NewCompletionRecord(originalSize, newSize int64) CompletionRecord {
+	r := CompletionRecord{OriginalSize: originalSize, NewSize: newSize, SavedBytes: originalSize - newSize}
+	if originalSize > 0 {
+		r.SavedPercent = float64(r.SavedBytes) / float64(originalSize) * 100
+	}
+	return r
+}
+
+// Runner represents a Runner that has connected to the Controller at some point.
+type Runner struct {
+	UUID          UUID      `json:"uuid"`
+	Name          string    `json:"name"`         // The name that the Runner identifies itself with.
+	DisplayName   string    `json:"display_name"` // The name shown to the user. Defaults to Name.
+	Version       string    `json:"version"`
+	LastSeen      time.Time `json:"last_seen"`
+	JobsCompleted int       `json:"jobs_completed"`
+	JobsFailed    int       `json:"jobs_failed"`
 }
 
 // DispatchedJob represents a job that is currently being worked on by a Runner.
+//
+// The Runner holds a lease on the job, which it renews with every status update. The job is only taken away from
+// the Runner once the lease has expired. LeaseExpires is measured by the Controller's clock, so a Runner's clock never
+// has to agree with it.
 type DispatchedJob struct {
-	UUID        UUID      `json:"uuid"`
-	Runner      string    `json:"runner"`
-	Job         Job       `json:"job"`
-	Status      JobStatus `json:"status"`
-	LastUpdated time.Time `json:"last_updated"`
+	UUID          UUID          `json:"uuid"`
+	Runner        string        `json:"runner"`
+	Job           Job           `json:"job"`
+	Status        JobStatus     `json:"status"`
+	LastUpdated   time.Time     `json:"last_updated"`
+	LeaseDuration time.Duration `json:"lease_duration"` // Negotiated with the Runner when the job is dispatched.
+	LeaseExpires  time.Time     `json:"lease_expires"`
+}
+
+// RenewLease returns a copy of d with its lease extended to LeaseDuration after now. Jobs which were dispatched
+// before leases were introduced don't have a lease to renew, so they are returned unchanged.
+func (d DispatchedJob) RenewLease(now time.Time) DispatchedJob {
+	if d.LeaseDuration > 0 {
+		d.LeaseExpires = now.Add(d.LeaseDuration)
+	}
+	return d
+}
+
+// HeldGroupPart is a completed part of a multi-part set which is held until the rest of its set has completed, so that
+// the set is replaced together.
+type HeldGroupPart struct {
+	Completed  CompletedJob
+	Dispatched DispatchedJob
+}
+
+// QuarantinedJob represents a job that failed too many times to be retried automatically.
+type QuarantinedJob struct {
+	Job                 Job       `json:"job"`
+	Attempts            int       `json:"attempts"`
+	Reason              string    `json:"reason"`
+	DateTimeQuarantined time.Time `json:"datetime_quarantined"`
+}
+
+// DatastoreHealth is whether or not the Library Manager can reach the datastore.
+type DatastoreHealth struct {
+	// Down is set once the datastore has failed to be reached enough times in a row to open the circuit breaker,
+	// and is cleared as soon as it is reached again.
+	Down bool `json:"down"`
+
+	// Failures is how many times in a row the datastore couldn't be reached, since FailingSince. LastError is the
+	// error of the latest failure.
+	Failures     int       `json:"failures"`
+	FailingSince time.Time `json:"failing_since"`
+	LastError    string    `json:"last_error"`
+}
+
+// DispatchPlan is the order in which the queued jobs are expected to be dispatched.
+type DispatchPlan struct {
+	// Positions holds the position of each queued job in the order of all the libraries, starting at 1, keyed by UUID.
+	// The jobs of drained libraries and the ones too far down the order don't have a position.
+	Positions map[UUID]int
+
+	// Paused is whether or not jobs aren't being dispatched at the moment, like when processing is disabled.
+	Paused bool
+
+	// TypicalJobDuration is a moving average of how long the completed jobs took. It is zero until a job completes.
+	TypicalJobDuration time.Duration
+}
+
+// SkippedPath is a file which was completed outside of Encodarr, so scans never queue it. Unlike a QuarantinedJob,
+// it isn't a failure and it doesn't expire.
+type SkippedPath struct {
+	Path            string    `json:"path"`
+	DateTimeSkipped time.Time `json:"datetime_skipped"`
+}
+
+// Benchmark describes a benchmark job. The Runner downloads and transcodes the file like any other job, but the
+// transcoded file is thrown away, so the original is never touched.
+type Benchmark struct {
+	Runner   string `json:"runner,omitempty"` // The Runner that the job must be dispatched to. Empty for the first one that asks.
+	Settings string `json:"settings"`         // The CommandDeciderSettings that the command was decided with.
+}
+
+// BenchmarkRequest is a request from the user to benchmark the file at Path. The command is decided with Settings, or
+// with the settings of the library if Settings is empty.
+type BenchmarkRequest struct {
+	UUID      UUID
+	Path      string
+	LibraryID int
+	Settings  string
+	Runner    string // Empty for the first Runner that asks for a job.
+}
+
+// BenchmarkStats is what a Runner measured while running a benchmark job.
+type BenchmarkStats struct {
+	Elapsed       time.Duration `json:"elapsed"`
+	FPS           float64       `json:"fps"`            // Average frames per second of the whole transcode.
+	ProjectedSize int64         `json:"projected_size"` // Size in bytes of the transcoded file before it was thrown away.
+}
+
+// BenchmarkResult is the outcome of a benchmark job. Benchmarks are kept apart from the history, so they don't count
+// towards any statistics.
+type BenchmarkResult struct {
+	UUID              UUID      `json:"uuid"`
+	Path              string    `json:"path"`
+	LibraryID         int       `json:"library_id"`
+	Runner            string    `json:"runner"`
+	Settings          string    `json:"settings"`
+	Command           []string  `json:"command"`
+	Failed            bool      `json:"failed"`
+	Errors            []string  `json:"errors"`
+	SourceSize        int64     `json:"source_size"` // In bytes
+	DateTimeCompleted time.Time `json:"datetime_completed"`
+
+	// The following fields are zero if the Runner didn't report them (ex. the job failed before it was run).
+	Elapsed       time.Duration `json:"elapsed"`
+	FPS           float64       `json:"fps"`
+	ProjectedSize int64         `json:"projected_size"`
+}
+
+// ValidationSeverity describes how serious a ValidationIssue is.
+type ValidationSeverity string
+
+const (
+	// ValidationError is used for issues which will prevent a library from working.
+	ValidationError ValidationSeverity = "error"
+
+	// ValidationWarning is used for issues which may cause unexpected behavior, but don't prevent a library from working.
+	ValidationWarning ValidationSeverity = "warning"
+)
+
+// ValidationIssue represents a single problem found while validating a library.
+type ValidationIssue struct {
+	Severity ValidationSeverity `json:"severity"`
+	Field    string             `json:"field"` // The JSON name of the library field that the issue is about.
+	Message  string             `json:"message"`
+}
+
+// SecretSetting names a sensitive setting. Secrets are encrypted at rest and never returned by the settings API.
+type SecretSetting string
+
+const (
+	// SecretWebhookSigningSecret is used to sign the bodies of webhook notifications.
+	SecretWebhookSigningSecret SecretSetting = "webhook_signing_secret"
+
+	// SecretSMTPPassword is the password for the SMTP server that email notifications are sent through.
+	SecretSMTPPassword SecretSetting = "smtp_password"
+
+	// SecretRunnerToken is the token that Runners authenticate with.
+	SecretRunnerToken SecretSetting = "runner_token"
+
+	// SecretMediaServerToken is the token that the Controller authenticates with to the media server (ex. a Plex token or a Jellyfin API key).
+	SecretMediaServerToken SecretSetting = "media_server_token"
+)
+
+// SecretSettings lists every SecretSetting.
+var SecretSettings = []SecretSetting{SecretWebhookSigningSecret, SecretSMTPPassword, SecretRunnerToken, SecretMediaServerToken}
+
+// notificationWebhookPrefix is the prefix of the secrets which hold the webhook URLs of the notification channels.
+const notificationWebhookPrefix = "notification_webhook:"
+
+// NotificationWebhookSecret returns the SecretSetting which holds the webhook URL of the notification channel with the
+// provided name. The URLs are secrets because anyone who knows one can post to the channel.
+func NotificationWebhookSecret(channel string) SecretSetting {
+	return SecretSetting(notificationWebhookPrefix + channel)
+}
+
+// NotificationWebhookChannel returns the name of the notification channel whose webhook URL is held by the provided
+// SecretSetting, and whether or not it holds one at all.
+func NotificationWebhookChannel(name SecretSetting) (string, bool) {
+	channel := strings.TrimPrefix(string(name), notificationWebhookPrefix)
+	return channel, channel != "" && channel != string(name)
+}
+
+// notificationTokenPrefix is the prefix of the secrets which hold the access tokens of the ntfy and Gotify channels.
+const notificationTokenPrefix = "notification_token:"
+
+// NotificationTokenSecret returns the SecretSetting which holds the access token of the notification channel with the
+// provided name (a Gotify application token, or an ntfy access token for protected topics).
+func NotificationTokenSecret(channel string) SecretSetting {
+	return SecretSetting(notificationTokenPrefix + channel)
+}
+
+// NotificationTokenChannel returns the name of the notification channel whose access token is held by the provided
+// SecretSetting, and whether or not it holds one at all.
+func NotificationTokenChannel(name SecretSetting) (string, bool) {
+	channel := strings.TrimPrefix(string(name), notificationTokenPrefix)
+	return channel, channel != "" && channel != string(name)
+}
+
+// MediaServerType is the kind of media server that is told to rescan the folders of replaced files.
+type MediaServerType string
+
+const (
+	// MediaServerNone disables the media server integration.
+	MediaServerNone     MediaServerType = ""
+	MediaServerPlex     MediaServerType = "plex"
+	MediaServerJellyfin MediaServerType = "jellyfin"
+	MediaServerEmby     MediaServerType = "emby"
+)
+
+// Valid returns whether or not t is a known MediaServerType.
+func (t MediaServerType) Valid() bool {
+	switch t {
+	case MediaServerNone, MediaServerPlex, MediaServerJellyfin, MediaServerEmby:
+		return true
+	default:
+		return false
+	}
+}
+
+// MediaServer is the media server which is told to rescan the folder of every file that a transcoded file replaces.
+// Its token is the SecretMediaServerToken.
+type MediaServer struct {
+	Type MediaServerType `json:"type"`
+	URL  string          `json:"url"` // The base URL of the server (ex. http://plex:32400).
+}
+
+// EventType identifies the kind of an Event.
+type EventType string
+
+const (
+	// EventLibraryComplete is emitted when the last outstanding job of a library completes and its queue is empty.
+	EventLibraryComplete EventType = "library_complete"
+
+	// EventJobCompleted is emitted when the transcoded file of a job replaces the original.
+	EventJobCompleted EventType = "job_completed"
+
+	// EventJobFailed is emitted when a Runner reports a job as failed or its transcoded file is rejected.
+	EventJobFailed EventType = "job_failed"
+
+	// EventJobStale is emitted when a dispatched job whose stale job action is StaleJobNotify stops being updated.
+	EventJobStale EventType = "job_stale"
+
+	// EventJobAwaitingSpace is emitted when a completed job can't be imported because its library is out of space.
+	EventJobAwaitingSpace EventType = "job_awaiting_space"
+
+	// EventRunnerOffline is emitted when a Runner misses its heartbeats for longer than the offline threshold.
+	EventRunnerOffline EventType = "runner_offline"
+
+	// EventNoRunners is emitted when no Runner has been seen for longer than the no runners alert period while jobs are queued.
+	EventNoRunners EventType = "no_runners"
+
+	// EventDailyDigest is emitted once a day, or once a week if the digest is weekly, with a summary of the jobs which
+	// were completed since the last one.
+	EventDailyDigest EventType = "daily_digest"
+
+	// EventJobCompletionDigest is sent in place of the job_completed events of a notification channel or library webhook
+	// with a CompletionDigest, once its window ends. It isn't subscribed to, so it isn't one of the EventTypes.
+	EventJobCompletionDigest EventType = "job_completion_digest"
+)
+
+// EventTypes lists every EventType.
+var EventTypes = []EventType{EventLibraryComplete, EventJobCompleted, EventJobFailed, EventJobStale, EventJobAwaitingSpace, EventRunnerOffline, EventNoRunners, EventDailyDigest}
+
+// Valid returns whether or not t is a known EventType.
+func (t EventType) Valid() bool {
+	for _, v := range EventTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// AboutLibrary returns whether or not the events of type t are about a library or one of its jobs, so that they are
+// sent to the webhooks of the library.
+func (t EventType) AboutLibrary() bool {
+	switch t {
+	case EventLibraryComplete, EventJobCompleted, EventJobFailed, EventJobStale, EventJobAwaitingSpace:
+		return true
+	default:
+		return false
+	}
+}
+
+// Event represents something that happened in the Controller that the user may want to be notified about.
+type Event struct {
+	Type      EventType `json:"type"`
+	LibraryID int       `json:"library_id"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+
+	Annotations map[string]string `json:"annotations,omitempty"` // The annotations of the job that the event is about, if any.
+
+	// The job and Runner that the event is about, if any.
+	JobUUID UUID   `json:"job_uuid,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Runner  string `json:"runner,omitempty"`
+
+	// BytesSaved is how much smaller the transcoded files are than their originals, for the job_completed, daily_digest
+	// and job_completion_digest events.
+	BytesSaved int64 `json:"bytes_saved,omitempty"`
+
+	// Digest is the summary of a daily_digest event.
+	Digest *DigestSummary `json:"digest,omitempty"`
+
+	// Completions are the batched job_completed events of a job_completion_digest event.
+	Completions *CompletionDigest `json:"completions,omitempty"`
+}
+
+// CompletionDigest is the summary of the job_completed events which a job_completion_digest event replaces.
+type CompletionDigest struct {
+	Since      time.Time             `json:"since"` // When the first of the events was batched.
+	Count      int                   `json:"count"`
+	BytesSaved int64                 `json:"bytes_saved"`
+	Jobs       []CompletionDigestJob `json:"jobs"`
+}
+
+// CompletionDigestJob is one of the completed jobs of a CompletionDigest.
+type CompletionDigestJob struct {
+	LibraryID  int    `json:"library_id"`
+	JobUUID    UUID   `json:"job_uuid"`
+	Path       string `json:"path"`
+	BytesSaved int64  `json:"bytes_saved"`
+}
+
+// DigestSummary is what happened since the previous digest and where the queues stand.
+type DigestSummary struct {
+	Period     string    `json:"period"` // daily or weekly
+	Since      time.Time `json:"since"`
+	Completed  int       `json:"completed"`
+	Failed     int       `json:"failed"`
+	BytesSaved int64     `json:"bytes_saved"`
+
+	Queued          int   `json:"queued"`            // Jobs waiting in the library queues.
+	Dispatched      int   `json:"dispatched"`        // Jobs being worked on by Runners.
+	TotalBytesSaved int64 `json:"total_bytes_saved"` // Saved by every job in the history.
+}
+
+// NotificationSenderType is the kind of service that a notification channel posts to.
+type NotificationSenderType string
+
+const (
+	NotificationDiscord NotificationSenderType = "discord"
+	NotificationSlack   NotificationSenderType = "slack"
+	NotificationEmail   NotificationSenderType = "email"
+	NotificationNtfy    NotificationSenderType = "ntfy"
+	NotificationGotify  NotificationSenderType = "gotify"
+)
+
+// Valid returns whether or not t is a known NotificationSenderType.
+func (t NotificationSenderType) Valid() bool {
+	switch t {
+	case NotificationDiscord, NotificationSlack, NotificationEmail, NotificationNtfy, NotificationGotify:
+		return true
+	default:
+		return false
+	}
+}
+
+// NotificationChannel is an incoming webhook, a list of email recipients, or a push notification server that the events
+// of the listed types are sent to. The URL of a webhook is the NotificationWebhookSecret of its Name, and the token of
+// an ntfy or Gotify server is its NotificationTokenSecret.
+type NotificationChannel struct {
+	Name   string                 `json:"name"`
+	Type   NotificationSenderType `json:"type"`
+	Events []EventType            `json:"events"`
+
+	// Recipients are the addresses that an email channel sends to.
+	Recipients []string `json:"recipients,omitempty"`
+
+	// Server is the URL of the ntfy or Gotify server that the channel publishes to, and Topic is the ntfy topic.
+	Server string `json:"server,omitempty"`
+	Topic  string `json:"topic,omitempty"`
+
+	// Template is the text/template that the message is made from, with the Event as its data. An empty Template uses
+	// "[{{.Type}}] {{.Message}}".
+	Template string `json:"template,omitempty"`
+
+	// CompletionDigest is a duration (ex. 15m) that the job_completed events are batched over before a single
+	// job_completion_digest message summarizes them. An empty CompletionDigest sends every event on its own.
+	CompletionDigest string `json:"completion_digest,omitempty"`
+}
+
+// Notifications are where the events are sent besides the log.
+type Notifications struct {
+	Channels []NotificationChannel `json:"channels"`
+
+	// DigestTime is the local time of day (ex. 08:00) that the daily_digest event is emitted at. An empty DigestTime disables it.
+	DigestTime string `json:"digest_time,omitempty"`
+
+	// DigestWeekday makes the digest weekly, on the named day (ex. monday). An empty DigestWeekday emits it every day.
+	DigestWeekday string `json:"digest_weekday,omitempty"`
+
+	// SMTP is the server that email channels send through. Its password is the SecretSMTPPassword.
+	SMTP *SMTPSettings `json:"smtp,omitempty"`
+
+	// WebURL is the address that the web interface is reached at (ex. http://encodarr.lan:8123). Push notifications
+	// about a job open its details there when they are clicked. An empty WebURL leaves them without a link.
+	WebURL string `json:"web_url,omitempty"`
+}
+
+// SMTPSettings describe the server that email notifications are sent through.
+type SMTPSettings struct {
+	Host     string      `json:"host"`
+	Port     int         `json:"port"`
+	Username string      `json:"username,omitempty"` // Empty if the server doesn't require authentication.
+	From     string      `json:"from"`
+	TLS      SMTPTLSMode `json:"tls"`
+}
+
+// SMTPTLSMode is how the connection to the SMTP server is secured.
+type SMTPTLSMode string
+
+const (
+	// SMTPStartTLS upgrades a plain connection with STARTTLS, usually on port 587. It is used if the mode is empty.
+	SMTPStartTLS SMTPTLSMode = "starttls"
+
+	// SMTPImplicitTLS connects with TLS from the start, usually on port 465.
+	SMTPImplicitTLS SMTPTLSMode = "tls"
+
+	// SMTPNoTLS doesn't secure the connection. Authentication is refused unless the server is on localhost.
+	SMTPNoTLS SMTPTLSMode = "none"
+)
+
+// Valid returns whether or not m is a known SMTPTLSMode.
+func (m SMTPTLSMode) Valid() bool {
+	switch m {
+	case "", SMTPStartTLS, SMTPImplicitTLS, SMTPNoTLS:
+		return true
+	default:
+		return false
+	}
 }
 
 // JobStatus represents the current status of a dispatched job.
@@ -51,15 +571,210 @@ type JobStatus struct {
 	StageEstimatedTimeRemaining string `json:"stage_estimated_time_remaining"`
 }
 
+// QueueOrder is the order in which a library scan queues the files that it discovers.
+type QueueOrder string
+
+const (
+	// QueueByPath queues files in the order that they are found in the library's folder.
+	QueueByPath QueueOrder = "path"
+
+	// QueueOldestFirst queues the files with the oldest modtimes first.
+	QueueOldestFirst QueueOrder = "oldest-first"
+
+	// QueueNewestFirst queues the files with the newest modtimes first, so that recently added files are ready soonest.
+	QueueNewestFirst QueueOrder = "newest-first"
+)
+
+// Valid returns whether or not o is a known QueueOrder. An empty QueueOrder is valid and means QueueByPath.
+func (o QueueOrder) Valid() bool {
+	switch o {
+	case "", QueueByPath, QueueOldestFirst, QueueNewestFirst:
+		return true
+	default:
+		return false
+	}
+}
+
+// StaleJobAction is what the health checker does with a dispatched job that its Runner stopped updating.
+type StaleJobAction string
+
+const (
+	// StaleJobRequeue takes the job away from its Runner and puts it back in its library's queue.
+	StaleJobRequeue StaleJobAction = "requeue"
+
+	// StaleJobFail takes the job away from its Runner and counts it as a failed attempt, so it is quarantined
+	// once MaxJobAttempts is reached.
+	StaleJobFail StaleJobAction = "fail"
+
+	// StaleJobNotify leaves the job with its Runner and only notifies the user, which suits very long transcodes.
+	StaleJobNotify StaleJobAction = "notify"
+)
+
+// Valid returns whether or not a is a known StaleJobAction. An empty StaleJobAction is valid and means
+// the global StaleJobAction setting.
+func (a StaleJobAction) Valid() bool {
+	switch a {
+	case "", StaleJobRequeue, StaleJobFail, StaleJobNotify:
+		return true
+	default:
+		return false
+	}
+}
+
+// OriginalFileHandling is what happens to an original file when the transcoded file of its job is imported.
+type OriginalFileHandling string
+
+const (
+	// OriginalReplace deletes the original file, which is replaced by the transcoded file.
+	OriginalReplace OriginalFileHandling = "replace"
+
+	// OriginalKeepRenamed keeps the original file next to the transcoded file as "<name>.original.<ext>".
+	OriginalKeepRenamed OriginalFileHandling = "keep-renamed"
+
+	// OriginalMoveToFolder moves the original file into the library's originals folder, keeping its path relative
+	// to the library's folder.
+	OriginalMoveToFolder OriginalFileHandling = "move-to-folder"
+
+	// OriginalMoveToTrash moves the original file into the trash folder, where it can be restored until it is deleted
+	// by the trash's retention.
+	OriginalMoveToTrash OriginalFileHandling = "move-to-trash"
+)
+
+// Valid returns whether or not h is a known OriginalFileHandling. An empty OriginalFileHandling is valid and means
+// OriginalReplace.
+func (h OriginalFileHandling) Valid() bool {
+	switch h {
+	case "", OriginalReplace, OriginalKeepRenamed, OriginalMoveToFolder, OriginalMoveToTrash:
+		return true
+	default:
+		return false
+	}
+}
+
+// StaleJobSettings are a library's overrides of the global stale job settings.
+type StaleJobSettings struct {
+	Timeout time.Duration  // Zero uses the HealthCheckTimeout setting.
+	Action  StaleJobAction // Empty uses the StaleJobAction setting.
+}
+
+// StaleJob is a dispatched job which the health checker took away from its Runner.
+type StaleJob struct {
+	DispatchedJob DispatchedJob
+	Action        StaleJobAction // Either StaleJobRequeue or StaleJobFail.
+	Reason        string
+}
+
+// HealthCheckAction records what the health checker did with a dispatched job whose lease expired.
+type HealthCheckAction struct {
+	Time      time.Time      `json:"time"`
+	JobUUID   UUID           `json:"job_uuid"`
+	Runner    string         `json:"runner"`
+	Path      string         `json:"path"`
+	LibraryID int            `json:"library_id"`
+	Action    StaleJobAction `json:"action"` // StaleJobNotify means that the job was left with its Runner.
+	Reason    string         `json:"reason"`
+}
+
+// JobEvent is a log record about a job, which is kept so that the timeline of the job can be assembled from it.
+type JobEvent struct {
+	Time      time.Time `json:"time"`
+	JobUUID   UUID      `json:"job_uuid"`
+	LibraryID int       `json:"library_id"` // -1 if the record didn't name the library of the job.
+	Component string    `json:"component"`  // The part of the Controller which logged it (ex. library.Manager).
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+}
+
 // Library represents a single library.
 type Library struct {
-	ID                     int           `json:"id"`
-	Folder                 string        `json:"folder"`
-	Priority               int           `json:"priority"`
-	FsCheckInterval        time.Duration `json:"fs_check_interval"`
-	Queue                  LibraryQueue  `json:"queue"`
-	PathMasks              []string      `json:"path_masks"`
-	CommandDeciderSettings string        `json:"command_decider_settings"` // We are using a string for the CommandDecider settings because it is easier for the frontend to convert back and forth from when setting and reading values.
+	ID                      int                  `json:"id"`
+	Folder                  string               `json:"folder"`
+	Priority                int                  `json:"priority"`
+	FsCheckInterval         time.Duration        `json:"fs_check_interval"`
+	Queue                   LibraryQueue         `json:"queue"`
+	PathMasks               []string             `json:"path_masks"`
+	MultiPartPatterns       []string             `json:"multi_part_patterns"`       // Regular expressions used to recognize multi-part files. Grouping is disabled when empty.
+	SkipUnchanged           bool                 `json:"skip_unchanged"`            // Skip files which haven't been modified since a job for them was last completed.
+	VerificationCommand     []string             `json:"verification_command"`      // Command which is run with the source and output paths appended before a transcode is imported. A non-zero exit rejects the transcode.
+	ScanOnStartup           bool                 `json:"scan_on_startup"`           // Scan as soon as the Controller starts instead of waiting for FsCheckInterval to elapse.
+	QueueOrder              QueueOrder           `json:"queue_order"`               // Order in which a scan queues the files it discovers. Empty is the same as QueueByPath.
+	StaleJobTimeout         time.Duration        `json:"stale_job_timeout"`         // How long a dispatched job may go without a status update before it is stale. Zero uses the HealthCheckTimeout setting.
+	StaleJobAction          StaleJobAction       `json:"stale_job_action"`          // What to do with the library's stale jobs. Empty uses the StaleJobAction setting.
+	MetadataReadConcurrency int                  `json:"metadata_read_concurrency"` // How many files a scan reads the metadata of at once. Zero uses the global limit, which also caps every library.
+	MaxQueuedBytes          int64                `json:"max_queued_bytes"`          // Scans stop queuing once the source files of the queued jobs add up to more than this many bytes. Zero is unlimited.
+	OriginalFileHandling    OriginalFileHandling `json:"original_file_handling"`    // What happens to an original file when its transcoded file is imported. Empty is the same as OriginalReplace.
+	PreserveModtime         bool                 `json:"preserve_modtime"`          // Give a transcoded file the modtime of the original it replaces instead of the time it was imported.
+	MoveSidecars            bool                 `json:"move_sidecars"`             // Rename the sidecar files (ex. subtitles) of an original along with it when its transcoded file has a different name.
+	Notifications           LibraryNotifications `json:"notifications"`             // Webhooks which receive the events about the library and its jobs.
+	MetadataReadTimeout     time.Duration        `json:"metadata_read_timeout"`     // How long reading the metadata of one of the library's files may take. Zero uses the global timeouts.
+	MetadataReadArgs        []string             `json:"metadata_read_args"`        // Extra arguments passed to the metadata reader for the library's files instead of the global ones. Empty uses the global ones.
+	CommandDeciderSettings  string               `json:"command_decider_settings"`  // We are using a string for the CommandDecider settings because it is easier for the frontend to convert back and forth from when setting and reading values.
+	Version                 int                  `json:"version"`                   // Incremented by the data storer on every save. Zero means the library hasn't been saved yet.
+	DeletedAt               time.Time            `json:"deleted_at"`                // When the library was deleted. Zero unless the library is waiting to be purged.
+}
+
+// MetadataReadOptions returns the library's overrides of how the metadata of its files is read.
+func (l Library) MetadataReadOptions() MetadataReadOptions {
+	return MetadataReadOptions{Timeout: l.MetadataReadTimeout, Args: l.MetadataReadArgs}
+}
+
+// LibraryNotifications are the webhooks that the events about a library and its jobs are sent to.
+type LibraryNotifications struct {
+	Webhooks []LibraryWebhook `json:"webhooks"`
+
+	// ReplaceGlobal sends the events about the library only to its Webhooks instead of also to the global notification channels.
+	ReplaceGlobal bool `json:"replace_global"`
+}
+
+// LibraryWebhook is a Discord or Slack webhook that the events of the listed types about a library are sent to.
+// Unlike the URLs of the global notification channels, its URL is stored with the library instead of as a secret.
+type LibraryWebhook struct {
+	Type   NotificationSenderType `json:"type"`
+	URL    string                 `json:"url"`
+	Events []EventType            `json:"events"`
+
+	// Template is the text/template that the message is made from, the same as the Template of a NotificationChannel.
+	Template string `json:"template,omitempty"`
+
+	// CompletionDigest batches the job_completed events, the same as the CompletionDigest of a NotificationChannel.
+	CompletionDigest string `json:"completion_digest,omitempty"`
+}
+
+// SearchResult represents a single file that matched a filename search.
+type SearchResult struct {
+	Location  string `json:"location"`   // Where the match was found. Either "queue", "dispatched", or "history".
+	LibraryID int    `json:"library_id"` // -1 if the library is not known (ex. history entries recorded without their job).
+	UUID      UUID   `json:"uuid"`       // Empty if the job is not known (ex. history entries recorded without their job).
+	Path      string `json:"path"`
+	State     string `json:"state"`
+}
+
+// FileSnapshot is the latest metadata of a file in a library, as read by the last scan which found it changed.
+type FileSnapshot struct {
+	Path       string    `json:"path"`
+	LibraryID  int       `json:"library_id"`
+	VideoCodec string    `json:"video_codec"` // Codec of the first video track. Empty if the file doesn't have one.
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	Duration   float32   `json:"duration"`  // In seconds
+	Size       int64     `json:"size"`      // In bytes
+	Container  string    `json:"container"` // Lowercase extension of the file without the dot (ex. "mkv")
+	HDR        bool      `json:"hdr"`
+	Modtime    time.Time `json:"modtime"` // Modtime of the file when the metadata was read.
+}
+
+// FileSnapshotFilter selects file snapshots. A zero or nil field matches every snapshot.
+type FileSnapshotFilter struct {
+	LibraryID   *int
+	VideoCodec  string // Compared ignoring case.
+	Container   string // Compared ignoring case.
+	HDR         *bool
+	MinHeight   int
+	MaxHeight   int
+	MinSize     int64
+	MaxSize     int64
+	MinDuration float32
+	MaxDuration float32
 }
 
 // File represents a file for the purposes of metadata reading.
@@ -79,6 +794,26 @@ func (q *LibraryQueue) Push(item Job) {
 	q.Items = append(q.Items, item)
 }
 
+// PushNew appends the items whose paths aren't already in the LibraryQueue (or earlier in items)
+// and returns the ones which were appended.
+func (q *LibraryQueue) PushNew(items []Job) []Job {
+	paths := make(map[string]struct{}, len(q.Items)+len(items))
+	for _, i := range q.Items {
+		paths[i.Path] = struct{}{}
+	}
+
+	pushed := make([]Job, 0, len(items))
+	for _, item := range items {
+		if _, ok := paths[item.Path]; ok {
+			continue
+		}
+		paths[item.Path] = struct{}{}
+		q.Push(item)
+		pushed = append(pushed, item)
+	}
+	return pushed
+}
+
 // Pop removes and returns the first item of a LibraryQueue.
 func (q *LibraryQueue) Pop() (Job, error) {
 	if len(q.Items) == 0 {
@@ -138,3 +873,46 @@ func (j Job) Equal(check Job) bool {
 func (j Job) EqualPath(check Job) bool {
 	return j.Path == check.Path
 }
+
+// LogFields returns the fields which tie a log record to j, so that the record is part of j's timeline.
+func (j Job) LogFields() LogFields {
+	return LogFields{"library_id": j.LibraryID, "job_uuid": j.UUID}
+}
+
+// MetricsSnapshot is the value of every metric at a single point in time, keyed by the metric names.
+type MetricsSnapshot struct {
+	Time       time.Time                    `json:"time"`
+	Counters   map[string]float64           `json:"counters"`
+	Histograms map[string]HistogramSnapshot `json:"histograms"`
+}
+
+// HistogramSnapshot is the value of a histogram in a MetricsSnapshot. Like Prometheus, each bucket counts the
+// observations at or below its upper bound, including the ones in the buckets before it. The +Inf bucket is left out
+// because its count is always Count.
+type HistogramSnapshot struct {
+	Buckets []HistogramBucket `json:"buckets"`
+	Sum     float64           `json:"sum"`
+	Count   uint64            `json:"count"`
+}
+
+// HistogramBucket is a bucket of a HistogramSnapshot.
+type HistogramBucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+// LogFields are the structured fields of a log record, such as the library_id or job_uuid that it is about.
+// They are passed to a Logger after the arguments of the format string.
+type LogFields map[string]interface{}
+
+// SplitLogFields separates the LogFields at the end of the arguments of a Logger call, if there are any,
+// from the arguments of the format string.
+func SplitLogFields(i []interface{}) ([]interface{}, LogFields) {
+	if len(i) == 0 {
+		return i, nil
+	}
+	if f, ok := i[len(i)-1].(LogFields); ok {
+		return i[:len(i)-1], f
+	}
+	return i, nil
+}
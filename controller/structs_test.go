@@ -0,0 +1,34 @@
+package controller
+
+import "testing"
+
+func TestNewCompletionRecord(t *testing.T) {
+	tests := []struct {
+		name          string
+		originalSize  int64
+		newSize       int64
+		expectedBytes int64
+		expectedPct   float64
+	}{
+		{name: "Smaller output", originalSize: 1000, newSize: 600, expectedBytes: 400, expectedPct: 40},
+		{name: "Larger output", originalSize: 500, newSize: 700, expectedBytes: -200, expectedPct: -40},
+		{name: "Same size", originalSize: 800, newSize: 800, expectedBytes: 0, expectedPct: 0},
+		{name: "Empty original", originalSize: 0, newSize: 100, expectedBytes: -100, expectedPct: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewCompletionRecord(test.originalSize, test.newSize)
+
+			if r.OriginalSize != test.originalSize || r.NewSize != test.newSize {
+				t.Errorf("expected sizes %v and %v but got %v and %v", test.originalSize, test.newSize, r.OriginalSize, r.NewSize)
+			}
+			if r.SavedBytes != test.expectedBytes {
+				t.Errorf("expected %v saved bytes but got %v", test.expectedBytes, r.SavedBytes)
+			}
+			if r.SavedPercent != test.expectedPct {
+				t.Errorf("expected %v%% saved but got %v%%", test.expectedPct, r.SavedPercent)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Package tdarr reads the files that Tdarr has processed from an export of its database, so that a library can be
+// migrated to Encodarr without evaluating those files again.
+package tdarr
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	// Registers the "sqlite" database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+// Status is the outcome of Tdarr's transcode decision for a file (its TranscodeDecisionMaker field).
+type Status string
+
+const (
+	// StatusTranscoded is set once Tdarr has replaced the file with its transcoded version.
+	StatusTranscoded Status = "Transcode success"
+
+	// StatusErrored is set when Tdarr's transcode of the file failed.
+	StatusErrored Status = "Transcode error"
+)
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// File is a file in Tdarr's database.
+type File struct {
+	Path   string
+	Status Status
+}
+
+// fileDocument is the part of a Tdarr file document that File is read from. The path is the document's _id, and
+// is repeated in file.
+type fileDocument struct {
+	ID                     string `json:"_id"`
+	File                   string `json:"file"`
+	TranscodeDecisionMaker string `json:"TranscodeDecisionMaker"`
+}
+
+// Parse reads the files from an export of Tdarr's database. The export is either the SQLite database of Tdarr's
+// server (ex. server/Tdarr/DB2/SQL/database.db), or JSON with the documents of its files table as an array or as
+// an object keyed by their IDs.
+func Parse(r io.Reader) ([]File, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(b, sqliteHeader) {
+		return parseSQLite(b)
+	}
+	return parseJSON(b)
+}
+
+// parseJSON reads the files from the JSON documents in b.
+func parseJSON(b []byte) ([]File, error) {
+	var docs []fileDocument
+	if err := json.Unmarshal(b, &docs); err != nil {
+		var keyed map[string]fileDocument
+		if json.Unmarshal(b, &keyed) != nil {
+			return nil, fmt.Errorf("the export isn't a Tdarr database or JSON file documents: %w", err)
+		}
+		for _, doc := range keyed {
+			docs = append(docs, doc)
+		}
+	}
+
+	files := make([]File, 0, len(docs))
+	for _, doc := range docs {
+		if f, ok := doc.toFile(); ok {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// parseSQLite reads the files from the filejsondb table of the Tdarr database in b. The driver only opens databases
+// from files, so b is written to a temporary one first.
+func parseSQLite(b []byte) ([]File, error) {
+	f, err := os.CreateTemp("", "tdarr-*.db")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", f.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT json_data FROM filejsondb;")
+	if err != nil {
+		return nil, fmt.Errorf("reading the files table of the Tdarr database: %w", err)
+	}
+	defer rows.Close()
+
+	files := []File{}
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var doc fileDocument
+		if err = json.Unmarshal([]byte(data), &doc); err != nil {
+			return nil, fmt.Errorf("invalid file document in the Tdarr database: %w", err)
+		}
+		if f, ok := doc.toFile(); ok {
+			files = append(files, f)
+		}
+	}
+	return files, rows.Err()
+}
+
+// toFile returns the File of doc, or false if it doesn't have a path.
+func (doc fileDocument) toFile() (File, bool) {
+	path := doc.File
+	if path == "" {
+		path = doc.ID
+	}
+	return File{Path: path, Status: Status(doc.TranscodeDecisionMaker)}, path != ""
+}
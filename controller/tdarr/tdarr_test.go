@@ -0,0 +1,90 @@
+package tdarr
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	expected := []File{
+		{Path: "/mnt/media/a.mkv", Status: StatusTranscoded},
+		{Path: "/mnt/media/b.mkv", Status: StatusErrored},
+		{Path: "/mnt/media/c.mkv", Status: "Not required"},
+	}
+
+	tests := []struct {
+		name   string
+		export []byte
+	}{
+		{
+			name: "JSON Array",
+			export: []byte(`[
+				{"_id": "/mnt/media/a.mkv", "file": "/mnt/media/a.mkv", "TranscodeDecisionMaker": "Transcode success"},
+				{"_id": "/mnt/media/b.mkv", "file": "/mnt/media/b.mkv", "TranscodeDecisionMaker": "Transcode error"},
+				{"_id": "/mnt/media/c.mkv", "TranscodeDecisionMaker": "Not required"}
+			]`),
+		},
+		{
+			name: "JSON Object",
+			export: []byte(`{
+				"/mnt/media/a.mkv": {"file": "/mnt/media/a.mkv", "TranscodeDecisionMaker": "Transcode success"},
+				"/mnt/media/b.mkv": {"file": "/mnt/media/b.mkv", "TranscodeDecisionMaker": "Transcode error"},
+				"/mnt/media/c.mkv": {"file": "/mnt/media/c.mkv", "TranscodeDecisionMaker": "Not required"},
+				"empty": {}
+			}`),
+		},
+		{name: "SQLite", export: testDatabase(t)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, err := Parse(bytes.NewReader(test.export))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+			if !reflect.DeepEqual(files, expected) {
+				t.Errorf("expected %v but got %v", expected, files)
+			}
+		})
+	}
+
+	if _, err := Parse(bytes.NewReader([]byte("not an export"))); err == nil {
+		t.Errorf("expected an error for an invalid export")
+	}
+}
+
+// testDatabase returns a Tdarr database with the files of TestParse.
+func testDatabase(t *testing.T) []byte {
+	path := filepath.Join(t.TempDir(), "database.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stmt := range []string{
+		"CREATE TABLE filejsondb (id TEXT PRIMARY KEY, json_data TEXT, timecreated INTEGER, lastupdated INTEGER);",
+		`INSERT INTO filejsondb (id, json_data) VALUES ('/mnt/media/a.mkv', '{"_id": "/mnt/media/a.mkv", "file": "/mnt/media/a.mkv", "TranscodeDecisionMaker": "Transcode success"}');`,
+		`INSERT INTO filejsondb (id, json_data) VALUES ('/mnt/media/b.mkv', '{"_id": "/mnt/media/b.mkv", "file": "/mnt/media/b.mkv", "TranscodeDecisionMaker": "Transcode error"}');`,
+		`INSERT INTO filejsondb (id, json_data) VALUES ('/mnt/media/c.mkv', '{"_id": "/mnt/media/c.mkv", "file": "/mnt/media/c.mkv", "TranscodeDecisionMaker": "Not required"}');`,
+	} {
+		if _, err = db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
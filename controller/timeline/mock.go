@@ -0,0 +1,41 @@
+package timeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+type mockLogger struct{}
+
+func (m *mockLogger) Trace(s string, i ...interface{})    {}
+func (m *mockLogger) Debug(s string, i ...interface{})    {}
+func (m *mockLogger) Info(s string, i ...interface{})     {}
+func (m *mockLogger) Warn(s string, i ...interface{})     {}
+func (m *mockLogger) Error(s string, i ...interface{})    {}
+func (m *mockLogger) Critical(s string, i ...interface{}) {}
+
+// mockJobEventDataStorer keeps the saved events and the times that events were deleted before.
+type mockJobEventDataStorer struct {
+	mu            sync.Mutex
+	events        []controller.JobEvent
+	saves         int
+	deletedBefore []time.Time
+}
+
+func (m *mockJobEventDataStorer) SaveJobEvents(ctx context.Context, events []controller.JobEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, events...)
+	m.saves++
+	return nil
+}
+
+func (m *mockJobEventDataStorer) DeleteJobEventsBefore(ctx context.Context, t time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deletedBefore = append(m.deletedBefore, t)
+	return 0, nil
+}
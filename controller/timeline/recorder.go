@@ -0,0 +1,155 @@
+// Package timeline records the log records which are about a job, so that everything that happened to a job can be
+// looked up by its UUID.
+package timeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/logging"
+)
+
+const (
+	// bufferSize is how many events can wait to be saved before new ones are dropped.
+	bufferSize = 1024
+
+	// maxBatchSize is how many events are saved with a single call to the data storer.
+	maxBatchSize = 256
+
+	flushInterval = 2 * time.Second
+	pruneInterval = time.Hour
+)
+
+// NewRecorder returns a new Recorder which saves events to ds and deletes them once they are older than retention.
+// A retention of 0 keeps events forever.
+func NewRecorder(logger controller.Logger, ds controller.JobEventDataStorer, retention time.Duration) Recorder {
+	return Recorder{
+		logger:    logger,
+		ds:        ds,
+		retention: retention,
+		events:    make(chan controller.JobEvent, bufferSize),
+		dropped:   new(uint64),
+		now:       time.Now,
+	}
+}
+
+// Recorder turns the log records which carry a job_uuid field into JobEvents and saves them in batches.
+type Recorder struct {
+	logger    controller.Logger
+	ds        controller.JobEventDataStorer
+	retention time.Duration
+
+	events  chan controller.JobEvent
+	dropped *uint64
+
+	now func() time.Time
+}
+
+// Hook queues e to be saved if it is about a job. It is meant to be passed to logging.Root.AddHook and never blocks,
+// so events are dropped if the data storer can't keep up.
+func (r *Recorder) Hook(e logging.Entry) {
+	uuid, ok := e.Fields["job_uuid"]
+	if !ok || fmt.Sprint(uuid) == "" {
+		return
+	}
+
+	libraryID := -1
+	if id, ok := e.Fields["library_id"].(int); ok {
+		libraryID = id
+	}
+
+	select {
+	case r.events <- controller.JobEvent{
+		Time:      e.Time,
+		JobUUID:   controller.UUID(fmt.Sprint(uuid)),
+		LibraryID: libraryID,
+		Component: e.Component,
+		Level:     e.Level.String(),
+		Message:   e.Message,
+	}:
+	default:
+		atomic.AddUint64(r.dropped, 1)
+	}
+}
+
+// Start starts saving the queued events and deleting the expired ones without blocking the thread.
+// The events which are still queued when ctx is done are saved before the WaitGroup is released.
+func (r *Recorder) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		flushTicker := time.NewTicker(flushInterval)
+		defer flushTicker.Stop()
+		pruneTicker := time.NewTicker(pruneInterval)
+		defer pruneTicker.Stop()
+
+		r.prune(ctx)
+
+		batch := make([]controller.JobEvent, 0, maxBatchSize)
+		for {
+			select {
+			case <-ctx.Done():
+				// The context is already done, so the last events are saved without it
+				batch = r.drain(batch)
+				r.flush(context.Background(), batch)
+				return
+			case e := <-r.events:
+				batch = append(batch, e)
+				if len(batch) >= maxBatchSize {
+					batch = r.flush(ctx, batch)
+				}
+			case <-flushTicker.C:
+				batch = r.flush(ctx, batch)
+			case <-pruneTicker.C:
+				r.prune(ctx)
+			}
+		}
+	}()
+}
+
+// drain appends the events which are waiting in the channel to batch.
+func (r *Recorder) drain(batch []controller.JobEvent) []controller.JobEvent {
+	for {
+		select {
+		case e := <-r.events:
+			batch = append(batch, e)
+		default:
+			return batch
+		}
+	}
+}
+
+// flush saves batch and returns it emptied. A batch which can't be saved is dropped, because keeping it around
+// would only make the next save bigger.
+func (r *Recorder) flush(ctx context.Context, batch []controller.JobEvent) []controller.JobEvent {
+	if dropped := atomic.SwapUint64(r.dropped, 0); dropped > 0 {
+		r.logger.Warn("Dropped %v job events because they were logged faster than they could be saved", dropped)
+	}
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := r.ds.SaveJobEvents(ctx, batch); err != nil {
+		r.logger.Error("failed to save %v job events: %v", len(batch), err)
+	}
+	return batch[:0]
+}
+
+// prune deletes the events which are older than the retention.
+func (r *Recorder) prune(ctx context.Context) {
+	if r.retention <= 0 {
+		return
+	}
+
+	deleted, err := r.ds.DeleteJobEventsBefore(ctx, r.now().Add(-r.retention))
+	if err != nil {
+		r.logger.Error("failed to delete expired job events: %v", err)
+	} else if deleted > 0 {
+		r.logger.Debug("Deleted %v expired job events", deleted)
+	}
+}
@@ -0,0 +1,71 @@
+package timeline
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/logging"
+)
+
+func TestRecorder(t *testing.T) {
+	ds := &mockJobEventDataStorer{}
+	r := NewRecorder(&mockLogger{}, ds, 24*time.Hour)
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	r.Hook(logging.Entry{Time: now, Level: logging.LevelInfo, Component: "library.Manager", Message: "Scanned 3 files", Fields: controller.LogFields{"library_id": 1}})
+	r.Hook(logging.Entry{Time: now, Level: logging.LevelInfo, Component: "library.Manager", Message: "Queued job abc", Fields: controller.LogFields{"library_id": 0, "job_uuid": controller.UUID("abc")}})
+	r.Hook(logging.Entry{Time: now, Level: logging.LevelWarn, Component: "runnerCommunicator", Message: "Job abc failed", Fields: controller.LogFields{"job_uuid": "abc"}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	r.Start(ctx, &wg)
+	cancel()
+	wg.Wait()
+
+	expected := []controller.JobEvent{
+		{Time: now, JobUUID: "abc", LibraryID: 0, Component: "library.Manager", Level: "INFO", Message: "Queued job abc"},
+		{Time: now, JobUUID: "abc", LibraryID: -1, Component: "runnerCommunicator", Level: "WARNING", Message: "Job abc failed"},
+	}
+	if len(ds.events) != len(expected) {
+		t.Fatalf("expected only the records about a job to be saved but got %+v", ds.events)
+	}
+	for i, e := range expected {
+		if ds.events[i] != e {
+			t.Errorf("expected %+v but got %+v", e, ds.events[i])
+		}
+	}
+
+	if len(ds.deletedBefore) != 1 || !ds.deletedBefore[0].Equal(now.Add(-24*time.Hour)) {
+		t.Errorf("expected the events before %v to be deleted but got %v", now.Add(-24*time.Hour), ds.deletedBefore)
+	}
+}
+
+func TestRecorderDropsWhenFull(t *testing.T) {
+	ds := &mockJobEventDataStorer{}
+	r := NewRecorder(&mockLogger{}, ds, 0)
+
+	for i := 0; i < bufferSize+10; i++ {
+		r.Hook(logging.Entry{Level: logging.LevelInfo, Message: "Progress", Fields: controller.LogFields{"job_uuid": "abc"}})
+	}
+
+	if *r.dropped != 10 {
+		t.Errorf("expected 10 dropped events but got %v", *r.dropped)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	r.Start(ctx, &wg)
+	cancel()
+	wg.Wait()
+
+	if len(ds.events) != bufferSize {
+		t.Errorf("expected %v saved events but got %v", bufferSize, len(ds.events))
+	}
+	if ds.deletedBefore != nil {
+		t.Errorf("expected nothing to be deleted without a retention but got %v", ds.deletedBefore)
+	}
+}
@@ -0,0 +1,281 @@
+// Package trash holds the original files replaced by transcoded files for a while before deleting them for good.
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+const (
+	// trashedAtFormat sorts the same alphabetically and chronologically. The nanoseconds keep the originals of the
+	// same file apart when it is trashed more than once.
+	trashedAtFormat = "20060102-150405.000000000"
+
+	// cleanupInterval is how often Start deletes the entries which are past the retention or needed for free space.
+	cleanupInterval = time.Hour
+)
+
+// ErrNotAnEntry is returned by Restore when the path isn't a file in the trash.
+var ErrNotAnEntry = errors.New("not an entry of the trash")
+
+// New returns a new Trash in dir. Entries which are older than retention are deleted, as are the oldest entries while
+// the free space of dir is below minFreeBytes. Zero disables either cleanup.
+func New(logger controller.Logger, dir string, retention time.Duration, minFreeBytes uint64) Trash {
+	return Trash{
+		logger:       logger,
+		dir:          filepath.Clean(dir),
+		retention:    retention,
+		minFreeBytes: minFreeBytes,
+		mu:           &sync.Mutex{},
+		now:          time.Now,
+		freeSpace:    controller.FreeSpace,
+	}
+}
+
+// Trash is a folder that original files are moved into instead of being deleted. Every entry is kept at
+// <dir>/<library id>/<time trashed>/<path relative to the library's folder>, so that originals with the same name
+// don't collide and the time they were trashed is known without a database.
+type Trash struct {
+	logger       controller.Logger
+	dir          string
+	retention    time.Duration
+	minFreeBytes uint64
+
+	// mu keeps Cleanup and Restore from working on the same entry at once.
+	mu *sync.Mutex
+
+	now       func() time.Time
+	freeSpace func(dir string) (uint64, error)
+}
+
+// Entry is an original file in the trash.
+type Entry struct {
+	Path         string    `json:"path"`
+	LibraryID    int       `json:"library_id"`
+	RelativePath string    `json:"relative_path"` // Relative to the folder of the library.
+	TrashedAt    time.Time `json:"trashed_at"`
+	Size         int64     `json:"size"` // In bytes
+}
+
+// Dir returns the folder of the trash.
+func (t *Trash) Dir() string {
+	return t.dir
+}
+
+// Path returns where the original file at path of the library with the provided ID and folder is moved to
+// if it is trashed now.
+func (t *Trash) Path(libraryID int, libraryFolder, path string) string {
+	rel, err := filepath.Rel(libraryFolder, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(path)
+	}
+	return filepath.Join(t.dir, strconv.Itoa(libraryID), t.now().UTC().Format(trashedAtFormat), rel)
+}
+
+// Entries returns the files in the trash, oldest first. Files which weren't put there by Path are left out.
+func (t *Trash) Entries() ([]Entry, error) {
+	entries := make([]Entry, 0)
+	err := filepath.WalkDir(t.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == t.dir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		entry, ok := t.parseEntry(path)
+		if !ok {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			entry.Size = info.Size()
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].TrashedAt.Before(entries[j].TrashedAt)
+	})
+	return entries, nil
+}
+
+// parseEntry returns the entry of the file at path, which is only ok if path is laid out the way Path lays it out.
+func (t *Trash) parseEntry(path string) (Entry, bool) {
+	rel, err := filepath.Rel(t.dir, filepath.Clean(path))
+	if err != nil {
+		return Entry{}, false
+	}
+
+	parts := strings.SplitN(filepath.ToSlash(rel), "/", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return Entry{}, false
+	}
+
+	libraryID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Entry{}, false
+	}
+	trashedAt, err := time.Parse(trashedAtFormat, parts[1])
+	if err != nil {
+		return Entry{}, false
+	}
+
+	return Entry{
+		Path:         filepath.Join(t.dir, rel),
+		LibraryID:    libraryID,
+		RelativePath: filepath.FromSlash(parts[2]),
+		TrashedAt:    trashedAt,
+	}, true
+}
+
+// Entry returns the entry at path. ErrNotAnEntry is returned if path isn't a file in the trash.
+func (t *Trash) Entry(path string) (Entry, error) {
+	entry, ok := t.parseEntry(path)
+	if !ok {
+		return Entry{}, ErrNotAnEntry
+	}
+
+	info, err := os.Stat(entry.Path)
+	if err != nil || !info.Mode().IsRegular() {
+		return Entry{}, ErrNotAnEntry
+	}
+	entry.Size = info.Size()
+	return entry, nil
+}
+
+// Restore moves the entry at path back to dest, replacing any file which is there.
+// ErrNotAnEntry is returned if path isn't a file in the trash.
+func (t *Trash) Restore(path, dest string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, err := t.Entry(path)
+	if err != nil {
+		return err
+	}
+
+	if err = controller.MoveFile(entry.Path, dest); err != nil {
+		return err
+	}
+	t.removeEmptyParents(entry.Path)
+	return nil
+}
+
+// Start starts deleting old entries without blocking the thread. The first cleanup happens right away, so that
+// entries which passed the retention while the Controller was stopped don't wait for an interval.
+func (t *Trash) Start(ctx context.Context, wg *sync.WaitGroup) {
+	if t.retention <= 0 && t.minFreeBytes == 0 {
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			deleted, err := t.Cleanup()
+			if errors.Is(err, controller.ErrFreeSpaceUnsupported) {
+				t.logger.Warn("Not deleting trash entries for free space: %v", err)
+			} else if err != nil {
+				t.logger.Error("failed to clean up the trash: %v", err)
+			}
+			if deleted > 0 {
+				t.logger.Info("Deleted %v entries from the trash", deleted)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Cleanup deletes the entries which are older than the retention, followed by the oldest entries for as long
+// as the free space of the trash's folder is below the minimum. It returns how many entries were deleted.
+func (t *Trash) Cleanup() (deleted int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries, err := t.Entries()
+	if err != nil {
+		return 0, err
+	}
+
+	if t.retention > 0 {
+		cutoff := t.now().Add(-t.retention)
+		for len(entries) > 0 && entries[0].TrashedAt.Before(cutoff) {
+			if err = t.delete(entries[0]); err != nil {
+				return deleted, err
+			}
+			deleted++
+			entries = entries[1:]
+		}
+	}
+
+	if t.minFreeBytes == 0 {
+		return deleted, nil
+	}
+	for len(entries) > 0 {
+		free, err := t.freeSpace(t.dir)
+		if errors.Is(err, controller.ErrFreeSpaceUnsupported) {
+			// It won't become supported, so the error is only returned once
+			t.minFreeBytes = 0
+		}
+		if err != nil {
+			return deleted, err
+		}
+		if free >= t.minFreeBytes {
+			break
+		}
+
+		if err = t.delete(entries[0]); err != nil {
+			return deleted, err
+		}
+		deleted++
+		entries = entries[1:]
+	}
+	return deleted, nil
+}
+
+// delete removes the file of entry along with the folders that it leaves empty.
+func (t *Trash) delete(entry Entry) error {
+	if err := os.Remove(entry.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("couldn't delete %v: %v", entry.Path, err)
+	}
+	t.logger.Debug("Deleted %v from the trash", entry.Path)
+	t.removeEmptyParents(entry.Path)
+	return nil
+}
+
+// removeEmptyParents removes the folders above path which are empty, up to but not including the trash's folder.
+func (t *Trash) removeEmptyParents(path string) {
+	for dir := filepath.Dir(path); dir != t.dir && strings.HasPrefix(dir, t.dir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		// Remove fails for folders which aren't empty
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package trash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPathAndEntries(t *testing.T) {
+	dir := t.TempDir()
+	tr := New(&mockLogger{}, filepath.Join(dir, "trash"), 0, 0)
+
+	// The trash's folder doesn't exist until something is trashed
+	if entries, err := tr.Entries(); err != nil || len(entries) != 0 {
+		t.Fatalf("expected no entries but got %v (%v)", entries, err)
+	}
+
+	first := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	now := first
+	tr.now = func() time.Time { return now }
+
+	// The same file is trashed twice, which must not collide
+	paths := []string{
+		tr.Path(1, "/media/tv", "/media/tv/Show/S01E01.mkv"),
+		tr.Path(2, "/media/movies", "/elsewhere/movie.mkv"),
+	}
+	now = now.Add(time.Second)
+	paths = append(paths, tr.Path(1, "/media/tv", "/media/tv/Show/S01E01.mkv"))
+
+	expected := []string{
+		filepath.Join(dir, "trash", "1", "20210801-120000.000000000", "Show", "S01E01.mkv"),
+		filepath.Join(dir, "trash", "2", "20210801-120000.000000000", "movie.mkv"),
+		filepath.Join(dir, "trash", "1", "20210801-120001.000000000", "Show", "S01E01.mkv"),
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("expected %v but got %v", expected, paths)
+	}
+
+	for _, p := range paths {
+		writeFile(t, p, "original")
+	}
+	// Files which weren't trashed by Path are left out
+	writeFile(t, filepath.Join(dir, "trash", "notes.txt"), "keep me")
+	writeFile(t, filepath.Join(dir, "trash", "1", "not-a-time", "a.mkv"), "keep me")
+
+	entries, err := tr.Entries()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries but got %+v", entries)
+	}
+	if last := entries[2]; last.Path != paths[2] || last.LibraryID != 1 || last.RelativePath != filepath.Join("Show", "S01E01.mkv") || !last.TrashedAt.Equal(now) || last.Size != int64(len("original")) {
+		t.Errorf("unexpected entry %+v", last)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	tr := New(&mockLogger{}, filepath.Join(dir, "trash"), 0, 0)
+
+	trashed := tr.Path(1, filepath.Join(dir, "media"), filepath.Join(dir, "media", "Show", "a.mkv"))
+	writeFile(t, trashed, "original")
+	dest := filepath.Join(dir, "media", "Show", "a.mkv")
+	writeFile(t, dest, "transcoded")
+
+	for _, p := range []string{filepath.Join(dir, "media", "Show", "a.mkv"), filepath.Join(dir, "trash", "..", "media", "Show", "a.mkv"), filepath.Join(dir, "trash", "1", "missing.mkv")} {
+		if err := tr.Restore(p, dest); !errors.Is(err, ErrNotAnEntry) {
+			t.Errorf("expected ErrNotAnEntry for %v but got %v", p, err)
+		}
+	}
+
+	if err := tr.Restore(trashed, dest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, err := os.ReadFile(dest); err != nil || string(b) != "original" {
+		t.Errorf("expected the original to be restored but got %q (%v)", b, err)
+	}
+
+	// The folders which held the entry are removed, but not the trash itself
+	if entries, err := os.ReadDir(filepath.Join(dir, "trash")); err != nil || len(entries) != 0 {
+		t.Errorf("expected an empty trash but got %v (%v)", entries, err)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	tests := []struct {
+		name         string
+		retention    time.Duration
+		minFreeBytes uint64
+		free         uint64
+		expected     []string
+	}{
+		{name: "Nothing To Delete", retention: 72 * time.Hour, expected: []string{"a.mkv", "b.mkv", "c.mkv"}},
+		{name: "Retention", retention: 36 * time.Hour, expected: []string{"b.mkv", "c.mkv"}},
+		{name: "Free Space", minFreeBytes: 100, free: 90, expected: []string{"c.mkv"}},
+		{name: "Enough Free Space", minFreeBytes: 100, free: 200, expected: []string{"a.mkv", "b.mkv", "c.mkv"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tr := New(&mockLogger{}, dir, test.retention, test.minFreeBytes)
+
+			// a.mkv is two days old, b.mkv one day old and c.mkv new
+			now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+			for i, name := range []string{"a.mkv", "b.mkv", "c.mkv"} {
+				tr.now = func() time.Time { return now.Add(time.Duration(i-2) * 24 * time.Hour) }
+				writeFile(t, tr.Path(1, "/media", "/media/"+name), "0123456789")
+			}
+			tr.now = func() time.Time { return now }
+
+			// Every deleted entry frees up 5 bytes
+			free := test.free
+			tr.freeSpace = func(string) (uint64, error) {
+				entries, _ := tr.Entries()
+				return free + uint64(3-len(entries))*5, nil
+			}
+
+			if _, err := tr.Cleanup(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			entries, err := tr.Entries()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			remaining := make([]string, 0)
+			for _, e := range entries {
+				remaining = append(remaining, e.RelativePath)
+			}
+			if !reflect.DeepEqual(remaining, test.expected) {
+				t.Errorf("expected %v to remain but got %v", test.expected, remaining)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+package userinterfacer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/google/uuid"
+)
+
+// planBenchmarks returns a benchmark request for each of the Runners in body, or a single one for whichever Runner asks
+// for a job first if there aren't any. An error is returned if the path isn't an absolute path to a regular file in
+// one of the libraries, or in the library in body if it is set.
+func planBenchmarks(body benchmarkRequestJSON, libraries []controller.Library, canonicalize func(string) string, stat func(string) (os.FileInfo, error)) ([]controller.BenchmarkRequest, error) {
+	p := canonicalize(body.Path)
+	if !isAbsolutePath(p) {
+		return nil, fmt.Errorf("'%v' isn't an absolute path", body.Path)
+	}
+
+	lib, ok := libraryContaining(libraries, p)
+	if body.LibraryID != 0 {
+		ok = false
+		for _, l := range libraries {
+			if l.ID == body.LibraryID {
+				lib, ok = l, true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("library %v doesn't exist", body.LibraryID)
+		}
+	} else if !ok {
+		return nil, fmt.Errorf("'%v' isn't in a library", body.Path)
+	}
+
+	if info, err := stat(filepath.FromSlash(p)); err != nil || !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("'%v' isn't a regular file", body.Path)
+	}
+
+	runners := body.Runners
+	if len(runners) == 0 {
+		runners = []string{""}
+	}
+
+	reqs := make([]controller.BenchmarkRequest, 0, len(runners))
+	seen := make(map[string]struct{})
+	for _, r := range runners {
+		if _, ok := seen[r]; ok {
+			continue
+		}
+		seen[r] = struct{}{}
+
+		reqs = append(reqs, controller.BenchmarkRequest{
+			UUID:      controller.UUID(uuid.NewString()),
+			Path:      p,
+			LibraryID: lib.ID,
+			Settings:  body.CommandDeciderSettings,
+			Runner:    r,
+		})
+	}
+	return reqs, nil
+}
+
+// compareBenchmarks summarizes results for each combination of path, settings and Runner, so that they can be compared
+// side by side. The averages only include the benchmarks which succeeded. The summaries are sorted by path, then
+// settings, then Runner.
+func compareBenchmarks(results []controller.BenchmarkResult) []benchmarkComparisonJSON {
+	type key struct{ path, settings, runner string }
+	comparisons := make(map[key]*benchmarkComparisonJSON)
+	order := []key{}
+
+	for _, r := range results {
+		k := key{r.Path, r.Settings, r.Runner}
+		c, ok := comparisons[k]
+		if !ok {
+			c = &benchmarkComparisonJSON{Path: r.Path, Settings: r.Settings, Runner: r.Runner}
+			comparisons[k] = c
+			order = append(order, k)
+		}
+
+		c.Runs++
+		if r.Failed {
+			c.Failed++
+			continue
+		}
+		c.AverageElapsed += r.Elapsed
+		c.AverageFPS += r.FPS
+		c.AverageProjectedSize += r.ProjectedSize
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].path != order[j].path {
+			return order[i].path < order[j].path
+		} else if order[i].settings != order[j].settings {
+			return order[i].settings < order[j].settings
+		}
+		return order[i].runner < order[j].runner
+	})
+
+	summaries := make([]benchmarkComparisonJSON, 0, len(order))
+	for _, k := range order {
+		c := comparisons[k]
+		if succeeded := c.Runs - c.Failed; succeeded > 0 {
+			c.AverageElapsed /= time.Duration(succeeded)
+			c.AverageFPS /= float64(succeeded)
+			c.AverageProjectedSize /= int64(succeeded)
+		}
+		summaries = append(summaries, *c)
+	}
+	return summaries
+}
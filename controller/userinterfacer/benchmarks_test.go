@@ -0,0 +1,90 @@
+package userinterfacer
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func TestPlanBenchmarks(t *testing.T) {
+	libraries := []controller.Library{{ID: 1, Folder: "/media/movies"}, {ID: 2, Folder: "/media/tv/"}}
+	stat := func(p string) (os.FileInfo, error) {
+		switch p {
+		case "/media/movies/a.mkv", "/media/tv/b.mkv":
+			return fakeFileInfo{}, nil
+		case "/media/movies/extras":
+			return fakeDirInfo{}, nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	tests := []struct {
+		name              string
+		body              benchmarkRequestJSON
+		expectedLibraryID int
+		expectedRunners   []string
+		expectErr         bool
+	}{
+		{name: "Inferred library", body: benchmarkRequestJSON{Path: "/media//tv/b.mkv"}, expectedLibraryID: 2, expectedRunners: []string{""}},
+		{name: "Explicit library", body: benchmarkRequestJSON{Path: "/media/tv/b.mkv", LibraryID: 1}, expectedLibraryID: 1, expectedRunners: []string{""}},
+		{name: "Runners", body: benchmarkRequestJSON{Path: "/media/movies/a.mkv", Runners: []string{"r1", "r2", "r1"}}, expectedLibraryID: 1, expectedRunners: []string{"r1", "r2"}},
+		{name: "Relative path", body: benchmarkRequestJSON{Path: "movies/a.mkv"}, expectErr: true},
+		{name: "Not in a library", body: benchmarkRequestJSON{Path: "/media/music/c.flac"}, expectErr: true},
+		{name: "Unknown library", body: benchmarkRequestJSON{Path: "/media/movies/a.mkv", LibraryID: 3}, expectErr: true},
+		{name: "Missing file", body: benchmarkRequestJSON{Path: "/media/movies/c.mkv"}, expectErr: true},
+		{name: "Directory", body: benchmarkRequestJSON{Path: "/media/movies/extras"}, expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.body.CommandDeciderSettings = "{}"
+			reqs, err := planBenchmarks(test.body, libraries, controller.PathCanonicalizer{}.Canonicalize, stat)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("expected error to be %v but got %v", test.expectErr, err)
+			}
+			if test.expectErr {
+				return
+			}
+
+			runners := make([]string, 0, len(reqs))
+			for _, req := range reqs {
+				runners = append(runners, req.Runner)
+				if req.UUID == "" {
+					t.Errorf("expected a UUID for the benchmark on runner '%v'", req.Runner)
+				}
+				if req.LibraryID != test.expectedLibraryID {
+					t.Errorf("expected library %v but got %v", test.expectedLibraryID, req.LibraryID)
+				}
+				if req.Settings != "{}" {
+					t.Errorf("expected the settings to be passed through but got %v", req.Settings)
+				}
+			}
+			if !reflect.DeepEqual(runners, test.expectedRunners) {
+				t.Errorf("expected runners %v but got %v", test.expectedRunners, runners)
+			}
+		})
+	}
+}
+
+func TestCompareBenchmarks(t *testing.T) {
+	results := []controller.BenchmarkResult{
+		{Path: "/b.mkv", Settings: "s", Runner: "r1", Elapsed: 4 * time.Minute, FPS: 30, ProjectedSize: 300},
+		{Path: "/a.mkv", Settings: "s", Runner: "r2", Elapsed: time.Minute, FPS: 90, ProjectedSize: 100},
+		{Path: "/b.mkv", Settings: "s", Runner: "r1", Elapsed: 2 * time.Minute, FPS: 60, ProjectedSize: 100},
+		{Path: "/b.mkv", Settings: "s", Runner: "r1", Failed: true},
+		{Path: "/a.mkv", Settings: "s", Runner: "r1", Failed: true},
+	}
+
+	expected := []benchmarkComparisonJSON{
+		{Path: "/a.mkv", Settings: "s", Runner: "r1", Runs: 1, Failed: 1},
+		{Path: "/a.mkv", Settings: "s", Runner: "r2", Runs: 1, AverageElapsed: time.Minute, AverageFPS: 90, AverageProjectedSize: 100},
+		{Path: "/b.mkv", Settings: "s", Runner: "r1", Runs: 3, Failed: 1, AverageElapsed: 3 * time.Minute, AverageFPS: 45, AverageProjectedSize: 200},
+	}
+
+	if got := compareBenchmarks(results); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v but got %+v", expected, got)
+	}
+}
@@ -0,0 +1,454 @@
+package userinterfacer
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/notifier"
+)
+
+// validLogVerbosities are the values accepted for the LogVerbosity setting.
+var validLogVerbosities = map[string]struct{}{"TRACE": {}, "DEBUG": {}, "INFO": {}, "WARN": {}, "WARNING": {}, "ERROR": {}, "CRITICAL": {}}
+
+// exportConfig creates a configJSON from the provided libraries and settings. Library queues are not included.
+func exportConfig(libs []controller.Library, settings settingsJSON) configJSON {
+	c := configJSON{Settings: &settings, Libraries: make([]configLibraryJSON, 0, len(libs))}
+	for _, l := range libs {
+		c.Libraries = append(c.Libraries, configLibraryJSON{
+			ID:                      l.ID,
+			Folder:                  l.Folder,
+			Priority:                l.Priority,
+			FsCheckInterval:         l.FsCheckInterval.String(),
+			PathMasks:               l.PathMasks,
+			MultiPartPatterns:       l.MultiPartPatterns,
+			SkipUnchanged:           l.SkipUnchanged,
+			VerificationCommand:     l.VerificationCommand,
+			ScanOnStartup:           l.ScanOnStartup,
+			QueueOrder:              l.QueueOrder,
+			StaleJobTimeout:         l.StaleJobTimeout.String(),
+			StaleJobAction:          l.StaleJobAction,
+			MetadataReadConcurrency: l.MetadataReadConcurrency,
+			MetadataReadTimeout:     l.MetadataReadTimeout.String(),
+			MetadataReadArgs:        l.MetadataReadArgs,
+			MaxQueuedBytes:          l.MaxQueuedBytes,
+			OriginalFileHandling:    l.OriginalFileHandling,
+			PreserveModtime:         l.PreserveModtime,
+			MoveSidecars:            l.MoveSidecars,
+			Notifications:           l.Notifications,
+			CommandDeciderSettings:  l.CommandDeciderSettings,
+		})
+	}
+	return c
+}
+
+// planImport validates the provided configuration document and compares it against the current libraries and settings.
+// Each library is also checked by validate, unless it is nil, whose errors and warnings are added to the report.
+// The returned libraries are the ones that need to be saved (created or updated). The import may only be applied
+// if the report doesn't contain any conflicts or errors.
+func planImport(doc configJSON, current []controller.Library, currentSettings settingsJSON, validate func(controller.Library) []controller.ValidationIssue) (toSave []controller.Library, report importReportJSON) {
+	report = importReportJSON{Created: []int{}, Updated: []int{}, Unchanged: []int{}, Conflicts: []string{}, Errors: []string{}, Warnings: []string{}}
+
+	currentByID := make(map[int]controller.Library, len(current))
+	currentByFolder := make(map[string]int, len(current))
+	for _, l := range current {
+		currentByID[l.ID] = l
+		currentByFolder[l.Folder] = l.ID
+	}
+
+	seenIDs := make(map[int]struct{}, len(doc.Libraries))
+	seenFolders := make(map[string]int, len(doc.Libraries))
+
+	for _, v := range doc.Libraries {
+		lib, errs := v.toLibrary()
+		if validate != nil {
+			for _, issue := range validate(lib) {
+				if issue.Severity == controller.ValidationWarning {
+					report.Warnings = append(report.Warnings, fmt.Sprintf("library %v: %v", v.ID, issue.Message))
+					continue
+				}
+				errs = append(errs, errors.New(issue.Message))
+			}
+		}
+		for _, err := range errs {
+			report.Errors = append(report.Errors, fmt.Sprintf("library %v: %v", v.ID, err))
+		}
+
+		if _, ok := seenIDs[v.ID]; ok {
+			report.Errors = append(report.Errors, fmt.Sprintf("library %v: duplicate id", v.ID))
+			continue
+		}
+		seenIDs[v.ID] = struct{}{}
+
+		if otherID, ok := seenFolders[v.Folder]; ok {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("library %v: folder '%v' is also used by library %v in the document", v.ID, v.Folder, otherID))
+		}
+		seenFolders[v.Folder] = v.ID
+
+		if existingID, ok := currentByFolder[v.Folder]; ok && existingID != v.ID {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("library %v: folder '%v' is already used by library %v", v.ID, v.Folder, existingID))
+		}
+
+		if len(errs) > 0 {
+			continue
+		}
+
+		existing, ok := currentByID[v.ID]
+		if !ok {
+			report.Created = append(report.Created, v.ID)
+			toSave = append(toSave, lib)
+			continue
+		}
+
+		// The document only holds the settings, so the fields which the data storer keeps are taken from the existing library.
+		lib.Queue = existing.Queue
+		lib.Version = existing.Version
+		lib.DeletedAt = existing.DeletedAt
+		if reflect.DeepEqual(lib, existing) {
+			report.Unchanged = append(report.Unchanged, v.ID)
+			continue
+		}
+
+		report.Updated = append(report.Updated, v.ID)
+		toSave = append(toSave, lib)
+	}
+
+	if doc.Settings != nil {
+		for _, err := range validateSettings(*doc.Settings) {
+			report.Errors = append(report.Errors, fmt.Sprintf("settings: %v", err))
+		}
+		report.SettingsChanged = settingsChanged(*doc.Settings, currentSettings)
+	}
+
+	return toSave, report
+}
+
+// toLibrary converts the configLibraryJSON into a controller.Library, returning any errors in the fields that it converts
+// or that the Library Manager doesn't check. The folder, the patterns, and the settings are checked by ValidateLibrary.
+func (c configLibraryJSON) toLibrary() (controller.Library, []error) {
+	errs := []error{}
+	lib := controller.Library{
+		ID:                      c.ID,
+		Folder:                  c.Folder,
+		Priority:                c.Priority,
+		PathMasks:               c.PathMasks,
+		MultiPartPatterns:       c.MultiPartPatterns,
+		SkipUnchanged:           c.SkipUnchanged,
+		VerificationCommand:     c.VerificationCommand,
+		ScanOnStartup:           c.ScanOnStartup,
+		QueueOrder:              c.QueueOrder,
+		StaleJobAction:          c.StaleJobAction,
+		MetadataReadConcurrency: c.MetadataReadConcurrency,
+		MetadataReadArgs:        c.MetadataReadArgs,
+		MaxQueuedBytes:          c.MaxQueuedBytes,
+		OriginalFileHandling:    c.OriginalFileHandling,
+		PreserveModtime:         c.PreserveModtime,
+		MoveSidecars:            c.MoveSidecars,
+		Notifications:           c.Notifications,
+		CommandDeciderSettings:  c.CommandDeciderSettings,
+	}
+
+	td, err := time.ParseDuration(c.FsCheckInterval)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid fs_check_interval: %v", err))
+	}
+	lib.FsCheckInterval = td
+
+	if !c.QueueOrder.Valid() {
+		errs = append(errs, fmt.Errorf("invalid queue_order '%v'", c.QueueOrder))
+	}
+
+	if lib.StaleJobTimeout, err = parseStaleJobTimeout(c.StaleJobTimeout); err != nil {
+		errs = append(errs, err)
+	}
+
+	if !c.StaleJobAction.Valid() {
+		errs = append(errs, fmt.Errorf("invalid stale_job_action '%v'", c.StaleJobAction))
+	}
+
+	if c.MetadataReadConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("metadata_read_concurrency must not be negative"))
+	}
+
+	if lib.MetadataReadTimeout, err = parseMetadataReadTimeout(c.MetadataReadTimeout); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.MaxQueuedBytes < 0 {
+		errs = append(errs, fmt.Errorf("max_queued_bytes must not be negative"))
+	}
+
+	if !c.OriginalFileHandling.Valid() {
+		errs = append(errs, fmt.Errorf("invalid original_file_handling '%v'", c.OriginalFileHandling))
+	}
+
+	errs = append(errs, validateLibraryNotifications(c.Notifications)...)
+
+	return lib, errs
+}
+
+// validateLibraryNotifications returns any problems with the webhooks of a library.
+func validateLibraryNotifications(n controller.LibraryNotifications) []error {
+	errs := []error{}
+
+	for i, w := range n.Webhooks {
+		if w.Type != controller.NotificationDiscord && w.Type != controller.NotificationSlack {
+			errs = append(errs, fmt.Errorf("library webhook %v: invalid type '%v': it must be discord or slack", i+1, w.Type))
+		}
+
+		if !isHTTPURL(w.URL) {
+			errs = append(errs, fmt.Errorf("library webhook %v: invalid url: it must be an http or https URL", i+1))
+		}
+
+		if len(w.Events) == 0 {
+			errs = append(errs, fmt.Errorf("library webhook %v: events must not be empty", i+1))
+		}
+		for _, e := range w.Events {
+			if !e.AboutLibrary() {
+				errs = append(errs, fmt.Errorf("library webhook %v: invalid event type '%v': only the events about a library and its jobs are sent to its webhooks", i+1, e))
+			}
+		}
+
+		if _, err := notifier.ParseTemplate(w.Template); err != nil {
+			errs = append(errs, fmt.Errorf("library webhook %v: invalid template: %v", i+1, err))
+		}
+
+		if _, err := notifier.ParseCompletionDigest(w.CompletionDigest); err != nil {
+			errs = append(errs, fmt.Errorf("library webhook %v: %v", i+1, err))
+		}
+	}
+
+	if n.ReplaceGlobal && len(n.Webhooks) == 0 {
+		errs = append(errs, fmt.Errorf("library replace_global requires at least one webhook"))
+	}
+
+	return errs
+}
+
+// settingsChanged returns whether or not applying s would change current. The redacted Secrets are ignored
+// because they are never applied, and so are an omitted CompressQueues, LogLevels, MediaServer, and Notifications and an empty QuarantineExpiry, QueryTimeout, and StaleJobAction.
+func settingsChanged(s, current settingsJSON) bool {
+	if len(s.SetSecrets) > 0 {
+		return true
+	}
+	if s.CompressQueues == nil {
+		s.CompressQueues = current.CompressQueues
+	}
+	if s.LogLevels == nil || (len(s.LogLevels) == 0 && len(current.LogLevels) == 0) {
+		s.LogLevels = current.LogLevels
+	}
+	if s.MediaServer == nil {
+		s.MediaServer = current.MediaServer
+	}
+	if s.Notifications == nil {
+		s.Notifications = current.Notifications
+	}
+	if s.QuarantineExpiry == "" {
+		s.QuarantineExpiry = current.QuarantineExpiry
+	}
+	if s.QueryTimeout == "" {
+		s.QueryTimeout = current.QueryTimeout
+	}
+	if s.StaleJobAction == "" {
+		s.StaleJobAction = current.StaleJobAction
+	}
+	s.Secrets, s.SetSecrets = nil, nil
+	current.Secrets, current.SetSecrets = nil, nil
+	return !reflect.DeepEqual(s, current)
+}
+
+// validateSettings returns any problems with the provided settings.
+func validateSettings(s settingsJSON) []error {
+	errs := []error{}
+
+	if _, err := time.ParseDuration(s.HealthCheckInterval); err != nil {
+		errs = append(errs, fmt.Errorf("invalid HealthCheckInterval: %v", err))
+	}
+
+	if _, err := time.ParseDuration(s.HealthCheckTimeout); err != nil {
+		errs = append(errs, fmt.Errorf("invalid HealthCheckTimeout: %v", err))
+	}
+
+	if _, ok := validLogVerbosities[s.LogVerbosity]; !ok {
+		errs = append(errs, fmt.Errorf("invalid LogVerbosity '%v'", s.LogVerbosity))
+	}
+
+	if err := validateLogLevels(s.LogLevels); err != nil {
+		errs = append(errs, err)
+	}
+
+	if s.MaxJobAttempts == 0 {
+		errs = append(errs, fmt.Errorf("MaxJobAttempts must be greater than 0"))
+	}
+
+	if s.QuarantineExpiry != "" {
+		if td, err := time.ParseDuration(s.QuarantineExpiry); err != nil {
+			errs = append(errs, fmt.Errorf("invalid QuarantineExpiry: %v", err))
+		} else if td < 0 {
+			errs = append(errs, fmt.Errorf("QuarantineExpiry must not be negative"))
+		}
+	}
+
+	if s.QueryTimeout != "" {
+		if td, err := time.ParseDuration(s.QueryTimeout); err != nil {
+			errs = append(errs, fmt.Errorf("invalid QueryTimeout: %v", err))
+		} else if td < 0 {
+			errs = append(errs, fmt.Errorf("QueryTimeout must not be negative"))
+		}
+	}
+
+	if !s.StaleJobAction.Valid() {
+		errs = append(errs, fmt.Errorf("invalid StaleJobAction '%v'", s.StaleJobAction))
+	}
+
+	if s.MediaServer != nil {
+		if !s.MediaServer.Type.Valid() {
+			errs = append(errs, fmt.Errorf("invalid MediaServer type '%v'", s.MediaServer.Type))
+		} else if s.MediaServer.Type != controller.MediaServerNone {
+			if !isHTTPURL(s.MediaServer.URL) {
+				errs = append(errs, fmt.Errorf("invalid MediaServer URL '%v': it must be an http or https URL", s.MediaServer.URL))
+			}
+		}
+	}
+
+	if s.Notifications != nil {
+		errs = append(errs, validateNotifications(*s.Notifications)...)
+	}
+
+	if err := validateSecrets(s.SetSecrets); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// validateLogLevels returns an error if any of the component names in levels is empty or any of their levels is invalid.
+func validateLogLevels(levels map[string]string) error {
+	for component, level := range levels {
+		if component == "" {
+			return fmt.Errorf("LogLevels component names must not be empty")
+		}
+		if _, ok := validLogVerbosities[level]; !ok {
+			return fmt.Errorf("invalid LogLevels level '%v' for %v", level, component)
+		}
+	}
+	return nil
+}
+
+// validateNotifications returns any problems with the provided notification settings.
+func validateNotifications(n controller.Notifications) []error {
+	errs := []error{}
+
+	names := make(map[string]struct{}, len(n.Channels))
+	for _, c := range n.Channels {
+		if c.Name == "" {
+			errs = append(errs, fmt.Errorf("notification channel names must not be empty"))
+		} else if _, ok := names[c.Name]; ok {
+			errs = append(errs, fmt.Errorf("duplicate notification channel '%v'", c.Name))
+		}
+		names[c.Name] = struct{}{}
+
+		if !c.Type.Valid() {
+			errs = append(errs, fmt.Errorf("notification channel '%v': invalid type '%v'", c.Name, c.Type))
+		}
+
+		if len(c.Events) == 0 {
+			errs = append(errs, fmt.Errorf("notification channel '%v': events must not be empty", c.Name))
+		}
+		for _, e := range c.Events {
+			if !e.Valid() {
+				errs = append(errs, fmt.Errorf("notification channel '%v': invalid event type '%v'", c.Name, e))
+			}
+		}
+
+		if _, err := notifier.ParseTemplate(c.Template); err != nil {
+			errs = append(errs, fmt.Errorf("notification channel '%v': invalid template: %v", c.Name, err))
+		}
+
+		if _, err := notifier.ParseCompletionDigest(c.CompletionDigest); err != nil {
+			errs = append(errs, fmt.Errorf("notification channel '%v': %v", c.Name, err))
+		}
+
+		if c.Type == controller.NotificationEmail {
+			if len(c.Recipients) == 0 {
+				errs = append(errs, fmt.Errorf("notification channel '%v': recipients must not be empty", c.Name))
+			}
+			for _, r := range c.Recipients {
+				if _, err := mail.ParseAddress(r); err != nil {
+					errs = append(errs, fmt.Errorf("notification channel '%v': invalid recipient '%v'", c.Name, r))
+				}
+			}
+			if n.SMTP == nil {
+				errs = append(errs, fmt.Errorf("notification channel '%v': email channels require the smtp settings", c.Name))
+			}
+		} else if len(c.Recipients) > 0 {
+			errs = append(errs, fmt.Errorf("notification channel '%v': only email channels have recipients", c.Name))
+		}
+
+		switch c.Type {
+		case controller.NotificationNtfy, controller.NotificationGotify:
+			if !isHTTPURL(c.Server) {
+				errs = append(errs, fmt.Errorf("notification channel '%v': invalid server '%v': it must be an http or https URL", c.Name, c.Server))
+			}
+			if c.Type == controller.NotificationNtfy && !ntfyTopicRegex.MatchString(c.Topic) {
+				errs = append(errs, fmt.Errorf("notification channel '%v': invalid topic '%v': it must only contain letters, numbers, - and _", c.Name, c.Topic))
+			} else if c.Type == controller.NotificationGotify && c.Topic != "" {
+				errs = append(errs, fmt.Errorf("notification channel '%v': only ntfy channels have a topic", c.Name))
+			}
+		default:
+			if c.Server != "" || c.Topic != "" {
+				errs = append(errs, fmt.Errorf("notification channel '%v': only ntfy and Gotify channels have a server and topic", c.Name))
+			}
+		}
+	}
+
+	if n.WebURL != "" && !isHTTPURL(n.WebURL) {
+		errs = append(errs, fmt.Errorf("invalid notification web_url '%v': it must be an http or https URL", n.WebURL))
+	}
+
+	if n.DigestTime != "" {
+		if _, _, _, err := notifier.ParseDigestSchedule(n.DigestTime, n.DigestWeekday); err != nil {
+			errs = append(errs, fmt.Errorf("invalid notification %v", err))
+		}
+	} else if n.DigestWeekday != "" {
+		errs = append(errs, fmt.Errorf("notification digest_weekday requires digest_time to be set"))
+	}
+
+	if n.SMTP != nil {
+		errs = append(errs, validateSMTP(*n.SMTP)...)
+	}
+
+	return errs
+}
+
+// ntfyTopicRegex matches the topic names that ntfy accepts.
+var ntfyTopicRegex = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+
+// isHTTPURL returns whether or not s is an absolute http or https URL.
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validateSMTP returns an error for every invalid SMTP setting.
+func validateSMTP(s controller.SMTPSettings) []error {
+	errs := []error{}
+	if s.Host == "" {
+		errs = append(errs, fmt.Errorf("smtp host must not be empty"))
+	}
+	if s.Port < 1 || s.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid smtp port %v: it must be between 1 and 65535", s.Port))
+	}
+	if _, err := mail.ParseAddress(s.From); err != nil {
+		errs = append(errs, fmt.Errorf("invalid smtp from address '%v'", s.From))
+	}
+	if !s.TLS.Valid() {
+		errs = append(errs, fmt.Errorf("invalid smtp tls '%v': it must be starttls, tls, or none", s.TLS))
+	}
+	return errs
+}
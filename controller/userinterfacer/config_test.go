@@ -0,0 +1,395 @@
+package userinterfacer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func TestPlanImport(t *testing.T) {
+	current := []controller.Library{
+		{ID: 0, Folder: "/movies", FsCheckInterval: time.Hour, PathMasks: []string{}, MultiPartPatterns: []string{}, CommandDeciderSettings: "{}", Queue: controller.LibraryQueue{Items: []controller.Job{{UUID: "a"}}}, Version: 4},
+		{ID: 1, Folder: "/tv", FsCheckInterval: time.Hour, PathMasks: []string{}, MultiPartPatterns: []string{}, CommandDeciderSettings: "{}", Version: 1},
+	}
+	currentSettings := settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3, Secrets: map[controller.SecretSetting]string{controller.SecretSMTPPassword: redactedSecret}}
+
+	tests := []struct {
+		name              string
+		doc               configJSON
+		expectedCreated   []int
+		expectedUpdated   []int
+		expectedUnchanged []int
+		issues            []controller.ValidationIssue // What ValidateLibrary finds in each library.
+		expectConflicts   bool
+		expectErrors      bool
+		expectWarnings    bool
+		expectSettings    bool
+	}{
+		{
+			name:              "Round trip of export is unchanged",
+			doc:               exportConfig(current, currentSettings),
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{0, 1},
+		},
+		{
+			name: "Create and update",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 1, Folder: "/tv", FsCheckInterval: "30m", PathMasks: []string{}, MultiPartPatterns: []string{}, CommandDeciderSettings: "{}"},
+				{ID: 2, Folder: "/anime", FsCheckInterval: "1h", CommandDeciderSettings: "{}"},
+			}},
+			expectedCreated:   []int{2},
+			expectedUpdated:   []int{1},
+			expectedUnchanged: []int{},
+		},
+		{
+			name: "Folder used by another existing library",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 5, Folder: "/movies", FsCheckInterval: "1h", CommandDeciderSettings: "{}"},
+			}},
+			expectedCreated:   []int{5},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectConflicts:   true,
+		},
+		{
+			name: "Invalid library",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 2, Folder: "", FsCheckInterval: "soon", MultiPartPatterns: []string{"("}, CommandDeciderSettings: "{"},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+		},
+		{
+			name: "Library with validation errors",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 2, Folder: "/missing", FsCheckInterval: "1h", CommandDeciderSettings: "{}"},
+			}},
+			issues:            []controller.ValidationIssue{{Severity: controller.ValidationError, Field: "folder", Message: "folder '/missing' couldn't be accessed"}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+		},
+		{
+			name: "Library with validation warnings",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 2, Folder: "/anime", FsCheckInterval: "1h", CommandDeciderSettings: "{}"},
+			}},
+			issues:            []controller.ValidationIssue{{Severity: controller.ValidationWarning, Field: "folder", Message: "no video files were found in '/anime'"}},
+			expectedCreated:   []int{2},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectWarnings:    true,
+		},
+		{
+			name: "Invalid queue order",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 2, Folder: "/anime", FsCheckInterval: "1h", QueueOrder: "random", CommandDeciderSettings: "{}"},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+		},
+		{
+			name: "Invalid stale job settings",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 2, Folder: "/anime", FsCheckInterval: "1h", StaleJobTimeout: "-1h", StaleJobAction: "retry", CommandDeciderSettings: "{}"},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+		},
+		{
+			name: "Negative metadata read concurrency",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 2, Folder: "/anime", FsCheckInterval: "1h", MetadataReadConcurrency: -1, CommandDeciderSettings: "{}"},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+		},
+		{
+			name: "Invalid original file handling",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 2, Folder: "/anime", FsCheckInterval: "1h", OriginalFileHandling: "delete", CommandDeciderSettings: "{}"},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+		},
+		{
+			name: "Negative max queued bytes",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 2, Folder: "/anime", FsCheckInterval: "1h", MaxQueuedBytes: -1, CommandDeciderSettings: "{}"},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+		},
+		{
+			name: "Library webhooks",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 2, Folder: "/anime", FsCheckInterval: "1h", CommandDeciderSettings: "{}", Notifications: controller.LibraryNotifications{
+					Webhooks:      []controller.LibraryWebhook{{Type: controller.NotificationDiscord, URL: "https://discord.com/api/webhooks/1/abc", Events: []controller.EventType{controller.EventJobFailed}}},
+					ReplaceGlobal: true,
+				}},
+			}},
+			expectedCreated:   []int{2},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+		},
+		{
+			name: "Invalid library webhooks",
+			doc: configJSON{Libraries: []configLibraryJSON{
+				{ID: 2, Folder: "/anime", FsCheckInterval: "1h", CommandDeciderSettings: "{}", Notifications: controller.LibraryNotifications{
+					Webhooks: []controller.LibraryWebhook{
+						{Type: controller.NotificationDiscord, URL: "discord.com/api/webhooks/1/abc", Events: []controller.EventType{controller.EventJobFailed}},
+						{Type: controller.NotificationEmail, URL: "https://hooks/anime", Events: []controller.EventType{controller.EventRunnerOffline}},
+					},
+				}},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+		},
+		{
+			name:              "Changed settings",
+			doc:               configJSON{Settings: &settingsJSON{HealthCheckInterval: "5m", HealthCheckTimeout: "1h", LogVerbosity: "DEBUG", MaxJobAttempts: 5}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectSettings:    true,
+		},
+		{
+			name:              "Redacted secrets are ignored",
+			doc:               configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+		},
+		{
+			name:              "Invalid stale job action",
+			doc:               configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3, StaleJobAction: "retry"}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+			expectSettings:    true,
+		},
+		{
+			name:              "Invalid query timeout",
+			doc:               configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3, QueryTimeout: "-5s"}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+			expectSettings:    true,
+		},
+		{
+			name:              "Invalid quarantine expiry",
+			doc:               configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3, QuarantineExpiry: "a week"}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+			expectSettings:    true,
+		},
+		{
+			name:              "Invalid log level",
+			doc:               configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", LogLevels: map[string]string{"library.Manager": "LOUD"}, MaxJobAttempts: 3}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+			expectSettings:    true,
+		},
+		{
+			name:              "Empty log levels",
+			doc:               configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", LogLevels: map[string]string{}, MaxJobAttempts: 3}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+		},
+		{
+			name:              "Set secret",
+			doc:               configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3, SetSecrets: map[controller.SecretSetting]string{controller.SecretRunnerToken: "token"}}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectSettings:    true,
+		},
+		{
+			name:              "Unknown secret",
+			doc:               configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3, SetSecrets: map[controller.SecretSetting]string{"api_key": "key"}}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+			expectSettings:    true,
+		},
+		{
+			name: "Notification channel",
+			doc: configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3,
+				Notifications: &controller.Notifications{
+					Channels: []controller.NotificationChannel{
+						{Name: "alerts", Type: controller.NotificationDiscord, Events: []controller.EventType{controller.EventJobFailed}, Template: "{{.Path}} failed on {{.Runner}}"},
+						{Name: "completions", Type: controller.NotificationSlack, Events: []controller.EventType{controller.EventJobCompleted}, CompletionDigest: "15m"},
+					},
+					DigestTime: "08:00",
+				},
+				SetSecrets: map[controller.SecretSetting]string{controller.NotificationWebhookSecret("alerts"): "https://discord.com/api/webhooks/1/a"},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectSettings:    true,
+		},
+		{
+			name: "Invalid completion digest",
+			doc: configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3,
+				Notifications: &controller.Notifications{
+					Channels: []controller.NotificationChannel{{Name: "completions", Type: controller.NotificationSlack, Events: []controller.EventType{controller.EventJobCompleted}, CompletionDigest: "-15m"}},
+				},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+			expectSettings:    true,
+		},
+		{
+			name: "Invalid notification channels",
+			doc: configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3,
+				Notifications: &controller.Notifications{
+					Channels: []controller.NotificationChannel{
+						{Name: "alerts", Type: "teams", Events: []controller.EventType{"job_exploded"}, Template: "{{.Path"},
+						{Name: "alerts", Type: controller.NotificationSlack},
+					},
+					DigestTime: "8am",
+				},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+			expectSettings:    true,
+		},
+		{
+			name: "Email channel",
+			doc: configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3,
+				Notifications: &controller.Notifications{
+					Channels:      []controller.NotificationChannel{{Name: "mail", Type: controller.NotificationEmail, Events: []controller.EventType{controller.EventDailyDigest}, Recipients: []string{"Me <me@example.com>"}}},
+					DigestTime:    "08:00",
+					DigestWeekday: "Monday",
+					SMTP:          &controller.SMTPSettings{Host: "smtp.example.com", Port: 587, Username: "me", From: "encodarr@example.com"},
+				},
+				SetSecrets: map[controller.SecretSetting]string{controller.SecretSMTPPassword: "password"},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectSettings:    true,
+		},
+		{
+			name: "Invalid email channel",
+			doc: configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3,
+				Notifications: &controller.Notifications{
+					Channels:      []controller.NotificationChannel{{Name: "mail", Type: controller.NotificationEmail, Events: []controller.EventType{controller.EventJobFailed}, Recipients: []string{"not an address"}}},
+					DigestWeekday: "someday",
+					SMTP:          &controller.SMTPSettings{Port: 70000, From: "nobody", TLS: "ssl"},
+				},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+			expectSettings:    true,
+		},
+		{
+			name: "Push notification channels",
+			doc: configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3,
+				Notifications: &controller.Notifications{
+					Channels: []controller.NotificationChannel{
+						{Name: "phone", Type: controller.NotificationNtfy, Events: []controller.EventType{controller.EventJobFailed}, Server: "https://ntfy.sh", Topic: "encodarr_alerts"},
+						{Name: "gotify", Type: controller.NotificationGotify, Events: []controller.EventType{controller.EventJobCompleted}, Server: "http://gotify.lan"},
+					},
+					WebURL: "http://encodarr.lan:8123",
+				},
+				SetSecrets: map[controller.SecretSetting]string{controller.NotificationTokenSecret("gotify"): "app-token"},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectSettings:    true,
+		},
+		{
+			name: "Invalid push notification channels",
+			doc: configJSON{Settings: &settingsJSON{HealthCheckInterval: "1m0s", HealthCheckTimeout: "1h0m0s", LogVerbosity: "INFO", MaxJobAttempts: 3,
+				Notifications: &controller.Notifications{
+					Channels: []controller.NotificationChannel{
+						{Name: "phone", Type: controller.NotificationNtfy, Events: []controller.EventType{controller.EventJobFailed}, Server: "ntfy.sh", Topic: "alerts/all"},
+						{Name: "slack", Type: controller.NotificationSlack, Events: []controller.EventType{controller.EventJobFailed}, Topic: "alerts"},
+					},
+					WebURL: "encodarr.lan",
+				},
+			}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+			expectSettings:    true,
+		},
+		{
+			name:              "Invalid settings",
+			doc:               configJSON{Settings: &settingsJSON{HealthCheckInterval: "5m", HealthCheckTimeout: "1h", LogVerbosity: "LOUD", MaxJobAttempts: 0}},
+			expectedCreated:   []int{},
+			expectedUpdated:   []int{},
+			expectedUnchanged: []int{},
+			expectErrors:      true,
+			expectSettings:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validate := func(controller.Library) []controller.ValidationIssue { return test.issues }
+			toSave, report := planImport(test.doc, current, currentSettings, validate)
+
+			if !reflect.DeepEqual(report.Created, test.expectedCreated) {
+				t.Errorf("expected created %v but got %v", test.expectedCreated, report.Created)
+			}
+			if !reflect.DeepEqual(report.Updated, test.expectedUpdated) {
+				t.Errorf("expected updated %v but got %v", test.expectedUpdated, report.Updated)
+			}
+			if !reflect.DeepEqual(report.Unchanged, test.expectedUnchanged) {
+				t.Errorf("expected unchanged %v but got %v", test.expectedUnchanged, report.Unchanged)
+			}
+			if (len(report.Conflicts) > 0) != test.expectConflicts {
+				t.Errorf("expected conflicts to be %v but got %v", test.expectConflicts, report.Conflicts)
+			}
+			if (len(report.Errors) > 0) != test.expectErrors {
+				t.Errorf("expected errors to be %v but got %v", test.expectErrors, report.Errors)
+			}
+			if (len(report.Warnings) > 0) != test.expectWarnings {
+				t.Errorf("expected warnings to be %v but got %v", test.expectWarnings, report.Warnings)
+			}
+			if report.SettingsChanged != test.expectSettings {
+				t.Errorf("expected settings changed to be %v but got %v", test.expectSettings, report.SettingsChanged)
+			}
+			if len(toSave) != len(test.expectedCreated)+len(test.expectedUpdated) {
+				t.Errorf("expected %v libraries to save but got %v", len(test.expectedCreated)+len(test.expectedUpdated), len(toSave))
+			}
+		})
+	}
+}
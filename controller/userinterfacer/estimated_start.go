@@ -0,0 +1,123 @@
+package userinterfacer
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// estimateStarts returns when each of the jobs in plan is expected to be dispatched, keyed by UUID. Every connected
+// Runner takes the next job in the plan as soon as it is free. A waiting Runner is free now and a busy one once its
+// job finishes, which is projected from the progress of the job. Each planned job is expected to take the typical job
+// duration of the plan, or the average projected duration of the dispatched jobs if no job has completed yet. Without
+// either, only the jobs that the Runners take next are estimated. nil is returned while dispatching is paused or if no
+// Runner is connected.
+func estimateStarts(plan controller.DispatchPlan, waitingRunners []string, dJobs []controller.DispatchedJob, now time.Time) map[controller.UUID]time.Time {
+	if plan.Paused || len(waitingRunners)+len(dJobs) == 0 {
+		return nil
+	}
+
+	typical := plan.TypicalJobDuration
+	if typical <= 0 {
+		typical = averageProjectedDuration(dJobs)
+	}
+
+	// free holds when each Runner is free to take a job.
+	free := make([]time.Time, 0, len(waitingRunners)+len(dJobs))
+	for range waitingRunners {
+		free = append(free, now)
+	}
+	for _, dJob := range dJobs {
+		if remaining, ok := remainingDuration(dJob.Status, typical); ok {
+			free = append(free, now.Add(remaining))
+		}
+	}
+
+	order := make([]controller.UUID, len(plan.Positions))
+	for uuid, position := range plan.Positions {
+		if position >= 1 && position <= len(order) {
+			order[position-1] = uuid
+		}
+	}
+
+	starts := make(map[controller.UUID]time.Time, len(order))
+	for _, uuid := range order {
+		if len(free) == 0 {
+			break
+		}
+
+		next := 0
+		for i := range free {
+			if free[i].Before(free[next]) {
+				next = i
+			}
+		}
+		if uuid != "" {
+			starts[uuid] = free[next]
+		}
+
+		if typical > 0 {
+			free[next] = free[next].Add(typical)
+		} else {
+			free = append(free[:next], free[next+1:]...)
+		}
+	}
+	return starts
+}
+
+// remainingDuration returns how much longer the dispatched job with the provided status is expected to take,
+// going by how far along it is or, if its progress isn't known, by the typical job duration. false is returned
+// if neither is known.
+func remainingDuration(status controller.JobStatus, typical time.Duration) (time.Duration, bool) {
+	elapsed, elapsedErr := time.ParseDuration(status.JobElapsedTime)
+	if total, ok := projectedDuration(status); ok {
+		return nonNegative(total - elapsed), true
+	}
+	if typical <= 0 {
+		return 0, false
+	}
+	if elapsedErr == nil {
+		return nonNegative(typical - elapsed), true
+	}
+	return typical, true
+}
+
+// projectedDuration returns how long the dispatched job with the provided status takes in total if the rest of it
+// goes as fast as it has so far. false is returned if the job hasn't reported any progress.
+func projectedDuration(status controller.JobStatus) (time.Duration, bool) {
+	elapsed, err := time.ParseDuration(status.JobElapsedTime)
+	if err != nil {
+		return 0, false
+	}
+	percentage, err := strconv.ParseFloat(status.Percentage, 64)
+	if err != nil || percentage <= 0 {
+		return 0, false
+	}
+	return time.Duration(float64(elapsed) * 100 / percentage), true
+}
+
+// averageProjectedDuration returns the average projectedDuration of the dispatched jobs which reported their progress,
+// or zero if none of them has.
+func averageProjectedDuration(dJobs []controller.DispatchedJob) time.Duration {
+	var total time.Duration
+	n := 0
+	for _, dJob := range dJobs {
+		if d, ok := projectedDuration(dJob.Status); ok {
+			total += d
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / time.Duration(n)
+}
+
+// nonNegative returns d, or zero if d is negative.
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
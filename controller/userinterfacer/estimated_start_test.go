@@ -0,0 +1,67 @@
+package userinterfacer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func TestEstimateStarts(t *testing.T) {
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	positions := map[controller.UUID]int{"a": 1, "b": 2, "c": 3, "d": 4}
+	halfway := controller.DispatchedJob{UUID: "x", Status: controller.JobStatus{Percentage: "50", JobElapsedTime: "30m0s"}}
+	unknown := controller.DispatchedJob{UUID: "y", Status: controller.JobStatus{Stage: "Copying"}}
+
+	tests := []struct {
+		name     string
+		plan     controller.DispatchPlan
+		waiting  []string
+		dJobs    []controller.DispatchedJob
+		expected map[controller.UUID]time.Duration // From now
+	}{
+		{
+			name:     "Typical duration",
+			plan:     controller.DispatchPlan{Positions: positions, TypicalJobDuration: time.Hour},
+			waiting:  []string{"runner-1"},
+			dJobs:    []controller.DispatchedJob{halfway},
+			expected: map[controller.UUID]time.Duration{"a": 0, "b": 30 * time.Minute, "c": time.Hour, "d": 90 * time.Minute},
+		},
+		{
+			name:     "Projected from the dispatched jobs",
+			plan:     controller.DispatchPlan{Positions: positions},
+			dJobs:    []controller.DispatchedJob{halfway, unknown},
+			expected: map[controller.UUID]time.Duration{"a": 30 * time.Minute, "b": time.Hour, "c": 90 * time.Minute, "d": 2 * time.Hour},
+		},
+		{
+			name:     "Unknown duration",
+			plan:     controller.DispatchPlan{Positions: positions},
+			waiting:  []string{"runner-1", "runner-2"},
+			dJobs:    []controller.DispatchedJob{unknown},
+			expected: map[controller.UUID]time.Duration{"a": 0, "b": 0},
+		},
+		{
+			name:    "Paused",
+			plan:    controller.DispatchPlan{Positions: positions, Paused: true, TypicalJobDuration: time.Hour},
+			waiting: []string{"runner-1"},
+		},
+		{
+			name: "No Runners",
+			plan: controller.DispatchPlan{Positions: positions, TypicalJobDuration: time.Hour},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			starts := estimateStarts(test.plan, test.waiting, test.dJobs, now)
+			if len(starts) != len(test.expected) {
+				t.Fatalf("expected %v estimates but got %v", len(test.expected), starts)
+			}
+			for uuid, after := range test.expected {
+				if start, ok := starts[uuid]; !ok || !start.Equal(now.Add(after)) {
+					t.Errorf("expected %v to start at %v but got %v", uuid, now.Add(after), start)
+				}
+			}
+		})
+	}
+}
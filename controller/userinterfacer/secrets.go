@@ -0,0 +1,55 @@
+package userinterfacer
+
+import (
+	"fmt"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// redactedSecret replaces the value of every sensitive setting which is set in settings responses.
+const redactedSecret = "•••"
+
+// redactedSecrets returns the sensitive settings which are set in ss, with their values redacted.
+func redactedSecrets(ss controller.SettingsStorer) map[controller.SecretSetting]string {
+	secrets := make(map[controller.SecretSetting]string)
+	for _, name := range controller.SecretSettings {
+		if ss.Secret(name) != "" {
+			secrets[name] = redactedSecret
+		}
+	}
+	for _, c := range ss.Notifications().Channels {
+		for _, name := range []controller.SecretSetting{controller.NotificationWebhookSecret(c.Name), controller.NotificationTokenSecret(c.Name)} {
+			if ss.Secret(name) != "" {
+				secrets[name] = redactedSecret
+			}
+		}
+	}
+	return secrets
+}
+
+// isSecretSetting returns whether or not name is a known sensitive setting. The webhook URL and token of any notification
+// channel are ones, so that they can be set in the same update which adds the channel.
+func isSecretSetting(name controller.SecretSetting) bool {
+	if _, ok := controller.NotificationWebhookChannel(name); ok {
+		return true
+	}
+	if _, ok := controller.NotificationTokenChannel(name); ok {
+		return true
+	}
+	for _, v := range controller.SecretSettings {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSecrets returns an error if secrets contains a setting which isn't a known sensitive setting.
+func validateSecrets(secrets map[controller.SecretSetting]string) error {
+	for name := range secrets {
+		if !isSecretSetting(name) {
+			return fmt.Errorf("unknown secret setting '%v'", name)
+		}
+	}
+	return nil
+}
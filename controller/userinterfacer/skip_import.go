@@ -0,0 +1,80 @@
+package userinterfacer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// maxSkipImportLine is the longest line, in bytes, that a skip import accepts.
+const maxSkipImportLine = 64 * 1024
+
+// planSkipImport reads the newline-delimited absolute paths and globs (ex. /media/movies/*/*.mkv) in r and returns the
+// paths to record as completed externally. Globs are expanded to the regular files that they match, while plain paths
+// are recorded whether or not they exist yet. An error is returned for the first line which isn't an absolute path
+// or a valid glob, so that nothing is recorded from a list with a typo in it.
+func planSkipImport(r io.Reader, canonicalize func(string) string, glob func(string) ([]string, error), stat func(string) (os.FileInfo, error), now time.Time) ([]controller.SkippedPath, skipImportReportJSON, error) {
+	skipped := []controller.SkippedPath{}
+	report := skipImportReportJSON{Unmatched: []string{}}
+	seen := make(map[string]struct{})
+
+	add := func(p string) {
+		if _, ok := seen[p]; ok {
+			return
+		}
+		seen[p] = struct{}{}
+		skipped = append(skipped, controller.SkippedPath{Path: p, DateTimeSkipped: now})
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxSkipImportLine)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !isAbsolutePath(canonicalize(line)) {
+			return nil, report, fmt.Errorf("line %v: '%v' isn't an absolute path", lineNum, line)
+		}
+
+		if !strings.ContainsAny(line, "*?[") {
+			add(canonicalize(line))
+			continue
+		}
+
+		matches, err := glob(filepath.FromSlash(line))
+		if err != nil {
+			return nil, report, fmt.Errorf("line %v: invalid glob '%v': %w", lineNum, line, err)
+		}
+
+		matched := false
+		for _, m := range matches {
+			if info, err := stat(m); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			add(canonicalize(filepath.ToSlash(m)))
+			matched = true
+		}
+		if !matched {
+			report.Unmatched = append(report.Unmatched, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, report, err
+	}
+
+	report.Skipped = len(skipped)
+	return skipped, report, nil
+}
+
+// isAbsolutePath returns whether or not the canonical path p is absolute, either from the root or a drive letter.
+func isAbsolutePath(p string) bool {
+	return strings.HasPrefix(p, "/") || (len(p) >= 3 && p[1] == ':' && p[2] == '/')
+}
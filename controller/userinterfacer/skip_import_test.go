@@ -0,0 +1,86 @@
+package userinterfacer
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// fakeDirInfo is a directory.
+type fakeDirInfo struct{ os.FileInfo }
+
+func (f fakeDirInfo) Mode() os.FileMode { return os.ModeDir }
+
+func TestPlanSkipImport(t *testing.T) {
+	now := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	globs := map[string][]string{
+		"/media/movies/*/*.mkv": {"/media/movies/a/a.mkv", "/media/movies/b/b.mkv", "/media/movies/c/extras.mkv"},
+		"/media/tv/*.mkv":       {},
+	}
+	glob := func(pattern string) ([]string, error) { return globs[pattern], nil }
+	stat := func(p string) (os.FileInfo, error) {
+		if p == "/media/movies/c/extras.mkv" {
+			return fakeDirInfo{}, nil
+		}
+		return fakeFileInfo{modtime: now}, nil
+	}
+
+	tests := []struct {
+		name              string
+		body              string
+		expectedPaths     []string
+		expectedUnmatched []string
+		expectErr         bool
+	}{
+		{
+			name:              "Paths and globs",
+			body:              "/media/movies/d.mkv\n\n  /media//tv/e.mkv  \r\n/media/movies/*/*.mkv\n/media/tv/*.mkv\n/media/movies/a/a.mkv\n",
+			expectedPaths:     []string{"/media/movies/d.mkv", "/media/tv/e.mkv", "/media/movies/a/a.mkv", "/media/movies/b/b.mkv"},
+			expectedUnmatched: []string{"/media/tv/*.mkv"},
+		},
+		{
+			name:      "Relative path",
+			body:      "/media/movies/d.mkv\nmovies/e.mkv\n",
+			expectErr: true,
+		},
+		{
+			name:              "Empty",
+			body:              "\n",
+			expectedPaths:     []string{},
+			expectedUnmatched: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			skipped, report, err := planSkipImport(strings.NewReader(test.body), controller.PathCanonicalizer{}.Canonicalize, glob, stat, now)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("expected error to be %v but got %v", test.expectErr, err)
+			}
+			if test.expectErr {
+				return
+			}
+
+			paths := make([]string, 0, len(skipped))
+			for _, s := range skipped {
+				paths = append(paths, s.Path)
+				if !s.DateTimeSkipped.Equal(now) {
+					t.Errorf("expected %v to be skipped at %v but got %v", s.Path, now, s.DateTimeSkipped)
+				}
+			}
+			if !reflect.DeepEqual(paths, test.expectedPaths) {
+				t.Errorf("expected the paths %v but got %v", test.expectedPaths, paths)
+			}
+			if !reflect.DeepEqual(report.Unmatched, test.expectedUnmatched) {
+				t.Errorf("expected the unmatched globs %v but got %v", test.expectedUnmatched, report.Unmatched)
+			}
+			if report.Skipped != len(test.expectedPaths) {
+				t.Errorf("expected %v skipped paths but got %v", len(test.expectedPaths), report.Skipped)
+			}
+		})
+	}
+}
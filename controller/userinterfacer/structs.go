@@ -1,6 +1,11 @@
 package userinterfacer
 
-import "github.com/BrenekH/encodarr/controller"
+import (
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/trash"
+)
 
 type runningJSONResponse struct {
 	DispatchedJobs []filteredDispatchedJob `json:"jobs"`
@@ -19,29 +24,273 @@ type filteredJob struct {
 }
 
 type settingsJSON struct {
+	// CompressQueues is left unchanged when it is omitted.
+	CompressQueues *bool `json:",omitempty"`
+
 	FileSystemCheckInterval string
 	HealthCheckInterval     string
 	HealthCheckTimeout      string
 	LogVerbosity            string
+
+	// LogLevels overrides LogVerbosity for the logger components it names (ex. {"library.Manager": "DEBUG"}).
+	// It is left unchanged when it is omitted, and an empty object removes every override.
+	LogLevels map[string]string `json:",omitempty"`
+
+	MaxJobAttempts uint64
+
+	// MediaServer is left unchanged when it is omitted. Its token is the media_server_token secret.
+	MediaServer *controller.MediaServer `json:",omitempty"`
+
+	// Notifications is left unchanged when it is omitted. The webhook URL of each channel is its notification_webhook:<name> secret.
+	Notifications *controller.Notifications `json:",omitempty"`
+
+	// QuarantineExpiry is left unchanged when it is empty. "0s" keeps jobs quarantined until they are cleared.
+	QuarantineExpiry string `json:",omitempty"`
+
+	// QueryTimeout is left unchanged when it is empty. "0s" disables the timeout.
+	QueryTimeout string `json:",omitempty"`
+
+	// StaleJobAction is left unchanged when it is empty.
+	StaleJobAction controller.StaleJobAction `json:",omitempty"`
+
+	// Secrets shows which sensitive settings are set, but their values are always redacted. They are changed
+	// through SetSecrets instead, where an empty value clears a secret.
+	Secrets    map[controller.SecretSetting]string `json:",omitempty"`
+	SetSecrets map[controller.SecretSetting]string `json:",omitempty"`
+}
+
+type healthActionsJSON struct {
+	Counts  map[controller.StaleJobAction]int `json:"counts"`
+	Actions []controller.HealthCheckAction    `json:"actions"`
+}
+
+type jobTimelineJSON struct {
+	UUID   controller.UUID       `json:"uuid"`
+	Events []controller.JobEvent `json:"events"`
+}
+
+type trashJSON struct {
+	Entries []trashEntryJSON `json:"entries"`
+}
+
+type trashEntryJSON struct {
+	trash.Entry
+	JobUUID   controller.UUID `json:"job_uuid,omitempty"`
+	RestoreTo string          `json:"restore_to"` // Empty if where the entry came from is unknown.
+}
+
+type searchJSON struct {
+	Results       []controller.SearchResult `json:"results"`
+	MoreAvailable bool                      `json:"more_available"`
+}
+
+type fileSnapshotsJSON struct {
+	Count int      `json:"count"`
+	Paths []string `json:"paths"`
+}
+
+// dispatchedRecordJSON describes a dispatched job record so that orphaned records can be spotted.
+type dispatchedRecordJSON struct {
+	UUID           controller.UUID `json:"uuid"`
+	Path           string          `json:"path"`
+	RunnerName     string          `json:"runner_name"`
+	LastUpdated    time.Time       `json:"last_updated"`
+	AgeSeconds     int64           `json:"age_seconds"`      // Time since LastUpdated.
+	RunnerLastSeen *time.Time      `json:"runner_last_seen"` // nil if the Runner doesn't have a record.
+}
+
+type dispatchedRecordsJSON struct {
+	Records []dispatchedRecordJSON `json:"records"`
+}
+
+// statusJSON describes the overall health of the Controller.
+type statusJSON struct {
+	NoRunners         bool       `json:"no_runners"`       // Whether no Runner has been seen for a while even though jobs are queued.
+	NoRunnersSince    *time.Time `json:"no_runners_since"` // When a Runner was last seen. nil unless NoRunners is true.
+	WaitingRunners    int        `json:"waiting_runners"`
+	ScanningLibraries int        `json:"scanning_libraries"`
+
+	DatastoreDown      bool       `json:"datastore_down"`       // Whether the circuit breaker for the datastore is open.
+	DatastoreDownSince *time.Time `json:"datastore_down_since"` // When the datastore started failing. nil unless DatastoreDown is true.
+	DatastoreError     string     `json:"datastore_error"`      // The latest error from the datastore. Empty unless DatastoreDown is true.
+
+	// AwaitingSpace lists the completed jobs which are waiting for space in their library to be imported.
+	AwaitingSpace []awaitingSpaceJSON `json:"awaiting_space"`
+
+	// LogFile is the path of the current log file. It is empty if the log is only written to stdout.
+	LogFile string `json:"log_file"`
+}
+
+// awaitingSpaceJSON describes a completed job which is waiting for space in its library.
+type awaitingSpaceJSON struct {
+	UUID      controller.UUID `json:"uuid"`
+	LibraryID int             `json:"library_id"`
+	Path      string          `json:"path"`
+}
+
+// testNotificationJSON is the outcome of sending a test notification to a channel.
+type testNotificationJSON struct {
+	Channel string `json:"channel"`
+	Sent    bool   `json:"sent"`
+	Error   string `json:"error,omitempty"`
 }
 
-type humanizedHistoryEntry struct {
-	File              string   `json:"file"`
-	DateTimeCompleted string   `json:"datetime_completed"`
-	Warnings          []string `json:"warnings"`
-	Errors            []string `json:"errors"`
+// deletedLibraryJSON describes a library which is waiting to be purged.
+type deletedLibraryJSON struct {
+	ID        int       `json:"id"`
+	Folder    string    `json:"folder"`
+	DeletedAt time.Time `json:"deleted_at"`
 }
 
-type historyJSON struct {
-	History []humanizedHistoryEntry `json:"history"`
+type deletedLibrariesJSON struct {
+	Libraries []deletedLibraryJSON `json:"libraries"`
 }
 
-type interimLibraryJSON struct {
-	ID                     int                     `json:"id"`
-	Folder                 string                  `json:"folder"`
-	Priority               int                     `json:"priority"`
-	FsCheckInterval        string                  `json:"fs_check_interval"`
-	Queue                  controller.LibraryQueue `json:"queue"`
-	PathMasks              []string                `json:"path_masks"`
-	CommandDeciderSettings string                  `json:"command_decider_settings"`
+type jobDetailJSON struct {
+	State     string         `json:"state"` // Either "queued", "awaiting_space", "dispatched", "completed", or "failed".
+	LibraryID int            `json:"library_id"`
+	Job       controller.Job `json:"job"`
+
+	// QueuePosition is the position of a queued job in the order of all the libraries, starting at 1. EstimatedStart
+	// is when it is expected to be dispatched. They are only set for queued jobs which have them.
+	QueuePosition  int        `json:"queue_position,omitempty"`
+	EstimatedStart *time.Time `json:"estimated_start,omitempty"`
+
+	// CommandLine is the FFmpeg command of the job as the Runner runs it, with the placeholders of the job's files,
+	// after the Runner's own options and before the output path. It is empty if the job doesn't have a command.
+	CommandLine string `json:"command_line,omitempty"`
+
+	// Runner and Status are only set once the job has been dispatched.
+	Runner string                `json:"runner,omitempty"`
+	Status *controller.JobStatus `json:"status,omitempty"`
+
+	LastUpdated       *time.Time `json:"last_updated,omitempty"`
+	DateTimeCompleted *time.Time `json:"datetime_completed,omitempty"`
+	Warnings          []string   `json:"warnings,omitempty"`
+	Errors            []string   `json:"errors,omitempty"`
+
+	// Output is only set once the transcoded file has been read back by the Controller.
+	Output *controller.OutputStats `json:"output,omitempty"`
+
+	// Completion is only set once the transcoded file has replaced the original.
+	Completion *controller.CompletionRecord `json:"completion,omitempty"`
+
+	// OriginalPath is where the original file was kept, if its library keeps originals.
+	OriginalPath string `json:"original_path,omitempty"`
+
+	// OriginalRestored is whether the original file was moved back into place from the trash.
+	OriginalRestored bool `json:"original_restored,omitempty"`
+}
+
+// configJSON is the document used to export and import the Controller's configuration.
+type configJSON struct {
+	Settings  *settingsJSON       `json:"settings,omitempty"`
+	Libraries []configLibraryJSON `json:"libraries"`
+}
+
+type configLibraryJSON struct {
+	ID                      int                             `json:"id"`
+	Folder                  string                          `json:"folder"`
+	Priority                int                             `json:"priority"`
+	FsCheckInterval         string                          `json:"fs_check_interval"`
+	PathMasks               []string                        `json:"path_masks"`
+	MultiPartPatterns       []string                        `json:"multi_part_patterns"`
+	SkipUnchanged           bool                            `json:"skip_unchanged"`
+	VerificationCommand     []string                        `json:"verification_command"`
+	ScanOnStartup           bool                            `json:"scan_on_startup"`
+	QueueOrder              controller.QueueOrder           `json:"queue_order"`
+	StaleJobTimeout         string                          `json:"stale_job_timeout"`
+	StaleJobAction          controller.StaleJobAction       `json:"stale_job_action"`
+	MetadataReadConcurrency int                             `json:"metadata_read_concurrency"`
+	MetadataReadTimeout     string                          `json:"metadata_read_timeout"`
+	MetadataReadArgs        []string                        `json:"metadata_read_args"`
+	MaxQueuedBytes          int64                           `json:"max_queued_bytes"`
+	OriginalFileHandling    controller.OriginalFileHandling `json:"original_file_handling"`
+	PreserveModtime         bool                            `json:"preserve_modtime"`
+	MoveSidecars            bool                            `json:"move_sidecars"`
+	Notifications           controller.LibraryNotifications `json:"notifications"`
+	CommandDeciderSettings  string                          `json:"command_decider_settings"`
+}
+
+// libraryIssuesJSON is the response to a library which can't be created or updated because ValidateLibrary found errors.
+type libraryIssuesJSON struct {
+	Issues []controller.ValidationIssue `json:"issues"`
+}
+
+type importReportJSON struct {
+	DryRun          bool     `json:"dry_run"`
+	Applied         bool     `json:"applied"`
+	Created         []int    `json:"created"`
+	Updated         []int    `json:"updated"`
+	Unchanged       []int    `json:"unchanged"`
+	SettingsChanged bool     `json:"settings_changed"`
+	Conflicts       []string `json:"conflicts"`
+	Errors          []string `json:"errors"`
+	Warnings        []string `json:"warnings"`
+}
+
+// skippedPathsJSON is the list of paths that were recorded as completed externally.
+type skippedPathsJSON struct {
+	Paths []controller.SkippedPath `json:"paths"`
+}
+
+// skipImportReportJSON is the result of importing a list of paths to skip.
+type skipImportReportJSON struct {
+	Skipped   int      `json:"skipped"`   // Paths recorded as completed externally, including those which already were.
+	Unmatched []string `json:"unmatched"` // Globs which didn't match any files.
+}
+
+// benchmarkRequestJSON is a request to benchmark a file. The library is inferred from the path if LibraryID is 0, and
+// the command is decided with the settings of the library if CommandDeciderSettings is empty.
+type benchmarkRequestJSON struct {
+	Path                   string   `json:"path"`
+	LibraryID              int      `json:"library_id"`
+	CommandDeciderSettings string   `json:"command_decider_settings"`
+	Runners                []string `json:"runners"` // Empty for whichever Runner asks for a job first.
+}
+
+// benchmarksQueuedJSON is the UUIDs of the benchmarks that were queued by a request, one per Runner.
+type benchmarksQueuedJSON struct {
+	UUIDs []controller.UUID `json:"uuids"`
+}
+
+// benchmarksJSON is the recorded benchmarks, newest first, along with a comparison of them.
+type benchmarksJSON struct {
+	Results    []controller.BenchmarkResult `json:"results"`
+	Comparison []benchmarkComparisonJSON    `json:"comparison"`
+}
+
+// benchmarkComparisonJSON summarizes the benchmarks of a file with the same settings on the same Runner.
+type benchmarkComparisonJSON struct {
+	Path     string `json:"path"`
+	Settings string `json:"settings"`
+	Runner   string `json:"runner"`
+	Runs     int    `json:"runs"`
+	Failed   int    `json:"failed"`
+
+	// The averages of the benchmarks which succeeded.
+	AverageElapsed       time.Duration `json:"average_elapsed"`
+	AverageFPS           float64       `json:"average_fps"`
+	AverageProjectedSize int64         `json:"average_projected_size"`
+}
+
+type tdarrImportReportJSON struct {
+	DryRun  bool `json:"dry_run"`
+	Applied bool `json:"applied"`
+
+	Files      int `json:"files"`      // Every file in the export.
+	Transcoded int `json:"transcoded"` // Files that Tdarr transcoded successfully.
+	Errored    int `json:"errored"`    // Files whose transcode errored in Tdarr.
+	Ignored    int `json:"ignored"`    // Files with any other status, which are left for Encodarr to evaluate.
+
+	MatchedTranscoded int `json:"matched_transcoded"`
+	MatchedErrored    int `json:"matched_errored"`
+
+	// The paths, as they are in the export, of the transcoded and errored files which aren't in a library or don't exist.
+	// Only the first 1000 are listed.
+	UnmatchedCount int      `json:"unmatched_count"`
+	Unmatched      []string `json:"unmatched"`
+
+	// The libraries with matched transcoded files whose scans don't skip processed files, because skip_unchanged is disabled.
+	LibrariesWithoutSkipUnchanged []int `json:"libraries_without_skip_unchanged"`
 }
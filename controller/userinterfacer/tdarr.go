@@ -0,0 +1,111 @@
+package userinterfacer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/tdarr"
+	"github.com/google/uuid"
+)
+
+// maxUnmatchedPaths is how many of the unmatched paths a Tdarr import report lists.
+const maxUnmatchedPaths = 1000
+
+// tdarrQuarantineReason is the reason of the jobs quarantined because their transcode errored in Tdarr.
+const tdarrQuarantineReason = "The transcode errored in Tdarr"
+
+// pathRewrite replaces the From prefix of a path with To, for when Tdarr saw the media under a different mount point.
+type pathRewrite struct {
+	From string
+	To   string
+}
+
+// apply returns p with the From prefix replaced, if p is in the From folder. The backslashes of a Windows path are
+// replaced with slashes, since the rest of it is joined to To.
+func (r pathRewrite) apply(p string) string {
+	from := strings.TrimRight(r.From, `/\`)
+	if from == "" || (p != from && !strings.HasPrefix(p, from+"/") && !strings.HasPrefix(p, from+`\`)) {
+		return p
+	}
+
+	rest := p[len(from):]
+	if strings.Contains(from, `\`) {
+		rest = strings.ReplaceAll(rest, `\`, "/")
+	}
+	return strings.TrimRight(r.To, `/\`) + rest
+}
+
+// planTdarrImport matches the transcoded and errored files in a Tdarr export with the files in the libraries.
+// A file matches if its path, after rewrite and canonicalize, is in the folder of a library and exists. Transcoded
+// files are returned with their current modtime as processed, so that scans skip them like files that Encodarr
+// transcoded, and errored ones are returned as quarantined jobs.
+func planTdarrImport(files []tdarr.File, rewrite pathRewrite, libraries []controller.Library, canonicalize func(string) string, stat func(string) (os.FileInfo, error), now time.Time) (processed map[string]time.Time, quarantined []controller.QuarantinedJob, report tdarrImportReportJSON) {
+	processed = make(map[string]time.Time)
+	quarantined = []controller.QuarantinedJob{}
+	report = tdarrImportReportJSON{Files: len(files), Unmatched: []string{}, LibrariesWithoutSkipUnchanged: []int{}}
+	matchedLibraries := make(map[int]struct{})
+
+	for _, f := range files {
+		switch f.Status {
+		case tdarr.StatusTranscoded:
+			report.Transcoded++
+		case tdarr.StatusErrored:
+			report.Errored++
+		default:
+			report.Ignored++
+			continue
+		}
+
+		p := canonicalize(rewrite.apply(f.Path))
+		lib, ok := libraryContaining(libraries, p)
+		var info os.FileInfo
+		if ok {
+			var err error
+			info, err = stat(filepath.FromSlash(p))
+			ok = err == nil && info.Mode().IsRegular()
+		}
+		if !ok {
+			report.UnmatchedCount++
+			if len(report.Unmatched) < maxUnmatchedPaths {
+				report.Unmatched = append(report.Unmatched, f.Path)
+			}
+			continue
+		}
+
+		if f.Status == tdarr.StatusTranscoded {
+			report.MatchedTranscoded++
+			processed[p] = info.ModTime()
+			matchedLibraries[lib.ID] = struct{}{}
+		} else {
+			report.MatchedErrored++
+			quarantined = append(quarantined, controller.QuarantinedJob{
+				Job:                 controller.Job{UUID: controller.UUID(uuid.NewString()), LibraryID: lib.ID, Path: p},
+				Reason:              tdarrQuarantineReason,
+				DateTimeQuarantined: now,
+			})
+		}
+	}
+
+	for _, lib := range libraries {
+		if _, ok := matchedLibraries[lib.ID]; ok && !lib.SkipUnchanged {
+			report.LibrariesWithoutSkipUnchanged = append(report.LibrariesWithoutSkipUnchanged, lib.ID)
+		}
+	}
+	sort.Ints(report.LibrariesWithoutSkipUnchanged)
+
+	return processed, quarantined, report
+}
+
+// libraryContaining returns the library whose folder contains the canonical path p.
+func libraryContaining(libraries []controller.Library, p string) (controller.Library, bool) {
+	for _, lib := range libraries {
+		if folder := strings.TrimSuffix(lib.Folder, "/"); strings.HasPrefix(p, folder+"/") {
+			return lib, true
+		}
+	}
+	return controller.Library{}, false
+}
@@ -0,0 +1,89 @@
+package userinterfacer
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/tdarr"
+)
+
+// fakeFileInfo is a regular file with a modtime.
+type fakeFileInfo struct {
+	os.FileInfo
+	modtime time.Time
+}
+
+func (f fakeFileInfo) ModTime() time.Time { return f.modtime }
+func (f fakeFileInfo) Mode() os.FileMode  { return 0 }
+
+func TestPlanTdarrImport(t *testing.T) {
+	modtime := time.Date(2021, time.August, 1, 12, 0, 0, 0, time.UTC)
+	now := modtime.Add(time.Hour)
+	existing := map[string]struct{}{"/media/movies/a.mkv": {}, "/media/movies/b.mkv": {}, "/media/tv/c.mkv": {}}
+	stat := func(p string) (os.FileInfo, error) {
+		if _, ok := existing[p]; !ok {
+			return nil, os.ErrNotExist
+		}
+		return fakeFileInfo{modtime: modtime}, nil
+	}
+	libraries := []controller.Library{{ID: 1, Folder: "/media/movies", SkipUnchanged: true}, {ID: 2, Folder: "/media/tv"}}
+	files := []tdarr.File{
+		{Path: "/mnt/user/media/movies/a.mkv", Status: tdarr.StatusTranscoded},
+		{Path: "/mnt/user/media/movies/b.mkv", Status: tdarr.StatusErrored},
+		{Path: "/mnt/user/media/tv/c.mkv", Status: tdarr.StatusTranscoded},
+		{Path: "/mnt/user/media/tv/missing.mkv", Status: tdarr.StatusTranscoded},
+		{Path: "/mnt/user/other/d.mkv", Status: tdarr.StatusErrored},
+		{Path: "/mnt/user/media/movies/e.mkv", Status: "Not required"},
+	}
+
+	processed, quarantined, report := planTdarrImport(files, pathRewrite{From: "/mnt/user/media/", To: "/media"}, libraries, controller.PathCanonicalizer{}.Canonicalize, stat, now)
+
+	expectedProcessed := map[string]time.Time{"/media/movies/a.mkv": modtime, "/media/tv/c.mkv": modtime}
+	if !reflect.DeepEqual(processed, expectedProcessed) {
+		t.Errorf("expected processed %v but got %v", expectedProcessed, processed)
+	}
+
+	if len(quarantined) != 1 || quarantined[0].Job.Path != "/media/movies/b.mkv" || quarantined[0].Job.LibraryID != 1 || quarantined[0].Job.UUID == "" || !quarantined[0].DateTimeQuarantined.Equal(now) {
+		t.Errorf("expected b.mkv to be quarantined in library 1 but got %+v", quarantined)
+	}
+
+	expectedReport := tdarrImportReportJSON{
+		Files:                         6,
+		Transcoded:                    3,
+		Errored:                       2,
+		Ignored:                       1,
+		MatchedTranscoded:             2,
+		MatchedErrored:                1,
+		UnmatchedCount:                2,
+		Unmatched:                     []string{"/mnt/user/media/tv/missing.mkv", "/mnt/user/other/d.mkv"},
+		LibrariesWithoutSkipUnchanged: []int{2},
+	}
+	if !reflect.DeepEqual(report, expectedReport) {
+		t.Errorf("expected the report %+v but got %+v", expectedReport, report)
+	}
+}
+
+func TestPathRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		rewrite  pathRewrite
+		path     string
+		expected string
+	}{
+		{name: "Rewritten", rewrite: pathRewrite{From: "/mnt/media", To: "/media"}, path: "/mnt/media/a.mkv", expected: "/media/a.mkv"},
+		{name: "Windows To Unix", rewrite: pathRewrite{From: `D:\Media`, To: "/media"}, path: `D:\Media\Show\a.mkv`, expected: "/media/Show/a.mkv"},
+		{name: "Different Folder With The Same Prefix", rewrite: pathRewrite{From: "/mnt/media", To: "/media"}, path: "/mnt/media2/a.mkv", expected: "/mnt/media2/a.mkv"},
+		{name: "No Rewrite", path: "/mnt/media/a.mkv", expected: "/mnt/media/a.mkv"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if p := test.rewrite.apply(test.path); p != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, p)
+			}
+		})
+	}
+}
@@ -1,6 +1,15 @@
 package userinterfacer
 
-import "github.com/BrenekH/encodarr/controller"
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
 
 func filterDispatchedJobs(dJobs []controller.DispatchedJob) []filteredDispatchedJob {
 	fDJobs := make([]filteredDispatchedJob, 0)
@@ -17,3 +26,139 @@ func filterDispatchedJobs(dJobs []controller.DispatchedJob) []filteredDispatched
 	}
 	return fDJobs
 }
+
+// commandLine returns the FFmpeg command line of the provided arguments, with the arguments which a shell would split
+// or interpret quoted. An empty string is returned if there aren't any arguments.
+func commandLine(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, "ffmpeg")
+	for _, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\n'\"\\$`|&;<>()*?[]{}!#~") {
+			a = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+		quoted = append(quoted, a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// countingWriter is an io.Writer that counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// parseFileSnapshotQuery converts the query parameters of a file snapshot query into a filter and a limit on
+// the number of returned paths.
+func parseFileSnapshotQuery(q url.Values) (controller.FileSnapshotFilter, int, error) {
+	filter := controller.FileSnapshotFilter{
+		VideoCodec: q.Get("video_codec"),
+		Container:  q.Get("container"),
+	}
+
+	if v := q.Get("library"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, 0, fmt.Errorf("invalid library: %v", err)
+		}
+		filter.LibraryID = &id
+	}
+
+	if v := q.Get("hdr"); v != "" {
+		hdr, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, 0, fmt.Errorf("invalid hdr: %v", err)
+		}
+		filter.HDR = &hdr
+	}
+
+	ints := map[string]*int{"min_height": &filter.MinHeight, "max_height": &filter.MaxHeight}
+	for name, dst := range ints {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return filter, 0, fmt.Errorf("invalid %v '%v'", name, v)
+			}
+			*dst = n
+		}
+	}
+
+	int64s := map[string]*int64{"min_size": &filter.MinSize, "max_size": &filter.MaxSize}
+	for name, dst := range int64s {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return filter, 0, fmt.Errorf("invalid %v '%v'", name, v)
+			}
+			*dst = n
+		}
+	}
+
+	float32s := map[string]*float32{"min_duration": &filter.MinDuration, "max_duration": &filter.MaxDuration}
+	for name, dst := range float32s {
+		if v := q.Get(name); v != "" {
+			f, err := strconv.ParseFloat(v, 32)
+			if err != nil || f < 0 {
+				return filter, 0, fmt.Errorf("invalid %v '%v'", name, v)
+			}
+			*dst = float32(f)
+		}
+	}
+
+	limit := defaultSearchLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return filter, 0, fmt.Errorf("invalid limit '%v'", v)
+		}
+		limit = n
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	return filter, limit, nil
+}
+
+// parseStaleJobTimeout converts the stale_job_timeout of a library's JSON into a duration. An empty string is
+// the same as "0s", which uses the HealthCheckTimeout setting.
+func parseStaleJobTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	td, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid stale_job_timeout: %v", err)
+	}
+	if td < 0 {
+		return 0, fmt.Errorf("stale_job_timeout must not be negative")
+	}
+	return td, nil
+}
+
+// parseMetadataReadTimeout converts the metadata_read_timeout of a library's JSON into a duration. An empty string is
+// the same as "0s", which uses the global metadata read timeouts.
+func parseMetadataReadTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	td, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid metadata_read_timeout: %v", err)
+	}
+	if td < 0 {
+		return 0, fmt.Errorf("metadata_read_timeout must not be negative")
+	}
+	return td, nil
+}
@@ -0,0 +1,88 @@
+package userinterfacer
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+func TestParseFileSnapshotQuery(t *testing.T) {
+	library := 2
+	hdr := false
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedFilter controller.FileSnapshotFilter
+		expectedLimit  int
+		expectErr      bool
+	}{
+		{name: "No filters", query: "", expectedLimit: defaultSearchLimit},
+		{
+			name:           "Every filter",
+			query:          "library=2&video_codec=h264&container=mkv&hdr=false&min_height=720&max_height=1080&min_size=5000000000&max_size=9000000000&min_duration=60&max_duration=7200.5&limit=10",
+			expectedFilter: controller.FileSnapshotFilter{LibraryID: &library, VideoCodec: "h264", Container: "mkv", HDR: &hdr, MinHeight: 720, MaxHeight: 1080, MinSize: 5e9, MaxSize: 9e9, MinDuration: 60, MaxDuration: 7200.5},
+			expectedLimit:  10,
+		},
+		{name: "Limit is capped", query: "limit=100000", expectedLimit: maxSearchLimit},
+		{name: "Invalid library", query: "library=tv", expectErr: true},
+		{name: "Invalid hdr", query: "hdr=maybe", expectErr: true},
+		{name: "Negative size", query: "min_size=-1", expectErr: true},
+		{name: "Invalid duration", query: "max_duration=long", expectErr: true},
+		{name: "Invalid limit", query: "limit=0", expectErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filter, limit, err := parseFileSnapshotQuery(q)
+			if (err != nil) != test.expectErr {
+				t.Fatalf("expected error to be %v but got %v", test.expectErr, err)
+			}
+			if test.expectErr {
+				return
+			}
+
+			if !reflect.DeepEqual(filter, test.expectedFilter) {
+				t.Errorf("expected filter %+v but got %+v", test.expectedFilter, filter)
+			}
+			if limit != test.expectedLimit {
+				t.Errorf("expected limit %v but got %v", test.expectedLimit, limit)
+			}
+		})
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "No command", args: nil, expected: ""},
+		{
+			name:     "Input flags before the input",
+			args:     []string{"-analyzeduration", "200M", "-probesize", "1G", "-i", "ENCODARR_INPUT_FILE", "-vcodec", "hevc"},
+			expected: "ffmpeg -analyzeduration 200M -probesize 1G -i ENCODARR_INPUT_FILE -vcodec hevc",
+		},
+		{
+			name:     "Quoted arguments",
+			args:     []string{"-i", "ENCODARR_INPUT_FILE", "-filter:a:0", "pan=stereo|FL=FC", "-metadata", "title=It's here"},
+			expected: `ffmpeg -i ENCODARR_INPUT_FILE -filter:a:0 'pan=stereo|FL=FC' -metadata 'title=It'\''s here'`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if out := commandLine(test.args); out != test.expected {
+				t.Errorf("expected %v but got %v", test.expected, out)
+			}
+		})
+	}
+}
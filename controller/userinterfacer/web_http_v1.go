@@ -2,34 +2,63 @@ package userinterfacer
 
 import (
 	"context"
+	"database/sql"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/BrenekH/encodarr/controller"
+	"github.com/BrenekH/encodarr/controller/library"
+	"github.com/BrenekH/encodarr/controller/notifier"
+	"github.com/BrenekH/encodarr/controller/tdarr"
+	"github.com/BrenekH/encodarr/controller/trash"
+	"github.com/BrenekH/encodarr/controller/webapi"
 )
 
 //go:embed webfiles
 var webfiles embed.FS
 
+const (
+	defaultSearchLimit int = 100
+	maxSearchLimit     int = 1000
+
+	defaultHealthActionsLimit int = 50
+	maxHealthActionsLimit     int = 1000
+)
+
 // NewWebHTTPv1 uses the provided arguments to instantiate a new WebHTTPv1 struct and return it.
-func NewWebHTTPv1(logger controller.Logger, httpServer controller.HTTPServer, ss controller.SettingsStorer, ds controller.UserInterfacerDataStorer, useOsFs bool) WebHTTPv1 {
+// Runners which haven't been seen for runnerOfflineThreshold are shown as offline, unless it is 0.
+func NewWebHTTPv1(logger controller.Logger, httpServer controller.HTTPServer, ss controller.SettingsStorer, ds controller.UserInterfacerDataStorer, paths controller.PathCanonicalizer, runnerOfflineThreshold time.Duration, useOsFs bool) WebHTTPv1 {
 	return WebHTTPv1{
 		logger:     logger,
 		httpServer: httpServer,
 		useOsFs:    useOsFs,
 		ss:         ss,
 		ds:         ds,
+		paths:      paths,
+
+		runnerOfflineThreshold: runnerOfflineThreshold,
 
 		waitingRunnersCache: make([]string, 0),
+		scanningLibraries:   make([]int, 0),
+		awaitingSpaceJobs:   make([]controller.Job, 0),
+		requestsMu:          &sync.Mutex{},
+		scanRequests:        make([]int, 0),
+		benchmarkRequests:   make([]controller.BenchmarkRequest, 0),
+		requeueRequests:     make([]int, 0),
 		libraryCache:        []controller.Library{},
 		libSettingsUpdates:  map[int]controller.Library{},
+		metricsSnapshot:     controller.MetricsSnapshot{Counters: map[string]float64{}, Histograms: map[string]controller.HistogramSnapshot{}},
 	}
 }
 
@@ -40,14 +69,53 @@ type WebHTTPv1 struct {
 	useOsFs    bool
 	ss         controller.SettingsStorer
 	ds         controller.UserInterfacerDataStorer
+	paths      controller.PathCanonicalizer
+
+	runnerOfflineThreshold time.Duration
 
 	waitingRunnersCache []string
+	scanningLibraries   []int
+	awaitingSpaceJobs   []controller.Job
 	libraryCache        []controller.Library
 	libSettingsUpdates  map[int]controller.Library
+
+	// requestsMu guards the requests which the HTTP handlers add and the Run loop collects.
+	requestsMu        *sync.Mutex
+	scanRequests      []int
+	benchmarkRequests []controller.BenchmarkRequest
+	requeueRequests   []int
+
+	// noRunnersSince is when a Runner was last seen while the no runners alert is raised, and zero otherwise.
+	noRunnersSince time.Time
+
+	// dispatchPlan is the order in which the queued jobs are expected to be dispatched.
+	dispatchPlan controller.DispatchPlan
+
+	// datastoreHealth is whether or not the Library Manager could reach the datastore on its latest attempts.
+	datastoreHealth controller.DatastoreHealth
+
+	// logFile is the path of the current log file, which is empty if the log is only written to stdout.
+	logFile string
+
+	// metricsSnapshot is the latest snapshot of the metrics, which is served as JSON for those who don't use Prometheus.
+	metricsSnapshot controller.MetricsSnapshot
+
+	// queueAging is how much the priority of a queued job rises per day that it waits. 0 disables aging.
+	queueAging float64
+
+	// trash holds the originals of the libraries which move them to the trash. It is nil if there isn't one.
+	trash *trash.Trash
+
+	// notifier sends the test notifications. It is nil if there isn't one.
+	notifier *notifier.Dispatcher
+
+	// libraryManager is called directly by the endpoints whose response depends on the outcome of the change.
+	// It is nil if there isn't one.
+	libraryManager *library.Manager
 }
 
 // Start starts the http server without blocking the thread.
-func (w *WebHTTPv1) Start(ctx *context.Context, wg *sync.WaitGroup) {
+func (w *WebHTTPv1) Start(ctx context.Context, wg *sync.WaitGroup) {
 	w.httpServer.Start(ctx, wg)
 
 	fSys, err := fs.Sub(webfiles, "webfiles")
@@ -65,11 +133,33 @@ func (w *WebHTTPv1) Start(ctx *context.Context, wg *sync.WaitGroup) {
 
 	// API Handlers
 	w.httpServer.HandleFunc("/api/web/v1/running", w.getRunning)
+	w.httpServer.HandleFunc("/api/web/v1/dispatched", w.getDispatched)
 	w.httpServer.HandleFunc("/api/web/v1/history", w.getHistory)
 	w.httpServer.HandleFunc("/api/web/v1/settings", w.settings)
 	w.httpServer.HandleFunc("/api/web/v1/waitingrunners", w.getWaitingRunners)
+	w.httpServer.HandleFunc("/api/web/v1/status", w.getStatus)
+	w.httpServer.HandleFunc("/api/web/v1/metrics", w.getMetrics)
+	w.httpServer.HandleFunc("/api/web/v1/health/actions", w.getHealthActions)
 	w.httpServer.HandleFunc("/api/web/v1/libraries", w.getAllLibraryIDs)
+	w.httpServer.HandleFunc("/api/web/v1/libraries/deleted", w.getDeletedLibraries)
 	w.httpServer.HandleFunc("/api/web/v1/library/", w.handleLibrary)
+	w.httpServer.HandleFunc("/api/web/v1/search", w.search)
+	w.httpServer.HandleFunc("/api/web/v1/files", w.queryFiles)
+	w.httpServer.HandleFunc("/api/web/v1/runners", w.handleRunners)
+	w.httpServer.HandleFunc("/api/web/v1/runner/", w.handleRunner)
+	w.httpServer.HandleFunc("/api/web/v1/job/", w.getJob)
+	w.httpServer.HandleFunc("/api/web/v1/config", w.handleConfig)
+	w.httpServer.HandleFunc("/api/web/v1/quarantine/clear", w.clearQuarantine)
+	w.httpServer.HandleFunc("/api/web/v1/skipped", w.getSkippedPaths)
+	w.httpServer.HandleFunc("/api/web/v1/skipped/import", w.importSkippedPaths)
+	w.httpServer.HandleFunc("/api/web/v1/skipped/remove", w.removeSkippedPath)
+	w.httpServer.HandleFunc("/api/web/v1/benchmarks", w.handleBenchmarks)
+	w.httpServer.HandleFunc("/api/web/v1/trash", w.getTrash)
+	w.httpServer.HandleFunc("/api/web/v1/trash/restore", w.restoreTrashEntry)
+	w.httpServer.HandleFunc("/api/web/v1/backup", w.backup)
+	w.httpServer.HandleFunc("/api/web/v1/notifications/test", w.testNotification)
+	w.httpServer.HandleFunc("/api/web/v1/import/tdarr", w.importTdarr)
+	w.httpServer.HandleFunc("/api/web/v1/processing", w.processing)
 }
 
 // NewLibrarySettings returns a new library settings the user may have set.
@@ -92,6 +182,94 @@ func (w *WebHTTPv1) SetWaitingRunners(runnerNames []string) {
 	w.waitingRunnersCache = temp
 }
 
+// ScanRequests returns the IDs of the libraries that the user has requested to be scanned since the last call.
+func (w *WebHTTPv1) ScanRequests() []int {
+	w.requestsMu.Lock()
+	defer w.requestsMu.Unlock()
+
+	requests := w.scanRequests
+	w.scanRequests = make([]int, 0)
+	return requests
+}
+
+// BenchmarkRequests returns the benchmarks that the user has requested since the last call.
+func (w *WebHTTPv1) BenchmarkRequests() []controller.BenchmarkRequest {
+	w.requestsMu.Lock()
+	defer w.requestsMu.Unlock()
+
+	requests := w.benchmarkRequests
+	w.benchmarkRequests = make([]controller.BenchmarkRequest, 0)
+	return requests
+}
+
+// RequeueRequests returns the IDs of the libraries that the user has requested to be requeued since the last call.
+func (w *WebHTTPv1) RequeueRequests() []int {
+	w.requestsMu.Lock()
+	defer w.requestsMu.Unlock()
+
+	requests := w.requeueRequests
+	w.requeueRequests = make([]int, 0)
+	return requests
+}
+
+// SetScanningLibraries sets the IDs of the libraries which are currently being scanned.
+func (w *WebHTTPv1) SetScanningLibraries(ids []int) {
+	w.scanningLibraries = ids
+}
+
+// SetAwaitingSpaceJobs sets the completed jobs which are waiting for space in their library to be imported.
+func (w *WebHTTPv1) SetAwaitingSpaceJobs(jobs []controller.Job) {
+	w.awaitingSpaceJobs = jobs
+}
+
+// SetNoRunnersSince sets when a Runner was last seen while the no runners alert is raised. The zero time clears the alert.
+func (w *WebHTTPv1) SetNoRunnersSince(t time.Time) {
+	w.noRunnersSince = t
+}
+
+// SetDispatchPlan sets the order in which the queued jobs are expected to be dispatched, which is shown along with
+// the queues and in the details of queued jobs.
+func (w *WebHTTPv1) SetDispatchPlan(p controller.DispatchPlan) {
+	w.dispatchPlan = p
+}
+
+// SetDatastoreHealth sets whether or not the datastore can be reached, which is shown in the status.
+func (w *WebHTTPv1) SetDatastoreHealth(h controller.DatastoreHealth) {
+	w.datastoreHealth = h
+}
+
+// SetLogFile sets the path of the current log file, which is shown in the status so that it is easy to find.
+func (w *WebHTTPv1) SetLogFile(path string) {
+	w.logFile = path
+}
+
+// SetMetricsSnapshot sets the latest snapshot of the metrics.
+func (w *WebHTTPv1) SetMetricsSnapshot(s controller.MetricsSnapshot) {
+	w.metricsSnapshot = s
+}
+
+// SetQueueAging sets how much the priority of a queued job rises per day that it waits, so that the effective priorities
+// of the queued jobs can be shown. 0 disables aging.
+func (w *WebHTTPv1) SetQueueAging(perDay float64) {
+	w.queueAging = perDay
+}
+
+// SetTrash sets the trash whose entries are listed and restored by the trash endpoints.
+func (w *WebHTTPv1) SetTrash(t *trash.Trash) {
+	w.trash = t
+}
+
+// SetNotifier sets the notifier that the test notifications are sent through.
+func (w *WebHTTPv1) SetNotifier(n *notifier.Dispatcher) {
+	w.notifier = n
+}
+
+// SetLibraryManager sets the Library Manager that the endpoints which can't wait for the next loop of Run call directly,
+// such as the kill switch.
+func (w *WebHTTPv1) SetLibraryManager(lm *library.Manager) {
+	w.libraryManager = lm
+}
+
 // nonRootIndexHandler serves up the index files for /running, /libraries, /history, and /settings.
 func (w *WebHTTPv1) nonRootIndexHandler(rw http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -113,7 +291,7 @@ func (w *WebHTTPv1) nonRootIndexHandler(rw http.ResponseWriter, r *http.Request)
 func (w *WebHTTPv1) getRunning(rw http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		dJobs, err := w.ds.DispatchedJobs()
+		dJobs, err := w.ds.DispatchedJobs(r.Context())
 		if err != nil {
 			w.logger.Error(err.Error())
 			rw.WriteHeader(http.StatusInternalServerError)
@@ -138,23 +316,76 @@ func (w *WebHTTPv1) getRunning(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getDispatched is a HTTP handler that returns every dispatched job record with its age and when its Runner was
+// last seen, so that the records can be inspected before orphaned ones are removed by the health checker.
+func (w *WebHTTPv1) getDispatched(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		dJobs, err := w.ds.DispatchedJobs(r.Context())
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		runners, err := w.ds.Runners(r.Context())
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		lastSeen := make(map[string]time.Time, len(runners))
+		for _, v := range runners {
+			lastSeen[v.Name] = v.LastSeen
+		}
+
+		resp := dispatchedRecordsJSON{Records: make([]dispatchedRecordJSON, 0, len(dJobs))}
+		for _, v := range dJobs {
+			record := dispatchedRecordJSON{
+				UUID:        v.UUID,
+				Path:        v.Job.Path,
+				RunnerName:  v.Runner,
+				LastUpdated: v.LastUpdated,
+				AgeSeconds:  int64(time.Since(v.LastUpdated) / time.Second),
+			}
+			if seen, ok := lastSeen[v.Runner]; ok {
+				record.RunnerLastSeen = &seen
+			}
+			resp.Records = append(resp.Records, record)
+		}
+
+		b, err := json.Marshal(resp)
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(b)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 // getHistory is a HTTP handler that returns the current history in a JSON response.
 func (w *WebHTTPv1) getHistory(rw http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		historyEntries, err := w.ds.HistoryEntries()
+		historyEntries, err := w.ds.HistoryEntries(r.Context())
 		if err != nil {
 			w.logger.Error(err.Error())
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		h := make([]humanizedHistoryEntry, len(historyEntries))
+		h := make([]webapi.HistoryEntry, len(historyEntries))
 
 		// Change datetime into human-readable format
 		for i, v := range historyEntries {
 			dt := v.DateTimeCompleted
-			h[i] = humanizedHistoryEntry{
+			h[i] = webapi.HistoryEntry{
 				File: v.Filename,
 				DateTimeCompleted: fmt.Sprintf("%02d-%02d-%d %02d:%02d:%02d",
 					dt.Month(), dt.Day(), dt.Year(),
@@ -165,7 +396,7 @@ func (w *WebHTTPv1) getHistory(rw http.ResponseWriter, r *http.Request) {
 		}
 
 		// Send JSON to client
-		historyJSONBytes, err := json.Marshal(historyJSON{h})
+		historyJSONBytes, err := json.Marshal(webapi.History{History: h})
 		if err != nil {
 			w.logger.Error("error marshaling Job histroy to json: %v", err)
 			rw.WriteHeader(http.StatusInternalServerError)
@@ -183,11 +414,7 @@ func (w *WebHTTPv1) getHistory(rw http.ResponseWriter, r *http.Request) {
 func (w *WebHTTPv1) settings(rw http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		rS := settingsJSON{
-			HealthCheckInterval: time.Duration(w.ss.HealthCheckInterval()).String(),
-			HealthCheckTimeout:  time.Duration(w.ss.HealthCheckTimeout()).String(),
-			LogVerbosity:        w.ss.LogVerbosity(),
-		}
+		rS := w.currentSettings()
 		b, err := json.Marshal(rS)
 		if err != nil {
 			w.logger.Error("failed to marshal settingsJSON: %v", err)
@@ -204,11 +431,7 @@ func (w *WebHTTPv1) settings(rw http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		rS := settingsJSON{
-			HealthCheckInterval: time.Duration(w.ss.HealthCheckInterval()).String(),
-			HealthCheckTimeout:  time.Duration(w.ss.HealthCheckTimeout()).String(),
-			LogVerbosity:        w.ss.LogVerbosity(),
-		}
+		rS := w.currentSettings()
 		err = json.Unmarshal(b, &rS)
 		if err != nil {
 			w.logger.Error(fmt.Sprintf("Failed to unmarshal settings put request body: %v", err))
@@ -216,22 +439,19 @@ func (w *WebHTTPv1) settings(rw http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		td, err := time.ParseDuration(rS.HealthCheckInterval)
-		if err == nil {
-			w.ss.SetHealthCheckInterval(uint64(td))
+		if err = validateSecrets(rS.SetSecrets); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
 		}
 
-		td, err = time.ParseDuration(rS.HealthCheckTimeout)
-		if err == nil {
-			w.ss.SetHealthCheckTimeout(uint64(td))
+		if !rS.StaleJobAction.Valid() {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Sprintf("invalid StaleJobAction '%v'", rS.StaleJobAction)))
+			return
 		}
 
-		w.ss.SetLogVerbosity(rS.LogVerbosity)
-
-		err = w.ss.Save()
-		if err != nil {
-			w.logger.Error(err.Error())
-		}
+		w.applySettings(rS)
 
 		rw.WriteHeader(http.StatusCreated)
 	default:
@@ -239,176 +459,1790 @@ func (w *WebHTTPv1) settings(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getWaitingRunners is a HTTP handler that returns all runners waiting for a job in a JSON response.
-func (w *WebHTTPv1) getWaitingRunners(rw http.ResponseWriter, r *http.Request) {
+// search is a HTTP handler that returns the files across all queues, dispatched jobs, and history that match the "q" query parameter.
+// The amount of results can be set using the "limit" query parameter.
+func (w *WebHTTPv1) search(rw http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		b, err := json.Marshal(struct {
-			Runners []string `json:"Runners"`
-		}{w.waitingRunnersCache})
+		q := r.URL.Query().Get("q")
+		if q == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		limit := defaultSearchLimit
+		if l := r.URL.Query().Get("limit"); l != "" {
+			parsed, err := strconv.Atoi(l)
+			if err != nil || parsed <= 0 {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+		if limit > maxSearchLimit {
+			limit = maxSearchLimit
+		}
+
+		results, more, err := w.ds.SearchFiles(r.Context(), q, limit)
 		if err != nil {
 			w.logger.Error(err.Error())
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
+		b, err := json.Marshal(searchJSON{Results: results, MoreAvailable: more})
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
 		rw.Write(b)
 	default:
 		rw.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-// getAllLibraryIDs is a HTTP handler that returns all of the library's IDs
-func (w *WebHTTPv1) getAllLibraryIDs(rw http.ResponseWriter, r *http.Request) {
+// queryFiles is a HTTP handler that returns the number of files whose latest metadata snapshot matches the query parameters,
+// along with the paths of the first "limit" of them. The supported filters are "library", "video_codec", "container", "hdr",
+// and the "min_" and "max_" variants of "height", "size" (bytes), and "duration" (seconds).
+func (w *WebHTTPv1) queryFiles(rw http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		ids := make([]int, len(w.libraryCache))
-		for k, v := range w.libraryCache {
-			ids[k] = v.ID
+		filter, limit, err := parseFileSnapshotQuery(r.URL.Query())
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+
+		paths, count, err := w.ds.QueryFileSnapshots(r.Context(), filter, limit)
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
 		}
 
-		b, err := json.Marshal(struct{ IDs []int }{ids})
+		b, err := json.Marshal(fileSnapshotsJSON{Count: count, Paths: paths})
 		if err != nil {
 			w.logger.Error(err.Error())
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
+		rw.Header().Set("Content-Type", "application/json")
 		rw.Write(b)
 	default:
 		rw.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-// handleLibrary is a HTTP handler than takes care of the management of a Library
-func (w *WebHTTPv1) handleLibrary(rw http.ResponseWriter, r *http.Request) {
-	libraryID := r.URL.Path[len("/api/web/v1/library/"):]
-
-	if libraryID == "new" && r.Method == http.MethodPost {
-		readBytes, err := io.ReadAll(r.Body)
+// getWaitingRunners is a HTTP handler that returns all runners waiting for a job in a JSON response.
+func (w *WebHTTPv1) getWaitingRunners(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		b, err := json.Marshal(struct {
+			Runners []string `json:"Runners"`
+		}{w.waitingRunnersCache})
 		if err != nil {
 			w.logger.Error(err.Error())
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		interimNewLib := interimLibraryJSON{}
-		err = json.Unmarshal(readBytes, &interimNewLib)
-		if err != nil {
-			w.logger.Error(err.Error())
-			rw.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		rw.Write(b)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
 
-		newLib := controller.Library{
-			Folder:    interimNewLib.Folder,
-			Priority:  interimNewLib.Priority,
-			PathMasks: interimNewLib.PathMasks,
-		}
+// getMetrics is a HTTP handler that returns the latest snapshot of the metrics as JSON.
+func (w *WebHTTPv1) getMetrics(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
 
-		td, err := time.ParseDuration(interimNewLib.FsCheckInterval)
-		if err == nil {
-			newLib.FsCheckInterval = td
-		}
+	b, err := json.Marshal(w.metricsSnapshot)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-		// Create map of library IDs (for fast valid ID lookup)
-		libIDMap := map[int]struct{}{}
-		for _, v := range w.libraryCache {
-			libIDMap[v.ID] = struct{}{}
-		}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
 
-		// Find valid ID
-		var validID int
-		for i := 0; i < 10_000; i++ {
-			_, ok := libIDMap[i]
-			if !ok {
-				validID = i
-				break
-			}
-		}
-		newLib.ID = validID
+// getStatus is a HTTP handler that returns the overall health of the Controller, including whether
+// the no runners alert is raised and whether the datastore is down.
+func (w *WebHTTPv1) getStatus(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
 
-		// Put new lib in a.libSettingsUpdates with located valid id
-		w.libSettingsUpdates[newLib.ID] = newLib
+	resp := statusJSON{
+		NoRunners:         !w.noRunnersSince.IsZero(),
+		WaitingRunners:    len(w.waitingRunnersCache),
+		ScanningLibraries: len(w.scanningLibraries),
+		AwaitingSpace:     make([]awaitingSpaceJSON, 0, len(w.awaitingSpaceJobs)),
+		LogFile:           w.logFile,
+	}
+	for _, job := range w.awaitingSpaceJobs {
+		resp.AwaitingSpace = append(resp.AwaitingSpace, awaitingSpaceJSON{
+			UUID:      job.UUID,
+			LibraryID: job.LibraryID,
+			Path:      job.Path,
+		})
+	}
+	if resp.NoRunners {
+		since := w.noRunnersSince
+		resp.NoRunnersSince = &since
+	}
+	if h := w.datastoreHealth; h.Down {
+		resp.DatastoreDown = true
+		resp.DatastoreDownSince = &h.FailingSince
+		resp.DatastoreError = h.LastError
+	}
 
-		rw.WriteHeader(http.StatusCreated)
-		rw.Write([]byte(fmt.Sprintf("http://%v/api/web/v1/library/%v", r.Host, newLib.ID)))
+	b, err := json.Marshal(resp)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	// Transform the string libraryID into an int intLibID
-	temp, err := strconv.ParseInt(libraryID, 0, 0)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
+
+// getHealthActions is a HTTP handler that returns how many times the health checker has taken each action with
+// stale jobs, along with its most recent actions. The amount of actions can be set using the "limit" query parameter.
+func (w *WebHTTPv1) getHealthActions(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := defaultHealthActionsLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	if limit > maxHealthActionsLimit {
+		limit = maxHealthActionsLimit
+	}
+
+	counts, err := w.ds.HealthCheckActionCounts(r.Context())
 	if err != nil {
 		w.logger.Error(err.Error())
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	intLibID := int(temp)
 
-	// Validate libraryID (and pull the matching library out of the cache).
-	var lib controller.Library
-	validID := false
-	for _, v := range w.libraryCache {
-		if intLibID == v.ID {
-			validID = true
-			lib = v
-			break
-		}
+	actions, err := w.ds.HealthCheckActions(r.Context(), limit)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
-	if !validID {
-		w.logger.Error("invalid library ID '%v' requested", intLibID)
-		rw.WriteHeader(http.StatusBadRequest)
+	b, err := json.Marshal(healthActionsJSON{Counts: counts, Actions: actions})
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
+
+// handleRunners is a HTTP handler that returns every known Runner along with its live status (GET),
+// or deletes the Runners that haven't been seen within the duration set by the "stale_after" query parameter (DELETE).
+func (w *WebHTTPv1) handleRunners(rw http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		toSend := interimLibraryJSON{lib.ID, lib.Folder, lib.Priority, lib.FsCheckInterval.String(), lib.Queue, lib.PathMasks, lib.CommandDeciderSettings}
-		b, err := json.Marshal(toSend)
+		runners, err := w.ds.Runners(r.Context())
 		if err != nil {
 			w.logger.Error(err.Error())
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		rw.Header().Set("Content-Type", "application/json")
-		rw.Write(b)
-	case http.MethodPut:
-		// Technically, there is a security flaw where an attacker can set the id in their request
-		// to a different library and overwrite a different library, but it's not like this API is locked down at all
-		// so does it really matter?
-		readBytes, err := io.ReadAll(r.Body)
+		dJobs, err := w.ds.DispatchedJobs(r.Context())
 		if err != nil {
 			w.logger.Error(err.Error())
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		uLib := interimLibraryJSON{}
-		err = json.Unmarshal(readBytes, &uLib)
+		waiting := make(map[string]bool, len(w.waitingRunnersCache))
+		for _, v := range w.waitingRunnersCache {
+			waiting[v] = true
+		}
+
+		resp := webapi.Runners{Runners: make([]webapi.Runner, len(runners))}
+		for i, v := range runners {
+			rJSON := webapi.Runner{
+				Runner:      v,
+				Online:      w.runnerOfflineThreshold <= 0 || time.Since(v.LastSeen) < w.runnerOfflineThreshold,
+				Waiting:     waiting[v.Name],
+				CurrentJobs: make([]controller.UUID, 0),
+			}
+			for _, dJob := range dJobs {
+				if dJob.Runner == v.Name {
+					rJSON.CurrentJobs = append(rJSON.CurrentJobs, dJob.UUID)
+				}
+			}
+			resp.Runners[i] = rJSON
+		}
+
+		b, err := json.Marshal(resp)
 		if err != nil {
 			w.logger.Error(err.Error())
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		lib.Folder = uLib.Folder
-		lib.Priority = uLib.Priority
-		lib.PathMasks = uLib.PathMasks
-		lib.CommandDeciderSettings = uLib.CommandDeciderSettings
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(b)
+	case http.MethodDelete:
+		staleAfter, err := time.ParseDuration(r.URL.Query().Get("stale_after"))
+		if err != nil || staleAfter <= 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
 
-		td, err := time.ParseDuration(uLib.FsCheckInterval)
+		deleted, err := w.ds.DeleteStaleRunners(r.Context(), time.Now().Add(-staleAfter))
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		b, err := json.Marshal(struct {
+			Deleted int `json:"deleted"`
+		}{deleted})
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(b)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRunner is a HTTP handler for renaming (PUT) and deleting (DELETE) a specific Runner.
+func (w *WebHTTPv1) handleRunner(rw http.ResponseWriter, r *http.Request) {
+	runnerUUID := controller.UUID(r.URL.Path[len("/api/web/v1/runner/"):])
+	if runnerUUID == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		b, rErr := io.ReadAll(r.Body)
+		if rErr != nil {
+			w.logger.Error(rErr.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		body := struct {
+			DisplayName string `json:"display_name"`
+		}{}
+		if rErr = json.Unmarshal(b, &body); rErr != nil || body.DisplayName == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err = w.ds.RenameRunner(r.Context(), runnerUUID, body.DisplayName)
+	case http.MethodDelete:
+		err = w.ds.DeleteRunner(r.Context(), runnerUUID)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err == sql.ErrNoRows {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// getJob is a HTTP handler that returns everything known about a single job, whether it is queued,
+// dispatched, or in the history.
+func (w *WebHTTPv1) getJob(rw http.ResponseWriter, r *http.Request) {
+	jobUUID := controller.UUID(r.URL.Path[len("/api/web/v1/job/"):])
+	if strings.HasSuffix(string(jobUUID), "/move") {
+		w.moveJob(rw, r, controller.UUID(strings.TrimSuffix(string(jobUUID), "/move")))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if strings.HasSuffix(string(jobUUID), "/timeline") {
+		w.getJobTimeline(rw, r, controller.UUID(strings.TrimSuffix(string(jobUUID), "/timeline")))
+		return
+	}
+	if jobUUID == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	detail, found, err := w.jobDetail(r.Context(), jobUUID)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if !found {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	detail.CommandLine = commandLine(detail.Job.Command)
+
+	b, err := json.Marshal(detail)
+	if err != nil {
+		w.logger.Error("failed to marshal jobDetailJSON: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
+
+// moveJob is a HTTP handler which moves the queued job with the provided UUID to the end of the queue of the library
+// in the "library_id" field of the request body. The job's command is decided again under the settings of that library.
+func (w *WebHTTPv1) moveJob(rw http.ResponseWriter, r *http.Request, jobUUID controller.UUID) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if w.libraryManager == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body := struct {
+		LibraryID *int `json:"library_id"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.LibraryID == nil || jobUUID == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err := w.libraryManager.MoveJob(jobUUID, *body.LibraryID)
+	switch {
+	case err == nil:
+		rw.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, controller.ErrJobNotFound):
+		rw.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, sql.ErrNoRows):
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(fmt.Sprintf("there isn't a library with the ID %v", *body.LibraryID)))
+	case errors.Is(err, controller.ErrJobDispatched), errors.Is(err, controller.ErrJobNotMovable):
+		rw.WriteHeader(http.StatusConflict)
+		rw.Write([]byte(err.Error()))
+	default:
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// getJobTimeline is a HTTP handler that returns the log records about a single job, oldest first. The records outlive
+// the job, so a job which has left the history still has a timeline until the records expire.
+func (w *WebHTTPv1) getJobTimeline(rw http.ResponseWriter, r *http.Request, jobUUID controller.UUID) {
+	if jobUUID == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	events, err := w.ds.JobEvents(r.Context(), jobUUID)
+	if err != nil {
+		w.logger.Error("failed to get the timeline of job %v: %v", jobUUID, err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(jobTimelineJSON{UUID: jobUUID, Events: events})
+	if err != nil {
+		w.logger.Error("failed to marshal jobTimelineJSON: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
+
+// jobDetail looks for the job with the provided UUID in the library queues, the jobs awaiting space, the dispatched jobs,
+// and the history, in that order.
+func (w *WebHTTPv1) jobDetail(ctx context.Context, jobUUID controller.UUID) (detail jobDetailJSON, found bool, err error) {
+	for _, lib := range w.libraryCache {
+		for _, job := range lib.Queue.Items {
+			if job.UUID == jobUUID {
+				detail = jobDetailJSON{State: "queued", LibraryID: lib.ID, Job: job, QueuePosition: w.dispatchPlan.Positions[job.UUID]}
+				if start, ok := w.estimatedStarts(ctx)[job.UUID]; ok {
+					detail.EstimatedStart = &start
+				}
+				return detail, true, nil
+			}
+		}
+	}
+
+	for _, job := range w.awaitingSpaceJobs {
+		if job.UUID == jobUUID {
+			return jobDetailJSON{State: "awaiting_space", LibraryID: job.LibraryID, Job: job}, true, nil
+		}
+	}
+
+	dJobs, err := w.ds.DispatchedJobs(ctx)
+	if err != nil {
+		return detail, false, err
+	}
+
+	for _, dJob := range dJobs {
+		if dJob.UUID == jobUUID {
+			return jobDetailJSON{
+				State:       "dispatched",
+				LibraryID:   dJob.Job.LibraryID,
+				Job:         dJob.Job,
+				Runner:      dJob.Runner,
+				Status:      &dJob.Status,
+				LastUpdated: &dJob.LastUpdated,
+			}, true, nil
+		}
+	}
+
+	h, err := w.ds.HistoryEntry(ctx, jobUUID)
+	if err == sql.ErrNoRows {
+		return detail, false, nil
+	} else if err != nil {
+		return detail, false, err
+	}
+
+	detail = jobDetailJSON{
+		State:             "completed",
+		LibraryID:         h.Job.LibraryID,
+		Job:               h.Job,
+		Runner:            h.Runner,
+		DateTimeCompleted: &h.DateTimeCompleted,
+		Warnings:          h.Warnings,
+		Errors:            h.Errors,
+		Output:            h.Output,
+		Completion:        h.Completion,
+		OriginalPath:      h.OriginalPath,
+		OriginalRestored:  h.OriginalRestored,
+	}
+	if h.Failed {
+		detail.State = "failed"
+	}
+
+	return detail, true, nil
+}
+
+// estimatedStarts returns when each of the queued jobs in the dispatch plan is expected to be dispatched by the Runners
+// which are connected now. nil is returned if they can't be estimated.
+func (w *WebHTTPv1) estimatedStarts(ctx context.Context) map[controller.UUID]time.Time {
+	if w.dispatchPlan.Paused || len(w.dispatchPlan.Positions) == 0 {
+		return nil
+	}
+
+	dJobs, err := w.ds.DispatchedJobs(ctx)
+	if err != nil {
+		w.logger.Error("failed to get the dispatched jobs to estimate start times: %v", err)
+		return nil
+	}
+	return estimateStarts(w.dispatchPlan, w.waitingRunnersCache, dJobs, time.Now())
+}
+
+// handleConfig is a HTTP handler for exporting and importing the Controller's configuration as a single JSON document.
+// Importing with the dry_run query parameter set to true reports what would change without applying anything.
+func (w *WebHTTPv1) handleConfig(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		b, err := json.Marshal(exportConfig(w.libraryCache, w.currentSettings()))
+		if err != nil {
+			w.logger.Error("failed to marshal configJSON: %v", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Content-Disposition", `attachment; filename="encodarr-config.json"`)
+		rw.Write(b)
+	case http.MethodPost:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.logger.Error(fmt.Sprintf("Failed to read request body: %v", err))
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		doc := configJSON{}
+		if err = json.Unmarshal(b, &doc); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// Folders are canonicalized before planning so that different spellings of a folder are detected as conflicts.
+		for i := range doc.Libraries {
+			doc.Libraries[i].Folder = w.paths.Canonicalize(doc.Libraries[i].Folder)
+		}
+
+		var validate func(controller.Library) []controller.ValidationIssue
+		if w.libraryManager != nil {
+			validate = w.libraryManager.ValidateLibrary
+		}
+		toSave, report := planImport(doc, w.libraryCache, w.currentSettings(), validate)
+		report.DryRun = r.URL.Query().Get("dry_run") == "true"
+
+		statusCode := http.StatusOK
+		if len(report.Errors) > 0 || len(report.Conflicts) > 0 {
+			statusCode = http.StatusUnprocessableEntity
+		} else if !report.DryRun {
+			if err = w.ds.ImportLibraries(r.Context(), toSave); err != nil {
+				w.logger.Error(err.Error())
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if doc.Settings != nil {
+				w.applySettings(*doc.Settings)
+			}
+
+			report.Applied = true
+			w.logger.Info("Imported configuration: %v created, %v updated", len(report.Created), len(report.Updated))
+		}
+
+		rb, err := json.Marshal(report)
+		if err != nil {
+			w.logger.Error("failed to marshal importReportJSON: %v", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(statusCode)
+		rw.Write(rb)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// importTdarr marks the files that Tdarr transcoded as processed and quarantines the ones that errored in Tdarr,
+// reading them from the Tdarr database export in the request body. The rewrite_from and rewrite_to query parameters
+// replace the prefix of the exported paths, and dry_run=true only reports what would be imported.
+func (w *WebHTTPv1) importTdarr(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	files, err := tdarr.Parse(r.Body)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	q := r.URL.Query()
+	rewrite := pathRewrite{From: q.Get("rewrite_from"), To: q.Get("rewrite_to")}
+	processed, quarantined, report := planTdarrImport(files, rewrite, w.libraryCache, w.paths.Canonicalize, os.Stat, time.Now())
+	report.DryRun = q.Get("dry_run") == "true"
+
+	if !report.DryRun {
+		if err = w.ds.ImportFileStates(r.Context(), processed, quarantined); err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		report.Applied = true
+		w.logger.Info("Imported from Tdarr: %v transcoded files marked as processed, %v errored files quarantined, %v unmatched",
+			report.MatchedTranscoded, report.MatchedErrored, report.UnmatchedCount)
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		w.logger.Error("failed to marshal tdarrImportReportJSON: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
+
+// currentSettings returns the current Controller settings as a settingsJSON.
+func (w *WebHTTPv1) currentSettings() settingsJSON {
+	compressQueues := w.ss.CompressQueues()
+	mediaServer := w.ss.MediaServer()
+	notifications := w.ss.Notifications()
+	return settingsJSON{
+		CompressQueues:      &compressQueues,
+		MediaServer:         &mediaServer,
+		Notifications:       &notifications,
+		HealthCheckInterval: time.Duration(w.ss.HealthCheckInterval()).String(),
+		HealthCheckTimeout:  time.Duration(w.ss.HealthCheckTimeout()).String(),
+		LogVerbosity:        w.ss.LogVerbosity(),
+		LogLevels:           w.ss.LogLevels(),
+		MaxJobAttempts:      w.ss.MaxJobAttempts(),
+		QuarantineExpiry:    time.Duration(w.ss.QuarantineExpiry()).String(),
+		QueryTimeout:        time.Duration(w.ss.QueryTimeout()).String(),
+		StaleJobAction:      controller.StaleJobAction(w.ss.StaleJobAction()),
+		Secrets:             redactedSecrets(w.ss),
+	}
+}
+
+// applySettings sets and saves the valid values from the provided settingsJSON.
+func (w *WebHTTPv1) applySettings(rS settingsJSON) {
+	td, err := time.ParseDuration(rS.HealthCheckInterval)
+	if err == nil {
+		w.ss.SetHealthCheckInterval(uint64(td))
+	}
+
+	td, err = time.ParseDuration(rS.HealthCheckTimeout)
+	if err == nil {
+		w.ss.SetHealthCheckTimeout(uint64(td))
+	}
+
+	w.ss.SetLogVerbosity(rS.LogVerbosity)
+
+	if rS.LogLevels != nil && validateLogLevels(rS.LogLevels) == nil {
+		w.ss.SetLogLevels(rS.LogLevels)
+	}
+
+	if rS.CompressQueues != nil {
+		w.ss.SetCompressQueues(*rS.CompressQueues)
+	}
+
+	if rS.MaxJobAttempts > 0 {
+		w.ss.SetMaxJobAttempts(rS.MaxJobAttempts)
+	}
+
+	if rS.MediaServer != nil && rS.MediaServer.Type.Valid() {
+		w.ss.SetMediaServer(*rS.MediaServer)
+	}
+
+	if rS.Notifications != nil && len(validateNotifications(*rS.Notifications)) == 0 {
+		w.ss.SetNotifications(*rS.Notifications)
+	}
+
+	if td, err = time.ParseDuration(rS.QuarantineExpiry); err == nil && td >= 0 {
+		w.ss.SetQuarantineExpiry(uint64(td))
+	}
+
+	if td, err = time.ParseDuration(rS.QueryTimeout); err == nil && td >= 0 {
+		w.ss.SetQueryTimeout(uint64(td))
+	}
+
+	if rS.StaleJobAction != "" && rS.StaleJobAction.Valid() {
+		w.ss.SetStaleJobAction(string(rS.StaleJobAction))
+	}
+
+	// Secrets are only ever written through SetSecrets so that settings which were read and sent back
+	// don't overwrite them with the redacted values.
+	for name, v := range rS.SetSecrets {
+		if isSecretSetting(name) {
+			w.ss.SetSecret(name, v)
+		}
+	}
+
+	if err = w.ss.Save(); err != nil {
+		w.logger.Error(err.Error())
+	}
+}
+
+// scanLibrary is a HTTP handler which requests an immediate scan of the library with the provided ID.
+func (w *WebHTTPv1) scanLibrary(rw http.ResponseWriter, r *http.Request, libraryID string) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, ok := w.idleLibraryID(rw, libraryID)
+	if !ok {
+		return
+	}
+
+	w.requestsMu.Lock()
+	w.scanRequests = append(w.scanRequests, id)
+	w.requestsMu.Unlock()
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// requeueLibrary is a HTTP handler which requests that every file in the library with the provided ID is queued again,
+// including the ones which have already been processed. Because that can mean re-encoding a whole library, the request
+// must be confirmed with the confirm=true query parameter.
+func (w *WebHTTPv1) requeueLibrary(rw http.ResponseWriter, r *http.Request, libraryID string) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Query().Get("confirm") != "true" {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte("requeuing a library processes all of its files again, repeat the request with ?confirm=true to proceed"))
+		return
+	}
+
+	id, ok := w.idleLibraryID(rw, libraryID)
+	if !ok {
+		return
+	}
+
+	w.requestsMu.Lock()
+	w.requeueRequests = append(w.requeueRequests, id)
+	w.requestsMu.Unlock()
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// previewScan is a HTTP handler which returns the jobs that a fresh scan of the library with the provided ID would queue,
+// without queueing them. Files which are queued or dispatched already are included as if they weren't.
+func (w *WebHTTPv1) previewScan(rw http.ResponseWriter, r *http.Request, libraryID string) {
+	if r.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if w.libraryManager == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	id, err := strconv.Atoi(libraryID)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := w.libraryManager.PreviewScan(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(webapi.ScanPreview{Jobs: jobs})
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
+
+// drainLibrary is a HTTP handler which stops (drain) or resumes (undrain) the dispatching of the jobs of the library
+// with the provided ID. A drained library is still scanned and its dispatched jobs are still imported.
+func (w *WebHTTPv1) drainLibrary(rw http.ResponseWriter, r *http.Request, libraryID string, drain bool) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if w.libraryManager == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	id, err := strconv.Atoi(libraryID)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if drain {
+		err = w.libraryManager.DrainLibrary(id)
+	} else {
+		err = w.libraryManager.UndrainLibrary(id)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// restoreLibrary is a HTTP handler which restores the deleted library with the provided ID,
+// as long as it hasn't been purged yet.
+func (w *WebHTTPv1) restoreLibrary(rw http.ResponseWriter, r *http.Request, libraryID string) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(libraryID)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = w.ds.RestoreLibrary(r.Context(), id)
+	if err == sql.ErrNoRows {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.logger.Info("Restored library %v", id)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// validateLibrary checks lib with the Library Manager before it is created (isNew) or updated. If any of the issues it
+// finds is an error, every issue is written to rw with a 400 status and ok is false. Warnings alone are only logged.
+// New libraries are given the default CommandDecider settings, so their settings aren't checked.
+func (w *WebHTTPv1) validateLibrary(rw http.ResponseWriter, lib controller.Library, isNew bool) (ok bool) {
+	if w.libraryManager == nil {
+		return true
+	}
+
+	issues := make([]controller.ValidationIssue, 0)
+	failed := false
+	for _, v := range w.libraryManager.ValidateLibrary(lib) {
+		if isNew && v.Field == "command_decider_settings" {
+			continue
+		}
+		issues = append(issues, v)
+
+		if v.Severity == controller.ValidationError {
+			failed = true
+		} else {
+			w.logger.Warn("Library %v: %v", lib.ID, v.Message)
+		}
+	}
+	if !failed {
+		return true
+	}
+
+	b, err := json.Marshal(libraryIssuesJSON{Issues: issues})
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusBadRequest)
+	rw.Write(b)
+	return false
+}
+
+// idleLibraryID parses libraryID and makes sure that it belongs to a known library which isn't being scanned.
+// If it doesn't, an appropriate status is written to rw and ok is false.
+func (w *WebHTTPv1) idleLibraryID(rw http.ResponseWriter, libraryID string) (id int, ok bool) {
+	id, err := strconv.Atoi(libraryID)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return 0, false
+	}
+
+	validID := false
+	for _, v := range w.libraryCache {
+		if v.ID == id {
+			validID = true
+			break
+		}
+	}
+
+	if !validID {
+		rw.WriteHeader(http.StatusNotFound)
+		return 0, false
+	}
+
+	for _, v := range w.scanningLibraries {
+		if v == id {
+			rw.WriteHeader(http.StatusConflict)
+			return 0, false
+		}
+	}
+
+	return id, true
+}
+
+// clearQuarantine is a HTTP handler which takes a path out of quarantine so that it can be queued again.
+func (w *WebHTTPv1) clearQuarantine(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body := struct {
+		Path string `json:"path"`
+	}{}
+	if err = json.Unmarshal(b, &body); err != nil || body.Path == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body.Path = w.paths.Canonicalize(body.Path)
+	err = w.ds.ClearQuarantine(r.Context(), body.Path)
+	if err == sql.ErrNoRows {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.logger.Info("Cleared quarantine of %v", body.Path)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// getSkippedPaths is a HTTP handler that returns the paths which were recorded as completed externally, sorted by path.
+func (w *WebHTTPv1) getSkippedPaths(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	skipped, err := w.ds.SkippedPaths(r.Context())
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(skippedPathsJSON{Paths: skipped})
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
+
+// importSkippedPaths is a HTTP handler which records the newline-delimited absolute paths and globs in the request body
+// as completed externally, so that scans never queue them.
+func (w *WebHTTPv1) importSkippedPaths(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	skipped, report, err := planSkipImport(r.Body, w.paths.Canonicalize, filepath.Glob, os.Stat, time.Now())
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	if err = w.ds.SkipPaths(r.Context(), skipped); err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.logger.Info("Recorded %v paths as completed externally, %v globs unmatched", report.Skipped, len(report.Unmatched))
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		w.logger.Error("failed to marshal skipImportReportJSON: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
+
+// removeSkippedPath is a HTTP handler which removes a path from the paths completed externally so that it can be queued again.
+func (w *WebHTTPv1) removeSkippedPath(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body := struct {
+		Path string `json:"path"`
+	}{}
+	if err = json.Unmarshal(b, &body); err != nil || body.Path == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body.Path = w.paths.Canonicalize(body.Path)
+	err = w.ds.UnskipPath(r.Context(), body.Path)
+	if err == sql.ErrNoRows {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.logger.Info("%v is no longer recorded as completed externally", body.Path)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// handleBenchmarks is a HTTP handler which queues benchmarks of a file on POST and returns the recorded benchmarks,
+// optionally of a single path, on GET.
+func (w *WebHTTPv1) handleBenchmarks(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		results, err := w.ds.BenchmarkResults(r.Context(), r.URL.Query().Get("path"))
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		b, err := json.Marshal(benchmarksJSON{Results: results, Comparison: compareBenchmarks(results)})
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(b)
+	case http.MethodPost:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var body benchmarkRequestJSON
+		if err = json.Unmarshal(b, &body); err != nil || body.Path == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		reqs, err := planBenchmarks(body, w.libraryCache, w.paths.Canonicalize, os.Stat)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		w.requestsMu.Lock()
+		w.benchmarkRequests = append(w.benchmarkRequests, reqs...)
+		w.requestsMu.Unlock()
+
+		queued := benchmarksQueuedJSON{UUIDs: make([]controller.UUID, len(reqs))}
+		for i, req := range reqs {
+			queued.UUIDs[i] = req.UUID
+		}
+		w.logger.Info("Queued %v benchmarks of %v", len(reqs), reqs[0].Path)
+
+		b, err = json.Marshal(queued)
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusAccepted)
+		rw.Write(b)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// getTrash is a HTTP handler that returns the original files in the trash, oldest first, along with where each of
+// them is restored to.
+func (w *WebHTTPv1) getTrash(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	toSend := trashJSON{Entries: make([]trashEntryJSON, 0)}
+	if w.trash != nil {
+		entries, err := w.trash.Entries()
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		for _, entry := range entries {
+			h, restoreTo := w.trashEntryOrigin(r.Context(), entry)
+			toSend.Entries = append(toSend.Entries, trashEntryJSON{Entry: entry, JobUUID: h.UUID, RestoreTo: restoreTo})
+		}
+	}
+
+	b, err := json.Marshal(toSend)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
+
+// restoreTrashEntry is a HTTP handler that moves the original file in the trash at the provided path back to where
+// it came from and records on its history entry that it was restored. The transcoded file is replaced if it has the
+// same path as the original.
+func (w *WebHTTPv1) restoreTrashEntry(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if w.trash == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body := struct {
+		Path string `json:"path"`
+	}{}
+	if err = json.Unmarshal(b, &body); err != nil || body.Path == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	entry, err := w.trash.Entry(body.Path)
+	if err != nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	h, restoreTo := w.trashEntryOrigin(r.Context(), entry)
+	if restoreTo == "" {
+		rw.WriteHeader(http.StatusConflict)
+		rw.Write([]byte("where the entry came from is unknown because neither its history entry nor its library exist anymore"))
+		return
+	}
+
+	if err = w.trash.Restore(entry.Path, restoreTo); errors.Is(err, trash.ErrNotAnEntry) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if h.UUID != "" {
+		if err = w.ds.MarkOriginalRestored(r.Context(), h.UUID); err != nil {
+			w.logger.Error("failed to mark the original of job %v as restored: %v", h.UUID, err)
+		}
+	}
+
+	w.logger.Info("Restored %v from the trash to %v", entry.Path, restoreTo)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// trashEntryOrigin returns the history entry of the job whose original is entry, along with where entry is restored to.
+// That is the path of the job, or the entry's relative path in its library if there isn't a history entry.
+// The returned path is empty if neither the history entry nor the library exist.
+func (w *WebHTTPv1) trashEntryOrigin(ctx context.Context, entry trash.Entry) (controller.History, string) {
+	h, err := w.ds.HistoryEntryByOriginalPath(ctx, entry.Path)
+	if err == nil {
+		return h, h.Job.Path
+	} else if err != sql.ErrNoRows {
+		w.logger.Error(err.Error())
+	}
+
+	for _, lib := range w.libraryCache {
+		if lib.ID == entry.LibraryID {
+			return controller.History{}, filepath.Join(lib.Folder, entry.RelativePath)
+		}
+	}
+	return controller.History{}, ""
+}
+
+// backup is a HTTP handler that streams a snapshot of the database as a download.
+func (w *WebHTTPv1) backup(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The headers aren't sent until the snapshot starts being written, which only happens after it has been verified.
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="encodarr-backup-%v.db"`, time.Now().Format("20060102-150405")))
+
+	cw := &countingWriter{w: rw}
+	err := w.ds.Backup(cw)
+
+	switch {
+	case err == nil:
+		w.logger.Info("Database backup downloaded (%v bytes)", cw.n)
+	case cw.n > 0:
+		// The download has already started, so all that can be done is to cut it short.
+		w.logger.Error("backup failed part way through the download: %v", err)
+	case errors.Is(err, controller.ErrBackupNotSupported):
+		rw.Header().Del("Content-Type")
+		rw.Header().Del("Content-Disposition")
+		rw.WriteHeader(http.StatusNotImplemented)
+	default:
+		w.logger.Error("backup failed: %v", err)
+		rw.Header().Del("Content-Type")
+		rw.Header().Del("Content-Disposition")
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// processing is a HTTP handler which shows (GET) or sets (PUT) whether or not the Library Manager starts scans and
+// dispatches jobs. Disabling it stops all processing without stopping the Controller, and it stays disabled until it is
+// enabled again or the Controller restarts.
+func (w *WebHTTPv1) processing(rw http.ResponseWriter, r *http.Request) {
+	if w.libraryManager == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		body := struct {
+			Enabled *bool `json:"enabled"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(`the body must be {"enabled": true} or {"enabled": false}`))
+			return
+		}
+		w.libraryManager.SetProcessingEnabled(*body.Enabled)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := json.Marshal(webapi.Processing{Enabled: w.libraryManager.ProcessingEnabled()})
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
+
+// testNotification is a HTTP handler that sends a test message to the notification channel named by the optional
+// "channel" field of the request body, or to every channel, and returns whether it was sent to each of them.
+func (w *WebHTTPv1) testNotification(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if w.notifier == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body := struct {
+		Channel string `json:"channel"`
+	}{}
+	if len(b) > 0 {
+		if err = json.Unmarshal(b, &body); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := w.notifier.SendTest(r.Context(), body.Channel)
+	if errors.Is(err, notifier.ErrUnknownChannel) {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	resp := struct {
+		Results []testNotificationJSON `json:"results"`
+	}{Results: make([]testNotificationJSON, 0, len(results))}
+	for _, res := range results {
+		j := testNotificationJSON{Channel: res.Channel, Sent: res.Err == nil}
+		if res.Err != nil {
+			j.Error = res.Err.Error()
+		}
+		resp.Results = append(resp.Results, j)
+	}
+
+	b, err = json.Marshal(resp)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(b)
+}
+
+// getAllLibraryIDs is a HTTP handler that returns all of the library's IDs
+func (w *WebHTTPv1) getAllLibraryIDs(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ids := make([]int, len(w.libraryCache))
+		for k, v := range w.libraryCache {
+			ids[k] = v.ID
+		}
+
+		b, err := json.Marshal(webapi.LibraryIDs{IDs: ids})
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Write(b)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// getDeletedLibraries is a HTTP handler which lists the libraries that have been deleted but can still be restored.
+func (w *WebHTTPv1) getDeletedLibraries(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	libs, err := w.ds.DeletedLibraries(r.Context())
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := deletedLibrariesJSON{Libraries: make([]deletedLibraryJSON, len(libs))}
+	for i, v := range libs {
+		resp.Libraries[i] = deletedLibraryJSON{ID: v.ID, Folder: v.Folder, DeletedAt: v.DeletedAt}
+	}
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Write(b)
+}
+
+// handleLibrary is a HTTP handler than takes care of the management of a Library
+func (w *WebHTTPv1) handleLibrary(rw http.ResponseWriter, r *http.Request) {
+	libraryID := r.URL.Path[len("/api/web/v1/library/"):]
+
+	if libraryID == "new" && r.Method == http.MethodPost {
+		readBytes, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		interimNewLib := webapi.Library{}
+		err = json.Unmarshal(readBytes, &interimNewLib)
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !interimNewLib.QueueOrder.Valid() {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Sprintf("invalid queue_order '%v'", interimNewLib.QueueOrder)))
+			return
+		}
+
+		if interimNewLib.MetadataReadConcurrency < 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("metadata_read_concurrency must not be negative"))
+			return
+		}
+
+		if interimNewLib.MaxQueuedBytes < 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("max_queued_bytes must not be negative"))
+			return
+		}
+
+		if !interimNewLib.OriginalFileHandling.Valid() {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Sprintf("invalid original_file_handling '%v'", interimNewLib.OriginalFileHandling)))
+			return
+		}
+
+		if !interimNewLib.StaleJobAction.Valid() {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Sprintf("invalid stale_job_action '%v'", interimNewLib.StaleJobAction)))
+			return
+		}
+
+		staleJobTimeout, err := parseStaleJobTimeout(interimNewLib.StaleJobTimeout)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+
+		metadataReadTimeout, err := parseMetadataReadTimeout(interimNewLib.MetadataReadTimeout)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+
+		if errs := validateLibraryNotifications(interimNewLib.Notifications); len(errs) > 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(errs[0].Error()))
+			return
+		}
+
+		newLib := controller.Library{
+			Folder:              interimNewLib.Folder,
+			Priority:            interimNewLib.Priority,
+			PathMasks:           interimNewLib.PathMasks,
+			MultiPartPatterns:   interimNewLib.MultiPartPatterns,
+			SkipUnchanged:       interimNewLib.SkipUnchanged,
+			VerificationCommand: interimNewLib.VerificationCommand,
+			ScanOnStartup:       interimNewLib.ScanOnStartup,
+			QueueOrder:          interimNewLib.QueueOrder,
+			StaleJobTimeout:     staleJobTimeout,
+			StaleJobAction:      interimNewLib.StaleJobAction,
+
+			MetadataReadConcurrency: interimNewLib.MetadataReadConcurrency,
+			MetadataReadTimeout:     metadataReadTimeout,
+			MetadataReadArgs:        interimNewLib.MetadataReadArgs,
+			MaxQueuedBytes:          interimNewLib.MaxQueuedBytes,
+			OriginalFileHandling:    interimNewLib.OriginalFileHandling,
+			PreserveModtime:         interimNewLib.PreserveModtime,
+			MoveSidecars:            interimNewLib.MoveSidecars,
+			Notifications:           interimNewLib.Notifications,
+		}
+
+		td, err := time.ParseDuration(interimNewLib.FsCheckInterval)
+		if err == nil {
+			newLib.FsCheckInterval = td
+		}
+
+		if !w.validateLibrary(rw, newLib, true) {
+			return
+		}
+
+		// Create map of library IDs (for fast valid ID lookup)
+		libIDMap := map[int]struct{}{}
+		for _, v := range w.libraryCache {
+			libIDMap[v.ID] = struct{}{}
+		}
+
+		// Deleted libraries keep their IDs until they are purged so that they can still be restored
+		deleted, err := w.ds.DeletedLibraries(r.Context())
+		if err != nil {
+			w.logger.Error(err.Error())
+		}
+		for _, v := range deleted {
+			libIDMap[v.ID] = struct{}{}
+		}
+
+		// Find valid ID
+		var validID int
+		for i := 0; i < 10_000; i++ {
+			_, ok := libIDMap[i]
+			if !ok {
+				validID = i
+				break
+			}
+		}
+		newLib.ID = validID
+
+		// Put new lib in a.libSettingsUpdates with located valid id
+		w.libSettingsUpdates[newLib.ID] = newLib
+
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte(fmt.Sprintf("http://%v/api/web/v1/library/%v", r.Host, newLib.ID)))
+		return
+	}
+
+	if strings.HasSuffix(libraryID, "/scan") {
+		w.scanLibrary(rw, r, strings.TrimSuffix(libraryID, "/scan"))
+		return
+	}
+
+	if strings.HasSuffix(libraryID, "/requeue") {
+		w.requeueLibrary(rw, r, strings.TrimSuffix(libraryID, "/requeue"))
+		return
+	}
+
+	if strings.HasSuffix(libraryID, "/preview") {
+		w.previewScan(rw, r, strings.TrimSuffix(libraryID, "/preview"))
+		return
+	}
+
+	if strings.HasSuffix(libraryID, "/drain") {
+		w.drainLibrary(rw, r, strings.TrimSuffix(libraryID, "/drain"), true)
+		return
+	}
+
+	if strings.HasSuffix(libraryID, "/undrain") {
+		w.drainLibrary(rw, r, strings.TrimSuffix(libraryID, "/undrain"), false)
+		return
+	}
+
+	if strings.HasSuffix(libraryID, "/restore") {
+		w.restoreLibrary(rw, r, strings.TrimSuffix(libraryID, "/restore"))
+		return
+	}
+
+	// Transform the string libraryID into an int intLibID
+	temp, err := strconv.ParseInt(libraryID, 0, 0)
+	if err != nil {
+		w.logger.Error(err.Error())
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	intLibID := int(temp)
+
+	// Validate libraryID (and pull the matching library out of the cache).
+	var lib controller.Library
+	validID := false
+	for _, v := range w.libraryCache {
+		if intLibID == v.ID {
+			validID = true
+			lib = v
+			break
+		}
+	}
+
+	if !validID {
+		w.logger.Error("invalid library ID '%v' requested", intLibID)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		toSend := webapi.Library{
+			ID:                      lib.ID,
+			Folder:                  lib.Folder,
+			Priority:                lib.Priority,
+			FsCheckInterval:         lib.FsCheckInterval.String(),
+			Queue:                   lib.Queue,
+			PathMasks:               lib.PathMasks,
+			MultiPartPatterns:       lib.MultiPartPatterns,
+			SkipUnchanged:           lib.SkipUnchanged,
+			VerificationCommand:     lib.VerificationCommand,
+			ScanOnStartup:           lib.ScanOnStartup,
+			QueueOrder:              lib.QueueOrder,
+			StaleJobTimeout:         lib.StaleJobTimeout.String(),
+			StaleJobAction:          lib.StaleJobAction,
+			MetadataReadConcurrency: lib.MetadataReadConcurrency,
+			MetadataReadTimeout:     lib.MetadataReadTimeout.String(),
+			MetadataReadArgs:        lib.MetadataReadArgs,
+			MaxQueuedBytes:          lib.MaxQueuedBytes,
+			OriginalFileHandling:    lib.OriginalFileHandling,
+			PreserveModtime:         lib.PreserveModtime,
+			MoveSidecars:            lib.MoveSidecars,
+			Notifications:           lib.Notifications,
+			CommandDeciderSettings:  lib.CommandDeciderSettings,
+		}
+		if w.libraryManager != nil {
+			toSend.Drained = w.libraryManager.LibraryDrained(lib.ID)
+		}
+		if w.queueAging > 0 {
+			now := time.Now()
+			toSend.EffectivePriorities = make(map[controller.UUID]float64, len(lib.Queue.Items))
+			for _, job := range lib.Queue.Items {
+				toSend.EffectivePriorities[job.UUID] = job.EffectivePriority(lib.Priority, w.queueAging, now)
+			}
+		}
+		if len(lib.Queue.Items) > 0 {
+			starts := w.estimatedStarts(r.Context())
+			for _, job := range lib.Queue.Items {
+				if position, ok := w.dispatchPlan.Positions[job.UUID]; ok {
+					if toSend.QueuePositions == nil {
+						toSend.QueuePositions = make(map[controller.UUID]int)
+					}
+					toSend.QueuePositions[job.UUID] = position
+				}
+				if start, ok := starts[job.UUID]; ok {
+					if toSend.EstimatedStarts == nil {
+						toSend.EstimatedStarts = make(map[controller.UUID]time.Time)
+					}
+					toSend.EstimatedStarts[job.UUID] = start
+				}
+			}
+		}
+		b, err := json.Marshal(toSend)
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(b)
+	case http.MethodPut:
+		// Technically, there is a security flaw where an attacker can set the id in their request
+		// to a different library and overwrite a different library, but it's not like this API is locked down at all
+		// so does it really matter?
+		readBytes, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		uLib := webapi.Library{}
+		err = json.Unmarshal(readBytes, &uLib)
+		if err != nil {
+			w.logger.Error(err.Error())
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !uLib.QueueOrder.Valid() {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Sprintf("invalid queue_order '%v'", uLib.QueueOrder)))
+			return
+		}
+
+		if uLib.MetadataReadConcurrency < 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("metadata_read_concurrency must not be negative"))
+			return
+		}
+
+		if uLib.MaxQueuedBytes < 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("max_queued_bytes must not be negative"))
+			return
+		}
+
+		if !uLib.OriginalFileHandling.Valid() {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Sprintf("invalid original_file_handling '%v'", uLib.OriginalFileHandling)))
+			return
+		}
+
+		if !uLib.StaleJobAction.Valid() {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(fmt.Sprintf("invalid stale_job_action '%v'", uLib.StaleJobAction)))
+			return
+		}
+
+		staleJobTimeout, err := parseStaleJobTimeout(uLib.StaleJobTimeout)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+
+		metadataReadTimeout, err := parseMetadataReadTimeout(uLib.MetadataReadTimeout)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+
+		if errs := validateLibraryNotifications(uLib.Notifications); len(errs) > 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(errs[0].Error()))
+			return
+		}
+
+		lib.Folder = uLib.Folder
+		lib.Priority = uLib.Priority
+		lib.PathMasks = uLib.PathMasks
+		lib.MultiPartPatterns = uLib.MultiPartPatterns
+		lib.SkipUnchanged = uLib.SkipUnchanged
+		lib.VerificationCommand = uLib.VerificationCommand
+		lib.ScanOnStartup = uLib.ScanOnStartup
+		lib.QueueOrder = uLib.QueueOrder
+		lib.StaleJobTimeout = staleJobTimeout
+		lib.StaleJobAction = uLib.StaleJobAction
+		lib.MetadataReadConcurrency = uLib.MetadataReadConcurrency
+		lib.MetadataReadTimeout = metadataReadTimeout
+		lib.MetadataReadArgs = uLib.MetadataReadArgs
+		lib.MaxQueuedBytes = uLib.MaxQueuedBytes
+		lib.OriginalFileHandling = uLib.OriginalFileHandling
+		lib.PreserveModtime = uLib.PreserveModtime
+		lib.MoveSidecars = uLib.MoveSidecars
+		lib.Notifications = uLib.Notifications
+		lib.CommandDeciderSettings = uLib.CommandDeciderSettings
+
+		td, err := time.ParseDuration(uLib.FsCheckInterval)
 		if err == nil {
 			lib.FsCheckInterval = td
 		}
 
+		if !w.validateLibrary(rw, lib, false) {
+			return
+		}
+
 		// Add lib to response of UI.NewLibrarySettings
 		w.libSettingsUpdates[lib.ID] = lib
 
 		rw.WriteHeader(http.StatusNoContent)
 	case http.MethodDelete:
-		if err = w.ds.DeleteLibrary(lib.ID); err != nil {
+		if err = w.ds.DeleteLibrary(r.Context(), lib.ID, time.Now()); err != nil {
 			w.logger.Error(err.Error())
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
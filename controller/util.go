@@ -2,15 +2,167 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
 )
 
 // IsContextFinished returns a boolean indicating whether or not a context.Context is finished.
 // This replaces the need to use a select code block.
-func IsContextFinished(ctx *context.Context) bool {
+func IsContextFinished(ctx context.Context) bool {
 	select {
-	case <-(*ctx).Done():
+	case <-ctx.Done():
 		return true
 	default:
 		return false
 	}
 }
+
+// rename is os.Rename, which is replaced by the tests to simulate a move between devices.
+var rename = os.Rename
+
+// copyContents is io.Copy, which is replaced by the tests to simulate a crash in the middle of a copy.
+var copyContents = io.Copy
+
+// freeSpace is FreeSpace, which is replaced by the tests to simulate a full filesystem.
+var freeSpace = FreeSpace
+
+// CopySpaceMargin is how many bytes must still be free on a filesystem after MoveFile copies a file onto it.
+const CopySpaceMargin = 256 << 20
+
+// MoveFile moves the file at from to to, creating the folder of to if it doesn't exist. An existing file at to is
+// replaced in a single step, so a crash leaves either the old or the new file there, never a partial one.
+//
+// The file is flushed to disk and then renamed when possible, which falls back to copying it into a temporary file
+// next to to and renaming that when the two paths are on different devices. from is only deleted once the copy is in
+// place. The copy keeps the mode and modtime of from. A copy isn't started if it wouldn't leave CopySpaceMargin free,
+// in which case an error wrapping ErrInsufficientSpace is returned and both files are left alone.
+func MoveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("couldn't create dest folder: %s", err)
+	}
+
+	if err := syncFile(from); err != nil {
+		return fmt.Errorf("couldn't flush source file to disk: %s", err)
+	}
+
+	err := rename(from, to)
+	if err == nil {
+		syncDir(filepath.Dir(to))
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err = copyFile(from, to); err != nil {
+		return err
+	}
+
+	// The copy was successful, so now delete the original file
+	if err = os.Remove(from); err != nil {
+		return fmt.Errorf("failed removing original file: %s", err)
+	}
+	return nil
+}
+
+// copyFile copies from into a temporary file next to to and renames it into place once it is complete and flushed
+// to disk, so that a partial copy is never left at to.
+func copyFile(from, to string) error {
+	inputFile, err := os.Open(from)
+	if err != nil {
+		return fmt.Errorf("couldn't open source file: %s", err)
+	}
+	defer inputFile.Close()
+
+	info, err := inputFile.Stat()
+	if err != nil {
+		return fmt.Errorf("couldn't stat source file: %s", err)
+	}
+
+	if err = checkFreeSpace(filepath.Dir(to), info.Size()); err != nil {
+		return err
+	}
+
+	tmp := to + ".encodarr-tmp"
+	outputFile, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("couldn't open dest file: %s", err)
+	}
+
+	n, err := copyContents(outputFile, inputFile)
+	if err == nil && n != info.Size() {
+		err = fmt.Errorf("copied %v of %v bytes", n, info.Size())
+	}
+	if err == nil {
+		err = outputFile.Sync()
+	}
+	if closeErr := outputFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writing to output file failed: %s", err)
+	}
+
+	if err = os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("couldn't set modtime of dest file: %s", err)
+	}
+
+	if err = os.Rename(tmp, to); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("couldn't rename dest file into place: %s", err)
+	}
+	syncDir(filepath.Dir(to))
+	return nil
+}
+
+// checkFreeSpace returns an error wrapping ErrInsufficientSpace if size bytes can't be written to dir while leaving
+// CopySpaceMargin free. Platforms which can't check are assumed to have enough space.
+func checkFreeSpace(dir string, size int64) error {
+	free, err := freeSpace(dir)
+	if errors.Is(err, ErrFreeSpaceUnsupported) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("couldn't check free space of dest folder: %s", err)
+	}
+
+	if needed := uint64(size) + CopySpaceMargin; free < needed {
+		return fmt.Errorf("%w: %v bytes are needed but only %v are free", ErrInsufficientSpace, needed, free)
+	}
+	return nil
+}
+
+// syncFile flushes the contents of the file at path to disk.
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, fs.ErrPermission) {
+		// A file which can't be written to, like a read-only original, can still be synced on most platforms
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// syncDir flushes the entries of the folder at path to disk, so that a rename into it survives a crash.
+// Not every platform can sync a folder, so failures are ignored.
+func syncDir(path string) {
+	d, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
@@ -2,7 +2,14 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestIsContextFinished(t *testing.T) {
@@ -21,7 +28,7 @@ func TestIsContextFinished(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			out := IsContextFinished(&test.in)
+			out := IsContextFinished(test.in)
 
 			if out != test.out {
 				t.Errorf("expected %v but got %v", test.out, out)
@@ -29,3 +36,153 @@ func TestIsContextFinished(t *testing.T) {
 		})
 	}
 }
+
+func TestMoveFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		crossDevice bool
+	}{
+		{name: "Rename", crossDevice: false},
+		{name: "Copy Across Devices", crossDevice: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.crossDevice {
+				rename = func(from, to string) error {
+					return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EXDEV}
+				}
+				freeSpace = func(string) (uint64, error) { return CopySpaceMargin << 1, nil }
+				defer func() {
+					rename = os.Rename
+					freeSpace = FreeSpace
+				}()
+			}
+
+			dir := t.TempDir()
+			from := filepath.Join(dir, "a.mkv")
+			to := filepath.Join(dir, "trash", "1", "a.mkv")
+			modtime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+			if err := os.WriteFile(from, []byte("original"), 0640); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(from, modtime, modtime); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := MoveFile(from, to); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if _, err := os.Stat(from); !os.IsNotExist(err) {
+				t.Errorf("expected %v to be gone but got %v", from, err)
+			}
+			b, err := os.ReadFile(to)
+			if err != nil || string(b) != "original" {
+				t.Fatalf("expected %v to hold the original contents but got %q (%v)", to, b, err)
+			}
+			info, _ := os.Stat(to)
+			if !info.ModTime().Equal(modtime) {
+				t.Errorf("expected modtime %v but got %v", modtime, info.ModTime())
+			}
+			if _, err := os.Stat(to + ".encodarr-tmp"); !os.IsNotExist(err) {
+				t.Errorf("expected the temporary file to be gone but got %v", err)
+			}
+		})
+	}
+}
+
+func TestMoveFileChecksFreeSpace(t *testing.T) {
+	rename = func(from, to string) error {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EXDEV}
+	}
+	freeSpace = func(string) (uint64, error) { return CopySpaceMargin + 4, nil }
+	defer func() {
+		rename = os.Rename
+		freeSpace = FreeSpace
+	}()
+
+	dir := t.TempDir()
+	from := filepath.Join(dir, "a.import.mkv")
+	to := filepath.Join(dir, "a.mkv")
+	if err := os.WriteFile(to, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(from, []byte("transcoded file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MoveFile(from, to); !errors.Is(err, ErrInsufficientSpace) {
+		t.Fatalf("expected ErrInsufficientSpace but got %v", err)
+	}
+	if b, err := os.ReadFile(to); err != nil || string(b) != "original" {
+		t.Errorf("expected the original to be left alone but got %q (%v)", b, err)
+	}
+	if _, err := os.Stat(from); err != nil {
+		t.Errorf("expected the transcoded file to be left alone but got %v", err)
+	}
+
+	// Once there is room, the move goes through
+	freeSpace = func(string) (uint64, error) { return CopySpaceMargin + 15, nil }
+	if err := MoveFile(from, to); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMoveFileSurvivesCrash(t *testing.T) {
+	rename = func(from, to string) error {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EXDEV}
+	}
+	freeSpace = func(string) (uint64, error) { return CopySpaceMargin << 1, nil }
+	defer func() {
+		rename = os.Rename
+		freeSpace = FreeSpace
+	}()
+
+	dir := t.TempDir()
+	from := filepath.Join(dir, "a.import.mkv")
+	to := filepath.Join(dir, "media", "a.mkv")
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(to, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(from, []byte("transcoded file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The copy is killed halfway through. Goexit stops MoveFile on the spot, so none of its clean up runs either.
+	copyContents = func(dst io.Writer, src io.Reader) (int64, error) {
+		n, _ := io.CopyN(dst, src, 5)
+		if n == 5 {
+			runtime.Goexit()
+		}
+		return n, nil
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		MoveFile(from, to)
+	}()
+	<-done
+	copyContents = io.Copy
+
+	if b, err := os.ReadFile(to); err != nil || string(b) != "original" {
+		t.Fatalf("expected the original to survive the crash but got %q (%v)", b, err)
+	}
+	if b, err := os.ReadFile(from); err != nil || string(b) != "transcoded file" {
+		t.Fatalf("expected the transcoded file to survive the crash but got %q (%v)", b, err)
+	}
+
+	// Moving again after the crash replaces the original and the partial copy.
+	if err := MoveFile(from, to); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, err := os.ReadFile(to); err != nil || string(b) != "transcoded file" {
+		t.Errorf("expected the original to be replaced but got %q (%v)", b, err)
+	}
+	if _, err := os.Stat(to + ".encodarr-tmp"); !os.IsNotExist(err) {
+		t.Errorf("expected the temporary file to be gone but got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package webapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// APIKeyHeader is the header that Client sends its APIKey in. The Controller doesn't check it, but a reverse proxy in
+// front of the Controller can.
+const APIKeyHeader = "X-Api-Key"
+
+// maxErrorBodySize is how much of an error response is kept as the message of an APIError.
+const maxErrorBodySize = 4096
+
+// APIError is returned by Client when the Controller responds with a status other than 2xx.
+type APIError struct {
+	StatusCode int
+	Message    string // The body of the response, which is empty for most errors.
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("the controller responded with %v %v", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("the controller responded with %v %v: %v", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// NewClient returns a Client for the Controller at baseURL (ex. http://localhost:8123). apiKey may be empty.
+func NewClient(baseURL, apiKey string) Client {
+	return Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Client sends requests to the web API of a Controller.
+type Client struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// LibraryIDs returns the IDs of every library.
+func (c *Client) LibraryIDs(ctx context.Context) ([]int, error) {
+	var resp LibraryIDs
+	err := c.do(ctx, http.MethodGet, "/api/web/v1/libraries", nil, &resp)
+	return resp.IDs, err
+}
+
+// Library returns the library with the provided ID, including its queue.
+func (c *Client) Library(ctx context.Context, id int) (Library, error) {
+	var resp Library
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/web/v1/library/%v", id), nil, &resp)
+	return resp, err
+}
+
+// ScanLibrary asks the Controller to scan the library with the provided ID.
+func (c *Client) ScanLibrary(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/api/web/v1/library/%v/scan", id), nil, nil)
+}
+
+// PreviewScan returns the jobs which a scan of the library with the provided ID would queue, without queueing them.
+func (c *Client) PreviewScan(ctx context.Context, id int) ([]controller.Job, error) {
+	var resp ScanPreview
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/web/v1/library/%v/preview", id), nil, &resp)
+	return resp.Jobs, err
+}
+
+// DrainLibrary asks the Controller to stop dispatching the jobs of the library with the provided ID.
+func (c *Client) DrainLibrary(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/api/web/v1/library/%v/drain", id), nil, nil)
+}
+
+// UndrainLibrary asks the Controller to dispatch the jobs of a drained library again.
+func (c *Client) UndrainLibrary(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/api/web/v1/library/%v/undrain", id), nil, nil)
+}
+
+// MoveJob asks the Controller to move the queued job with the provided UUID to the queue of another library.
+func (c *Client) MoveJob(ctx context.Context, uuid controller.UUID, libraryID int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/api/web/v1/job/%v/move", uuid), MoveJob{LibraryID: libraryID}, nil)
+}
+
+// History returns every job in the history.
+func (c *Client) History(ctx context.Context) ([]HistoryEntry, error) {
+	var resp History
+	err := c.do(ctx, http.MethodGet, "/api/web/v1/history", nil, &resp)
+	return resp.History, err
+}
+
+// Runners returns every Runner which has connected to the Controller.
+func (c *Client) Runners(ctx context.Context) ([]Runner, error) {
+	var resp Runners
+	err := c.do(ctx, http.MethodGet, "/api/web/v1/runners", nil, &resp)
+	return resp.Runners, err
+}
+
+// Processing returns whether or not the Controller starts scans and dispatches jobs.
+func (c *Client) Processing(ctx context.Context) (bool, error) {
+	var resp Processing
+	err := c.do(ctx, http.MethodGet, "/api/web/v1/processing", nil, &resp)
+	return resp.Enabled, err
+}
+
+// SetProcessing stops (false) or resumes (true) every scan and dispatch of the Controller.
+func (c *Client) SetProcessing(ctx context.Context, enabled bool) error {
+	return c.do(ctx, http.MethodPut, "/api/web/v1/processing", Processing{Enabled: enabled}, nil)
+}
+
+// do sends a request to path with the JSON of in as the body, unless it is nil, and decodes the response into out,
+// unless it is nil. An *APIError is returned if the response doesn't have a 2xx status.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set(APIKeyHeader, c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding the response of %v: %w", path, err)
+	}
+	return nil
+}
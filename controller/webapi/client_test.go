@@ -0,0 +1,77 @@
+package webapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get(APIKeyHeader))
+		switch r.URL.Path {
+		case "/api/web/v1/libraries":
+			rw.Write([]byte(`{"IDs": [1, 2]}`))
+		case "/api/web/v1/library/2/scan":
+			rw.WriteHeader(http.StatusAccepted)
+		case "/api/web/v1/processing":
+			b, _ := io.ReadAll(r.Body)
+			requests = append(requests, string(b))
+			rw.Write([]byte(`{"enabled": false}`))
+		case "/api/web/v1/library/3/scan":
+			rw.WriteHeader(http.StatusConflict)
+			rw.Write([]byte("library 3 is already being scanned\n"))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL+"/", "key")
+	ctx := context.Background()
+
+	ids, err := c.LibraryIDs(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("expected the IDs [1 2] but got %v", ids)
+	}
+
+	if err = c.ScanLibrary(ctx, 2); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	var apiErr *APIError
+	if err = c.ScanLibrary(ctx, 3); !errors.As(err, &apiErr) {
+		t.Fatalf("expected an APIError but got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusConflict || apiErr.Message != "library 3 is already being scanned" {
+		t.Errorf("expected a 409 with the response body but got %+v", apiErr)
+	}
+
+	if err = c.SetProcessing(ctx, false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err = c.Runners(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a 404 APIError but got %v", err)
+	}
+
+	expected := []string{
+		"GET /api/web/v1/libraries key",
+		"POST /api/web/v1/library/2/scan key",
+		"POST /api/web/v1/library/3/scan key",
+		"PUT /api/web/v1/processing key",
+		`{"enabled":false}`,
+		"GET /api/web/v1/runners key",
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected the requests %q but got %q", expected, requests)
+	}
+}
@@ -0,0 +1,96 @@
+// Package webapi holds the request and response bodies of the web API and a client for it, so that the Controller
+// and the programs which talk to it share one definition of them.
+package webapi
+
+import (
+	"time"
+
+	"github.com/BrenekH/encodarr/controller"
+)
+
+// HistoryEntry is a job in the history, as sent by /api/web/v1/history.
+type HistoryEntry struct {
+	File              string   `json:"file"`
+	DateTimeCompleted string   `json:"datetime_completed"`
+	Warnings          []string `json:"warnings"`
+	Errors            []string `json:"errors"`
+}
+
+// History is the response of /api/web/v1/history.
+type History struct {
+	History []HistoryEntry `json:"history"`
+}
+
+// LibraryIDs is the response of /api/web/v1/libraries.
+type LibraryIDs struct {
+	IDs []int
+}
+
+// Library is a library with its queue, as sent and received by /api/web/v1/library/<id>.
+type Library struct {
+	ID                      int                             `json:"id"`
+	Folder                  string                          `json:"folder"`
+	Priority                int                             `json:"priority"`
+	FsCheckInterval         string                          `json:"fs_check_interval"`
+	Queue                   controller.LibraryQueue         `json:"queue"`
+	PathMasks               []string                        `json:"path_masks"`
+	MultiPartPatterns       []string                        `json:"multi_part_patterns"`
+	SkipUnchanged           bool                            `json:"skip_unchanged"`
+	VerificationCommand     []string                        `json:"verification_command"`
+	ScanOnStartup           bool                            `json:"scan_on_startup"`
+	QueueOrder              controller.QueueOrder           `json:"queue_order"`
+	StaleJobTimeout         string                          `json:"stale_job_timeout"`
+	StaleJobAction          controller.StaleJobAction       `json:"stale_job_action"`
+	MetadataReadConcurrency int                             `json:"metadata_read_concurrency"`
+	MetadataReadTimeout     string                          `json:"metadata_read_timeout"`
+	MetadataReadArgs        []string                        `json:"metadata_read_args"`
+	MaxQueuedBytes          int64                           `json:"max_queued_bytes"`
+	OriginalFileHandling    controller.OriginalFileHandling `json:"original_file_handling"`
+	PreserveModtime         bool                            `json:"preserve_modtime"`
+	MoveSidecars            bool                            `json:"move_sidecars"`
+	Notifications           controller.LibraryNotifications `json:"notifications"`
+	CommandDeciderSettings  string                          `json:"command_decider_settings"`
+
+	// Drained is whether or not the library's jobs are kept from being dispatched. It is ignored in updates, because
+	// libraries are drained through /api/web/v1/library/<id>/drain and /undrain.
+	Drained bool `json:"drained,omitempty"`
+
+	// EffectivePriorities holds the priority of each queued job after aging, keyed by UUID. It is only sent
+	// when queue aging is enabled and is ignored in updates.
+	EffectivePriorities map[controller.UUID]float64 `json:"effective_priorities,omitempty"`
+
+	// QueuePositions holds the position of each queued job in the order of all the libraries, starting at 1, and
+	// EstimatedStarts when each of them is expected to be dispatched, keyed by UUID. Jobs which don't have one are left
+	// out. Both are ignored in updates.
+	QueuePositions  map[controller.UUID]int       `json:"queue_positions,omitempty"`
+	EstimatedStarts map[controller.UUID]time.Time `json:"estimated_starts,omitempty"`
+}
+
+// Runner is a Runner with what it is doing, as sent by /api/web/v1/runners.
+type Runner struct {
+	controller.Runner
+	Online      bool              `json:"online"` // Whether the Runner has been seen within the offline threshold.
+	Waiting     bool              `json:"waiting"`
+	CurrentJobs []controller.UUID `json:"current_jobs"`
+}
+
+// Runners is the response of /api/web/v1/runners.
+type Runners struct {
+	Runners []Runner `json:"runners"`
+}
+
+// ScanPreview is the response of /api/web/v1/library/<id>/preview.
+type ScanPreview struct {
+	Jobs []controller.Job `json:"jobs"`
+}
+
+// MoveJob is the request body of /api/web/v1/job/<uuid>/move.
+type MoveJob struct {
+	LibraryID int `json:"library_id"`
+}
+
+// Processing is whether or not the Controller starts scans and dispatches jobs, as sent and received by
+// /api/web/v1/processing.
+type Processing struct {
+	Enabled bool `json:"enabled"`
+}
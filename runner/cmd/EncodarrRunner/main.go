@@ -24,6 +24,9 @@ func init() {
 
 func main() {
 	logger.Info("Starting Encodarr Runner")
+	if path := options.LogFile(); path != "" {
+		logger.Info(fmt.Sprintf("Writing logs to %v", path))
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 
 	signals := make(chan os.Signal, 1)
@@ -46,6 +49,9 @@ func main() {
 	if err != nil {
 		logger.Critical(err.Error())
 	}
+	apiV1.LeaseDuration = options.LeaseDuration()
+
+	go runner.SendHeartbeats(ctx, &apiV1, options.HeartbeatInterval())
 
-	runner.Run(&ctx, &apiV1, &cmdRun, false)
+	runner.Run(ctx, &apiV1, &cmdRun, false)
 }
@@ -3,6 +3,7 @@ package cmdrunner
 import (
 	"fmt"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/BrenekH/encodarr/runner"
@@ -70,6 +71,13 @@ type CmdRunner struct {
 
 	timeSince Sincer
 	cmdr      Commander
+
+	// cmd is the command which is running. It is guarded by cmdMu because Stop is called from another goroutine
+	// than the one which starts it.
+	cmd     Cmder
+	job     runner.JobInfo // The job that cmd is running, for the log records.
+	stopped bool
+	cmdMu   sync.Mutex
 }
 
 // Done returns a boolean indicating whether or not the command is complete.
@@ -86,24 +94,48 @@ func (r *CmdRunner) Start(ji runner.JobInfo) {
 	r.failed = false
 	r.warnings = []string{}
 	r.errors = []string{}
+	r.fps = 0
+	r.time = ""
+	r.speed = 0
 
 	// ji.MediaDuration is in ~~milliseconds~~ seconds
 	r.fileDuration = time.Duration(ji.MediaDuration) * time.Second //* time.Millisecond
 
-	a := append(r.BaseArgs, ji.CommandArgs...)
+	// The arguments are copied instead of appended to BaseArgs, so that they are run exactly as the Controller
+	// assembled them even if BaseArgs has room to spare which a previous job's arguments would share.
+	a := make([]string, 0, len(r.BaseArgs)+len(ji.CommandArgs))
+	a = append(a, r.BaseArgs...)
+	a = append(a, ji.CommandArgs...)
 	c := r.cmdr.Command(r.Executable, a...)
 
+	r.cmdMu.Lock()
+	r.cmd = nil
+	r.job = ji
+	r.stopped = false
+	r.cmdMu.Unlock()
+
 	errPipe, _ := c.StderrPipe()
 	b := make([]byte, 1024)
 
 	r.startTime = time.Now()
 
 	go func() {
-		logger.Info("Starting FFmpeg command")
+		r.cmdMu.Lock()
+		if r.stopped {
+			r.cmdMu.Unlock()
+			r.failed = true
+			r.done = true
+			return
+		}
+
+		logger.Info(ji.WithFields("Starting FFmpeg command"))
+		logger.Debug(ji.WithFields(fmt.Sprintf("Running %v with the arguments %q", r.Executable, a)))
 		err := c.Start()
 		if err != nil {
-			logger.Error(err.Error())
+			logger.Error(ji.WithFields(err.Error()))
 		}
+		r.cmd = c
+		r.cmdMu.Unlock()
 
 		for {
 			n, err := errPipe.Read(b)
@@ -131,10 +163,26 @@ func (r *CmdRunner) Start(ji runner.JobInfo) {
 		}
 
 		r.done = true
-		logger.Info("FFmpeg command finished")
+		logger.Info(ji.WithFields("FFmpeg command finished"))
 	}()
 }
 
+// Stop kills the running command. Done returns true once it has exited, and the command is reported as failed.
+func (r *CmdRunner) Stop() {
+	r.cmdMu.Lock()
+	defer r.cmdMu.Unlock()
+
+	r.stopped = true
+	if r.cmd == nil {
+		return
+	}
+
+	logger.Info(r.job.WithFields("Stopping FFmpeg command"))
+	if err := r.cmd.Kill(); err != nil {
+		logger.Warn(r.job.WithFields(err.Error()))
+	}
+}
+
 // Status returns the current status of the job.
 func (r *CmdRunner) Status() runner.JobStatus {
 	currentFileTime, err := parseColonTimeToDuration(r.time)
@@ -157,6 +205,7 @@ func (r *CmdRunner) Results() runner.CommandResults {
 	return runner.CommandResults{
 		Failed:         r.failed,
 		JobElapsedTime: r.timeSince.Since(r.startTime).Round(time.Second),
+		FPS:            r.fps,
 		Warnings:       r.warnings,
 		Errors:         r.errors,
 	}
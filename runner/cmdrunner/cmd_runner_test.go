@@ -72,6 +72,21 @@ func TestStart(t *testing.T) {
 			t.Errorf("expected Commander.Command to be called with %v, but got %v instead", expected, mCmdr)
 		}
 	})
+
+	t.Run("Input Flags Kept Before the Input", func(t *testing.T) {
+		mCmdr := mockCommander{}
+		cR := NewCmdRunner()
+		cR.cmdr = &mCmdr
+
+		cR.Start(runner.JobInfo{
+			CommandArgs: []string{"-analyzeduration", "200M", "-probesize", "1G", "-i", "input.mp4", "output.mkv"},
+		})
+
+		expected := []string{"-hide_banner", "-loglevel", "warning", "-stats", "-y", "-analyzeduration", "200M", "-probesize", "1G", "-i", "input.mp4", "output.mkv"}
+		if !reflect.DeepEqual(mCmdr.lastCallArgs, expected) {
+			t.Errorf("expected Commander.Command to be called with %v, but got %v instead", expected, mCmdr.lastCallArgs)
+		}
+	})
 }
 
 func TestStartResults(t *testing.T) {
@@ -97,7 +112,7 @@ func TestStartResults(t *testing.T) {
 		// we just get to wait for it to be complete.
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
 		defer cancel()
-		if failedToSetDone := waitCmdRunner(&ctx, &cR); failedToSetDone {
+		if failedToSetDone := waitCmdRunner(ctx, &cR); failedToSetDone {
 			t.Errorf("test CmdRunner failed to set the done variable within 10 seconds")
 		}
 
@@ -108,6 +123,26 @@ func TestStartResults(t *testing.T) {
 	})
 }
 
+func TestStop(t *testing.T) {
+	mCmdr := mockCommander{}
+	cR := NewCmdRunner()
+	cR.cmdr = &mCmdr
+
+	cR.Start(runner.JobInfo{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Second)
+	defer cancel()
+	if failedToSetDone := waitCmdRunner(ctx, &cR); failedToSetDone {
+		t.Errorf("test CmdRunner failed to set the done variable within 10 seconds")
+	}
+
+	cR.Stop()
+
+	if !mCmdr.cmder.killCalled {
+		t.Errorf("expected Cmder.Kill to be called")
+	}
+}
+
 func TestStatus(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -251,7 +286,7 @@ func TestResults(t *testing.T) {
 // CmdRunner indicates it is done or the context is up.
 //
 // The boolean return value indicates whether or not the CmdRunner failed to set the done variable.
-func waitCmdRunner(ctx *context.Context, cR *CmdRunner) bool {
+func waitCmdRunner(ctx context.Context, cR *CmdRunner) bool {
 	for {
 		if runner.IsContextFinished(ctx) {
 			return true
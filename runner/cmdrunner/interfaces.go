@@ -20,4 +20,5 @@ type Cmder interface {
 	Start() error
 	StderrPipe() (io.ReadCloser, error)
 	Wait() error
+	Kill() error
 }
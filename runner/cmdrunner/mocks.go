@@ -28,6 +28,8 @@ func (m *mockCommander) Command(name string, args ...string) Cmder {
 
 type mockCmder struct {
 	statusCode int
+
+	killCalled bool
 }
 
 func (m *mockCmder) Start() error {
@@ -38,6 +40,11 @@ func (m *mockCmder) StderrPipe() (io.ReadCloser, error) {
 	return io.NopCloser(&bytes.Buffer{}), io.EOF
 }
 
+func (m *mockCmder) Kill() error {
+	m.killCalled = true
+	return nil
+}
+
 func (m *mockCmder) Wait() error {
 	if m.statusCode == 0 {
 		return nil
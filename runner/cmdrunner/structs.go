@@ -14,5 +14,18 @@ func (s timeSince) Since(t time.Time) time.Duration {
 type execCommander struct{}
 
 func (e execCommander) Command(name string, args ...string) Cmder {
-	return exec.Command(name, args...)
+	return execCmd{exec.Command(name, args...)}
+}
+
+// execCmd adds a Kill method to exec.Cmd.
+type execCmd struct {
+	*exec.Cmd
+}
+
+// Kill kills the process of the command, if it has been started.
+func (c execCmd) Kill() error {
+	if c.Process == nil {
+		return nil
+	}
+	return c.Process.Kill()
 }
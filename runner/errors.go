@@ -3,4 +3,5 @@ package runner
 import "errors"
 
 // ErrUnresponsive represents the error state when the Controller decides that the Runner is no longer responsive.
+// It is returned when the Controller rejects the renewal of the lease on a job, which means that the job was taken away.
 var ErrUnresponsive error = errors.New("received unresponsive status code")
@@ -0,0 +1,25 @@
+package runner
+
+import (
+	"context"
+	"time"
+)
+
+// SendHeartbeats tells the Controller that this Runner is alive every interval until ctx is finished,
+// so that the Controller can tell an idle Runner apart from one that has gone offline.
+func SendHeartbeats(ctx context.Context, c Communicator, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.SendHeartbeat(ctx); err != nil && !IsContextFinished(ctx) {
+			logger.Warn(err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSendHeartbeats(t *testing.T) {
+	mCommunicator := mockCommunicator{}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	SendHeartbeats(ctx, &mCommunicator, time.Millisecond*10)
+
+	// One heartbeat is sent right away and then one every interval until the context is finished.
+	if mCommunicator.heartbeats < 2 {
+		t.Errorf("expected at least 2 heartbeats but got %v", mCommunicator.heartbeats)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/BrenekH/encodarr/runner"
+	"github.com/BrenekH/encodarr/runner/options"
 	"github.com/BrenekH/logange"
 )
 
@@ -45,6 +46,7 @@ func NewAPIv1(tempDir, runnerName, controllerIP, controllerPort string) (APIv1,
 		httpClient:   http.DefaultClient,
 		fS:           OsFS{},
 		currentTime:  TimeNow{},
+		active:       &activeJob{},
 	}, nil
 }
 
@@ -56,14 +58,36 @@ type APIv1 struct {
 	httpClient   RequestDoer
 	fS           FSer
 	currentTime  CurrentTimer
+
+	// LeaseDuration is the lease this Runner asks the Controller for when requesting a job. The Controller caps it
+	// at its own maximum and never grants less than its default. 0 leaves the lease up to the Controller.
+	LeaseDuration time.Duration
+
+	// active is the job which the Runner is working on. It is sent with the heartbeats so that a restarted Controller
+	// knows which of its dispatched jobs are still being worked on.
+	active *activeJob
 }
 
 // SendJobComplete lets the Controller know that the job was completed and sends the resulting file if there is one.
-func (a *APIv1) SendJobComplete(ctx *context.Context, ji runner.JobInfo, cmdR runner.CommandResults) error {
+func (a *APIv1) SendJobComplete(ctx context.Context, ji runner.JobInfo, cmdR runner.CommandResults) error {
+	// The job is finished no matter whether the Controller accepts it or not
+	defer a.active.set("")
+
 	var request *http.Request
 	var err error
+	var stats *benchmarkStats
+
+	if ji.Benchmark && !cmdR.Failed {
+		// The transcoded file of a benchmark is thrown away, so only its size is reported.
+		if info, err := a.fS.Stat(ji.OutFile); err != nil {
+			cmdR.Failed = true
+			cmdR.Errors = append(cmdR.Errors, fmt.Sprintf("Failed to read the size of the transcoded file: %v", err))
+		} else {
+			stats = &benchmarkStats{Elapsed: cmdR.JobElapsedTime, FPS: cmdR.FPS, ProjectedSize: info.Size()}
+		}
+	}
 
-	if !cmdR.Failed {
+	if !cmdR.Failed && !ji.Benchmark {
 		filename := a.Dir + "/output.mkv"
 
 		r, w := io.Pipe()
@@ -88,24 +112,29 @@ func (a *APIv1) SendJobComplete(ctx *context.Context, ji runner.JobInfo, cmdR ru
 			if err != nil {
 				logger.Critical(err.Error())
 			}
+
+			if ji.CaptionsFile != "" {
+				a.writeCaptionsPart(writer, ji.CaptionsFile)
+			}
 		}()
 
-		request, err = http.NewRequestWithContext(*ctx, "POST", fmt.Sprintf("%v/api/runner/v1/job/complete", a.ControllerIP), r)
+		request, err = http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%v/api/runner/v1/job/complete", a.ControllerIP), r)
 		if err != nil {
 			return err
 		}
 
 		request.Header.Add("Content-Type", writer.FormDataContentType())
 	} else {
-		request, err = http.NewRequestWithContext(*ctx, "POST", fmt.Sprintf("%v/api/runner/v1/job/complete", a.ControllerIP), &bytes.Buffer{})
+		request, err = http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%v/api/runner/v1/job/complete", a.ControllerIP), &bytes.Buffer{})
 		if err != nil {
 			return err
 		}
 	}
 
 	b, err := json.Marshal(historyEntry{
-		UUID:   ji.UUID,
-		Failed: cmdR.Failed,
+		UUID:      ji.UUID,
+		Failed:    cmdR.Failed,
+		Benchmark: stats,
 		History: history{
 			Filename:          ji.File,
 			DateTimeCompleted: a.currentTime.Now(),
@@ -118,6 +147,7 @@ func (a *APIv1) SendJobComplete(ctx *context.Context, ji runner.JobInfo, cmdR ru
 	}
 
 	request.Header.Add("X-Encodarr-History-Entry", string(b))
+	request.Header.Set("X-Encodarr-Runner-Name", a.RunnerName)
 
 	response, err := a.httpClient.Do(request)
 	if err != nil {
@@ -132,16 +162,42 @@ func (a *APIv1) SendJobComplete(ctx *context.Context, ji runner.JobInfo, cmdR ru
 	return nil
 }
 
+// writeCaptionsPart adds the closed captions extracted by the job to the multipart form.
+// FFmpeg doesn't create the file if no captions were decoded, so failing to open it is only a warning.
+func (a *APIv1) writeCaptionsPart(writer *multipart.Writer, captionsFname string) {
+	file, err := a.fS.Open(captionsFname)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Not sending captions because of error: %v", err))
+		return
+	}
+	defer file.Close()
+
+	part, err := writer.CreateFormFile("captions", filepath.Base(file.Name()))
+	if err != nil {
+		logger.Critical(err.Error())
+		return
+	}
+
+	if _, err = io.Copy(part, file); err != nil {
+		logger.Critical(err.Error())
+	}
+}
+
 // SendNewJobRequest requests a new job from the Controller and downloads the file to be worked on.
 // This method blocks the thread until a job is assigned to this Runner.
-func (a *APIv1) SendNewJobRequest(ctx *context.Context) (runner.JobInfo, error) {
-	req, err := http.NewRequestWithContext(*ctx, http.MethodGet, fmt.Sprintf("%v/api/runner/v1/job/request", a.ControllerIP), nil)
+func (a *APIv1) SendNewJobRequest(ctx context.Context) (runner.JobInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%v/api/runner/v1/job/request", a.ControllerIP), nil)
 	if err != nil {
 		return runner.JobInfo{}, err
 	}
 
 	req.Header.Set("X-Encodarr-Runner-Name", a.RunnerName)
+	req.Header.Set("X-Encodarr-Runner-Version", options.Version)
+	if a.LeaseDuration > 0 {
+		req.Header.Set(leaseDurationHeader, a.LeaseDuration.String())
+	}
 
+	sentAt := a.currentTime.Now()
 	resp, err := a.httpClient.Do(req)
 	if err != nil {
 		return runner.JobInfo{}, err
@@ -155,6 +211,8 @@ func (a *APIv1) SendNewJobRequest(ctx *context.Context) (runner.JobInfo, error)
 	if err != nil {
 		return runner.JobInfo{}, err
 	}
+	lease := grantedLease(resp.Header)
+	a.active.start(jobInfo.UUID, lease, sentAt)
 
 	fPath := a.Dir + "/input" + path.Ext(jobInfo.Path)
 
@@ -164,7 +222,21 @@ func (a *APIv1) SendNewJobRequest(ctx *context.Context) (runner.JobInfo, error)
 	}
 	defer f.Close()
 
-	logger.Info(fmt.Sprintf("Received job for %v", jobInfo.Path))
+	libraryID := -1
+	if jobInfo.LibraryID != nil {
+		libraryID = *jobInfo.LibraryID
+	}
+	fields := runner.JobInfo{UUID: jobInfo.UUID, LibraryID: libraryID}
+
+	kind := "job"
+	if jobInfo.Benchmark != nil {
+		kind = "benchmark"
+	}
+	if lease > 0 {
+		logger.Info(fields.WithFields(fmt.Sprintf("Received %v for %v with a %v lease", kind, jobInfo.Path, lease)))
+	} else {
+		logger.Info(fields.WithFields(fmt.Sprintf("Received %v for %v", kind, jobInfo.Path)))
+	}
 
 	_, err = io.Copy(f, resp.Body)
 	if err != nil {
@@ -173,20 +245,28 @@ func (a *APIv1) SendNewJobRequest(ctx *context.Context) (runner.JobInfo, error)
 
 	outputFname := a.Dir + "/output.mkv"
 
+	var captionsFname string
+	if extractsCaptions(jobInfo.Command) {
+		captionsFname = a.Dir + "/captions.srt"
+	}
+
 	dur := jobInfo.Metadata.General.Duration
 
 	return runner.JobInfo{
-		CommandArgs:   parseFFmpegCmd(fPath, outputFname, jobInfo.Command),
+		CommandArgs:   parseFFmpegCmd(fPath, outputFname, captionsFname, jobInfo.Command),
 		UUID:          jobInfo.UUID,
+		LibraryID:     libraryID,
 		File:          jobInfo.Path,
 		InFile:        fPath,
 		OutFile:       outputFname,
+		CaptionsFile:  captionsFname,
 		MediaDuration: dur,
+		Benchmark:     jobInfo.Benchmark != nil,
 	}, nil
 }
 
 // SendStatus updates the Controller with the status of the current job.
-func (a *APIv1) SendStatus(ctx *context.Context, uuid string, js runner.JobStatus) error {
+func (a *APIv1) SendStatus(ctx context.Context, uuid string, js runner.JobStatus) error {
 	b, err := json.Marshal(struct {
 		UUID   string           `json:"uuid"`
 		Status runner.JobStatus `json:"status"`
@@ -200,11 +280,13 @@ func (a *APIv1) SendStatus(ctx *context.Context, uuid string, js runner.JobStatu
 
 	// TODO: Set a timeout for the http request (using context.Deadline)
 
-	req, err := http.NewRequestWithContext(*ctx, http.MethodPost, fmt.Sprintf("%v/api/runner/v1/job/status", a.ControllerIP), bytes.NewBuffer(b))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%v/api/runner/v1/job/status", a.ControllerIP), bytes.NewBuffer(b))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("X-Encodarr-Runner-Name", a.RunnerName)
 
+	sentAt := a.currentTime.Now()
 	resp, err := a.httpClient.Do(req)
 	if err != nil {
 		return err
@@ -212,24 +294,105 @@ func (a *APIv1) SendStatus(ctx *context.Context, uuid string, js runner.JobStatu
 	defer resp.Body.Close() // We need to close the response body to make sure resources are cleaned up
 
 	if resp.StatusCode == 409 {
+		// The Controller rejected the lease renewal, so the job may already belong to another Runner.
+		a.active.set("")
 		return runner.ErrUnresponsive
 	}
+	if resp.StatusCode == http.StatusOK {
+		a.active.renew(uuid, grantedLease(resp.Header), sentAt)
+	}
+
+	return nil
+}
+
+// SendHeartbeat lets the Controller know that this Runner is still alive, even if it isn't working on a job,
+// along with the job it is working on.
+func (a *APIv1) SendHeartbeat(ctx context.Context) error {
+	sentAt := a.currentTime.Now()
+	if uuid, sinceExpired, ok := a.active.expired(sentAt); ok {
+		message := fmt.Sprintf("The lease on job %v expired %v ago without being renewed, so the Controller may give it to another Runner", uuid, sinceExpired.Round(time.Second))
+		logger.Warn(runner.JobInfo{UUID: uuid, LibraryID: -1}.WithFields(message))
+	}
+
+	hb := heartbeat{Jobs: []string{}}
+	uuid := a.active.get()
+	if uuid != "" {
+		hb.Jobs = append(hb.Jobs, uuid)
+	}
+
+	b, err := json.Marshal(hb)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%v/api/runner/v1/heartbeat", a.ControllerIP), bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("X-Encodarr-Runner-Name", a.RunnerName)
+	req.Header.Set("X-Encodarr-Runner-Version", options.Version)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("heartbeat received unexpected status code %v", resp.StatusCode)
+	}
+	// The Controller renews the leases on the jobs that are sent with a heartbeat.
+	a.active.renew(uuid, 0, sentAt)
 
 	return nil
 }
 
+// leaseDurationHeader carries the lease a Runner asks for in its job requests and the lease the Controller grants
+// in its responses.
+const leaseDurationHeader = "X-Encodarr-Lease-Duration"
+
+// grantedLease returns the lease the Controller granted in its response, or 0 if it didn't grant one.
+// Controllers from before leases were introduced never send the header.
+func grantedLease(h http.Header) time.Duration {
+	s := h.Get(leaseDurationHeader)
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		logger.Warn(fmt.Sprintf("Invalid lease duration from the Controller: `%v`", s))
+		return 0
+	}
+	return d
+}
+
 // job represents a job in the Encodarr ecosystem.
 type job struct {
-	UUID     string       `json:"uuid"`
-	Path     string       `json:"path"`
-	Command  []string     `json:"command"`
-	Metadata FileMetadata `json:"metadata"`
+	UUID      string       `json:"uuid"`
+	LibraryID *int         `json:"library_id"` // nil if the Controller is too old to send it.
+	Path      string       `json:"path"`
+	Command   []string     `json:"command"`
+	Metadata  FileMetadata `json:"metadata"`
+	Benchmark *struct{}    `json:"benchmark"` // nil unless the job is a benchmark. The settings in it are only used by the Controller.
+}
+
+type heartbeat struct {
+	Jobs []string `json:"jobs"`
 }
 
 type historyEntry struct {
-	UUID    string  `json:"uuid"`
-	Failed  bool    `json:"failed"`
-	History history `json:"history"`
+	UUID      string          `json:"uuid"`
+	Failed    bool            `json:"failed"`
+	Benchmark *benchmarkStats `json:"benchmark,omitempty"` // nil unless the job is a benchmark which succeeded.
+	History   history         `json:"history"`
+}
+
+// benchmarkStats is what the Runner measured while running a benchmark job.
+type benchmarkStats struct {
+	Elapsed       time.Duration `json:"elapsed"`
+	FPS           float64       `json:"fps"`
+	ProjectedSize int64         `json:"projected_size"` // The size of the transcoded file in bytes.
 }
 
 type history struct {
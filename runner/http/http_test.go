@@ -80,7 +80,7 @@ func TestSendJobComplete(t *testing.T) {
 				apiV1.currentTime = &mockCurrentTime{time: test.inDate}
 
 				ctx := context.Background()
-				outErr := apiV1.SendJobComplete(&ctx, test.inJI, test.inCR)
+				outErr := apiV1.SendJobComplete(ctx, test.inJI, test.inCR)
 
 				if outErr != nil {
 					t.Errorf("unexpected error: %v", outErr)
@@ -107,7 +107,7 @@ func TestSendJobComplete(t *testing.T) {
 		apiV1.httpClient = &hC
 
 		ctx := context.Background()
-		outErr := apiV1.SendJobComplete(&ctx, runner.JobInfo{}, runner.CommandResults{Failed: true})
+		outErr := apiV1.SendJobComplete(ctx, runner.JobInfo{}, runner.CommandResults{Failed: true})
 
 		if outErr != nil {
 			t.Errorf("unexpected error: %v", outErr)
@@ -119,6 +119,45 @@ func TestSendJobComplete(t *testing.T) {
 		}
 	})
 
+	t.Run("Benchmarks Report Stats Without Sending a File", func(t *testing.T) {
+		hC := mockHTTPClient{
+			DoResponse: netHTTP.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(&bytes.Buffer{}),
+			},
+		}
+		apiV1.httpClient = &hC
+		apiV1.fS = &mockFS{statSizes: map[string]int64{"/tmp/output.mkv": 1024}}
+		apiV1.currentTime = &mockCurrentTime{time: time.Unix(0, 0).UTC()}
+
+		ji := runner.JobInfo{UUID: "uuid-4", OutFile: "/tmp/output.mkv", Benchmark: true}
+		outErr := apiV1.SendJobComplete(context.Background(), ji, runner.CommandResults{JobElapsedTime: 2 * time.Second, FPS: 59.5, Warnings: []string{}, Errors: []string{}})
+		if outErr != nil {
+			t.Errorf("unexpected error: %v", outErr)
+		}
+
+		if contentType := hC.LastRequest.Header.Get("Content-Type"); strings.HasPrefix(contentType, "multipart/") {
+			t.Errorf("expected %v not to start with 'multipart/'", contentType)
+		}
+		expected := `{"uuid":"uuid-4","failed":false,"benchmark":{"elapsed":2000000000,"fps":59.5,"projected_size":1024},"history":{"file":"","datetime_completed":"1970-01-01T00:00:00Z","warnings":[],"errors":[]}}`
+		if outHeader := hC.LastRequest.Header.Get("X-Encodarr-History-Entry"); outHeader != expected {
+			t.Errorf("expected %v but got %v", expected, outHeader)
+		}
+
+		// A benchmark whose transcoded file is missing can't report a projected size, so it is reported as failed.
+		ji.OutFile = "/tmp/missing.mkv"
+		if outErr = apiV1.SendJobComplete(context.Background(), ji, runner.CommandResults{}); outErr != nil {
+			t.Errorf("unexpected error: %v", outErr)
+		}
+		if outHeader := hC.LastRequest.Header.Get("X-Encodarr-History-Entry"); !strings.Contains(outHeader, `"failed":true`) || strings.Contains(outHeader, `"benchmark"`) {
+			t.Errorf("expected the benchmark to be reported as failed without stats but got %v", outHeader)
+		}
+
+		apiV1.httpClient = &mockHTTPClient{}
+		apiV1.fS = &mockFS{}
+		apiV1.currentTime = TimeNow{}
+	})
+
 	t.Run("HTTPClient.Do is Called", func(t *testing.T) {
 		hC := mockHTTPClient{
 			DoResponse: netHTTP.Response{
@@ -129,7 +168,7 @@ func TestSendJobComplete(t *testing.T) {
 		apiV1.httpClient = &hC
 
 		ctx := context.Background()
-		outErr := apiV1.SendJobComplete(&ctx, runner.JobInfo{}, runner.CommandResults{})
+		outErr := apiV1.SendJobComplete(ctx, runner.JobInfo{}, runner.CommandResults{})
 
 		if outErr != nil {
 			t.Errorf("unexpected error: %v", outErr)
@@ -151,7 +190,7 @@ func TestSendJobComplete(t *testing.T) {
 		}
 
 		ctx := context.Background()
-		outErr := apiV1.SendJobComplete(&ctx, runner.JobInfo{}, runner.CommandResults{})
+		outErr := apiV1.SendJobComplete(ctx, runner.JobInfo{}, runner.CommandResults{})
 
 		if outErr != runner.ErrUnresponsive {
 			t.Errorf("expected ErrUnresponsive but got %v", outErr)
@@ -183,9 +222,10 @@ func TestSendNewJobRequest(t *testing.T) {
 		}{
 			{
 				name:  "Filled in (Encode to HEVC)",
-				inStr: `{"uuid": "uuid-4", "path": "/media/testFile.mp4", "command": ["-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"], "metadata": {"general": {"duration": 0}}}`,
+				inStr: `{"uuid": "uuid-4", "library_id": 2, "path": "/media/testFile.mp4", "command": ["-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"], "metadata": {"general": {"duration": 0}}}`,
 				expected: runner.JobInfo{
 					UUID:          "uuid-4",
+					LibraryID:     2,
 					File:          "/media/testFile.mp4",
 					InFile:        "/tmp/input.mp4",
 					OutFile:       "/tmp/output.mkv",
@@ -193,6 +233,35 @@ func TestSendNewJobRequest(t *testing.T) {
 					MediaDuration: 0,
 				},
 			},
+			{
+				// Older Controllers don't send the library ID
+				name:  "Extract Closed Captions",
+				inStr: `{"uuid": "uuid-4", "path": "/media/testFile.mkv", "command": ["-i", "ENCODARR_INPUT_FILE", "-f", "lavfi", "-i", "movie=ENCODARR_INPUT_FILE[out0+subcc]", "-map", "1:s", "-c:s", "srt", "ENCODARR_CAPTIONS_FILE", "-map", "0:v", "-vcodec", "hevc"], "metadata": {"general": {"duration": 0}}}`,
+				expected: runner.JobInfo{
+					UUID:          "uuid-4",
+					LibraryID:     -1,
+					File:          "/media/testFile.mkv",
+					InFile:        "/tmp/input.mkv",
+					OutFile:       "/tmp/output.mkv",
+					CaptionsFile:  "/tmp/captions.srt",
+					CommandArgs:   []string{"-i", "/tmp/input.mkv", "-f", "lavfi", "-i", "movie=/tmp/input.mkv[out0+subcc]", "-map", "1:s", "-c:s", "srt", "/tmp/captions.srt", "-map", "0:v", "-vcodec", "hevc", "/tmp/output.mkv"},
+					MediaDuration: 0,
+				},
+			},
+			{
+				name:  "Benchmark",
+				inStr: `{"uuid": "uuid-4", "library_id": 2, "path": "/media/testFile.mp4", "command": ["-i", "ENCODARR_INPUT_FILE", "-vcodec", "hevc"], "metadata": {"general": {"duration": 0}}, "benchmark": {"runner": "test", "settings": "{}"}}`,
+				expected: runner.JobInfo{
+					UUID:          "uuid-4",
+					LibraryID:     2,
+					File:          "/media/testFile.mp4",
+					InFile:        "/tmp/input.mp4",
+					OutFile:       "/tmp/output.mkv",
+					CommandArgs:   []string{"-i", "/tmp/input.mp4", "-vcodec", "hevc", "/tmp/output.mkv"},
+					MediaDuration: 0,
+					Benchmark:     true,
+				},
+			},
 		}
 
 		for _, test := range tests {
@@ -207,7 +276,7 @@ func TestSendNewJobRequest(t *testing.T) {
 				apiV1.httpClient = &hC
 
 				ctx := context.Background()
-				outJI, outErr := apiV1.SendNewJobRequest(&ctx)
+				outJI, outErr := apiV1.SendNewJobRequest(ctx)
 
 				if outErr != nil {
 					t.Errorf("unexpected error: %v", outErr)
@@ -231,7 +300,7 @@ func TestSendNewJobRequest(t *testing.T) {
 		apiV1.httpClient = &hC
 
 		ctx := context.Background()
-		_, outErr := apiV1.SendNewJobRequest(&ctx)
+		_, outErr := apiV1.SendNewJobRequest(ctx)
 
 		if outErr != nil {
 			t.Errorf("unexpected error: %v", outErr)
@@ -256,7 +325,7 @@ func TestSendNewJobRequest(t *testing.T) {
 		apiV1.fS = &fS
 
 		ctx := context.Background()
-		outJI, outErr := apiV1.SendNewJobRequest(&ctx)
+		outJI, outErr := apiV1.SendNewJobRequest(ctx)
 
 		if outErr != nil {
 			t.Errorf("unexpected error: %v", outErr)
@@ -282,7 +351,7 @@ func TestSendNewJobRequest(t *testing.T) {
 		}
 
 		ctx := context.Background()
-		_, outErr := apiV1.SendNewJobRequest(&ctx)
+		_, outErr := apiV1.SendNewJobRequest(ctx)
 
 		if outErr != nil {
 			t.Errorf("expected nil but got %v", outErr)
@@ -292,6 +361,102 @@ func TestSendNewJobRequest(t *testing.T) {
 	})
 }
 
+func TestSendNewJobRequestLease(t *testing.T) {
+	apiV1, err := NewAPIv1("/tmp", "test", "", "")
+	if err != nil {
+		t.Errorf("Unexpected error creating apiV1: %v", err)
+		return
+	}
+	apiV1.Dir = "/tmp"
+	apiV1.fS = &mockFS{}
+
+	// The Runner's clock is far behind the Controller's, which must not matter because only durations are exchanged.
+	sentAt := time.Unix(1000, 0)
+	apiV1.currentTime = &mockCurrentTime{time: sentAt}
+
+	tests := []struct {
+		name             string
+		requested        time.Duration
+		granted          string
+		expectedHeader   string
+		expectedDeadline time.Time
+	}{
+		{name: "Controller Decides", granted: "1h0m0s", expectedDeadline: sentAt.Add(time.Hour)},
+		{name: "Requested Lease", requested: 2 * time.Hour, granted: "2h0m0s", expectedHeader: "2h0m0s", expectedDeadline: sentAt.Add(2 * time.Hour)},
+		{name: "Controller Without Leases", requested: time.Hour, expectedHeader: "1h0m0s"},
+		{name: "Invalid Grant", granted: "soon"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := map[string][]string{"X-Encodarr-Job-Info": {`{"uuid": "uuid-4", "metadata": {"general": {"duration": 0}}}`}}
+			if test.granted != "" {
+				header["X-Encodarr-Lease-Duration"] = []string{test.granted}
+			}
+			hC := mockHTTPClient{
+				DoResponse: netHTTP.Response{
+					StatusCode: 200,
+					Body:       io.NopCloser(&bytes.Buffer{}),
+					Header:     header,
+				},
+			}
+			apiV1.httpClient = &hC
+			apiV1.LeaseDuration = test.requested
+
+			ctx := context.Background()
+			if _, err := apiV1.SendNewJobRequest(ctx); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if h := hC.LastRequest.Header.Get("X-Encodarr-Lease-Duration"); h != test.expectedHeader {
+				t.Errorf("expected lease header %q but got %q", test.expectedHeader, h)
+			}
+			if d := apiV1.active.deadline(); !d.Equal(test.expectedDeadline) {
+				t.Errorf("expected lease deadline %v but got %v", test.expectedDeadline, d)
+			}
+		})
+	}
+}
+
+func TestApiV1SendStatusRenewsLease(t *testing.T) {
+	apiV1, err := NewAPIv1(options.TempDir(), "", "", "")
+	if err != nil {
+		t.Errorf("Unexpected error creating apiV1: %v", err)
+		return
+	}
+
+	start := time.Unix(1000, 0)
+	cT := mockCurrentTime{time: start}
+	apiV1.currentTime = &cT
+	apiV1.active.start("uuid-4", time.Minute, start)
+
+	apiV1.httpClient = &mockHTTPClient{
+		DoResponse: netHTTP.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(&bytes.Buffer{}),
+		},
+	}
+	cT.time = start.Add(30 * time.Second)
+
+	ctx := context.Background()
+	if err := apiV1.SendStatus(ctx, "uuid-4", runner.JobStatus{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if expected, d := start.Add(90*time.Second), apiV1.active.deadline(); !d.Equal(expected) {
+		t.Errorf("expected lease deadline %v but got %v", expected, d)
+	}
+
+	// A status update for a job that isn't active doesn't renew anything.
+	cT.time = start.Add(time.Minute)
+	if err := apiV1.SendStatus(ctx, "uuid-5", runner.JobStatus{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if expected, d := start.Add(90*time.Second), apiV1.active.deadline(); !d.Equal(expected) {
+		t.Errorf("expected lease deadline %v but got %v", expected, d)
+	}
+}
+
 func TestApiV1SendStatus(t *testing.T) {
 	apiV1, err := NewAPIv1(options.TempDir(), "", "", "")
 	if err != nil {
@@ -320,7 +485,7 @@ func TestApiV1SendStatus(t *testing.T) {
 		apiV1.httpClient = &c
 
 		ctx := context.Background()
-		err = apiV1.SendStatus(&ctx, "uuid-4", in)
+		err = apiV1.SendStatus(ctx, "uuid-4", in)
 
 		if err != nil {
 			t.Errorf("unexpected error %v", err)
@@ -345,7 +510,7 @@ func TestApiV1SendStatus(t *testing.T) {
 		}
 
 		ctx := context.Background()
-		err = apiV1.SendStatus(&ctx, "uuid-4", runner.JobStatus{})
+		err = apiV1.SendStatus(ctx, "uuid-4", runner.JobStatus{})
 
 		if err == nil {
 			t.Errorf("Expected Unresponsive error: %v", err)
@@ -354,3 +519,57 @@ func TestApiV1SendStatus(t *testing.T) {
 		}
 	})
 }
+
+func TestApiV1SendHeartbeat(t *testing.T) {
+	apiV1, err := NewAPIv1(options.TempDir(), "runner-1", "", "")
+	if err != nil {
+		t.Errorf("Unexpected error creating apiV1: %v", err)
+		return
+	}
+
+	tests := []struct {
+		name         string
+		activeJob    string
+		statusCode   int
+		expectedBody string
+		expectError  bool
+	}{
+		{name: "Idle", statusCode: 200, expectedBody: `{"jobs":[]}`, expectError: false},
+		{name: "Working on a Job", activeJob: "uuid-4", statusCode: 200, expectedBody: `{"jobs":["uuid-4"]}`, expectError: false},
+		{name: "Unexpected Status Code", statusCode: 500, expectedBody: `{"jobs":[]}`, expectError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := mockHTTPClient{
+				DoResponse: netHTTP.Response{
+					StatusCode: test.statusCode,
+					Body:       io.NopCloser(&bytes.Buffer{}),
+				},
+			}
+			apiV1.httpClient = &c
+			apiV1.active.set(test.activeJob)
+
+			ctx := context.Background()
+			err := apiV1.SendHeartbeat(ctx)
+
+			if (err != nil) != test.expectError {
+				t.Errorf("expected error to be %v but got %v", test.expectError, err)
+			}
+			if c.LastRequest.URL.Path != "/api/runner/v1/heartbeat" {
+				t.Errorf("expected request to /api/runner/v1/heartbeat but got %v", c.LastRequest.URL.Path)
+			}
+			if name := c.LastRequest.Header.Get("X-Encodarr-Runner-Name"); name != "runner-1" {
+				t.Errorf("expected runner name header to be runner-1 but got %v", name)
+			}
+
+			b, err := io.ReadAll(c.LastRequest.Body)
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if string(b) != test.expectedBody {
+				t.Errorf("expected body %v but got %v", test.expectedBody, string(b))
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"io"
 	netHTTP "net/http"
+	"os"
 	"time"
 )
 
@@ -23,6 +24,7 @@ type CurrentTimer interface {
 type FSer interface {
 	Create(name string) (Filer, error)
 	Open(name string) (Filer, error)
+	Stat(name string) (os.FileInfo, error)
 }
 
 // Filer is a mock interface for the ApiV1 struct which allows
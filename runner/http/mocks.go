@@ -3,6 +3,7 @@ package http
 import (
 	"io"
 	netHTTP "net/http"
+	"os"
 	"time"
 )
 
@@ -32,6 +33,7 @@ func (m *mockCurrentTime) Now() time.Time {
 type mockFS struct {
 	createdFiles []string
 	openedFiles  []string
+	statSizes    map[string]int64
 }
 
 func (m *mockFS) Create(name string) (Filer, error) {
@@ -50,6 +52,22 @@ func (m *mockFS) Open(name string) (Filer, error) {
 	return &mockFiler{name}, nil
 }
 
+func (m *mockFS) Stat(name string) (os.FileInfo, error) {
+	size, ok := m.statSizes[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return mockFileInfo{size: size}, nil
+}
+
+// mockFileInfo is a mock struct for the os.FileInfo interface which only knows its size.
+type mockFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (m mockFileInfo) Size() int64 { return m.size }
+
 // mockFiler is a mock struct for the Filer interface.
 type mockFiler struct {
 	name string
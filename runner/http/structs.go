@@ -2,6 +2,7 @@ package http
 
 import (
 	"os"
+	"sync"
 	"time"
 )
 
@@ -19,6 +20,11 @@ func (o OsFS) Open(name string) (Filer, error) {
 	return os.Open(name)
 }
 
+// Stat wraps os.Stat
+func (o OsFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
 // TimeNow uses time.Now to satisfy the CurrentTimer interface.
 type TimeNow struct{}
 
@@ -27,6 +33,78 @@ func (t TimeNow) Now() time.Time {
 	return time.Now()
 }
 
+// activeJob holds the UUID of the job which the Runner is working on. It is guarded by a mutex because
+// the heartbeats are sent from their own goroutine.
+type activeJob struct {
+	mu   sync.Mutex
+	uuid string
+
+	// lease is how long the Controller grants the job to this Runner for, or 0 if the Controller didn't say.
+	// leaseExpires is measured with this Runner's clock from just before the request which granted or renewed the lease
+	// was sent. The Controller starts the lease after receiving that request, so this Runner never believes it holds a
+	// lease which the Controller considers expired, no matter how far apart their clocks are.
+	lease        time.Duration
+	leaseExpires time.Time
+	warned       bool
+}
+
+func (j *activeJob) get() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.uuid
+}
+
+func (j *activeJob) set(uuid string) {
+	j.start(uuid, 0, time.Time{})
+}
+
+// start sets the active job along with the lease which was granted by a request sent at sentAt.
+func (j *activeJob) start(uuid string, lease time.Duration, sentAt time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.uuid = uuid
+	j.lease = lease
+	j.leaseExpires = time.Time{}
+	j.warned = false
+	if uuid != "" && lease > 0 {
+		j.leaseExpires = sentAt.Add(lease)
+	}
+}
+
+// renew extends the lease on uuid from sentAt. A lease of 0 keeps the previously granted duration.
+func (j *activeJob) renew(uuid string, lease time.Duration, sentAt time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if uuid == "" || j.uuid != uuid {
+		return
+	}
+	if lease > 0 {
+		j.lease = lease
+	}
+	if j.lease > 0 {
+		j.leaseExpires = sentAt.Add(j.lease)
+		j.warned = false
+	}
+}
+
+// expired reports the active job and how long ago its lease expired. It only reports each expiry once.
+func (j *activeJob) expired(now time.Time) (string, time.Duration, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.uuid == "" || j.leaseExpires.IsZero() || j.warned || now.Before(j.leaseExpires) {
+		return "", 0, false
+	}
+	j.warned = true
+	return j.uuid, now.Sub(j.leaseExpires), true
+}
+
+// deadline returns when this Runner considers the lease on the active job to expire. It is zero if there isn't a lease.
+func (j *activeJob) deadline() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.leaseExpires
+}
+
 // FileMetadata contains information about a video file.
 type FileMetadata struct {
 	General        General         `json:"general"`
@@ -48,12 +126,16 @@ type VideoTrack struct {
 	Width          int    `json:"width"`
 	Height         int    `json:"height"`
 	ColorPrimaries string `json:"color_primaries"`
+	BitDepth       int    `json:"bit_depth"`
+
+	VariableFrameRate bool `json:"variable_frame_rate"`
 }
 
 // AudioTrack contains information about a singular audio stream in a media file.
 type AudioTrack struct {
-	Index    int `json:"index"`
-	Channels int `json:"channels"`
+	Index    int    `json:"index"`
+	Channels int    `json:"channels"`
+	Language string `json:"language"`
 }
 
 // SubtitleTrack contains information about a singular text stream in a media file.
@@ -1,7 +1,11 @@
 package http
 
-// parseFFmpegCmd takes a string slice and creates a valid parameter list for FFmpeg
-func parseFFmpegCmd(inputFname, outputFname string, cmd []string) []string {
+import "strings"
+
+// parseFFmpegCmd takes a string slice and creates a valid parameter list for FFmpeg.
+// ENCODARR_INPUT_FILE is also replaced when it is part of a filter (ex. movie=ENCODARR_INPUT_FILE[out0+subcc]),
+// in which case the input filename is escaped for the filtergraph.
+func parseFFmpegCmd(inputFname, outputFname, captionsFname string, cmd []string) []string {
 	if len(cmd) == 0 {
 		return nil
 	}
@@ -9,12 +13,34 @@ func parseFFmpegCmd(inputFname, outputFname string, cmd []string) []string {
 	var s []string = make([]string, len(cmd))
 
 	for i := range cmd {
-		if cmd[i] == "ENCODARR_INPUT_FILE" {
+		switch {
+		case cmd[i] == "ENCODARR_INPUT_FILE":
 			s[i] = inputFname
-		} else {
+		case cmd[i] == "ENCODARR_CAPTIONS_FILE":
+			s[i] = captionsFname
+		case strings.Contains(cmd[i], "ENCODARR_INPUT_FILE"):
+			s[i] = strings.ReplaceAll(cmd[i], "ENCODARR_INPUT_FILE", escapeFilterArg(inputFname))
+		default:
 			s[i] = cmd[i]
 		}
 	}
 
 	return append(s, outputFname)
 }
+
+// extractsCaptions returns whether or not the command from the Controller writes closed captions to a sidecar file.
+func extractsCaptions(cmd []string) bool {
+	for _, v := range cmd {
+		if v == "ENCODARR_CAPTIONS_FILE" {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeFilterArg escapes s so that it can be used as an option value in an FFmpeg filtergraph.
+// The value is escaped once for the filter's options and again for the filtergraph itself.
+func escapeFilterArg(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(s)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(s)
+}
@@ -42,6 +42,20 @@ func TestParseFFmpegCmd(t *testing.T) {
 			inCmd:    []string{"-hwaccel_device", "/dev/dri/renderD128", "-i", "ENCODARR_INPUT_FILE", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc"},
 			expected: []string{"-hwaccel_device", "/dev/dri/renderD128", "-i", "input.mkv", "-map", "0:s?", "-map", "0:a", "-c", "copy", "-map", "0:v", "-vcodec", "hevc", "output.mkv"},
 		},
+		{
+			name:     "Extract Closed Captions",
+			inFname:  "/tmp/Encodarr/Runner/123/input.mkv",
+			outFname: "output.mkv",
+			inCmd:    []string{"-i", "ENCODARR_INPUT_FILE", "-f", "lavfi", "-i", "movie=ENCODARR_INPUT_FILE[out0+subcc]", "-map", "1:s", "-c:s", "srt", "ENCODARR_CAPTIONS_FILE", "-map", "0:v", "-vcodec", "hevc"},
+			expected: []string{"-i", "/tmp/Encodarr/Runner/123/input.mkv", "-f", "lavfi", "-i", "movie=/tmp/Encodarr/Runner/123/input.mkv[out0+subcc]", "-map", "1:s", "-c:s", "srt", "captions.srt", "-map", "0:v", "-vcodec", "hevc", "output.mkv"},
+		},
+		{
+			name:     "Extract Closed Captions from a Windows Path",
+			inFname:  `C:\Temp\Encodarr\Runner\123\input.mkv`,
+			outFname: "output.mkv",
+			inCmd:    []string{"-i", "ENCODARR_INPUT_FILE", "-f", "lavfi", "-i", "movie=ENCODARR_INPUT_FILE[out0+subcc]", "-map", "1:s", "-c:s", "srt", "ENCODARR_CAPTIONS_FILE"},
+			expected: []string{"-i", `C:\Temp\Encodarr\Runner\123\input.mkv`, "-f", "lavfi", "-i", `movie=C\\:\\\\Temp\\\\Encodarr\\\\Runner\\\\123\\\\input.mkv[out0+subcc]`, "-map", "1:s", "-c:s", "srt", "captions.srt", "output.mkv"},
+		},
 		{
 			name:     "All False Params",
 			inFname:  "input.mkv",
@@ -55,7 +69,7 @@ func TestParseFFmpegCmd(t *testing.T) {
 		testname := fmt.Sprintf("%v", tt.name)
 
 		t.Run(testname, func(t *testing.T) {
-			ans := parseFFmpegCmd(tt.inFname, tt.outFname, tt.inCmd)
+			ans := parseFFmpegCmd(tt.inFname, tt.outFname, "captions.srt", tt.inCmd)
 
 			if !reflect.DeepEqual(ans, tt.expected) {
 				t.Errorf("got %v, expected %v", ans, tt.expected)
@@ -4,15 +4,17 @@ import "context"
 
 // Communicator defines how a struct which talks with a Controller should behave.
 type Communicator interface {
-	SendJobComplete(*context.Context, JobInfo, CommandResults) error
-	SendNewJobRequest(*context.Context) (JobInfo, error)
-	SendStatus(*context.Context, string, JobStatus) error
+	SendJobComplete(context.Context, JobInfo, CommandResults) error
+	SendNewJobRequest(context.Context) (JobInfo, error)
+	SendStatus(context.Context, string, JobStatus) error
+	SendHeartbeat(context.Context) error
 }
 
 // CommandRunner defines how a struct which runs the FFmpeg commands should behave.
 type CommandRunner interface {
 	Done() bool
 	Start(JobInfo)
+	Stop()
 	Status() JobStatus
 	Results() CommandResults
 }
@@ -0,0 +1,180 @@
+// Package logfile provides a log file which is rotated once it reaches a maximum size.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the format of the rotation time which is added to the name of a rotated log file.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Rotation describes when a File is rotated and which of its rotated files are kept.
+type Rotation struct {
+	// MaxSize is the size in bytes that the file may grow to before it is rotated. 0 disables rotation.
+	MaxSize int64
+
+	// MaxBackups is how many rotated files are kept. 0 keeps all of them.
+	MaxBackups int
+
+	// MaxAge is how long rotated files are kept. 0 keeps them regardless of their age.
+	MaxAge time.Duration
+}
+
+// File is an io.Writer which appends to a log file and rotates it once it reaches its maximum size.
+// A rotated file is renamed with the time it was rotated (ex. runner.log becomes runner-2021-08-01T12-00-00.000.log)
+// and a new file is started in its place. Writes are serialized, so it is safe to use from multiple goroutines.
+type File struct {
+	path     string
+	rotation Rotation
+	now      func() time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens the log file at path for appending, creating it and its directory if they don't exist.
+func Open(path string, rotation Rotation) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return nil, err
+	}
+
+	f := &File{path: path, rotation: rotation, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Path returns the path of the current log file.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Write appends p to the log file. If p would take the file past its maximum size, the file is rotated
+// first so that a record is never split between two files.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.rotation.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.rotation.MaxSize {
+		if err := f.rotate(); err != nil {
+			return 0, fmt.Errorf("rotating the log file %v: %w", f.path, err)
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file. Any writes after it fail.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// open opens f.path for appending and reads its current size.
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate renames the current file, starts a new one and removes the rotated files which are no longer kept.
+func (f *File) rotate() error {
+	// Windows can't rename a file which is still open
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	ext := filepath.Ext(f.path)
+	backup := fmt.Sprintf("%v-%v%v", strings.TrimSuffix(f.path, ext), f.now().UTC().Format(backupTimeFormat), ext)
+	renameErr := os.Rename(f.path, backup)
+
+	// Reopen even if the rename failed so that the Runner keeps logging
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	f.removeOldBackups()
+	return nil
+}
+
+// removeOldBackups removes the rotated files beyond MaxBackups and the ones older than MaxAge.
+func (f *File) removeOldBackups() {
+	if f.rotation.MaxBackups == 0 && f.rotation.MaxAge == 0 {
+		return
+	}
+
+	dir := filepath.Dir(f.path)
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(filepath.Base(f.path), ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type backup struct {
+		path    string
+		rotated time.Time
+	}
+	backups := make([]backup, 0)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+
+		// Only files whose names end in a rotation time are backups
+		t, err := time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, name), rotated: t})
+	}
+
+	// Newest first
+	sort.Slice(backups, func(i, j int) bool { return backups[i].rotated.After(backups[j].rotated) })
+
+	for i, b := range backups {
+		tooMany := f.rotation.MaxBackups > 0 && i >= f.rotation.MaxBackups
+		tooOld := f.rotation.MaxAge > 0 && f.now().Sub(b.rotated) > f.rotation.MaxAge
+		if tooMany || tooOld {
+			os.Remove(b.path)
+		}
+	}
+}
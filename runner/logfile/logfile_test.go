@@ -0,0 +1,131 @@
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func dirNames(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		rotation Rotation
+		expected []string
+	}{
+		{
+			name:     "No Rotation",
+			rotation: Rotation{},
+			expected: []string{"runner.log"},
+		},
+		{
+			name:     "Keep All",
+			rotation: Rotation{MaxSize: 1},
+			expected: []string{"runner-2021-08-02T00-00-00.000.log", "runner-2021-08-03T00-00-00.000.log", "runner-2021-08-04T00-00-00.000.log", "runner.log"},
+		},
+		{
+			name:     "Max Backups",
+			rotation: Rotation{MaxSize: 1, MaxBackups: 1},
+			expected: []string{"runner-2021-08-04T00-00-00.000.log", "runner.log"},
+		},
+		{
+			name:     "Max Age",
+			rotation: Rotation{MaxSize: 1, MaxAge: 36 * time.Hour},
+			expected: []string{"runner-2021-08-03T00-00-00.000.log", "runner-2021-08-04T00-00-00.000.log", "runner.log"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			f, err := Open(filepath.Join(dir, "runner.log"), test.rotation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			now := time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC)
+			f.now = func() time.Time { return now }
+			for i := 0; i < 4; i++ {
+				if _, err = f.Write([]byte(fmt.Sprintf("record %v\n", i))); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				now = now.Add(24 * time.Hour)
+			}
+
+			if names := dirNames(t, dir); !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected %v but got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	f, err := Open(filepath.Join(dir, "runner.log"), Rotation{MaxSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rotations int
+	f.now = func() time.Time {
+		rotations++
+		return time.Date(2021, time.August, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(rotations) * time.Millisecond)
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				f.Write([]byte(fmt.Sprintf("record %03d of worker %v\n", j, i)))
+			}
+		}(i)
+	}
+	wg.Wait()
+	f.Close()
+
+	names := dirNames(t, dir)
+	if len(names) < 2 {
+		t.Errorf("expected the file to be rotated but got %v", names)
+	}
+
+	var lines []string
+	for _, name := range names {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")...)
+	}
+	if len(lines) != 400 {
+		t.Fatalf("expected 400 records but got %v", len(lines))
+	}
+	for _, line := range lines {
+		if len(line) != len("record 000 of worker 0") || !strings.HasPrefix(line, "record ") {
+			t.Errorf("expected every record to be intact but got %q", line)
+		}
+	}
+
+	if _, err = f.Write([]byte("closed\n")); err == nil {
+		t.Errorf("expected an error writing to a closed file")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/BrenekH/encodarr/runner/logfile"
 	"github.com/BrenekH/encodarr/runner/options"
 	"github.com/BrenekH/logange"
 )
@@ -23,17 +25,58 @@ func init() {
 
 	logange.RootLogger.AddHandler(&rootStdoutHandler)
 
-	// Setup a file handler for the root logger if we are not in test mode
-	if !options.InTestMode() {
-		rootFileHandler, err := logange.NewFileHandler(fmt.Sprintf("%v/runner.log", options.ConfigDir()))
+	// Setup a rotating file handler for the root logger if we are not in test mode
+	if path := options.LogFile(); !options.InTestMode() && path != "" {
+		f, err := logfile.Open(path, logfile.Rotation{
+			MaxSize:    options.LogMaxSize(),
+			MaxBackups: options.LogMaxBackups(),
+			MaxAge:     options.LogMaxAge(),
+		})
 		if err != nil {
-			log.Printf("Error creating rootFileHandler: %v", err)
+			log.Printf("Error opening the log file: %v", err)
 			os.Exit(10)
 			return
 		}
-		rootFileHandler.SetFormatter(formatter)
-		rootFileHandler.SetLevel(options.LogLevel())
 
+		rootFileHandler := rotatingFileHandler{file: f, formatter: formatter, logLevel: options.LogLevel()}
 		logange.RootLogger.AddHandler(&rootFileHandler)
 	}
 }
+
+// rotatingFileHandler is a logange.Handler which writes to a log file that is rotated once it reaches its maximum size.
+type rotatingFileHandler struct {
+	file      *logfile.File
+	formatter logange.Formatter
+	logLevel  logange.Level
+}
+
+// SetFormatter sets the formatter for the handler to use
+func (h *rotatingFileHandler) SetFormatter(f logange.Formatter) {
+	h.formatter = f
+}
+
+// SetLevel sets the level the handler uses
+func (h *rotatingFileHandler) SetLevel(lvl logange.Level) {
+	h.logLevel = lvl
+}
+
+// Level returns the current logging level
+func (h *rotatingFileHandler) Level() logange.Level {
+	return h.logLevel
+}
+
+// LevelString returns the current logging level as a string
+func (h *rotatingFileHandler) LevelString() string {
+	return logange.LevelToString(h.logLevel)
+}
+
+// RecordLog writes the formatted log to the log file
+func (h *rotatingFileHandler) RecordLog(message string, logLvl logange.Level, lineno string, name string, datetime time.Time) {
+	if logLvl < h.logLevel {
+		return
+	}
+
+	if _, err := h.file.Write([]byte(h.formatter.Format(message, logange.LevelToString(logLvl), lineno, name, datetime))); err != nil {
+		fmt.Printf("Error writing to log file %v: %v\n", h.file.Path(), err)
+	}
+}
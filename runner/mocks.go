@@ -1,6 +1,9 @@
 package runner
 
-import "context"
+import (
+	"context"
+	"sync"
+)
 
 type mockCmdRunner struct {
 	done           bool
@@ -13,6 +16,7 @@ type mockCmdRunner struct {
 
 	doneCalled    bool
 	startCalled   bool
+	stopCalled    bool
 	statusCalled  bool
 	resultsCalled bool
 }
@@ -27,6 +31,11 @@ func (r *mockCmdRunner) Start(ji JobInfo) {
 	r.jobInfo = ji
 }
 
+func (r *mockCmdRunner) Stop() {
+	r.stopCalled = true
+	r.done = true
+}
+
 func (r *mockCmdRunner) Status() JobStatus {
 	r.statusCalled = true
 
@@ -51,6 +60,10 @@ type mockCommunicator struct {
 
 	statusReturnErr error
 
+	// heartbeats is guarded by heartbeatsMu because SendHeartbeats may be run in its own goroutine.
+	heartbeatsMu sync.Mutex
+	heartbeats   int
+
 	statusTimesCalled int
 
 	jobCompleteCalled bool
@@ -61,19 +74,19 @@ type mockCommunicator struct {
 	statusSetOnlyFirst bool
 }
 
-func (c *mockCommunicator) SendJobComplete(ctx *context.Context, ji JobInfo, cr CommandResults) error {
+func (c *mockCommunicator) SendJobComplete(ctx context.Context, ji JobInfo, cr CommandResults) error {
 	c.jobCompleteCalled = true
 	c.jobComJobInfo = ji
 	c.cmdResults = cr
 	return nil
 }
 
-func (c *mockCommunicator) SendNewJobRequest(ctx *context.Context) (JobInfo, error) {
+func (c *mockCommunicator) SendNewJobRequest(ctx context.Context) (JobInfo, error) {
 	c.newJobCalled = true
 	return c.jobReqJobInfo, nil
 }
 
-func (c *mockCommunicator) SendStatus(ctx *context.Context, uuid string, js JobStatus) error {
+func (c *mockCommunicator) SendStatus(ctx context.Context, uuid string, js JobStatus) error {
 	c.statusTimesCalled++
 	if c.statusSetOnlyFirst && !c.statusCalled {
 		c.statusUUID = uuid
@@ -82,3 +95,10 @@ func (c *mockCommunicator) SendStatus(ctx *context.Context, uuid string, js JobS
 	c.statusCalled = true
 	return c.statusReturnErr
 }
+
+func (c *mockCommunicator) SendHeartbeat(ctx context.Context) error {
+	c.heartbeatsMu.Lock()
+	defer c.heartbeatsMu.Unlock()
+	c.heartbeats++
+	return nil
+}
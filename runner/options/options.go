@@ -6,6 +6,7 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -40,6 +41,24 @@ var controllerIP string = "localhost"
 var controllerPortConst optionConst = optionConst{"ENCODARR_RUNNER_CONTROLLER_PORT", "controller-port", "Sets the port for connecting to a Controller.", "--controller-port <port>"}
 var controllerPort string = "8123"
 
+var heartbeatIntervalConst optionConst = optionConst{"ENCODARR_RUNNER_HEARTBEAT_INTERVAL", "heartbeat-interval", "Sets how often the Runner tells the Controller that it is still alive.", "--heartbeat-interval <duration>"}
+var heartbeatInterval string = "30s"
+
+var leaseDurationConst optionConst = optionConst{"ENCODARR_RUNNER_LEASE_DURATION", "lease-duration", "Sets the lease the Runner asks the Controller for when requesting a job. 0s leaves it up to the Controller.", "--lease-duration <duration>"}
+var leaseDuration string = "0s"
+
+var logFileConst optionConst = optionConst{"ENCODARR_LOG_FILE", "log-file", "Sets the file that logs are written to in addition to the console. Defaults to runner.log in the config directory. none disables the log file.", "--log-file <file|none>"}
+var logFile string = ""
+
+var logMaxSizeConst optionConst = optionConst{"ENCODARR_LOG_MAX_SIZE", "log-max-size", "Sets the size in MiB that the log file may grow to before it is rotated. 0 disables rotation.", "--log-max-size <MiB>"}
+var logMaxSize string = "100"
+
+var logMaxBackupsConst optionConst = optionConst{"ENCODARR_LOG_MAX_BACKUPS", "log-max-backups", "Sets how many rotated log files are kept. 0 keeps all of them.", "--log-max-backups <count>"}
+var logMaxBackups string = "5"
+
+var logMaxAgeConst optionConst = optionConst{"ENCODARR_LOG_MAX_AGE", "log-max-age", "Sets how long rotated log files are kept. 0s keeps them regardless of their age.", "--log-max-age <duration>"}
+var logMaxAge string = "0s"
+
 var inTestMode bool = strings.HasSuffix(os.Args[0], ".test") || strings.HasSuffix(os.Args[0], ".test.exe")
 
 var inputsParsed bool = false
@@ -96,6 +115,24 @@ func parseInputs() {
 	stringVarFromEnv(&controllerPort, controllerPortConst.EnvVar)
 	stringVar(&controllerPort, controllerPortConst.CmdLine, controllerPortConst.Description, controllerPortConst.Usage)
 
+	// Heartbeat interval
+	stringVarFromEnv(&heartbeatInterval, heartbeatIntervalConst.EnvVar)
+	stringVar(&heartbeatInterval, heartbeatIntervalConst.CmdLine, heartbeatIntervalConst.Description, heartbeatIntervalConst.Usage)
+
+	// Lease duration
+	stringVarFromEnv(&leaseDuration, leaseDurationConst.EnvVar)
+	stringVar(&leaseDuration, leaseDurationConst.CmdLine, leaseDurationConst.Description, leaseDurationConst.Usage)
+
+	// Log file
+	stringVarFromEnv(&logFile, logFileConst.EnvVar)
+	stringVar(&logFile, logFileConst.CmdLine, logFileConst.Description, logFileConst.Usage)
+	stringVarFromEnv(&logMaxSize, logMaxSizeConst.EnvVar)
+	stringVar(&logMaxSize, logMaxSizeConst.CmdLine, logMaxSizeConst.Description, logMaxSizeConst.Usage)
+	stringVarFromEnv(&logMaxBackups, logMaxBackupsConst.EnvVar)
+	stringVar(&logMaxBackups, logMaxBackupsConst.CmdLine, logMaxBackupsConst.Description, logMaxBackupsConst.Usage)
+	stringVarFromEnv(&logMaxAge, logMaxAgeConst.EnvVar)
+	stringVar(&logMaxAge, logMaxAgeConst.CmdLine, logMaxAgeConst.Description, logMaxAgeConst.Usage)
+
 	if !inTestMode {
 		makeConfigDir()
 	}
@@ -170,6 +207,82 @@ func ControllerPort() string {
 	return controllerPort
 }
 
+// HeartbeatInterval returns how often the Runner should tell the Controller that it is still alive.
+func HeartbeatInterval() time.Duration {
+	parseInputs()
+
+	d, err := time.ParseDuration(heartbeatInterval)
+	if err != nil || d <= 0 {
+		logger.Warn(fmt.Sprintf("Invalid heartbeat interval: `%v`. Default to 30s.", heartbeatInterval))
+		return 30 * time.Second
+	}
+	return d
+}
+
+// LeaseDuration returns the lease the Runner should ask the Controller for when requesting a job.
+// 0 means that the Controller decides.
+func LeaseDuration() time.Duration {
+	parseInputs()
+
+	d, err := time.ParseDuration(leaseDuration)
+	if err != nil || d < 0 {
+		logger.Warn(fmt.Sprintf("Invalid lease duration: `%v`. Default to 0s.", leaseDuration))
+		return 0
+	}
+	return d
+}
+
+// LogFile returns the path of the log file, or an empty string if logs are only written to the console.
+func LogFile() string {
+	parseInputs()
+
+	switch logFile {
+	case "":
+		return fmt.Sprintf("%v/runner.log", configDir)
+	case "none":
+		return ""
+	}
+	return logFile
+}
+
+// The log file getters use fmt.Printf instead of logger.Warn because they are used to set up the loggers.
+
+// LogMaxSize returns the size in bytes that the log file may grow to before it is rotated. 0 disables rotation.
+func LogMaxSize() int64 {
+	parseInputs()
+
+	n, err := strconv.ParseInt(logMaxSize, 10, 64)
+	if err != nil || n < 0 {
+		fmt.Printf("Invalid log max size: `%v`. Default to 100.\n", logMaxSize)
+		return 100 << 20
+	}
+	return n << 20
+}
+
+// LogMaxBackups returns how many rotated log files are kept. 0 keeps all of them.
+func LogMaxBackups() int {
+	parseInputs()
+
+	n, err := strconv.Atoi(logMaxBackups)
+	if err != nil || n < 0 {
+		fmt.Printf("Invalid log max backups: `%v`. Default to 5.\n", logMaxBackups)
+		return 5
+	}
+	return n
+}
+
+// LogMaxAge returns how long rotated log files are kept. 0 keeps them regardless of their age.
+func LogMaxAge() time.Duration {
+	parseInputs()
+
+	d, err := time.ParseDuration(logMaxAge)
+	if err != nil || d < 0 {
+		fmt.Printf("Invalid log max age: `%v`. Default to 0s.\n", logMaxAge)
+		return 0
+	}
+	return d
+}
+
 // InTestMode indicates whether the package is running under go test or normal conditions.
 func InTestMode() bool {
 	return inTestMode
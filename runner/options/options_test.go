@@ -3,6 +3,7 @@ package options
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestStringVarFromEnv(t *testing.T) {
@@ -73,6 +74,49 @@ func TestControllerPort(t *testing.T) {
 	}
 }
 
+func TestHeartbeatInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		expected time.Duration
+	}{
+		{name: "Valid Duration", in: "10s", expected: 10 * time.Second},
+		{name: "Invalid Duration", in: "often", expected: 30 * time.Second},
+		{name: "Zero Duration", in: "0s", expected: 30 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			heartbeatInterval = test.in
+			if d := HeartbeatInterval(); d != test.expected {
+				t.Errorf("expected %v but got %v", test.expected, d)
+			}
+		})
+	}
+}
+
+func TestLeaseDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		expected time.Duration
+	}{
+		{name: "Valid Duration", in: "6h", expected: 6 * time.Hour},
+		{name: "Zero Duration", in: "0s", expected: 0},
+		{name: "Invalid Duration", in: "long", expected: 0},
+		{name: "Negative Duration", in: "-1h", expected: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			leaseDuration = test.in
+			if d := LeaseDuration(); d != test.expected {
+				t.Errorf("expected %v but got %v", test.expected, d)
+			}
+		})
+	}
+}
+
 func TestInTestMode(t *testing.T) {
 	tm := InTestMode()
 	v := inTestMode
@@ -2,12 +2,13 @@ package runner
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"time"
 )
 
 // Run runs the basic loop of the Runner
-func Run(ctx *context.Context, c Communicator, r CommandRunner, testMode bool) {
+func Run(ctx context.Context, c Communicator, r CommandRunner, testMode bool) {
 	looped := false
 
 	for {
@@ -55,11 +56,11 @@ func Run(ctx *context.Context, c Communicator, r CommandRunner, testMode bool) {
 			err = c.SendStatus(ctx, ji.UUID, status)
 			if err != nil {
 				if err == ErrUnresponsive {
-					logger.Warn(err.Error())
+					logger.Warn(ji.WithFields(err.Error()))
 					unresponsive = true
 					break
 				} else {
-					logger.Error(err.Error())
+					logger.Error(ji.WithFields(err.Error()))
 				}
 			}
 
@@ -67,8 +68,13 @@ func Run(ctx *context.Context, c Communicator, r CommandRunner, testMode bool) {
 				break
 			}
 		}
-		// If we are detected as unresponsive, skip sending the job complete request.
+		// If we are detected as unresponsive, the lease on the job was lost and the Controller won't accept it anymore.
+		// The command is stopped and the job complete request is skipped.
 		if unresponsive {
+			r.Stop()
+			for !r.Done() {
+				time.Sleep(sleepAmount)
+			}
 			cleanup(ji)
 			continue
 		}
@@ -84,22 +90,36 @@ func Run(ctx *context.Context, c Communicator, r CommandRunner, testMode bool) {
 
 		// Make sure that the Web UI properly states that we are copying the result to the Controller.
 		// Setting Percentage to 100 also makes sure that the Runner card appears at the top of the page.
+		stage := "Copying to Controller"
+		if ji.Benchmark {
+			stage = "Reporting Benchmark"
+		}
 		err = c.SendStatus(ctx, ji.UUID, JobStatus{
-			Stage:                       "Copying to Controller",
+			Stage:                       stage,
 			Percentage:                  "100",
 			JobElapsedTime:              cmdResults.JobElapsedTime.String(),
 			FPS:                         "N/A",
 			StageElapsedTime:            "N/A",
 			StageEstimatedTimeRemaining: "N/A",
 		})
-		if err != nil {
-			logger.Warn(err.Error())
+		if err == ErrUnresponsive {
+			logger.Warn(ji.WithFields(err.Error()))
+			cleanup(ji)
+			continue
+		} else if err != nil {
+			logger.Warn(ji.WithFields(err.Error()))
 		}
 
 		// Send job complete
 		err = c.SendJobComplete(ctx, ji, cmdResults)
 		if err != nil {
-			logger.Error(err.Error())
+			logger.Error(ji.WithFields(err.Error()))
+		} else if cmdResults.Failed {
+			logger.Info(ji.WithFields(fmt.Sprintf("Sent job %v to the Controller as failed", ji.UUID)))
+		} else if ji.Benchmark {
+			logger.Info(ji.WithFields(fmt.Sprintf("Sent benchmark %v to the Controller", ji.UUID)))
+		} else {
+			logger.Info(ji.WithFields(fmt.Sprintf("Sent job %v to the Controller as completed", ji.UUID)))
 		}
 
 		cleanup(ji)
@@ -108,22 +128,28 @@ func Run(ctx *context.Context, c Communicator, r CommandRunner, testMode bool) {
 
 // IsContextFinished returns a boolean indicating whether or not a context.Context is finished.
 // This replaces the need to use a select code block.
-func IsContextFinished(ctx *context.Context) bool {
+func IsContextFinished(ctx context.Context) bool {
 	select {
-	case <-(*ctx).Done():
+	case <-ctx.Done():
 		return true
 	default:
 		return false
 	}
 }
 
-// cleanup uses os.Remove to delete JobInfo.InFile and JobInfo.OutFile.
+// cleanup uses os.Remove to delete JobInfo.InFile, JobInfo.OutFile, and JobInfo.CaptionsFile if it is set.
 func cleanup(ji JobInfo) {
 	if err := os.Remove(ji.InFile); err != nil {
-		logger.Warn(err.Error())
+		logger.Warn(ji.WithFields(err.Error()))
 	}
 
 	if err := os.Remove(ji.OutFile); err != nil {
-		logger.Warn(err.Error())
+		logger.Warn(ji.WithFields(err.Error()))
+	}
+
+	if ji.CaptionsFile != "" {
+		if err := os.Remove(ji.CaptionsFile); err != nil {
+			logger.Warn(ji.WithFields(err.Error()))
+		}
 	}
 }
@@ -15,7 +15,7 @@ func TestRun(t *testing.T) {
 		mCommunicator := mockCommunicator{}
 		ctx := context.Background()
 
-		Run(&ctx, &mCommunicator, &mCmdRunner, true)
+		Run(ctx, &mCommunicator, &mCmdRunner, true)
 
 		if mCmdRunner.statusLoops != mCmdRunner.statusLoopout {
 			t.Errorf("expected CmdRunner to run %v times but got %v instead", mCmdRunner.statusLoopout, mCmdRunner.statusLoops)
@@ -35,7 +35,7 @@ func TestRun(t *testing.T) {
 		mCommunicator := mockCommunicator{}
 		ctx := context.Background()
 
-		Run(&ctx, &mCommunicator, &mCmdRunner, true)
+		Run(ctx, &mCommunicator, &mCmdRunner, true)
 
 		// Command Runner
 		if !mCmdRunner.doneCalled {
@@ -75,7 +75,7 @@ func TestRun(t *testing.T) {
 		mCommunicator := mockCommunicator{}
 		ctx := context.Background()
 
-		Run(&ctx, &mCommunicator, &mCmdRunner, true)
+		Run(ctx, &mCommunicator, &mCmdRunner, true)
 
 		// Command Runner
 		if !mCmdRunner.doneCalled {
@@ -126,7 +126,7 @@ func TestRun(t *testing.T) {
 		}
 		ctx := context.Background()
 
-		Run(&ctx, &mCommunicator, &mCmdRunner, true)
+		Run(ctx, &mCommunicator, &mCmdRunner, true)
 
 		if !reflect.DeepEqual(ji, mCmdRunner.jobInfo) {
 			t.Errorf("expected %v but got %v", ji, mCmdRunner.jobInfo)
@@ -152,7 +152,7 @@ func TestRun(t *testing.T) {
 		}
 		ctx := context.Background()
 
-		Run(&ctx, &mCommunicator, &mCmdRunner, true)
+		Run(ctx, &mCommunicator, &mCmdRunner, true)
 
 		if !reflect.DeepEqual(js, mCommunicator.statusJobStatus) {
 			t.Errorf("expected %v but got %v", js, mCommunicator.statusJobStatus)
@@ -169,7 +169,7 @@ func TestRun(t *testing.T) {
 		mCommunicator := mockCommunicator{}
 		ctx := context.Background()
 
-		Run(&ctx, &mCommunicator, &mCmdRunner, true)
+		Run(ctx, &mCommunicator, &mCmdRunner, true)
 
 		if !reflect.DeepEqual(cr, mCommunicator.cmdResults) {
 			t.Errorf("expected %v but got %v", cr, mCommunicator.cmdResults)
@@ -186,11 +186,14 @@ func TestRun(t *testing.T) {
 		}
 		ctx := context.Background()
 
-		Run(&ctx, &mCommunicator, &mCmdRunner, true)
+		Run(ctx, &mCommunicator, &mCmdRunner, true)
 
 		if mCommunicator.jobCompleteCalled {
 			t.Errorf("SendJobComplete was unexpectedly called")
 		}
+		if !mCmdRunner.stopCalled {
+			t.Errorf("expected the command to be stopped")
+		}
 	})
 }
 
@@ -210,7 +213,7 @@ func TestIsContextFinished(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			out := IsContextFinished(&test.in)
+			out := IsContextFinished(test.in)
 
 			if out != test.out {
 				t.Errorf("expected %v but got %v", test.out, out)
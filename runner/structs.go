@@ -1,15 +1,30 @@
 package runner
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // JobInfo defines the information about a Job that is sent from the Controller.
 type JobInfo struct {
 	UUID          string
+	LibraryID     int // -1 if the Controller didn't say which library the job is from.
 	File          string
 	InFile        string
 	OutFile       string
+	CaptionsFile  string // Empty unless the command extracts closed captions
 	CommandArgs   []string
 	MediaDuration float32
+	Benchmark     bool // Benchmarks only report how the command performed, without sending the transcoded file.
+}
+
+// WithFields appends the UUID and library ID of the job to message as key=value pairs, like the fields of the
+// Controller's log records, so that the records of both about the same job can be matched up.
+func (j JobInfo) WithFields(message string) string {
+	if j.LibraryID < 0 {
+		return fmt.Sprintf("%v job_uuid=%v", message, j.UUID)
+	}
+	return fmt.Sprintf("%v job_uuid=%v library_id=%v", message, j.UUID, j.LibraryID)
 }
 
 // JobStatus defines the information to be reported about the current state of a running job.
@@ -26,6 +41,7 @@ type JobStatus struct {
 type CommandResults struct {
 	Failed         bool
 	JobElapsedTime time.Duration
+	FPS            float64 // The average frames per second that FFmpeg last reported.
 	Warnings       []string
 	Errors         []string
 }
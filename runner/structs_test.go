@@ -0,0 +1,22 @@
+package runner
+
+import "testing"
+
+func TestJobInfoWithFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		ji       JobInfo
+		expected string
+	}{
+		{name: "Library ID", ji: JobInfo{UUID: "abc", LibraryID: 0}, expected: "FFmpeg command finished job_uuid=abc library_id=0"},
+		{name: "Unknown Library", ji: JobInfo{UUID: "abc", LibraryID: -1}, expected: "FFmpeg command finished job_uuid=abc"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.ji.WithFields("FFmpeg command finished"); got != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, got)
+			}
+		})
+	}
+}